@@ -0,0 +1,258 @@
+// Programmatic access to the databases served by sqlite-tui, enabled with
+// server.api.listen. Callers authenticate with a bearer token from the
+// api-token command, sent in the "authorization" metadata.
+//
+// Regenerate the Go code with:
+//   protoc --go_out=. --go_opt=paths=source_relative \
+//     --go-grpc_out=. --go-grpc_opt=paths=source_relative api.proto
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.6.1
+// - protoc             (unknown)
+// source: api.proto
+
+package apipb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	SQLiteTUI_ListDatabases_FullMethodName = "/sqlitetui.v1.SQLiteTUI/ListDatabases"
+	SQLiteTUI_GetSchema_FullMethodName     = "/sqlitetui.v1.SQLiteTUI/GetSchema"
+	SQLiteTUI_Query_FullMethodName         = "/sqlitetui.v1.SQLiteTUI/Query"
+	SQLiteTUI_Export_FullMethodName        = "/sqlitetui.v1.SQLiteTUI/Export"
+)
+
+// SQLiteTUIClient is the client API for SQLiteTUI service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type SQLiteTUIClient interface {
+	// Databases the caller can read.
+	ListDatabases(ctx context.Context, in *ListDatabasesRequest, opts ...grpc.CallOption) (*ListDatabasesResponse, error)
+	// Tables and views of a database, or the columns of one table.
+	GetSchema(ctx context.Context, in *GetSchemaRequest, opts ...grpc.CallOption) (*GetSchemaResponse, error)
+	// Runs a statement. Reads stream their rows; writes return one message.
+	Query(ctx context.Context, in *QueryRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[QueryResponse], error)
+	// Streams every row of a table.
+	Export(ctx context.Context, in *ExportRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[QueryResponse], error)
+}
+
+type sQLiteTUIClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewSQLiteTUIClient(cc grpc.ClientConnInterface) SQLiteTUIClient {
+	return &sQLiteTUIClient{cc}
+}
+
+func (c *sQLiteTUIClient) ListDatabases(ctx context.Context, in *ListDatabasesRequest, opts ...grpc.CallOption) (*ListDatabasesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListDatabasesResponse)
+	err := c.cc.Invoke(ctx, SQLiteTUI_ListDatabases_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *sQLiteTUIClient) GetSchema(ctx context.Context, in *GetSchemaRequest, opts ...grpc.CallOption) (*GetSchemaResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetSchemaResponse)
+	err := c.cc.Invoke(ctx, SQLiteTUI_GetSchema_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *sQLiteTUIClient) Query(ctx context.Context, in *QueryRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[QueryResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &SQLiteTUI_ServiceDesc.Streams[0], SQLiteTUI_Query_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[QueryRequest, QueryResponse]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type SQLiteTUI_QueryClient = grpc.ServerStreamingClient[QueryResponse]
+
+func (c *sQLiteTUIClient) Export(ctx context.Context, in *ExportRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[QueryResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &SQLiteTUI_ServiceDesc.Streams[1], SQLiteTUI_Export_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ExportRequest, QueryResponse]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type SQLiteTUI_ExportClient = grpc.ServerStreamingClient[QueryResponse]
+
+// SQLiteTUIServer is the server API for SQLiteTUI service.
+// All implementations must embed UnimplementedSQLiteTUIServer
+// for forward compatibility.
+type SQLiteTUIServer interface {
+	// Databases the caller can read.
+	ListDatabases(context.Context, *ListDatabasesRequest) (*ListDatabasesResponse, error)
+	// Tables and views of a database, or the columns of one table.
+	GetSchema(context.Context, *GetSchemaRequest) (*GetSchemaResponse, error)
+	// Runs a statement. Reads stream their rows; writes return one message.
+	Query(*QueryRequest, grpc.ServerStreamingServer[QueryResponse]) error
+	// Streams every row of a table.
+	Export(*ExportRequest, grpc.ServerStreamingServer[QueryResponse]) error
+	mustEmbedUnimplementedSQLiteTUIServer()
+}
+
+// UnimplementedSQLiteTUIServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedSQLiteTUIServer struct{}
+
+func (UnimplementedSQLiteTUIServer) ListDatabases(context.Context, *ListDatabasesRequest) (*ListDatabasesResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method ListDatabases not implemented")
+}
+func (UnimplementedSQLiteTUIServer) GetSchema(context.Context, *GetSchemaRequest) (*GetSchemaResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method GetSchema not implemented")
+}
+func (UnimplementedSQLiteTUIServer) Query(*QueryRequest, grpc.ServerStreamingServer[QueryResponse]) error {
+	return status.Error(codes.Unimplemented, "method Query not implemented")
+}
+func (UnimplementedSQLiteTUIServer) Export(*ExportRequest, grpc.ServerStreamingServer[QueryResponse]) error {
+	return status.Error(codes.Unimplemented, "method Export not implemented")
+}
+func (UnimplementedSQLiteTUIServer) mustEmbedUnimplementedSQLiteTUIServer() {}
+func (UnimplementedSQLiteTUIServer) testEmbeddedByValue()                   {}
+
+// UnsafeSQLiteTUIServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to SQLiteTUIServer will
+// result in compilation errors.
+type UnsafeSQLiteTUIServer interface {
+	mustEmbedUnimplementedSQLiteTUIServer()
+}
+
+func RegisterSQLiteTUIServer(s grpc.ServiceRegistrar, srv SQLiteTUIServer) {
+	// If the following call panics, it indicates UnimplementedSQLiteTUIServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&SQLiteTUI_ServiceDesc, srv)
+}
+
+func _SQLiteTUI_ListDatabases_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListDatabasesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SQLiteTUIServer).ListDatabases(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SQLiteTUI_ListDatabases_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SQLiteTUIServer).ListDatabases(ctx, req.(*ListDatabasesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SQLiteTUI_GetSchema_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetSchemaRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SQLiteTUIServer).GetSchema(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SQLiteTUI_GetSchema_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SQLiteTUIServer).GetSchema(ctx, req.(*GetSchemaRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SQLiteTUI_Query_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(QueryRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(SQLiteTUIServer).Query(m, &grpc.GenericServerStream[QueryRequest, QueryResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type SQLiteTUI_QueryServer = grpc.ServerStreamingServer[QueryResponse]
+
+func _SQLiteTUI_Export_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ExportRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(SQLiteTUIServer).Export(m, &grpc.GenericServerStream[ExportRequest, QueryResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type SQLiteTUI_ExportServer = grpc.ServerStreamingServer[QueryResponse]
+
+// SQLiteTUI_ServiceDesc is the grpc.ServiceDesc for SQLiteTUI service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var SQLiteTUI_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "sqlitetui.v1.SQLiteTUI",
+	HandlerType: (*SQLiteTUIServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListDatabases",
+			Handler:    _SQLiteTUI_ListDatabases_Handler,
+		},
+		{
+			MethodName: "GetSchema",
+			Handler:    _SQLiteTUI_GetSchema_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Query",
+			Handler:       _SQLiteTUI_Query_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Export",
+			Handler:       _SQLiteTUI_Export_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "api.proto",
+}
@@ -3,18 +3,24 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
+	"log/slog"
 	"os"
+	"os/signal"
+	"time"
 
 	"github.com/johan-st/sqlite-tui/internal/access"
 	"github.com/johan-st/sqlite-tui/internal/cli"
 	"github.com/johan-st/sqlite-tui/internal/config"
 	"github.com/johan-st/sqlite-tui/internal/database"
-	"github.com/johan-st/sqlite-tui/internal/history"
-	"github.com/johan-st/sqlite-tui/internal/server"
+	"github.com/johan-st/sqlite-tui/internal/logging"
+	"github.com/johan-st/sqlite-tui/internal/tracing"
 	"github.com/johan-st/sqlite-tui/internal/tui"
+	"github.com/johan-st/sqlite-tui/pkg/sqlitetui"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"golang.org/x/term"
@@ -58,12 +64,25 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Config wizard: sqlite-tui config init [-o file] [-force]
+	if len(args) >= 2 && args[0] == "config" && args[1] == "init" {
+		if err := runConfigInit(args[2:]); err != nil {
+			log.Fatalf("Config init error: %v", err)
+		}
+		return
+	}
+
 	pathArg := args[0]
 	cmdArgs := args[1:] // Remaining args are command + args
 
 	if len(cmdArgs) > 0 {
 		// CLI mode: run command and exit
 		if err := runLocalCLI(pathArg, cmdArgs); err != nil {
+			// The command already reported its error, only propagate the code
+			var exitErr *cli.ExitError
+			if errors.As(err, &exitErr) {
+				os.Exit(exitErr.Code)
+			}
 			log.Fatalf("Error: %v", err)
 		}
 	} else {
@@ -81,6 +100,7 @@ func printUsage() {
 	fmt.Println("  sqlite-tui <path>                    Interactive TUI mode")
 	fmt.Println("  sqlite-tui <path> <command> [args]   CLI mode (run and exit)")
 	fmt.Println("  sqlite-tui -ssh -config <file>       SSH server mode")
+	fmt.Println("  sqlite-tui config init [-o <file>]   Create a config file interactively")
 	fmt.Println()
 	fmt.Println("Local mode examples:")
 	fmt.Println("  sqlite-tui mydb.db                   Open database in TUI")
@@ -96,6 +116,37 @@ func printUsage() {
 	flag.PrintDefaults()
 }
 
+// runConfigInit runs the interactive config wizard and writes the result
+func runConfigInit(args []string) error {
+	fs := flag.NewFlagSet("config init", flag.ExitOnError)
+	output := fs.String("o", "config.yaml", "path of the config file to write")
+	force := fs.Bool("force", false, "overwrite an existing config file")
+	fs.Parse(args)
+
+	if _, err := os.Stat(*output); err == nil && !*force {
+		return fmt.Errorf("%s already exists (use -force to overwrite)", *output)
+	}
+
+	answers, err := config.RunInitWizard(os.Stdin, os.Stdout)
+	if err != nil {
+		return err
+	}
+
+	data, err := config.RenderInitConfig(answers)
+	if err != nil {
+		return err
+	}
+
+	// The file may hold public keys only, but keep it private like the host key
+	if err := os.WriteFile(*output, data, 0600); err != nil {
+		return fmt.Errorf("failed to write config: %w", err)
+	}
+
+	fmt.Printf("\nWrote %s\n", *output)
+	fmt.Printf("Start the server with: sqlite-tui -ssh -config %s\n", *output)
+	return nil
+}
+
 // initLocal creates database manager and user for local mode
 func initLocal(pathArg string) (*database.Manager, *access.UserInfo, error) {
 	// Create minimal config from path argument
@@ -104,6 +155,11 @@ func initLocal(pathArg string) (*database.Manager, *access.UserInfo, error) {
 		Path:        pathArg,
 		Description: "Local database",
 	}}
+	key, err := promptKey(pathArg)
+	if err != nil {
+		return nil, nil, err
+	}
+	cfg.Databases[0].Key = key
 
 	// Initialize database manager
 	dbManager, err := database.NewManager(cfg)
@@ -124,6 +180,26 @@ func initLocal(pathArg string) (*database.Manager, *access.UserInfo, error) {
 	return dbManager, user, nil
 }
 
+// promptKey asks on the terminal for the key of a database file without a
+// SQLite header, which may be encrypted, when the build can open encrypted
+// databases. It returns "" for anything else.
+func promptKey(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() || !database.EncryptionSupported() ||
+		!errors.Is(database.CheckSQLiteFile(path), database.ErrNotSQLite) ||
+		!term.IsTerminal(int(os.Stdin.Fd())) {
+		return "", nil
+	}
+
+	fmt.Fprintf(os.Stderr, "Key for %s: ", path)
+	key, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("failed to read key: %w", err)
+	}
+	return string(key), nil
+}
+
 // runLocalCLI runs a CLI command in local mode
 func runLocalCLI(pathArg string, cmdArgs []string) error {
 	dbManager, user, err := initLocal(pathArg)
@@ -135,8 +211,15 @@ func runLocalCLI(pathArg string, cmdArgs []string) error {
 	// Create CLI handler (no history store in local mode)
 	handler := cli.NewHandler(dbManager, nil, version)
 
+	// Ctrl-C cancels a running query, which then fails with an error
+	sigCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
 	// Execute command using local context
 	ctx := cli.NewLocalContext(user, cmdArgs, os.Stdout, os.Stderr)
+	ctx.Ctx = sigCtx
+	ctx.In = os.Stdin
+	ctx.Interactive = term.IsTerminal(int(os.Stdin.Fd()))
 	return handler.HandleLocal(ctx)
 }
 
@@ -172,49 +255,36 @@ func runSSHServer(configPath string) error {
 		return fmt.Errorf("failed to load config: %w", err)
 	}
 
-	// Initialize history store
-	historyStore, err := history.NewStore(cfg.GetDataDir())
-	if err != nil {
-		return fmt.Errorf("failed to initialize history store: %w", err)
+	if err := logging.Setup(os.Stderr, cfg.Log); err != nil {
+		return fmt.Errorf("invalid log config: %w", err)
 	}
-	defer historyStore.Close()
 
-	// Initialize database manager
-	dbManager, err := database.NewManager(cfg)
-	if err != nil {
-		return fmt.Errorf("failed to initialize database manager: %w", err)
+	if err := tracing.Setup(cfg.Tracing, version); err != nil {
+		return err
 	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := tracing.Shutdown(ctx); err != nil {
+			slog.Warn("Failed to export remaining traces", "err", err)
+		}
+	}()
 
-	if err := dbManager.Start(); err != nil {
-		return fmt.Errorf("failed to start database manager: %w", err)
+	studio, err := sqlitetui.New(cfg, version)
+	if err != nil {
+		return err
 	}
-	defer dbManager.Stop()
+	defer studio.Close()
 
-	// Start config watcher for hot-reloading
-	configWatcher, err := config.NewWatcher(cfg)
-	if err != nil {
-		log.Printf("Warning: Failed to create config watcher: %v", err)
-	} else {
-		configWatcher.OnReload(func(newCfg *config.Config) {
-			log.Println("Config reloaded, updating resolver...")
-			dbManager.UpdateResolver(newCfg.BuildResolver())
-			dbManager.GetDiscovery().UpdateSources(newCfg.Databases)
-		})
-		if err := configWatcher.Start(); err != nil {
-			log.Printf("Warning: Failed to start config watcher: %v", err)
-		} else {
-			defer configWatcher.Stop()
+	// Hot-reload users, access rules and database sources
+	err = studio.WatchConfig(func(newCfg *config.Config) {
+		if err := logging.SetLevel(newCfg.Log.Level); err != nil {
+			slog.Warn("Keeping previous log level", "err", err)
 		}
+	})
+	if err != nil {
+		slog.Warn("Failed to start config watcher", "err", err)
 	}
 
-	// Create CLI handler
-	cliHandler := cli.NewHandler(dbManager, historyStore, version)
-
-	// Create and configure SSH server
-	sshServer := server.NewServer(cfg, dbManager, historyStore)
-	sshServer.SetCLIHandler(cliHandler.Handle)
-	sshServer.SetTUIHandler(tui.Handler(dbManager, historyStore))
-
-	log.Printf("Starting SSH server on %s", cfg.Server.SSH.Listen)
-	return sshServer.Start()
+	return studio.Server.Start()
 }
@@ -36,7 +36,7 @@ func (l Level) String() string {
 // ParseLevel parses a string into an access Level.
 func ParseLevel(s string) Level {
 	switch strings.ToLower(strings.TrimSpace(s)) {
-	case "none", "no-access":
+	case "none", "no-access", "deny":
 		return None
 	case "read-only", "readonly", "ro":
 		return ReadOnly
@@ -69,3 +69,41 @@ func (l Level) CanAdmin() bool {
 func (l Level) CanDownload() bool {
 	return l >= ReadOnly
 }
+
+// Visibility controls whether a database shows up in listings, separately
+// from whether it can be opened.
+type Visibility int
+
+const (
+	// VisibilityDefault lists the database when the user can read it.
+	VisibilityDefault Visibility = iota
+	// Hidden never lists the database; it is opened by naming it.
+	Hidden
+	// Listed lists the database (name and size) even when the user can't
+	// open it.
+	Listed
+)
+
+// String returns the string representation of the visibility.
+func (v Visibility) String() string {
+	switch v {
+	case Hidden:
+		return "hidden"
+	case Listed:
+		return "listed"
+	default:
+		return "default"
+	}
+}
+
+// ParseVisibility parses a string into a Visibility.
+func ParseVisibility(s string) Visibility {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "hidden":
+		return Hidden
+	case "listed", "visible":
+		return Listed
+	default:
+		return VisibilityDefault
+	}
+}
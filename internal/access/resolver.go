@@ -1,6 +1,8 @@
 package access
 
 import (
+	"net"
+	"net/netip"
 	"path/filepath"
 	"strings"
 
@@ -11,6 +13,18 @@ import (
 type Rule struct {
 	Pattern string
 	Level   Level
+
+	// From limits the rule to clients connecting from these addresses or
+	// CIDR ranges; empty applies it to all
+	From []string
+
+	// NoDownload forbids downloading the raw database file even when the
+	// level allows reading
+	NoDownload bool
+
+	// Visibility decides whether the database is listed, independently of
+	// the level
+	Visibility Visibility
 }
 
 // Resolver resolves access levels for users and databases.
@@ -24,17 +38,54 @@ type Resolver struct {
 	// User-specific rules (keyed by username)
 	UserRules map[string][]Rule
 
+	// Group rules (keyed by group name)
+	GroupRules map[string][]Rule
+
+	// Groups each user belongs to, in the order they are checked (keyed by
+	// username)
+	UserGroups map[string][]string
+
 	// Admin usernames (have full access to everything)
 	Admins map[string]bool
+
+	// CLI commands each user may run (keyed by username); users without an
+	// entry may run all commands
+	UserCommands map[string]map[string]bool
+
+	// Row filters (keyed by username)
+	UserRowFilters map[string][]RowFilter
+
+	// TOTP secrets of users enrolled in a second factor (keyed by username)
+	UserTOTP map[string]string
+
+	// Usernames allowed to run single commands as admin with sudo
+	Sudoers map[string]bool
 }
 
+// RowFilter limits the rows of a table a user sees to those matching a
+// WHERE predicate, in databases matching Pattern.
+type RowFilter struct {
+	Pattern string
+	Table   string
+	Where   string
+}
+
+// alwaysAllowedCommands can be run whatever a user's command list says.
+var alwaysAllowedCommands = map[string]bool{"help": true, "version": true, "whoami": true}
+
 // NewResolver creates a new access resolver.
 func NewResolver() *Resolver {
 	return &Resolver{
 		AnonymousAccess: None,
 		PublicRules:     make([]Rule, 0),
 		UserRules:       make(map[string][]Rule),
+		GroupRules:      make(map[string][]Rule),
+		UserGroups:      make(map[string][]string),
 		Admins:          make(map[string]bool),
+		UserCommands:    make(map[string]map[string]bool),
+		UserRowFilters:  make(map[string][]RowFilter),
+		UserTOTP:        make(map[string]string),
+		Sudoers:         make(map[string]bool),
 	}
 }
 
@@ -50,7 +101,12 @@ func (r *Resolver) AddAdmin(username string) {
 
 // AddPublicRule adds a public database rule.
 func (r *Resolver) AddPublicRule(pattern string, level Level) {
-	r.PublicRules = append(r.PublicRules, Rule{Pattern: pattern, Level: level})
+	r.AddPublicRules(Rule{Pattern: pattern, Level: level})
+}
+
+// AddPublicRules adds public access rules.
+func (r *Resolver) AddPublicRules(rules ...Rule) {
+	r.PublicRules = append(r.PublicRules, rules...)
 }
 
 // AddUserRule adds an access rule for a specific user.
@@ -58,44 +114,306 @@ func (r *Resolver) AddUserRule(username, pattern string, level Level) {
 	r.UserRules[username] = append(r.UserRules[username], Rule{Pattern: pattern, Level: level})
 }
 
+// AddGroupRule adds an access rule for a group.
+func (r *Resolver) AddGroupRule(group, pattern string, level Level) {
+	r.AddGroupRules(group, Rule{Pattern: pattern, Level: level})
+}
+
+// AddUserRules adds access rules for a user.
+func (r *Resolver) AddUserRules(username string, rules ...Rule) {
+	r.UserRules[username] = append(r.UserRules[username], rules...)
+}
+
+// AddGroupRules adds access rules for a group.
+func (r *Resolver) AddGroupRules(group string, rules ...Rule) {
+	r.GroupRules[group] = append(r.GroupRules[group], rules...)
+}
+
+// AddGroupMember adds a user to a group. Adding a user twice has no effect.
+func (r *Resolver) AddGroupMember(group, username string) {
+	for _, g := range r.UserGroups[username] {
+		if g == group {
+			return
+		}
+	}
+	r.UserGroups[username] = append(r.UserGroups[username], group)
+}
+
+// GroupsOf returns the groups a user belongs to.
+func (r *Resolver) GroupsOf(user *UserInfo) []string {
+	if user == nil || user.IsAnonymous {
+		return nil
+	}
+	return r.UserGroups[user.Name]
+}
+
+// SetUserCommands restricts a user to the given CLI commands.
+func (r *Resolver) SetUserCommands(username string, commands []string) {
+	allowed := make(map[string]bool, len(commands))
+	for _, c := range commands {
+		allowed[strings.ToLower(strings.TrimSpace(c))] = true
+	}
+	r.UserCommands[username] = allowed
+}
+
+// CommandAllowed reports whether a user may run a CLI command. Command
+// lists apply to named users only; "list" is checked as "ls".
+func (r *Resolver) CommandAllowed(user *UserInfo, command string) bool {
+	if command == "list" {
+		command = "ls"
+	}
+	if alwaysAllowedCommands[command] || user == nil || user.IsAnonymous {
+		return true
+	}
+	allowed, ok := r.UserCommands[user.Name]
+	return !ok || allowed[command]
+}
+
+// SetUserTOTP enrolls a user in TOTP with a base32 secret.
+func (r *Resolver) SetUserTOTP(username, secret string) {
+	r.UserTOTP[username] = secret
+}
+
+// TOTPSecret returns the user's TOTP secret, or "" if they aren't enrolled.
+func (r *Resolver) TOTPSecret(user *UserInfo) string {
+	if user == nil || user.IsAnonymous {
+		return ""
+	}
+	return r.UserTOTP[user.Name]
+}
+
+// AddSudoer lets a user run single commands as admin with sudo.
+func (r *Resolver) AddSudoer(username string) {
+	r.Sudoers[username] = true
+}
+
+// CanSudo reports whether a user may run commands as admin with sudo.
+func (r *Resolver) CanSudo(user *UserInfo) bool {
+	if user == nil || user.IsAnonymous {
+		return false
+	}
+	return r.Sudoers[user.Name]
+}
+
+// AddRowFilter adds a row filter for a user.
+func (r *Resolver) AddRowFilter(username string, filter RowFilter) {
+	r.UserRowFilters[username] = append(r.UserRowFilters[username], filter)
+}
+
+// RowFilters returns the WHERE predicates limiting what a user sees in a
+// database, keyed by table. Several filters on one table are combined with
+// AND. Admins and anonymous users are never filtered.
+func (r *Resolver) RowFilters(user *UserInfo, dbPath, dbAlias string) map[string]string {
+	if user == nil || user.IsAnonymous || user.IsAdmin || r.Admins[user.Name] {
+		return nil
+	}
+
+	var filters map[string]string
+	for _, f := range r.UserRowFilters[user.Name] {
+		if !matchPattern(f.Pattern, dbPath, dbAlias) {
+			continue
+		}
+		if filters == nil {
+			filters = make(map[string]string)
+		}
+		where := "(" + f.Where + ")"
+		if prev, ok := filters[f.Table]; ok {
+			where = prev + " AND " + where
+		}
+		filters[f.Table] = where
+	}
+	return filters
+}
+
 // Resolve determines the access level for a user to a specific database.
 // The database can be identified by path or alias.
 func (r *Resolver) Resolve(user *UserInfo, dbPath, dbAlias string) Level {
+	return r.resolveRule(user, dbPath, dbAlias).Level
+}
+
+// CanDownload reports whether a user may download the raw database file:
+// the access level must allow it and the deciding rule must not forbid it.
+func (r *Resolver) CanDownload(user *UserInfo, dbPath, dbAlias string) bool {
+	rule := r.resolveRule(user, dbPath, dbAlias)
+	return rule.Level.CanDownload() && !rule.NoDownload
+}
+
+// Listed reports whether a database shows up in the user's listings.
+// Admins see every database.
+func (r *Resolver) Listed(user *UserInfo, dbPath, dbAlias string) bool {
+	rule := r.resolveRule(user, dbPath, dbAlias)
+	switch rule.Visibility {
+	case Hidden:
+		return false
+	case Listed:
+		return true
+	default:
+		return rule.Level.CanRead()
+	}
+}
+
+// ResolveTable determines the access level for a user to a table. Rules of
+// the form alias/table apply to the tables they match, as well as the
+// database's own rules; they can only lower the database's level.
+func (r *Resolver) ResolveTable(user *UserInfo, dbPath, dbAlias, table string) Level {
+	level := r.Resolve(user, dbPath, dbAlias)
+	if tableLevel := r.resolveTableRule(user, dbPath, dbAlias, table).Level; tableLevel < level {
+		return tableLevel
+	}
+	return level
+}
+
+// HasTableRules reports whether any alias/table rule could apply to a user
+// in a database, so callers can skip per-table checks when there are none.
+func (r *Resolver) HasTableRules(user *UserInfo, dbAlias string) bool {
+	if user != nil && (user.IsAdmin || (!user.IsAnonymous && r.Admins[user.Name])) {
+		return false
+	}
+	hasTable := func(rules []Rule) bool {
+		for _, rule := range rules {
+			if db, _, ok := splitTablePattern(rule.Pattern); ok {
+				if matched, _ := doublestar.Match(db, dbAlias); matched {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	if user != nil && !user.IsAnonymous && hasTable(r.UserRules[user.Name]) {
+		return true
+	}
+	for _, group := range r.GroupsOf(user) {
+		if hasTable(r.GroupRules[group]) {
+			return true
+		}
+	}
+	return hasTable(r.PublicRules)
+}
+
+// resolveRule returns the rule deciding a user's access to a database.
+func (r *Resolver) resolveRule(user *UserInfo, dbPath, dbAlias string) Rule {
+	return r.resolveTableRule(user, dbPath, dbAlias, "")
+}
+
+// resolveTableRule returns the rule deciding a user's access to a table, or
+// to the database itself when table is empty.
+func (r *Resolver) resolveTableRule(user *UserInfo, dbPath, dbAlias, table string) Rule {
 	// 1. If user is admin (either via flag or in admin list), they have full access
 	if user != nil && user.IsAdmin {
-		return Admin
+		return Rule{Level: Admin}
 	}
 	if user != nil && !user.IsAnonymous && r.Admins[user.Name] {
-		return Admin
+		return Rule{Level: Admin}
+	}
+
+	var remoteAddr string
+	if user != nil {
+		remoteAddr = user.RemoteAddr
 	}
 
 	// 2. Check user-specific rules
 	if user != nil && !user.IsAnonymous {
 		if rules, ok := r.UserRules[user.Name]; ok {
-			if level, matched := matchRules(rules, dbPath, dbAlias); matched {
-				return level
+			if rule, matched := matchRules(rules, dbPath, dbAlias, table, remoteAddr); matched {
+				return rule
 			}
 		}
 	}
 
-	// 3. Check public rules
-	if level, matched := matchRules(r.PublicRules, dbPath, dbAlias); matched {
-		return level
+	// 3. Check the rules of the user's groups, in membership order
+	for _, group := range r.GroupsOf(user) {
+		if rule, matched := matchRules(r.GroupRules[group], dbPath, dbAlias, table, remoteAddr); matched {
+			return rule
+		}
+	}
+
+	// 4. Check public rules
+	if rule, matched := matchRules(r.PublicRules, dbPath, dbAlias, table, remoteAddr); matched {
+		return rule
 	}
 
-	// 4. Fall back to anonymous access level
-	return r.AnonymousAccess
+	// 5. Fall back to anonymous access level
+	return Rule{Level: r.AnonymousAccess}
 }
 
-// matchRules finds the first matching rule and returns its level.
-// Returns the level and true if a rule matched, or None and false if no match.
-func matchRules(rules []Rule, dbPath, dbAlias string) (Level, bool) {
+// matchRules finds the first matching rule.
+// Returns the rule and true if a rule matched, or false if no match.
+// A matching None rule counts as a match, so it denies access and stops
+// later rules (and public rules) from granting it. Rules limited to other
+// source addresses are skipped. With a table, alias/table rules for that
+// table are more specific and win over the database's own rules.
+func matchRules(rules []Rule, dbPath, dbAlias, table, remoteAddr string) (Rule, bool) {
+	if table != "" {
+		for _, rule := range rules {
+			if matchTablePattern(rule.Pattern, dbAlias, table) && SourceAllowed(remoteAddr, rule.From) {
+				return rule, true
+			}
+		}
+	}
 	for _, rule := range rules {
-		if matchPattern(rule.Pattern, dbPath, dbAlias) {
-			return rule.Level, true
+		if matchPattern(rule.Pattern, dbPath, dbAlias) && SourceAllowed(remoteAddr, rule.From) {
+			return rule, true
 		}
 	}
-	return None, false
+	return Rule{Level: None}, false
+}
+
+// splitTablePattern splits a pattern of the form alias/table, e.g.
+// "prod*/audit_*". Paths such as "data/*.db" or "/srv/app.db" are not
+// table patterns.
+func splitTablePattern(pattern string) (db, table string, ok bool) {
+	pattern = strings.TrimSpace(pattern)
+	if pattern == "" || strings.ContainsAny(pattern[:1], "/.~") || strings.Count(pattern, "/") != 1 {
+		return "", "", false
+	}
+	db, table, _ = strings.Cut(pattern, "/")
+	if db == "" || table == "" || strings.Contains(table, ".") {
+		return "", "", false
+	}
+	return db, table, true
+}
+
+// matchTablePattern checks if an alias/table pattern matches a table in the
+// database with the given alias.
+func matchTablePattern(pattern, dbAlias, table string) bool {
+	dbPattern, tablePattern, ok := splitTablePattern(pattern)
+	if !ok || dbAlias == "" {
+		return false
+	}
+	if matched, _ := doublestar.Match(dbPattern, dbAlias); !matched {
+		return false
+	}
+	matched, _ := doublestar.Match(tablePattern, table)
+	return matched
+}
+
+// SourceAllowed reports whether remoteAddr (host or host:port) is one of the
+// addresses or CIDR ranges in from. An empty list allows any address;
+// otherwise an unknown address or a list of invalid entries allows none.
+func SourceAllowed(remoteAddr string, from []string) bool {
+	if len(from) == 0 {
+		return true
+	}
+	host := remoteAddr
+	if h, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		host = h
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+	ip = ip.Unmap()
+	for _, entry := range from {
+		entry = strings.TrimSpace(entry)
+		if prefix, err := netip.ParsePrefix(entry); err == nil {
+			if prefix.Contains(ip) {
+				return true
+			}
+		} else if addr, err := netip.ParseAddr(entry); err == nil && addr.Unmap() == ip {
+			return true
+		}
+	}
+	return false
 }
 
 // matchPattern checks if a pattern matches a database path or alias.
@@ -242,3 +242,272 @@ func TestResolver_NilUser(t *testing.T) {
 		t.Errorf("nil user access = %v, want ReadOnly", level)
 	}
 }
+
+func TestResolver_CommandAllowed(t *testing.T) {
+	r := NewResolver()
+	r.SetUserCommands("analyst", []string{"query", "select", "export", "ls"})
+
+	analyst := &UserInfo{Name: "analyst"}
+	tests := []struct {
+		user    *UserInfo
+		command string
+		want    bool
+	}{
+		{analyst, "query", true},
+		{analyst, "list", true}, // alias of ls
+		{analyst, "download", false},
+		{analyst, "drop-table", false},
+		{analyst, "help", true}, // always allowed
+		{&UserInfo{Name: "other"}, "download", true},
+		{&UserInfo{Name: "analyst", IsAnonymous: true, AnonymousName: "analyst"}, "download", true},
+	}
+	for _, tt := range tests {
+		if got := r.CommandAllowed(tt.user, tt.command); got != tt.want {
+			t.Errorf("CommandAllowed(%s, %q) = %v, want %v", tt.user.DisplayName(), tt.command, got, tt.want)
+		}
+	}
+}
+
+func TestResolver_RowFilters(t *testing.T) {
+	r := NewResolver()
+	r.AddRowFilter("tenant", RowFilter{Pattern: "shop", Table: "orders", Where: "tenant_id = 42"})
+	r.AddRowFilter("tenant", RowFilter{Pattern: "*", Table: "orders", Where: "deleted = 0"})
+	r.AddRowFilter("tenant", RowFilter{Pattern: "other", Table: "users", Where: "id = 1"})
+
+	got := r.RowFilters(&UserInfo{Name: "tenant"}, "/data/shop.db", "shop")
+	want := map[string]string{"orders": "(tenant_id = 42) AND (deleted = 0)"}
+	if len(got) != len(want) || got["orders"] != want["orders"] {
+		t.Errorf("RowFilters() = %v, want %v", got, want)
+	}
+
+	if got := r.RowFilters(&UserInfo{Name: "tenant", IsAdmin: true}, "/data/shop.db", "shop"); got != nil {
+		t.Errorf("expected admins to be unfiltered, got %v", got)
+	}
+	if got := r.RowFilters(&UserInfo{Name: "someone"}, "/data/shop.db", "shop"); got != nil {
+		t.Errorf("expected users without filters to be unfiltered, got %v", got)
+	}
+}
+
+func TestResolver_DenyRules(t *testing.T) {
+	r := NewResolver()
+	r.AddPublicRule("/data/secrets.db", None)
+	r.AddPublicRule("/data/*", ReadOnly)
+	r.AddUserRule("alice", "/data/private.db", ParseLevel("deny"))
+	r.AddUserRule("alice", "/data/*", ReadWrite)
+
+	tests := []struct {
+		name string
+		user *UserInfo
+		path string
+		want Level
+	}{
+		{"public deny before allow", &UserInfo{Name: "anon", IsAnonymous: true}, "/data/secrets.db", None},
+		{"public allow", &UserInfo{Name: "anon", IsAnonymous: true}, "/data/shop.db", ReadOnly},
+		{"user deny before allow", &UserInfo{Name: "alice"}, "/data/private.db", None},
+		{"user allow", &UserInfo{Name: "alice"}, "/data/shop.db", ReadWrite},
+		{"user without rules falls back to public deny", &UserInfo{Name: "bob"}, "/data/secrets.db", None},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := r.Resolve(tt.user, tt.path, ""); got != tt.want {
+				t.Errorf("Resolve() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolver_Groups(t *testing.T) {
+	r := NewResolver()
+	r.AddGroupRule("analysts", "/data/reports/*", ReadOnly)
+	r.AddGroupRule("analysts", "/data/secrets.db", None)
+	r.AddGroupRule("engineers", "/data/*", ReadWrite)
+	r.AddGroupMember("analysts", "alice")
+	r.AddGroupMember("engineers", "alice")
+	r.AddGroupMember("analysts", "alice") // duplicate is ignored
+	r.AddUserRule("alice", "/data/reports/q1.db", ReadWrite)
+	r.AddPublicRule("*", ReadOnly)
+
+	alice := &UserInfo{Name: "alice"}
+	tests := []struct {
+		name string
+		user *UserInfo
+		path string
+		want Level
+	}{
+		{"user rule before group", alice, "/data/reports/q1.db", ReadWrite},
+		{"first group", alice, "/data/reports/q2.db", ReadOnly},
+		{"group deny", alice, "/data/secrets.db", None},
+		{"second group", alice, "/data/app.db", ReadWrite},
+		{"public after groups", alice, "/other/x.db", ReadOnly},
+		{"non-member", &UserInfo{Name: "bob"}, "/data/app.db", ReadOnly},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := r.Resolve(tt.user, tt.path, ""); got != tt.want {
+				t.Errorf("Resolve() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if got := r.GroupsOf(alice); len(got) != 2 || got[0] != "analysts" || got[1] != "engineers" {
+		t.Errorf("GroupsOf() = %v, want [analysts engineers]", got)
+	}
+}
+
+func TestResolver_RuleSourceAddress(t *testing.T) {
+	r := NewResolver()
+	r.AddUserRules("alice",
+		Rule{Pattern: "*", Level: ReadWrite, From: []string{"10.8.0.0/16", "192.168.1.5"}},
+		Rule{Pattern: "*", Level: ReadOnly},
+	)
+
+	tests := []struct {
+		addr string
+		want Level
+	}{
+		{"10.8.3.4:51234", ReadWrite},
+		{"192.168.1.5:22", ReadWrite},
+		{"[::ffff:10.8.0.1]:22", ReadWrite},
+		{"203.0.113.9:22", ReadOnly},
+		{"", ReadOnly},
+	}
+	for _, tt := range tests {
+		if got := r.Resolve(&UserInfo{Name: "alice", RemoteAddr: tt.addr}, "/data/app.db", "app"); got != tt.want {
+			t.Errorf("Resolve(from %q) = %v, want %v", tt.addr, got, tt.want)
+		}
+	}
+}
+
+func TestSourceAllowed(t *testing.T) {
+	tests := []struct {
+		addr string
+		from []string
+		want bool
+	}{
+		{"203.0.113.9:22", nil, true},
+		{"10.1.2.3:22", []string{"10.0.0.0/8"}, true},
+		{"10.1.2.3", []string{"10.0.0.0/8"}, true},
+		{"11.1.2.3:22", []string{"10.0.0.0/8"}, false},
+		{"[2001:db8::1]:22", []string{"2001:db8::/32"}, true},
+		{"10.1.2.3:22", []string{"not-an-address"}, false},
+		{"unknown", []string{"10.0.0.0/8"}, false},
+	}
+	for _, tt := range tests {
+		if got := SourceAllowed(tt.addr, tt.from); got != tt.want {
+			t.Errorf("SourceAllowed(%q, %v) = %v, want %v", tt.addr, tt.from, got, tt.want)
+		}
+	}
+}
+
+func TestResolver_CanDownload(t *testing.T) {
+	r := NewResolver()
+	r.AddUserRules("analyst",
+		Rule{Pattern: "reports", Level: ReadOnly, NoDownload: true},
+		Rule{Pattern: "*", Level: ReadOnly},
+	)
+	r.AddPublicRules(Rule{Pattern: "demo", Level: ReadOnly, NoDownload: true})
+
+	analyst := &UserInfo{Name: "analyst"}
+	if r.CanDownload(analyst, "/data/reports.db", "reports") {
+		t.Error("expected download to be forbidden by the rule")
+	}
+	if !r.Resolve(analyst, "/data/reports.db", "reports").CanRead() {
+		t.Error("expected read access to remain")
+	}
+	if !r.CanDownload(analyst, "/data/app.db", "app") {
+		t.Error("expected download to be allowed by the fallback rule")
+	}
+	if r.CanDownload(&UserInfo{Name: "anon", IsAnonymous: true}, "/data/demo.db", "demo") {
+		t.Error("expected public download to be forbidden")
+	}
+	if !r.CanDownload(&UserInfo{Name: "root", IsAdmin: true}, "/data/reports.db", "reports") {
+		t.Error("expected admins to always download")
+	}
+}
+
+func TestResolver_Visibility(t *testing.T) {
+	r := NewResolver()
+	r.AddUserRules("alice",
+		Rule{Pattern: "secrets", Level: ReadOnly, Visibility: Hidden},
+		Rule{Pattern: "payroll", Level: None, Visibility: Listed},
+		Rule{Pattern: "*", Level: ReadOnly},
+	)
+	alice := &UserInfo{Name: "alice"}
+	admin := &UserInfo{Name: "root", IsAdmin: true}
+
+	tests := []struct {
+		alias     string
+		user      *UserInfo
+		wantLevel Level
+		wantList  bool
+	}{
+		{"secrets", alice, ReadOnly, false},
+		{"payroll", alice, None, true},
+		{"app", alice, ReadOnly, true},
+		{"secrets", admin, Admin, true},
+		{"app", &UserInfo{Name: "bob"}, None, false},
+	}
+	for _, tt := range tests {
+		path := "/data/" + tt.alias + ".db"
+		if got := r.Resolve(tt.user, path, tt.alias); got != tt.wantLevel {
+			t.Errorf("Resolve(%s, %s) = %v, want %v", tt.user.Name, tt.alias, got, tt.wantLevel)
+		}
+		if got := r.Listed(tt.user, path, tt.alias); got != tt.wantList {
+			t.Errorf("Listed(%s, %s) = %v, want %v", tt.user.Name, tt.alias, got, tt.wantList)
+		}
+	}
+}
+
+func TestResolver_TablePatterns(t *testing.T) {
+	r := NewResolver()
+	r.AddUserRules("alice",
+		Rule{Pattern: "prod*", Level: ReadWrite},
+		Rule{Pattern: "prod*/audit_*", Level: None},
+		Rule{Pattern: "prod/config", Level: ReadOnly},
+		Rule{Pattern: "data/*.db", Level: ReadOnly},
+	)
+	r.AddPublicRule("staging/secrets", Admin)
+	alice := &UserInfo{Name: "alice"}
+	admin := &UserInfo{Name: "root", IsAdmin: true}
+
+	tests := []struct {
+		alias string
+		table string
+		user  *UserInfo
+		want  Level
+	}{
+		{"prod", "users", alice, ReadWrite},
+		{"prod", "audit_log", alice, None},
+		{"prod-eu", "audit_2024", alice, None},
+		{"prod", "config", alice, ReadOnly},
+		{"prod-eu", "config", alice, ReadWrite},
+		{"staging", "secrets", alice, None},
+		{"prod", "audit_log", admin, Admin},
+	}
+	for _, tt := range tests {
+		path := "/srv/" + tt.alias + ".db"
+		if got := r.ResolveTable(tt.user, path, tt.alias, tt.table); got != tt.want {
+			t.Errorf("ResolveTable(%s, %s/%s) = %v, want %v", tt.user.Name, tt.alias, tt.table, got, tt.want)
+		}
+	}
+
+	// Table patterns never decide access to a whole database
+	if got := r.Resolve(alice, "/srv/prod.db", "prod"); got != ReadWrite {
+		t.Errorf("Resolve(alice, prod) = %v, want %v", got, ReadWrite)
+	}
+	if !r.HasTableRules(alice, "prod-eu") {
+		t.Error("HasTableRules(alice, prod-eu) = false, want true")
+	}
+	if r.HasTableRules(alice, "dev") {
+		t.Error("HasTableRules(alice, dev) = true, want false")
+	}
+	if r.HasTableRules(admin, "prod") {
+		t.Error("HasTableRules(admin, prod) = true, want false")
+	}
+
+	for _, p := range []string{"data/*.db", "/srv/app.db", "./app", "a/b/c", "app"} {
+		if _, _, ok := splitTablePattern(p); ok {
+			t.Errorf("splitTablePattern(%q) treated a path as a table pattern", p)
+		}
+	}
+}
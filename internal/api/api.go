@@ -0,0 +1,312 @@
+// Package api exposes the database manager's operations — listing, schema,
+// queries and exports — as a service for other Go programs. The RPCs and
+// messages are defined in apipb/api.proto; Service implements them with
+// plain Go types, and Server serves them over gRPC to callers holding a
+// token from the api-token command.
+//
+// The transport authenticates callers and attaches the user with WithUser;
+// the service then applies the same access rules, limits and timeouts as
+// SSH sessions.
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/johan-st/sqlite-tui/internal/access"
+	"github.com/johan-st/sqlite-tui/internal/database"
+	"github.com/johan-st/sqlite-tui/internal/history"
+)
+
+// batchSize is the number of rows sent per streamed message.
+const batchSize = 100
+
+var (
+	// ErrUnauthenticated is returned when the context carries no user.
+	ErrUnauthenticated = errors.New("unauthenticated")
+	// ErrInvalidArgument is returned for malformed requests.
+	ErrInvalidArgument = errors.New("invalid argument")
+)
+
+type ctxKey struct{}
+
+// WithUser returns a context carrying the authenticated user.
+func WithUser(ctx context.Context, user *access.UserInfo) context.Context {
+	return context.WithValue(ctx, ctxKey{}, user)
+}
+
+// UserFromContext returns the user attached by WithUser, or nil.
+func UserFromContext(ctx context.Context) *access.UserInfo {
+	user, _ := ctx.Value(ctxKey{}).(*access.UserInfo)
+	return user
+}
+
+// Database describes a database the caller can read.
+type Database struct {
+	Alias       string
+	Description string
+	Size        int64
+	AccessLevel string
+}
+
+// SchemaRequest asks for the tables of a database, or for one table.
+type SchemaRequest struct {
+	Database string
+	Table    string
+}
+
+// Schema lists tables and views; Table is set when one was requested.
+type Schema struct {
+	Tables []string
+	Views  []string
+	Table  *database.TableInfo
+}
+
+// QueryRequest runs SQL against a database.
+type QueryRequest struct {
+	Database string
+	SQL      string
+	Args     []any
+	TOTP     string // code for DROP and DELETE from users enrolled in TOTP
+}
+
+// ExportRequest streams all rows of a table.
+type ExportRequest struct {
+	Database string
+	Table    string
+}
+
+// QueryResponse is one streamed message. The first message of a read has
+// Columns; later ones have Rows. Values are nil, int64, float64, string or
+// []byte; query results may also hold a database.TruncatedValue for values
+// over database.MaxCellSize. A write sends one message with RowsAffected
+// and LastInsertID. Truncated, on the last message, says why rows were
+// left out.
+type QueryResponse struct {
+	Columns      []string
+	Rows         [][]any
+	RowsAffected int64
+	LastInsertID int64
+	Truncated    string
+}
+
+// QueryStream receives streamed responses.
+type QueryStream interface {
+	Context() context.Context
+	Send(*QueryResponse) error
+}
+
+// Service implements the API on top of a database manager.
+type Service struct {
+	dbManager    *database.Manager
+	historyStore *history.Store
+}
+
+// NewService creates the API service. Queries are recorded in historyStore
+// if it is not nil.
+func NewService(dbManager *database.Manager, historyStore *history.Store) *Service {
+	return &Service{dbManager: dbManager, historyStore: historyStore}
+}
+
+func user(ctx context.Context) (*access.UserInfo, error) {
+	if u := UserFromContext(ctx); u != nil {
+		return u, nil
+	}
+	return nil, ErrUnauthenticated
+}
+
+// ListDatabases returns the databases listed for the caller. Some may be
+// listed with access level "none".
+func (s *Service) ListDatabases(ctx context.Context) ([]Database, error) {
+	u, err := user(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var dbs []Database
+	for _, db := range s.dbManager.ListDatabases(u) {
+		dbs = append(dbs, Database{
+			Alias:       db.Alias,
+			Description: db.Description,
+			Size:        db.Size,
+			AccessLevel: db.AccessLevel.String(),
+		})
+	}
+	return dbs, nil
+}
+
+// GetSchema returns the tables and views of a database, and the details of
+// req.Table if set.
+func (s *Service) GetSchema(ctx context.Context, req *SchemaRequest) (*Schema, error) {
+	u, err := user(ctx)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := s.dbManager.OpenConnection(req.Database, u)
+	if err != nil {
+		return nil, err
+	}
+
+	schema := database.NewSchema(conn)
+	res := &Schema{}
+	if res.Tables, err = schema.ListTables(); err != nil {
+		return nil, err
+	}
+	res.Tables = s.dbManager.FilterTables(u, req.Database, res.Tables)
+	if res.Views, err = schema.ListViews(); err != nil {
+		return nil, err
+	}
+	if req.Table != "" {
+		if !s.dbManager.TableAccessLevel(u, req.Database, req.Table).CanRead() {
+			return nil, fmt.Errorf("%w to table: %s", database.ErrAccessDenied, req.Table)
+		}
+		if res.Table, err = schema.GetTableInfo(req.Table); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// Query runs req.SQL through the manager, which checks access, applies
+// the caller's query limits and timeout and takes the write lock for
+// writes. The result is then sent in batches.
+func (s *Service) Query(req *QueryRequest, stream QueryStream) error {
+	u, err := user(stream.Context())
+	if err != nil {
+		return err
+	}
+
+	// Each call gets its own lock session; the lock is re-entrant per
+	// session
+	sessionID := "api-" + uuid.New().String()
+	ctx := stream.Context()
+	if req.TOTP != "" {
+		ctx = database.WithTOTP(ctx, req.TOTP)
+	}
+	start := time.Now()
+	res, err := s.dbManager.ExecuteQueryArgs(ctx, req.Database, u, sessionID, req.SQL, req.Args...)
+	s.recordQuery(u, sessionID, req.Database, req.SQL, start, res, err)
+	if err != nil {
+		return err
+	}
+	if !res.IsSelect {
+		return stream.Send(&QueryResponse{RowsAffected: res.RowsAffected, LastInsertID: res.LastInsertID})
+	}
+
+	if err := stream.Send(&QueryResponse{Columns: res.Columns}); err != nil {
+		return err
+	}
+	for rows := res.Rows; len(rows) > 0; {
+		n := min(batchSize, len(rows))
+		msg := &QueryResponse{Rows: rows[:n]}
+		if rows = rows[n:]; len(rows) == 0 {
+			msg.Truncated = res.TruncationNote()
+		}
+		if err := stream.Send(msg); err != nil {
+			return err
+		}
+	}
+	if len(res.Rows) == 0 && res.Truncated {
+		return stream.Send(&QueryResponse{Truncated: res.TruncationNote()})
+	}
+	return nil
+}
+
+// Export streams the rows of a table as they are read, up to the caller's
+// export row limit and within their query timeout.
+func (s *Service) Export(req *ExportRequest, stream QueryStream) error {
+	u, err := user(stream.Context())
+	if err != nil {
+		return err
+	}
+	if !s.dbManager.GetAccessLevel(u, req.Database).CanRead() {
+		return fmt.Errorf("%w to database: %s", database.ErrAccessDenied, req.Database)
+	}
+	if !s.dbManager.TableAccessLevel(u, req.Database, req.Table).CanRead() {
+		return fmt.Errorf("%w to table: %s", database.ErrAccessDenied, req.Table)
+	}
+	conn, err := s.dbManager.OpenConnection(req.Database, u)
+	if err != nil {
+		return err
+	}
+
+	// One row past the cap shows that the export was cut off
+	rowCap := s.dbManager.ExportRowLimit(u, req.Database)
+	opts := database.SelectOptions{}
+	if rowCap > 0 {
+		opts.Limit = rowCap + 1
+	}
+
+	return s.dbManager.RunWithQueryTimeout(stream.Context(), u, req.Database, func(ctx context.Context) error {
+		rows, err := database.SelectRows(ctx, conn, req.Table, opts)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		if err := stream.Send(&QueryResponse{Columns: rows.Columns()}); err != nil {
+			return err
+		}
+		batch := make([][]any, 0, batchSize)
+		written := 0
+		for rows.Next() {
+			if rowCap > 0 && written == rowCap {
+				return stream.Send(&QueryResponse{
+					Rows:      batch,
+					Truncated: fmt.Sprintf("export limited to %d rows", rowCap),
+				})
+			}
+			batch = append(batch, rows.Row())
+			written++
+			if len(batch) == batchSize {
+				if err := stream.Send(&QueryResponse{Rows: batch}); err != nil {
+					return err
+				}
+				batch = make([][]any, 0, batchSize)
+			}
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if len(batch) > 0 {
+			return stream.Send(&QueryResponse{Rows: batch})
+		}
+		return nil
+	})
+}
+
+// recordQuery stores a query in the history, if there is one, under a
+// session of its own naming the caller.
+func (s *Service) recordQuery(u *access.UserInfo, sessionID, name, query string, start time.Time, res *database.QueryResult, err error) {
+	if s.historyStore == nil {
+		return
+	}
+	s.historyStore.CreateSession(&history.Session{
+		ID:           sessionID,
+		UserName:     u.Name,
+		RemoteAddr:   u.RemoteAddr,
+		CreatedAt:    start,
+		LastActiveAt: time.Now(),
+	})
+
+	record := &history.QueryRecord{
+		SessionID:       sessionID,
+		DatabasePath:    name,
+		Query:           query,
+		ExecutionTimeMs: time.Since(start).Milliseconds(),
+		CreatedAt:       start,
+	}
+	if db := s.dbManager.GetDatabase(name); db != nil {
+		record.DatabasePath = db.Path
+	}
+	if res != nil {
+		record.RowsAffected = res.RowsAffected
+	}
+	if err != nil {
+		record.Error = err.Error()
+	}
+	s.historyStore.RecordQuery(record)
+}
@@ -0,0 +1,269 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/johan-st/sqlite-tui/apipb"
+	"github.com/johan-st/sqlite-tui/internal/access"
+	"github.com/johan-st/sqlite-tui/internal/config"
+	"github.com/johan-st/sqlite-tui/internal/database"
+	"github.com/johan-st/sqlite-tui/internal/testutil"
+	"github.com/johan-st/sqlite-tui/internal/totp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// testAPI serves the API over an in-memory listener and returns a client.
+func testAPI(t *testing.T, cfg *config.Config) (*Server, apipb.SQLiteTUIClient) {
+	t.Helper()
+	t.Chdir(t.TempDir()) // the signing key goes in the data directory
+
+	manager, err := database.NewManager(cfg)
+	if err != nil {
+		t.Fatalf("failed to create manager: %v", err)
+	}
+	if err := manager.Start(); err != nil {
+		t.Fatalf("failed to start manager: %v", err)
+	}
+	t.Cleanup(manager.Stop)
+
+	s, err := NewServer(cfg, manager, nil)
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	lis := bufconn.Listen(1 << 20)
+	if err := s.Serve(lis); err != nil {
+		t.Fatalf("failed to serve: %v", err)
+	}
+	t.Cleanup(func() { s.Shutdown(context.Background()) })
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return s, apipb.NewSQLiteTUIClient(conn)
+}
+
+// as returns a context authenticating calls with a token for user.
+func as(t *testing.T, s *Server, user *access.UserInfo) context.Context {
+	t.Helper()
+	token, _, err := s.Token(user)
+	if err != nil {
+		t.Fatalf("failed to get token: %v", err)
+	}
+	return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+}
+
+// query runs a query and collects its rows.
+func query(ctx context.Context, client apipb.SQLiteTUIClient, db, sql string) ([]*apipb.Row, string, error) {
+	stream, err := client.Query(ctx, &apipb.QueryRequest{Database: db, Sql: sql})
+	if err != nil {
+		return nil, "", err
+	}
+	var rows []*apipb.Row
+	var truncated string
+	for {
+		msg, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return rows, truncated, nil
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		rows = append(rows, msg.Rows...)
+		if msg.Truncated != "" {
+			truncated = msg.Truncated
+		}
+	}
+}
+
+func TestServer_Auth(t *testing.T) {
+	dbPath, cleanup := testutil.TestDB(t, "users.db")
+	defer cleanup()
+
+	cfg := &config.Config{
+		Databases:       []config.DatabaseSource{{Path: dbPath, Alias: "test"}},
+		AnonymousAccess: "read-only",
+		Users: []config.User{
+			{Name: "reader", Access: []config.AccessRule{{Pattern: "*", Level: "read-only"}}},
+			{Name: "office", From: []string{"10.0.0.0/8"}, Access: []config.AccessRule{{Pattern: "*", Level: "read-only"}}},
+		},
+	}
+	s, client := testAPI(t, cfg)
+
+	if _, _, err := s.Token(&access.UserInfo{IsAnonymous: true}); err == nil {
+		t.Error("expected anonymous users to get no token")
+	}
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want codes.Code
+	}{
+		{"no token", context.Background(), codes.Unauthenticated},
+		{"bad token", metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer nope"), codes.Unauthenticated},
+		{"user removed", as(t, s, &access.UserInfo{Name: "gone"}), codes.Unauthenticated},
+		{"outside from rules", as(t, s, &access.UserInfo{Name: "office"}), codes.Unauthenticated},
+		{"valid token", as(t, s, &access.UserInfo{Name: "reader"}), codes.OK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := client.ListDatabases(tt.ctx, &apipb.ListDatabasesRequest{})
+			if status.Code(err) != tt.want {
+				t.Errorf("ListDatabases: got %v, want %v", err, tt.want)
+			}
+			_, _, err = query(tt.ctx, client, "test", "SELECT 1")
+			if status.Code(err) != tt.want {
+				t.Errorf("Query: got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestServer_QueryLimits(t *testing.T) {
+	dbPath, cleanup := testutil.TestDB(t, "users.db")
+	defer cleanup()
+
+	cfg := &config.Config{
+		Databases: []config.DatabaseSource{{Path: dbPath, Alias: "test"}},
+		Users: []config.User{
+			{Name: "reader", Access: []config.AccessRule{{Pattern: "*", Level: "read-only"}}},
+			{Name: "writer", Access: []config.AccessRule{{Pattern: "*", Level: "read-write"}}},
+		},
+		QueryLimits: config.QueryLimitsConfig{
+			ReadOnly: config.QueryLimit{QueriesPerMinute: 2, MaxRows: 2, MaxExportRows: 1},
+		},
+		Approvals: config.ApprovalsConfig{Commands: []string{"drop-table"}},
+	}
+	s, client := testAPI(t, cfg)
+	reader := as(t, s, &access.UserInfo{Name: "reader"})
+
+	// Reads go through the manager: result caps and the rate limit apply
+	rows, truncated, err := query(reader, client, "test", "SELECT * FROM users")
+	if err != nil || len(rows) != 2 || truncated == "" {
+		t.Errorf("expected 2 rows, truncated; got %d rows, %q, %v", len(rows), truncated, err)
+	}
+	if _, _, err := query(reader, client, "test", "SELECT 1"); err != nil {
+		t.Errorf("second query: %v", err)
+	}
+	if _, _, err := query(reader, client, "test", "SELECT 1"); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("expected the third query to be rate limited, got %v", err)
+	}
+
+	// Exports stop at the export row cap
+	stream, err := client.Export(reader, &apipb.ExportRequest{Database: "test", Table: "users"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	exported, truncated := 0, ""
+	for {
+		msg, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		exported += len(msg.Rows)
+		truncated += msg.Truncated
+	}
+	if exported != 1 || truncated == "" {
+		t.Errorf("expected 1 exported row, truncated; got %d, %q", exported, truncated)
+	}
+
+	// Writes need write access and are otherwise applied
+	if _, _, err := query(reader, client, "test", "DELETE FROM posts WHERE id = 1"); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("expected reader's write to be denied, got %v", err)
+	}
+	writer := as(t, s, &access.UserInfo{Name: "writer"})
+	if _, _, err := query(writer, client, "test", "UPDATE users SET name = 'x' WHERE id = 1"); err != nil {
+		t.Errorf("writer's update: %v", err)
+	}
+	if _, _, err := query(writer, client, "test", "DROP TABLE posts"); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("expected DROP to need approval, got %v", err)
+	}
+}
+
+func TestServer_TOTP(t *testing.T) {
+	dbPath, cleanup := testutil.TestDB(t, "users.db")
+	defer cleanup()
+
+	const secret = "JBSWY3DPEHPK3PXP"
+	cfg := &config.Config{
+		Databases: []config.DatabaseSource{{Path: dbPath, Alias: "test"}},
+		Users: []config.User{
+			{Name: "operator", TOTPSecret: secret, Access: []config.AccessRule{{Pattern: "*", Level: "read-write"}}},
+		},
+	}
+	s, client := testAPI(t, cfg)
+	operator := as(t, s, &access.UserInfo{Name: "operator"})
+
+	del := &apipb.QueryRequest{Database: "test", Sql: "DELETE FROM posts WHERE id = 1"}
+	stream, err := client.Query(operator, del)
+	if err == nil {
+		_, err = stream.Recv()
+	}
+	if status.Code(err) != codes.PermissionDenied {
+		t.Errorf("expected DELETE without a code to be denied, got %v", err)
+	}
+
+	code, err := totp.Code(secret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	del.Totp = code
+	if stream, err = client.Query(operator, del); err == nil {
+		_, err = stream.Recv()
+	}
+	if err != nil {
+		t.Errorf("expected DELETE with a code to run, got %v", err)
+	}
+}
+
+func TestServer_PlaintextOnlyOnLoopback(t *testing.T) {
+	t.Chdir(t.TempDir())
+	cfg := &config.Config{}
+	s, err := NewServer(cfg, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Shutdown(context.Background())
+
+	for _, tt := range []struct {
+		addr string
+		ok   bool
+	}{
+		{"127.0.0.1:0", true},
+		{"[::1]:0", true},
+		{"0.0.0.0:0", false},
+	} {
+		lis, err := net.Listen("tcp", tt.addr)
+		if err != nil {
+			t.Logf("%s: %v", tt.addr, err)
+			continue
+		}
+		err = s.Serve(lis)
+		if tt.ok && err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.addr, err)
+		}
+		if !tt.ok {
+			if err == nil || !strings.Contains(err.Error(), "without TLS") {
+				t.Errorf("%s: expected plain text to be refused, got %v", tt.addr, err)
+			}
+			lis.Close()
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/johan-st/sqlite-tui/apipb"
+	"github.com/johan-st/sqlite-tui/internal/database"
+	"github.com/johan-st/sqlite-tui/internal/ratelimit"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// grpcService adapts Service to the generated gRPC interface, converting
+// messages and errors.
+type grpcService struct {
+	apipb.UnimplementedSQLiteTUIServer
+	service *Service
+}
+
+func (g *grpcService) ListDatabases(ctx context.Context, _ *apipb.ListDatabasesRequest) (*apipb.ListDatabasesResponse, error) {
+	dbs, err := g.service.ListDatabases(ctx)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	res := &apipb.ListDatabasesResponse{}
+	for _, db := range dbs {
+		res.Databases = append(res.Databases, &apipb.Database{
+			Alias:       db.Alias,
+			Description: db.Description,
+			Size:        db.Size,
+			AccessLevel: db.AccessLevel,
+		})
+	}
+	return res, nil
+}
+
+func (g *grpcService) GetSchema(ctx context.Context, req *apipb.GetSchemaRequest) (*apipb.GetSchemaResponse, error) {
+	schema, err := g.service.GetSchema(ctx, &SchemaRequest{Database: req.Database, Table: req.Table})
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	res := &apipb.GetSchemaResponse{Tables: schema.Tables, Views: schema.Views}
+	if t := schema.Table; t != nil {
+		res.Table = &apipb.Table{Name: t.Name, Sql: t.SQL, RowCount: t.RowCount}
+		for _, c := range t.Columns {
+			col := &apipb.Column{Name: c.Name, Type: c.Type, NotNull: c.NotNull, PrimaryKey: int32(c.PrimaryKey)}
+			if c.DefaultValue.Valid {
+				col.DefaultValue = &c.DefaultValue.String
+			}
+			res.Table.Columns = append(res.Table.Columns, col)
+		}
+	}
+	return res, nil
+}
+
+func (g *grpcService) Query(req *apipb.QueryRequest, stream grpc.ServerStreamingServer[apipb.QueryResponse]) error {
+	args := make([]any, len(req.Args))
+	for i, v := range req.Args {
+		arg, err := fromValue(v)
+		if err != nil {
+			return toStatus(err)
+		}
+		args[i] = arg
+	}
+	return toStatus(g.service.Query(&QueryRequest{Database: req.Database, SQL: req.Sql, Args: args, TOTP: req.Totp}, queryStream{stream}))
+}
+
+func (g *grpcService) Export(req *apipb.ExportRequest, stream grpc.ServerStreamingServer[apipb.QueryResponse]) error {
+	return toStatus(g.service.Export(&ExportRequest{Database: req.Database, Table: req.Table}, queryStream{stream}))
+}
+
+// queryStream sends QueryResponses as messages on a gRPC stream.
+type queryStream struct {
+	grpc.ServerStreamingServer[apipb.QueryResponse]
+}
+
+func (s queryStream) Send(res *QueryResponse) error {
+	msg := &apipb.QueryResponse{
+		Columns:      res.Columns,
+		RowsAffected: res.RowsAffected,
+		LastInsertId: res.LastInsertID,
+		Truncated:    res.Truncated,
+	}
+	for _, row := range res.Rows {
+		r := &apipb.Row{Values: make([]*apipb.Value, len(row))}
+		for i, v := range row {
+			r.Values[i] = toValue(v)
+		}
+		msg.Rows = append(msg.Rows, r)
+	}
+	return s.ServerStreamingServer.Send(msg)
+}
+
+// toValue converts a value read from SQLite to a message.
+func toValue(v any) *apipb.Value {
+	switch v := v.(type) {
+	case nil:
+		return &apipb.Value{Kind: &apipb.Value_Null{Null: true}}
+	case int64:
+		return &apipb.Value{Kind: &apipb.Value_Integer{Integer: v}}
+	case float64:
+		return &apipb.Value{Kind: &apipb.Value_Real{Real: v}}
+	case string:
+		return &apipb.Value{Kind: &apipb.Value_Text{Text: v}}
+	case []byte:
+		return &apipb.Value{Kind: &apipb.Value_Blob{Blob: v}}
+	case bool:
+		if v {
+			return &apipb.Value{Kind: &apipb.Value_Integer{Integer: 1}}
+		}
+		return &apipb.Value{Kind: &apipb.Value_Integer{Integer: 0}}
+	case database.TruncatedValue:
+		return &apipb.Value{Kind: &apipb.Value_Truncated{Truncated: &apipb.Truncated{Head: toValue(v.Head), Size: v.Size}}}
+	default:
+		return &apipb.Value{Kind: &apipb.Value_Text{Text: fmt.Sprint(v)}}
+	}
+}
+
+// fromValue converts a query argument to a value to bind.
+func fromValue(v *apipb.Value) (any, error) {
+	switch k := v.GetKind().(type) {
+	case *apipb.Value_Null, nil:
+		return nil, nil
+	case *apipb.Value_Integer:
+		return k.Integer, nil
+	case *apipb.Value_Real:
+		return k.Real, nil
+	case *apipb.Value_Text:
+		return k.Text, nil
+	case *apipb.Value_Blob:
+		return k.Blob, nil
+	default:
+		return nil, fmt.Errorf("%w: truncated values can't be bound", ErrInvalidArgument)
+	}
+}
+
+// toStatus maps service errors to gRPC status codes.
+func toStatus(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+
+	var lockErr *database.LockError
+	var rateErr *ratelimit.Error
+	code := codes.Unknown
+	switch {
+	case errors.Is(err, ErrUnauthenticated):
+		code = codes.Unauthenticated
+	case errors.Is(err, ErrInvalidArgument):
+		code = codes.InvalidArgument
+	case errors.Is(err, database.ErrDatabaseNotFound), errors.Is(err, database.ErrTableNotFound):
+		code = codes.NotFound
+	case errors.Is(err, database.ErrAccessDenied), errors.Is(err, database.ErrApprovalRequired):
+		code = codes.PermissionDenied
+	case errors.As(err, &lockErr), database.IsWALLockError(err):
+		code = codes.Unavailable
+	case errors.As(err, &rateErr):
+		code = codes.ResourceExhausted
+	case errors.Is(err, database.ErrQueryTimeout), errors.Is(err, context.DeadlineExceeded):
+		code = codes.DeadlineExceeded
+	case errors.Is(err, context.Canceled):
+		code = codes.Canceled
+	}
+	return status.Error(code, err.Error())
+}
@@ -0,0 +1,174 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/johan-st/sqlite-tui/apipb"
+	"github.com/johan-st/sqlite-tui/internal/access"
+	"github.com/johan-st/sqlite-tui/internal/config"
+	"github.com/johan-st/sqlite-tui/internal/database"
+	"github.com/johan-st/sqlite-tui/internal/history"
+	"github.com/johan-st/sqlite-tui/internal/token"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// tokenTTL is how long an api-token is valid
+const tokenTTL = 30 * 24 * time.Hour
+
+// Server serves the API over gRPC. Every call must carry a token from
+// Token as "authorization: Bearer <token>" metadata.
+type Server struct {
+	config *config.Config
+	signer *token.Signer
+	grpc   *grpc.Server
+}
+
+// NewServer creates the gRPC API server for the configured listen address.
+// The key signing tokens is kept in the data directory, so tokens survive
+// restarts; deleting it revokes them all.
+func NewServer(cfg *config.Config, dbManager *database.Manager, historyStore *history.Store) (*Server, error) {
+	signer, err := token.Load(filepath.Join(cfg.GetDataDir(), "api_secret"))
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{config: cfg, signer: signer}
+	opts := []grpc.ServerOption{
+		grpc.UnaryInterceptor(s.unaryAuth),
+		grpc.StreamInterceptor(s.streamAuth),
+	}
+	if api := cfg.Server.API; api.TLSCert != "" || api.TLSKey != "" {
+		creds, err := credentials.NewServerTLSFromFile(api.TLSCert, api.TLSKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load API TLS certificate: %w", err)
+		}
+		opts = append(opts, grpc.Creds(creds))
+	}
+	s.grpc = grpc.NewServer(opts...)
+	apipb.RegisterSQLiteTUIServer(s.grpc, &grpcService{service: NewService(dbManager, historyStore)})
+	return s, nil
+}
+
+// Start listens on the configured address and serves the API in the
+// background.
+func (s *Server) Start() error {
+	lis, err := net.Listen("tcp", s.config.Server.API.Listen)
+	if err != nil {
+		return fmt.Errorf("failed to listen for the API: %w", err)
+	}
+	if err := s.Serve(lis); err != nil {
+		lis.Close()
+		return err
+	}
+	return nil
+}
+
+// Serve serves the API on lis in the background. Without TLS, tokens
+// would cross the network readable and replayable, so it refuses TCP
+// addresses other than loopback.
+func (s *Server) Serve(lis net.Listener) error {
+	tls := s.config.Server.API.TLSCert != ""
+	if !tls && !isLoopback(lis.Addr()) {
+		return fmt.Errorf("the API listens on %s without TLS: set server.api.tls_cert and tls_key, or listen on a loopback address", lis.Addr())
+	}
+	slog.Info("Starting API", "addr", lis.Addr().String(), "tls", tls)
+	go func() {
+		if err := s.grpc.Serve(lis); err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+			slog.Error("API error", "err", err)
+		}
+	}()
+	return nil
+}
+
+// isLoopback reports whether addr only accepts connections from this
+// host: a loopback TCP address, or an address that isn't TCP at all, such
+// as a unix socket.
+func isLoopback(addr net.Addr) bool {
+	tcp, ok := addr.(*net.TCPAddr)
+	return !ok || tcp.IP.IsLoopback()
+}
+
+// Shutdown stops the API, letting calls in progress finish until ctx ends.
+func (s *Server) Shutdown(ctx context.Context) {
+	stopped := make(chan struct{})
+	go func() {
+		s.grpc.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		s.grpc.Stop()
+	}
+}
+
+// Token returns a token authenticating API calls as user, and when it
+// expires.
+func (s *Server) Token(user *access.UserInfo) (string, time.Time, error) {
+	if user == nil || user.IsAnonymous {
+		return "", time.Time{}, errors.New("only authenticated users can use the API")
+	}
+	expires := time.Now().Add(tokenTTL).Truncate(time.Second)
+	return s.signer.Sign("api", user.Name, expires), expires, nil
+}
+
+// authenticate returns ctx carrying the user named by the call's token.
+// The user must still be configured and connect from an address their
+// from rules allow.
+func (s *Server) authenticate(ctx context.Context) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	var t string
+	if auth := md.Get("authorization"); len(auth) > 0 {
+		t, _ = strings.CutPrefix(auth[0], "Bearer ")
+	}
+	name, _, ok := s.signer.Verify("api", t)
+	if !ok {
+		return nil, toStatus(fmt.Errorf("%w: missing, invalid or expired token", ErrUnauthenticated))
+	}
+
+	remoteAddr := ""
+	if p, ok := peer.FromContext(ctx); ok {
+		remoteAddr = p.Addr.String()
+	}
+	u := s.config.FindUserByName(name)
+	if u == nil || !access.SourceAllowed(remoteAddr, u.From) {
+		return nil, toStatus(fmt.Errorf("%w: %s may not use the API from here", ErrUnauthenticated, name))
+	}
+	return WithUser(ctx, &access.UserInfo{Name: u.Name, IsAdmin: u.Admin, RemoteAddr: remoteAddr}), nil
+}
+
+func (s *Server) unaryAuth(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	ctx, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (s *Server) streamAuth(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := s.authenticate(ss.Context())
+	if err != nil {
+		return err
+	}
+	return handler(srv, authedStream{ServerStream: ss, ctx: ctx})
+}
+
+// authedStream is a server stream whose context carries the caller.
+type authedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s authedStream) Context() context.Context {
+	return s.ctx
+}
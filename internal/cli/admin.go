@@ -1,10 +1,14 @@
 package cli
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/johan-st/sqlite-tui/internal/history"
 	"github.com/johan-st/sqlite-tui/internal/server"
 )
 
@@ -14,17 +18,21 @@ func (h *Handler) cmdSessions(ctx *CommandContext) {
 		return
 	}
 
-	// Get session manager from SSH context (only available in SSH mode)
-	if ctx.Session == nil {
+	// Sessions are only tracked in SSH mode
+	sessionMgr := ctx.SessionMgr
+	if sessionMgr == nil {
 		fmt.Fprintln(ctx.Err, "sessions command is only available in SSH server mode")
-		ctx.Exit(1)
+		ctx.Exit(ExitUsage)
 		return
 	}
 
-	sessionMgr := server.GetSessionMgrFromSSH(ctx.Session)
-	if sessionMgr == nil {
-		fmt.Fprintln(ctx.Err, "Session manager not available")
-		ctx.Exit(1)
+	if args := ctx.GetPositionalArgs(); len(args) > 0 {
+		if args[0] != "kill" || len(args) < 2 {
+			fmt.Fprintln(ctx.Err, "Usage: sessions [kill <id>]")
+			ctx.Exit(ExitUsage)
+			return
+		}
+		h.killSession(ctx, sessionMgr, args[1])
 		return
 	}
 
@@ -47,19 +55,76 @@ func (h *Handler) cmdSessions(ctx *CommandContext) {
 	}
 
 	if len(sessions) == 0 {
-		fmt.Fprintln(ctx.Out, "No active sessions")
+		ctx.Infof("No active sessions\n")
 		return
 	}
 
-	fmt.Fprintln(ctx.Out, "ID\tUSER\tREMOTE\tDURATION\tIDLE")
+	rows := make([][]string, 0, len(sessions))
 	for _, s := range sessions {
-		fmt.Fprintf(ctx.Out, "%s\t%s\t%s\t%s\t%s\n",
-			s.ID[:8],
+		rows = append(rows, []string{
+			shortID(s.ID),
 			s.User.DisplayName(),
 			s.RemoteAddr,
 			formatDuration(s.Duration()),
-			formatDuration(s.IdleTime()))
+			formatDuration(s.IdleTime()),
+		})
+	}
+	printTable(ctx.Out, []string{"ID", "USER", "REMOTE", "DURATION", "IDLE"}, rows, ctx.maxColWidth())
+}
+
+// killSession terminates another session and releases its locks.
+func (h *Handler) killSession(ctx *CommandContext, sessionMgr *server.SessionManager, idOrPrefix string) {
+	target, err := sessionMgr.FindSession(idOrPrefix)
+	if err != nil {
+		fmt.Fprintf(ctx.Err, "Error: %v\n", err)
+		if errors.Is(err, server.ErrSessionNotFound) {
+			ctx.Exit(ExitNotFound)
+		} else {
+			ctx.Exit(ExitUsage)
+		}
+		return
+	}
+
+	if target.ID == ctx.GetSessionID() {
+		fmt.Fprintln(ctx.Err, "Error: refusing to kill your own session")
+		ctx.Exit(ExitUsage)
+		return
 	}
+
+	if err := sessionMgr.KillSession(target.ID); err != nil {
+		// The connection may already be gone; the session is ended regardless
+		fmt.Fprintf(ctx.Err, "Warning: closing connection: %v\n", err)
+	}
+	h.dbManager.GetLockManager().ReleaseAllForSession(target.ID)
+
+	format := ctx.GetFlag("format")
+	if format == "json" {
+		printJSON(ctx.Out, map[string]any{
+			"killed":      target.ID,
+			"user":        target.User.DisplayName(),
+			"remote_addr": target.RemoteAddr,
+		})
+	} else {
+		ctx.Infof("Killed session %s (%s from %s)\n", shortID(target.ID), target.User.DisplayName(), target.RemoteAddr)
+	}
+
+	// Log to audit
+	if h.historyStore != nil {
+		h.historyStore.RecordAuditSimple(ctx.GetSessionID(), "KILL_SESSION", "", "", map[string]any{
+			"session_id":  target.ID,
+			"user":        target.User.DisplayName(),
+			"remote_addr": target.RemoteAddr,
+		})
+	}
+}
+
+// shortID shortens a session ID for display, to a prefix sessions kill
+// still accepts while it is unique.
+func shortID(id string) string {
+	if len(id) > 8 {
+		return id[:8]
+	}
+	return id
 }
 
 // cmdHistory shows query history.
@@ -70,21 +135,48 @@ func (h *Handler) cmdHistory(ctx *CommandContext) {
 
 	if h.historyStore == nil {
 		fmt.Fprintln(ctx.Err, "History not available in local mode")
-		ctx.Exit(1)
+		ctx.Exit(ExitUsage)
+		return
+	}
+
+	if args := ctx.GetPositionalArgs(); len(args) > 0 {
+		if args[0] != "prune" {
+			fmt.Fprintln(ctx.Err, "Usage: history [prune --older-than=AGE [--keep-errors]]")
+			ctx.Exit(ExitUsage)
+			return
+		}
+		h.pruneLog(ctx, "PRUNE_HISTORY", func(before time.Time) (int64, error) {
+			return h.historyStore.PruneQueryHistory(before, ctx.HasFlag("keep-errors"))
+		})
 		return
 	}
 
-	limit := 50
+	filter := history.QueryFilter{
+		User:       ctx.GetFlag("user"),
+		ErrorsOnly: ctx.HasFlag("errors-only"),
+		Search:     ctx.GetFlag("search"),
+		Limit:      50,
+	}
 	if l := ctx.GetFlag("limit"); l != "" {
 		if n, err := strconv.Atoi(l); err == nil {
-			limit = n
+			filter.Limit = n
 		}
 	}
+	if db := ctx.GetFlag("db"); db != "" {
+		filter.Databases = h.databaseNames(db)
+	}
+	var ok bool
+	if filter.Since, ok = ctx.timeFlag("since"); !ok {
+		return
+	}
+	if filter.Until, ok = ctx.timeFlag("until"); !ok {
+		return
+	}
 
-	queries, err := h.historyStore.ListQueryHistory("", "", time.Time{}, limit)
+	queries, err := h.historyStore.FindQueryHistory(filter)
 	if err != nil {
 		fmt.Fprintf(ctx.Err, "Error fetching history: %v\n", err)
-		ctx.Exit(1)
+		ctx.Exit(errorExitCode(err))
 		return
 	}
 
@@ -95,22 +187,26 @@ func (h *Handler) cmdHistory(ctx *CommandContext) {
 	}
 
 	if len(queries) == 0 {
-		fmt.Fprintln(ctx.Out, "No query history")
+		ctx.Infof("No query history\n")
 		return
 	}
 
-	fmt.Fprintln(ctx.Out, "TIME\tDATABASE\tDURATION\tQUERY")
+	rows := make([][]string, 0, len(queries))
 	for _, q := range queries {
-		query := q.Query
-		if len(query) > 50 {
-			query = query[:47] + "..."
+		status := "ok"
+		if q.Error != "" {
+			status = "error"
 		}
-		fmt.Fprintf(ctx.Out, "%s\t%s\t%dms\t%s\n",
-			q.CreatedAt.Format("15:04:05"),
+		rows = append(rows, []string{
+			q.CreatedAt.Format("2006-01-02 15:04:05"),
+			q.UserName,
 			q.DatabasePath,
-			q.ExecutionTimeMs,
-			query)
+			fmt.Sprintf("%dms", q.ExecutionTimeMs),
+			status,
+			q.Query,
+		})
 	}
+	printTable(ctx.Out, []string{"TIME", "USER", "DATABASE", "DURATION", "STATUS", "QUERY"}, rows, ctx.maxColWidth())
 }
 
 // cmdAudit shows the audit log.
@@ -121,48 +217,101 @@ func (h *Handler) cmdAudit(ctx *CommandContext) {
 
 	if h.historyStore == nil {
 		fmt.Fprintln(ctx.Err, "Audit log not available in local mode")
-		ctx.Exit(1)
+		ctx.Exit(ExitUsage)
+		return
+	}
+
+	if args := ctx.GetPositionalArgs(); len(args) > 0 {
+		if args[0] != "prune" {
+			fmt.Fprintln(ctx.Err, "Usage: audit [prune --older-than=AGE]")
+			ctx.Exit(ExitUsage)
+			return
+		}
+		h.pruneLog(ctx, "PRUNE_AUDIT", h.historyStore.PruneAuditLog)
 		return
 	}
 
-	limit := 50
+	filter := history.AuditFilter{
+		Action: strings.ToUpper(ctx.GetFlag("action")),
+		Table:  ctx.GetFlag("table"),
+		User:   ctx.GetFlag("user"),
+		Denied: ctx.HasFlag("denied"),
+		Limit:  50,
+	}
 	if l := ctx.GetFlag("limit"); l != "" {
 		if n, err := strconv.Atoi(l); err == nil {
-			limit = n
+			filter.Limit = n
 		}
 	}
+	if db := ctx.GetFlag("db"); db != "" {
+		filter.Databases = h.databaseNames(db)
+	}
+	var ok bool
+	if filter.Since, ok = ctx.timeFlag("since"); !ok {
+		return
+	}
+	if filter.Until, ok = ctx.timeFlag("until"); !ok {
+		return
+	}
 
-	entries, err := h.historyStore.ListAuditLog("", "", "", time.Time{}, limit)
+	entries, err := h.historyStore.FindAuditLog(filter)
 	if err != nil {
 		fmt.Fprintf(ctx.Err, "Error fetching audit log: %v\n", err)
-		ctx.Exit(1)
+		ctx.Exit(errorExitCode(err))
 		return
 	}
 
 	format := ctx.GetFlag("format")
-	if format == "json" {
+	switch format {
+	case "json":
 		printJSON(ctx.Out, entries)
 		return
+	case "jsonl":
+		// One self-contained object per line, oldest first, for log shippers
+		for i := len(entries) - 1; i >= 0; i-- {
+			printJSONLine(ctx.Out, auditEvent(entries[i]))
+		}
+		return
 	}
 
 	if len(entries) == 0 {
-		fmt.Fprintln(ctx.Out, "No audit log entries")
+		ctx.Infof("No audit log entries\n")
 		return
 	}
 
-	fmt.Fprintln(ctx.Out, "TIME\tACTION\tDATABASE\tTABLE\tDETAILS")
+	rows := make([][]string, 0, len(entries))
 	for _, e := range entries {
-		details := e.Details
-		if len(details) > 40 {
-			details = details[:37] + "..."
-		}
-		fmt.Fprintf(ctx.Out, "%s\t%s\t%s\t%s\t%s\n",
-			e.CreatedAt.Format("15:04:05"),
+		rows = append(rows, []string{
+			e.CreatedAt.Format("2006-01-02 15:04:05"),
+			e.UserName,
 			e.Action,
 			e.DatabasePath,
 			e.TableName,
-			details)
+			e.Details,
+		})
+	}
+	printTable(ctx.Out, []string{"TIME", "USER", "ACTION", "DATABASE", "TABLE", "DETAILS"}, rows, ctx.maxColWidth())
+}
+
+// auditEvent converts an audit record to a flat event for export.
+func auditEvent(e *history.AuditRecord) map[string]any {
+	event := map[string]any{
+		"id":         e.ID,
+		"time":       e.CreatedAt.UTC().Format(time.RFC3339Nano),
+		"session_id": e.SessionID,
+		"user":       e.UserName,
+		"action":     e.Action,
+		"database":   e.DatabasePath,
+		"table":      e.TableName,
+	}
+	// Details are stored as JSON; embed them as an object when they parse
+	var details any
+	if e.Details != "" && json.Unmarshal([]byte(e.Details), &details) == nil {
+		event["details"] = details
+	} else if e.Details != "" {
+		event["details"] = e.Details
 	}
+	return event
 }
 
 // cmdReloadConfig reloads the configuration.
@@ -174,14 +323,141 @@ func (h *Handler) cmdReloadConfig(ctx *CommandContext) {
 	// In local mode, there's no config to reload
 	if ctx.Session == nil {
 		fmt.Fprintln(ctx.Err, "reload-config is only available in SSH server mode")
-		ctx.Exit(1)
+		ctx.Exit(ExitUsage)
 		return
 	}
 
 	// TODO: Implement config reload via a channel or callback
 	// For now, just print a message
-	fmt.Fprintln(ctx.Out, "Configuration reload triggered")
-	fmt.Fprintln(ctx.Out, "Note: Config watcher handles automatic reloading")
+	ctx.Infof("Configuration reload triggered\n")
+	ctx.Infof("Note: Config watcher handles automatic reloading\n")
+}
+
+// cmdRescan scans the database sources for added and removed files now,
+// for when change notifications missed them.
+func (h *Handler) cmdRescan(ctx *CommandContext) {
+	if !ctx.RequireAdmin() {
+		return
+	}
+
+	added, removed, err := h.dbManager.Rescan()
+	if err != nil {
+		fmt.Fprintf(ctx.Err, "Rescan failed: %v\n", err)
+		ctx.Exit(errorExitCode(err))
+		return
+	}
+	total := len(h.dbManager.GetDiscovery().GetDatabases())
+
+	if ctx.GetFlag("format") == "json" {
+		// Empty lists rather than null
+		printJSON(ctx.Out, map[string]any{
+			"added":     append([]string{}, added...),
+			"removed":   append([]string{}, removed...),
+			"databases": total,
+		})
+		return
+	}
+
+	for _, path := range added {
+		fmt.Fprintf(ctx.Out, "+ %s\n", path)
+	}
+	for _, path := range removed {
+		fmt.Fprintf(ctx.Out, "- %s\n", path)
+	}
+	ctx.Infof("%d added, %d removed, %d database(s) in total\n", len(added), len(removed), total)
+}
+
+// databaseNames returns the names a database may be recorded under: the
+// given name plus its path, if it is a known database.
+func (h *Handler) databaseNames(name string) []string {
+	names := []string{name}
+	if db := h.dbManager.GetDatabase(name); db != nil {
+		if db.Path != name {
+			names = append(names, db.Path)
+		}
+		if db.Alias != "" && db.Alias != name {
+			names = append(names, db.Alias)
+		}
+	}
+	return names
+}
+
+// pruneLog deletes history or audit entries older than --older-than and
+// records the pruning itself in the audit log.
+func (h *Handler) pruneLog(ctx *CommandContext, action string, prune func(before time.Time) (int64, error)) {
+	if ctx.GetFlag("older-than") == "" {
+		fmt.Fprintln(ctx.Err, "prune requires --older-than (e.g. --older-than=30d)")
+		ctx.Exit(ExitUsage)
+		return
+	}
+	before, ok := ctx.timeFlag("older-than")
+	if !ok {
+		return
+	}
+
+	deleted, err := prune(before)
+	if err != nil {
+		fmt.Fprintf(ctx.Err, "Prune error: %v\n", err)
+		ctx.Exit(errorExitCode(err))
+		return
+	}
+
+	format := ctx.GetFlag("format")
+	if format == "json" {
+		printJSON(ctx.Out, map[string]any{"deleted": deleted, "before": before})
+	} else {
+		ctx.Infof("Deleted %d entries older than %s\n", deleted, before.Format("2006-01-02 15:04:05"))
+	}
+
+	details := map[string]any{"before": before, "deleted": deleted}
+	if ctx.HasFlag("keep-errors") {
+		details["keep_errors"] = true
+	}
+	h.historyStore.RecordAuditSimple(ctx.GetSessionID(), action, "", "", details)
+}
+
+// timeFlag parses a time flag such as --since. Accepted forms are RFC 3339,
+// "2006-01-02", "2006-01-02 15:04", "today", "yesterday" and durations ago
+// like "90m", "24h" or "7d". It reports false after printing an error.
+func (c *CommandContext) timeFlag(name string) (time.Time, bool) {
+	v := c.GetFlag(name)
+	if v == "" {
+		return time.Time{}, true
+	}
+	t, err := parseTimeFlag(v, time.Now())
+	if err != nil {
+		fmt.Fprintf(c.Err, "Invalid --%s: %v\n", name, err)
+		c.Exit(ExitUsage)
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// parseTimeFlag parses an absolute or relative time relative to now.
+func parseTimeFlag(v string, now time.Time) (time.Time, error) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	switch v {
+	case "today":
+		return today, nil
+	case "yesterday":
+		return today.AddDate(0, 0, -1), nil
+	}
+
+	if n, ok := strings.CutSuffix(v, "d"); ok {
+		if days, err := strconv.Atoi(n); err == nil && days >= 0 {
+			return now.AddDate(0, 0, -days), nil
+		}
+	}
+	if d, err := time.ParseDuration(v); err == nil && d >= 0 {
+		return now.Add(-d), nil
+	}
+
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, v, now.Location()); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognized time %q (use 2006-01-02, RFC 3339, today, yesterday or 24h/7d)", v)
 }
 
 // formatDuration formats a duration for display.
@@ -0,0 +1,39 @@
+package cli
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/johan-st/sqlite-tui/internal/server"
+)
+
+// cmdAPIToken prints a token authenticating gRPC API calls as the current
+// user.
+func (h *Handler) cmdAPIToken(ctx *CommandContext) {
+	if ctx.Session == nil {
+		fmt.Fprintln(ctx.Err, "api-token is only available in SSH server mode")
+		ctx.Exit(ExitUsage)
+		return
+	}
+
+	apiServer := server.GetAPIFromSSH(ctx.Session)
+	if apiServer == nil {
+		fmt.Fprintln(ctx.Err, "The API is not enabled (set server.api.listen)")
+		ctx.Exit(ExitUsage)
+		return
+	}
+
+	token, expires, err := apiServer.Token(ctx.User)
+	if err != nil {
+		fmt.Fprintf(ctx.Err, "Error: %v\n", err)
+		ctx.Exit(ExitAccessDenied)
+		return
+	}
+
+	if h.historyStore != nil {
+		h.historyStore.RecordAuditSimple(ctx.GetSessionID(), "API_TOKEN", "", "", nil)
+	}
+
+	fmt.Fprintln(ctx.Out, token)
+	fmt.Fprintf(ctx.Err, "Valid until %s\n", expires.Format(time.RFC3339))
+}
@@ -0,0 +1,234 @@
+package cli
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/johan-st/sqlite-tui/internal/history"
+)
+
+// requireApproval turns a command that needs an admin's approval into a
+// pending request. It reports whether the command may run now.
+func (h *Handler) requireApproval(cmd string, ctx *CommandContext) bool {
+	if !h.approvalRequired(cmd, ctx) {
+		return true
+	}
+	if h.historyStore == nil || ctx.User == nil {
+		fmt.Fprintf(ctx.Err, "Access denied: %s needs an admin's approval, which is not available in local mode\n", cmd)
+		ctx.Exit(ExitAccessDenied)
+		return false
+	}
+
+	// Only users who could run the command may ask for it
+	args := ctx.GetPositionalArgs()
+	var dbPath, tableName string
+	if len(args) > 0 {
+		if !ctx.RequireWrite(args[0]) {
+			return false
+		}
+		dbPath = h.dbManager.GetDatabase(args[0]).Path
+	}
+	if len(args) > 1 && cmd != "query" {
+		tableName = args[1]
+	}
+
+	approval := &history.Approval{
+		UserName:     ctx.User.Name,
+		Command:      cmd,
+		Args:         approvalArgs(ctx.Args),
+		DatabasePath: dbPath,
+	}
+	if err := h.historyStore.CreateApproval(approval); err != nil {
+		fmt.Fprintf(ctx.Err, "Error requesting approval: %v\n", err)
+		ctx.Exit(ExitUsage)
+		return false
+	}
+
+	h.historyStore.RecordAuditSimple(ctx.GetSessionID(), "APPROVAL_REQUESTED", dbPath, tableName, map[string]any{
+		"approval": approval.ID,
+		"command":  cmd,
+		"args":     approval.Args,
+	})
+
+	if ctx.GetFlag("format") == "json" {
+		printJSON(ctx.Out, map[string]any{"approval": approval.ID, "status": approval.Status})
+	} else {
+		fmt.Fprintf(ctx.Out, "Approval #%d requested: %s\n", approval.ID, approvalCommandLine(approval))
+		ctx.Infof("The command runs when an admin approves it with: approvals approve %d\n", approval.ID)
+	}
+	return false
+}
+
+// approvalRequired reports whether a command needs an admin's approval:
+// by its name, or for query by what its SQL does. Under sudo it is the
+// user's own need: running as admin doesn't skip approval.
+func (h *Handler) approvalRequired(cmd string, ctx *CommandContext) bool {
+	user := ctx.User
+	if ctx.sudoer != nil {
+		user = ctx.sudoer
+	}
+	if h.dbManager.ApprovalRequired(user, cmd) {
+		return true
+	}
+	args := ctx.GetPositionalArgs()
+	return cmd == "query" && len(args) > 1 && h.dbManager.QueryApproval(user, args[1]) != ""
+}
+
+// approvalArgs returns the arguments to store with a request. One-time
+// codes and local output paths mean nothing when an admin runs it later.
+func approvalArgs(args []string) []string {
+	stored := make([]string, 0, len(args))
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "--totp") || strings.HasPrefix(arg, "--output") || arg == "--confirm" {
+			continue
+		}
+		stored = append(stored, arg)
+	}
+	return stored
+}
+
+// approvalCommandLine formats a request's command for display.
+func approvalCommandLine(a *history.Approval) string {
+	return strings.TrimSpace(a.Command + " " + strings.Join(a.Args, " "))
+}
+
+// cmdApprovals lists, approves and denies commands waiting for approval.
+func (h *Handler) cmdApprovals(ctx *CommandContext) {
+	if h.historyStore == nil {
+		fmt.Fprintln(ctx.Err, "Approvals not available in local mode")
+		ctx.Exit(ExitUsage)
+		return
+	}
+
+	args := ctx.GetPositionalArgs()
+	switch {
+	case len(args) == 0 || args[0] == "list":
+		h.listApprovals(ctx)
+	case (args[0] == "approve" || args[0] == "deny") && len(args) == 2:
+		if !ctx.RequireAdmin() {
+			return
+		}
+		id, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			fmt.Fprintf(ctx.Err, "Invalid approval id: %s\n", args[1])
+			ctx.Exit(ExitUsage)
+			return
+		}
+		h.decideApproval(ctx, id, args[0] == "approve")
+	default:
+		fmt.Fprintln(ctx.Err, "Usage: approvals [list] [--all] | approvals approve <id> | approvals deny <id>")
+		ctx.Exit(ExitUsage)
+	}
+}
+
+// listApprovals shows pending requests: all of them to admins, their own
+// to other users. --all includes decided requests.
+func (h *Handler) listApprovals(ctx *CommandContext) {
+	status := history.ApprovalPending
+	if ctx.HasFlag("all") {
+		status = ""
+	}
+	userName := ""
+	if ctx.User == nil || !ctx.User.IsAdmin {
+		if ctx.User == nil || ctx.User.IsAnonymous {
+			fmt.Fprintln(ctx.Err, "Access denied: approvals need an authenticated user")
+			ctx.Exit(ExitAccessDenied)
+			return
+		}
+		userName = ctx.User.Name
+	}
+
+	approvals, err := h.historyStore.ListApprovals(status, userName)
+	if err != nil {
+		fmt.Fprintf(ctx.Err, "Error listing approvals: %v\n", err)
+		ctx.Exit(ExitUsage)
+		return
+	}
+
+	format := ctx.GetFlag("format")
+	if format == "json" {
+		printJSON(ctx.Out, approvals)
+		return
+	}
+
+	if len(approvals) == 0 {
+		ctx.Infof("No pending approvals\n")
+		return
+	}
+
+	rows := make([][]string, 0, len(approvals))
+	for _, a := range approvals {
+		rows = append(rows, []string{
+			strconv.FormatInt(a.ID, 10),
+			a.UserName,
+			approvalCommandLine(a),
+			a.Status,
+			a.CreatedAt.Local().Format("2006-01-02 15:04:05"),
+			a.DecidedBy,
+		})
+	}
+	printTable(ctx.Out, ctx.headers([]string{"ID", "USER", "COMMAND", "STATUS", "REQUESTED", "DECIDED BY"}), rows, ctx.maxColWidth())
+}
+
+// decideApproval approves or denies a pending request. An approved command
+// runs straight away in the admin's session.
+func (h *Handler) decideApproval(ctx *CommandContext, id int64, approve bool) {
+	approval, err := h.historyStore.GetApproval(id)
+	if err != nil {
+		fmt.Fprintf(ctx.Err, "Error reading approval: %v\n", err)
+		ctx.Exit(ExitUsage)
+		return
+	}
+	if approval == nil {
+		fmt.Fprintf(ctx.Err, "Approval not found: %d\n", id)
+		ctx.Exit(ExitNotFound)
+		return
+	}
+
+	run := *ctx
+	run.Args = append(append([]string{}, approval.Args...), "--confirm")
+	if code := ctx.GetFlag("totp"); code != "" {
+		run.Args = append(run.Args, "--totp="+code)
+	}
+
+	status, action := history.ApprovalDenied, "APPROVAL_DENIED"
+	if approve {
+		status, action = history.ApprovalApproved, "APPROVAL_APPROVED"
+		// The admin's own second factor, if any, is checked before the
+		// request is used up
+		if approval.Status == history.ApprovalPending && !h.requireTOTP(approval.Command, &run) {
+			ctx.Exit(run.exitCode)
+			return
+		}
+	}
+
+	// Each request runs at most once, so it is marked before it runs
+	ok, err := h.historyStore.DecideApproval(id, status, ctx.User.Name)
+	if err != nil {
+		fmt.Fprintf(ctx.Err, "Error updating approval: %v\n", err)
+		ctx.Exit(ExitUsage)
+		return
+	}
+	if !ok {
+		fmt.Fprintf(ctx.Err, "Approval #%d was already decided\n", id)
+		ctx.Exit(ExitUsage)
+		return
+	}
+
+	h.historyStore.RecordAuditSimple(ctx.GetSessionID(), action, approval.DatabasePath, "", map[string]any{
+		"approval":     id,
+		"requested_by": approval.UserName,
+		"command":      approval.Command,
+		"args":         approval.Args,
+	})
+
+	if !approve {
+		ctx.Infof("Approval #%d denied\n", id)
+		return
+	}
+
+	ctx.Infof("Approval #%d approved, running: %s\n", id, approvalCommandLine(approval))
+	h.dispatch(approval.Command, &run)
+	ctx.Exit(run.exitCode)
+}
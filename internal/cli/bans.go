@@ -0,0 +1,118 @@
+package cli
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// cmdBans lists and clears temporary IP bans for failed authentication.
+func (h *Handler) cmdBans(ctx *CommandContext) {
+	if !ctx.RequireAdmin() {
+		return
+	}
+
+	if h.historyStore == nil {
+		fmt.Fprintln(ctx.Err, "Bans not available in local mode")
+		ctx.Exit(ExitUsage)
+		return
+	}
+
+	args := ctx.GetPositionalArgs()
+	switch {
+	case len(args) == 0 || args[0] == "list":
+		h.listBans(ctx)
+	case args[0] == "clear":
+		h.clearBans(ctx, args[1:])
+	default:
+		fmt.Fprintln(ctx.Err, "Usage: bans [list] [--all] | bans clear <ip> | bans clear --all")
+		ctx.Exit(ExitUsage)
+	}
+}
+
+func (h *Handler) listBans(ctx *CommandContext) {
+	now := time.Now()
+	bans, err := h.historyStore.ListBans(ctx.HasFlag("all"), now)
+	if err != nil {
+		fmt.Fprintf(ctx.Err, "Error listing bans: %v\n", err)
+		ctx.Exit(ExitUsage)
+		return
+	}
+
+	format := ctx.GetFlag("format")
+	if format == "json" {
+		printJSON(ctx.Out, bans)
+		return
+	}
+
+	if len(bans) == 0 {
+		ctx.Infof("No active bans\n")
+		return
+	}
+
+	rows := make([][]string, 0, len(bans))
+	for _, b := range bans {
+		status := "active"
+		if !b.Active(now) {
+			status = "expired"
+		}
+		rows = append(rows, []string{
+			b.IP,
+			status,
+			strconv.Itoa(b.Failures),
+			b.CreatedAt.Local().Format("2006-01-02 15:04:05"),
+			b.ExpiresAt.Local().Format("2006-01-02 15:04:05"),
+			b.Reason,
+		})
+	}
+	printTable(ctx.Out, ctx.headers([]string{"IP", "STATUS", "FAILURES", "BANNED", "EXPIRES", "REASON"}), rows, ctx.maxColWidth())
+}
+
+func (h *Handler) clearBans(ctx *CommandContext, args []string) {
+	var cleared int64
+	var ip string
+	switch {
+	case ctx.HasFlag("all") && len(args) == 0:
+		n, err := h.historyStore.ClearAllBans()
+		if err != nil {
+			fmt.Fprintf(ctx.Err, "Error clearing bans: %v\n", err)
+			ctx.Exit(ExitUsage)
+			return
+		}
+		cleared = n
+	case len(args) == 1 && !ctx.HasFlag("all"):
+		ip = args[0]
+		ok, err := h.historyStore.ClearBan(ip)
+		if err != nil {
+			fmt.Fprintf(ctx.Err, "Error clearing ban: %v\n", err)
+			ctx.Exit(ExitUsage)
+			return
+		}
+		if !ok {
+			fmt.Fprintf(ctx.Err, "No ban for %s\n", ip)
+			ctx.Exit(ExitNotFound)
+			return
+		}
+		cleared = 1
+	default:
+		fmt.Fprintln(ctx.Err, "Usage: bans clear <ip> | bans clear --all")
+		ctx.Exit(ExitUsage)
+		return
+	}
+
+	// Log to audit
+	details := map[string]any{"cleared": cleared}
+	if ip != "" {
+		details["ip"] = ip
+	}
+	h.historyStore.RecordAuditSimple(ctx.GetSessionID(), "UNBAN_IP", "", "", details)
+
+	format := ctx.GetFlag("format")
+	if format == "json" {
+		printJSON(ctx.Out, map[string]any{"cleared": cleared})
+	} else if ip != "" {
+		ctx.Infof("Cleared ban on %s\n", ip)
+	} else {
+		ctx.Infof("Cleared %d ban(s)\n", cleared)
+	}
+}
@@ -0,0 +1,66 @@
+package cli
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/johan-st/sqlite-tui/internal/database"
+)
+
+// checkProgressInterval is how often check reports progress.
+const checkProgressInterval = time.Second
+
+// cmdCheck runs an integrity check, reporting progress on stderr.
+func (h *Handler) cmdCheck(ctx *CommandContext) {
+	dbName, ok := ctx.RequireArg(0, "database")
+	if !ok {
+		return
+	}
+
+	if !ctx.RequireRead(dbName) {
+		return
+	}
+
+	conn, err := h.dbManager.OpenConnection(dbName, ctx.User)
+	if err != nil {
+		fmt.Fprintf(ctx.Err, "Failed to open database: %v\n", err)
+		ctx.Exit(errorExitCode(err))
+		return
+	}
+
+	lastReport := time.Now()
+	progress := func(p database.IntegrityProgress) {
+		if ctx.Quiet() || time.Since(lastReport) < checkProgressInterval {
+			return
+		}
+		lastReport = time.Now()
+		fmt.Fprintf(ctx.Err, "Checked %d/%d tables (%s)\n", p.Done, p.Total, p.Table)
+	}
+
+	report, err := database.IntegrityCheck(ctx.Context(), conn, ctx.HasFlag("quick"), progress)
+	if err != nil {
+		fmt.Fprintf(ctx.Err, "Check error: %v\n", err)
+		ctx.Exit(errorExitCode(err))
+		return
+	}
+
+	format := ctx.GetFlag("format")
+	if format == "json" {
+		printJSON(ctx.Out, map[string]any{
+			"ok":       report.OK(),
+			"quick":    report.Quick,
+			"tables":   report.Tables,
+			"problems": report.Problems,
+		})
+	} else if report.OK() {
+		ctx.Infof("ok (%d tables checked)\n", report.Tables)
+	} else {
+		for _, p := range report.Problems {
+			fmt.Fprintln(ctx.Out, p)
+		}
+	}
+
+	if !report.OK() {
+		ctx.Exit(ExitSQLError)
+	}
+}
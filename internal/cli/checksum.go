@@ -0,0 +1,74 @@
+package cli
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/johan-st/sqlite-tui/internal/database"
+)
+
+// cmdChecksum prints a content checksum per table.
+func (h *Handler) cmdChecksum(ctx *CommandContext) {
+	args := ctx.GetPositionalArgs()
+	if len(args) < 1 {
+		fmt.Fprintln(ctx.Err, "Usage: checksum <database> [table...]")
+		ctx.Exit(ExitUsage)
+		return
+	}
+
+	dbName := args[0]
+	tables := args[1:]
+
+	if !ctx.RequireRead(dbName) {
+		return
+	}
+
+	conn, err := h.dbManager.OpenConnection(dbName, ctx.User)
+	if err != nil {
+		fmt.Fprintf(ctx.Err, "Failed to open database: %v\n", err)
+		ctx.Exit(errorExitCode(err))
+		return
+	}
+
+	if len(tables) == 0 {
+		tables, err = database.NewSchema(conn).ListTables()
+		if err != nil {
+			fmt.Fprintf(ctx.Err, "Failed to list tables: %v\n", err)
+			ctx.Exit(errorExitCode(err))
+			return
+		}
+		tables = h.dbManager.FilterTables(ctx.User, dbName, tables)
+	}
+
+	sums := make([]*database.TableChecksum, 0, len(tables))
+	for _, table := range tables {
+		sum, err := database.ChecksumTable(conn, table)
+		if err != nil {
+			fmt.Fprintf(ctx.Err, "Checksum error for %s: %v\n", table, err)
+			ctx.Exit(errorExitCode(err))
+			return
+		}
+		sums = append(sums, sum)
+	}
+
+	format := ctx.GetFlag("format")
+	if format == "json" {
+		result := make([]map[string]any, 0, len(sums))
+		for _, s := range sums {
+			result = append(result, map[string]any{
+				"table":  s.Table,
+				"rows":   s.Rows,
+				"sha256": s.Sum,
+			})
+		}
+		printJSON(ctx.Out, result)
+		return
+	}
+
+	rows := make([][]string, 0, len(sums))
+	for _, s := range sums {
+		rows = append(rows, []string{s.Table, strconv.FormatInt(s.Rows, 10), s.Sum})
+	}
+	// Never truncate the hashes, they are meant to be compared
+	printTable(ctx.Out, ctx.headers([]string{"TABLE", "ROWS", "SHA256"}), rows, 0)
+}
@@ -2,22 +2,51 @@
 package cli
 
 import (
+	"bufio"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"strings"
+	"time"
 
 	"github.com/charmbracelet/ssh"
+	"github.com/dustin/go-humanize"
 	"github.com/johan-st/sqlite-tui/internal/access"
 	"github.com/johan-st/sqlite-tui/internal/database"
 	"github.com/johan-st/sqlite-tui/internal/history"
+	"github.com/johan-st/sqlite-tui/internal/ratelimit"
 	"github.com/johan-st/sqlite-tui/internal/server"
+	"golang.org/x/term"
 )
 
+// Exit codes returned by CLI commands. These are stable so that shell
+// scripts and CI jobs can branch on the kind of failure.
+const (
+	ExitOK           = 0 // Command succeeded
+	ExitUsage        = 1 // Bad arguments, unknown command or other general failure
+	ExitAccessDenied = 2 // User lacks the required access level
+	ExitNotFound     = 3 // Database or table does not exist
+	ExitSQLError     = 4 // SQLite returned an error
+	ExitLocked       = 5 // Database is locked by another session
+	ExitRateLimited  = 6 // Too many connections or queries, retry later
+)
+
+// ExitError is returned by HandleLocal when a command fails.
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("command failed with exit code %d", e.Code)
+}
+
 // Handler handles CLI commands over SSH or locally.
 type Handler struct {
 	dbManager    *database.Manager
 	historyStore *history.Store
 	version      string
+	started      time.Time
 }
 
 // NewHandler creates a new CLI handler.
@@ -26,15 +55,19 @@ func NewHandler(dbManager *database.Manager, historyStore *history.Store, versio
 		dbManager:    dbManager,
 		historyStore: historyStore,
 		version:      version,
+		started:      time.Now(),
 	}
 }
 
 // LocalContext wraps command execution for local (non-SSH) mode.
 type LocalContext struct {
-	User *access.UserInfo
-	Args []string
-	Out  io.Writer
-	Err  io.Writer
+	Ctx         context.Context // cancels running queries, e.g. on Ctrl-C; nil for none
+	User        *access.UserInfo
+	Args        []string
+	In          io.Reader
+	Out         io.Writer
+	Err         io.Writer
+	Interactive bool // stdin is a terminal, so prompts can be answered
 }
 
 // NewLocalContext creates a context for local CLI execution.
@@ -51,26 +84,30 @@ func NewLocalContext(user *access.UserInfo, args []string, out, errOut io.Writer
 func (h *Handler) HandleLocal(lctx *LocalContext) error {
 	if len(lctx.Args) == 0 {
 		fmt.Fprintln(lctx.Out, "No command specified. Run 'help' for usage.")
-		return nil
+		return &ExitError{Code: ExitUsage}
 	}
 
 	// Create CommandContext compatible with existing handlers
 	ctx := &CommandContext{
 		Session:      nil, // No SSH session in local mode
+		ctx:          lctx.Ctx,
 		User:         lctx.User,
 		SessionInfo:  nil,
+		SessionMgr:   nil,
 		DBManager:    h.dbManager,
 		HistoryStore: h.historyStore,
 		Args:         lctx.Args[1:],
+		In:           lctx.In,
 		Out:          lctx.Out,
 		Err:          lctx.Err,
-		exitCode:     0,
+		Interactive:  lctx.Interactive,
+		exitCode:     ExitOK,
 	}
 
 	h.routeCommand(lctx.Args[0], ctx)
 
-	if ctx.exitCode != 0 {
-		return fmt.Errorf("command failed with exit code %d", ctx.exitCode)
+	if ctx.exitCode != ExitOK {
+		return &ExitError{Code: ctx.exitCode}
 	}
 	return nil
 }
@@ -80,34 +117,111 @@ func (h *Handler) Handle(s ssh.Session) {
 	cmd := s.Command()
 	if len(cmd) == 0 {
 		fmt.Fprintln(s, "No command specified. Run 'help' for usage.")
+		s.Exit(ExitUsage)
 		return
 	}
 
 	// Get user and session info
 	user := server.GetUserFromContext(s.Context())
 	session := server.GetSessionFromSSH(s)
+	_, _, hasPty := s.Pty()
 
 	ctx := &CommandContext{
 		Session:      s,
+		ctx:          s.Context(),
 		User:         user,
 		SessionInfo:  session,
+		SessionMgr:   server.GetSessionMgrFromSSH(s),
 		DBManager:    h.dbManager,
 		HistoryStore: h.historyStore,
 		Args:         cmd[1:],
+		In:           s,
 		Out:          s,
 		Err:          s.Stderr(),
-		exitCode:     0,
+		Interactive:  hasPty,
+		exitCode:     ExitOK,
+	}
+
+	// Every command counts against the user's query budget
+	if err := server.CheckQueryRate(s); err != nil {
+		fmt.Fprintf(ctx.Err, "Error: %v\n", err)
+		s.Exit(ExitRateLimited)
+		return
+	}
+	if session != nil {
+		if err := session.ChargeQuery(); err != nil {
+			fmt.Fprintf(ctx.Err, "Error: %v\n", err)
+			s.Exit(ExitRateLimited)
+			return
+		}
 	}
 
 	h.routeCommand(cmd[0], ctx)
 
-	if ctx.exitCode != 0 {
+	if ctx.exitCode != ExitOK {
 		s.Exit(ctx.exitCode)
 	}
 }
 
-// routeCommand routes a command to its handler.
+// routeCommand routes a command to its handler, unless the user's command
+// list excludes it.
 func (h *Handler) routeCommand(cmd string, ctx *CommandContext) {
+	if !h.dbManager.CommandAllowed(ctx.User, cmd) {
+		fmt.Fprintf(ctx.Err, "Access denied: you may not run %s\n", cmd)
+		ctx.Exit(ExitAccessDenied)
+		if h.historyStore != nil {
+			h.historyStore.RecordAuditSimple(ctx.GetSessionID(), "COMMAND_DENIED", "", "", map[string]any{
+				"command": cmd,
+			})
+		}
+		return
+	}
+	if cmd == "sudo" {
+		// sudo routes the command it runs through the gates below
+		h.cmdSudo(ctx)
+		return
+	}
+
+	if !h.requireTables(cmd, ctx) {
+		h.auditDenied(cmd, ctx)
+		return
+	}
+	if !h.requireTOTP(cmd, ctx) || !h.requireApproval(cmd, ctx) {
+		return
+	}
+	if !ctx.parseLockWait() {
+		return
+	}
+
+	withOutputFile(ctx, func() {
+		h.dispatch(cmd, ctx)
+	})
+
+	if ctx.exitCode == ExitAccessDenied {
+		h.auditDenied(cmd, ctx)
+	}
+}
+
+// auditDenied records a command that failed for lack of access, so probing
+// shows up in the audit log.
+func (h *Handler) auditDenied(cmd string, ctx *CommandContext) {
+	if h.historyStore == nil {
+		return
+	}
+	var dbPath string
+	if args := ctx.GetPositionalArgs(); len(args) > 0 {
+		if db := h.dbManager.GetDatabase(args[0]); db != nil {
+			dbPath = db.Path
+		}
+	}
+	h.historyStore.RecordAuditSimple(ctx.GetSessionID(), "ACCESS_DENIED", dbPath, "", map[string]any{
+		"command": cmd,
+		"args":    ctx.Args,
+	})
+}
+
+// dispatch calls the handler for a command.
+func (h *Handler) dispatch(cmd string, ctx *CommandContext) {
 	switch cmd {
 	// Database commands
 	case "ls", "list":
@@ -118,6 +232,18 @@ func (h *Handler) routeCommand(cmd string, ctx *CommandContext) {
 		h.cmdTables(ctx)
 	case "schema":
 		h.cmdSchema(ctx)
+	case "describe":
+		h.cmdDescribe(ctx)
+	case "dupes":
+		h.cmdDupes(ctx)
+	case "pragma":
+		h.cmdPragma(ctx)
+	case "size":
+		h.cmdSize(ctx)
+	case "checksum":
+		h.cmdChecksum(ctx)
+	case "check":
+		h.cmdCheck(ctx)
 
 	// Query commands
 	case "query":
@@ -126,6 +252,14 @@ func (h *Handler) routeCommand(cmd string, ctx *CommandContext) {
 		h.cmdSelect(ctx)
 	case "count":
 		h.cmdCount(ctx)
+	case "cell":
+		h.cmdCell(ctx)
+	case "tail":
+		h.cmdTail(ctx)
+	case "fts":
+		h.cmdFTS(ctx)
+	case "json":
+		h.cmdJSON(ctx)
 
 	// Data commands
 	case "insert":
@@ -134,12 +268,16 @@ func (h *Handler) routeCommand(cmd string, ctx *CommandContext) {
 		h.cmdUpdate(ctx)
 	case "delete":
 		h.cmdDelete(ctx)
+	case "seed":
+		h.cmdSeed(ctx)
 
 	// Export commands
 	case "export":
 		h.cmdExport(ctx)
 	case "download":
 		h.cmdDownload(ctx)
+	case "upload":
+		h.cmdUpload(ctx)
 
 	// Schema commands
 	case "create-table":
@@ -154,14 +292,36 @@ func (h *Handler) routeCommand(cmd string, ctx *CommandContext) {
 		h.cmdSessions(ctx)
 	case "history":
 		h.cmdHistory(ctx)
+	case "totp":
+		h.cmdTOTP(ctx)
+	case "approvals":
+		h.cmdApprovals(ctx)
+	case "truncate":
+		h.cmdTruncate(ctx)
 	case "audit":
 		h.cmdAudit(ctx)
+	case "locks":
+		h.cmdLocks(ctx)
+	case "status":
+		h.cmdStatus(ctx)
 	case "reload-config":
 		h.cmdReloadConfig(ctx)
+	case "host-key":
+		h.cmdHostKey(ctx)
+	case "bans":
+		h.cmdBans(ctx)
+	case "rescan":
+		h.cmdRescan(ctx)
 
 	// Utility commands
 	case "whoami":
 		h.cmdWhoami(ctx)
+	case "health":
+		h.cmdHealth(ctx)
+	case "web-login":
+		h.cmdWebLogin(ctx)
+	case "api-token":
+		h.cmdAPIToken(ctx)
 	case "help":
 		h.cmdHelp(ctx)
 	case "version":
@@ -170,7 +330,7 @@ func (h *Handler) routeCommand(cmd string, ctx *CommandContext) {
 	default:
 		fmt.Fprintf(ctx.Err, "Unknown command: %s\n", cmd)
 		fmt.Fprintln(ctx.Err, "Run 'help' for usage.")
-		ctx.Exit(1)
+		ctx.Exit(ExitUsage)
 	}
 }
 
@@ -179,12 +339,65 @@ type CommandContext struct {
 	Session      ssh.Session // nil in local mode
 	User         *access.UserInfo
 	SessionInfo  *server.Session
+	SessionMgr   *server.SessionManager // nil in local mode
 	DBManager    *database.Manager
 	HistoryStore *history.Store
 	Args         []string
+	In           io.Reader // nil when there is no input to read from
 	Out          io.Writer
 	Err          io.Writer
+	Interactive  bool // a user is at a terminal and can answer prompts
 	exitCode     int
+	outputPath   string           // set when --output redirects Out to a file
+	lockWait     *time.Duration   // set by --wait, see parseLockWait
+	sudoer       *access.UserInfo // the user behind sudo, see approvalRequired
+	totpVerified bool             // set once requireTOTP accepted a code
+	ctx          context.Context  // cancelled when the client goes away
+}
+
+// Context returns the context for the command's queries. Over SSH it is
+// cancelled when the client disconnects, so a running query stops. Writes
+// wait for the write lock as --wait asks, and report their place in line
+// on stderr while queued. A TOTP code the command was given covers its
+// queries.
+func (c *CommandContext) Context() context.Context {
+	ctx := c.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if c.totpVerified {
+		ctx = database.WithTOTPVerified(ctx)
+	}
+	if c.lockWait != nil {
+		ctx = database.WithLockTimeout(ctx, *c.lockWait)
+	}
+	return database.WithLockWaitFunc(ctx, c.lockWaitNote)
+}
+
+// parseLockWait reads --wait, how long the command's writes wait for a
+// write lock another session holds instead of following the database's
+// lock policy.
+func (c *CommandContext) parseLockWait() bool {
+	v := c.GetFlag("wait")
+	if v == "" && !c.HasFlag("wait") {
+		return true
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		fmt.Fprintf(c.Err, "Invalid --wait: %q, use a duration such as 10s\n", v)
+		c.Exit(ExitUsage)
+		return false
+	}
+	c.lockWait = &d
+	return true
+}
+
+// lockWaitNote tells the user a write is queued for the lock.
+func (c *CommandContext) lockWaitNote(position int, heldBy string) {
+	if c.Quiet() {
+		return
+	}
+	fmt.Fprintf(c.Err, "Waiting for the write lock held by %s (%s in line)\n", heldBy, humanize.Ordinal(position))
 }
 
 // Exit sets the exit code (used instead of calling Session.Exit directly).
@@ -192,6 +405,33 @@ func (c *CommandContext) Exit(code int) {
 	c.exitCode = code
 }
 
+// Quiet reports whether informational output should be suppressed.
+func (c *CommandContext) Quiet() bool {
+	return c.HasFlag("quiet") || c.HasFlag("q")
+}
+
+// Infof prints an informational message unless --quiet is set.
+// Data output and errors are never suppressed. When --output is in use the
+// message goes to Err so that it does not end up in the file.
+func (c *CommandContext) Infof(format string, args ...any) {
+	if c.Quiet() {
+		return
+	}
+	w := c.Out
+	if c.outputPath != "" {
+		w = c.Err
+	}
+	fmt.Fprintf(w, format, args...)
+}
+
+// headers returns the column headers to print, or nil if --no-header is set.
+func (c *CommandContext) headers(columns []string) []string {
+	if c.HasFlag("no-header") {
+		return nil
+	}
+	return columns
+}
+
 // GetSessionID returns the session ID or empty string.
 func (c *CommandContext) GetSessionID() string {
 	if c.SessionInfo != nil {
@@ -204,7 +444,7 @@ func (c *CommandContext) GetSessionID() string {
 func (c *CommandContext) RequireArg(index int, name string) (string, bool) {
 	if index >= len(c.Args) {
 		fmt.Fprintf(c.Err, "Missing required argument: %s\n", name)
-		c.Exit(1)
+		c.Exit(ExitUsage)
 		return "", false
 	}
 	return c.Args[index], true
@@ -248,12 +488,25 @@ func (c *CommandContext) GetPositionalArgs() []string {
 	return result
 }
 
+// RequireDatabase checks that a database exists.
+func (c *CommandContext) RequireDatabase(dbPath string) bool {
+	if c.DBManager.GetDatabase(dbPath) == nil {
+		fmt.Fprintf(c.Err, "Database not found: %s\n", dbPath)
+		c.Exit(ExitNotFound)
+		return false
+	}
+	return true
+}
+
 // RequireRead checks if user has read access to a database.
 func (c *CommandContext) RequireRead(dbPath string) bool {
+	if !c.RequireDatabase(dbPath) {
+		return false
+	}
 	level := c.DBManager.GetAccessLevel(c.User, dbPath)
 	if !level.CanRead() {
 		fmt.Fprintf(c.Err, "Access denied: no read access to %s\n", dbPath)
-		c.Exit(1)
+		c.Exit(ExitAccessDenied)
 		return false
 	}
 	return true
@@ -261,21 +514,122 @@ func (c *CommandContext) RequireRead(dbPath string) bool {
 
 // RequireWrite checks if user has write access to a database.
 func (c *CommandContext) RequireWrite(dbPath string) bool {
+	if !c.RequireDatabase(dbPath) {
+		return false
+	}
 	level := c.DBManager.GetAccessLevel(c.User, dbPath)
 	if !level.CanWrite() {
 		fmt.Fprintf(c.Err, "Access denied: no write access to %s\n", dbPath)
-		c.Exit(1)
+		c.Exit(ExitAccessDenied)
+		return false
+	}
+	return true
+}
+
+// ConfirmByName asks the user to type name to confirm a destructive action.
+// It is only usable when Interactive is set; on mismatch it reports the
+// failure and sets the exit code.
+func (c *CommandContext) ConfirmByName(name, action string) bool {
+	fmt.Fprintf(c.Err, "%s\n", action)
+	line, err := c.readLine(fmt.Sprintf("Type %q to confirm: ", name))
+	if err != nil && line == "" {
+		fmt.Fprintln(c.Err, "\nAborted: no confirmation received")
+		c.Exit(ExitUsage)
+		return false
+	}
+	if line != name {
+		fmt.Fprintln(c.Err, "Aborted: confirmation did not match")
+		c.Exit(ExitUsage)
 		return false
 	}
 	return true
 }
 
+// readLine prompts for and reads a single line of input.
+func (c *CommandContext) readLine(prompt string) (string, error) {
+	if c.In == nil {
+		return "", io.EOF
+	}
+	// SSH PTYs are in raw mode, so let term handle echo and line editing
+	if c.Session != nil {
+		t := term.NewTerminal(c.Session, prompt)
+		line, err := t.ReadLine()
+		return strings.TrimSpace(line), err
+	}
+	fmt.Fprint(c.Err, prompt)
+	line, err := bufio.NewReader(c.In).ReadString('\n')
+	return strings.TrimSpace(line), err
+}
+
 // RequireAdmin checks if user has admin access.
 func (c *CommandContext) RequireAdmin() bool {
 	if c.User == nil || !c.User.IsAdmin {
 		fmt.Fprintln(c.Err, "Access denied: admin access required")
-		c.Exit(1)
+		c.Exit(ExitAccessDenied)
 		return false
 	}
 	return true
 }
+
+// rowsLeft returns how many more rows the session's quota allows, or -1 if
+// there is no limit.
+func (c *CommandContext) rowsLeft() int {
+	if c.SessionInfo == nil {
+		return -1
+	}
+	return c.SessionInfo.RowsLeft()
+}
+
+// limitRows trims a result to the rows the session's quota allows and
+// charges them, printing a note when rows are dropped.
+func (c *CommandContext) limitRows(result *database.QueryResult) {
+	if c.SessionInfo == nil || result == nil {
+		return
+	}
+	if n := c.SessionInfo.TakeRows(len(result.Rows)); n < len(result.Rows) {
+		result.Rows = result.Rows[:n]
+		c.noteQuota(n)
+	}
+}
+
+// noteQuota reports output cut off by the anonymous session quota.
+func (c *CommandContext) noteQuota(n int) {
+	fmt.Fprintf(c.Err, "Note: output limited to %d rows by the anonymous session quota\n", n)
+}
+
+// capRows trims a result to the access level's row cap for select and
+// export, printing a note when rows are dropped.
+func (c *CommandContext) capRows(result *database.QueryResult, rowCap int) {
+	if rowCap <= 0 || result == nil || len(result.Rows) <= rowCap {
+		return
+	}
+	result.Rows = result.Rows[:rowCap]
+	c.noteCapped(rowCap)
+}
+
+// noteCapped reports output cut off by the access level's row cap.
+func (c *CommandContext) noteCapped(rowCap int) {
+	fmt.Fprintf(c.Err, "Note: output capped at %d rows for your access level (an admin can lift it with --no-cap)\n", rowCap)
+}
+
+// errorExitCode maps an error returned by the database layer to an exit code.
+func errorExitCode(err error) int {
+	var lockErr *database.LockError
+	var rateErr *ratelimit.Error
+	switch {
+	case errors.As(err, &lockErr), database.IsWALLockError(err):
+		return ExitLocked
+	case errors.As(err, &rateErr), errors.Is(err, server.ErrQuotaExceeded):
+		return ExitRateLimited
+	case errors.Is(err, database.ErrDatabaseNotFound), errors.Is(err, database.ErrTableNotFound),
+		errors.Is(err, database.ErrNotFTSIndex), strings.Contains(err.Error(), "no such table"):
+		return ExitNotFound
+	case errors.Is(err, database.ErrAccessDenied), errors.Is(err, database.ErrApprovalRequired):
+		return ExitAccessDenied
+	case errors.Is(err, database.ErrInvalidAttachment), errors.Is(err, database.ErrInvalidSeedSpec),
+		errors.Is(err, database.ErrNotSQLite), errors.Is(err, database.ErrSnapshotWrite):
+		return ExitUsage
+	default:
+		return ExitSQLError
+	}
+}
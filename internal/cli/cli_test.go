@@ -2,13 +2,23 @@ package cli
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/johan-st/sqlite-tui/internal/access"
 	"github.com/johan-st/sqlite-tui/internal/config"
 	"github.com/johan-st/sqlite-tui/internal/database"
+	"github.com/johan-st/sqlite-tui/internal/history"
+	"github.com/johan-st/sqlite-tui/internal/server"
 	"github.com/johan-st/sqlite-tui/internal/testutil"
+	"github.com/johan-st/sqlite-tui/internal/totp"
 )
 
 // testEnv sets up a test environment with database manager.
@@ -76,22 +86,35 @@ func (e *testEnv) run(user *access.UserInfo, args ...string) (stdout, stderr str
 	ctx := &CommandContext{
 		User:      user,
 		DBManager: e.manager,
-		Args:      args,
 		Out:       &outBuf,
 		Err:       &errBuf,
-		exitCode:  0,
+		exitCode:  ExitOK,
 	}
 
 	if len(args) > 0 {
-		e.handler.routeCommand(args[0], &CommandContext{
-			User:      user,
-			DBManager: e.manager,
-			Args:      args[1:], // args after command
-			Out:       &outBuf,
-			Err:       &errBuf,
-			exitCode:  0,
-		})
+		ctx.Args = args[1:] // args after command
+		e.handler.routeCommand(args[0], ctx)
+	}
+
+	return outBuf.String(), errBuf.String(), ctx.exitCode
+}
+
+// runInteractive runs a command as if attached to a terminal, feeding input
+// to any prompts.
+func (e *testEnv) runInteractive(user *access.UserInfo, input string, args ...string) (stdout, stderr string, exitCode int) {
+	var outBuf, errBuf bytes.Buffer
+
+	ctx := &CommandContext{
+		User:        user,
+		DBManager:   e.manager,
+		In:          strings.NewReader(input),
+		Out:         &outBuf,
+		Err:         &errBuf,
+		Interactive: true,
+		exitCode:    ExitOK,
+		Args:        args[1:],
 	}
+	e.handler.routeCommand(args[0], ctx)
 
 	return outBuf.String(), errBuf.String(), ctx.exitCode
 }
@@ -226,6 +249,50 @@ func TestCLI_DropTable_RequiresConfirm(t *testing.T) {
 	}
 }
 
+func TestCLI_DropTable_InteractiveConfirm(t *testing.T) {
+	env := newTestEnv(t, "users.db")
+	defer env.Close()
+
+	// Wrong name aborts
+	_, stderr, code := env.runInteractive(env.adminUser, "posts\n", "drop-table", "test", "users")
+	if code != ExitUsage || !strings.Contains(stderr, "did not match") {
+		t.Fatalf("expected mismatch to abort, got code=%d stderr=%q", code, stderr)
+	}
+	stdout, _, _ := env.run(env.adminUser, "tables", "test")
+	if !strings.Contains(stdout, "users") {
+		t.Fatal("table was dropped despite failed confirmation")
+	}
+
+	// Correct name drops the table
+	_, stderr, code = env.runInteractive(env.adminUser, "users\n", "drop-table", "test", "users")
+	if code != ExitOK {
+		t.Fatalf("expected success, got code=%d stderr=%q", code, stderr)
+	}
+	if !strings.Contains(stderr, `Type "users" to confirm`) {
+		t.Errorf("expected prompt on stderr, got %q", stderr)
+	}
+}
+
+func TestCLI_Delete_InteractiveConfirm(t *testing.T) {
+	env := newTestEnv(t, "users.db")
+	defer env.Close()
+
+	// EOF without an answer aborts
+	_, _, code := env.runInteractive(env.adminUser, "", "delete", "test", "users", "--where=id=1")
+	if code != ExitUsage {
+		t.Fatalf("expected abort on EOF, got code=%d", code)
+	}
+
+	_, stderr, code := env.runInteractive(env.adminUser, "users\n", "delete", "test", "users", "--where=id=1")
+	if code != ExitOK {
+		t.Fatalf("expected success, got code=%d stderr=%q", code, stderr)
+	}
+	stdout, _, _ := env.run(env.adminUser, "select", "test", "users")
+	if strings.Contains(stdout, "Alice") {
+		t.Error("expected row to be deleted")
+	}
+}
+
 // --- Command Output Tests ---
 
 func TestCLI_Tables_ListsTables(t *testing.T) {
@@ -281,6 +348,25 @@ func TestCLI_Count_ReturnsCount(t *testing.T) {
 	}
 }
 
+func TestCLI_Cell_PrintsValue(t *testing.T) {
+	env := newTestEnv(t, "users.db")
+	defer env.Close()
+
+	stdout, stderr, _ := env.run(env.adminUser, "cell", "test", "users", "name", "1")
+
+	if stderr != "" {
+		t.Errorf("unexpected error: %s", stderr)
+	}
+	if strings.TrimSpace(stdout) == "" {
+		t.Error("expected the name of user 1")
+	}
+
+	_, stderr, code := env.run(env.adminUser, "cell", "test", "users", "name", "999")
+	if code == ExitOK || stderr == "" {
+		t.Errorf("expected an error for a missing row, got exit %d", code)
+	}
+}
+
 func TestCLI_Query_SelectReturnsData(t *testing.T) {
 	env := newTestEnv(t, "users.db")
 	defer env.Close()
@@ -403,3 +489,1915 @@ func TestCLI_Version(t *testing.T) {
 		t.Errorf("expected version string, got: %s", stdout)
 	}
 }
+
+// --- Pragma Tests ---
+
+func TestCLI_Pragma_ReaderCanRead(t *testing.T) {
+	env := newTestEnv(t, "users.db")
+	defer env.Close()
+
+	stdout, stderr, _ := env.run(env.readOnlyUser, "pragma", "test", "user_version")
+
+	if stderr != "" {
+		t.Errorf("unexpected error: %s", stderr)
+	}
+	if !strings.Contains(stdout, "user_version") {
+		t.Errorf("expected user_version in output, got: %s", stdout)
+	}
+}
+
+func TestCLI_Pragma_ReaderCannotSet(t *testing.T) {
+	env := newTestEnv(t, "users.db")
+	defer env.Close()
+
+	_, stderr, _ := env.run(env.readOnlyUser, "pragma", "test", "user_version", "7")
+
+	if !strings.Contains(stderr, "no write access") {
+		t.Errorf("expected access denied error, got: %s", stderr)
+	}
+}
+
+func TestCLI_Pragma_RejectsUnsafePragma(t *testing.T) {
+	env := newTestEnv(t, "users.db")
+	defer env.Close()
+
+	_, stderr, _ := env.run(env.adminUser, "pragma", "test", "writable_schema", "ON")
+
+	if !strings.Contains(stderr, "cannot be set") {
+		t.Errorf("expected whitelist error, got: %s", stderr)
+	}
+}
+
+func TestCLI_Pragma_AdminCanSet(t *testing.T) {
+	env := newTestEnv(t, "users.db")
+	defer env.Close()
+
+	_, stderr, _ := env.run(env.adminUser, "pragma", "test", "user_version", "7")
+	if stderr != "" {
+		t.Fatalf("unexpected error: %s", stderr)
+	}
+
+	stdout, _, _ := env.run(env.adminUser, "pragma", "test", "user_version", "--format=json")
+	if !strings.Contains(stdout, "7") {
+		t.Errorf("expected user_version 7, got: %s", stdout)
+	}
+}
+
+func TestCLI_Pragma_OnlyFilePragmas(t *testing.T) {
+	env := newTestEnv(t, "users.db")
+	defer env.Close()
+
+	// Per-connection settings would only change one pooled connection
+	for _, name := range []string{"cache_size", "foreign_keys", "synchronous", "busy_timeout"} {
+		if _, stderr, code := env.run(env.adminUser, "pragma", "test", name, "1"); code != ExitUsage || !strings.Contains(stderr, "cannot be set") {
+			t.Errorf("%s: expected it not to be settable, got code=%d stderr=%q", name, code, stderr)
+		}
+	}
+
+	stdout, stderr, code := env.run(env.adminUser, "pragma", "test", "application_id", "--value=-1", "--format=json")
+	if code != ExitOK {
+		t.Fatalf("pragma failed: code=%d stderr=%q", code, stderr)
+	}
+	var out map[string]any
+	if err := json.Unmarshal([]byte(stdout), &out); err != nil {
+		t.Fatalf("expected JSON, got %q: %v", stdout, err)
+	}
+	if out["previous"] != float64(0) || out["current"] != float64(-1) {
+		t.Errorf("expected application_id read back as -1, got %v", out)
+	}
+
+	// A journal mode set in the source config can't be changed
+	env.manager.GetDatabase("test").Source.JournalMode = "wal"
+	if _, stderr, code := env.run(env.adminUser, "pragma", "test", "journal_mode", "delete"); code != ExitUsage || !strings.Contains(stderr, "server config") {
+		t.Errorf("expected the configured journal mode to stick, got code=%d stderr=%q", code, stderr)
+	}
+
+	// auto_vacuum only changes after VACUUM, which the read-back shows
+	stdout, _, _ = env.run(env.adminUser, "pragma", "test", "auto_vacuum", "full", "--format=json")
+	if err := json.Unmarshal([]byte(stdout), &out); err != nil || out["current"] != out["previous"] {
+		t.Errorf("expected auto_vacuum unchanged until VACUUM, got %q (%v)", stdout, err)
+	}
+}
+
+func TestCLI_Pragma_QueryLimits(t *testing.T) {
+	env := newTestEnv(t, "users.db")
+	defer env.Close()
+
+	cfg := &config.Config{
+		Databases: []config.DatabaseSource{{Path: env.dbPath, Alias: "test"}},
+		Users: []config.User{
+			{Name: "reader", Access: []config.AccessRule{{Pattern: "*", Level: "read-only"}}},
+		},
+		QueryLimits: config.QueryLimitsConfig{
+			ReadOnly: config.QueryLimit{QueriesPerMinute: 1},
+		},
+	}
+	manager, err := database.NewManager(cfg)
+	if err != nil {
+		t.Fatalf("failed to create manager: %v", err)
+	}
+	if err := manager.Start(); err != nil {
+		t.Fatalf("failed to start manager: %v", err)
+	}
+	env.manager.Stop()
+	env.manager = manager
+	env.handler = NewHandler(manager, nil, "test")
+
+	// Reading a pragma is a query like any other
+	if _, stderr, code := env.run(env.readOnlyUser, "pragma", "test", "user_version"); code != ExitOK {
+		t.Fatalf("pragma failed: code=%d stderr=%q", code, stderr)
+	}
+	if _, stderr, code := env.run(env.readOnlyUser, "pragma", "test", "integrity_check"); code != ExitRateLimited {
+		t.Errorf("expected the second pragma to be rate limited, got code=%d stderr=%q", code, stderr)
+	}
+
+	// Setting one takes the write lock
+	unlock, err := manager.LockForWrite(context.Background(), "test", "other", "other-session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unlock()
+	if _, stderr, code := env.run(env.adminUser, "pragma", "test", "user_version", "3"); code == ExitOK || !strings.Contains(stderr, "locked") {
+		t.Errorf("expected the write lock to be needed, got code=%d stderr=%q", code, stderr)
+	}
+}
+
+// --- Size Tests ---
+
+func TestCLI_Size_ListsTablesAndIndexes(t *testing.T) {
+	env := newTestEnv(t, "users.db")
+	defer env.Close()
+
+	stdout, stderr, _ := env.run(env.readOnlyUser, "size", "test", "--sort=name")
+
+	if stderr != "" {
+		t.Errorf("unexpected error: %s", stderr)
+	}
+	for _, want := range []string{"users", "posts", "sqlite_autoindex_users_1", "Freelist pages"} {
+		if !strings.Contains(stdout, want) {
+			t.Errorf("expected %q in output, got: %s", want, stdout)
+		}
+	}
+}
+
+func TestCLI_Size_JSONFormat(t *testing.T) {
+	env := newTestEnv(t, "users.db")
+	defer env.Close()
+
+	stdout, stderr, _ := env.run(env.adminUser, "size", "test", "--format=json")
+
+	if stderr != "" {
+		t.Errorf("unexpected error: %s", stderr)
+	}
+	if !strings.Contains(stdout, `"page_count"`) || !strings.Contains(stdout, `"objects"`) {
+		t.Errorf("expected JSON size report, got: %s", stdout)
+	}
+}
+
+func TestCLI_Size_UnknownSortKey(t *testing.T) {
+	env := newTestEnv(t, "users.db")
+	defer env.Close()
+
+	_, stderr, _ := env.run(env.adminUser, "size", "test", "--sort=color")
+
+	if !strings.Contains(stderr, "Unknown sort key") {
+		t.Errorf("expected sort key error, got: %s", stderr)
+	}
+}
+
+func TestCLI_Info_ShowsMetadata(t *testing.T) {
+	env := newTestEnv(t, "users.db")
+	defer env.Close()
+
+	env.run(env.adminUser, "pragma", "test", "user_version", "7")
+	stdout, stderr, _ := env.run(env.readOnlyUser, "info", "test", "--format=json")
+
+	if stderr != "" {
+		t.Errorf("unexpected error: %s", stderr)
+	}
+	var info map[string]any
+	if err := json.Unmarshal([]byte(stdout), &info); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, stdout)
+	}
+	if info["user_version"] != float64(7) || info["encoding"] != "UTF-8" {
+		t.Errorf("unexpected info: %s", stdout)
+	}
+	for _, key := range []string{"tables", "page_size", "journal_mode", "application_id", "wal_size"} {
+		if _, ok := info[key]; !ok {
+			t.Errorf("expected %q in info, got: %s", key, stdout)
+		}
+	}
+}
+
+func TestCLI_Check_ReportsOK(t *testing.T) {
+	env := newTestEnv(t, "users.db")
+	defer env.Close()
+
+	stdout, stderr, code := env.run(env.readOnlyUser, "check", "test")
+	if code != ExitOK || stderr != "" {
+		t.Fatalf("check failed (%d): %s", code, stderr)
+	}
+	if !strings.HasPrefix(stdout, "ok") {
+		t.Errorf("expected ok, got: %s", stdout)
+	}
+
+	stdout, _, _ = env.run(env.readOnlyUser, "check", "test", "--quick", "--format=json")
+	if !strings.Contains(stdout, `"ok": true`) || !strings.Contains(stdout, `"quick": true`) {
+		t.Errorf("expected JSON report, got: %s", stdout)
+	}
+}
+
+func TestCLI_Tail(t *testing.T) {
+	env := newTestEnv(t, "users.db")
+	defer env.Close()
+
+	stdout, stderr, code := env.run(env.readOnlyUser, "tail", "test", "users", "--lines=2", "--format=csv")
+	if code != ExitOK || stderr != "" {
+		t.Fatalf("tail failed (%d): %s", code, stderr)
+	}
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	if len(lines) != 3 || !strings.Contains(lines[2], "Charlie") || strings.Contains(stdout, "Alice") {
+		t.Errorf("expected the header and last two rows, oldest first, got: %s", stdout)
+	}
+
+	if _, _, code := env.run(env.readOnlyUser, "tail", "test", "nope"); code != ExitNotFound {
+		t.Errorf("expected exit %d for a missing table, got %d", ExitNotFound, code)
+	}
+}
+
+func TestCLI_Query_Snapshot(t *testing.T) {
+	env := newTestEnv(t, "users.db")
+	defer env.Close()
+
+	stdout, stderr, code := env.run(env.readOnlyUser, "query", "test", "SELECT count(*) AS n FROM users", "--snapshot", "--format=json")
+	if code != ExitOK || stderr != "" {
+		t.Fatalf("snapshot query failed (%d): %s", code, stderr)
+	}
+	if !strings.Contains(stdout, `"n"`) {
+		t.Errorf("expected a count, got: %s", stdout)
+	}
+
+	_, _, code = env.run(env.adminUser, "query", "test", "DELETE FROM users", "--snapshot")
+	if code != ExitUsage {
+		t.Errorf("write on a snapshot: exit %d, want %d", code, ExitUsage)
+	}
+}
+
+// --- Exit Code Tests ---
+
+func TestCLI_ExitCodes(t *testing.T) {
+	env := newTestEnv(t, "users.db")
+	defer env.Close()
+
+	tests := []struct {
+		name string
+		user *access.UserInfo
+		args []string
+		want int
+	}{
+		{"success", env.adminUser, []string{"count", "test", "users"}, ExitOK},
+		{"usage", env.adminUser, []string{"select", "test"}, ExitUsage},
+		{"unknown command", env.adminUser, []string{"nonexistent-command"}, ExitUsage},
+		{"access denied", env.readOnlyUser, []string{"delete", "test", "users", "--where=id=1", "--confirm"}, ExitAccessDenied},
+		{"database not found", env.adminUser, []string{"tables", "nope"}, ExitNotFound},
+		{"table not found", env.adminUser, []string{"schema", "test", "nope"}, ExitNotFound},
+		{"sql error", env.adminUser, []string{"query", "test", "SELECT * FROM users WHERE"}, ExitSQLError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, stderr, code := env.run(tt.user, tt.args...)
+			if code != tt.want {
+				t.Errorf("exit code = %d, want %d (stderr: %s)", code, tt.want, stderr)
+			}
+		})
+	}
+}
+
+func TestCLI_ExitCode_Locked(t *testing.T) {
+	env := newTestEnv(t, "users.db")
+	defer env.Close()
+
+	db := env.manager.GetDatabase("test")
+	if err := env.manager.GetLockManager().TryLock(db.Path, "someone-else", "other-session"); err != nil {
+		t.Fatalf("failed to take lock: %v", err)
+	}
+
+	_, _, code := env.run(env.adminUser, "query", "test", "DELETE FROM users WHERE id = 1")
+	if code != ExitLocked {
+		t.Errorf("exit code = %d, want %d", code, ExitLocked)
+	}
+}
+
+func TestCLI_Wait(t *testing.T) {
+	env := newTestEnv(t, "users.db")
+	defer env.Close()
+
+	db := env.manager.GetDatabase("test")
+	locks := env.manager.GetLockManager()
+	if err := locks.TryLock(db.Path, "someone-else", "other-session"); err != nil {
+		t.Fatalf("failed to take lock: %v", err)
+	}
+
+	_, _, code := env.run(env.adminUser, "query", "test", "UPDATE users SET name = 'x' WHERE id = 1", "--wait=abc")
+	if code != ExitUsage {
+		t.Errorf("invalid --wait: exit code = %d, want %d", code, ExitUsage)
+	}
+	_, _, code = env.run(env.adminUser, "query", "test", "UPDATE users SET name = 'x' WHERE id = 1", "--wait=20ms")
+	if code != ExitLocked {
+		t.Errorf("--wait timing out: exit code = %d, want %d", code, ExitLocked)
+	}
+
+	go func() {
+		for locks.QueueLength(db.Path) == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		locks.Unlock(db.Path, "other-session")
+	}()
+	_, stderr, code := env.run(env.adminUser, "query", "test", "UPDATE users SET name = 'x' WHERE id = 1", "--wait=5s")
+	if code != ExitOK {
+		t.Fatalf("--wait: exit code = %d, stderr: %s", code, stderr)
+	}
+	if !strings.Contains(stderr, "Waiting for the write lock held by someone-else (1st in line)") {
+		t.Errorf("expected the place in line on stderr, got %q", stderr)
+	}
+}
+
+func TestCLI_Quiet_SuppressesInfo(t *testing.T) {
+	env := newTestEnv(t, "users.db")
+	defer env.Close()
+
+	stdout, stderr, _ := env.run(env.adminUser,
+		"insert", "test", "users", `--json={"name":"Quiet","email":"q@example.com"}`, "--quiet")
+
+	if stderr != "" {
+		t.Errorf("unexpected error: %s", stderr)
+	}
+	if stdout != "" {
+		t.Errorf("expected no output with --quiet, got: %s", stdout)
+	}
+}
+
+// --- Output File Tests ---
+
+func TestCLI_Output_WritesFile(t *testing.T) {
+	env := newTestEnv(t, "users.db")
+	defer env.Close()
+
+	outPath := filepath.Join(t.TempDir(), "users.csv")
+	stdout, stderr, code := env.run(env.adminUser, "export", "test", "users", "--output="+outPath)
+
+	if code != ExitOK || stderr != "" {
+		t.Fatalf("export failed: code=%d stderr=%s", code, stderr)
+	}
+	if stdout != "" {
+		t.Errorf("expected nothing on stdout, got: %s", stdout)
+	}
+	data, err := os.ReadFile(outPath)
+	if err != nil {
+		t.Fatalf("failed to read output file: %v", err)
+	}
+	if !strings.Contains(string(data), "Alice") {
+		t.Errorf("expected Alice in output file, got: %s", data)
+	}
+}
+
+func TestCLI_Output_FailureLeavesNoFile(t *testing.T) {
+	env := newTestEnv(t, "users.db")
+	defer env.Close()
+
+	dir := t.TempDir()
+	outPath := filepath.Join(dir, "missing.csv")
+	_, _, code := env.run(env.adminUser, "export", "test", "no_such_table", "--output="+outPath)
+
+	if code == ExitOK {
+		t.Fatal("expected export of missing table to fail")
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 0 {
+		t.Errorf("expected no files after failed export, found %d", len(entries))
+	}
+}
+
+// --- Table Output Tests ---
+
+func TestPrintTable_AlignsAndTruncates(t *testing.T) {
+	var buf bytes.Buffer
+	printTable(&buf, []string{"id", "name"}, [][]string{
+		{"1", "Al"},
+		{"100", "a very long value\nwith a newline"},
+	}, 10)
+
+	lines := strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 lines, got %d: %q", len(lines), buf.String())
+	}
+	// Second column starts at the same offset on every line
+	for _, line := range lines {
+		if len(line) < 6 || line[3:5] != "  " || line[5] == ' ' {
+			t.Errorf("misaligned line %q", line)
+		}
+	}
+	if !strings.HasSuffix(lines[2], "…") {
+		t.Errorf("expected truncated cell, got %q", lines[2])
+	}
+	if strings.Contains(buf.String(), "\t") {
+		t.Errorf("expected no tabs in table output, got %q", buf.String())
+	}
+}
+
+func TestCLI_Select_MaxColWidthZeroDisablesTruncation(t *testing.T) {
+	env := newTestEnv(t, "users.db")
+	defer env.Close()
+
+	stdout, stderr, _ := env.run(env.adminUser, "select", "test", "users", "--max-col-width=0")
+
+	if stderr != "" {
+		t.Errorf("unexpected error: %s", stderr)
+	}
+	if strings.Contains(stdout, "…") {
+		t.Errorf("expected no truncation, got: %s", stdout)
+	}
+}
+
+// --- TSV and Header Tests ---
+
+func TestCLI_Select_TSVNoHeader(t *testing.T) {
+	env := newTestEnv(t, "users.db")
+	defer env.Close()
+
+	stdout, stderr, _ := env.run(env.adminUser,
+		"select", "test", "users", "--columns=id,name", "--format=tsv", "--no-header")
+
+	if stderr != "" {
+		t.Errorf("unexpected error: %s", stderr)
+	}
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 data lines, got %d: %q", len(lines), stdout)
+	}
+	if lines[0] != "1\tAlice" {
+		t.Errorf("first line = %q, want %q", lines[0], "1\tAlice")
+	}
+}
+
+func TestPrintTSV_EscapesSpecialCharacters(t *testing.T) {
+	var buf bytes.Buffer
+	printTSV(&buf, []string{"a", "b"}, [][]string{{"x\ty", "line1\nline2\\"}})
+
+	want := "a\tb\nx\\ty\tline1\\nline2\\\\\n"
+	if buf.String() != want {
+		t.Errorf("printTSV() = %q, want %q", buf.String(), want)
+	}
+}
+
+// newAttachEnv sets up users.db as "test" and large.db as "other", with a
+// user that can only read "test".
+func newAttachEnv(t *testing.T) *testEnv {
+	t.Helper()
+
+	usersPath, cleanupUsers := testutil.TestDB(t, "users.db")
+	largePath, cleanupLarge := testutil.TestDB(t, "large.db")
+
+	cfg := &config.Config{
+		Databases: []config.DatabaseSource{
+			{Path: usersPath, Alias: "test"},
+			{Path: largePath, Alias: "other"},
+		},
+		AnonymousAccess: "none",
+		Users: []config.User{
+			{Name: "admin", Admin: true},
+			{Name: "reader", Access: []config.AccessRule{{Pattern: "*", Level: "read-only"}}},
+			{Name: "limited", Access: []config.AccessRule{{Pattern: "test", Level: "read-only"}}},
+			{Name: "editor", Access: []config.AccessRule{
+				{Pattern: "test", Level: "read-write"},
+				{Pattern: "other", Level: "read-only"},
+			}},
+		},
+	}
+
+	manager, err := database.NewManager(cfg)
+	if err != nil {
+		t.Fatalf("failed to create manager: %v", err)
+	}
+	if err := manager.Start(); err != nil {
+		t.Fatalf("failed to start manager: %v", err)
+	}
+
+	return &testEnv{
+		t:       t,
+		dbPath:  usersPath,
+		cleanup: func() { cleanupUsers(); cleanupLarge() },
+		manager: manager,
+		handler: NewHandler(manager, nil, "test"),
+
+		adminUser:    &access.UserInfo{Name: "admin", IsAdmin: true},
+		readOnlyUser: &access.UserInfo{Name: "reader"},
+		anonUser:     &access.UserInfo{Name: "anon", IsAnonymous: true},
+	}
+}
+
+func TestCLI_Query_AttachJoinsAcrossDatabases(t *testing.T) {
+	env := newAttachEnv(t)
+	defer env.Close()
+
+	stdout, stderr, code := env.run(env.readOnlyUser, "query", "test",
+		"SELECT u.name, r.name FROM users u JOIN o.records r ON r.id = u.id ORDER BY u.id",
+		"--attach=other:o", "--format=csv")
+	if code != ExitOK {
+		t.Fatalf("expected success, got code=%d stderr=%q", code, stderr)
+	}
+	if !strings.Contains(stdout, "Alice") {
+		t.Errorf("expected joined rows, got %q", stdout)
+	}
+
+	// The attachment is gone once the query finishes
+	_, _, code = env.run(env.readOnlyUser, "query", "test", "SELECT COUNT(*) FROM o.records")
+	if code == ExitOK {
+		t.Error("attached database leaked into the shared connection")
+	}
+}
+
+func TestCLI_Query_AttachChecksAccess(t *testing.T) {
+	env := newAttachEnv(t)
+	defer env.Close()
+
+	limited := &access.UserInfo{Name: "limited"}
+	_, _, code := env.run(limited, "query", "test", "SELECT 1", "--attach=other")
+	if code != ExitAccessDenied && code != ExitNotFound {
+		t.Errorf("expected attach of inaccessible database to fail, got code=%d", code)
+	}
+
+	_, _, code = env.run(env.readOnlyUser, "query", "test", "SELECT 1", "--attach=missing")
+	if code != ExitNotFound {
+		t.Errorf("expected not found for unknown attachment, got code=%d", code)
+	}
+
+	_, _, code = env.run(env.readOnlyUser, "query", "test", "SELECT 1", "--attach=other:main")
+	if code != ExitUsage {
+		t.Errorf("expected usage error for reserved schema name, got code=%d", code)
+	}
+}
+
+func TestCLI_Query_AttachIsReadOnlyWithoutWriteAccess(t *testing.T) {
+	env := newAttachEnv(t)
+	defer env.Close()
+
+	editor := &access.UserInfo{Name: "editor"}
+
+	// Explicit writes need write access to every attachment
+	_, _, code := env.run(editor, "query", "test", "DELETE FROM o.records", "--attach=other:o")
+	if code != ExitAccessDenied {
+		t.Errorf("expected access denied, got code=%d", code)
+	}
+
+	// A write the prefix heuristic misses is still stopped by the read-only attach
+	_, _, code = env.run(editor, "query", "test",
+		"WITH x AS (SELECT 1) DELETE FROM o.records", "--attach=other:o")
+	if code == ExitOK {
+		t.Error("expected write to read-only attachment to fail")
+	}
+
+	stdout, _, _ := env.run(env.adminUser, "count", "other", "records")
+	if strings.TrimSpace(stdout) == "0" {
+		t.Error("records were deleted through a read-only attachment")
+	}
+}
+
+func TestCLI_FTS_CreateSearchDrop(t *testing.T) {
+	env := newTestEnv(t, "users.db")
+	defer env.Close()
+
+	_, stderr, code := env.run(env.adminUser, "fts", "create", "test", "users", "--columns=name,email")
+	if code != ExitOK {
+		t.Fatalf("create failed: code=%d stderr=%q", code, stderr)
+	}
+
+	stdout, stderr, code := env.run(env.adminUser, "fts", "search", "test", "users_fts", "alice", "--format=csv")
+	if code != ExitOK {
+		t.Fatalf("search failed: code=%d stderr=%q", code, stderr)
+	}
+	if !strings.Contains(stdout, "Alice") || strings.Contains(stdout, "Bob") {
+		t.Errorf("expected only Alice, got %q", stdout)
+	}
+
+	// New rows are indexed by the triggers
+	env.run(env.adminUser, "insert", "test", "users", `--json={"name":"Zelda","email":"zelda@example.com"}`)
+	stdout, _, _ = env.run(env.adminUser, "fts", "search", "test", "users_fts", "zelda")
+	if !strings.Contains(stdout, "Zelda") {
+		t.Errorf("expected inserted row to be searchable, got %q", stdout)
+	}
+
+	_, stderr, code = env.run(env.adminUser, "fts", "drop", "test", "users_fts")
+	if code != ExitOK {
+		t.Fatalf("drop failed: code=%d stderr=%q", code, stderr)
+	}
+
+	// Writes still work once the triggers are gone
+	_, stderr, code = env.run(env.adminUser, "insert", "test", "users", `--json={"name":"Yann","email":"yann@example.com"}`)
+	if code != ExitOK {
+		t.Errorf("insert after drop failed: %q", stderr)
+	}
+}
+
+func TestCLI_FTS_RejectsPlainTable(t *testing.T) {
+	env := newTestEnv(t, "users.db")
+	defer env.Close()
+
+	_, _, code := env.run(env.adminUser, "fts", "drop", "test", "users")
+	if code != ExitNotFound {
+		t.Errorf("expected not found for non-FTS table, got code=%d", code)
+	}
+
+	stdout, _, _ := env.run(env.adminUser, "tables", "test")
+	if !strings.Contains(stdout, "users") {
+		t.Error("plain table was dropped")
+	}
+}
+
+func TestCLI_FTS_ReaderCannotCreate(t *testing.T) {
+	env := newTestEnv(t, "users.db")
+	defer env.Close()
+
+	_, _, code := env.run(env.readOnlyUser, "fts", "create", "test", "users", "--columns=name")
+	if code != ExitAccessDenied {
+		t.Errorf("expected access denied, got code=%d", code)
+	}
+}
+
+func TestCLI_JSON_ExtractAndEach(t *testing.T) {
+	env := newTestEnv(t, "users.db")
+	defer env.Close()
+
+	env.run(env.adminUser, "query", "test", "CREATE TABLE docs (id INTEGER PRIMARY KEY, data TEXT)")
+	env.run(env.adminUser, "query", "test",
+		`INSERT INTO docs (data) VALUES ('{"user":{"name":"ann"},"tags":["a","b","c"]}'), ('not json')`)
+
+	stdout, stderr, code := env.run(env.readOnlyUser, "json", "extract", "test", "docs", "data", "$.user.name", "--format=csv")
+	if code != ExitOK {
+		t.Fatalf("extract failed: code=%d stderr=%q", code, stderr)
+	}
+	if !strings.Contains(stdout, "1,ann") || !strings.Contains(stdout, "2,NULL") {
+		t.Errorf("unexpected extract output: %q", stdout)
+	}
+
+	stdout, stderr, code = env.run(env.readOnlyUser, "json", "each", "test", "docs", "data", "$.tags", "--format=csv", "--no-header")
+	if code != ExitOK {
+		t.Fatalf("each failed: code=%d stderr=%q", code, stderr)
+	}
+	if lines := strings.Split(strings.TrimSpace(stdout), "\n"); len(lines) != 3 {
+		t.Errorf("expected 3 exploded rows, got %q", stdout)
+	}
+}
+
+func TestCLI_JSON_RejectsBadPath(t *testing.T) {
+	env := newTestEnv(t, "users.db")
+	defer env.Close()
+
+	_, _, code := env.run(env.readOnlyUser, "json", "extract", "test", "users", "name", "user.name")
+	if code != ExitUsage {
+		t.Errorf("expected usage error, got code=%d", code)
+	}
+}
+
+func TestCLI_Seed_RespectsConstraints(t *testing.T) {
+	env := newTestEnv(t, "users.db")
+	defer env.Close()
+
+	_, stderr, code := env.run(env.adminUser, "seed", "test", "users", "--rows=200", "--seed=1")
+	if code != ExitOK {
+		t.Fatalf("seed users failed: code=%d stderr=%q", code, stderr)
+	}
+
+	// posts.user_id is NOT NULL and references users(id)
+	_, stderr, code = env.run(env.adminUser, "seed", "test", "posts", "--rows=50", "--seed=1")
+	if code != ExitOK {
+		t.Fatalf("seed posts failed: code=%d stderr=%q", code, stderr)
+	}
+
+	stdout, _, _ := env.run(env.adminUser, "query", "test",
+		"SELECT COUNT(*) FROM posts WHERE user_id NOT IN (SELECT id FROM users) OR title IS NULL", "--format=csv", "--no-header")
+	if strings.TrimSpace(stdout) != "0" {
+		t.Errorf("expected all seeded posts to be valid, got %q", stdout)
+	}
+	stdout, _, _ = env.run(env.adminUser, "count", "test", "users")
+	if !strings.Contains(stdout, "203") {
+		t.Errorf("expected 203 users, got %q", stdout)
+	}
+}
+
+func TestCLI_Seed_InvalidSpec(t *testing.T) {
+	env := newTestEnv(t, "users.db")
+	defer env.Close()
+
+	_, _, code := env.run(env.adminUser, "seed", "test", "users", "--spec=name:nonsense")
+	if code != ExitUsage {
+		t.Errorf("expected usage error for unknown kind, got code=%d", code)
+	}
+	_, _, code = env.run(env.readOnlyUser, "seed", "test", "users")
+	if code != ExitAccessDenied {
+		t.Errorf("expected access denied for reader, got code=%d", code)
+	}
+}
+
+func TestCLI_Checksum_IndependentOfRowOrder(t *testing.T) {
+	env := newTestEnv(t, "users.db")
+	defer env.Close()
+
+	before, stderr, code := env.run(env.adminUser, "checksum", "test", "users")
+	if code != ExitOK {
+		t.Fatalf("checksum failed: code=%d stderr=%q", code, stderr)
+	}
+
+	// Rewriting the table in a different physical order keeps the checksum
+	env.run(env.adminUser, "query", "test", "CREATE TABLE tmp AS SELECT * FROM users")
+	env.run(env.adminUser, "query", "test", "DELETE FROM users")
+	env.run(env.adminUser, "query", "test", "INSERT INTO users SELECT * FROM tmp ORDER BY id DESC")
+	after, _, _ := env.run(env.adminUser, "checksum", "test", "users")
+	if before != after {
+		t.Errorf("checksum changed with row order:\n%s\n%s", before, after)
+	}
+
+	env.run(env.adminUser, "update", "test", "users", "--where=id=1", `--set={"name":"Alicia"}`)
+	changed, _, _ := env.run(env.adminUser, "checksum", "test", "users")
+	if changed == before {
+		t.Error("checksum did not change after update")
+	}
+}
+
+func TestCLI_Checksum_UnknownTable(t *testing.T) {
+	env := newTestEnv(t, "users.db")
+	defer env.Close()
+
+	_, _, code := env.run(env.readOnlyUser, "checksum", "test", "missing")
+	if code != ExitNotFound {
+		t.Errorf("expected not found, got code=%d", code)
+	}
+}
+
+func TestCLI_Describe_ProfilesColumns(t *testing.T) {
+	env := newTestEnv(t, "users.db")
+	defer env.Close()
+
+	stdout, stderr, code := env.run(env.readOnlyUser, "describe", "test", "users", "--format=json")
+	if code != ExitOK {
+		t.Fatalf("describe failed: code=%d stderr=%q", code, stderr)
+	}
+
+	var profile struct {
+		Rows    int64 `json:"rows"`
+		Columns []struct {
+			Name     string `json:"name"`
+			Nulls    int64  `json:"nulls"`
+			Distinct int64  `json:"distinct"`
+			Min      any    `json:"min"`
+			Max      any    `json:"max"`
+		} `json:"columns"`
+	}
+	if err := json.Unmarshal([]byte(stdout), &profile); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if profile.Rows != 3 {
+		t.Errorf("rows = %d, want 3", profile.Rows)
+	}
+	for _, c := range profile.Columns {
+		if c.Name == "name" {
+			if c.Distinct != 3 || c.Nulls != 0 || c.Min != "Alice" || c.Max != "Charlie" {
+				t.Errorf("unexpected profile for name: %+v", c)
+			}
+		}
+	}
+}
+
+func TestCLI_Dupes_FindsDuplicateKeys(t *testing.T) {
+	env := newTestEnv(t, "users.db")
+	defer env.Close()
+
+	env.run(env.adminUser, "insert", "test", "users", `--json={"name":"Alice","email":"alice2@example.com"}`)
+	env.run(env.adminUser, "insert", "test", "users", `--json={"name":"Alice","email":"alice3@example.com"}`)
+
+	stdout, stderr, code := env.run(env.adminUser, "dupes", "test", "users", "--columns=name", "--format=csv", "--delete-sql")
+	if code != ExitOK {
+		t.Fatalf("dupes failed: code=%d stderr=%q", code, stderr)
+	}
+	if !strings.Contains(stdout, "Alice,3,") {
+		t.Errorf("expected Alice with count 3, got %q", stdout)
+	}
+	if strings.Contains(stdout, "Bob") {
+		t.Errorf("unique rows should not be listed: %q", stdout)
+	}
+	if !strings.Contains(stdout, `DELETE FROM "users" WHERE rowid NOT IN (SELECT MIN(rowid) FROM "users" GROUP BY "name");`) {
+		t.Errorf("expected delete template, got %q", stdout)
+	}
+}
+
+func TestCLI_Dupes_UnknownColumn(t *testing.T) {
+	env := newTestEnv(t, "users.db")
+	defer env.Close()
+
+	_, stderr, code := env.run(env.readOnlyUser, "dupes", "test", "users", "--columns=nope")
+	if code != ExitUsage || !strings.Contains(stderr, "nope") {
+		t.Errorf("expected usage error for unknown column, got code=%d stderr=%q", code, stderr)
+	}
+}
+
+func TestCLI_History_Filters(t *testing.T) {
+	env := newTestEnv(t, "users.db")
+	defer env.Close()
+
+	store, err := history.NewStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create history store: %v", err)
+	}
+	defer store.Close()
+	env.handler = NewHandler(env.manager, store, "test")
+
+	env.run(env.adminUser, "query", "test", "SELECT name FROM users")
+	env.run(env.adminUser, "query", "test", "SELECT * FROM no_such_table")
+
+	stdout, stderr, code := env.run(env.adminUser, "history", "--errors-only", "--format=json")
+	if code != ExitOK {
+		t.Fatalf("history failed: code=%d stderr=%q", code, stderr)
+	}
+	if !strings.Contains(stdout, "no_such_table") || strings.Contains(stdout, "SELECT name") {
+		t.Errorf("expected only the failed query, got %q", stdout)
+	}
+
+	stdout, _, _ = env.run(env.adminUser, "history", "--search=select NAME", "--db=test")
+	if !strings.Contains(stdout, "SELECT name FROM users") || strings.Contains(stdout, "no_such_table") {
+		t.Errorf("expected only the matching query, got %q", stdout)
+	}
+
+	stdout, _, _ = env.run(env.adminUser, "history", "--until=2000-01-01", "--format=json")
+	if strings.Contains(stdout, "SELECT") {
+		t.Errorf("expected no queries before 2000, got %q", stdout)
+	}
+
+	_, _, code = env.run(env.adminUser, "history", "--since=whenever")
+	if code != ExitUsage {
+		t.Errorf("expected usage error for bad time, got code=%d", code)
+	}
+}
+
+func TestParseTimeFlag(t *testing.T) {
+	now := time.Date(2024, 5, 10, 15, 30, 0, 0, time.UTC)
+	tests := []struct {
+		in   string
+		want time.Time
+	}{
+		{"today", time.Date(2024, 5, 10, 0, 0, 0, 0, time.UTC)},
+		{"yesterday", time.Date(2024, 5, 9, 0, 0, 0, 0, time.UTC)},
+		{"2h", now.Add(-2 * time.Hour)},
+		{"7d", now.AddDate(0, 0, -7)},
+		{"2024-01-02", time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{"2024-01-02 03:04", time.Date(2024, 1, 2, 3, 4, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		got, err := parseTimeFlag(tt.in, now)
+		if err != nil || !got.Equal(tt.want) {
+			t.Errorf("parseTimeFlag(%q) = %v, %v; want %v", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestCLI_Audit_FiltersAndJSONL(t *testing.T) {
+	env := newTestEnv(t, "users.db")
+	defer env.Close()
+
+	store, err := history.NewStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create history store: %v", err)
+	}
+	defer store.Close()
+	env.handler = NewHandler(env.manager, store, "test")
+
+	env.run(env.adminUser, "insert", "test", "users", `--json={"name":"Dora","email":"dora@example.com"}`)
+	env.run(env.adminUser, "delete", "test", "users", "--where=name='Dora'", "--confirm")
+
+	stdout, stderr, code := env.run(env.adminUser, "audit", "--action=delete", "--db=test", "--table=users", "--format=jsonl")
+	if code != ExitOK {
+		t.Fatalf("audit failed: code=%d stderr=%q", code, stderr)
+	}
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("expected 1 jsonl line, got %q", stdout)
+	}
+	var event map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &event); err != nil {
+		t.Fatalf("invalid JSON line: %v", err)
+	}
+	if event["action"] != "DELETE" || event["table"] != "users" {
+		t.Errorf("unexpected event: %v", event)
+	}
+	if _, ok := event["details"].(map[string]any); !ok {
+		t.Errorf("expected details to be embedded as an object, got %T", event["details"])
+	}
+
+	stdout, _, _ = env.run(env.adminUser, "audit", "--table=posts", "--format=jsonl")
+	if strings.TrimSpace(stdout) != "" {
+		t.Errorf("expected no entries for posts, got %q", stdout)
+	}
+}
+
+func TestCLI_Locks_ListAndRelease(t *testing.T) {
+	env := newTestEnv(t, "users.db")
+	defer env.Close()
+
+	locks := env.manager.GetLockManager()
+	if err := locks.TryLock(env.dbPath, "crashed-user", "dead-session"); err != nil {
+		t.Fatalf("failed to take lock: %v", err)
+	}
+
+	stdout, stderr, code := env.run(env.adminUser, "locks")
+	if code != ExitOK {
+		t.Fatalf("locks failed: code=%d stderr=%q", code, stderr)
+	}
+	if !strings.Contains(stdout, "test") || !strings.Contains(stdout, "crashed-user") {
+		t.Errorf("expected lock to be listed, got %q", stdout)
+	}
+
+	_, _, code = env.run(env.readOnlyUser, "locks", "release", "test")
+	if code != ExitAccessDenied {
+		t.Errorf("expected non-admin release to be denied, got code=%d", code)
+	}
+
+	_, stderr, code = env.run(env.adminUser, "locks", "release", "test")
+	if code != ExitOK {
+		t.Fatalf("release failed: code=%d stderr=%q", code, stderr)
+	}
+	if locks.IsLocked(env.dbPath) {
+		t.Error("lock still held after release")
+	}
+
+	_, _, code = env.run(env.adminUser, "locks", "release", "test")
+	if code != ExitNotFound {
+		t.Errorf("expected not found when no lock is held, got code=%d", code)
+	}
+}
+
+func TestCLI_Sessions_Kill(t *testing.T) {
+	env := newTestEnv(t, "users.db")
+	defer env.Close()
+
+	sessions := server.NewSessionManager(nil)
+	own, err := sessions.CreateSession(env.adminUser, "192.0.2.1:5000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	run := func(user *access.UserInfo, args ...string) (string, string, int) {
+		var outBuf, errBuf bytes.Buffer
+		ctx := &CommandContext{
+			User:        user,
+			SessionInfo: own,
+			SessionMgr:  sessions,
+			DBManager:   env.manager,
+			Args:        args[1:],
+			Out:         &outBuf,
+			Err:         &errBuf,
+			exitCode:    ExitOK,
+		}
+		env.handler.routeCommand(args[0], ctx)
+		return outBuf.String(), errBuf.String(), ctx.exitCode
+	}
+
+	// Create sessions until two share a first character, for an
+	// ambiguous prefix
+	byPrefix := map[string]*server.Session{}
+	var first, second *server.Session
+	for second == nil {
+		s, err := sessions.CreateSession(env.readOnlyUser, "198.51.100.7:5000")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if other := byPrefix[s.ID[:1]]; other != nil {
+			first, second = other, s
+		}
+		byPrefix[s.ID[:1]] = s
+	}
+	locks := env.manager.GetLockManager()
+	if err := locks.TryLock(env.dbPath, "reader", first.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, code := run(env.readOnlyUser, "sessions", "kill", first.ID); code != ExitAccessDenied {
+		t.Errorf("expected non-admin kill to be denied, got code=%d", code)
+	}
+	if _, stderr, code := run(env.adminUser, "sessions", "kill", first.ID[:1]); code != ExitUsage || !strings.Contains(stderr, "ambiguous") {
+		t.Errorf("expected an ambiguous prefix to be refused, got code=%d stderr=%q", code, stderr)
+	}
+	if _, stderr, code := run(env.adminUser, "sessions", "kill", own.ID); code != ExitUsage || !strings.Contains(stderr, "your own session") {
+		t.Errorf("expected killing your own session to be refused, got code=%d stderr=%q", code, stderr)
+	}
+	if _, _, code := run(env.adminUser, "sessions", "kill", "nope"); code != ExitNotFound {
+		t.Errorf("expected an unknown session to be not found, got code=%d", code)
+	}
+
+	stdout, stderr, code := run(env.adminUser, "sessions", "kill", first.ID[:8])
+	if code != ExitOK || !strings.Contains(stdout, "Killed session "+first.ID[:8]) {
+		t.Fatalf("kill by prefix failed: code=%d stdout=%q stderr=%q", code, stdout, stderr)
+	}
+	if sessions.GetSession(first.ID) != nil || sessions.GetSession(second.ID) == nil {
+		t.Error("expected just the named session to end")
+	}
+	if locks.IsLocked(env.dbPath) {
+		t.Error("expected the killed session's lock to be released")
+	}
+
+	stdout, _, code = run(env.adminUser, "sessions")
+	if code != ExitOK || strings.Contains(stdout, first.ID[:8]) || !strings.Contains(stdout, second.ID[:8]) {
+		t.Errorf("unexpected session list: code=%d stdout=%q", code, stdout)
+	}
+}
+
+func TestShortID(t *testing.T) {
+	for id, want := range map[string]string{
+		"":                                     "",
+		"abc":                                  "abc",
+		"12345678":                             "12345678",
+		"0f8c2d4e-7a1b-4c3d-9e8f-1a2b3c4d5e6f": "0f8c2d4e",
+	} {
+		if got := shortID(id); got != want {
+			t.Errorf("shortID(%q) = %q, want %q", id, got, want)
+		}
+	}
+}
+
+func TestCLI_Status(t *testing.T) {
+	env := newTestEnv(t, "users.db")
+	defer env.Close()
+
+	store, err := history.NewStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create history store: %v", err)
+	}
+	defer store.Close()
+	env.handler = NewHandler(env.manager, store, "test")
+
+	if err := env.manager.GetLockManager().TryLock(env.dbPath, "someone", "s1"); err != nil {
+		t.Fatalf("failed to take lock: %v", err)
+	}
+
+	stdout, stderr, code := env.run(env.adminUser, "status", "--format=json")
+	if code != ExitOK {
+		t.Fatalf("status failed: code=%d stderr=%q", code, stderr)
+	}
+	var status map[string]any
+	if err := json.Unmarshal([]byte(stdout), &status); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, stdout)
+	}
+	if status["version"] != "test" || status["databases"] != float64(1) || status["locks"] != float64(1) {
+		t.Errorf("unexpected status: %v", status)
+	}
+	if size, ok := status["history_bytes"].(float64); !ok || size <= 0 {
+		t.Errorf("expected history size, got %v", status["history_bytes"])
+	}
+
+	_, _, code = env.run(env.readOnlyUser, "status")
+	if code != ExitAccessDenied {
+		t.Errorf("expected non-admin to be denied, got code=%d", code)
+	}
+}
+
+func TestCLI_History_Prune(t *testing.T) {
+	env := newTestEnv(t, "users.db")
+	defer env.Close()
+
+	store, err := history.NewStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create history store: %v", err)
+	}
+	defer store.Close()
+	env.handler = NewHandler(env.manager, store, "test")
+
+	old := time.Now().AddDate(0, 0, -60)
+	store.RecordQuery(&history.QueryRecord{DatabasePath: "test", Query: "SELECT 'old ok'", CreatedAt: old})
+	store.RecordQuery(&history.QueryRecord{DatabasePath: "test", Query: "SELECT 'old error'", Error: "boom", CreatedAt: old})
+	store.RecordAudit(&history.AuditRecord{Action: "DELETE", DatabasePath: "test", CreatedAt: old})
+	env.run(env.adminUser, "query", "test", "SELECT 'recent'")
+
+	_, _, code := env.run(env.adminUser, "history", "prune")
+	if code != ExitUsage {
+		t.Errorf("expected usage error without --older-than, got code=%d", code)
+	}
+
+	stdout, stderr, code := env.run(env.adminUser, "history", "prune", "--older-than=30d", "--keep-errors", "--format=json")
+	if code != ExitOK {
+		t.Fatalf("history prune failed: code=%d stderr=%q", code, stderr)
+	}
+	if !strings.Contains(stdout, `"deleted": 1`) {
+		t.Errorf("expected one deleted entry, got %q", stdout)
+	}
+
+	stdout, _, _ = env.run(env.adminUser, "history", "--format=json")
+	if strings.Contains(stdout, "old ok") || !strings.Contains(stdout, "old error") || !strings.Contains(stdout, "recent") {
+		t.Errorf("unexpected history after prune: %q", stdout)
+	}
+
+	stdout, stderr, code = env.run(env.adminUser, "audit", "prune", "--older-than=30d", "--format=json")
+	if code != ExitOK {
+		t.Fatalf("audit prune failed: code=%d stderr=%q", code, stderr)
+	}
+	if !strings.Contains(stdout, `"deleted": 1`) {
+		t.Errorf("expected one deleted audit entry, got %q", stdout)
+	}
+
+	stdout, _, _ = env.run(env.adminUser, "audit", "--format=json")
+	if strings.Contains(stdout, `"DELETE"`) || !strings.Contains(stdout, "PRUNE_HISTORY") {
+		t.Errorf("unexpected audit log after prune: %q", stdout)
+	}
+}
+
+func TestCLI_Health(t *testing.T) {
+	env := newTestEnv(t, "users.db")
+	defer env.Close()
+
+	store, err := history.NewStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create history store: %v", err)
+	}
+	defer store.Close()
+	env.handler = NewHandler(env.manager, store, "test")
+
+	stdout, stderr, code := env.run(env.adminUser, "health", "--format=json")
+	if code != ExitOK {
+		t.Fatalf("health failed: code=%d stderr=%q stdout=%q", code, stderr, stdout)
+	}
+	for _, check := range []string{`"discovery"`, `"history"`, `"database"`, `"test opens"`} {
+		if !strings.Contains(stdout, check) {
+			t.Errorf("expected %s in report, got %q", check, stdout)
+		}
+	}
+
+	stdout, _, _ = env.run(env.readOnlyUser, "health")
+	if strings.Contains(stdout, "test opens") {
+		t.Errorf("expected details to be hidden from non-admins, got %q", stdout)
+	}
+
+	// A closed history store is reported as unhealthy
+	store.Close()
+	stdout, _, code = env.run(env.adminUser, "health")
+	if code != ExitUsage || !strings.Contains(stdout, "FAIL") {
+		t.Errorf("expected failing health check, got code=%d stdout=%q", code, stdout)
+	}
+}
+
+func TestCLI_HostKey(t *testing.T) {
+	env := newTestEnv(t, "users.db")
+	defer env.Close()
+
+	_, _, code := env.run(env.readOnlyUser, "host-key")
+	if code != ExitAccessDenied {
+		t.Errorf("expected non-admin to be denied, got code=%d", code)
+	}
+
+	// Host keys belong to the SSH server
+	_, stderr, code := env.run(env.adminUser, "host-key", "rotate")
+	if code != ExitUsage || !strings.Contains(stderr, "SSH server mode") {
+		t.Errorf("expected usage error in local mode, got code=%d stderr=%q", code, stderr)
+	}
+
+	for v, want := range map[string]time.Duration{"0": 0, "12h": 12 * time.Hour, "7d": 7 * 24 * time.Hour} {
+		if got, err := parseDurationFlag(v); err != nil || got != want {
+			t.Errorf("parseDurationFlag(%q) = %v, %v; want %v", v, got, err, want)
+		}
+	}
+	if _, err := parseDurationFlag("-1h"); err == nil {
+		t.Error("expected negative grace to be rejected")
+	}
+}
+
+func TestCLI_Bans(t *testing.T) {
+	env := newTestEnv(t, "users.db")
+	defer env.Close()
+
+	store, err := history.NewStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create history store: %v", err)
+	}
+	defer store.Close()
+	env.handler = NewHandler(env.manager, store, "test")
+
+	now := time.Now()
+	store.RecordAuthFailure("203.0.113.7", "root", "SHA256:abc", now)
+	store.BanIP(&history.Ban{IP: "203.0.113.7", Reason: "test", Failures: 3, CreatedAt: now, ExpiresAt: now.Add(time.Hour)})
+	store.BanIP(&history.Ban{IP: "198.51.100.1", Reason: "old", Failures: 3, CreatedAt: now.Add(-2 * time.Hour), ExpiresAt: now.Add(-time.Hour)})
+
+	_, _, code := env.run(env.readOnlyUser, "bans")
+	if code != ExitAccessDenied {
+		t.Errorf("expected non-admin to be denied, got code=%d", code)
+	}
+
+	stdout, stderr, code := env.run(env.adminUser, "bans", "--format=json")
+	if code != ExitOK {
+		t.Fatalf("bans failed: code=%d stderr=%q", code, stderr)
+	}
+	if !strings.Contains(stdout, "203.0.113.7") || strings.Contains(stdout, "198.51.100.1") {
+		t.Errorf("expected only the active ban, got %q", stdout)
+	}
+
+	stdout, _, _ = env.run(env.adminUser, "bans", "--all")
+	if !strings.Contains(stdout, "198.51.100.1") || !strings.Contains(stdout, "expired") {
+		t.Errorf("expected expired ban with --all, got %q", stdout)
+	}
+
+	_, _, code = env.run(env.adminUser, "bans", "clear", "192.0.2.1")
+	if code != ExitNotFound {
+		t.Errorf("expected not found for unbanned IP, got code=%d", code)
+	}
+
+	_, stderr, code = env.run(env.adminUser, "bans", "clear", "203.0.113.7")
+	if code != ExitOK {
+		t.Fatalf("bans clear failed: code=%d stderr=%q", code, stderr)
+	}
+	if ban, _ := store.GetBan("203.0.113.7"); ban != nil {
+		t.Errorf("expected ban to be cleared, got %+v", ban)
+	}
+	if n, _ := store.CountAuthFailures("203.0.113.7", now.Add(-time.Minute)); n != 0 {
+		t.Errorf("expected failures to be forgotten, got %d", n)
+	}
+
+	stdout, _, _ = env.run(env.adminUser, "audit", "--action=unban_ip", "--format=json")
+	if !strings.Contains(stdout, "UNBAN_IP") {
+		t.Errorf("expected UNBAN_IP audit entry, got %q", stdout)
+	}
+
+	stdout, _, code = env.run(env.adminUser, "bans", "clear", "--all", "--format=json")
+	if code != ExitOK || !strings.Contains(stdout, `"cleared": 1`) {
+		t.Errorf("expected one ban cleared, got code=%d stdout=%q", code, stdout)
+	}
+}
+
+func TestCLI_WebLogin(t *testing.T) {
+	env := newTestEnv(t, "users.db")
+	defer env.Close()
+
+	// Sign-in links are handed out by the SSH server
+	_, stderr, code := env.run(env.readOnlyUser, "web-login")
+	if code != ExitUsage || !strings.Contains(stderr, "SSH server mode") {
+		t.Errorf("expected usage error in local mode, got code=%d stderr=%q", code, stderr)
+	}
+}
+
+func TestCLI_APIToken(t *testing.T) {
+	env := newTestEnv(t, "users.db")
+	defer env.Close()
+
+	// Tokens are handed out by the SSH server
+	_, stderr, code := env.run(env.readOnlyUser, "api-token")
+	if code != ExitUsage || !strings.Contains(stderr, "SSH server mode") {
+		t.Errorf("expected usage error in local mode, got code=%d stderr=%q", code, stderr)
+	}
+}
+
+func TestCLI_Upload(t *testing.T) {
+	env := newTestEnv(t, "users.db")
+	defer env.Close()
+
+	replacement, cleanup := testutil.TestDB(t, "empty.db")
+	defer cleanup()
+	data, err := os.ReadFile(replacement)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	upload := func(user *access.UserInfo, input []byte) (string, int) {
+		var outBuf, errBuf bytes.Buffer
+		ctx := &CommandContext{
+			User:      user,
+			DBManager: env.manager,
+			Args:      []string{"test"},
+			In:        bytes.NewReader(input),
+			Out:       &outBuf,
+			Err:       &errBuf,
+			exitCode:  ExitOK,
+		}
+		env.handler.routeCommand("upload", ctx)
+		return errBuf.String(), ctx.exitCode
+	}
+
+	if _, code := upload(env.readOnlyUser, data); code != ExitAccessDenied {
+		t.Errorf("expected read-only user to be denied, got code=%d", code)
+	}
+
+	stderr, code := upload(env.adminUser, []byte("not a database"))
+	if code != ExitUsage || !strings.Contains(stderr, "not a valid SQLite database") {
+		t.Errorf("expected invalid file to be rejected, got code=%d stderr=%q", code, stderr)
+	}
+
+	if stderr, code := upload(env.adminUser, data); code != ExitOK {
+		t.Fatalf("upload failed: code=%d stderr=%q", code, stderr)
+	}
+	stdout, _, _ := env.run(env.adminUser, "tables", "test")
+	if strings.Contains(stdout, "users") {
+		t.Errorf("expected database to be replaced, tables:\n%s", stdout)
+	}
+}
+
+func TestCLI_CommandAllowlist(t *testing.T) {
+	env := newTestEnv(t, "users.db")
+	defer env.Close()
+
+	resolver := access.NewResolver()
+	resolver.AddUserRule("analyst", "*", access.ReadOnly)
+	resolver.SetUserCommands("analyst", []string{"query", "select"})
+	env.manager.UpdateResolver(resolver)
+	analyst := &access.UserInfo{Name: "analyst"}
+
+	stdout, stderr, code := env.run(analyst, "select", "test", "users")
+	if code != ExitOK || !strings.Contains(stdout, "Alice") {
+		t.Errorf("expected select to be allowed, got code=%d stderr=%q", code, stderr)
+	}
+
+	dir := t.TempDir()
+	out := filepath.Join(dir, "dump.db")
+	_, stderr, code = env.run(analyst, "download", "test", "--output="+out)
+	if code != ExitAccessDenied || !strings.Contains(stderr, "may not run download") {
+		t.Errorf("expected download to be denied, got code=%d stderr=%q", code, stderr)
+	}
+	if _, err := os.Stat(out); !os.IsNotExist(err) {
+		t.Errorf("expected no output file for a denied command")
+	}
+}
+
+func TestCLI_RowFilters(t *testing.T) {
+	env := newTestEnv(t, "users.db")
+	defer env.Close()
+
+	resolver := access.NewResolver()
+	resolver.AddUserRule("tenant", "*", access.ReadWrite)
+	resolver.AddRowFilter("tenant", access.RowFilter{Pattern: "test", Table: "users", Where: "id <> 2"})
+	env.manager.UpdateResolver(resolver)
+	tenant := &access.UserInfo{Name: "tenant"}
+
+	stdout, stderr, code := env.run(tenant, "select", "test", "users")
+	if code != ExitOK || !strings.Contains(stdout, "Alice") || strings.Contains(stdout, "Bob") {
+		t.Errorf("expected filtered select, got code=%d stdout=%q stderr=%q", code, stdout, stderr)
+	}
+
+	stdout, _, code = env.run(tenant, "query", "test", "SELECT name FROM users WHERE id = 2")
+	if code != ExitOK || strings.Contains(stdout, "Bob") {
+		t.Errorf("expected query to see filtered rows only, got code=%d stdout=%q", code, stdout)
+	}
+
+	for _, sql := range []string{
+		`SELECT name FROM main.users`,
+		`SELECT name FROM "main"."users"`,
+		`DROP VIEW users`,
+		`VACUUM INTO '/tmp/copy.db'`,
+	} {
+		if _, stderr, code := env.run(tenant, "query", "test", sql); code != ExitAccessDenied {
+			t.Errorf("expected %q to be denied, got code=%d stderr=%q", sql, code, stderr)
+		}
+	}
+
+	if _, stderr, code := env.run(tenant, "query", "test", "DELETE FROM users"); code == ExitOK {
+		t.Errorf("expected writes to a filtered table to fail, stderr=%q", stderr)
+	}
+
+	out := filepath.Join(t.TempDir(), "dump.db")
+	if _, stderr, code := env.run(tenant, "download", "test", "--output="+out); code != ExitAccessDenied {
+		t.Errorf("expected download to be denied, got code=%d stderr=%q", code, stderr)
+	}
+
+	// Other users are unaffected
+	stdout, _, _ = env.run(env.adminUser, "select", "test", "users")
+	if !strings.Contains(stdout, "Bob") {
+		t.Errorf("expected admin to see all rows, got %q", stdout)
+	}
+}
+
+func TestCLI_DownloadNotAllowed(t *testing.T) {
+	env := newTestEnv(t, "users.db")
+	defer env.Close()
+
+	resolver := access.NewResolver()
+	resolver.AddUserRules("analyst", access.Rule{Pattern: "*", Level: access.ReadOnly, NoDownload: true})
+	env.manager.UpdateResolver(resolver)
+	analyst := &access.UserInfo{Name: "analyst"}
+
+	if _, stderr, code := env.run(analyst, "select", "test", "users"); code != ExitOK {
+		t.Errorf("expected select to be allowed, got code=%d stderr=%q", code, stderr)
+	}
+	stdout, stderr, code := env.run(analyst, "download", "test")
+	if code != ExitAccessDenied || stdout != "" {
+		t.Errorf("expected download to be denied, got code=%d stderr=%q", code, stderr)
+	}
+}
+
+func TestCLI_QueryLimits(t *testing.T) {
+	env := newTestEnv(t, "users.db")
+	defer env.Close()
+
+	cfg := &config.Config{
+		Databases: []config.DatabaseSource{{Path: env.dbPath, Alias: "test"}},
+		Users: []config.User{
+			{Name: "reader", Access: []config.AccessRule{{Pattern: "*", Level: "read-only"}}},
+		},
+		QueryLimits: config.QueryLimitsConfig{
+			ReadOnly: config.QueryLimit{QueriesPerMinute: 2, MaxRows: 2},
+		},
+	}
+	manager, err := database.NewManager(cfg)
+	if err != nil {
+		t.Fatalf("failed to create manager: %v", err)
+	}
+	if err := manager.Start(); err != nil {
+		t.Fatalf("failed to start manager: %v", err)
+	}
+	env.manager.Stop()
+	env.manager = manager
+	env.handler = NewHandler(manager, nil, "test")
+
+	stdout, stderr, code := env.run(env.readOnlyUser, "query", "test", "SELECT name FROM users ORDER BY id")
+	if code != ExitOK || !strings.Contains(stdout, "Bob") || strings.Contains(stdout, "Charlie") {
+		t.Errorf("expected two rows, got code=%d stdout=%q", code, stdout)
+	}
+	if !strings.Contains(stderr, "limited to 2 rows") {
+		t.Errorf("expected truncation note, got stderr=%q", stderr)
+	}
+
+	env.run(env.readOnlyUser, "query", "test", "SELECT 1")
+	_, stderr, code = env.run(env.readOnlyUser, "query", "test", "SELECT 1")
+	if code != ExitRateLimited {
+		t.Errorf("expected third query to be rate limited, got code=%d stderr=%q", code, stderr)
+	}
+
+	// Admins are not limited
+	stdout, _, code = env.run(env.adminUser, "query", "test", "SELECT name FROM users")
+	if code != ExitOK || !strings.Contains(stdout, "Charlie") {
+		t.Errorf("expected admin to be unlimited, got code=%d stdout=%q", code, stdout)
+	}
+}
+
+func TestCLI_QueryResultBytes(t *testing.T) {
+	env := newTestEnv(t, "users.db")
+	defer env.Close()
+
+	cfg := &config.Config{
+		Databases: []config.DatabaseSource{{Path: env.dbPath, Alias: "test"}},
+		Users: []config.User{
+			{Name: "reader", Access: []config.AccessRule{{Pattern: "*", Level: "read-only"}}},
+		},
+		QueryLimits: config.QueryLimitsConfig{
+			ReadOnly: config.QueryLimit{MaxResultBytes: 100},
+		},
+	}
+	manager, err := database.NewManager(cfg)
+	if err != nil {
+		t.Fatalf("failed to create manager: %v", err)
+	}
+	if err := manager.Start(); err != nil {
+		t.Fatalf("failed to start manager: %v", err)
+	}
+	env.manager.Stop()
+	env.manager = manager
+	env.handler = NewHandler(manager, nil, "test")
+
+	stdout, stderr, code := env.run(env.readOnlyUser, "query", "test", "SELECT * FROM users ORDER BY id")
+	if code != ExitOK || !strings.Contains(stdout, "Alice") || strings.Contains(stdout, "Charlie") {
+		t.Errorf("expected the result cut short, got code=%d stdout=%q", code, stdout)
+	}
+	if !strings.Contains(stderr, "by the query size limit") {
+		t.Errorf("expected size limit note, got stderr=%q", stderr)
+	}
+
+	// Admins get the default cap, which this result is well under
+	stdout, stderr, code = env.run(env.adminUser, "query", "test", "SELECT * FROM users")
+	if code != ExitOK || !strings.Contains(stdout, "Charlie") || stderr != "" {
+		t.Errorf("expected the full result for admin, got code=%d stdout=%q stderr=%q", code, stdout, stderr)
+	}
+}
+
+func TestCLI_Audit_Denied(t *testing.T) {
+	env := newTestEnv(t, "users.db")
+	defer env.Close()
+
+	store, err := history.NewStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create history store: %v", err)
+	}
+	defer store.Close()
+	env.handler = NewHandler(env.manager, store, "test")
+
+	env.run(env.adminUser, "insert", "test", "users", `--json={"name":"Dora","email":"dora@example.com"}`)
+	if _, _, code := env.run(env.readOnlyUser, "delete", "test", "users", "--where=id=1", "--confirm"); code != ExitAccessDenied {
+		t.Fatalf("expected delete to be denied, got code=%d", code)
+	}
+
+	stdout, stderr, code := env.run(env.adminUser, "audit", "--denied", "--format=jsonl")
+	if code != ExitOK {
+		t.Fatalf("audit failed: code=%d stderr=%q", code, stderr)
+	}
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("expected only the denial, got %q", stdout)
+	}
+	var event map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &event); err != nil {
+		t.Fatalf("invalid JSON line: %v", err)
+	}
+	details, _ := event["details"].(map[string]any)
+	if event["action"] != "ACCESS_DENIED" || event["database"] != env.dbPath || details["command"] != "delete" {
+		t.Errorf("unexpected event: %v", event)
+	}
+}
+
+func TestCLI_TOTP(t *testing.T) {
+	env := newTestEnv(t, "users.db")
+	defer env.Close()
+
+	const secret = "JBSWY3DPEHPK3PXP"
+	resolver := access.NewResolver()
+	resolver.AddUserRule("operator", "*", access.ReadWrite)
+	resolver.SetUserTOTP("operator", secret)
+	env.manager.UpdateResolver(resolver)
+	operator := &access.UserInfo{Name: "operator"}
+
+	if _, stderr, code := env.run(operator, "delete", "test", "users", "--where=id=1", "--confirm"); code != ExitAccessDenied || !strings.Contains(stderr, "--totp") {
+		t.Errorf("expected delete without a code to be denied, got code=%d stderr=%q", code, stderr)
+	}
+	if _, _, code := env.run(operator, "query", "test", "DELETE FROM users WHERE id = 1", "--totp=000000"); code != ExitAccessDenied {
+		t.Errorf("expected a wrong code to be denied, got code=%d", code)
+	}
+
+	code, err := totp.Code(secret, time.Now())
+	if err != nil {
+		t.Fatalf("failed to generate code: %v", err)
+	}
+	if _, stderr, exit := env.run(operator, "delete", "test", "users", "--where=id=1", "--confirm", "--totp="+code); exit != ExitOK {
+		t.Errorf("expected delete with a code to succeed, got code=%d stderr=%q", exit, stderr)
+	}
+	if _, _, exit := env.run(operator, "delete", "test", "users", "--where=id=2", "--confirm", "--totp="+code); exit != ExitAccessDenied {
+		t.Errorf("expected a reused code to be denied, got code=%d", exit)
+	}
+
+	if _, stderr, exit := env.run(operator, "query", "test", "SELECT COUNT(*) FROM users"); exit != ExitOK {
+		t.Errorf("expected select without a code to succeed, got code=%d stderr=%q", exit, stderr)
+	}
+	if _, stderr, exit := env.run(operator, "query", "test", "SELECT 'drop' AS word"); exit != ExitOK {
+		t.Errorf("expected a select mentioning drop to need no code, got code=%d stderr=%q", exit, stderr)
+	}
+	if _, stderr, exit := env.run(env.adminUser, "delete", "test", "users", "--where=id=2", "--confirm"); exit != ExitOK {
+		t.Errorf("expected users without TOTP to need no code, got code=%d stderr=%q", exit, stderr)
+	}
+}
+
+func TestCLI_Approvals(t *testing.T) {
+	env := newTestEnv(t, "users.db")
+	defer env.Close()
+
+	cfg := &config.Config{
+		Databases: []config.DatabaseSource{{Path: env.dbPath, Alias: "test"}},
+		Users: []config.User{
+			{Name: "reader", Access: []config.AccessRule{{Pattern: "*", Level: "read-only"}}},
+			{Name: "writer", Access: []config.AccessRule{{Pattern: "*", Level: "read-write"}}},
+			{Name: "oncall", CanSudo: true, Access: []config.AccessRule{{Pattern: "*", Level: "read-write"}}},
+		},
+		Approvals: config.ApprovalsConfig{Commands: []string{"drop-table", "truncate"}},
+	}
+	manager, err := database.NewManager(cfg)
+	if err != nil {
+		t.Fatalf("failed to create manager: %v", err)
+	}
+	if err := manager.Start(); err != nil {
+		t.Fatalf("failed to start manager: %v", err)
+	}
+	env.manager.Stop()
+	env.manager = manager
+
+	store, err := history.NewStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create history store: %v", err)
+	}
+	defer store.Close()
+	env.handler = NewHandler(manager, store, "test")
+	writer := &access.UserInfo{Name: "writer"}
+
+	if _, _, code := env.run(env.readOnlyUser, "truncate", "test", "users", "--confirm"); code != ExitAccessDenied {
+		t.Errorf("expected read-only user to be denied, got code=%d", code)
+	}
+
+	stdout, stderr, code := env.run(writer, "truncate", "test", "users", "--confirm")
+	if code != ExitOK || !strings.Contains(stdout, "Approval #1 requested") {
+		t.Fatalf("expected a pending request, got code=%d stdout=%q stderr=%q", code, stdout, stderr)
+	}
+	stdout, _, _ = env.run(env.adminUser, "count", "test", "users")
+	if strings.TrimSpace(stdout) == "0" {
+		t.Fatal("expected truncate to wait for approval")
+	}
+
+	stdout, _, _ = env.run(writer, "approvals", "--format=json")
+	var pending []map[string]any
+	if err := json.Unmarshal([]byte(stdout), &pending); err != nil || len(pending) != 1 || pending[0]["command"] != "truncate" {
+		t.Fatalf("expected the writer's request, got %q (%v)", stdout, err)
+	}
+
+	if _, _, code := env.run(writer, "approvals", "approve", "1"); code != ExitAccessDenied {
+		t.Errorf("expected non-admin approval to be denied, got code=%d", code)
+	}
+	if _, stderr, code := env.run(env.adminUser, "approvals", "approve", "1"); code != ExitOK {
+		t.Fatalf("approve failed: code=%d stderr=%q", code, stderr)
+	}
+	stdout, _, _ = env.run(env.adminUser, "count", "test", "users")
+	if strings.TrimSpace(stdout) != "0" {
+		t.Errorf("expected approved truncate to run, got count %q", stdout)
+	}
+	if _, _, code := env.run(env.adminUser, "approvals", "approve", "1"); code != ExitUsage {
+		t.Errorf("expected a request to run only once, got code=%d", code)
+	}
+
+	env.run(writer, "drop-table", "test", "users", "--confirm")
+	if _, _, code := env.run(env.adminUser, "approvals", "deny", "2"); code != ExitOK {
+		t.Errorf("deny failed: code=%d", code)
+	}
+	stdout, _, _ = env.run(env.adminUser, "tables", "test")
+	if !strings.Contains(stdout, "users") {
+		t.Errorf("expected users table to survive, got %q", stdout)
+	}
+
+	stdout, _, _ = env.run(env.adminUser, "audit", "--action=APPROVAL_DENIED", "--format=jsonl")
+	if !strings.Contains(stdout, `"requested_by":"writer"`) {
+		t.Errorf("expected denial in audit log, got %q", stdout)
+	}
+
+	// Raw SQL doing the same needs the same approval
+	for i, sql := range []string{"DROP TABLE users", "DELETE FROM users", "WITH x AS (SELECT 1) DELETE FROM users"} {
+		stdout, stderr, code := env.run(writer, "query", "test", sql)
+		if want := fmt.Sprintf("Approval #%d requested", i+3); code != ExitOK || !strings.Contains(stdout, want) {
+			t.Errorf("query %q: expected %q, got code=%d stdout=%q stderr=%q", sql, want, code, stdout, stderr)
+		}
+	}
+	if _, stderr, code := env.run(writer, "query", "test", "DELETE FROM users WHERE id = 1"); code != ExitOK {
+		t.Errorf("expected a bounded DELETE to run, got code=%d stderr=%q", code, stderr)
+	}
+	if _, err := manager.ExecuteQuery(context.Background(), "test", writer, "", "DROP TABLE users"); !errors.Is(err, database.ErrApprovalRequired) {
+		t.Errorf("ExecuteQuery(DROP TABLE) = %v, want ErrApprovalRequired", err)
+	}
+	stdout, _, _ = env.run(env.adminUser, "tables", "test")
+	if !strings.Contains(stdout, "users") {
+		t.Fatalf("expected users table to survive the requests, got %q", stdout)
+	}
+	if _, stderr, code := env.run(env.adminUser, "approvals", "approve", "3"); code != ExitOK {
+		t.Fatalf("approve failed: code=%d stderr=%q", code, stderr)
+	}
+	stdout, _, _ = env.run(env.adminUser, "tables", "test")
+	if strings.Contains(stdout, "users") {
+		t.Errorf("expected the approved DROP to run, got %q", stdout)
+	}
+
+	// sudo doesn't get around approval
+	stdout, stderr, code = env.run(&access.UserInfo{Name: "oncall"}, "sudo", "--reason=INC-7", "truncate", "test", "posts", "--confirm")
+	if code != ExitOK || !strings.Contains(stdout, "Approval #6 requested") {
+		t.Errorf("expected sudo truncate to need approval, got code=%d stdout=%q stderr=%q", code, stdout, stderr)
+	}
+}
+
+func TestCLI_AnonymousQuota(t *testing.T) {
+	env := newTestEnv(t, "users.db")
+	defer env.Close()
+
+	resolver := access.NewResolver()
+	resolver.SetAnonymousAccess(access.ReadOnly)
+	env.manager.UpdateResolver(resolver)
+
+	sessions := server.NewSessionManager(nil)
+	sessions.SetAnonymousQuota(server.Quota{MaxQueries: 5, MaxRows: 2})
+	session, err := sessions.CreateSession(env.anonUser, "192.0.2.1:5000")
+	if err != nil {
+		t.Fatalf("failed to create session: %v", err)
+	}
+
+	run := func(args ...string) (string, string, int) {
+		var outBuf, errBuf bytes.Buffer
+		ctx := &CommandContext{
+			User:        env.anonUser,
+			SessionInfo: session,
+			DBManager:   env.manager,
+			Args:        args[1:],
+			Out:         &outBuf,
+			Err:         &errBuf,
+			exitCode:    ExitOK,
+		}
+		env.handler.routeCommand(args[0], ctx)
+		return outBuf.String(), errBuf.String(), ctx.exitCode
+	}
+
+	stdout, stderr, code := run("export", "test", "users", "--format=csv")
+	if code != ExitOK || !strings.Contains(stdout, "Bob") || strings.Contains(stdout, "Charlie") {
+		t.Errorf("expected two exported rows, got code=%d stdout=%q", code, stdout)
+	}
+	if !strings.Contains(stderr, "anonymous session quota") {
+		t.Errorf("expected quota note, got stderr=%q", stderr)
+	}
+
+	err = session.ChargeQuery()
+	if !errors.Is(err, server.ErrQuotaExceeded) {
+		t.Errorf("expected the spent row quota to stop queries, got %v", err)
+	}
+	if code := errorExitCode(err); code != ExitRateLimited {
+		t.Errorf("expected exit code %d, got %d", ExitRateLimited, code)
+	}
+}
+
+func TestCLI_Sudo(t *testing.T) {
+	env := newTestEnv(t, "users.db")
+	defer env.Close()
+
+	store, err := history.NewStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create history store: %v", err)
+	}
+	defer store.Close()
+	env.handler = NewHandler(env.manager, store, "test")
+
+	resolver := access.NewResolver()
+	resolver.AddUserRule("oncall", "*", access.ReadOnly)
+	resolver.AddUserRule("reader", "*", access.ReadOnly)
+	resolver.AddSudoer("oncall")
+	env.manager.UpdateResolver(resolver)
+	oncall := &access.UserInfo{Name: "oncall"}
+
+	if _, _, code := env.run(oncall, "audit"); code != ExitAccessDenied {
+		t.Errorf("expected audit to need admin, got code=%d", code)
+	}
+	if _, stderr, code := env.run(oncall, "sudo", "audit"); code != ExitUsage || !strings.Contains(stderr, "reason") {
+		t.Errorf("expected sudo without a reason to fail, got code=%d stderr=%q", code, stderr)
+	}
+	if _, _, code := env.run(env.readOnlyUser, "sudo", "--reason=curious", "audit"); code != ExitAccessDenied {
+		t.Errorf("expected sudo to be denied without can_sudo, got code=%d", code)
+	}
+
+	stdout, stderr, code := env.run(oncall, "sudo", "--reason=INC-42", "audit", "--action=SUDO", "--format=jsonl")
+	if code != ExitOK {
+		t.Fatalf("sudo audit failed: code=%d stderr=%q", code, stderr)
+	}
+	var event map[string]any
+	if err := json.Unmarshal([]byte(strings.TrimSpace(stdout)), &event); err != nil {
+		t.Fatalf("expected one audit event, got %q: %v", stdout, err)
+	}
+	details, _ := event["details"].(map[string]any)
+	if details["command"] != "audit" || details["reason"] != "INC-42" {
+		t.Errorf("unexpected sudo event: %v", event)
+	}
+
+	if _, _, code := env.run(oncall, "audit"); code != ExitAccessDenied {
+		t.Errorf("expected sudo not to last beyond one command, got code=%d", code)
+	}
+
+	// The command goes through the usual gates, including --output
+	out := filepath.Join(t.TempDir(), "audit.jsonl")
+	if _, stderr, code := env.run(oncall, "sudo", "--reason=INC-43", "audit", "--format=jsonl", "--output="+out); code != ExitOK {
+		t.Fatalf("sudo audit --output failed: code=%d stderr=%q", code, stderr)
+	}
+	if data, err := os.ReadFile(out); err != nil || !strings.Contains(string(data), "INC-43") {
+		t.Errorf("expected the audit log in %s, got %q (%v)", out, data, err)
+	}
+	resolver.SetUserCommands("oncall", []string{"sudo", "ls"})
+	env.manager.UpdateResolver(resolver)
+	if _, stderr, code := env.run(oncall, "sudo", "--reason=INC-44", "audit"); code != ExitAccessDenied || !strings.Contains(stderr, "may not run audit") {
+		t.Errorf("expected the command list to apply under sudo, got code=%d stderr=%q", code, stderr)
+	}
+	stdout, _, _ = env.run(env.adminUser, "audit", "--action=COMMAND_DENIED", "--format=jsonl")
+	if !strings.Contains(stdout, `"command":"audit"`) {
+		t.Errorf("expected the denied command in the audit log, got %q", stdout)
+	}
+}
+
+func TestCLI_TablePatterns(t *testing.T) {
+	env := newTestEnv(t, "users.db")
+	defer env.Close()
+
+	resolver := access.NewResolver()
+	resolver.AddUserRules("writer",
+		access.Rule{Pattern: "t*/sensitive_*", Level: access.None},
+		access.Rule{Pattern: "test/posts", Level: access.ReadOnly},
+		access.Rule{Pattern: "test", Level: access.ReadWrite},
+	)
+	env.manager.UpdateResolver(resolver)
+	writer := &access.UserInfo{Name: "writer"}
+
+	stdout, stderr, code := env.run(writer, "tables", "test")
+	if code != ExitOK {
+		t.Fatalf("tables failed: code=%d stderr=%q", code, stderr)
+	}
+	if strings.Contains(stdout, "sensitive_data") || !strings.Contains(stdout, "users") {
+		t.Errorf("expected sensitive_data to be hidden, got %q", stdout)
+	}
+
+	if _, _, code := env.run(writer, "select", "test", "sensitive_data"); code != ExitAccessDenied {
+		t.Errorf("expected select on a closed table to be denied, got code=%d", code)
+	}
+	if _, _, code := env.run(writer, "insert", "test", "posts", `--json={"title":"x"}`); code != ExitAccessDenied {
+		t.Errorf("expected insert into a read-only table to be denied, got code=%d", code)
+	}
+	if _, stderr, code := env.run(writer, "count", "test", "posts"); code != ExitOK {
+		t.Errorf("expected count on a read-only table to work, got code=%d stderr=%q", code, stderr)
+	}
+
+	// Raw SQL sees the closed table as empty and can't write the read-only one
+	stdout, stderr, code = env.run(writer, "query", "test", "SELECT COUNT(*) AS n FROM sensitive_data", "--format=csv")
+	if code != ExitOK || strings.TrimSpace(stdout) != "n\n0" {
+		t.Errorf("expected no rows from sensitive_data, got code=%d stdout=%q stderr=%q", code, stdout, stderr)
+	}
+	if _, _, code := env.run(writer, "query", "test", "DELETE FROM posts"); code == ExitOK {
+		t.Error("expected raw DELETE on a read-only table to fail")
+	}
+
+	if stdout, _, code := env.run(env.adminUser, "select", "test", "sensitive_data"); code != ExitOK || stdout == "" {
+		t.Errorf("expected admin to read every table, got code=%d", code)
+	}
+}
+
+func TestCLI_ExportRowCap(t *testing.T) {
+	env := newTestEnv(t, "users.db")
+	defer env.Close()
+
+	cfg := &config.Config{
+		Databases: []config.DatabaseSource{{Path: env.dbPath, Alias: "test"}},
+		Users: []config.User{
+			{Name: "reader", Access: []config.AccessRule{{Pattern: "*", Level: "read-only"}}},
+		},
+		QueryLimits: config.QueryLimitsConfig{ReadOnly: config.QueryLimit{MaxExportRows: 2}},
+	}
+	manager, err := database.NewManager(cfg)
+	if err != nil {
+		t.Fatalf("failed to create manager: %v", err)
+	}
+	if err := manager.Start(); err != nil {
+		t.Fatalf("failed to start manager: %v", err)
+	}
+	env.manager.Stop()
+	env.manager = manager
+	env.handler = NewHandler(manager, nil, "test")
+
+	for _, cmd := range []string{"select", "export"} {
+		stdout, stderr, code := env.run(env.readOnlyUser, cmd, "test", "users", "--format=csv", "--no-header")
+		if code != ExitOK {
+			t.Fatalf("%s failed: code=%d stderr=%q", cmd, code, stderr)
+		}
+		if lines := strings.Count(stdout, "\n"); lines != 2 || !strings.Contains(stderr, "capped at 2 rows") {
+			t.Errorf("expected %s to be capped at 2 rows with a note, got %d rows, stderr=%q", cmd, lines, stderr)
+		}
+
+		if _, _, code := env.run(env.readOnlyUser, cmd, "test", "users", "--no-cap"); code != ExitAccessDenied {
+			t.Errorf("expected --no-cap to need admin for %s, got code=%d", cmd, code)
+		}
+		stdout, stderr, code = env.run(env.adminUser, cmd, "test", "users", "--format=csv", "--no-header", "--no-cap")
+		if code != ExitOK || strings.Count(stdout, "\n") != 3 || stderr != "" {
+			t.Errorf("expected admin %s to return every row, got code=%d stdout=%q stderr=%q", cmd, code, stdout, stderr)
+		}
+	}
+
+	// A --limit under the cap is not reported as truncated
+	if _, stderr, _ := env.run(env.readOnlyUser, "select", "test", "users", "--limit=1"); stderr != "" {
+		t.Errorf("expected no note under the cap, got %q", stderr)
+	}
+}
+
+func TestCLI_QueryTimeout(t *testing.T) {
+	env := newTestEnv(t, "users.db")
+	defer env.Close()
+
+	cfg := &config.Config{
+		Databases: []config.DatabaseSource{{Path: env.dbPath, Alias: "test"}},
+		Users: []config.User{
+			{Name: "reader", Access: []config.AccessRule{{Pattern: "*", Level: "read-only"}}},
+		},
+		QueryLimits: config.QueryLimitsConfig{ReadOnly: config.QueryLimit{Timeout: "50ms"}},
+	}
+	manager, err := database.NewManager(cfg)
+	if err != nil {
+		t.Fatalf("failed to create manager: %v", err)
+	}
+	if err := manager.Start(); err != nil {
+		t.Fatalf("failed to start manager: %v", err)
+	}
+	env.manager.Stop()
+	env.manager = manager
+
+	store, err := history.NewStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create history store: %v", err)
+	}
+	defer store.Close()
+	env.handler = NewHandler(manager, store, "test")
+
+	slow := "WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM n) SELECT COUNT(*) FROM n"
+	_, stderr, code := env.run(env.readOnlyUser, "query", "test", slow)
+	if code == ExitOK || !strings.Contains(stderr, "query timed out after 50ms") {
+		t.Fatalf("expected the query to time out, got code=%d stderr=%q", code, stderr)
+	}
+
+	records, err := store.FindQueryHistory(history.QueryFilter{})
+	if err != nil {
+		t.Fatalf("failed to read history: %v", err)
+	}
+	if len(records) != 1 || !strings.Contains(records[0].Error, "query timed out") {
+		t.Errorf("expected the timeout in the history, got %+v", records)
+	}
+
+	// Admins have no level timeout
+	if _, stderr, code := env.run(env.adminUser, "query", "test", "SELECT COUNT(*) FROM users"); code != ExitOK {
+		t.Errorf("expected admin query to run, got code=%d stderr=%q", code, stderr)
+	}
+}
@@ -12,7 +12,7 @@ func (h *Handler) cmdInsert(ctx *CommandContext) {
 	args := ctx.GetPositionalArgs()
 	if len(args) < 2 {
 		fmt.Fprintln(ctx.Err, "Usage: insert <database> <table> --json='{\"col\":\"val\"}'")
-		ctx.Exit(1)
+		ctx.Exit(ExitUsage)
 		return
 	}
 
@@ -26,28 +26,28 @@ func (h *Handler) cmdInsert(ctx *CommandContext) {
 	jsonData := ctx.GetFlag("json")
 	if jsonData == "" {
 		fmt.Fprintln(ctx.Err, "Error: --json flag is required")
-		ctx.Exit(1)
+		ctx.Exit(ExitUsage)
 		return
 	}
 
 	var data map[string]any
 	if err := json.Unmarshal([]byte(jsonData), &data); err != nil {
 		fmt.Fprintf(ctx.Err, "Error parsing JSON: %v\n", err)
-		ctx.Exit(1)
+		ctx.Exit(ExitUsage)
 		return
 	}
 
 	conn, err := h.dbManager.OpenConnection(dbName, ctx.User)
 	if err != nil {
 		fmt.Fprintf(ctx.Err, "Failed to open database: %v\n", err)
-		ctx.Exit(1)
+		ctx.Exit(errorExitCode(err))
 		return
 	}
 
 	result, err := database.Insert(conn, tableName, data)
 	if err != nil {
 		fmt.Fprintf(ctx.Err, "Insert error: %v\n", err)
-		ctx.Exit(1)
+		ctx.Exit(errorExitCode(err))
 		return
 	}
 
@@ -58,7 +58,7 @@ func (h *Handler) cmdInsert(ctx *CommandContext) {
 			"rows_affected":  result.RowsAffected,
 		})
 	} else {
-		fmt.Fprintf(ctx.Out, "Inserted row with ID: %d\n", result.LastInsertID)
+		ctx.Infof("Inserted row with ID: %d\n", result.LastInsertID)
 	}
 
 	// Log to audit if history store is available
@@ -72,7 +72,7 @@ func (h *Handler) cmdUpdate(ctx *CommandContext) {
 	args := ctx.GetPositionalArgs()
 	if len(args) < 2 {
 		fmt.Fprintln(ctx.Err, "Usage: update <database> <table> --where=\"...\" --set='{\"col\":\"val\"}'")
-		ctx.Exit(1)
+		ctx.Exit(ExitUsage)
 		return
 	}
 
@@ -86,35 +86,35 @@ func (h *Handler) cmdUpdate(ctx *CommandContext) {
 	where := ctx.GetFlag("where")
 	if where == "" {
 		fmt.Fprintln(ctx.Err, "Error: --where is required to prevent accidental full-table updates")
-		ctx.Exit(1)
+		ctx.Exit(ExitUsage)
 		return
 	}
 
 	setData := ctx.GetFlag("set")
 	if setData == "" {
 		fmt.Fprintln(ctx.Err, "Error: --set flag is required")
-		ctx.Exit(1)
+		ctx.Exit(ExitUsage)
 		return
 	}
 
 	var data map[string]any
 	if err := json.Unmarshal([]byte(setData), &data); err != nil {
 		fmt.Fprintf(ctx.Err, "Error parsing JSON: %v\n", err)
-		ctx.Exit(1)
+		ctx.Exit(ExitUsage)
 		return
 	}
 
 	conn, err := h.dbManager.OpenConnection(dbName, ctx.User)
 	if err != nil {
 		fmt.Fprintf(ctx.Err, "Failed to open database: %v\n", err)
-		ctx.Exit(1)
+		ctx.Exit(errorExitCode(err))
 		return
 	}
 
 	result, err := database.Update(conn, tableName, data, where)
 	if err != nil {
 		fmt.Fprintf(ctx.Err, "Update error: %v\n", err)
-		ctx.Exit(1)
+		ctx.Exit(errorExitCode(err))
 		return
 	}
 
@@ -122,7 +122,7 @@ func (h *Handler) cmdUpdate(ctx *CommandContext) {
 	if format == "json" {
 		printJSON(ctx.Out, map[string]any{"rows_affected": result.RowsAffected})
 	} else {
-		fmt.Fprintf(ctx.Out, "Updated %d row(s)\n", result.RowsAffected)
+		ctx.Infof("Updated %d row(s)\n", result.RowsAffected)
 	}
 
 	// Log to audit
@@ -137,7 +137,7 @@ func (h *Handler) cmdDelete(ctx *CommandContext) {
 	args := ctx.GetPositionalArgs()
 	if len(args) < 2 {
 		fmt.Fprintln(ctx.Err, "Usage: delete <database> <table> --where=\"...\" --confirm")
-		ctx.Exit(1)
+		ctx.Exit(ExitUsage)
 		return
 	}
 
@@ -148,30 +148,37 @@ func (h *Handler) cmdDelete(ctx *CommandContext) {
 		return
 	}
 
+	where := ctx.GetFlag("where")
+
 	if !ctx.HasFlag("confirm") && !ctx.HasFlag("force") {
-		fmt.Fprintln(ctx.Err, "Error: --confirm is required to prevent accidental deletes")
-		ctx.Exit(1)
-		return
+		if !ctx.Interactive {
+			fmt.Fprintln(ctx.Err, "Error: --confirm is required to prevent accidental deletes")
+			ctx.Exit(ExitUsage)
+			return
+		}
+		if where != "" && !ctx.ConfirmByName(tableName,
+			fmt.Sprintf("This will delete rows from '%s' where %s.", tableName, where)) {
+			return
+		}
 	}
 
-	where := ctx.GetFlag("where")
 	if where == "" {
 		fmt.Fprintln(ctx.Err, "Error: --where is required to prevent accidental full-table deletes")
-		ctx.Exit(1)
+		ctx.Exit(ExitUsage)
 		return
 	}
 
 	conn, err := h.dbManager.OpenConnection(dbName, ctx.User)
 	if err != nil {
 		fmt.Fprintf(ctx.Err, "Failed to open database: %v\n", err)
-		ctx.Exit(1)
+		ctx.Exit(errorExitCode(err))
 		return
 	}
 
 	result, err := database.Delete(conn, tableName, where)
 	if err != nil {
 		fmt.Fprintf(ctx.Err, "Delete error: %v\n", err)
-		ctx.Exit(1)
+		ctx.Exit(errorExitCode(err))
 		return
 	}
 
@@ -179,7 +186,7 @@ func (h *Handler) cmdDelete(ctx *CommandContext) {
 	if format == "json" {
 		printJSON(ctx.Out, map[string]any{"rows_affected": result.RowsAffected})
 	} else {
-		fmt.Fprintf(ctx.Out, "Deleted %d row(s)\n", result.RowsAffected)
+		ctx.Infof("Deleted %d row(s)\n", result.RowsAffected)
 	}
 
 	// Log to audit
@@ -188,3 +195,54 @@ func (h *Handler) cmdDelete(ctx *CommandContext) {
 			map[string]any{"where": where})
 	}
 }
+
+// cmdTruncate deletes every row of a table.
+func (h *Handler) cmdTruncate(ctx *CommandContext) {
+	args := ctx.GetPositionalArgs()
+	if len(args) < 2 {
+		fmt.Fprintln(ctx.Err, "Usage: truncate <database> <table> --confirm")
+		ctx.Exit(ExitUsage)
+		return
+	}
+
+	dbName := args[0]
+	tableName := args[1]
+
+	if !ctx.RequireWrite(dbName) {
+		return
+	}
+
+	if !ctx.HasFlag("confirm") {
+		if !ctx.Interactive {
+			fmt.Fprintln(ctx.Err, "Error: --confirm is required to truncate a table")
+			fmt.Fprintln(ctx.Err, "This will permanently delete all rows in the table.")
+			ctx.Exit(ExitUsage)
+			return
+		}
+		if !ctx.ConfirmByName(tableName,
+			fmt.Sprintf("This will permanently delete all rows in '%s'.", tableName)) {
+			return
+		}
+	}
+
+	sql := fmt.Sprintf("DELETE FROM %s", quoteIdentifier(tableName))
+
+	result, err := h.dbManager.ExecuteQuery(ctx.Context(), dbName, ctx.User, ctx.GetSessionID(), sql)
+	if err != nil {
+		fmt.Fprintf(ctx.Err, "Error truncating table: %v\n", err)
+		ctx.Exit(errorExitCode(err))
+		return
+	}
+
+	format := ctx.GetFlag("format")
+	if format == "json" {
+		printJSON(ctx.Out, map[string]any{"rows_affected": result.RowsAffected})
+	} else {
+		ctx.Infof("Deleted %d row(s) from '%s'\n", result.RowsAffected, tableName)
+	}
+
+	// Log to audit
+	if h.historyStore != nil {
+		h.historyStore.RecordAuditSimple(ctx.GetSessionID(), "TRUNCATE", dbName, tableName, nil)
+	}
+}
@@ -3,6 +3,8 @@ package cli
 import (
 	"fmt"
 	"path/filepath"
+	"strconv"
+	"strings"
 
 	"github.com/dustin/go-humanize"
 	"github.com/johan-st/sqlite-tui/internal/database"
@@ -19,19 +21,20 @@ func (h *Handler) cmdList(ctx *CommandContext) {
 	}
 
 	if len(databases) == 0 {
-		fmt.Fprintln(ctx.Out, "No accessible databases found.")
+		ctx.Infof("No accessible databases found.\n")
 		return
 	}
 
-	// Simple tab-separated output
-	fmt.Fprintln(ctx.Out, "ALIAS\tPATH\tSIZE\tACCESS")
+	rows := make([][]string, 0, len(databases))
 	for _, db := range databases {
-		fmt.Fprintf(ctx.Out, "%s\t%s\t%s\t%s\n",
+		rows = append(rows, []string{
 			db.Alias,
 			db.Path,
 			humanize.Bytes(uint64(db.Size)),
-			db.AccessLevel.String())
+			db.AccessLevel.String(),
+		})
 	}
+	printTable(ctx.Out, []string{"ALIAS", "PATH", "SIZE", "ACCESS"}, rows, ctx.maxColWidth())
 }
 
 // cmdInfo shows information about a specific database.
@@ -48,10 +51,23 @@ func (h *Handler) cmdInfo(ctx *CommandContext) {
 	db := h.dbManager.GetDatabase(dbName)
 	if db == nil {
 		fmt.Fprintf(ctx.Err, "Database not found: %s\n", dbName)
-		ctx.Exit(1)
+		ctx.Exit(ExitNotFound)
 		return
 	}
 
+	// The file details above still print if the database can't be opened
+	var meta *database.DatabaseMetadata
+	tableCount := -1
+	conn, err := h.dbManager.OpenConnection(dbName, ctx.User)
+	if err == nil {
+		schema := database.NewSchema(conn)
+		meta, _ = schema.DatabaseInfo()
+		tables, err := schema.ListTables()
+		if err == nil {
+			tableCount = len(h.dbManager.FilterTables(ctx.User, dbName, tables))
+		}
+	}
+
 	format := ctx.GetFlag("format")
 	if format == "json" {
 		info := map[string]any{
@@ -62,26 +78,46 @@ func (h *Handler) cmdInfo(ctx *CommandContext) {
 			"mod_time":    db.ModTime,
 			"access":      h.dbManager.GetAccessLevel(ctx.User, dbName).String(),
 		}
+		if len(db.Aliases) > 0 {
+			info["aliases"] = db.Aliases
+		}
+		if tableCount >= 0 {
+			info["tables"] = tableCount
+		}
+		if meta != nil {
+			info["page_size"] = meta.PageSize
+			info["page_count"] = meta.PageCount
+			info["freelist_count"] = meta.FreelistCount
+			info["encoding"] = meta.Encoding
+			info["journal_mode"] = meta.JournalMode
+			info["user_version"] = meta.UserVersion
+			info["application_id"] = meta.ApplicationID
+			info["wal_size"] = meta.WALSize
+		}
 		printJSON(ctx.Out, info)
 		return
 	}
 
 	fmt.Fprintf(ctx.Out, "Alias:\t%s\n", db.Alias)
 	fmt.Fprintf(ctx.Out, "Path:\t%s\n", db.Path)
+	if len(db.Aliases) > 0 {
+		fmt.Fprintf(ctx.Out, "Also known as:\t%s\n", strings.Join(db.Aliases, ", "))
+	}
 	if db.Description != "" {
 		fmt.Fprintf(ctx.Out, "Description:\t%s\n", db.Description)
 	}
 	fmt.Fprintf(ctx.Out, "Size:\t%s\n", humanize.Bytes(uint64(db.Size)))
 	fmt.Fprintf(ctx.Out, "Access:\t%s\n", h.dbManager.GetAccessLevel(ctx.User, dbName).String())
-
-	// Get table count
-	conn, err := h.dbManager.OpenConnection(dbName, ctx.User)
-	if err == nil {
-		schema := database.NewSchema(conn)
-		tables, err := schema.ListTables()
-		if err == nil {
-			fmt.Fprintf(ctx.Out, "Tables:\t%d\n", len(tables))
-		}
+	if tableCount >= 0 {
+		fmt.Fprintf(ctx.Out, "Tables:\t%d\n", tableCount)
+	}
+	if meta != nil {
+		fmt.Fprintf(ctx.Out, "Pages:\t%d x %d bytes (%d free)\n", meta.PageCount, meta.PageSize, meta.FreelistCount)
+		fmt.Fprintf(ctx.Out, "Encoding:\t%s\n", meta.Encoding)
+		fmt.Fprintf(ctx.Out, "Journal mode:\t%s\n", meta.JournalMode)
+		fmt.Fprintf(ctx.Out, "WAL size:\t%s\n", humanize.Bytes(uint64(meta.WALSize)))
+		fmt.Fprintf(ctx.Out, "User version:\t%d\n", meta.UserVersion)
+		fmt.Fprintf(ctx.Out, "Application ID:\t%d\n", meta.ApplicationID)
 	}
 }
 
@@ -99,49 +135,88 @@ func (h *Handler) cmdTables(ctx *CommandContext) {
 	conn, err := h.dbManager.OpenConnection(dbName, ctx.User)
 	if err != nil {
 		fmt.Fprintf(ctx.Err, "Failed to open database: %v\n", err)
-		ctx.Exit(1)
+		ctx.Exit(errorExitCode(err))
 		return
 	}
 
+	// Shadow tables back virtual tables and are only listed on request
 	schema := database.NewSchema(conn)
-	tables, err := schema.ListTables()
+	entries, err := schema.ListTableEntries(ctx.HasFlag("all"))
 	if err != nil {
 		fmt.Fprintf(ctx.Err, "Failed to list tables: %v\n", err)
-		ctx.Exit(1)
+		ctx.Exit(errorExitCode(err))
 		return
 	}
+	kinds := make(map[string]database.TableEntry, len(entries))
+	tables := make([]string, 0, len(entries))
+	for _, e := range entries {
+		kinds[e.Name] = e
+		tables = append(tables, e.Name)
+	}
+	tables = h.dbManager.FilterTables(ctx.User, dbName, tables)
+
+	// Row counts of big tables are estimated unless --exact is given
+	exactOnly := ctx.HasFlag("exact")
+	countRows := func(table string) (int64, bool, error) {
+		if exactOnly {
+			count, err := schema.GetRowCount(table)
+			return count, true, err
+		}
+		return schema.EstimateRowCount(table)
+	}
 
 	format := ctx.GetFlag("format")
 	if format == "json" {
 		result := make([]map[string]any, 0, len(tables))
 		for _, table := range tables {
-			info, _ := schema.GetTableInfo(table)
-			if info != nil {
-				result = append(result, map[string]any{
-					"name":    info.Name,
-					"columns": len(info.Columns),
-					"rows":    info.RowCount,
-				})
+			columns, err := schema.GetColumns(table)
+			if err != nil {
+				continue
+			}
+			count, exact, err := countRows(table)
+			if err != nil {
+				continue
 			}
+			entry := map[string]any{
+				"name":        table,
+				"kind":        kinds[table].Kind,
+				"columns":     len(columns),
+				"rows":        count,
+				"rows_approx": !exact,
+			}
+			if kinds[table].Module != "" {
+				entry["module"] = kinds[table].Module
+			}
+			result = append(result, entry)
 		}
 		printJSON(ctx.Out, result)
 		return
 	}
 
 	if len(tables) == 0 {
-		fmt.Fprintln(ctx.Out, "No tables found.")
+		ctx.Infof("No tables found.\n")
 		return
 	}
 
-	fmt.Fprintln(ctx.Out, "TABLE\tCOLUMNS\tROWS")
+	rows := make([][]string, 0, len(tables))
 	for _, table := range tables {
-		info, err := schema.GetTableInfo(table)
+		kind := strings.TrimSpace(kinds[table].Kind + " " + kinds[table].Module)
+		columns, err := schema.GetColumns(table)
 		if err != nil {
-			fmt.Fprintf(ctx.Out, "%s\t?\t?\n", table)
+			rows = append(rows, []string{table, kind, "?", "?"})
 			continue
 		}
-		fmt.Fprintf(ctx.Out, "%s\t%d\t%d\n", info.Name, len(info.Columns), info.RowCount)
+		count, exact, err := countRows(table)
+		rowCount := "?"
+		if err == nil {
+			rowCount = strconv.FormatInt(count, 10)
+			if !exact {
+				rowCount = "~" + rowCount
+			}
+		}
+		rows = append(rows, []string{table, kind, strconv.Itoa(len(columns)), rowCount})
 	}
+	printTable(ctx.Out, []string{"TABLE", "KIND", "COLUMNS", "ROWS"}, rows, ctx.maxColWidth())
 }
 
 // cmdSchema shows the schema of a table.
@@ -149,7 +224,7 @@ func (h *Handler) cmdSchema(ctx *CommandContext) {
 	args := ctx.GetPositionalArgs()
 	if len(args) < 2 {
 		fmt.Fprintln(ctx.Err, "Usage: schema <database> <table>")
-		ctx.Exit(1)
+		ctx.Exit(ExitUsage)
 		return
 	}
 
@@ -163,7 +238,7 @@ func (h *Handler) cmdSchema(ctx *CommandContext) {
 	conn, err := h.dbManager.OpenConnection(dbName, ctx.User)
 	if err != nil {
 		fmt.Fprintf(ctx.Err, "Failed to open database: %v\n", err)
-		ctx.Exit(1)
+		ctx.Exit(errorExitCode(err))
 		return
 	}
 
@@ -171,7 +246,7 @@ func (h *Handler) cmdSchema(ctx *CommandContext) {
 	info, err := schema.GetTableInfo(tableName)
 	if err != nil {
 		fmt.Fprintf(ctx.Err, "Failed to get table info: %v\n", err)
-		ctx.Exit(1)
+		ctx.Exit(errorExitCode(err))
 		return
 	}
 
@@ -183,6 +258,13 @@ func (h *Handler) cmdSchema(ctx *CommandContext) {
 			"columns":     info.Columns,
 			"primary_key": info.PrimaryKey,
 			"row_count":   info.RowCount,
+			"kind":        info.Kind,
+			"triggers":    info.Triggers,
+			"checks":      info.Checks,
+		}
+		if info.Module != "" {
+			result["module"] = info.Module
+			result["module_args"] = info.ModuleArgs
 		}
 
 		// Get indexes
@@ -198,10 +280,16 @@ func (h *Handler) cmdSchema(ctx *CommandContext) {
 	}
 
 	fmt.Fprintf(ctx.Out, "Table: %s\n", info.Name)
+	switch info.Kind {
+	case database.TableKindVirtual:
+		fmt.Fprintf(ctx.Out, "Virtual: %s(%s)\n", info.Module, strings.Join(info.ModuleArgs, ", "))
+	case database.TableKindShadow:
+		fmt.Fprintln(ctx.Out, "Shadow: stores a virtual table's data; change it through the virtual table")
+	}
 	fmt.Fprintf(ctx.Out, "Rows: %d\n\n", info.RowCount)
 
 	fmt.Fprintln(ctx.Out, "Columns:")
-	fmt.Fprintln(ctx.Out, "NAME\tTYPE\tNULLABLE\tDEFAULT\tPK")
+	colRows := make([][]string, 0, len(info.Columns))
 	for _, col := range info.Columns {
 		nullable := "YES"
 		if col.NotNull {
@@ -211,38 +299,72 @@ func (h *Handler) cmdSchema(ctx *CommandContext) {
 		if col.DefaultValue.Valid {
 			defaultVal = col.DefaultValue.String
 		}
+		if col.Generated != "" {
+			defaultVal = fmt.Sprintf("AS (%s) %s", col.Expression, col.Generated)
+		}
+		typ := col.Type
+		if col.Collation != "" && col.Collation != "BINARY" {
+			typ = strings.TrimSpace(typ + " COLLATE " + col.Collation)
+		}
+		if col.Hidden {
+			typ = strings.TrimSpace(typ + " HIDDEN")
+		}
+		unique := ""
+		if col.Unique {
+			unique = "YES"
+		}
 		pk := ""
 		if col.PrimaryKey > 0 {
 			pk = fmt.Sprintf("%d", col.PrimaryKey)
 		}
-		fmt.Fprintf(ctx.Out, "%s\t%s\t%s\t%s\t%s\n",
-			col.Name, col.Type, nullable, defaultVal, pk)
+		colRows = append(colRows, []string{col.Name, typ, nullable, unique, defaultVal, pk})
+	}
+	printTable(ctx.Out, []string{"NAME", "TYPE", "NULLABLE", "UNIQUE", "DEFAULT", "PK"}, colRows, ctx.maxColWidth())
+
+	if len(info.Checks) > 0 {
+		fmt.Fprintln(ctx.Out, "\nChecks:")
+		for _, check := range info.Checks {
+			fmt.Fprintf(ctx.Out, "  CHECK (%s)\n", check)
+		}
 	}
 
 	// Get indexes
 	indexes, err := schema.GetIndexes(tableName)
 	if err == nil && len(indexes) > 0 {
 		fmt.Fprintln(ctx.Out, "\nIndexes:")
-		fmt.Fprintln(ctx.Out, "NAME\tUNIQUE\tCOLUMNS")
+		idxRows := make([][]string, 0, len(indexes))
 		for _, idx := range indexes {
 			unique := "NO"
 			if idx.Unique {
 				unique = "YES"
 			}
-			fmt.Fprintf(ctx.Out, "%s\t%s\t%s\n",
-				idx.Name, unique, joinStrings(idx.Columns, ", "))
+			idxRows = append(idxRows, []string{idx.Name, unique, joinStrings(idx.Columns, ", ")})
 		}
+		printTable(ctx.Out, []string{"NAME", "UNIQUE", "COLUMNS"}, idxRows, ctx.maxColWidth())
 	}
 
 	// Get foreign keys
 	fks, err := schema.GetForeignKeys(tableName)
 	if err == nil && len(fks) > 0 {
 		fmt.Fprintln(ctx.Out, "\nForeign Keys:")
-		fmt.Fprintln(ctx.Out, "FROM\tTO\tON_UPDATE\tON_DELETE")
+		fkRows := make([][]string, 0, len(fks))
 		for _, fk := range fks {
-			fmt.Fprintf(ctx.Out, "%s\t%s.%s\t%s\t%s\n",
-				fk.From, fk.Table, fk.To, fk.OnUpdate, fk.OnDelete)
+			fkRows = append(fkRows, []string{fk.From, fk.Table + "." + fk.To, fk.OnUpdate, fk.OnDelete})
+		}
+		printTable(ctx.Out, []string{"FROM", "TO", "ON_UPDATE", "ON_DELETE"}, fkRows, ctx.maxColWidth())
+	}
+
+	if len(info.Triggers) > 0 {
+		fmt.Fprintln(ctx.Out, "\nTriggers:")
+		trigRows := make([][]string, 0, len(info.Triggers))
+		for _, trig := range info.Triggers {
+			event := trig.Event
+			if len(trig.Columns) > 0 {
+				event += " OF " + joinStrings(trig.Columns, ", ")
+			}
+			trigRows = append(trigRows, []string{trig.Name, trig.Timing, event})
 		}
+		printTable(ctx.Out, []string{"NAME", "TIMING", "EVENT"}, trigRows, ctx.maxColWidth())
 	}
 
 	if info.SQL != "" {
@@ -0,0 +1,82 @@
+package cli
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/johan-st/sqlite-tui/internal/database"
+)
+
+// cmdDescribe prints a per-column data profile of a table.
+func (h *Handler) cmdDescribe(ctx *CommandContext) {
+	args := ctx.GetPositionalArgs()
+	if len(args) < 2 {
+		fmt.Fprintln(ctx.Err, "Usage: describe <database> <table>")
+		ctx.Exit(ExitUsage)
+		return
+	}
+
+	dbName := args[0]
+	tableName := args[1]
+
+	if !ctx.RequireRead(dbName) {
+		return
+	}
+
+	conn, err := h.dbManager.OpenConnection(dbName, ctx.User)
+	if err != nil {
+		fmt.Fprintf(ctx.Err, "Failed to open database: %v\n", err)
+		ctx.Exit(errorExitCode(err))
+		return
+	}
+
+	profile, err := database.ProfileTable(conn, tableName)
+	if err != nil {
+		fmt.Fprintf(ctx.Err, "Profile error: %v\n", err)
+		ctx.Exit(errorExitCode(err))
+		return
+	}
+
+	format := ctx.GetFlag("format")
+	if format == "json" {
+		cols := make([]map[string]any, 0, len(profile.Columns))
+		for _, c := range profile.Columns {
+			cols = append(cols, map[string]any{
+				"name":       c.Name,
+				"type":       c.Type,
+				"nulls":      c.Nulls,
+				"distinct":   c.Distinct,
+				"min":        c.Min,
+				"max":        c.Max,
+				"avg_length": c.AvgLength,
+			})
+		}
+		printJSON(ctx.Out, map[string]any{
+			"table":   profile.Table,
+			"rows":    profile.Rows,
+			"columns": cols,
+		})
+		return
+	}
+
+	fmt.Fprintf(ctx.Out, "Table:\t%s\n", profile.Table)
+	fmt.Fprintf(ctx.Out, "Rows:\t%d\n\n", profile.Rows)
+
+	rows := make([][]string, 0, len(profile.Columns))
+	for _, c := range profile.Columns {
+		avg := "NULL"
+		if c.AvgLength != nil {
+			avg = strconv.FormatFloat(*c.AvgLength, 'f', 1, 64)
+		}
+		rows = append(rows, []string{
+			c.Name, c.Type,
+			strconv.FormatInt(c.Nulls, 10),
+			strconv.FormatInt(c.Distinct, 10),
+			database.FormatValue(c.Min),
+			database.FormatValue(c.Max),
+			avg,
+		})
+	}
+	printTable(ctx.Out, ctx.headers([]string{"COLUMN", "TYPE", "NULLS", "DISTINCT", "MIN", "MAX", "AVG_LEN"}),
+		rows, ctx.maxColWidth())
+}
@@ -0,0 +1,127 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/johan-st/sqlite-tui/internal/database"
+)
+
+// maxDupeSamples is the number of sample rowids shown per duplicate key.
+const maxDupeSamples = 5
+
+// cmdDupes reports rows that share the same values in the given columns.
+func (h *Handler) cmdDupes(ctx *CommandContext) {
+	args := ctx.GetPositionalArgs()
+	if len(args) < 2 {
+		fmt.Fprintln(ctx.Err, "Usage: dupes <database> <table> --columns=a,b [--limit=N] [--delete-sql]")
+		ctx.Exit(ExitUsage)
+		return
+	}
+
+	dbName := args[0]
+	tableName := args[1]
+
+	columns := parseColumns(ctx.GetFlag("columns"))
+	if len(columns) == 0 {
+		fmt.Fprintln(ctx.Err, "Error: --columns is required")
+		ctx.Exit(ExitUsage)
+		return
+	}
+
+	limit := 100
+	if v := ctx.GetFlag("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			fmt.Fprintf(ctx.Err, "Invalid limit: %s\n", v)
+			ctx.Exit(ExitUsage)
+			return
+		}
+		limit = n
+	}
+
+	if !ctx.RequireRead(dbName) {
+		return
+	}
+
+	conn, err := h.dbManager.OpenConnection(dbName, ctx.User)
+	if err != nil {
+		fmt.Fprintf(ctx.Err, "Failed to open database: %v\n", err)
+		ctx.Exit(errorExitCode(err))
+		return
+	}
+
+	// SQLite treats an unknown double-quoted identifier as a string literal,
+	// which would silently group everything together, so check names first
+	existing, err := database.NewSchema(conn).GetColumns(tableName)
+	if err != nil {
+		fmt.Fprintf(ctx.Err, "Failed to get columns: %v\n", err)
+		ctx.Exit(errorExitCode(err))
+		return
+	}
+	if len(existing) == 0 {
+		fmt.Fprintf(ctx.Err, "Table not found: %s\n", tableName)
+		ctx.Exit(ExitNotFound)
+		return
+	}
+	known := make(map[string]bool, len(existing))
+	for _, c := range existing {
+		known[strings.ToLower(c.Name)] = true
+	}
+	quoted := make([]string, len(columns))
+	for i, c := range columns {
+		if !known[strings.ToLower(c)] {
+			fmt.Fprintf(ctx.Err, "No such column: %s\n", c)
+			ctx.Exit(ExitUsage)
+			return
+		}
+		quoted[i] = quoteIdentifier(c)
+	}
+	keyList := strings.Join(quoted, ", ")
+	table := quoteIdentifier(tableName)
+
+	query := fmt.Sprintf(
+		"SELECT %s, COUNT(*) AS count, group_concat(rowid) AS rowids FROM %s GROUP BY %s HAVING COUNT(*) > 1 ORDER BY count DESC, %s",
+		keyList, table, keyList, keyList)
+	if limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", limit)
+	}
+
+	result, err := h.dbManager.WithQueryTimeout(ctx.Context(), ctx.User, dbName, func(qctx context.Context) (*database.QueryResult, error) {
+		return database.QueryContext(qctx, conn, query)
+	})
+	if err != nil {
+		fmt.Fprintf(ctx.Err, "Query error: %v\n", err)
+		ctx.Exit(errorExitCode(err))
+		return
+	}
+
+	// Trim the rowid list to a few samples
+	rowidCol := len(result.Columns) - 1
+	for _, row := range result.Rows {
+		if s, ok := row[rowidCol].(string); ok {
+			ids := strings.Split(s, ",")
+			if len(ids) > maxDupeSamples {
+				ids = append(ids[:maxDupeSamples], "...")
+			}
+			row[rowidCol] = strings.Join(ids, ",")
+		}
+	}
+	result.Columns[rowidCol] = "sample_rowids"
+
+	format := ctx.GetFlag("format")
+	if len(result.Rows) == 0 && format != "json" {
+		ctx.Infof("No duplicates found.\n")
+	} else {
+		formatQueryResult(ctx, result, format)
+	}
+
+	if ctx.HasFlag("delete-sql") && len(result.Rows) > 0 {
+		// Keep the first row of each group
+		ctx.Infof("\n-- Remove duplicates, keeping the lowest rowid of each group:\n")
+		fmt.Fprintf(ctx.Out, "DELETE FROM %s WHERE rowid NOT IN (SELECT MIN(rowid) FROM %s GROUP BY %s);\n",
+			table, table, keyList)
+	}
+}
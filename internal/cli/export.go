@@ -1,7 +1,10 @@
 package cli
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 
 	"github.com/johan-st/sqlite-tui/internal/database"
 )
@@ -10,8 +13,8 @@ import (
 func (h *Handler) cmdExport(ctx *CommandContext) {
 	args := ctx.GetPositionalArgs()
 	if len(args) < 2 {
-		fmt.Fprintln(ctx.Err, "Usage: export <database> <table> [--format=csv|json]")
-		ctx.Exit(1)
+		fmt.Fprintln(ctx.Err, "Usage: export <database> <table> [--format=csv|tsv|json]")
+		ctx.Exit(ExitUsage)
 		return
 	}
 
@@ -21,60 +24,166 @@ func (h *Handler) cmdExport(ctx *CommandContext) {
 	if !ctx.RequireRead(dbName) {
 		return
 	}
+	rowCap, ok := h.exportRowCap(ctx, dbName)
+	if !ok {
+		return
+	}
+
+	format := ctx.GetFlag("format")
+	if format == "" {
+		format = "csv" // Default to CSV for export
+	}
+	if format != "csv" && format != "tsv" && format != "json" {
+		fmt.Fprintf(ctx.Err, "Unknown format: %s (use csv, tsv or json)\n", format)
+		ctx.Exit(ExitUsage)
+		return
+	}
 
 	conn, err := h.dbManager.OpenConnection(dbName, ctx.User)
 	if err != nil {
 		fmt.Fprintf(ctx.Err, "Failed to open database: %v\n", err)
-		ctx.Exit(1)
+		ctx.Exit(errorExitCode(err))
 		return
 	}
 
-	// No limit for export - get all rows
+	// Export every row, up to the caps. One row past a cap shows that
+	// output was cut off.
 	opts := database.SelectOptions{Limit: 0}
 	if where := ctx.GetFlag("where"); where != "" {
 		opts.Where = where
 	}
+	if rowCap > 0 {
+		opts.Limit = rowCap + 1
+	}
+	left := ctx.rowsLeft()
+	if left >= 0 && (opts.Limit <= 0 || opts.Limit > left) {
+		opts.Limit = left + 1
+	}
 
-	result, err := database.Select(conn, tableName, opts)
+	// Rows are written as they are read, so memory use doesn't grow with
+	// the table
+	written := 0
+	capped, outOfQuota := false, false
+	err = h.dbManager.RunWithQueryTimeout(ctx.Context(), ctx.User, dbName, func(qctx context.Context) error {
+		rows, err := database.SelectRows(qctx, conn, tableName, opts)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		out := newExportWriter(ctx.Out, format, rows.Columns())
+		out.header(ctx.headers(rows.Columns()))
+		for rows.Next() {
+			if rowCap > 0 && written == rowCap {
+				capped = true
+				break
+			}
+			if left >= 0 && written == left {
+				outOfQuota = true
+				break
+			}
+			out.row(rows.Row())
+			written++
+		}
+		out.finish()
+		return rows.Err()
+	})
+	if ctx.SessionInfo != nil {
+		ctx.SessionInfo.TakeRows(written)
+	}
 	if err != nil {
 		fmt.Fprintf(ctx.Err, "Query error: %v\n", err)
-		ctx.Exit(1)
+		ctx.Exit(errorExitCode(err))
 		return
 	}
+	if capped {
+		ctx.noteCapped(rowCap)
+	} else if outOfQuota {
+		ctx.noteQuota(written)
+	}
+}
 
-	format := ctx.GetFlag("format")
-	if format == "" {
-		format = "csv" // Default to CSV for export
+// exportWriter writes exported rows one at a time in the export format.
+type exportWriter struct {
+	w       io.Writer
+	format  string
+	columns []string
+	rows    int
+}
+
+func newExportWriter(w io.Writer, format string, columns []string) *exportWriter {
+	return &exportWriter{w: w, format: format, columns: columns}
+}
+
+// header writes the header row; nil headers are skipped. JSON has none.
+func (e *exportWriter) header(headers []string) {
+	switch {
+	case headers == nil || e.format == "json":
+	case e.format == "tsv":
+		printTSVLine(e.w, headers)
+	default:
+		printCSV(e.w, headers, nil)
 	}
+}
 
-	switch format {
-	case "json":
-		rows := make([]map[string]any, 0, len(result.Rows))
-		for _, row := range result.Rows {
-			m := make(map[string]any)
-			for i, col := range result.Columns {
-				if i < len(row) {
-					m[col] = row[i]
-				}
-			}
-			rows = append(rows, m)
+// row writes one row.
+func (e *exportWriter) row(row []any) {
+	defer func() { e.rows++ }()
+
+	if e.format != "json" {
+		values := make([]string, len(row))
+		for i, v := range row {
+			values[i] = database.FormatValue(v)
 		}
-		printJSON(ctx.Out, rows)
-
-	case "csv":
-		strRows := make([][]string, len(result.Rows))
-		for i, row := range result.Rows {
-			strRows[i] = make([]string, len(row))
-			for j, v := range row {
-				strRows[i][j] = database.FormatValue(v)
-			}
+		if e.format == "tsv" {
+			printTSVLine(e.w, values)
+		} else {
+			printCSV(e.w, nil, [][]string{values})
 		}
-		printCSV(ctx.Out, result.Columns, strRows)
+		return
+	}
 
-	default:
-		fmt.Fprintf(ctx.Err, "Unknown format: %s (use csv or json)\n", format)
-		ctx.Exit(1)
+	// The same layout printJSON gives a slice of objects
+	obj := make(map[string]any, len(e.columns))
+	for i, col := range e.columns {
+		if i < len(row) {
+			obj[col] = row[i]
+		}
+	}
+	data, _ := json.MarshalIndent(obj, "  ", "  ")
+	if e.rows == 0 {
+		fmt.Fprint(e.w, "[\n  ")
+	} else {
+		fmt.Fprint(e.w, ",\n  ")
+	}
+	e.w.Write(data)
+}
+
+// finish ends the output, closing the JSON array.
+func (e *exportWriter) finish() {
+	if e.format != "json" {
+		return
+	}
+	if e.rows == 0 {
+		fmt.Fprintln(e.w, "[]")
+	} else {
+		fmt.Fprint(e.w, "\n]\n")
+	}
+}
+
+// exportRowCap returns the row cap for select and export in a database (0
+// for none). Admins may lift it with --no-cap, also when running a command
+// on someone's behalf through sudo or an approval.
+func (h *Handler) exportRowCap(ctx *CommandContext, dbName string) (int, bool) {
+	if ctx.HasFlag("no-cap") {
+		if ctx.User != nil && ctx.User.IsAdmin {
+			return 0, true
+		}
+		fmt.Fprintln(ctx.Err, "Access denied: only admins can lift the row cap with --no-cap")
+		ctx.Exit(ExitAccessDenied)
+		return 0, false
 	}
+	return h.dbManager.ExportRowLimit(ctx.User, dbName), true
 }
 
 // cmdDownload streams the raw database file.
@@ -82,7 +191,7 @@ func (h *Handler) cmdDownload(ctx *CommandContext) {
 	args := ctx.GetPositionalArgs()
 	if len(args) < 1 {
 		fmt.Fprintln(ctx.Err, "Usage: download <database>")
-		ctx.Exit(1)
+		ctx.Exit(ExitUsage)
 		return
 	}
 
@@ -94,7 +203,7 @@ func (h *Handler) cmdDownload(ctx *CommandContext) {
 
 	if err := h.dbManager.StreamDatabase(dbName, ctx.User, ctx.Out); err != nil {
 		fmt.Fprintf(ctx.Err, "Download error: %v\n", err)
-		ctx.Exit(1)
+		ctx.Exit(errorExitCode(err))
 		return
 	}
 }
@@ -0,0 +1,187 @@
+package cli
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/johan-st/sqlite-tui/internal/database"
+)
+
+const ftsUsage = `Usage: fts create <database> <table> --columns=a,b [--name=index]
+       fts rebuild <database> <index>
+       fts search <database> <index> "<query>" [--limit=N] [--snippet]
+       fts drop <database> <index>`
+
+// cmdFTS manages FTS5 full-text indexes.
+func (h *Handler) cmdFTS(ctx *CommandContext) {
+	args := ctx.GetPositionalArgs()
+	if len(args) < 3 {
+		fmt.Fprintln(ctx.Err, ftsUsage)
+		ctx.Exit(ExitUsage)
+		return
+	}
+
+	switch args[0] {
+	case "create":
+		h.ftsCreate(ctx, args[1], args[2])
+	case "rebuild":
+		h.ftsRebuild(ctx, args[1], args[2])
+	case "drop":
+		h.ftsDrop(ctx, args[1], args[2])
+	case "search":
+		if len(args) < 4 {
+			fmt.Fprintln(ctx.Err, ftsUsage)
+			ctx.Exit(ExitUsage)
+			return
+		}
+		h.ftsSearch(ctx, args[1], args[2], args[3])
+	default:
+		fmt.Fprintf(ctx.Err, "Unknown fts command: %s\n", args[0])
+		fmt.Fprintln(ctx.Err, ftsUsage)
+		ctx.Exit(ExitUsage)
+	}
+}
+
+// ftsCreate creates an index over the given columns of a table.
+func (h *Handler) ftsCreate(ctx *CommandContext, dbName, tableName string) {
+	columns := parseColumns(ctx.GetFlag("columns"))
+	if len(columns) == 0 {
+		fmt.Fprintln(ctx.Err, "Error: --columns is required")
+		ctx.Exit(ExitUsage)
+		return
+	}
+
+	if !ctx.RequireWrite(dbName) {
+		return
+	}
+
+	index := ctx.GetFlag("name")
+	if index == "" {
+		index = database.FTSIndexName(tableName)
+	}
+
+	conn, err := h.dbManager.OpenConnection(dbName, ctx.User)
+	if err != nil {
+		fmt.Fprintf(ctx.Err, "Failed to open database: %v\n", err)
+		ctx.Exit(errorExitCode(err))
+		return
+	}
+
+	if err := database.CreateFTSIndex(conn, tableName, index, columns); err != nil {
+		fmt.Fprintf(ctx.Err, "Error creating index: %v\n", err)
+		ctx.Exit(errorExitCode(err))
+		return
+	}
+
+	format := ctx.GetFlag("format")
+	if format == "json" {
+		printJSON(ctx.Out, map[string]any{"created": index, "table": tableName, "columns": columns})
+	} else {
+		ctx.Infof("Full-text index '%s' created on '%s'\n", index, tableName)
+	}
+
+	// Log to audit
+	if h.historyStore != nil {
+		h.historyStore.RecordAuditSimple(ctx.GetSessionID(), "FTS_CREATE", dbName, tableName,
+			map[string]any{"index": index, "columns": columns})
+	}
+}
+
+// ftsRebuild repopulates an index from its content table.
+func (h *Handler) ftsRebuild(ctx *CommandContext, dbName, index string) {
+	if !ctx.RequireWrite(dbName) {
+		return
+	}
+
+	conn, err := h.dbManager.OpenConnection(dbName, ctx.User)
+	if err != nil {
+		fmt.Fprintf(ctx.Err, "Failed to open database: %v\n", err)
+		ctx.Exit(errorExitCode(err))
+		return
+	}
+
+	if err := database.RebuildFTSIndex(conn, index); err != nil {
+		fmt.Fprintf(ctx.Err, "Error rebuilding index: %v\n", err)
+		ctx.Exit(errorExitCode(err))
+		return
+	}
+
+	format := ctx.GetFlag("format")
+	if format == "json" {
+		printJSON(ctx.Out, map[string]any{"rebuilt": index})
+	} else {
+		ctx.Infof("Full-text index '%s' rebuilt\n", index)
+	}
+
+	// Log to audit
+	if h.historyStore != nil {
+		h.historyStore.RecordAuditSimple(ctx.GetSessionID(), "FTS_REBUILD", dbName, index, nil)
+	}
+}
+
+// ftsDrop removes an index and its sync triggers.
+func (h *Handler) ftsDrop(ctx *CommandContext, dbName, index string) {
+	if !ctx.RequireWrite(dbName) {
+		return
+	}
+
+	conn, err := h.dbManager.OpenConnection(dbName, ctx.User)
+	if err != nil {
+		fmt.Fprintf(ctx.Err, "Failed to open database: %v\n", err)
+		ctx.Exit(errorExitCode(err))
+		return
+	}
+
+	if err := database.DropFTSIndex(conn, index); err != nil {
+		fmt.Fprintf(ctx.Err, "Error dropping index: %v\n", err)
+		ctx.Exit(errorExitCode(err))
+		return
+	}
+
+	format := ctx.GetFlag("format")
+	if format == "json" {
+		printJSON(ctx.Out, map[string]any{"dropped": index})
+	} else {
+		ctx.Infof("Full-text index '%s' dropped\n", index)
+	}
+
+	// Log to audit
+	if h.historyStore != nil {
+		h.historyStore.RecordAuditSimple(ctx.GetSessionID(), "FTS_DROP", dbName, index, nil)
+	}
+}
+
+// ftsSearch runs a MATCH query against an index.
+func (h *Handler) ftsSearch(ctx *CommandContext, dbName, index, match string) {
+	if !ctx.RequireRead(dbName) {
+		return
+	}
+
+	limit := 100
+	if v := ctx.GetFlag("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			fmt.Fprintf(ctx.Err, "Invalid limit: %s\n", v)
+			ctx.Exit(ExitUsage)
+			return
+		}
+		limit = n
+	}
+
+	conn, err := h.dbManager.OpenConnection(dbName, ctx.User)
+	if err != nil {
+		fmt.Fprintf(ctx.Err, "Failed to open database: %v\n", err)
+		ctx.Exit(errorExitCode(err))
+		return
+	}
+
+	result, err := database.SearchFTSIndex(conn, index, match, limit, ctx.HasFlag("snippet"))
+	if err != nil {
+		fmt.Fprintf(ctx.Err, "Search error: %v\n", err)
+		ctx.Exit(errorExitCode(err))
+		return
+	}
+
+	format := ctx.GetFlag("format")
+	formatQueryResult(ctx, result, format)
+}
@@ -0,0 +1,38 @@
+package cli
+
+import (
+	"context"
+
+	"github.com/johan-st/sqlite-tui/internal/server"
+)
+
+// cmdHealth runs the server health checks. Exits non-zero when a check fails.
+func (h *Handler) cmdHealth(ctx *CommandContext) {
+	report := server.CheckHealth(context.Background(), h.dbManager, h.historyStore)
+
+	// Check details can name databases and paths; only admins see them
+	if !ctx.User.IsAdmin {
+		for i := range report.Checks {
+			report.Checks[i].Message = ""
+		}
+	}
+
+	format := ctx.GetFlag("format")
+	if format == "json" {
+		printJSON(ctx.Out, report)
+	} else {
+		rows := make([][]string, 0, len(report.Checks))
+		for _, c := range report.Checks {
+			status := "ok"
+			if !c.OK {
+				status = "FAIL"
+			}
+			rows = append(rows, []string{c.Name, status, c.Message})
+		}
+		printTable(ctx.Out, ctx.headers([]string{"CHECK", "STATUS", "MESSAGE"}), rows, ctx.maxColWidth())
+	}
+
+	if !report.OK() {
+		ctx.Exit(ExitUsage)
+	}
+}
@@ -0,0 +1,126 @@
+package cli
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/johan-st/sqlite-tui/internal/server"
+)
+
+// defaultHostKeyGrace is how long the old host key stays in use after
+// host-key rotate.
+const defaultHostKeyGrace = 7 * 24 * time.Hour
+
+// cmdHostKey lists or rotates the server's host keys.
+func (h *Handler) cmdHostKey(ctx *CommandContext) {
+	if !ctx.RequireAdmin() {
+		return
+	}
+
+	if ctx.Session == nil {
+		fmt.Fprintln(ctx.Err, "host-key is only available in SSH server mode")
+		ctx.Exit(ExitUsage)
+		return
+	}
+
+	hostKeys := server.GetHostKeysFromSSH(ctx.Session)
+	if hostKeys == nil {
+		fmt.Fprintln(ctx.Err, "Host key manager not available")
+		ctx.Exit(ExitUsage)
+		return
+	}
+
+	args := ctx.GetPositionalArgs()
+	switch {
+	case len(args) == 0 || args[0] == "list":
+		h.listHostKeys(ctx, hostKeys)
+	case args[0] == "rotate":
+		h.rotateHostKey(ctx, hostKeys)
+	default:
+		fmt.Fprintln(ctx.Err, "Usage: host-key [list | rotate [--type=ed25519|rsa|ecdsa] [--grace=7d]]")
+		ctx.Exit(ExitUsage)
+	}
+}
+
+func (h *Handler) listHostKeys(ctx *CommandContext, hostKeys *server.HostKeyManager) {
+	keys, err := hostKeys.List()
+	if err != nil {
+		fmt.Fprintf(ctx.Err, "Error: %v\n", err)
+		ctx.Exit(ExitUsage)
+		return
+	}
+
+	format := ctx.GetFlag("format")
+	if format == "json" {
+		printJSON(ctx.Out, keys)
+		return
+	}
+
+	rows := make([][]string, 0, len(keys))
+	for _, k := range keys {
+		activates := ""
+		if !k.ActivatesAt.IsZero() {
+			activates = k.ActivatesAt.Local().Format("2006-01-02 15:04:05")
+		}
+		rows = append(rows, []string{k.Type, k.Status, k.Fingerprint, activates, k.Path})
+	}
+	printTable(ctx.Out, ctx.headers([]string{"TYPE", "STATUS", "FINGERPRINT", "ACTIVATES", "PATH"}), rows, ctx.maxColWidth())
+}
+
+func (h *Handler) rotateHostKey(ctx *CommandContext, hostKeys *server.HostKeyManager) {
+	grace := defaultHostKeyGrace
+	if v := ctx.GetFlag("grace"); v != "" {
+		d, err := parseDurationFlag(v)
+		if err != nil {
+			fmt.Fprintf(ctx.Err, "Invalid --grace: %v\n", err)
+			ctx.Exit(ExitUsage)
+			return
+		}
+		grace = d
+	}
+
+	key, err := hostKeys.Rotate(ctx.GetFlag("type"), grace)
+	if err != nil {
+		fmt.Fprintf(ctx.Err, "Error: %v\n", err)
+		ctx.Exit(ExitUsage)
+		return
+	}
+
+	format := ctx.GetFlag("format")
+	if format == "json" {
+		printJSON(ctx.Out, key)
+	} else if key.Status == "active" {
+		ctx.Infof("New %s host key is active: %s\n", key.Type, key.Fingerprint)
+		fmt.Fprintln(ctx.Out, key.PublicKey)
+	} else {
+		ctx.Infof("New %s host key %s becomes active at %s.\n", key.Type, key.Fingerprint,
+			key.ActivatesAt.Local().Format("2006-01-02 15:04:05"))
+		ctx.Infof("Add it to clients' known_hosts before then:\n")
+		fmt.Fprintln(ctx.Out, key.PublicKey)
+	}
+
+	// Log to audit
+	if h.historyStore != nil {
+		h.historyStore.RecordAuditSimple(ctx.GetSessionID(), "ROTATE_HOST_KEY", "", "", map[string]any{
+			"type":         key.Type,
+			"fingerprint":  key.Fingerprint,
+			"activates_at": key.ActivatesAt,
+		})
+	}
+}
+
+// parseDurationFlag parses a Go duration or a number of days like "7d".
+func parseDurationFlag(v string) (time.Duration, error) {
+	if n, ok := strings.CutSuffix(v, "d"); ok {
+		if days, err := strconv.Atoi(n); err == nil && days >= 0 {
+			return time.Duration(days) * 24 * time.Hour, nil
+		}
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("expected a duration like 12h or 7d, got %q", v)
+	}
+	return d, nil
+}
@@ -0,0 +1,103 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/johan-st/sqlite-tui/internal/database"
+)
+
+const jsonUsage = `Usage: json extract <database> <table> <column> '$.path' [--where=...] [--limit=N]
+       json each <database> <table> <column> ['$.path'] [--where=...] [--limit=N]`
+
+// cmdJSON queries JSON stored in table columns.
+func (h *Handler) cmdJSON(ctx *CommandContext) {
+	args := ctx.GetPositionalArgs()
+	if len(args) < 4 {
+		fmt.Fprintln(ctx.Err, jsonUsage)
+		ctx.Exit(ExitUsage)
+		return
+	}
+
+	sub, dbName, tableName, column := args[0], args[1], args[2], args[3]
+	path := "$"
+	if len(args) > 4 {
+		path = args[4]
+	}
+
+	if !strings.HasPrefix(path, "$") {
+		fmt.Fprintf(ctx.Err, "Invalid JSON path: %s (paths start with '$')\n", path)
+		ctx.Exit(ExitUsage)
+		return
+	}
+
+	var query string
+	col := quoteIdentifier(column)
+	switch sub {
+	case "extract":
+		if len(args) < 5 {
+			fmt.Fprintln(ctx.Err, jsonUsage)
+			ctx.Exit(ExitUsage)
+			return
+		}
+		// Rows that don't hold valid JSON yield NULL instead of failing the query
+		query = fmt.Sprintf(
+			"SELECT rowid, CASE WHEN json_valid(%s) THEN json_extract(%s, ?1) END AS value FROM %s",
+			col, col, quoteIdentifier(tableName))
+		if where := ctx.GetFlag("where"); where != "" {
+			query += " WHERE " + where
+		}
+	case "each":
+		// json_each explodes arrays and objects into one row per element
+		query = fmt.Sprintf(
+			"SELECT t.rowid, j.key, j.value, j.type FROM %s AS t, json_each(t.%s, ?1) AS j WHERE json_valid(t.%s)",
+			quoteIdentifier(tableName), col, col)
+		if where := ctx.GetFlag("where"); where != "" {
+			query += " AND (" + where + ")"
+		}
+	default:
+		fmt.Fprintf(ctx.Err, "Unknown json command: %s\n", sub)
+		fmt.Fprintln(ctx.Err, jsonUsage)
+		ctx.Exit(ExitUsage)
+		return
+	}
+
+	limit := 100
+	if v := ctx.GetFlag("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			fmt.Fprintf(ctx.Err, "Invalid limit: %s\n", v)
+			ctx.Exit(ExitUsage)
+			return
+		}
+		limit = n
+	}
+	if limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", limit)
+	}
+
+	if !ctx.RequireRead(dbName) {
+		return
+	}
+
+	conn, err := h.dbManager.OpenConnection(dbName, ctx.User)
+	if err != nil {
+		fmt.Fprintf(ctx.Err, "Failed to open database: %v\n", err)
+		ctx.Exit(errorExitCode(err))
+		return
+	}
+
+	result, err := h.dbManager.WithQueryTimeout(ctx.Context(), ctx.User, dbName, func(qctx context.Context) (*database.QueryResult, error) {
+		return database.QueryContext(qctx, conn, query, path)
+	})
+	if err != nil {
+		fmt.Fprintf(ctx.Err, "Query error: %v\n", err)
+		ctx.Exit(errorExitCode(err))
+		return
+	}
+
+	format := ctx.GetFlag("format")
+	formatQueryResult(ctx, result, format)
+}
@@ -0,0 +1,127 @@
+package cli
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// cmdLocks lists application-level write locks or force-releases one.
+func (h *Handler) cmdLocks(ctx *CommandContext) {
+	if !ctx.RequireAdmin() {
+		return
+	}
+
+	args := ctx.GetPositionalArgs()
+	if len(args) > 0 {
+		if args[0] != "release" || len(args) < 2 {
+			fmt.Fprintln(ctx.Err, "Usage: locks [release <database>]")
+			ctx.Exit(ExitUsage)
+			return
+		}
+		h.releaseLock(ctx, args[1])
+		return
+	}
+
+	locks := h.dbManager.GetLockManager().ListLocks()
+
+	format := ctx.GetFlag("format")
+	if format == "json" {
+		result := make([]map[string]any, 0, len(locks))
+		for _, info := range locks {
+			result = append(result, map[string]any{
+				"database":   h.databaseLabel(info.Path),
+				"path":       info.Path,
+				"table":      info.Table,
+				"held_by":    info.HeldBy,
+				"session_id": info.SessionID,
+				"since":      info.Since,
+				"age":        time.Since(info.Since).Round(time.Second).String(),
+				"waiting":    info.Waiting,
+				"heartbeat":  info.Heartbeat,
+			})
+		}
+		printJSON(ctx.Out, result)
+		return
+	}
+
+	if len(locks) == 0 {
+		ctx.Infof("No locks held\n")
+		return
+	}
+
+	rows := make([][]string, 0, len(locks))
+	for _, info := range locks {
+		session := shortID(info.SessionID)
+		table := info.Table
+		if table == "" {
+			table = "*"
+		}
+		rows = append(rows, []string{
+			h.databaseLabel(info.Path),
+			table,
+			info.HeldBy,
+			session,
+			formatDuration(time.Since(info.Since)),
+			strconv.Itoa(info.Waiting),
+		})
+	}
+	printTable(ctx.Out, ctx.headers([]string{"DATABASE", "TABLE", "HOLDER", "SESSION", "AGE", "WAITING"}), rows, ctx.maxColWidth())
+}
+
+// releaseLock force-clears the lock on a database.
+func (h *Handler) releaseLock(ctx *CommandContext, name string) {
+	path := name
+	if db := h.dbManager.GetDatabase(name); db != nil {
+		path = db.Path
+	}
+
+	released := h.dbManager.GetLockManager().ForceUnlock(path)
+	if len(released) == 0 {
+		fmt.Fprintf(ctx.Err, "No lock held on %s\n", name)
+		ctx.Exit(ExitNotFound)
+		return
+	}
+
+	format := ctx.GetFlag("format")
+	if format == "json" {
+		result := make([]map[string]any, 0, len(released))
+		for _, info := range released {
+			result = append(result, map[string]any{
+				"released":   h.databaseLabel(path),
+				"table":      info.Table,
+				"held_by":    info.HeldBy,
+				"session_id": info.SessionID,
+			})
+		}
+		printJSON(ctx.Out, result)
+	} else {
+		for _, info := range released {
+			what := h.databaseLabel(path)
+			if info.Table != "" {
+				what = fmt.Sprintf("table %s of %s", info.Table, what)
+			}
+			ctx.Infof("Released lock on %s held by %s since %s\n", what, info.HeldBy, info.Since.Format(time.RFC3339))
+		}
+	}
+
+	// Log to audit
+	if h.historyStore != nil {
+		for _, info := range released {
+			h.historyStore.RecordAuditSimple(ctx.GetSessionID(), "FORCE_UNLOCK", name, "", map[string]any{
+				"table":      info.Table,
+				"held_by":    info.HeldBy,
+				"session_id": info.SessionID,
+				"since":      info.Since,
+			})
+		}
+	}
+}
+
+// databaseLabel returns the alias of a database path, or the path itself.
+func (h *Handler) databaseLabel(path string) string {
+	if db := h.dbManager.GetDatabase(path); db != nil && db.Alias != "" {
+		return db.Alias
+	}
+	return path
+}
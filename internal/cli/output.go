@@ -0,0 +1,89 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// atomicFile writes to a temporary file next to the destination and renames
+// it into place on Commit, so readers never observe a partially written file.
+type atomicFile struct {
+	*os.File
+	path string
+}
+
+// createAtomicFile creates a temporary file in the same directory as path.
+func createAtomicFile(path string) (*atomicFile, error) {
+	dir := filepath.Dir(path)
+	f, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return nil, err
+	}
+	return &atomicFile{File: f, path: path}, nil
+}
+
+// Commit flushes the temporary file and renames it to the destination.
+func (f *atomicFile) Commit() error {
+	if err := f.Sync(); err != nil {
+		f.Abort()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Chmod(f.Name(), 0644); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Rename(f.Name(), f.path); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return nil
+}
+
+// Abort discards the temporary file, leaving the destination untouched.
+func (f *atomicFile) Abort() {
+	f.Close()
+	os.Remove(f.Name())
+}
+
+// withOutputFile runs fn with ctx.Out redirected to the --output file, if
+// one was given. The file only replaces the destination when the command
+// succeeds.
+func withOutputFile(ctx *CommandContext, fn func()) {
+	path := ctx.GetFlag("output")
+	if path == "" || path == "-" {
+		fn()
+		return
+	}
+
+	// Writing files on the server is not something remote users should do
+	if ctx.Session != nil {
+		fmt.Fprintln(ctx.Err, "Error: --output is only available in local mode")
+		ctx.Exit(ExitUsage)
+		return
+	}
+
+	f, err := createAtomicFile(path)
+	if err != nil {
+		fmt.Fprintf(ctx.Err, "Failed to create output file: %v\n", err)
+		ctx.Exit(ExitUsage)
+		return
+	}
+
+	ctx.Out = f
+	ctx.outputPath = path
+	fn()
+
+	if ctx.exitCode != ExitOK {
+		f.Abort()
+		return
+	}
+	if err := f.Commit(); err != nil {
+		fmt.Fprintf(ctx.Err, "Failed to write output file: %v\n", err)
+		ctx.Exit(ExitUsage)
+	}
+}
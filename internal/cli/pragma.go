@@ -0,0 +1,147 @@
+package cli
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/johan-st/sqlite-tui/internal/database"
+)
+
+// writablePragmas lists the pragmas that may be changed through the pragma
+// command: those stored in the database file. Per-connection settings such
+// as cache_size would only change one pooled connection, so they can only
+// be read. auto_vacuum takes effect on an existing database after VACUUM.
+var writablePragmas = map[string]bool{
+	"application_id": true,
+	"auto_vacuum":    true,
+	"journal_mode":   true,
+	"user_version":   true,
+}
+
+// actionPragmas modify the database even when called without a value, so
+// they require write access just like an assignment.
+var actionPragmas = map[string]bool{
+	"incremental_vacuum": true,
+	"optimize":           true,
+	"shrink_memory":      true,
+	"wal_checkpoint":     true,
+}
+
+var (
+	pragmaNameRe  = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	pragmaValueRe = regexp.MustCompile(`^(-?[0-9]+|[A-Za-z_][A-Za-z0-9_]*)$`)
+)
+
+// cmdPragma reads or sets a PRAGMA on a database.
+func (h *Handler) cmdPragma(ctx *CommandContext) {
+	args := ctx.GetPositionalArgs()
+	if len(args) < 2 {
+		fmt.Fprintln(ctx.Err, "Usage: pragma <database> <name> [value|--value=N]")
+		ctx.Exit(ExitUsage)
+		return
+	}
+
+	dbName := args[0]
+	name := strings.ToLower(args[1])
+
+	if !pragmaNameRe.MatchString(name) {
+		fmt.Fprintf(ctx.Err, "Invalid pragma name: %s\n", args[1])
+		ctx.Exit(ExitUsage)
+		return
+	}
+
+	if !ctx.RequireRead(dbName) {
+		return
+	}
+
+	// Negative values look like flags, so they can also be passed as --value=N
+	value := ctx.GetFlag("value")
+	if value == "" && len(args) > 2 {
+		value = args[2]
+	}
+
+	if value == "" {
+		if actionPragmas[name] && !ctx.RequireWrite(dbName) {
+			return
+		}
+		h.readPragma(ctx, dbName, name)
+		return
+	}
+
+	if !writablePragmas[name] {
+		fmt.Fprintf(ctx.Err, "Error: pragma %q cannot be set (writable: %s)\n",
+			name, strings.Join(writablePragmaNames(), ", "))
+		ctx.Exit(ExitUsage)
+		return
+	}
+	if !pragmaValueRe.MatchString(value) {
+		fmt.Fprintf(ctx.Err, "Invalid pragma value: %s\n", value)
+		ctx.Exit(ExitUsage)
+		return
+	}
+
+	if !ctx.RequireWrite(dbName) {
+		return
+	}
+
+	// A journal mode set in the source config is applied on every open
+	if db := h.dbManager.GetDatabase(dbName); name == "journal_mode" && db != nil && db.Source != nil {
+		if mode := strings.ToLower(db.Source.JournalMode); mode != "" && mode != "keep" {
+			fmt.Fprintf(ctx.Err, "Error: journal_mode is set to %s in the server config\n", mode)
+			ctx.Exit(ExitUsage)
+			return
+		}
+	}
+
+	if h.dbManager.Tx(ctx.GetSessionID()) != nil {
+		fmt.Fprintln(ctx.Err, "Error: pragmas can't be set in a transaction")
+		ctx.Exit(ExitUsage)
+		return
+	}
+
+	previous, current, err := h.dbManager.SetPragma(ctx.Context(), dbName, ctx.User, ctx.GetSessionID(), name, value)
+	if err != nil {
+		fmt.Fprintf(ctx.Err, "Pragma error: %v\n", err)
+		ctx.Exit(errorExitCode(err))
+		return
+	}
+
+	format := ctx.GetFlag("format")
+	if format == "json" {
+		printJSON(ctx.Out, map[string]any{"pragma": name, "value": value, "previous": previous, "current": current})
+	} else {
+		ctx.Infof("Set %s = %s, now %s (was %s)\n", name, value, database.FormatValue(current), database.FormatValue(previous))
+	}
+
+	// Log to audit
+	if h.historyStore != nil {
+		h.historyStore.RecordAuditSimple(ctx.GetSessionID(), "PRAGMA", dbName, "",
+			map[string]any{"pragma": name, "value": value, "previous": previous, "current": current})
+	}
+}
+
+// readPragma prints the current value(s) of a pragma. It runs as a query,
+// under the user's query limits and timeout.
+func (h *Handler) readPragma(ctx *CommandContext, dbName, name string) {
+	result, err := h.dbManager.ExecuteQuery(ctx.Context(), dbName, ctx.User, ctx.GetSessionID(), "PRAGMA "+name)
+	if err != nil {
+		fmt.Fprintf(ctx.Err, "Pragma error: %v\n", err)
+		ctx.Exit(errorExitCode(err))
+		return
+	}
+
+	format := ctx.GetFlag("format")
+	formatQueryResult(ctx, result, format)
+}
+
+// writablePragmaNames returns the sorted list of settable pragmas.
+func writablePragmaNames() []string {
+	names := make([]string, 0, len(writablePragmas))
+	for name := range writablePragmas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -1,10 +1,13 @@
 package cli
 
 import (
+	"context"
 	"fmt"
 	"strconv"
+	"time"
 
 	"github.com/johan-st/sqlite-tui/internal/database"
+	"github.com/johan-st/sqlite-tui/internal/history"
 )
 
 // cmdQuery executes a raw SQL query.
@@ -12,7 +15,7 @@ func (h *Handler) cmdQuery(ctx *CommandContext) {
 	args := ctx.GetPositionalArgs()
 	if len(args) < 2 {
 		fmt.Fprintln(ctx.Err, "Usage: query <database> \"<sql>\"")
-		ctx.Exit(1)
+		ctx.Exit(ExitUsage)
 		return
 	}
 
@@ -24,19 +27,79 @@ func (h *Handler) cmdQuery(ctx *CommandContext) {
 	}
 
 	// Check write access for non-SELECT queries
-	if !isReadOnlyQuery(sql) && !ctx.RequireWrite(dbName) {
+	if !database.IsReadOnlyQuery(sql) && !ctx.RequireWrite(dbName) {
 		return
 	}
 
-	result, err := h.dbManager.ExecuteQuery(dbName, ctx.User, ctx.GetSessionID(), sql)
+	// Other databases can be attached for cross-database joins
+	attachments, err := database.ParseAttachments(ctx.GetFlag("attach"))
+	if err != nil {
+		fmt.Fprintf(ctx.Err, "Error: %v\n", err)
+		ctx.Exit(ExitUsage)
+		return
+	}
+	for _, a := range attachments {
+		if !ctx.RequireRead(a.Database) {
+			return
+		}
+	}
+
+	// --snapshot reads from a copy, so long queries don't hold up writers
+	snapshot := ctx.HasFlag("snapshot")
+	if snapshot && len(attachments) > 0 {
+		fmt.Fprintln(ctx.Err, "Error: --snapshot can't be combined with --attach")
+		ctx.Exit(ExitUsage)
+		return
+	}
+
+	start := time.Now()
+	var result *database.QueryResult
+	if snapshot {
+		result, err = h.dbManager.ExecuteQuerySnapshot(ctx.Context(), dbName, ctx.User, ctx.GetSessionID(), sql)
+	} else if refs := h.dbManager.ReferencedDatabases(dbName, sql); len(attachments) == 0 && len(refs) > 0 && h.dbManager.Tx(ctx.GetSessionID()) == nil {
+		// Tables qualified by another database's alias attach it
+		result, err = h.dbManager.ExecuteCrossQuery(ctx.Context(), append([]string{dbName}, refs...), ctx.User, ctx.GetSessionID(), sql)
+	} else {
+		result, err = h.dbManager.ExecuteQueryAttached(ctx.Context(), dbName, attachments, ctx.User, ctx.GetSessionID(), sql)
+	}
+	h.recordQuery(ctx, dbName, sql, start, result, err)
 	if err != nil {
 		fmt.Fprintf(ctx.Err, "Query error: %v\n", err)
-		ctx.Exit(1)
+		ctx.Exit(errorExitCode(err))
 		return
 	}
 
+	ctx.limitRows(result)
 	format := ctx.GetFlag("format")
 	formatQueryResult(ctx, result, format)
+	if note := result.TruncationNote(); note != "" {
+		fmt.Fprintf(ctx.Err, "Note: %s\n", note)
+	}
+}
+
+// recordQuery stores an executed query in the history, if available.
+func (h *Handler) recordQuery(ctx *CommandContext, dbName, sql string, start time.Time, result *database.QueryResult, err error) {
+	if h.historyStore == nil {
+		return
+	}
+
+	record := &history.QueryRecord{
+		SessionID:       ctx.GetSessionID(),
+		DatabasePath:    dbName,
+		Query:           sql,
+		ExecutionTimeMs: time.Since(start).Milliseconds(),
+		CreatedAt:       start,
+	}
+	if db := h.dbManager.GetDatabase(dbName); db != nil {
+		record.DatabasePath = db.Path
+	}
+	if result != nil {
+		record.RowsAffected = result.RowsAffected
+	}
+	if err != nil {
+		record.Error = err.Error()
+	}
+	h.historyStore.RecordQuery(record)
 }
 
 // cmdSelect browses table data.
@@ -44,7 +107,7 @@ func (h *Handler) cmdSelect(ctx *CommandContext) {
 	args := ctx.GetPositionalArgs()
 	if len(args) < 2 {
 		fmt.Fprintln(ctx.Err, "Usage: select <database> <table> [--where=...] [--limit=N] [--offset=N]")
-		ctx.Exit(1)
+		ctx.Exit(ExitUsage)
 		return
 	}
 
@@ -54,11 +117,15 @@ func (h *Handler) cmdSelect(ctx *CommandContext) {
 	if !ctx.RequireRead(dbName) {
 		return
 	}
+	rowCap, ok := h.exportRowCap(ctx, dbName)
+	if !ok {
+		return
+	}
 
 	conn, err := h.dbManager.OpenConnection(dbName, ctx.User)
 	if err != nil {
 		fmt.Fprintf(ctx.Err, "Failed to open database: %v\n", err)
-		ctx.Exit(1)
+		ctx.Exit(errorExitCode(err))
 		return
 	}
 
@@ -80,24 +147,94 @@ func (h *Handler) cmdSelect(ctx *CommandContext) {
 			opts.Offset = n
 		}
 	}
+	// One row past a cap tells capRows and limitRows that output was cut off
+	if rowCap > 0 && (opts.Limit <= 0 || opts.Limit > rowCap) {
+		opts.Limit = rowCap + 1
+	}
+	if left := ctx.rowsLeft(); left >= 0 && (opts.Limit <= 0 || opts.Limit > left) {
+		opts.Limit = left + 1
+	}
 
-	result, err := database.Select(conn, tableName, opts)
+	result, err := h.dbManager.WithQueryTimeout(ctx.Context(), ctx.User, dbName, func(qctx context.Context) (*database.QueryResult, error) {
+		return database.SelectContext(qctx, conn, tableName, opts)
+	})
 	if err != nil {
 		fmt.Fprintf(ctx.Err, "Query error: %v\n", err)
-		ctx.Exit(1)
+		ctx.Exit(errorExitCode(err))
 		return
 	}
+	ctx.capRows(result, rowCap)
+	ctx.limitRows(result)
 
 	format := ctx.GetFlag("format")
 	formatQueryResult(ctx, result, format)
 }
 
+// cmdCell prints one whole value. Query results cut values over
+// database.MaxCellSize; this fetches them, writing BLOBs as raw bytes.
+func (h *Handler) cmdCell(ctx *CommandContext) {
+	args := ctx.GetPositionalArgs()
+	if len(args) < 4 {
+		fmt.Fprintln(ctx.Err, "Usage: cell <database> <table> <column> <key> [--key=column]")
+		ctx.Exit(ExitUsage)
+		return
+	}
+
+	dbName, tableName, column := args[0], args[1], args[2]
+	if !ctx.RequireRead(dbName) {
+		return
+	}
+
+	conn, err := h.dbManager.OpenConnection(dbName, ctx.User)
+	if err != nil {
+		fmt.Fprintf(ctx.Err, "Failed to open database: %v\n", err)
+		ctx.Exit(errorExitCode(err))
+		return
+	}
+
+	keyColumn := ctx.GetFlag("key")
+	if keyColumn == "" {
+		keyColumn = database.NewSchema(conn).KeyColumn(tableName)
+	}
+	if keyColumn == "" {
+		fmt.Fprintf(ctx.Err, "Table %s has no single key column; name one with --key\n", tableName)
+		ctx.Exit(ExitUsage)
+		return
+	}
+
+	// Integer keys must bind as integers to match INTEGER columns
+	var key any = args[3]
+	if n, err := strconv.ParseInt(args[3], 10, 64); err == nil {
+		key = n
+	}
+
+	var value any
+	err = h.dbManager.RunWithQueryTimeout(ctx.Context(), ctx.User, dbName, func(qctx context.Context) error {
+		value, err = database.FetchCell(qctx, conn, tableName, column, keyColumn, key)
+		return err
+	})
+	if err != nil {
+		fmt.Fprintf(ctx.Err, "Query error: %v\n", err)
+		ctx.Exit(errorExitCode(err))
+		return
+	}
+
+	switch v := value.(type) {
+	case []byte:
+		ctx.Out.Write(v)
+	case nil:
+		fmt.Fprintln(ctx.Out, "NULL")
+	default:
+		fmt.Fprintln(ctx.Out, database.FormatValue(v))
+	}
+}
+
 // cmdCount counts rows in a table.
 func (h *Handler) cmdCount(ctx *CommandContext) {
 	args := ctx.GetPositionalArgs()
 	if len(args) < 2 {
 		fmt.Fprintln(ctx.Err, "Usage: count <database> <table> [--where=...]")
-		ctx.Exit(1)
+		ctx.Exit(ExitUsage)
 		return
 	}
 
@@ -111,7 +248,7 @@ func (h *Handler) cmdCount(ctx *CommandContext) {
 	conn, err := h.dbManager.OpenConnection(dbName, ctx.User)
 	if err != nil {
 		fmt.Fprintf(ctx.Err, "Failed to open database: %v\n", err)
-		ctx.Exit(1)
+		ctx.Exit(errorExitCode(err))
 		return
 	}
 
@@ -123,10 +260,12 @@ func (h *Handler) cmdCount(ctx *CommandContext) {
 		query = fmt.Sprintf("SELECT COUNT(*) FROM %s", quoteIdentifier(tableName))
 	}
 
-	result, err := database.Query(conn, query)
+	result, err := h.dbManager.WithQueryTimeout(ctx.Context(), ctx.User, dbName, func(qctx context.Context) (*database.QueryResult, error) {
+		return database.QueryContext(qctx, conn, query)
+	})
 	if err != nil {
 		fmt.Fprintf(ctx.Err, "Query error: %v\n", err)
-		ctx.Exit(1)
+		ctx.Exit(errorExitCode(err))
 		return
 	}
 
@@ -159,45 +298,34 @@ func formatQueryResult(ctx *CommandContext, result *database.QueryResult, format
 		printJSON(ctx.Out, rows)
 
 	case "csv":
-		// Convert rows to strings
-		strRows := make([][]string, len(result.Rows))
-		for i, row := range result.Rows {
-			strRows[i] = make([]string, len(row))
-			for j, v := range row {
-				strRows[i][j] = database.FormatValue(v)
-			}
-		}
-		printCSV(ctx.Out, result.Columns, strRows)
+		printCSV(ctx.Out, ctx.headers(result.Columns), stringRows(result))
+
+	case "tsv":
+		printTSV(ctx.Out, ctx.headers(result.Columns), stringRows(result))
 
 	default:
 		// Table format
 		if len(result.Columns) == 0 {
 			if result.RowsAffected > 0 {
-				fmt.Fprintf(ctx.Out, "Rows affected: %d\n", result.RowsAffected)
+				ctx.Infof("Rows affected: %d\n", result.RowsAffected)
 			}
 			return
 		}
 
-		// Print headers
-		for i, col := range result.Columns {
-			if i > 0 {
-				fmt.Fprint(ctx.Out, "\t")
-			}
-			fmt.Fprint(ctx.Out, col)
-		}
-		fmt.Fprintln(ctx.Out)
+		printTable(ctx.Out, ctx.headers(result.Columns), stringRows(result), ctx.maxColWidth())
+	}
+}
 
-		// Print rows
-		for _, row := range result.Rows {
-			for i, v := range row {
-				if i > 0 {
-					fmt.Fprint(ctx.Out, "\t")
-				}
-				fmt.Fprint(ctx.Out, database.FormatValue(v))
-			}
-			fmt.Fprintln(ctx.Out)
+// stringRows formats every value of a query result for display.
+func stringRows(result *database.QueryResult) [][]string {
+	strRows := make([][]string, len(result.Rows))
+	for i, row := range result.Rows {
+		strRows[i] = make([]string, len(row))
+		for j, v := range row {
+			strRows[i][j] = database.FormatValue(v)
 		}
 	}
+	return strRows
 }
 
 // parseColumns splits a comma-separated column list.
@@ -264,29 +392,3 @@ func quoteIdentifier(name string) string {
 	}
 	return `"` + escaped + `"`
 }
-
-// isReadOnlyQuery checks if a query is read-only.
-func isReadOnlyQuery(query string) bool {
-	upper := toUpper(trim(query))
-	return hasPrefix(upper, "SELECT") ||
-		hasPrefix(upper, "PRAGMA") ||
-		hasPrefix(upper, "EXPLAIN") ||
-		hasPrefix(upper, "WITH")
-}
-
-func toUpper(s string) string {
-	b := make([]byte, len(s))
-	for i := 0; i < len(s); i++ {
-		c := s[i]
-		if c >= 'a' && c <= 'z' {
-			b[i] = c - 32
-		} else {
-			b[i] = c
-		}
-	}
-	return string(b)
-}
-
-func hasPrefix(s, prefix string) bool {
-	return len(s) >= len(prefix) && s[:len(prefix)] == prefix
-}
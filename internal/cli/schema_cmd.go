@@ -11,7 +11,7 @@ func (h *Handler) cmdCreateTable(ctx *CommandContext) {
 	if len(args) < 2 {
 		fmt.Fprintln(ctx.Err, "Usage: create-table <database> <table> --columns=\"col:type[:pk|notnull],..\"")
 		fmt.Fprintln(ctx.Err, "   or: create-table <database> <table> --sql=\"CREATE TABLE ...\"")
-		ctx.Exit(1)
+		ctx.Exit(ExitUsage)
 		return
 	}
 
@@ -32,14 +32,14 @@ func (h *Handler) cmdCreateTable(ctx *CommandContext) {
 		sql = buildCreateTableSQL(tableName, colSpec)
 	} else {
 		fmt.Fprintln(ctx.Err, "Error: --columns or --sql is required")
-		ctx.Exit(1)
+		ctx.Exit(ExitUsage)
 		return
 	}
 
-	result, err := h.dbManager.ExecuteQuery(dbName, ctx.User, ctx.GetSessionID(), sql)
+	result, err := h.dbManager.ExecuteQuery(ctx.Context(), dbName, ctx.User, ctx.GetSessionID(), sql)
 	if err != nil {
 		fmt.Fprintf(ctx.Err, "Error creating table: %v\n", err)
-		ctx.Exit(1)
+		ctx.Exit(errorExitCode(err))
 		return
 	}
 
@@ -47,7 +47,7 @@ func (h *Handler) cmdCreateTable(ctx *CommandContext) {
 	if format == "json" {
 		printJSON(ctx.Out, map[string]any{"created": tableName, "rows_affected": result.RowsAffected})
 	} else {
-		fmt.Fprintf(ctx.Out, "Table '%s' created successfully\n", tableName)
+		ctx.Infof("Table '%s' created successfully\n", tableName)
 	}
 
 	// Log to audit
@@ -61,7 +61,7 @@ func (h *Handler) cmdAddColumn(ctx *CommandContext) {
 	args := ctx.GetPositionalArgs()
 	if len(args) < 4 {
 		fmt.Fprintln(ctx.Err, "Usage: add-column <database> <table> <column> <type> [--default=...] [--notnull]")
-		ctx.Exit(1)
+		ctx.Exit(ExitUsage)
 		return
 	}
 
@@ -86,10 +86,10 @@ func (h *Handler) cmdAddColumn(ctx *CommandContext) {
 		sql += " DEFAULT " + defaultVal
 	}
 
-	_, err := h.dbManager.ExecuteQuery(dbName, ctx.User, ctx.GetSessionID(), sql)
+	_, err := h.dbManager.ExecuteQuery(ctx.Context(), dbName, ctx.User, ctx.GetSessionID(), sql)
 	if err != nil {
 		fmt.Fprintf(ctx.Err, "Error adding column: %v\n", err)
-		ctx.Exit(1)
+		ctx.Exit(errorExitCode(err))
 		return
 	}
 
@@ -97,7 +97,7 @@ func (h *Handler) cmdAddColumn(ctx *CommandContext) {
 	if format == "json" {
 		printJSON(ctx.Out, map[string]any{"added": colName, "table": tableName, "type": colType})
 	} else {
-		fmt.Fprintf(ctx.Out, "Column '%s' added to table '%s'\n", colName, tableName)
+		ctx.Infof("Column '%s' added to table '%s'\n", colName, tableName)
 	}
 
 	// Log to audit
@@ -111,7 +111,7 @@ func (h *Handler) cmdDropTable(ctx *CommandContext) {
 	args := ctx.GetPositionalArgs()
 	if len(args) < 2 {
 		fmt.Fprintln(ctx.Err, "Usage: drop-table <database> <table> --confirm")
-		ctx.Exit(1)
+		ctx.Exit(ExitUsage)
 		return
 	}
 
@@ -123,18 +123,24 @@ func (h *Handler) cmdDropTable(ctx *CommandContext) {
 	}
 
 	if !ctx.HasFlag("confirm") {
-		fmt.Fprintln(ctx.Err, "Error: --confirm is required to drop a table")
-		fmt.Fprintln(ctx.Err, "This will permanently delete the table and all its data.")
-		ctx.Exit(1)
-		return
+		if !ctx.Interactive {
+			fmt.Fprintln(ctx.Err, "Error: --confirm is required to drop a table")
+			fmt.Fprintln(ctx.Err, "This will permanently delete the table and all its data.")
+			ctx.Exit(ExitUsage)
+			return
+		}
+		if !ctx.ConfirmByName(tableName,
+			fmt.Sprintf("This will permanently delete the table '%s' and all its data.", tableName)) {
+			return
+		}
 	}
 
 	sql := fmt.Sprintf("DROP TABLE %s", quoteIdentifier(tableName))
 
-	_, err := h.dbManager.ExecuteQuery(dbName, ctx.User, ctx.GetSessionID(), sql)
+	_, err := h.dbManager.ExecuteQuery(ctx.Context(), dbName, ctx.User, ctx.GetSessionID(), sql)
 	if err != nil {
 		fmt.Fprintf(ctx.Err, "Error dropping table: %v\n", err)
-		ctx.Exit(1)
+		ctx.Exit(errorExitCode(err))
 		return
 	}
 
@@ -142,7 +148,7 @@ func (h *Handler) cmdDropTable(ctx *CommandContext) {
 	if format == "json" {
 		printJSON(ctx.Out, map[string]any{"dropped": tableName})
 	} else {
-		fmt.Fprintf(ctx.Out, "Table '%s' dropped\n", tableName)
+		ctx.Infof("Table '%s' dropped\n", tableName)
 	}
 
 	// Log to audit
@@ -0,0 +1,97 @@
+package cli
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+
+	"github.com/johan-st/sqlite-tui/internal/database"
+)
+
+// maxSeedRows caps how many rows a single seed command may insert.
+const maxSeedRows = 1000000
+
+// cmdSeed fills a table with generated test data.
+func (h *Handler) cmdSeed(ctx *CommandContext) {
+	args := ctx.GetPositionalArgs()
+	if len(args) < 2 {
+		fmt.Fprintln(ctx.Err, "Usage: seed <database> <table> [--rows=N] [--spec=col:kind,...] [--seed=N]")
+		ctx.Exit(ExitUsage)
+		return
+	}
+
+	dbName := args[0]
+	tableName := args[1]
+
+	opts := database.SeedOptions{Rows: 100}
+	if v := ctx.GetFlag("rows"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxSeedRows {
+			fmt.Fprintf(ctx.Err, "Invalid row count: %s (1-%d)\n", v, maxSeedRows)
+			ctx.Exit(ExitUsage)
+			return
+		}
+		opts.Rows = n
+	}
+	if v := ctx.GetFlag("seed"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			fmt.Fprintf(ctx.Err, "Invalid seed: %s\n", v)
+			ctx.Exit(ExitUsage)
+			return
+		}
+		opts.Rand = rand.New(rand.NewSource(n))
+	}
+	if spec := ctx.GetFlag("spec"); spec != "" {
+		opts.Spec = make(map[string]string)
+		for _, part := range splitTrim(spec, ",") {
+			col, kind, ok := strings.Cut(part, ":")
+			if !ok || col == "" {
+				fmt.Fprintf(ctx.Err, "Invalid spec entry: %s (use col:kind)\n", part)
+				ctx.Exit(ExitUsage)
+				return
+			}
+			opts.Spec[col] = strings.ToLower(kind)
+		}
+	}
+
+	if !ctx.RequireWrite(dbName) {
+		return
+	}
+
+	conn, err := h.dbManager.OpenConnection(dbName, ctx.User)
+	if err != nil {
+		fmt.Fprintf(ctx.Err, "Failed to open database: %v\n", err)
+		ctx.Exit(errorExitCode(err))
+		return
+	}
+
+	// Bulk writes hold the application lock like any other write query
+	unlock, err := h.dbManager.LockForWrite(ctx.Context(), dbName, ctx.User.DisplayName(), ctx.GetSessionID(), tableName)
+	if err != nil {
+		fmt.Fprintf(ctx.Err, "Seed error: %v\n", err)
+		ctx.Exit(errorExitCode(err))
+		return
+	}
+	inserted, err := database.SeedTable(conn, tableName, opts)
+	unlock()
+	if err != nil {
+		fmt.Fprintf(ctx.Err, "Seed error: %v\n", err)
+		ctx.Exit(errorExitCode(err))
+		return
+	}
+
+	format := ctx.GetFlag("format")
+	if format == "json" {
+		printJSON(ctx.Out, map[string]any{"table": tableName, "rows_inserted": inserted})
+	} else {
+		ctx.Infof("Inserted %d rows into '%s'\n", inserted, tableName)
+	}
+
+	// Log to audit
+	if h.historyStore != nil {
+		h.historyStore.RecordAuditSimple(ctx.GetSessionID(), "SEED", dbName, tableName,
+			map[string]any{"rows": inserted, "spec": ctx.GetFlag("spec")})
+	}
+}
@@ -0,0 +1,118 @@
+package cli
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/dustin/go-humanize"
+	"github.com/johan-st/sqlite-tui/internal/database"
+)
+
+// cmdSize reports per-table and per-index on-disk sizes.
+func (h *Handler) cmdSize(ctx *CommandContext) {
+	dbName, ok := ctx.RequireArg(0, "database")
+	if !ok {
+		return
+	}
+
+	if !ctx.RequireRead(dbName) {
+		return
+	}
+
+	conn, err := h.dbManager.OpenConnection(dbName, ctx.User)
+	if err != nil {
+		fmt.Fprintf(ctx.Err, "Failed to open database: %v\n", err)
+		ctx.Exit(errorExitCode(err))
+		return
+	}
+
+	report, err := database.MeasureSizes(ctx.Context(), conn)
+	if err != nil {
+		fmt.Fprintf(ctx.Err, "Failed to measure sizes: %v\n", err)
+		ctx.Exit(errorExitCode(err))
+		return
+	}
+	sizes := report.Objects
+
+	sortBy := ctx.GetFlag("sort")
+	if sortBy == "" {
+		sortBy = "size"
+	}
+	if !sortObjectSizes(sizes, sortBy, ctx.HasFlag("reverse")) {
+		fmt.Fprintf(ctx.Err, "Unknown sort key: %s (use size, pages, name or type)\n", sortBy)
+		ctx.Exit(ExitUsage)
+		return
+	}
+
+	format := ctx.GetFlag("format")
+	if format == "json" {
+		objs := make([]map[string]any, 0, len(sizes))
+		for _, s := range sizes {
+			objs = append(objs, map[string]any{
+				"name":  s.Name,
+				"type":  s.Type,
+				"table": s.Table,
+				"pages": s.Pages,
+				"bytes": s.Bytes,
+			})
+		}
+		printJSON(ctx.Out, map[string]any{
+			"page_size":      report.PageSize,
+			"page_count":     report.PageCount,
+			"freelist_count": report.FreelistCount,
+			"total_bytes":    report.TotalBytes(),
+			"estimated":      report.Estimated,
+			"objects":        objs,
+		})
+		return
+	}
+
+	fmt.Fprintf(ctx.Out, "Page size:\t%d\n", report.PageSize)
+	fmt.Fprintf(ctx.Out, "Pages:\t%d\n", report.PageCount)
+	fmt.Fprintf(ctx.Out, "Freelist pages:\t%d\n", report.FreelistCount)
+	fmt.Fprintf(ctx.Out, "Total:\t%s\n", humanize.Bytes(uint64(report.TotalBytes())))
+	if report.Estimated {
+		ctx.Infof("Note:\tdbstat unavailable, sizes are estimated from payload\n")
+	}
+	fmt.Fprintln(ctx.Out)
+
+	rows := make([][]string, 0, len(sizes))
+	for _, s := range sizes {
+		rows = append(rows, []string{
+			s.Name, s.Type, s.Table,
+			strconv.FormatInt(s.Pages, 10),
+			humanize.Bytes(uint64(s.Bytes)),
+		})
+	}
+	printTable(ctx.Out, []string{"NAME", "TYPE", "TABLE", "PAGES", "SIZE"}, rows, ctx.maxColWidth())
+}
+
+// sortObjectSizes sorts sizes by the given key. Size and page sorts are
+// largest first, name and type sorts are alphabetical. Returns false for an
+// unknown key.
+func sortObjectSizes(sizes []*database.ObjectSize, key string, reverse bool) bool {
+	var less func(a, b *database.ObjectSize) bool
+	switch key {
+	case "size", "bytes":
+		less = func(a, b *database.ObjectSize) bool { return a.Bytes > b.Bytes }
+	case "pages":
+		less = func(a, b *database.ObjectSize) bool { return a.Pages > b.Pages }
+	case "name":
+		less = func(a, b *database.ObjectSize) bool { return a.Name < b.Name }
+	case "type":
+		less = func(a, b *database.ObjectSize) bool { return a.Type < b.Type }
+	default:
+		return false
+	}
+
+	// Sort by name first so ties come out in a stable order
+	sort.Slice(sizes, func(i, j int) bool { return sizes[i].Name < sizes[j].Name })
+	sort.SliceStable(sizes, func(i, j int) bool {
+		if reverse {
+			return less(sizes[j], sizes[i])
+		}
+		return less(sizes[i], sizes[j])
+	})
+	return true
+}
@@ -0,0 +1,70 @@
+package cli
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/johan-st/sqlite-tui/internal/server"
+)
+
+// cmdStatus shows a health snapshot of the running server.
+func (h *Handler) cmdStatus(ctx *CommandContext) {
+	if !ctx.RequireAdmin() {
+		return
+	}
+
+	uptime := time.Since(h.started)
+	databases := len(h.dbManager.GetDiscovery().GetDatabases())
+	locks := len(h.dbManager.GetLockManager().ListLocks())
+
+	// Sessions and history only exist in SSH server mode
+	sessions := -1
+	if ctx.Session != nil {
+		if sessionMgr := server.GetSessionMgrFromSSH(ctx.Session); sessionMgr != nil {
+			sessions = sessionMgr.Count()
+		}
+	}
+	historySize := int64(-1)
+	if h.historyStore != nil {
+		size, err := h.historyStore.Size()
+		if err != nil {
+			fmt.Fprintf(ctx.Err, "Warning: history size: %v\n", err)
+		} else {
+			historySize = size
+		}
+	}
+
+	format := ctx.GetFlag("format")
+	if format == "json" {
+		result := map[string]any{
+			"version":        h.version,
+			"started":        h.started,
+			"uptime":         uptime.Round(time.Second).String(),
+			"uptime_seconds": int64(uptime.Seconds()),
+			"databases":      databases,
+			"locks":          locks,
+			"sessions":       nil,
+			"history_bytes":  nil,
+		}
+		if sessions >= 0 {
+			result["sessions"] = sessions
+		}
+		if historySize >= 0 {
+			result["history_bytes"] = historySize
+		}
+		printJSON(ctx.Out, result)
+		return
+	}
+
+	fmt.Fprintf(ctx.Out, "Version:\t%s\n", h.version)
+	fmt.Fprintf(ctx.Out, "Uptime:\t%s (since %s)\n", formatDuration(uptime), h.started.Format(time.RFC3339))
+	fmt.Fprintf(ctx.Out, "Databases:\t%d\n", databases)
+	if sessions >= 0 {
+		fmt.Fprintf(ctx.Out, "Sessions:\t%d\n", sessions)
+	}
+	fmt.Fprintf(ctx.Out, "Locks:\t%d\n", locks)
+	if historySize >= 0 {
+		fmt.Fprintf(ctx.Out, "History DB:\t%s\n", humanize.Bytes(uint64(historySize)))
+	}
+}
@@ -0,0 +1,68 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+)
+
+// cmdSudo runs a single command as admin for users with can_sudo. A reason
+// is required, and the escalation is audited as SUDO before the command
+// runs. The command goes through the same gates as any other, as the
+// elevated user.
+func (h *Handler) cmdSudo(ctx *CommandContext) {
+	// sudo's own flags come before the command; the rest belong to it
+	var reason string
+	i := 0
+	for ; i < len(ctx.Args) && strings.HasPrefix(ctx.Args[i], "-"); i++ {
+		value, ok := strings.CutPrefix(ctx.Args[i], "--reason=")
+		if !ok {
+			fmt.Fprintf(ctx.Err, "Unknown sudo option: %s\n", ctx.Args[i])
+			ctx.Exit(ExitUsage)
+			return
+		}
+		reason = strings.TrimSpace(value)
+	}
+	if i == len(ctx.Args) {
+		fmt.Fprintln(ctx.Err, "Usage: sudo --reason=\"...\" <command> [args...]")
+		ctx.Exit(ExitUsage)
+		return
+	}
+	cmd, args := ctx.Args[i], ctx.Args[i+1:]
+
+	if ctx.User == nil || !h.dbManager.CanSudo(ctx.User) {
+		fmt.Fprintln(ctx.Err, "Access denied: you may not use sudo")
+		ctx.Exit(ExitAccessDenied)
+		return
+	}
+	if cmd == "sudo" {
+		fmt.Fprintln(ctx.Err, "Error: sudo can't run sudo")
+		ctx.Exit(ExitUsage)
+		return
+	}
+	if reason == "" && ctx.Interactive {
+		reason, _ = ctx.readLine("Reason: ")
+	}
+	if reason == "" {
+		fmt.Fprintln(ctx.Err, "Error: sudo requires a reason, pass --reason=\"...\"")
+		ctx.Exit(ExitUsage)
+		return
+	}
+
+	if h.historyStore != nil {
+		h.historyStore.RecordAuditSimple(ctx.GetSessionID(), "SUDO", "", "", map[string]any{
+			"command": cmd,
+			"args":    args,
+			"reason":  reason,
+		})
+	}
+
+	elevated := *ctx.User
+	elevated.IsAdmin = true
+
+	run := *ctx
+	run.User = &elevated
+	run.Args = args
+	run.sudoer = ctx.User
+	h.routeCommand(cmd, &run)
+	ctx.Exit(run.exitCode)
+}
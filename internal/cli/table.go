@@ -0,0 +1,80 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/mattn/go-runewidth"
+)
+
+// defaultMaxColWidth is the cell width limit used when --max-col-width is not set.
+const defaultMaxColWidth = 50
+
+// cellReplacer makes control characters visible so they cannot break the layout.
+var cellReplacer = strings.NewReplacer("\r\n", `\n`, "\n", `\n`, "\r", `\r`, "\t", `\t`)
+
+// maxColWidth returns the --max-col-width flag value. Zero disables truncation.
+func (c *CommandContext) maxColWidth() int {
+	if v := c.GetFlag("max-col-width"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			return n
+		}
+	}
+	return defaultMaxColWidth
+}
+
+// printTable writes rows as aligned columns separated by two spaces.
+// Cells wider than maxWidth display columns are truncated with an ellipsis;
+// a maxWidth of zero disables truncation. Headers are skipped when nil.
+func printTable(w io.Writer, headers []string, rows [][]string, maxWidth int) {
+	cells := make([][]string, 0, len(rows)+1)
+	if headers != nil {
+		cells = append(cells, headers)
+	}
+	for _, row := range rows {
+		clean := make([]string, len(row))
+		for i, v := range row {
+			clean[i] = truncateCell(cellReplacer.Replace(v), maxWidth)
+		}
+		cells = append(cells, clean)
+	}
+
+	// Compute the display width of every column
+	var widths []int
+	for _, row := range cells {
+		for i, v := range row {
+			if i >= len(widths) {
+				widths = append(widths, 0)
+			}
+			if cw := runewidth.StringWidth(v); cw > widths[i] {
+				widths[i] = cw
+			}
+		}
+	}
+
+	var sb strings.Builder
+	for _, row := range cells {
+		sb.Reset()
+		for i, v := range row {
+			if i > 0 {
+				sb.WriteString("  ")
+			}
+			sb.WriteString(v)
+			// Don't pad the last column to avoid trailing whitespace
+			if i < len(row)-1 {
+				sb.WriteString(strings.Repeat(" ", widths[i]-runewidth.StringWidth(v)))
+			}
+		}
+		fmt.Fprintln(w, sb.String())
+	}
+}
+
+// truncateCell shortens s to at most maxWidth display columns.
+func truncateCell(s string, maxWidth int) string {
+	if maxWidth <= 0 || runewidth.StringWidth(s) <= maxWidth {
+		return s
+	}
+	return runewidth.Truncate(s, maxWidth, "…")
+}
@@ -0,0 +1,75 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/johan-st/sqlite-tui/internal/access"
+)
+
+// tableCommands lists the commands naming tables in their arguments, and
+// whether they write to them.
+var tableCommands = map[string]bool{
+	"schema":       false,
+	"describe":     false,
+	"dupes":        false,
+	"checksum":     false,
+	"select":       false,
+	"count":        false,
+	"cell":         false,
+	"tail":         false,
+	"json":         false,
+	"export":       false,
+	"insert":       true,
+	"update":       true,
+	"delete":       true,
+	"truncate":     true,
+	"seed":         true,
+	"create-table": true,
+	"add-column":   true,
+	"drop-table":   true,
+}
+
+// requireTables checks the tables a command names against alias/table
+// rules. Database-level checks are left to the command, so only a table
+// rule narrowing the user's access denies here.
+func (h *Handler) requireTables(cmd string, ctx *CommandContext) bool {
+	write, ok := tableCommands[cmd]
+	if !ok {
+		return true
+	}
+
+	args := ctx.GetPositionalArgs()
+	if cmd == "json" && len(args) > 0 {
+		args = args[1:] // json extract|each <database> <table> ...
+	}
+	if len(args) < 2 || h.dbManager.GetDatabase(args[0]) == nil {
+		return true
+	}
+	dbName, tables := args[0], args[1:2]
+	if cmd == "checksum" {
+		tables = args[1:]
+	}
+
+	allowed := func(level access.Level) bool {
+		if write {
+			return level.CanWrite()
+		}
+		return level.CanRead()
+	}
+	if !allowed(h.dbManager.GetAccessLevel(ctx.User, dbName)) {
+		return true
+	}
+	for _, table := range tables {
+		if allowed(h.dbManager.TableAccessLevel(ctx.User, dbName, table)) {
+			continue
+		}
+		if write {
+			fmt.Fprintf(ctx.Err, "Access denied: no write access to table %s\n", table)
+		} else {
+			fmt.Fprintf(ctx.Err, "Access denied: no access to table %s\n", table)
+		}
+		ctx.Exit(ExitAccessDenied)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,105 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/johan-st/sqlite-tui/internal/database"
+)
+
+// defaultTailLines is how many rows tail prints without --lines.
+const defaultTailLines = 10
+
+// cmdTail prints a table's last rows and, with --follow, the rows added or
+// updated after them until the client disconnects.
+func (h *Handler) cmdTail(ctx *CommandContext) {
+	args := ctx.GetPositionalArgs()
+	if len(args) < 2 {
+		fmt.Fprintln(ctx.Err, "Usage: tail <database> <table> [--lines=N] [--follow]")
+		ctx.Exit(ExitUsage)
+		return
+	}
+	dbName, tableName := args[0], args[1]
+
+	lines := defaultTailLines
+	if v := ctx.GetFlag("lines"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			fmt.Fprintf(ctx.Err, "Invalid --lines: %s\n", v)
+			ctx.Exit(ExitUsage)
+			return
+		}
+		lines = n
+	}
+
+	if !ctx.RequireRead(dbName) {
+		return
+	}
+
+	fctx, cancel := context.WithCancel(ctx.Context())
+	defer cancel()
+	feed, events, err := h.dbManager.Follow(fctx, dbName, ctx.User, tableName)
+	if err != nil {
+		fmt.Fprintf(ctx.Err, "Failed to follow table: %v\n", err)
+		ctx.Exit(errorExitCode(err))
+		return
+	}
+
+	recent, err := feed.Recent(fctx, lines)
+	if err != nil {
+		fmt.Fprintf(ctx.Err, "Query error: %v\n", err)
+		ctx.Exit(errorExitCode(err))
+		return
+	}
+	ctx.limitRows(recent)
+
+	format := ctx.GetFlag("format")
+	if !ctx.HasFlag("follow") {
+		formatQueryResult(ctx, recent, format)
+		return
+	}
+
+	// Following prints a line per row as it arrives
+	if format != "json" && !ctx.HasFlag("no-header") {
+		printTSVLine(ctx.Out, recent.Columns)
+	}
+	for _, row := range recent.Rows {
+		printFeedRow(ctx, format, "", recent.Columns, row)
+	}
+	for e := range events {
+		if e.Err != nil {
+			fmt.Fprintf(ctx.Err, "Follow error: %v\n", e.Err)
+			ctx.Exit(errorExitCode(e.Err))
+			return
+		}
+		if ctx.SessionInfo != nil && ctx.SessionInfo.TakeRows(1) == 0 {
+			fmt.Fprintln(ctx.Err, "Note: stopped following, the anonymous session quota is used up")
+			return
+		}
+		printFeedRow(ctx, format, e.Op, e.Columns, e.Row)
+	}
+}
+
+// printFeedRow prints one row followed by tail: as a JSON line holding the
+// operation that produced it, or as TSV.
+func printFeedRow(ctx *CommandContext, format, op string, columns []string, row []any) {
+	if format == "json" {
+		values := make(map[string]any, len(columns))
+		for i, col := range columns {
+			values[col] = row[i]
+		}
+		line := map[string]any{"row": values}
+		if op != "" {
+			line["op"] = op
+		}
+		printJSONLine(ctx.Out, line)
+		return
+	}
+
+	fields := make([]string, len(row))
+	for i, v := range row {
+		fields[i] = database.FormatValue(v)
+	}
+	printTSVLine(ctx.Out, fields)
+}
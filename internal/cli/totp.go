@@ -0,0 +1,88 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/johan-st/sqlite-tui/internal/database"
+	"github.com/johan-st/sqlite-tui/internal/totp"
+)
+
+// totpCommands need a TOTP code from users enrolled in TOTP.
+var totpCommands = map[string]bool{
+	"delete":     true,
+	"drop-table": true,
+	"truncate":   true,
+	"download":   true,
+	"upload":     true,
+}
+
+// needsTOTP reports whether a command is destructive enough to need a code.
+func needsTOTP(cmd string, ctx *CommandContext) bool {
+	if totpCommands[cmd] {
+		return true
+	}
+	if cmd == "query" {
+		if args := ctx.GetPositionalArgs(); len(args) > 1 && database.IsDestructiveQuery(args[1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// requireTOTP asks users enrolled in TOTP for a code before destructive
+// commands: from --totp, or a prompt in interactive sessions. Failures are
+// audited as TOTP_DENIED.
+func (h *Handler) requireTOTP(cmd string, ctx *CommandContext) bool {
+	if !needsTOTP(cmd, ctx) || h.dbManager.TOTPSecret(ctx.User) == "" {
+		return true
+	}
+
+	code := ctx.GetFlag("totp")
+	if code == "" && ctx.Interactive {
+		code, _ = ctx.readLine("TOTP code: ")
+	}
+	if code == "" {
+		fmt.Fprintf(ctx.Err, "Access denied: %s requires a TOTP code, pass --totp=CODE\n", cmd)
+		ctx.Exit(ExitAccessDenied)
+		return false
+	}
+
+	if err := h.dbManager.VerifyTOTP(ctx.User, code); err != nil {
+		fmt.Fprintln(ctx.Err, "Access denied: invalid or reused TOTP code")
+		ctx.Exit(ExitAccessDenied)
+		if h.historyStore != nil {
+			h.historyStore.RecordAuditSimple(ctx.GetSessionID(), "TOTP_DENIED", "", "", map[string]any{
+				"command": cmd,
+			})
+		}
+		return false
+	}
+	ctx.totpVerified = true
+	return true
+}
+
+// cmdTOTP generates a TOTP secret for enrolling in a second factor.
+func (h *Handler) cmdTOTP(ctx *CommandContext) {
+	args := ctx.GetPositionalArgs()
+	if len(args) < 1 || args[0] != "new" {
+		fmt.Fprintln(ctx.Err, "Usage: totp new")
+		ctx.Exit(ExitUsage)
+		return
+	}
+	if ctx.User == nil || ctx.User.IsAnonymous {
+		fmt.Fprintln(ctx.Err, "Access denied: TOTP needs an authenticated user")
+		ctx.Exit(ExitAccessDenied)
+		return
+	}
+
+	secret, err := totp.NewSecret()
+	if err != nil {
+		fmt.Fprintf(ctx.Err, "Error: %v\n", err)
+		ctx.Exit(ExitUsage)
+		return
+	}
+
+	fmt.Fprintf(ctx.Out, "Secret:\t%s\n", secret)
+	fmt.Fprintf(ctx.Out, "URI:\t%s\n", totp.URI("sqlite-tui", ctx.User.Name, secret))
+	ctx.Infof("\nAdd the URI to an authenticator app, then have an admin set\n  totp_secret: %q\nfor user %s in the config.\n", secret, ctx.User.Name)
+}
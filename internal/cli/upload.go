@@ -0,0 +1,68 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+)
+
+// cmdUpload replaces a database with a SQLite file read from stdin.
+func (h *Handler) cmdUpload(ctx *CommandContext) {
+	args := ctx.GetPositionalArgs()
+	if len(args) < 1 {
+		fmt.Fprintln(ctx.Err, "Usage: upload <database> < file.db")
+		ctx.Exit(ExitUsage)
+		return
+	}
+
+	dbName := args[0]
+
+	if !ctx.RequireWrite(dbName) {
+		return
+	}
+
+	// Replacing the file would overwrite the tables the user only sees
+	// part of
+	if len(h.dbManager.RowFilters(ctx.User, dbName)) > 0 {
+		fmt.Fprintln(ctx.Err, "Access denied: uploads not allowed with row filters")
+		ctx.Exit(ExitAccessDenied)
+		return
+	}
+
+	// A terminal on stdin means nothing was piped in
+	if ctx.In == nil || ctx.Interactive {
+		fmt.Fprintln(ctx.Err, "upload reads the database from stdin: upload <database> < file.db")
+		ctx.Exit(ExitUsage)
+		return
+	}
+
+	db := h.dbManager.GetDatabase(dbName)
+	upload, err := h.dbManager.CreateUpload(db.Path)
+	if err != nil {
+		fmt.Fprintf(ctx.Err, "Upload error: %v\n", err)
+		ctx.Exit(ExitUsage)
+		return
+	}
+
+	n, err := io.Copy(upload, ctx.In)
+	if err != nil {
+		upload.Abort()
+		fmt.Fprintf(ctx.Err, "Upload error: %v\n", err)
+		ctx.Exit(ExitUsage)
+		return
+	}
+
+	if err := upload.Commit(ctx.User.DisplayName(), ctx.GetSessionID()); err != nil {
+		fmt.Fprintf(ctx.Err, "Upload rejected: %v\n", err)
+		ctx.Exit(errorExitCode(err))
+		return
+	}
+
+	if h.historyStore != nil {
+		h.historyStore.RecordAuditSimple(ctx.GetSessionID(), "UPLOAD", db.Path, "", map[string]any{
+			"via":   "cli",
+			"bytes": n,
+		})
+	}
+
+	ctx.Infof("Uploaded %s (%d bytes)\n", dbName, n)
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"strings"
 )
 
 // cmdWhoami shows current user information.
@@ -24,6 +25,9 @@ func (h *Handler) cmdWhoami(ctx *CommandContext) {
 		if ctx.User.PublicKeyFP != "" {
 			info["public_key_fp"] = ctx.User.PublicKeyFP
 		}
+		if groups := h.dbManager.UserGroups(ctx.User); len(groups) > 0 {
+			info["groups"] = groups
+		}
 		printJSON(ctx.Out, info)
 		return
 	}
@@ -34,6 +38,9 @@ func (h *Handler) cmdWhoami(ctx *CommandContext) {
 	if ctx.User.PublicKeyFP != "" {
 		fmt.Fprintf(ctx.Out, "Key:\t%s\n", ctx.User.PublicKeyFP)
 	}
+	if groups := h.dbManager.UserGroups(ctx.User); len(groups) > 0 {
+		fmt.Fprintf(ctx.Out, "Groups:\t%s\n", strings.Join(groups, ", "))
+	}
 	fmt.Fprintf(ctx.Out, "Session:\t%s\n", ctx.GetSessionID())
 }
 
@@ -54,44 +61,94 @@ USAGE:
 DATABASE COMMANDS:
   ls, list                         List accessible databases
   info <database>                  Show database information
-  tables <database>                List tables in database
+  tables <database>                List tables (--exact to count big tables, --all for shadow tables)
   schema <database> <table>        Show table schema
+  describe <database> <table>      Profile column values
+  dupes <database> <table>         Find duplicate rows (--columns=a,b)
+  pragma <database> <name> [value] Read or set a PRAGMA
+  size <database>                  Show per-table and per-index sizes
+  checksum <database> [table...]   Checksum table contents
+  check <database>                 Check database integrity (--quick)
 
 QUERY COMMANDS:
   query <database> "<sql>"         Execute SQL query
   select <database> <table>        Browse table data
   count <database> <table>         Count rows in table
+  cell <database> <table> <column> <key>
+                                   Print one whole value, e.g. a BLOB
+  tail <database> <table>          Print the last rows (--follow for new ones)
+  fts search <database> <index>    Full-text search an FTS5 index
+  json extract|each <db> <table> <column> [path]
+                                   Query JSON stored in a column
 
 DATA COMMANDS (requires write access):
   insert <database> <table> --json='{"col":"val"}'
   update <database> <table> --where="id=1" --set='{"col":"val"}'
   delete <database> <table> --where="id=1" --confirm
+  truncate <database> <table> --confirm
+  seed <database> <table> --rows=1000
 
 EXPORT COMMANDS:
   export <database> <table>        Export table data
   download <database>              Download raw database file
+  upload <database> < file.db      Replace a database with a file from stdin
 
 SCHEMA COMMANDS (requires write access):
   create-table <database> <table>  Create new table
   add-column <database> <table>    Add column to table
   drop-table <database> <table>    Drop table (requires --confirm)
+  fts create|rebuild|drop ...      Manage FTS5 full-text indexes
 
 ADMIN COMMANDS (requires admin access):
   sessions                         List active sessions
+  sessions kill <id>               Terminate a session and release its locks
   history                          View query history
+  history prune --older-than=30d   Delete old query history
   audit                            View audit log
+  audit prune --older-than=365d    Delete old audit entries
+  locks                            List write locks
+  locks release <database>         Force-release a stale write lock
+  status                           Show server health snapshot
   reload-config                    Reload configuration
+  rescan                           Scan database sources for new and removed files
+  host-key [list]                  List host keys
+  host-key rotate [--grace=7d]     Generate a new host key, active after the grace period
+  bans [--all]                     List IPs banned for failed logins
+  bans clear <ip>|--all            Lift IP bans
+  approvals [list] [--all]         List commands waiting for approval (your own for non-admins)
+  approvals approve|deny <id>      Approve and run, or deny, a requested command
 
 UTILITY COMMANDS:
   whoami                           Show current user info
+  health                           Run health checks (exit 1 on failure)
+  web-login                        Print a sign-in link for the web viewer
+  api-token                        Print a token for the gRPC API
+  totp new                         Generate a TOTP secret for a second factor
+  sudo --reason="..." <command>    Run one command as admin (users with can_sudo)
   help [command]                   Show help
   version                          Show version
 
 COMMON OPTIONS:
   --format=json                    Output in JSON format
   --format=csv                     Output in CSV format
+  --format=tsv                     Output in TSV format (tabs/newlines escaped)
+  --no-header                      Omit the header row (table, csv, tsv)
   --limit=N                        Limit number of rows
   --offset=N                       Skip N rows
+  --quiet, -q                      Suppress informational messages
+  --output=PATH                    Write output to a file (local mode only)
+  --max-col-width=N                Truncate table cells wider than N (default 50, 0 = off)
+  --totp=CODE                      TOTP code for destructive commands (if enrolled)
+  --wait=DURATION                  Wait up to DURATION for another session's write lock
+
+EXIT CODES:
+  0  Success
+  1  Usage error or general failure
+  2  Access denied
+  3  Database or table not found
+  4  SQL error
+  5  Database locked by another session
+  6  Rate limit exceeded, retry later
 
 Run 'help <command>' for detailed help on a specific command.`)
 }
@@ -107,19 +164,380 @@ USAGE:
 OPTIONS:
   --format=json    Output in JSON format`,
 
+		"pragma": `pragma - Read or set a PRAGMA
+
+USAGE:
+  pragma <database> <name> [value] [--format=json]
+
+Any pragma can be read with read access. Setting a value requires write
+access and is limited to the pragmas stored in the database file:
+user_version, application_id, journal_mode and auto_vacuum (which takes
+effect on an existing database after VACUUM). The value is read back after
+setting it and shown with the previous one. Pragmas that act on the
+database without a value (optimize, wal_checkpoint, incremental_vacuum)
+also require write access. Changes are recorded in the audit log.
+
+Negative values look like flags; pass them as --value=N instead.
+
+EXAMPLES:
+  pragma mydb journal_mode
+  pragma mydb page_count
+  pragma mydb user_version 7
+  pragma mydb application_id --value=-1`,
+
+		"fts": `fts - Manage and search FTS5 full-text indexes
+
+USAGE:
+  fts create <database> <table> --columns=a,b [--name=index]
+  fts rebuild <database> <index>
+  fts search <database> <index> "<query>" [options]
+  fts drop <database> <index>
+
+create builds an external-content FTS5 index (default name <table>_fts)
+and adds triggers that keep it in sync with the table. rebuild repopulates
+it from the table, drop removes the index and its triggers. create, rebuild
+and drop require write access; search requires read access.
+
+SEARCH OPTIONS:
+  --limit=N           Limit results (default: 100, 0 = no limit)
+  --snippet           Add a column with the matching text highlighted
+  --format=json       Output as JSON
+
+EXAMPLES:
+  fts create mydb posts --columns=title,body
+  fts search mydb posts_fts "sqlite AND tui" --snippet
+  fts rebuild mydb posts_fts`,
+
+		"json": `json - Query JSON stored in table columns
+
+USAGE:
+  json extract <database> <table> <column> '$.path' [options]
+  json each <database> <table> <column> ['$.path'] [options]
+
+extract returns json_extract(column, path) for every row. each explodes
+the array or object at path (default $) into one row per element, with
+its key, value and type. Rows that don't hold valid JSON are skipped.
+
+OPTIONS:
+  --where="condition"  Filter rows (for each, qualify table columns as t.col)
+  --limit=N            Limit rows (default: 100, 0 = no limit)
+  --format=json        Output as JSON
+
+EXAMPLES:
+  json extract mydb events payload '$.user.id'
+  json each mydb posts tags --where="t.id = 1"`,
+
+		"seed": `seed - Fill a table with generated test data
+
+USAGE:
+  seed <database> <table> [options]
+
+Values are picked from each column's name and declared type, e.g. email,
+name, created_at or INTEGER. NOT NULL and single-column UNIQUE constraints
+are respected and foreign key columns use values from the referenced table.
+INTEGER PRIMARY KEY columns are left to SQLite. Requires write access.
+
+OPTIONS:
+  --rows=N             Number of rows to insert (default: 100, max 1000000)
+  --spec=col:kind,...  Override the kind for columns
+  --seed=N             Seed the generator for reproducible data
+
+KINDS:
+  int, real, text, words, name, email, bool, date, datetime, uuid, url,
+  phone, blob, skip (leave the column to its default)
+
+EXAMPLES:
+  seed mydb users --rows=1000
+  seed mydb events --rows=50 --spec=payload:text,source:skip`,
+
+		"describe": `describe - Profile the values in a table
+
+USAGE:
+  describe <database> <table> [--format=json]
+
+Reports, per column, the number of NULLs, distinct values, the minimum and
+maximum value and the average length. This scans the whole table.
+
+EXAMPLE:
+  describe mydb users`,
+
+		"dupes": `dupes - Find duplicate rows
+
+USAGE:
+  dupes <database> <table> --columns=a,b [options]
+
+Groups rows by the given columns and lists every key that occurs more than
+once, with its count and up to 5 sample rowids.
+
+OPTIONS:
+  --columns=a,b        Columns that make up the key (required)
+  --limit=N            Limit duplicate keys shown (default: 100, 0 = no limit)
+  --delete-sql         Print a DELETE statement that keeps one row per key
+  --format=json        Output as JSON
+
+The DELETE statement is only printed, never run. Review it and run it with
+the query command.
+
+EXAMPLE:
+  dupes mydb users --columns=email --delete-sql`,
+
+		"history": `history - View query history (admin)
+
+USAGE:
+  history [options]
+  history prune --older-than=AGE [--keep-errors]
+
+OPTIONS:
+  --user=NAME          Only queries by this user (authenticated or anonymous name)
+  --db=DATABASE        Only queries against this database (alias or path)
+  --since=TIME         Only queries at or after TIME
+  --until=TIME         Only queries before TIME
+  --errors-only        Only queries that failed
+  --search=TEXT        Only queries containing TEXT (case-insensitive)
+  --limit=N            Limit entries (default: 50)
+  --format=json        Output as JSON
+
+PRUNE OPTIONS:
+  --older-than=AGE     Delete entries recorded before AGE (a TIME, e.g. 30d)
+  --keep-errors        Keep failed queries when pruning
+
+Ended sessions no longer referenced by history or audit entries are pruned
+along with them. Pruning is itself recorded in the audit log.
+
+TIME can be 2006-01-02, "2006-01-02 15:04", RFC 3339, today, yesterday, or
+a duration ago such as 90m, 24h or 7d.
+
+EXAMPLE:
+  history --user=alice --db=prod --since=yesterday --until=today
+  history prune --older-than=30d --keep-errors`,
+
+		"audit": `audit - View the audit log (admin)
+
+USAGE:
+  audit [options]
+  audit prune --older-than=AGE
+
+OPTIONS:
+  --action=ACTION      Only entries with this action (e.g. DELETE, PRAGMA)
+  --db=DATABASE        Only entries for this database (alias or path)
+  --table=TABLE        Only entries for this table
+  --user=NAME          Only entries by this user (authenticated or anonymous name)
+  --denied             Only denials (ACCESS_DENIED, COMMAND_DENIED)
+  --since=TIME         Only entries at or after TIME
+  --until=TIME         Only entries before TIME
+  --limit=N            Limit entries (default: 50, 0 = no limit)
+  --format=json        Output as a JSON array
+  --format=jsonl       Output one JSON object per line, oldest first
+
+Commands refused for lack of access are recorded as ACCESS_DENIED with
+the command and its arguments; commands outside a user's allowed list as
+COMMAND_DENIED.
+
+TIME accepts the same forms as history. The jsonl format has stable
+snake_case fields (id, time, session_id, user, action, database, table,
+details) and is meant for shipping into a SIEM or log pipeline.
+
+EXAMPLE:
+  audit --action=delete --db=prod --since=7d --limit=0 --format=jsonl
+  audit --denied --since=1d
+  audit prune --older-than=365d`,
+
+		"status": `status - Show a server health snapshot (admin)
+
+USAGE:
+  status [--format=json]
+
+Reports version, uptime, the number of discovered databases, active SSH
+sessions, held write locks and the on-disk size of the history database.
+Sessions and history are only available in SSH server mode.`,
+
+		"host-key": `host-key - List and rotate SSH host keys (admin, SSH mode)
+
+USAGE:
+  host-key [list] [--format=json]
+  host-key rotate [--type=ed25519|rsa|ecdsa] [--grace=7d]
+
+Only one key per type is served. rotate generates a replacement for the
+host key of --type (default: the first configured key) and keeps serving
+the current key until the grace period ends, so the new key can be added to
+clients' known_hosts first. The old key is then kept as <path>.old.
+--grace=0 switches immediately.
+
+EXAMPLES:
+  host-key
+  host-key rotate --grace=14d
+  host-key rotate --type=rsa --grace=0`,
+
+		"bans": `bans - List and clear IP bans (admin)
+
+USAGE:
+  bans [list] [--all] [--format=json]
+  bans clear <ip>
+  bans clear --all
+
+Failed public-key logins are recorded per IP. With auth_bans.max_failures
+set, an IP reaching that many failures within auth_bans.window is refused
+for auth_bans.duration. --all also lists expired bans. Clearing a ban also
+forgets the IP's recorded failures.
+
+EXAMPLES:
+  bans
+  bans clear 203.0.113.7`,
+
+		"rescan": `rescan - Scan database sources for new and removed files (admin)
+
+USAGE:
+  rescan [--format=json]
+
+Sources are watched for changes, but notifications can go missing, e.g. on
+NFS or in containers. rescan looks for new and removed databases now and
+lists them, + for added and - for removed. Set discovery.rescan_interval
+to rescan on a timer instead.
+
+EXAMPLES:
+  rescan`,
+
+		"web-login": `web-login - Sign in to the web viewer (SSH mode)
+
+USAGE:
+  web-login
+
+Prints a link that signs a browser in to the read-only web viewer as the
+current user. The link is valid for 10 minutes and works once; the
+browser then stays signed in for 12 hours. Requires server.web.listen to be set.
+Anonymous users can browse the web viewer without signing in.`,
+
+		"api-token": `api-token - Get a token for the gRPC API (SSH mode)
+
+USAGE:
+  api-token
+
+Prints a token that authenticates gRPC API calls as the current user,
+sent as "authorization: Bearer <token>" metadata. It is valid for 30
+days, and only while the user is configured and connects from an address
+their from rules allow. Requires server.api.listen to be set. The API is
+defined in apipb/api.proto.`,
+
+		"sudo": `sudo - Run one command as admin
+
+USAGE:
+  sudo --reason="..." <command> [args...]
+
+For users with can_sudo in the config. Runs a single command with admin
+access, so rare incidents don't need a permanent admin grant. The reason is
+required; in an interactive session you are asked for it if --reason is
+missing. Every use is audited as SUDO with the command and reason before
+the command runs.
+
+EXAMPLES:
+  sudo --reason="INC-142 stuck lock" locks release mydb
+  sudo --reason="GDPR request 77" delete mydb users --where="id = 5" --confirm`,
+
+		"totp": `totp - Enroll in a TOTP second factor
+
+USAGE:
+  totp new
+
+Generates a TOTP secret and an otpauth:// URI for an authenticator app. An
+admin then sets totp_secret for the user in the config.
+
+Once enrolled, delete, drop-table, truncate, download, upload and queries
+containing DROP or DELETE need a 6-digit code: pass --totp=CODE, or type it when
+prompted in an interactive session. Each code is accepted once. Failed
+codes are audited as TOTP_DENIED.
+
+EXAMPLES:
+  totp new
+  delete mydb users --where="id = 5" --confirm --totp=123456`,
+
+		"health": `health - Run health checks
+
+USAGE:
+  health [--format=json]
+
+Checks that database discovery is running, the history database is
+writable (SSH server mode) and a sample database opens. Exits with 1 if
+any check fails. Check details are only shown to admins.
+
+The same report is served over HTTP at /healthz when server.health.listen
+is configured (200 when healthy, 503 otherwise).`,
+
+		"checksum": `checksum - Checksum table contents
+
+USAGE:
+  checksum <database> [table...] [--format=json]
+
+Computes a SHA-256 over each table's column names and rows, read in
+primary key order. The result doesn't depend on physical row order, so
+running checksum on a replica or backup and diffing the output shows which
+tables differ. All tables are checksummed when none are given.
+
+EXAMPLES:
+  checksum mydb
+  checksum mydb users orders --no-header`,
+
+		"check": `check - Check database integrity
+
+USAGE:
+  check <database> [options]
+
+OPTIONS:
+  --quick          Run quick_check, which skips matching indexes to tables
+  --format=json    Output in JSON format
+
+Runs PRAGMA integrity_check one table at a time, printing progress to
+stderr on large databases. Prints "ok" or the problems found (at most
+100) and exits with 4 if there are any. Checking by table skips the
+search for unused pages that a whole-database integrity_check does.
+
+EXAMPLES:
+  check mydb
+  check mydb --quick --format=json`,
+
+		"size": `size - Show on-disk size per table and index
+
+USAGE:
+  size <database> [options]
+
+OPTIONS:
+  --sort=size      Sort by size (default), pages, name or type
+  --reverse        Reverse the sort order
+  --format=json    Output in JSON format
+
+Sizes come from the dbstat virtual table. When dbstat is not available
+they are estimated from the payload length of each row.
+
+EXAMPLES:
+  size mydb
+  size mydb --sort=name --format=json`,
+
 		"query": `query - Execute SQL query
 
 USAGE:
   query <database> "<sql>" [options]
 
 OPTIONS:
-  --format=json    Output results as JSON
-  --format=csv     Output results as CSV
-  --format=table   Output results as table (default)
+  --format=json       Output results as JSON
+  --format=csv        Output results as CSV
+  --format=tsv        Output results as TSV
+  --format=table      Output results as aligned table (default)
+  --no-header         Omit the header row
+  --max-col-width=N   Truncate cells wider than N columns (default 50, 0 = off)
+  --attach=db[:name]  Attach other databases for this query (comma-separated)
+  --snapshot          Run a read-only query on a temporary copy of the database
+
+Attached databases are read-only unless you have write access to them.
+Write queries require write access to every attached database.
+
+--snapshot reads a copy of the database (VACUUM INTO), so a long analytical
+query doesn't hold up writers. Copies are shared for up to a minute; taking
+a new one needs the write lock, as a write does (see --wait).
 
 EXAMPLES:
   query mydb "SELECT * FROM users"
-  query mydb "SELECT * FROM users WHERE active=1" --format=json`,
+  query mydb "SELECT * FROM users WHERE active=1" --format=json
+  query mydb "SELECT u.name, o.total FROM users u JOIN shop.orders o ON o.user_id = u.id" --attach=orders:shop
+  query mydb "SELECT country, count(*) FROM events GROUP BY 1" --snapshot`,
 
 		"select": `select - Browse table data
 
@@ -133,12 +551,38 @@ OPTIONS:
   --offset=N               Skip N rows
   --format=json            Output as JSON
   --format=csv             Output as CSV
+  --format=tsv             Output as TSV
+  --no-header              Omit the header row
+  --no-cap                 Lift max_export_rows (admins only)
 
 EXAMPLES:
   select mydb users
   select mydb users --limit=10 --format=json
   select mydb users --where="active=1" --columns="id,name"`,
 
+		"tail": `tail - Print a table's last rows and follow changes
+
+USAGE:
+  tail <database> <table> [options]
+
+OPTIONS:
+  --lines=N        Rows to print (default: 10)
+  --follow         Keep printing rows as they are added or updated
+  --format=json    Output as JSON (JSON lines with --follow)
+  --no-header      Omit the header row
+
+Rows are ordered by rowid, or by the primary key of a WITHOUT ROWID
+table. With --follow, rows past the last key are printed as they are
+added, and rows whose updated_at (or modified_at) column moves past the
+latest seen are printed as updated; JSON lines say which ("op"). Deleted
+rows aren't reported. Followed rows are printed as TSV, and the command
+runs until the client disconnects.
+
+EXAMPLES:
+  tail mydb events
+  tail mydb events --lines=50 --follow
+  tail mydb orders --follow --format=json`,
+
 		"export": `export - Export table data
 
 USAGE:
@@ -146,11 +590,17 @@ USAGE:
 
 OPTIONS:
   --format=csv     Export as CSV (default)
+  --format=tsv     Export as TSV
   --format=json    Export as JSON
+  --no-header      Omit the header row
+  --no-cap         Lift max_export_rows (admins only)
 
 OUTPUT:
   Data is written to stdout. Redirect to a file:
-  ssh host export mydb users --format=csv > users.csv`,
+  ssh host export mydb users --format=csv > users.csv
+
+  In local mode --output=PATH writes the file directly. It is written to a
+  temporary file first and renamed into place only if the export succeeds.`,
 
 		"download": `download - Download raw database file
 
@@ -163,6 +613,20 @@ Requires at least read access to the database.
 EXAMPLE:
   ssh host download mydb > mydb.db`,
 
+		"upload": `upload - Replace a database with a file from stdin
+
+USAGE:
+  upload <database> < file.db
+
+Reads a SQLite database from stdin and replaces the database with it. The
+file must have a valid SQLite header and pass PRAGMA integrity_check. It is
+written next to the database first and moved into place under the write
+lock, so readers never see a partial file.
+Requires write access to the database.
+
+EXAMPLE:
+  ssh host upload staging < local.db`,
+
 		"insert": `insert - Insert a row
 
 USAGE:
@@ -188,10 +652,58 @@ EXAMPLE:
 USAGE:
   delete <database> <table> --where="condition" --confirm
 
-The --confirm or --force flag is required to prevent accidental deletes.
+When run from a terminal without --confirm you are asked to type the table
+name to confirm. Non-interactive use requires --confirm or --force.
 
 EXAMPLE:
   delete mydb users --where="id=1" --confirm`,
+
+		"truncate": `truncate - Delete all rows of a table
+
+USAGE:
+  truncate <database> <table> --confirm
+
+When run from a terminal without --confirm you are asked to type the table
+name to confirm. Non-interactive use requires --confirm.
+
+EXAMPLE:
+  truncate mydb sessions --confirm`,
+
+		"approvals": `approvals - Two-person approval of destructive commands
+
+USAGE:
+  approvals [list] [--all] [--format=json]
+  approvals approve <id>
+  approvals deny <id>
+
+Commands listed under approvals.commands in the config (for example
+drop-table and truncate) don't run when a non-admin issues them. They are
+stored as pending requests instead, which an admin approves or denies. An
+approved command runs immediately, in the admin's session; each request
+runs at most once. Requests, approvals and denials are audited.
+
+SQL doing the same needs the same approval: with drop-table listed, any
+DROP statement, and with truncate, any DELETE without a WHERE clause. From
+query and the TUI such SQL becomes a pending query request; other clients
+get an error.
+
+Admins see every pending request; other users see their own. --all also
+shows decided requests.
+
+EXAMPLES:
+  approvals
+  approvals approve 12`,
+
+		"drop-table": `drop-table - Drop a table
+
+USAGE:
+  drop-table <database> <table> --confirm
+
+When run from a terminal without --confirm you are asked to type the table
+name to confirm. Non-interactive use requires --confirm.
+
+EXAMPLE:
+  drop-table mydb old_users --confirm`,
 	}
 
 	if h, ok := help[command]; ok {
@@ -218,16 +730,23 @@ func printJSON(w io.Writer, v any) {
 	enc.Encode(v)
 }
 
-// printCSV writes CSV-like output.
+// printJSONLine writes v as compact JSON followed by a newline.
+func printJSONLine(w io.Writer, v any) {
+	json.NewEncoder(w).Encode(v)
+}
+
+// printCSV writes CSV-like output. Headers are skipped when nil.
 func printCSV(w io.Writer, headers []string, rows [][]string) {
 	// Print headers
-	for i, h := range headers {
-		if i > 0 {
-			fmt.Fprint(w, ",")
+	if headers != nil {
+		for i, h := range headers {
+			if i > 0 {
+				fmt.Fprint(w, ",")
+			}
+			fmt.Fprint(w, escapeCSV(h))
 		}
-		fmt.Fprint(w, escapeCSV(h))
+		fmt.Fprintln(w)
 	}
-	fmt.Fprintln(w)
 
 	// Print rows
 	for _, row := range rows {
@@ -241,6 +760,29 @@ func printCSV(w io.Writer, headers []string, rows [][]string) {
 	}
 }
 
+// tsvReplacer escapes characters that would break a TSV record.
+var tsvReplacer = strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`)
+
+// printTSV writes tab-separated output with one record per line. Tabs,
+// newlines and backslashes inside values are backslash-escaped so every
+// line can be split on tabs safely. Headers are skipped when nil.
+func printTSV(w io.Writer, headers []string, rows [][]string) {
+	if headers != nil {
+		printTSVLine(w, headers)
+	}
+	for _, row := range rows {
+		printTSVLine(w, row)
+	}
+}
+
+func printTSVLine(w io.Writer, values []string) {
+	escaped := make([]string, len(values))
+	for i, v := range values {
+		escaped[i] = tsvReplacer.Replace(v)
+	}
+	fmt.Fprintln(w, strings.Join(escaped, "\t"))
+}
+
 // escapeCSV escapes a value for CSV output.
 func escapeCSV(s string) string {
 	needsQuotes := false
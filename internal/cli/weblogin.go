@@ -0,0 +1,37 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/johan-st/sqlite-tui/internal/server"
+)
+
+// cmdWebLogin prints a link that signs a browser in to the web viewer as
+// the current user.
+func (h *Handler) cmdWebLogin(ctx *CommandContext) {
+	if ctx.Session == nil {
+		fmt.Fprintln(ctx.Err, "web-login is only available in SSH server mode")
+		ctx.Exit(ExitUsage)
+		return
+	}
+
+	webServer := server.GetWebFromSSH(ctx.Session)
+	if webServer == nil {
+		fmt.Fprintln(ctx.Err, "The web viewer is not enabled (set server.web.listen)")
+		ctx.Exit(ExitUsage)
+		return
+	}
+
+	link, err := webServer.LoginURL(ctx.User)
+	if err != nil {
+		fmt.Fprintf(ctx.Err, "Error: %v\n", err)
+		ctx.Exit(ExitAccessDenied)
+		return
+	}
+
+	if h.historyStore != nil {
+		h.historyStore.RecordAuditSimple(ctx.GetSessionID(), "WEB_LOGIN", "", "", nil)
+	}
+
+	fmt.Fprintln(ctx.Out, link)
+}
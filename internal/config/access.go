@@ -6,13 +6,29 @@ import "github.com/johan-st/sqlite-tui/internal/access"
 type AccessRule struct {
 	Pattern string `yaml:"pattern"`
 	Level   string `yaml:"level"`
+
+	// From limits the rule to clients connecting from these addresses or
+	// CIDR ranges, e.g. "10.8.0.0/16"
+	From []string `yaml:"from"`
+
+	// AllowDownload set to false forbids downloading the raw file while
+	// still allowing queries and exports. Defaults to true
+	AllowDownload *bool `yaml:"allow_download"`
+
+	// Visibility is "hidden" to leave matching databases out of listings
+	// (they open by name only), or "listed" to list them even when the
+	// level doesn't allow opening them
+	Visibility string `yaml:"visibility"`
 }
 
 // ToAccessRule converts a config AccessRule to an access.Rule.
 func (r AccessRule) ToAccessRule() access.Rule {
 	return access.Rule{
-		Pattern: r.Pattern,
-		Level:   access.ParseLevel(r.Level),
+		Pattern:    r.Pattern,
+		Level:      access.ParseLevel(r.Level),
+		From:       r.From,
+		NoDownload: r.AllowDownload != nil && !*r.AllowDownload,
+		Visibility: access.ParseVisibility(r.Visibility),
 	}
 }
 
@@ -21,19 +37,95 @@ type User struct {
 	Name       string       `yaml:"name"`
 	Admin      bool         `yaml:"admin"`
 	PublicKeys []string     `yaml:"public_keys"`
+	Principals []string     `yaml:"principals"`
 	Access     []AccessRule `yaml:"access"`
+
+	// From limits where the user may connect from: addresses or CIDR
+	// ranges; empty allows any
+	From []string `yaml:"from"`
+
+	// Groups the user belongs to, in addition to groups listing the user
+	// as a member. Group rules are checked after the user's own rules
+	Groups []string `yaml:"groups"`
+
+	// Commands lists the CLI commands the user may run, e.g. query, select
+	// and export; empty allows all. help, version and whoami are always
+	// allowed
+	Commands []string `yaml:"commands"`
+
+	// TOTPSecret enrolls the user in a second factor: a base32 secret (see
+	// the "totp new" command) whose codes are required for destructive
+	// operations
+	TOTPSecret string `yaml:"totp_secret"`
+
+	// CanSudo lets the user run single commands as an admin with "sudo",
+	// giving a reason that is audited
+	CanSudo bool `yaml:"can_sudo"`
+
+	// RowFilters limit the rows the user sees in some tables
+	RowFilters []RowFilter `yaml:"row_filters"`
+
+	// PublicKeysFile is an authorized_keys file with more keys for the
+	// user, read when the config is loaded or reloaded
+	PublicKeysFile string `yaml:"public_keys_file"`
+
+	// PublicKeysFrom fetches more keys from a code host, e.g. "github:alice"
+	// or "gitlab:alice"
+	PublicKeysFrom string `yaml:"public_keys_from"`
+
+	// Internal: keys read from PublicKeysFile
+	fileKeys []string
+}
+
+// AllPublicKeys returns the user's inline keys followed by the keys read
+// from their public_keys_file.
+func (u *User) AllPublicKeys() []string {
+	if len(u.fileKeys) == 0 {
+		return u.PublicKeys
+	}
+	keys := make([]string, 0, len(u.PublicKeys)+len(u.fileKeys))
+	keys = append(keys, u.PublicKeys...)
+	return append(keys, u.fileKeys...)
+}
+
+// Group gives a set of users the same access rules.
+type Group struct {
+	Name    string       `yaml:"name"`
+	Members []string     `yaml:"members"`
+	Access  []AccessRule `yaml:"access"`
+}
+
+// RowFilter restricts a user to the rows of a table matching a WHERE
+// predicate, e.g. "tenant_id = 42".
+type RowFilter struct {
+	Database string `yaml:"database"`
+	Table    string `yaml:"table"`
+	Where    string `yaml:"where"`
+}
+
+// ToRowFilter converts a config RowFilter to an access.RowFilter.
+func (f RowFilter) ToRowFilter() access.RowFilter {
+	return access.RowFilter{
+		Pattern: f.Database,
+		Table:   f.Table,
+		Where:   f.Where,
+	}
 }
 
 // PublicDatabase defines a publicly accessible database pattern.
 type PublicDatabase struct {
-	Pattern string `yaml:"pattern"`
-	Level   string `yaml:"level"`
+	Pattern       string `yaml:"pattern"`
+	Level         string `yaml:"level"`
+	AllowDownload *bool  `yaml:"allow_download"`
+	Visibility    string `yaml:"visibility"`
 }
 
 // ToAccessRule converts a PublicDatabase to an access.Rule.
 func (p PublicDatabase) ToAccessRule() access.Rule {
 	return access.Rule{
-		Pattern: p.Pattern,
-		Level:   access.ParseLevel(p.Level),
+		Pattern:    p.Pattern,
+		Level:      access.ParseLevel(p.Level),
+		NoDownload: p.AllowDownload != nil && !*p.AllowDownload,
+		Visibility: access.ParseVisibility(p.Visibility),
 	}
 }
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 
@@ -23,15 +25,57 @@ type Config struct {
 	// Anonymous access level (none, read-only, read-write)
 	AnonymousAccess string `yaml:"anonymous_access"`
 
+	// Per-session caps for anonymous users
+	AnonymousQuota AnonymousQuotaConfig `yaml:"anonymous_quota"`
+
 	// Allow keyless SSH connections
 	AllowKeyless bool `yaml:"allow_keyless"`
 
+	// Allow raw database file downloads at all (default true)
+	AllowRawDownload *bool `yaml:"allow_raw_download"`
+
 	// Users and their access rules
 	Users []User `yaml:"users"`
 
+	// Groups of users sharing access rules
+	Groups []Group `yaml:"groups"`
+
+	// SSH certificate authorities trusted to sign user certificates
+	CertAuthorities []string `yaml:"cert_authorities"`
+
 	// Public databases (accessible without auth)
 	Public []PublicDatabase `yaml:"public"`
 
+	// Rate limits for SSH clients
+	RateLimits RateLimitConfig `yaml:"rate_limits"`
+
+	// Query rate and row caps by access level
+	QueryLimits QueryLimitsConfig `yaml:"query_limits"`
+
+	// Caps on simultaneous SSH sessions
+	SessionLimits SessionLimitConfig `yaml:"session_limits"`
+
+	// Temporary bans for IPs with repeated authentication failures
+	AuthBans AuthBanConfig `yaml:"auth_bans"`
+
+	// Server log output
+	Log LogConfig `yaml:"log"`
+
+	// OpenTelemetry trace export
+	Tracing TracingConfig `yaml:"tracing"`
+
+	// Commands run on events such as session starts and writes
+	Hooks HooksConfig `yaml:"hooks"`
+
+	// Commands that need an admin's approval before they run
+	Approvals ApprovalsConfig `yaml:"approvals"`
+
+	// Bounds on the database connections kept open
+	Connections ConnectionsConfig `yaml:"connections"`
+
+	// How database sources are watched for new files
+	Discovery DiscoveryConfig `yaml:"discovery"`
+
 	// Internal: path to the config file
 	path string
 
@@ -43,17 +87,231 @@ type Config struct {
 
 // ServerConfig contains server-related configuration.
 type ServerConfig struct {
-	SSH   SSHConfig   `yaml:"ssh"`
-	Local LocalConfig `yaml:"local"`
+	SSH    SSHConfig    `yaml:"ssh"`
+	Local  LocalConfig  `yaml:"local"`
+	Health HealthConfig `yaml:"health"`
+	Web    WebConfig    `yaml:"web"`
+	API    APIConfig    `yaml:"api"`
+}
+
+// RateLimitConfig contains per-client rate limits. Zero disables a limit.
+type RateLimitConfig struct {
+	// ConnectionsPerMinute limits SSH sessions per remote IP
+	ConnectionsPerMinute int `yaml:"connections_per_minute"`
+	// QueriesPerMinute limits CLI commands and TUI queries per user
+	// (per IP for anonymous users)
+	QueriesPerMinute int `yaml:"queries_per_minute"`
+}
+
+// QueryLimitsConfig caps queries by the user's access level to the
+// database. Anonymous users get the anonymous limits whatever their level;
+// admins are never limited.
+type QueryLimitsConfig struct {
+	Anonymous QueryLimit `yaml:"anonymous"`
+	ReadOnly  QueryLimit `yaml:"read-only"`
+	ReadWrite QueryLimit `yaml:"read-write"`
+}
+
+// QueryLimit caps queries run through the database manager. Zero disables
+// a limit.
+type QueryLimit struct {
+	// QueriesPerMinute limits queries per user (per IP for anonymous users)
+	QueriesPerMinute int `yaml:"queries_per_minute"`
+	// MaxRows caps the rows a query returns; further rows aren't read
+	MaxRows int `yaml:"max_rows"`
+	// MaxResultBytes caps the size of a query's result, 64 MiB by default
+	// at every level; -1 lifts the cap
+	MaxResultBytes int64 `yaml:"max_result_bytes"`
+	// MaxExportRows caps the rows one select or export returns
+	MaxExportRows int `yaml:"max_export_rows"`
+	// Timeout stops queries running longer than this (e.g. "30s")
+	Timeout string `yaml:"timeout"`
+}
+
+// GetTimeout parses and returns the query timeout, 0 for none.
+func (q QueryLimit) GetTimeout() time.Duration {
+	return parseTimeout(q.Timeout)
+}
+
+// ApprovalsConfig lists CLI commands that non-admin users can only request.
+// The request is stored until an admin approves it, which runs the command.
+type ApprovalsConfig struct {
+	Commands []string `yaml:"commands"`
+}
+
+// AnonymousQuotaConfig caps what a single anonymous SSH session may do,
+// so public databases can't be dumped wholesale. Zero disables a limit.
+type AnonymousQuotaConfig struct {
+	// MaxQueries limits CLI commands and TUI queries per session
+	MaxQueries int `yaml:"max_queries"`
+	// MaxRows limits the rows a session fetches in total
+	MaxRows int `yaml:"max_rows"`
+	// MaxDuration disconnects the session after this long (e.g. "15m")
+	MaxDuration string `yaml:"max_duration"`
+}
+
+// SessionLimitConfig caps simultaneous sessions. Zero disables a limit.
+type SessionLimitConfig struct {
+	// PerUser limits sessions per authenticated user name (admins exempt)
+	PerUser int `yaml:"per_user"`
+	// PerKey limits sessions per public key fingerprint (admins exempt)
+	PerKey int `yaml:"per_key"`
+	// PerAnonymousIP limits anonymous sessions per remote IP
+	PerAnonymousIP int `yaml:"per_anonymous_ip"`
+}
+
+// AuthBanConfig bans IPs that fail authentication too often.
+type AuthBanConfig struct {
+	// MaxFailures is the number of failures within Window that gets an IP
+	// banned; zero disables bans (failures are still recorded)
+	MaxFailures int `yaml:"max_failures"`
+	// Window is how far back failures are counted, default 10m
+	Window string `yaml:"window"`
+	// Duration is how long a ban lasts, default 1h
+	Duration string `yaml:"duration"`
+}
+
+// ConnectionsConfig bounds the database connections the server keeps open,
+// so discovering many databases doesn't hold a file handle for each forever.
+type ConnectionsConfig struct {
+	// IdleTimeout closes connections unused for this long, default 10m;
+	// "0" keeps them open until shutdown
+	IdleTimeout string `yaml:"idle_timeout"`
+	// MaxOpen caps the connections open at once; opening another closes
+	// the least recently used. Zero means no cap
+	MaxOpen int `yaml:"max_open"`
+	// LockTTL releases write locks whose holder showed no sign of life for
+	// this long and whose session is gone, default 10m; "0" never does
+	LockTTL string `yaml:"lock_ttl"`
+}
+
+// DiscoveryConfig contains the database discovery settings.
+type DiscoveryConfig struct {
+	// RescanInterval rescans all sources this often, for file systems
+	// where change notifications are unreliable, such as NFS or bind
+	// mounts in containers. Empty or "0" relies on notifications alone
+	RescanInterval string `yaml:"rescan_interval"`
+}
+
+// LogConfig contains the server log settings.
+type LogConfig struct {
+	// Format is "text" or "json"
+	Format string `yaml:"format"`
+	// Level is debug, info, warn or error; changes apply on reload
+	Level string `yaml:"level"`
+	// Syslog also sends logs to syslog: "local" for the local daemon (and
+	// so journald on systemd hosts), or "udp://host:port" / "tcp://host:port"
+	Syslog string `yaml:"syslog"`
+	// SyslogTag is the program name in syslog entries, "sqlite-tui" if empty
+	SyslogTag string `yaml:"syslog_tag"`
+}
+
+// TracingConfig contains the OpenTelemetry trace export settings.
+type TracingConfig struct {
+	// Endpoint is the OTLP/HTTP collector URL, e.g. http://localhost:4318;
+	// spans are posted to its /v1/traces. Empty disables tracing.
+	Endpoint string `yaml:"endpoint"`
+	// Headers are sent with every export, e.g. for authentication
+	Headers map[string]string `yaml:"headers"`
+	// ServiceName is the service.name of the spans, "sqlite-tui" if empty
+	ServiceName string `yaml:"service_name"`
+}
+
+// HooksConfig lists the commands run for each event. Each command is run
+// with sh -c and receives the event as JSON on stdin.
+type HooksConfig struct {
+	// Timeout bounds each command's run time, "10s" if empty
+	Timeout        string   `yaml:"timeout"`
+	OnSessionStart []string `yaml:"on_session_start"`
+	OnSessionEnd   []string `yaml:"on_session_end"`
+	// OnWrite runs after data or schema changes
+	OnWrite    []string `yaml:"on_write"`
+	OnDownload []string `yaml:"on_download"`
+	OnUpload   []string `yaml:"on_upload"`
+	// OnBan runs when an IP is banned for failed logins
+	OnBan []string `yaml:"on_ban"`
+	// OnAudit runs for every audit log entry
+	OnAudit []string `yaml:"on_audit"`
+	// OnChange runs for each row the change feed finds added or updated
+	// in the Watch tables, "database/table" with the database's alias or
+	// path. Unlike on_write it sees writes by other processes too.
+	OnChange []string `yaml:"on_change"`
+	Watch    []string `yaml:"watch"`
+}
+
+// WebConfig contains the read-only web viewer configuration.
+type WebConfig struct {
+	// Listen is the address serving the web viewer; empty disables it
+	Listen string `yaml:"listen"`
+	// URL is the viewer's address as users reach it, used in login links;
+	// defaults to http://<listen>
+	URL string `yaml:"url"`
+}
+
+// APIConfig contains the gRPC API configuration.
+type APIConfig struct {
+	// Listen is the address serving the API; empty disables it
+	Listen string `yaml:"listen"`
+	// TLSCert and TLSKey are PEM files; without them the API is served in
+	// plain text, which is only allowed on a loopback address
+	TLSCert string `yaml:"tls_cert"`
+	TLSKey  string `yaml:"tls_key"`
+}
+
+// HealthConfig contains the HTTP health endpoint configuration.
+type HealthConfig struct {
+	// Listen is the address serving /healthz; empty disables the endpoint
+	Listen string `yaml:"listen"`
 }
 
 // SSHConfig contains SSH server configuration.
 type SSHConfig struct {
-	Enabled     bool   `yaml:"enabled"`
-	Listen      string `yaml:"listen"`
-	HostKeyPath string `yaml:"host_key_path"`
-	IdleTimeout string `yaml:"idle_timeout"`
+	Enabled bool `yaml:"enabled"`
+	// Listen is one address or a list; "unix:/path" listens on a unix socket
+	Listen      ListenAddrs `yaml:"listen"`
+	HostKeyPath string      `yaml:"host_key_path"`
+	// HostKeys are more host key files, e.g. an RSA key for older clients.
+	// Missing keys are generated with the type named in the file name
+	// (rsa, ecdsa), ed25519 otherwise
+	HostKeys    []string `yaml:"host_keys"`
+	IdleTimeout string   `yaml:"idle_timeout"`
+	// IdleWarning is how long before the idle timeout sessions are warned
+	// they will be disconnected; "0" disables the warning
+	IdleWarning string `yaml:"idle_warning"`
 	MaxTimeout  string `yaml:"max_timeout"`
+
+	// SFTP enables the sftp subsystem for downloading (and, for admins,
+	// uploading) database files with sftp or scp
+	SFTP bool `yaml:"sftp"`
+	// UploadDir is where admins may upload new databases over SFTP;
+	// empty allows replacing existing databases only
+	UploadDir string `yaml:"upload_dir"`
+
+	// KeyRefresh is how often keys from public_keys_from are re-fetched
+	KeyRefresh string `yaml:"key_refresh"`
+}
+
+// ListenAddrs is a list of listen addresses that may be written as a single
+// string in YAML.
+type ListenAddrs []string
+
+// UnmarshalYAML accepts a string or a list of strings.
+func (l *ListenAddrs) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*l = ListenAddrs{value.Value}
+		return nil
+	}
+	var addrs []string
+	if err := value.Decode(&addrs); err != nil {
+		return err
+	}
+	*l = addrs
+	return nil
+}
+
+// String joins the addresses for display.
+func (l ListenAddrs) String() string {
+	return strings.Join(l, ", ")
 }
 
 // LocalConfig contains local mode configuration.
@@ -67,6 +325,146 @@ type DatabaseSource struct {
 	Alias       string `yaml:"alias"`
 	Description string `yaml:"description"`
 	Recursive   bool   `yaml:"recursive"`
+
+	// LockPolicy decides what a write does when another session holds the
+	// write lock: "fail" (default) errors at once, "wait" queues for up to
+	// LockTimeout, "none" skips the lock and relies on SQLite's busy timeout.
+	// Transactions lock under "none" too, and writes fail while one is open
+	LockPolicy  string `yaml:"lock_policy"`
+	LockTimeout string `yaml:"lock_timeout"`
+
+	// QueryTimeout stops queries on these databases running longer than
+	// this, for every user (e.g. "10s")
+	QueryTimeout string `yaml:"query_timeout"`
+
+	// MaxReaders caps the read-only connections kept open per database for
+	// concurrent readers; writes use one connection of their own (default 4)
+	MaxReaders int `yaml:"max_readers"`
+
+	// Connection settings, applied to every connection opened on these
+	// databases. JournalMode is "wal", "delete", "truncate",
+	// "persist", "memory", "off" or "keep" (default) to leave the file's own;
+	// Synchronous is "normal" (default), "off", "full" or "extra";
+	// BusyTimeout is how long SQLite waits for a lock (default "5s");
+	// CacheSize is PRAGMA cache_size, pages or -KiB; ForeignKeys enforces
+	// foreign keys, off by default as in SQLite. ReadOnly opens the files
+	// read-only, e.g. on read-only media, and limits every user to read
+	// access
+	JournalMode string `yaml:"journal_mode"`
+	Synchronous string `yaml:"synchronous"`
+	BusyTimeout string `yaml:"busy_timeout"`
+	CacheSize   int    `yaml:"cache_size"`
+	ForeignKeys bool   `yaml:"foreign_keys"`
+	ReadOnly    bool   `yaml:"read_only"`
+
+	// Immutable opens the files with immutable=1 for databases known never
+	// to change, such as archives: SQLite skips all locking, so reads never
+	// wait. Implies ReadOnly
+	Immutable bool `yaml:"immutable"`
+
+	// BusyRetries is how often a statement is retried, with growing waits,
+	// when another process briefly holds the database file, instead of
+	// failing with "database is locked" (default 5, -1 to never retry).
+	// Retries stop at the query timeout
+	BusyRetries int `yaml:"busy_retries"`
+
+	// Detect decides which files in a directory or glob are databases:
+	// "header" (default) those starting with the SQLite header, whatever
+	// their name; "extension" those named .db, .sqlite, .sqlite3 or .db3,
+	// without reading them; "both" those so named that also start with the
+	// header
+	Detect string `yaml:"detect"`
+
+	// Extensions are more extensions database files of this source are
+	// named with, such as ".data", or "" for files without one
+	Extensions []string `yaml:"extensions"`
+
+	// Exclude leaves out files of a directory or glob matching any of
+	// these globs, such as backups and temp copies: a pattern without a
+	// slash matches the name of a file or of a directory it is in, e.g.
+	// "*_backup.db" or "node_modules"; others match the path relative to
+	// the directory, e.g. "tmp/**"
+	Exclude []string `yaml:"exclude"`
+
+	// Attach names companion databases, by path or alias, to attach to
+	// these databases under a schema name, e.g. archive: archive.db, so
+	// split datasets can be queried together as archive.table. Relative
+	// paths are relative to the database. Each is attached read-only, for
+	// users who can read it
+	Attach map[string]string `yaml:"attach"`
+
+	// Key decrypts these databases, or KeyFile names a file holding the
+	// key, for encrypted databases such as SQLCipher's. Opening them needs
+	// a build with a driver that supports encryption. Files are found by
+	// extension, as encrypted files have no SQLite header
+	Key     string `yaml:"key"`
+	KeyFile string `yaml:"key_file"`
+}
+
+// Ways of telling database files apart, see DatabaseSource.Detect.
+const (
+	DetectHeader    = "header"
+	DetectExtension = "extension"
+	DetectBoth      = "both"
+)
+
+// GetQueryTimeout parses and returns the source's query timeout, 0 for
+// none.
+func (s *DatabaseSource) GetQueryTimeout() time.Duration {
+	return parseTimeout(s.QueryTimeout)
+}
+
+// GetBusyTimeout parses and returns the source's busy timeout, 0 for the
+// default.
+func (s *DatabaseSource) GetBusyTimeout() time.Duration {
+	return parseTimeout(s.BusyTimeout)
+}
+
+// parseTimeout parses a timeout setting; empty or invalid means none.
+func parseTimeout(s string) time.Duration {
+	if s == "" {
+		return 0
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0
+	}
+	return d
+}
+
+// GetKey returns the source's encryption key, read from KeyFile unless
+// Key is set, or "" for unencrypted databases.
+func (s *DatabaseSource) GetKey() (string, error) {
+	if s.Key != "" || s.KeyFile == "" {
+		return s.Key, nil
+	}
+	data, err := os.ReadFile(s.KeyFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read key file: %w", err)
+	}
+	key := strings.TrimSpace(string(data))
+	if key == "" {
+		return "", fmt.Errorf("key file %s is empty", s.KeyFile)
+	}
+	return key, nil
+}
+
+// Encrypted reports whether the source's databases are encrypted.
+func (s *DatabaseSource) Encrypted() bool {
+	return s.Key != "" || s.KeyFile != ""
+}
+
+// GetLockTimeout returns how long writes wait for the lock under the "wait"
+// policy.
+func (s *DatabaseSource) GetLockTimeout() time.Duration {
+	if s.LockTimeout == "" {
+		return 30 * time.Second
+	}
+	d, err := time.ParseDuration(s.LockTimeout)
+	if err != nil || d <= 0 {
+		return 30 * time.Second
+	}
+	return d
 }
 
 // DefaultConfig returns a configuration with sensible defaults.
@@ -76,10 +474,11 @@ func DefaultConfig() *Config {
 		Server: ServerConfig{
 			SSH: SSHConfig{
 				Enabled:     true,
-				Listen:      ":2222",
+				Listen:      ListenAddrs{":2222"},
 				HostKeyPath: ".sqlite-tui/host_key",
 				IdleTimeout: "30m",
 				MaxTimeout:  "24h",
+				KeyRefresh:  "1h",
 			},
 			Local: LocalConfig{
 				Enabled: true,
@@ -90,6 +489,10 @@ func DefaultConfig() *Config {
 		AllowKeyless:    false,
 		Users:           []User{},
 		Public:          []PublicDatabase{},
+		Log: LogConfig{
+			Format: "text",
+			Level:  "info",
+		},
 	}
 }
 
@@ -112,6 +515,10 @@ func Load(path string) (*Config, error) {
 
 	cfg.path = absPath
 
+	if err := cfg.loadKeyFiles(); err != nil {
+		return nil, err
+	}
+
 	// Get file modification time
 	info, err := os.Stat(absPath)
 	if err == nil {
@@ -128,29 +535,46 @@ func (c *Config) Path() string {
 	return c.path
 }
 
-// Reload reloads the configuration from disk.
-func (c *Config) Reload() error {
+// Reload reloads the configuration from disk and describes what changed.
+// Only access, users, databases and the log level apply without a restart.
+func (c *Config) Reload() ([]string, error) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
 	data, err := os.ReadFile(c.path)
 	if err != nil {
-		return fmt.Errorf("failed to read config file: %w", err)
+		return nil, fmt.Errorf("failed to read config file: %w", err)
 	}
 
 	newCfg := DefaultConfig()
 	if err := yaml.Unmarshal(data, newCfg); err != nil {
-		return fmt.Errorf("failed to parse config file: %w", err)
+		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	}
+	newCfg.path = c.path
+	if err := newCfg.loadKeyFiles(); err != nil {
+		return nil, err
 	}
 
+	changes := diffConfigs(c, newCfg)
+
 	// Update fields
 	c.Name = newCfg.Name
 	c.Server = newCfg.Server
 	c.Databases = newCfg.Databases
 	c.AnonymousAccess = newCfg.AnonymousAccess
 	c.AllowKeyless = newCfg.AllowKeyless
+	c.AllowRawDownload = newCfg.AllowRawDownload
 	c.Users = newCfg.Users
+	c.Groups = newCfg.Groups
+	c.CertAuthorities = newCfg.CertAuthorities
 	c.Public = newCfg.Public
+	c.Log = newCfg.Log
+	c.AuthBans = newCfg.AuthBans
+	c.Hooks = newCfg.Hooks
+	c.QueryLimits = newCfg.QueryLimits
+	c.Approvals = newCfg.Approvals
+	c.Connections = newCfg.Connections
+	c.Discovery = newCfg.Discovery
 
 	// Update mod time
 	info, err := os.Stat(c.path)
@@ -158,7 +582,7 @@ func (c *Config) Reload() error {
 		c.modTime = info.ModTime()
 	}
 
-	return nil
+	return changes, nil
 }
 
 // HasChanged checks if the config file has been modified.
@@ -185,7 +609,23 @@ func (c *Config) BuildResolver() *access.Resolver {
 
 	// Add public rules
 	for _, pub := range c.Public {
-		resolver.AddPublicRule(pub.Pattern, access.ParseLevel(pub.Level))
+		resolver.AddPublicRules(pub.ToAccessRule())
+	}
+
+	// Add group rules and members. Members listed on the group come before
+	// groups named by the user
+	for _, group := range c.Groups {
+		for _, rule := range group.Access {
+			resolver.AddGroupRules(group.Name, rule.ToAccessRule())
+		}
+		for _, member := range group.Members {
+			resolver.AddGroupMember(group.Name, member)
+		}
+	}
+	for _, user := range c.Users {
+		for _, group := range user.Groups {
+			resolver.AddGroupMember(group, user.Name)
+		}
 	}
 
 	// Add user rules
@@ -194,20 +634,45 @@ func (c *Config) BuildResolver() *access.Resolver {
 			resolver.AddAdmin(user.Name)
 		}
 		for _, rule := range user.Access {
-			resolver.AddUserRule(user.Name, rule.Pattern, access.ParseLevel(rule.Level))
+			resolver.AddUserRules(user.Name, rule.ToAccessRule())
+		}
+		if len(user.Commands) > 0 {
+			resolver.SetUserCommands(user.Name, user.Commands)
+		}
+		if user.TOTPSecret != "" {
+			resolver.SetUserTOTP(user.Name, user.TOTPSecret)
+		}
+		if user.CanSudo {
+			resolver.AddSudoer(user.Name)
+		}
+		for _, f := range user.RowFilters {
+			resolver.AddRowFilter(user.Name, f.ToRowFilter())
 		}
 	}
 
 	return resolver
 }
 
+// FindUserByName finds a user by name.
+func (c *Config) FindUserByName(name string) *User {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for i := range c.Users {
+		if c.Users[i].Name == name {
+			return &c.Users[i]
+		}
+	}
+	return nil
+}
+
 // FindUserByPublicKey finds a user by their SSH public key.
 func (c *Config) FindUserByPublicKey(keyFingerprint string) *User {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
 	for i := range c.Users {
-		for _, key := range c.Users[i].PublicKeys {
+		for _, key := range c.Users[i].AllPublicKeys() {
 			// Simple fingerprint comparison - in practice, you'd parse the key
 			if key == keyFingerprint {
 				return &c.Users[i]
@@ -229,6 +694,32 @@ func (c *Config) GetIdleTimeout() time.Duration {
 	return d
 }
 
+// GetAnonymousMaxDuration parses and returns how long anonymous sessions
+// may stay connected, or 0 for no limit.
+func (c *Config) GetAnonymousMaxDuration() time.Duration {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	d, err := time.ParseDuration(c.AnonymousQuota.MaxDuration)
+	if err != nil || d < 0 {
+		return 0
+	}
+	return d
+}
+
+// GetIdleWarning parses and returns how long before the idle timeout
+// sessions are warned.
+func (c *Config) GetIdleWarning() time.Duration {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	d, err := time.ParseDuration(c.Server.SSH.IdleWarning)
+	if err != nil || d < 0 {
+		return time.Minute
+	}
+	return d
+}
+
 // GetMaxTimeout parses and returns the max timeout duration.
 func (c *Config) GetMaxTimeout() time.Duration {
 	c.mu.RLock()
@@ -241,6 +732,160 @@ func (c *Config) GetMaxTimeout() time.Duration {
 	return d
 }
 
+// GetKeyRefresh parses and returns the refresh interval for fetched keys.
+func (c *Config) GetKeyRefresh() time.Duration {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	d, err := time.ParseDuration(c.Server.SSH.KeyRefresh)
+	if err != nil || d <= 0 {
+		return time.Hour
+	}
+	return d
+}
+
+// GetAuthBans returns the failure threshold, counting window and ban
+// duration for IPs failing authentication. A zero threshold disables bans.
+func (c *Config) GetAuthBans() (maxFailures int, window, duration time.Duration) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	window, err := time.ParseDuration(c.AuthBans.Window)
+	if err != nil || window <= 0 {
+		window = 10 * time.Minute
+	}
+	duration, err = time.ParseDuration(c.AuthBans.Duration)
+	if err != nil || duration <= 0 {
+		duration = time.Hour
+	}
+	return c.AuthBans.MaxFailures, window, duration
+}
+
+// GetConnectionLimits returns how long database connections may sit idle
+// before they are closed (0 for ever) and how many may be open at once (0
+// for no cap).
+func (c *Config) GetConnectionLimits() (idleTimeout time.Duration, maxOpen int) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	idleTimeout = 10 * time.Minute
+	if c.Connections.IdleTimeout != "" {
+		d, err := time.ParseDuration(c.Connections.IdleTimeout)
+		if err == nil && d >= 0 {
+			idleTimeout = d
+		}
+	}
+	return idleTimeout, max(c.Connections.MaxOpen, 0)
+}
+
+// GetLockTTL returns how long a write lock may go without a heartbeat from
+// an ended session before it is released, 0 for never.
+func (c *Config) GetLockTTL() time.Duration {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.Connections.LockTTL != "" {
+		if d, err := time.ParseDuration(c.Connections.LockTTL); err == nil && d >= 0 {
+			return d
+		}
+	}
+	return 10 * time.Minute
+}
+
+// GetRescanInterval returns how often database sources are rescanned on a
+// timer, or 0 when they aren't.
+func (c *Config) GetRescanInterval() time.Duration {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.Discovery.RescanInterval != "" {
+		if d, err := time.ParseDuration(c.Discovery.RescanInterval); err == nil && d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// ApprovalRequired reports whether a command needs an admin's approval.
+func (c *Config) ApprovalRequired(command string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return slices.Contains(c.Approvals.Commands, command)
+}
+
+// RawDownloadAllowed reports whether raw database files may be downloaded
+// at all. When false, no access level allows it.
+func (c *Config) RawDownloadAllowed() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.AllowRawDownload == nil || *c.AllowRawDownload
+}
+
+// GetQueryLimit returns the query limits for a user with the given access
+// level.
+func (c *Config) GetQueryLimit(anonymous bool, level access.Level) QueryLimit {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	switch {
+	case level >= access.Admin:
+		return QueryLimit{}
+	case anonymous:
+		return c.QueryLimits.Anonymous
+	case level == access.ReadWrite:
+		return c.QueryLimits.ReadWrite
+	default:
+		return c.QueryLimits.ReadOnly
+	}
+}
+
+// GetHooks returns the commands configured for a hook event such as
+// "session_start", matching the on_<event> settings.
+func (c *Config) GetHooks(event string) []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	switch event {
+	case "session_start":
+		return c.Hooks.OnSessionStart
+	case "session_end":
+		return c.Hooks.OnSessionEnd
+	case "write":
+		return c.Hooks.OnWrite
+	case "download":
+		return c.Hooks.OnDownload
+	case "upload":
+		return c.Hooks.OnUpload
+	case "ban":
+		return c.Hooks.OnBan
+	case "audit":
+		return c.Hooks.OnAudit
+	case "change":
+		return c.Hooks.OnChange
+	}
+	return nil
+}
+
+// GetHookWatches returns the tables followed for the change hooks, as
+// "database/table".
+func (c *Config) GetHookWatches() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.Hooks.Watch
+}
+
+// GetHooksTimeout returns how long a hook command may run.
+func (c *Config) GetHooksTimeout() time.Duration {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	d, err := time.ParseDuration(c.Hooks.Timeout)
+	if err != nil || d <= 0 {
+		return 10 * time.Second
+	}
+	return d
+}
+
 // GetDataDir returns the data directory path (for history, keys, etc.).
 func (c *Config) GetDataDir() string {
 	return ".sqlite-tui"
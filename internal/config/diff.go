@@ -0,0 +1,184 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// diffConfigs describes what changed between two configs, one line per
+// change, for logging after a reload.
+func diffConfigs(old, new *Config) []string {
+	var changes []string
+	add := func(format string, args ...any) {
+		changes = append(changes, fmt.Sprintf(format, args...))
+	}
+
+	// Users, by name
+	oldUsers := make(map[string]User, len(old.Users))
+	for _, u := range old.Users {
+		oldUsers[u.Name] = u
+	}
+	newUsers := make(map[string]bool, len(new.Users))
+	for _, u := range new.Users {
+		newUsers[u.Name] = true
+		prev, ok := oldUsers[u.Name]
+		if !ok {
+			add("user %s added", u.Name)
+			continue
+		}
+		if fields := userChanges(prev, u); len(fields) > 0 {
+			add("user %s changed: %s", u.Name, strings.Join(fields, ", "))
+		}
+	}
+	for _, u := range old.Users {
+		if !newUsers[u.Name] {
+			add("user %s removed", u.Name)
+		}
+	}
+
+	// Groups, by name
+	oldGroups := make(map[string]Group, len(old.Groups))
+	for _, g := range old.Groups {
+		oldGroups[g.Name] = g
+	}
+	newGroups := make(map[string]bool, len(new.Groups))
+	for _, g := range new.Groups {
+		newGroups[g.Name] = true
+		prev, ok := oldGroups[g.Name]
+		if !ok {
+			add("group %s added", g.Name)
+		} else if !reflect.DeepEqual(prev, g) {
+			add("group %s changed", g.Name)
+		}
+	}
+	for _, g := range old.Groups {
+		if !newGroups[g.Name] {
+			add("group %s removed", g.Name)
+		}
+	}
+
+	// Database sources, by path
+	oldSources := make(map[string]DatabaseSource, len(old.Databases))
+	for _, s := range old.Databases {
+		oldSources[s.Path] = s
+	}
+	newSources := make(map[string]bool, len(new.Databases))
+	for _, s := range new.Databases {
+		newSources[s.Path] = true
+		prev, ok := oldSources[s.Path]
+		if !ok {
+			add("database source %s added", s.Path)
+		} else if !reflect.DeepEqual(prev, s) {
+			add("database source %s changed", s.Path)
+		}
+	}
+	for _, s := range old.Databases {
+		if !newSources[s.Path] {
+			add("database source %s removed", s.Path)
+		}
+	}
+
+	if old.AnonymousAccess != new.AnonymousAccess {
+		add("anonymous_access: %s -> %s", old.AnonymousAccess, new.AnonymousAccess)
+	}
+	if old.AllowKeyless != new.AllowKeyless {
+		add("allow_keyless: %t -> %t", old.AllowKeyless, new.AllowKeyless)
+	}
+	if oldAllow, newAllow := old.AllowRawDownload == nil || *old.AllowRawDownload,
+		new.AllowRawDownload == nil || *new.AllowRawDownload; oldAllow != newAllow {
+		add("allow_raw_download: %t -> %t", oldAllow, newAllow)
+	}
+	if !reflect.DeepEqual(old.Public, new.Public) {
+		add("public databases changed")
+	}
+	if !reflect.DeepEqual(old.CertAuthorities, new.CertAuthorities) {
+		add("cert_authorities changed")
+	}
+	if old.AuthBans != new.AuthBans {
+		add("auth_bans changed")
+	}
+	if old.QueryLimits != new.QueryLimits {
+		add("query_limits changed")
+	}
+	if !reflect.DeepEqual(old.Hooks, new.Hooks) {
+		add("hooks changed")
+	}
+	if !reflect.DeepEqual(old.Approvals, new.Approvals) {
+		add("approvals changed")
+	}
+	if old.Connections != new.Connections {
+		add("connections changed")
+	}
+	if old.Discovery != new.Discovery {
+		add("discovery changed")
+	}
+	if old.Log != new.Log {
+		add("log settings changed (only the level applies before restart)")
+	}
+
+	// Read once at startup
+	if old.Name != new.Name {
+		add("name changed (takes effect on restart)")
+	}
+	oldSSH, newSSH := old.Server.SSH, new.Server.SSH
+	oldSSH.UploadDir, oldSSH.KeyRefresh = newSSH.UploadDir, newSSH.KeyRefresh
+	oldSSH.IdleTimeout, oldSSH.IdleWarning = newSSH.IdleTimeout, newSSH.IdleWarning
+	if !reflect.DeepEqual(oldSSH, newSSH) || old.Server.Local != new.Server.Local || old.Server.Health != new.Server.Health ||
+		old.Server.Web != new.Server.Web || old.Server.API != new.Server.API {
+		add("server settings changed (take effect on restart)")
+	} else if !reflect.DeepEqual(old.Server, new.Server) {
+		add("server settings changed")
+	}
+	if old.RateLimits != new.RateLimits {
+		add("rate_limits changed (take effect on restart)")
+	}
+	if old.SessionLimits != new.SessionLimits {
+		add("session_limits changed (take effect on restart)")
+	}
+	if old.AnonymousQuota != new.AnonymousQuota {
+		add("anonymous_quota changed (takes effect on restart)")
+	}
+	if !reflect.DeepEqual(old.Tracing, new.Tracing) {
+		add("tracing changed (takes effect on restart)")
+	}
+
+	return changes
+}
+
+// userChanges lists the settings that differ between two versions of a user.
+func userChanges(old, new User) []string {
+	var fields []string
+	if old.Admin != new.Admin {
+		fields = append(fields, "admin")
+	}
+	if !reflect.DeepEqual(old.AllPublicKeys(), new.AllPublicKeys()) ||
+		old.PublicKeysFrom != new.PublicKeysFrom {
+		fields = append(fields, "keys")
+	}
+	if !reflect.DeepEqual(old.Principals, new.Principals) {
+		fields = append(fields, "principals")
+	}
+	if !reflect.DeepEqual(old.From, new.From) {
+		fields = append(fields, "from")
+	}
+	if !reflect.DeepEqual(old.Access, new.Access) {
+		fields = append(fields, "access")
+	}
+	if !reflect.DeepEqual(old.Groups, new.Groups) {
+		fields = append(fields, "groups")
+	}
+	if !reflect.DeepEqual(old.Commands, new.Commands) {
+		fields = append(fields, "commands")
+	}
+	if old.TOTPSecret != new.TOTPSecret {
+		fields = append(fields, "totp")
+	}
+	if old.CanSudo != new.CanSudo {
+		fields = append(fields, "can_sudo")
+	}
+	if !reflect.DeepEqual(old.RowFilters, new.RowFilters) {
+		fields = append(fields, "row_filters")
+	}
+	return fields
+}
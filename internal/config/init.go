@@ -0,0 +1,204 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+
+	gossh "golang.org/x/crypto/ssh"
+	"gopkg.in/yaml.v3"
+)
+
+// InitAnswers holds the choices made in the config init wizard.
+type InitAnswers struct {
+	Name            string
+	Listen          string
+	Databases       []string
+	AdminName       string
+	AdminKey        string // authorized_keys line, may be empty
+	AnonymousAccess string
+}
+
+// anonymousLevels are the accepted anonymous_access values.
+var anonymousLevels = []string{"none", "read-only", "read-write"}
+
+// RunInitWizard asks for the settings of a new config file on out and
+// reads the answers from in. Empty answers keep the shown default.
+func RunInitWizard(in io.Reader, out io.Writer) (*InitAnswers, error) {
+	defaults := DefaultConfig()
+	r := bufio.NewReader(in)
+
+	ask := func(question, def string) (string, error) {
+		if def != "" {
+			fmt.Fprintf(out, "%s [%s]: ", question, def)
+		} else {
+			fmt.Fprintf(out, "%s: ", question)
+		}
+		line, err := r.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			if err == io.EOF {
+				return "", fmt.Errorf("input ended before the wizard finished")
+			}
+			return "", err
+		}
+		if line = strings.TrimSpace(line); line == "" {
+			return def, nil
+		}
+		return line, nil
+	}
+
+	a := &InitAnswers{}
+	var err error
+
+	if a.Name, err = ask("Studio name", defaults.Name); err != nil {
+		return nil, err
+	}
+	if a.Listen, err = ask("SSH listen address", defaults.Server.SSH.Listen[0]); err != nil {
+		return nil, err
+	}
+
+	dbs, err := ask("Database paths, globs or directories (comma-separated)", "./*.db")
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range strings.Split(dbs, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			a.Databases = append(a.Databases, p)
+		}
+	}
+
+	if a.AdminName, err = ask("Admin user name", "admin"); err != nil {
+		return nil, err
+	}
+
+	for {
+		key, err := ask("Admin public key or path to a .pub file (empty to add later)", "")
+		if err != nil {
+			return nil, err
+		}
+		if key == "" {
+			break
+		}
+		if a.AdminKey, err = readPublicKey(key); err == nil {
+			break
+		}
+		fmt.Fprintf(out, "  %v\n", err)
+	}
+
+	for {
+		level, err := ask("Anonymous access (none, read-only, read-write)", defaults.AnonymousAccess)
+		if err != nil {
+			return nil, err
+		}
+		if isAnonymousLevel(level) {
+			a.AnonymousAccess = level
+			break
+		}
+		fmt.Fprintf(out, "  unknown level %q\n", level)
+	}
+
+	return a, nil
+}
+
+// readPublicKey accepts an authorized_keys line or a path to a file holding
+// one and returns the validated key line.
+func readPublicKey(s string) (string, error) {
+	line := s
+	if !strings.HasPrefix(s, "ssh-") && !strings.HasPrefix(s, "ecdsa-") && !strings.HasPrefix(s, "sk-") {
+		data, err := os.ReadFile(s)
+		if err != nil {
+			return "", fmt.Errorf("not a public key and not a readable file: %w", err)
+		}
+		line = strings.TrimSpace(string(data))
+	}
+	if _, _, _, _, err := gossh.ParseAuthorizedKey([]byte(line)); err != nil {
+		return "", fmt.Errorf("invalid public key: %w", err)
+	}
+	return line, nil
+}
+
+func isAnonymousLevel(level string) bool {
+	for _, l := range anonymousLevels {
+		if l == level {
+			return true
+		}
+	}
+	return false
+}
+
+var initTemplate = template.Must(template.New("config").Funcs(template.FuncMap{
+	"q": strconv.Quote,
+}).Parse(`# sqlite-tui configuration
+# Generated by "sqlite-tui config init". See config.example.yaml for all options.
+name: {{q .Name}}
+
+# Server configuration
+server:
+  ssh:
+    enabled: true
+    listen: {{q .Listen}}
+    # Generated on first start if missing
+    host_key_path: ".sqlite-tui/host_key"
+    idle_timeout: "30m"
+    idle_warning: "1m"
+    max_timeout: "24h"
+
+  local:
+    enabled: true
+
+# Database sources: file paths, directories or globs
+databases:
+{{- range .Databases}}
+  - path: {{q .}}
+{{- end}}
+
+# Anonymous access (unauthenticated users): none, read-only, read-write
+anonymous_access: {{q .AnonymousAccess}}
+
+# Allow connections without SSH key (keyboard-interactive)
+allow_keyless: false
+
+# Users and access rules
+users:
+  - name: {{q .AdminName}}
+    admin: true
+    public_keys:
+{{- if .AdminKey}}
+      - {{q .AdminKey}}
+{{- else}}
+      []
+      # Add the admin's key here, e.g.:
+      # - "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAI... admin@example.com"
+{{- end}}
+
+  # Non-admin users get per-database access rules:
+  # - name: developer
+  #   public_keys:
+  #     - "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAI... dev@example.com"
+  #   access:
+  #     - pattern: "*"
+  #       level: "read-only"
+
+# Public databases (accessible without authentication)
+public: []
+`))
+
+// RenderInitConfig renders a commented config file from wizard answers.
+// The result is parsed back to make sure it is valid YAML.
+func RenderInitConfig(a *InitAnswers) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := initTemplate.Execute(&buf, a); err != nil {
+		return nil, err
+	}
+
+	check := DefaultConfig()
+	if err := yaml.Unmarshal(buf.Bytes(), check); err != nil {
+		return nil, fmt.Errorf("generated config is invalid: %w", err)
+	}
+	return buf.Bytes(), nil
+}
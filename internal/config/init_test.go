@@ -0,0 +1,134 @@
+package config
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// testPublicKey returns an authorized_keys line for a new key, with
+// comment.
+func testPublicKey(t *testing.T, comment string) string {
+	t.Helper()
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := gossh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSpace(string(gossh.MarshalAuthorizedKey(key))) + " " + comment
+}
+
+// TestInitWizard_RoundTrip tests that the wizard's answers, including ones
+// YAML would misread unquoted, survive rendering and loading the config.
+func TestInitWizard_RoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	key := testPublicKey(t, `ops "laptop" #1: main`)
+	answers := strings.Join([]string{
+		`Café "prod": #1`,                // name
+		"",                               // listen, the default
+		`./data/*.db, /srv/it's here.db`, // databases
+		"ops: admin",                     // admin name
+		"ssh-ed25519 not-a-key",          // invalid key, asked again
+		key,                              // key
+		"everyone",                       // unknown level, asked again
+		"read-only",                      // anonymous access
+	}, "\n") + "\n"
+
+	var out strings.Builder
+	a, err := RunInitWizard(strings.NewReader(answers), &out)
+	if err != nil {
+		t.Fatalf("wizard failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "invalid public key") || !strings.Contains(out.String(), `unknown level "everyone"`) {
+		t.Errorf("expected the bad answers to be reported, got %q", out.String())
+	}
+
+	data, err := RenderInitConfig(a)
+	if err != nil {
+		t.Fatalf("render failed: %v", err)
+	}
+	path := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("generated config doesn't load: %v\n%s", err, data)
+	}
+
+	if cfg.Name != `Café "prod": #1` {
+		t.Errorf("name = %q", cfg.Name)
+	}
+	if listen := DefaultConfig().Server.SSH.Listen; !slices.Equal(cfg.Server.SSH.Listen, listen) {
+		t.Errorf("listen = %v, want the default %v", cfg.Server.SSH.Listen, listen)
+	}
+	var paths []string
+	for _, db := range cfg.Databases {
+		paths = append(paths, db.Path)
+	}
+	if !slices.Equal(paths, []string{"./data/*.db", "/srv/it's here.db"}) {
+		t.Errorf("database paths = %q", paths)
+	}
+	if cfg.AnonymousAccess != "read-only" {
+		t.Errorf("anonymous access = %q", cfg.AnonymousAccess)
+	}
+	if len(cfg.Users) != 1 {
+		t.Fatalf("expected one user, got %+v", cfg.Users)
+	}
+	admin := cfg.Users[0]
+	if admin.Name != "ops: admin" || !admin.Admin || !slices.Equal(admin.PublicKeys, []string{key}) {
+		t.Errorf("unexpected admin: %+v", admin)
+	}
+}
+
+// TestInitWizard_Defaults tests that empty answers keep the defaults, that
+// the key may come from a file, and that a config without a key loads.
+func TestInitWizard_Defaults(t *testing.T) {
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "id_ed25519.pub")
+	key := testPublicKey(t, "admin@example.com")
+	if err := os.WriteFile(keyFile, []byte(key+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := RunInitWizard(strings.NewReader("\n\n\n\n"+keyFile+"\n\n"), &strings.Builder{})
+	if err != nil {
+		t.Fatalf("wizard failed: %v", err)
+	}
+	defaults := DefaultConfig()
+	if a.Name != defaults.Name || a.AdminName != "admin" || a.AdminKey != key ||
+		a.AnonymousAccess != defaults.AnonymousAccess || !slices.Equal(a.Databases, []string{"./*.db"}) {
+		t.Errorf("unexpected answers: %+v", a)
+	}
+
+	a.AdminKey = ""
+	data, err := RenderInitConfig(a)
+	if err != nil {
+		t.Fatalf("render failed: %v", err)
+	}
+	path := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("generated config doesn't load: %v\n%s", err, data)
+	}
+	if len(cfg.Users) != 1 || len(cfg.Users[0].PublicKeys) != 0 {
+		t.Errorf("expected an admin without keys, got %+v", cfg.Users)
+	}
+
+	// Input ending early is an error, not an empty answer
+	if _, err := RunInitWizard(strings.NewReader("name\n"), &strings.Builder{}); err == nil {
+		t.Error("expected an error when input ends before the wizard finishes")
+	}
+}
@@ -0,0 +1,76 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// keyHosts maps public_keys_from prefixes to the URL serving a user's keys.
+var keyHosts = map[string]string{
+	"github": "https://github.com/%s.keys",
+	"gitlab": "https://gitlab.com/%s.keys",
+}
+
+// KeySourceURL returns the URL of a public_keys_from source such as
+// "github:alice".
+func KeySourceURL(source string) (string, error) {
+	host, name, ok := strings.Cut(source, ":")
+	format, known := keyHosts[host]
+	if !ok || !known {
+		return "", fmt.Errorf("unknown key source %q (use github:<user> or gitlab:<user>)", source)
+	}
+	if name == "" || strings.ContainsAny(name, "/?#%@: ") {
+		return "", fmt.Errorf("invalid user name in key source %q", source)
+	}
+	return fmt.Sprintf(format, name), nil
+}
+
+// loadKeyFiles reads the public_keys_file of every user and checks their
+// public_keys_from source. Relative paths are resolved against the config
+// file's directory.
+func (c *Config) loadKeyFiles() error {
+	for i := range c.Users {
+		user := &c.Users[i]
+		user.fileKeys = nil
+
+		if user.PublicKeysFrom != "" {
+			if _, err := KeySourceURL(user.PublicKeysFrom); err != nil {
+				return fmt.Errorf("user %s: %w", user.Name, err)
+			}
+		}
+
+		if user.PublicKeysFile == "" {
+			continue
+		}
+
+		path := user.PublicKeysFile
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(filepath.Dir(c.path), path)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("user %s: failed to read public keys file: %w", user.Name, err)
+		}
+		user.fileKeys = ParseAuthorizedKeys(data)
+	}
+	return nil
+}
+
+// ParseAuthorizedKeys returns the key lines of authorized_keys data,
+// skipping blank lines and comments.
+func ParseAuthorizedKeys(data []byte) []string {
+	var keys []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		keys = append(keys, string(line))
+	}
+	return keys
+}
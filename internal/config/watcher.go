@@ -1,18 +1,23 @@
 package config
 
 import (
-	"log"
+	"log/slog"
+	"os"
+	"os/signal"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
 )
 
-// Watcher watches the config file for changes and reloads it.
+// Watcher watches the config file for changes and reloads it. SIGHUP
+// forces a reload as well.
 type Watcher struct {
 	config    *Config
 	watcher   *fsnotify.Watcher
 	callbacks []func(*Config)
+	hup       chan os.Signal
 	stop      chan struct{}
 	mu        sync.RWMutex
 }
@@ -28,6 +33,7 @@ func NewWatcher(config *Config) (*Watcher, error) {
 		config:    config,
 		watcher:   watcher,
 		callbacks: make([]func(*Config), 0),
+		hup:       make(chan os.Signal, 1),
 		stop:      make(chan struct{}),
 	}
 
@@ -51,6 +57,7 @@ func (w *Watcher) Start() error {
 	if err := w.watcher.Add(path); err != nil {
 		return err
 	}
+	signal.Notify(w.hup, syscall.SIGHUP)
 
 	go w.watch()
 	return nil
@@ -58,6 +65,7 @@ func (w *Watcher) Start() error {
 
 // Stop stops watching the config file.
 func (w *Watcher) Stop() {
+	signal.Stop(w.hup)
 	close(w.stop)
 	w.watcher.Close()
 }
@@ -90,7 +98,11 @@ func (w *Watcher) watch() {
 			if !ok {
 				return
 			}
-			log.Printf("config watcher error: %v", err)
+			slog.Error("Config watcher error", "err", err)
+
+		case <-w.hup:
+			slog.Info("Received SIGHUP, reloading config")
+			w.reload()
 
 		case <-w.stop:
 			if debounceTimer != nil {
@@ -103,12 +115,16 @@ func (w *Watcher) watch() {
 
 // reload reloads the config and notifies callbacks.
 func (w *Watcher) reload() {
-	if err := w.config.Reload(); err != nil {
-		log.Printf("failed to reload config: %v", err)
+	changes, err := w.config.Reload()
+	if err != nil {
+		slog.Error("Failed to reload config", "err", err)
 		return
 	}
 
-	log.Printf("config reloaded from %s", w.config.Path())
+	slog.Info("Config reloaded", "path", w.config.Path(), "changes", len(changes))
+	for _, change := range changes {
+		slog.Info("Config change", "change", change)
+	}
 
 	w.mu.RLock()
 	callbacks := make([]func(*Config), len(w.callbacks))
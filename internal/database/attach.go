@@ -0,0 +1,262 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/johan-st/sqlite-tui/internal/access"
+)
+
+// Attachment names a managed database to ATTACH under a schema name.
+type Attachment struct {
+	Database string // path or alias
+	Schema   string // name used to qualify tables in the query
+}
+
+// ErrInvalidAttachment is returned when an attachment cannot be used.
+var ErrInvalidAttachment = errors.New("invalid attachment")
+
+var schemaNameRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ParseAttachments parses a comma-separated list of alias[:schema] pairs.
+// When the schema is omitted the alias itself is used.
+func ParseAttachments(spec string) ([]Attachment, error) {
+	var result []Attachment
+	seen := map[string]bool{}
+
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		db, schema, found := strings.Cut(part, ":")
+		if !found {
+			schema = db
+		}
+		if db == "" {
+			return nil, fmt.Errorf("%w: missing database in %q", ErrInvalidAttachment, part)
+		}
+		if !schemaNameRe.MatchString(schema) {
+			return nil, fmt.Errorf("%w: %q is not a valid schema name", ErrInvalidAttachment, schema)
+		}
+		lower := strings.ToLower(schema)
+		if isReservedSchema(schema) || seen[lower] {
+			return nil, fmt.Errorf("%w: schema name %q is reserved or already used", ErrInvalidAttachment, schema)
+		}
+		seen[lower] = true
+		result = append(result, Attachment{Database: db, Schema: schema})
+	}
+	return result, nil
+}
+
+// groupAttachments returns the ATTACH statements for the companion
+// databases db's source attaches, and a connection key suffix naming them.
+// Only companions the user can read without row filters are attached, and
+// only read-only, so writes never reach a database the write lock doesn't
+// cover.
+func (m *Manager) groupAttachments(db *DiscoveredDatabase, user *access.UserInfo) (init []string, key string) {
+	companions := sourceAttach(db)
+	schemas := make([]string, 0, len(companions))
+	for schema := range companions {
+		schemas = append(schemas, schema)
+	}
+	sort.Strings(schemas)
+
+	for _, schema := range schemas {
+		member := m.groupMember(db, companions[schema])
+		switch {
+		case !schemaNameRe.MatchString(schema) || isReservedSchema(schema):
+			slog.Warn("Skipping attached database with invalid schema name", "database", db.Path, "schema", schema)
+			continue
+		case member == nil:
+			slog.Warn("Skipping attached database that was not found", "database", db.Path, "attach", companions[schema])
+			continue
+		case member.Path == db.Path,
+			!m.GetAccessLevel(user, member.Path).CanRead(),
+			len(m.RowFilters(user, member.Path)) > 0:
+			continue
+		}
+		uri := fileURI(member.Path, url.Values{"mode": {"ro"}})
+		init = append(init, attachStatement(uri, schema, member.Key))
+		key += attachConnKey + member.Path
+	}
+	return init, key
+}
+
+// sourceAttach returns the companions db's source attaches, by schema.
+func sourceAttach(db *DiscoveredDatabase) map[string]string {
+	if db.Source == nil {
+		return nil
+	}
+	return db.Source.Attach
+}
+
+// groupMember finds a companion database by path or alias, resolving
+// relative paths against db's directory.
+func (m *Manager) groupMember(db *DiscoveredDatabase, member string) *DiscoveredDatabase {
+	if other := m.discovery.GetDatabase(member); other != nil {
+		return other
+	}
+	if !filepath.IsAbs(member) {
+		return m.discovery.GetDatabase(filepath.Join(filepath.Dir(db.Path), member))
+	}
+	return nil
+}
+
+// attachStatement returns the statement attaching the database at uri as
+// schema, with its key if it is encrypted.
+func attachStatement(uri, schema, key string) string {
+	stmt := "ATTACH DATABASE " + quoteLiteral(uri) + " AS " + quoteIdentifier(schema)
+	if key != "" {
+		stmt += " KEY " + quoteLiteral(key)
+	}
+	return stmt
+}
+
+// isReservedSchema reports whether SQLite reserves a schema name.
+func isReservedSchema(schema string) bool {
+	lower := strings.ToLower(schema)
+	return lower == "main" || lower == "temp"
+}
+
+// ExecuteQueryAttached executes a query with other managed databases
+// attached for its duration. The user needs read access to every attached
+// database, and write access to all of them for write queries. Attached
+// databases the user cannot write are opened read-only.
+//
+// The query runs on a dedicated connection that is closed afterwards, so
+// the attachments never leak into the shared connection pool.
+func (m *Manager) ExecuteQueryAttached(ctx context.Context, pathOrAlias string, attachments []Attachment, user *access.UserInfo, sessionID string, query string) (*QueryResult, error) {
+	if len(attachments) == 0 {
+		return m.ExecuteQuery(ctx, pathOrAlias, user, sessionID, query)
+	}
+
+	db := m.discovery.GetDatabase(pathOrAlias)
+	if db == nil {
+		return nil, fmt.Errorf("%w: %s", ErrDatabaseNotFound, pathOrAlias)
+	}
+
+	write := !IsReadOnlyQuery(query)
+	level := m.GetAccessLevel(user, pathOrAlias)
+	if !level.CanRead() {
+		return nil, fmt.Errorf("%w to database: %s", ErrAccessDenied, pathOrAlias)
+	}
+	if write && !level.CanWrite() {
+		return nil, fmt.Errorf("%w: write permission required", ErrAccessDenied)
+	}
+	if err := checkFileStatements(query); err != nil {
+		return nil, err
+	}
+	if err := m.checkQueryApproval(user, query); err != nil {
+		return nil, err
+	}
+	if err := m.checkTOTP(ctx, user, query); err != nil {
+		return nil, err
+	}
+
+	if len(m.RowFilters(user, pathOrAlias)) > 0 {
+		return nil, fmt.Errorf("%w: attaching not allowed with row filters", ErrAccessDenied)
+	}
+
+	// Resolve and check every attachment before touching any file
+	dbs := make([]*DiscoveredDatabase, len(attachments))
+	paths := make([]string, len(attachments))
+	writable := make([]bool, len(attachments))
+	for i, a := range attachments {
+		other := m.discovery.GetDatabase(a.Database)
+		if other == nil {
+			return nil, fmt.Errorf("%w: %s", ErrDatabaseNotFound, a.Database)
+		}
+		if other.Path == db.Path {
+			return nil, fmt.Errorf("%w: %s is the queried database", ErrInvalidAttachment, a.Database)
+		}
+		otherLevel := m.GetAccessLevel(user, a.Database)
+		if !otherLevel.CanRead() {
+			return nil, fmt.Errorf("%w to database: %s", ErrAccessDenied, a.Database)
+		}
+		if write && !otherLevel.CanWrite() {
+			return nil, fmt.Errorf("%w: write permission required on %s", ErrAccessDenied, a.Database)
+		}
+		if len(m.RowFilters(user, a.Database)) > 0 {
+			return nil, fmt.Errorf("%w: attaching not allowed with row filters", ErrAccessDenied)
+		}
+		dbs[i] = other
+		paths[i] = other.Path
+		writable[i] = otherLevel.CanWrite()
+	}
+
+	limits, err := m.checkQueryLimit(user, level)
+	if err != nil {
+		return nil, err
+	}
+
+	// Open the database as openConnection would, and attach on every
+	// connection the pools open, readers and writer alike, after the
+	// source's own companions
+	opts := DefaultOpenOptions()
+	opts.ReadOnly = !level.CanWrite()
+	if db.Source != nil {
+		sourceOpenOptions(&opts, db.Source)
+	}
+	opts.Init, _ = m.groupAttachments(db, user)
+	for i, a := range attachments {
+		if _, ok := sourceAttach(db)[a.Schema]; ok {
+			return nil, fmt.Errorf("%w: schema name %q is attached by the database's configuration", ErrInvalidAttachment, a.Schema)
+		}
+		mode := "ro"
+		if writable[i] {
+			mode = "rw"
+		}
+		uri := fileURI(paths[i], url.Values{"mode": {mode}})
+		opts.Init = append(opts.Init, attachStatement(uri, a.Schema, dbs[i].Key))
+	}
+	opts.Key = db.Key
+	conn, err := Open(db.Path, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to attach databases: %w", err)
+	}
+	defer conn.Close()
+
+	// Writes may touch any attached database, so lock all of them. Locks
+	// are taken in path order, so two sessions attaching the same
+	// databases the other way round can't each hold the lock the other
+	// waits for
+	if write {
+		locked := append([]*DiscoveredDatabase{db}, dbs...)
+		sort.Slice(locked, func(i, j int) bool { return locked[i].Path < locked[j].Path })
+		var unlocks []func()
+		defer func() {
+			for _, unlock := range unlocks {
+				unlock()
+			}
+		}()
+		for _, d := range locked {
+			unlock, err := m.lockForWrite(ctx, d, nil, user.DisplayName(), sessionID, true)
+			if err != nil {
+				return nil, err
+			}
+			unlocks = append(unlocks, unlock)
+		}
+	}
+
+	result, err := m.WithQueryTimeout(ctx, user, pathOrAlias, func(ctx context.Context) (*QueryResult, error) {
+		return tracedQuery(ctx, nil, conn, query, nil, limits)
+	})
+	if err != nil {
+		if IsWALLockError(err) {
+			LogWALError(db.Path, err)
+		}
+		return nil, err
+	}
+	if write {
+		m.fireWrite(db.Path, user, sessionID, query, result)
+	}
+	return result, nil
+}
@@ -0,0 +1,282 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/johan-st/sqlite-tui/internal/access"
+)
+
+// ErrBackupInProgress is returned when another backup is writing the same
+// destination file.
+var ErrBackupInProgress = errors.New("a backup to this file is already running")
+
+// backupTargets holds the destination paths of running backups.
+var (
+	backupMu      sync.Mutex
+	backupTargets = make(map[string]bool)
+)
+
+// Backup writes a consistent copy of a database to destPath and returns
+// its size. It takes the database's write lock from the lock queue first,
+// following its lock policy or the wait asked for with WithLockTimeout, so
+// a backup never runs alongside a writer or an upload replacing the file.
+// Like a download, it needs download permission and no row filters.
+func (m *Manager) Backup(ctx context.Context, pathOrAlias string, user *access.UserInfo, sessionID, destPath string) (int64, error) {
+	db := m.discovery.GetDatabase(pathOrAlias)
+	if db == nil {
+		return 0, fmt.Errorf("%w: %s", ErrDatabaseNotFound, pathOrAlias)
+	}
+
+	m.mu.RLock()
+	resolver := m.resolver
+	m.mu.RUnlock()
+	if !resolver.CanDownload(user, db.Path, db.Alias) {
+		return 0, fmt.Errorf("%w: download permission required", ErrAccessDenied)
+	}
+	if len(m.RowFilters(user, pathOrAlias)) > 0 {
+		return 0, fmt.Errorf("%w: backups not allowed with row filters", ErrAccessDenied)
+	}
+
+	conn, err := m.openConnection(pathOrAlias, user, true)
+	if err != nil {
+		return 0, err
+	}
+	unlock, err := m.lockBackup(ctx, db, user, sessionID)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+	return backupConn(ctx, conn, destPath)
+}
+
+// lockBackup takes the whole-database write lock for copying db. The lock
+// is the session's own, so a session holding it for a transaction would
+// lose it when the copy is done; it is refused instead.
+func (m *Manager) lockBackup(ctx context.Context, db *DiscoveredDatabase, user *access.UserInfo, sessionID string) (func(), error) {
+	if m.txConn(db.Path, sessionID) != nil {
+		return nil, ErrInTransaction
+	}
+	return m.lockForWrite(ctx, db, nil, user.DisplayName(), sessionID, true)
+}
+
+// backupConn writes a consistent copy of the database to destPath with
+// VACUUM INTO and returns its size. The copy is a snapshot taken in a read
+// transaction. It is written to a temporary file that is synced and then
+// renamed over destPath, so destPath only ever holds a complete backup.
+// Callers hold the database's write lock, see Manager.Backup.
+func backupConn(ctx context.Context, conn *Connection, destPath string) (int64, error) {
+	if conn.tx != nil {
+		return 0, errors.New("cannot back up inside a transaction")
+	}
+
+	dest, err := filepath.Abs(destPath)
+	if err != nil {
+		return 0, err
+	}
+	if src, err := filepath.Abs(conn.Path); err == nil && src == dest {
+		return 0, errors.New("cannot back up a database onto itself")
+	}
+
+	backupMu.Lock()
+	if backupTargets[dest] {
+		backupMu.Unlock()
+		return 0, fmt.Errorf("%w: %s", ErrBackupInProgress, dest)
+	}
+	backupTargets[dest] = true
+	backupMu.Unlock()
+	defer func() {
+		backupMu.Lock()
+		delete(backupTargets, dest)
+		backupMu.Unlock()
+	}()
+
+	// VACUUM INTO accepts an empty file as its target
+	tmp, err := os.CreateTemp(filepath.Dir(dest), filepath.Base(dest)+".*.tmp")
+	if err != nil {
+		return 0, fmt.Errorf("failed to create backup file: %w", err)
+	}
+	tmpPath := tmp.Name()
+	tmp.Close()
+	committed := false
+	defer func() {
+		if !committed {
+			os.Remove(tmpPath)
+		}
+	}()
+
+	// VACUUM INTO only reads the source, so the read-only pool can run it
+	if _, err := conn.DB.ExecContext(ctx, "VACUUM INTO ?", tmpPath); err != nil {
+		return 0, fmt.Errorf("backup failed: %w", err)
+	}
+
+	size, err := syncFile(tmpPath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to sync backup: %w", err)
+	}
+	if err := os.Rename(tmpPath, dest); err != nil {
+		return 0, fmt.Errorf("failed to move backup into place: %w", err)
+	}
+	committed = true
+
+	// Persist the rename too
+	if dir, err := os.Open(filepath.Dir(dest)); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+	return size, nil
+}
+
+// syncFile flushes a file to disk and returns its size.
+func syncFile(path string) (int64, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	if err := f.Sync(); err != nil {
+		return 0, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// snapshotMaxAge is how long a snapshot is reused for queries before the
+// next one takes a fresh copy.
+var snapshotMaxAge = time.Minute
+
+// cachedSnapshot is a snapshot of a connection's database shared by the
+// snapshot queries run on it while it is fresh.
+type cachedSnapshot struct {
+	conn  *Connection
+	taken time.Time
+	refs  int  // queries running on it
+	stale bool // replaced or expired; closed once refs drops to zero
+
+	ready chan struct{} // closed once conn or err is set
+	err   error
+}
+
+// acquireSnapshot returns a snapshot of conn's database for a query on db,
+// and the function to call when the query is done. Snapshots younger than
+// snapshotMaxAge are shared; an older one is replaced by a copy taken
+// under the database's write lock, see Manager.Backup.
+func (m *Manager) acquireSnapshot(ctx context.Context, db *DiscoveredDatabase, conn *Connection, user *access.UserInfo, sessionID string) (*Connection, func(), error) {
+	m.snapMu.Lock()
+	s := m.snapshots[conn]
+	if s == nil || (s.conn != nil && time.Since(s.taken) >= snapshotMaxAge) {
+		if s != nil {
+			m.expireSnapshotLocked(conn, s)
+		}
+		s = &cachedSnapshot{ready: make(chan struct{})}
+		m.snapshots[conn] = s
+		m.snapMu.Unlock()
+
+		snap, err := m.takeSnapshot(ctx, db, conn, user, sessionID)
+		m.snapMu.Lock()
+		s.conn, s.err, s.taken = snap, err, time.Now()
+		if s.err != nil && m.snapshots[conn] == s {
+			delete(m.snapshots, conn)
+		}
+		close(s.ready)
+	}
+	s.refs++
+	m.snapMu.Unlock()
+
+	select {
+	case <-s.ready:
+	case <-ctx.Done():
+		m.releaseSnapshot(s)
+		return nil, nil, ctx.Err()
+	}
+	if s.err != nil {
+		m.releaseSnapshot(s)
+		return nil, nil, s.err
+	}
+	return s.conn, func() { m.releaseSnapshot(s) }, nil
+}
+
+// takeSnapshot copies conn's database under the write lock.
+func (m *Manager) takeSnapshot(ctx context.Context, db *DiscoveredDatabase, conn *Connection, user *access.UserInfo, sessionID string) (*Connection, error) {
+	unlock, err := m.lockBackup(ctx, db, user, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	return snapshotConn(ctx, conn)
+}
+
+// releaseSnapshot ends a query's use of s, closing it if it went stale.
+func (m *Manager) releaseSnapshot(s *cachedSnapshot) {
+	m.snapMu.Lock()
+	defer m.snapMu.Unlock()
+	s.refs--
+	if s.stale && s.refs == 0 && s.conn != nil {
+		s.conn.Close()
+	}
+}
+
+// expireSnapshotLocked forgets the snapshot s of conn's database, closing
+// it now if no query is using it, else once the last one is done.
+// m.snapMu must be held.
+func (m *Manager) expireSnapshotLocked(conn *Connection, s *cachedSnapshot) {
+	if m.snapshots[conn] == s {
+		delete(m.snapshots, conn)
+	}
+	s.stale = true
+	if s.refs == 0 && s.conn != nil {
+		s.conn.Close()
+	}
+}
+
+// expireSnapshots deletes the snapshots older than snapshotMaxAge, so idle
+// copies don't sit on disk until the next query. With all set, it deletes
+// every snapshot, as on Stop.
+func (m *Manager) expireSnapshots(now time.Time, all bool) {
+	m.snapMu.Lock()
+	defer m.snapMu.Unlock()
+	for conn, s := range m.snapshots {
+		if s.conn == nil {
+			continue // still being taken
+		}
+		if all || now.Sub(s.taken) >= snapshotMaxAge {
+			m.expireSnapshotLocked(conn, s)
+		}
+	}
+}
+
+// snapshotConn backs up the database to a temporary file and opens the
+// copy immutable, with the same per-connection setup as conn, such as row
+// filter views. Reads on it never contend with writers to the database.
+// Closing the snapshot deletes the copy. Callers hold the database's write
+// lock, see Manager.acquireSnapshot.
+func snapshotConn(ctx context.Context, conn *Connection) (*Connection, error) {
+	dir, err := os.MkdirTemp("", "sqlite-tui-snapshot-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create snapshot directory: %w", err)
+	}
+	path := filepath.Join(dir, filepath.Base(conn.Path))
+	if _, err := backupConn(ctx, conn, path); err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+
+	opts := conn.opts
+	opts.Immutable = true
+	opts.MaxIdleTime = 0
+	snap, err := Open(path, opts)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("failed to open snapshot: %w", err)
+	}
+	snap.onClose = func() { os.RemoveAll(dir) }
+	return snap, nil
+}
@@ -0,0 +1,169 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"time"
+)
+
+// changePollInterval is how often open databases are checked for changes.
+var changePollInterval = 2 * time.Second
+
+// changeBuffer is how many changes a watcher may fall behind by before
+// further ones are dropped.
+const changeBuffer = 16
+
+// DatabaseChange reports that a database was written to, through this
+// server or by another process.
+type DatabaseChange struct {
+	Path    string
+	Schema  bool  // the schema changed: tables, indexes, views or triggers
+	Size    int64 // the file's size after the change
+	ModTime int64
+}
+
+// changeWatch tracks a database's change counters on a connection of its
+// own, since PRAGMA data_version only counts changes made by other
+// connections.
+type changeWatch struct {
+	db           *sql.DB
+	data, schema int64
+}
+
+// WatchChanges returns a channel receiving changes to the databases with
+// open connections until ctx is done, when it is closed. Changes are
+// dropped while the channel is full.
+func (m *Manager) WatchChanges(ctx context.Context) <-chan DatabaseChange {
+	ch := make(chan DatabaseChange, changeBuffer)
+	m.changeMu.Lock()
+	m.changeSubs[ch] = struct{}{}
+	m.changeMu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		m.changeMu.Lock()
+		delete(m.changeSubs, ch)
+		close(ch)
+		m.changeMu.Unlock()
+	}()
+	return ch
+}
+
+// notifyChange sends a change to every watcher.
+func (m *Manager) notifyChange(change DatabaseChange) {
+	m.changeMu.Lock()
+	defer m.changeMu.Unlock()
+	for ch := range m.changeSubs {
+		select {
+		case ch <- change:
+		default:
+		}
+	}
+}
+
+// changeLoop polls open databases for changes every interval until Stop.
+func (m *Manager) changeLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	watches := make(map[string]*changeWatch)
+	defer func() {
+		for _, w := range watches {
+			w.db.Close()
+		}
+	}()
+
+	for {
+		select {
+		case <-m.stop:
+			return
+		case <-ticker.C:
+			m.pollChanges(watches)
+		}
+	}
+}
+
+// pollChanges compares the change counters of each database with an open
+// connection to those seen last, reporting the databases that changed and
+// refreshing their size in discovery. Databases seen for the first time
+// only record their counters.
+func (m *Manager) pollChanges(watches map[string]*changeWatch) {
+	// Immutable databases never change
+	open := make(map[string]*Connection)
+	m.mu.RLock()
+	for _, conn := range m.connections {
+		if !conn.opts.Immutable {
+			open[conn.Path] = conn
+		}
+	}
+	m.mu.RUnlock()
+
+	for path, w := range watches {
+		if open[path] == nil {
+			w.db.Close()
+			delete(watches, path)
+		}
+	}
+
+	for path, conn := range open {
+		w, ok := watches[path]
+		if !ok {
+			w, err := openChangeWatch(conn)
+			if err != nil {
+				slog.Warn("Failed to watch database for changes", "path", path, "err", err)
+				continue
+			}
+			watches[path] = w
+			continue
+		}
+
+		data, schema, err := w.versions()
+		if err != nil {
+			slog.Warn("Failed to check database for changes", "path", path, "err", err)
+			continue
+		}
+		if data == w.data && schema == w.schema {
+			continue
+		}
+		change := DatabaseChange{Path: path, Schema: schema != w.schema}
+		w.data, w.schema = data, schema
+
+		if db := m.discovery.refreshStat(path); db != nil {
+			change.Size, change.ModTime = db.Size, db.ModTime
+		}
+		m.notifyChange(change)
+	}
+}
+
+// openChangeWatch opens a single read-only connection to conn's database
+// and records its current counters.
+func openChangeWatch(conn *Connection) (*changeWatch, error) {
+	// Row filter views and attachments don't affect the counters
+	opts := conn.opts
+	opts.Init = nil
+	opts.MaxIdleTime = 0
+	db, err := openPool(conn.Path, "ro", opts, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &changeWatch{db: db}
+	if w.data, w.schema, err = w.versions(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// versions reads PRAGMA data_version, which moves on every commit by
+// another connection, and schema_version, which moves on schema changes.
+func (w *changeWatch) versions() (data, schema int64, err error) {
+	if err := w.db.QueryRow("PRAGMA data_version").Scan(&data); err != nil {
+		return 0, 0, err
+	}
+	if err := w.db.QueryRow("PRAGMA schema_version").Scan(&schema); err != nil {
+		return 0, 0, err
+	}
+	return data, schema, nil
+}
@@ -0,0 +1,127 @@
+package database
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// TableChecksum holds the checksum of a table's contents.
+type TableChecksum struct {
+	Table string
+	Rows  int64
+	Sum   string // hex-encoded SHA-256
+}
+
+// ChecksumTable computes a deterministic SHA-256 over a table's column
+// names and rows. Rows are read in primary key order, or ordered by every
+// column when the table has no primary key, so the result does not depend
+// on physical row order. Values are hashed together with their storage
+// class, so 1, 1.0 and '1' produce different checksums.
+func ChecksumTable(conn *Connection, table string) (*TableChecksum, error) {
+	columns, err := NewSchema(conn).GetColumns(table)
+	if err != nil {
+		return nil, err
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrTableNotFound, table)
+	}
+	// Generated and hidden columns are derived from the others
+	columns = slices.DeleteFunc(columns, func(c ColumnInfo) bool {
+		return c.Generated != "" || c.Hidden
+	})
+
+	var pk []string
+	names := make([]string, len(columns))
+	all := make([]string, len(columns))
+	for i, c := range columns {
+		names[i] = c.Name
+		all[i] = quoteIdentifier(c.Name)
+	}
+	// Sort PK columns by their position in the key
+	for pos := 1; pos <= len(columns); pos++ {
+		for _, c := range columns {
+			if c.PrimaryKey == pos {
+				pk = append(pk, quoteIdentifier(c.Name))
+			}
+		}
+	}
+	order := pk
+	if len(order) == 0 {
+		order = all
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM %s ORDER BY %s",
+		strings.Join(all, ", "), quoteIdentifier(table), strings.Join(order, ", "))
+	rows, err := conn.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	h := sha256.New()
+	for _, name := range names {
+		writeChecksumValue(h, name)
+	}
+
+	values := make([]any, len(columns))
+	ptrs := make([]any, len(columns))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+
+	var count int64
+	for rows.Next() {
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		h.Write([]byte{'r'})
+		for _, v := range values {
+			writeChecksumValue(h, v)
+		}
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return &TableChecksum{
+		Table: table,
+		Rows:  count,
+		Sum:   hex.EncodeToString(h.Sum(nil)),
+	}, nil
+}
+
+// writeChecksumValue writes a type-tagged, length-prefixed encoding of v.
+func writeChecksumValue(h hash.Hash, v any) {
+	var tag byte
+	var data string
+	switch val := v.(type) {
+	case nil:
+		h.Write([]byte{'n'})
+		return
+	case int64:
+		tag, data = 'i', strconv.FormatInt(val, 10)
+	case float64:
+		tag, data = 'f', strconv.FormatFloat(val, 'g', -1, 64)
+	case string:
+		tag, data = 's', val
+	case []byte:
+		tag, data = 'b', string(val)
+	case bool:
+		tag, data = 'i', "0"
+		if val {
+			data = "1"
+		}
+	default:
+		tag, data = 's', fmt.Sprint(val)
+	}
+	h.Write([]byte{tag})
+	h.Write([]byte(strconv.Itoa(len(data))))
+	h.Write([]byte{':'})
+	h.Write([]byte(data))
+}
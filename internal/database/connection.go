@@ -2,25 +2,90 @@
 package database
 
 import (
+	"context"
 	"database/sql"
+	"database/sql/driver"
 	"fmt"
+	"math/rand/v2"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/johan-st/sqlite-tui/internal/tracing"
 	_ "modernc.org/sqlite" // Pure Go SQLite driver
 )
 
-// Connection wraps a database connection with metadata.
+// Connection wraps a database's connections with metadata. Reads run on
+// DB, a pool of read-only SQLite connections, so readers don't queue behind
+// each other or behind writes. A read-write Connection also holds a single
+// writer connection that runs every statement that may write, and
+// transactions, one at a time.
 type Connection struct {
-	DB       *sql.DB
+	DB       *sql.DB // read-only reader pool
 	Path     string
 	ReadOnly bool
+	writer   *sql.DB // nil for read-only connections
+	tx       *sql.Tx // set when bound to a session's transaction, see Manager.BeginTx
 	mu       sync.Mutex
+
+	busyRetry RetryPolicy
+	opts      OpenOptions // what the connection was opened with
+	onClose   func()      // run after closing, e.g. to delete a snapshot
 }
 
 // OpenOptions configures how a database connection is opened.
 type OpenOptions struct {
 	ReadOnly    bool
 	BusyTimeout int // milliseconds
+	MaxReaders  int // size of the reader pool
+
+	// JournalMode is set by the writer, as it is stored in the file; ""
+	// (the default) leaves the file's own. Synchronous, CacheSize (0 for SQLite's
+	// default) and ForeignKeys apply to every connection
+	JournalMode string
+	Synchronous string
+	CacheSize   int
+	ForeignKeys bool
+
+	// MaxIdleTime closes pooled SQLite connections idle this long, so
+	// readers opened for a burst of queries don't stay open; 0 keeps them
+	MaxIdleTime time.Duration
+
+	// Init holds statements run on every new underlying connection, e.g.
+	// to create the temp views for row filters
+	Init []string
+
+	// BusyRetry retries statements that find the database locked
+	BusyRetry RetryPolicy
+
+	// Immutable opens the database read-only with immutable=1: SQLite
+	// takes no locks and assumes the file never changes, which only holds
+	// for archives and snapshots
+	Immutable bool
+
+	// Key decrypts an encrypted database; it needs a driver with
+	// encryption, see SetDriver
+	Key string
+}
+
+// RetryPolicy retries statements that fail with SQLITE_BUSY because
+// another process briefly holds the database file.
+type RetryPolicy struct {
+	Retries   int           // retries after the first attempt, 0 for none
+	BaseDelay time.Duration // wait before the first retry, doubled after each
+	MaxDelay  time.Duration // longest wait between two attempts
+}
+
+// DefaultBusyRetries is the number of busy retries when none is configured.
+const DefaultBusyRetries = 5
+
+// DefaultRetryPolicy returns the busy retry policy used by default.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		Retries:   DefaultBusyRetries,
+		BaseDelay: 10 * time.Millisecond,
+		MaxDelay:  time.Second,
+	}
 }
 
 // DefaultOpenOptions returns sensible defaults for opening a database.
@@ -28,22 +93,83 @@ func DefaultOpenOptions() OpenOptions {
 	return OpenOptions{
 		ReadOnly:    false,
 		BusyTimeout: 5000, // 5 seconds
+		MaxReaders:  DefaultMaxReaders,
+		Synchronous: "NORMAL",
+		BusyRetry:   DefaultRetryPolicy(),
 	}
 }
 
+// DefaultMaxReaders is the reader pool size when none is configured.
+const DefaultMaxReaders = 4
+
 // Open opens a database connection with the given options.
-func Open(path string, opts OpenOptions) (*Connection, error) {
-	mode := "rwc"
-	if opts.ReadOnly {
-		mode = "ro"
-	}
+func Open(path string, opts OpenOptions) (conn *Connection, err error) {
+	span := tracing.Start("db.open", nil,
+		tracing.String("db.system", "sqlite"),
+		tracing.String("db.path", path),
+		tracing.Bool("db.read_only", opts.ReadOnly),
+	)
+	defer func() { span.End(err) }()
 
-	dsn := fmt.Sprintf("file:%s?mode=%s&_busy_timeout=%d&_journal_mode=WAL&_synchronous=NORMAL&_foreign_keys=ON",
-		path, mode, opts.BusyTimeout)
+	opts.ReadOnly = opts.ReadOnly || opts.Immutable
 
-	db, err := sql.Open("sqlite", dsn)
+	// The writer comes first: it creates the file if needed, which the
+	// read-only readers can't
+	var writer *sql.DB
+	if !opts.ReadOnly {
+		writer, err = openPool(path, "rwc", opts, 1) // SQLite has one writer at a time
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	readers := max(opts.MaxReaders, 1)
+	db, err := openPool(path, "ro", opts, readers)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open database: %w", err)
+		if writer != nil {
+			writer.Close()
+		}
+		return nil, err
+	}
+
+	return &Connection{
+		DB:        db,
+		Path:      path,
+		ReadOnly:  opts.ReadOnly,
+		writer:    writer,
+		busyRetry: opts.BusyRetry,
+		opts:      opts,
+	}, nil
+}
+
+// openPool opens a pool of up to size SQLite connections in mode, with
+// the driver set by SetDriver.
+func openPool(path, mode string, opts OpenOptions, size int) (*sql.DB, error) {
+	drv := activeDriver()
+	if opts.Key != "" && !drv.Encryption {
+		return nil, ErrEncryptionUnsupported
+	}
+	dsn := drv.DSN(DSNParams{
+		Path:      path,
+		Mode:      mode,
+		Pragmas:   openPragmas(mode, opts),
+		Immutable: opts.Immutable,
+		Key:       opts.Key,
+	})
+
+	var db *sql.DB
+	if len(opts.Init) > 0 {
+		sqlDrv, err := sqlDriver(drv.Name)
+		if err != nil {
+			return nil, err
+		}
+		db = sql.OpenDB(&initConnector{driver: sqlDrv, dsn: dsn, init: opts.Init})
+	} else {
+		var err error
+		db, err = sql.Open(drv.Name, dsn)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open database: %w", err)
+		}
 	}
 
 	// Test the connection
@@ -52,16 +178,74 @@ func Open(path string, opts OpenOptions) (*Connection, error) {
 		return nil, fmt.Errorf("failed to connect to database: %w", err)
 	}
 
-	// Configure connection pool for SQLite
-	db.SetMaxOpenConns(1) // SQLite doesn't handle concurrent writes well
-	db.SetMaxIdleConns(1)
-	db.SetConnMaxLifetime(0) // Don't close idle connections
+	db.SetMaxOpenConns(size)
+	db.SetMaxIdleConns(size)
+	db.SetConnMaxLifetime(0)
+	db.SetConnMaxIdleTime(opts.MaxIdleTime)
+	return db, nil
+}
 
-	return &Connection{
-		DB:       db,
-		Path:     path,
-		ReadOnly: opts.ReadOnly,
-	}, nil
+// openPragmas returns the PRAGMAs setting the options on each new
+// connection of a pool in mode.
+func openPragmas(mode string, opts OpenOptions) []string {
+	pragmas := []string{fmt.Sprintf("busy_timeout(%d)", opts.BusyTimeout)}
+	if mode != "ro" && isPragmaWord(opts.JournalMode) {
+		pragmas = append(pragmas, "journal_mode("+opts.JournalMode+")")
+	}
+	if isPragmaWord(opts.Synchronous) {
+		pragmas = append(pragmas, "synchronous("+opts.Synchronous+")")
+	}
+	if opts.CacheSize != 0 {
+		pragmas = append(pragmas, fmt.Sprintf("cache_size(%d)", opts.CacheSize))
+	}
+	if opts.ForeignKeys {
+		pragmas = append(pragmas, "foreign_keys(1)")
+	} else {
+		pragmas = append(pragmas, "foreign_keys(0)")
+	}
+	return pragmas
+}
+
+// isPragmaWord reports whether s is a non-empty keyword, safe to pass as a
+// PRAGMA value.
+func isPragmaWord(s string) bool {
+	for _, c := range s {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z') {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// initConnector opens SQLite connections and runs statements on each one
+// before handing it to database/sql.
+type initConnector struct {
+	driver driver.Driver
+	dsn    string
+	init   []string
+}
+
+func (c *initConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.driver.Open(c.dsn)
+	if err != nil {
+		return nil, err
+	}
+	execer, ok := conn.(driver.ExecerContext)
+	if !ok {
+		conn.Close()
+		return nil, fmt.Errorf("sqlite driver does not support ExecContext")
+	}
+	for _, stmt := range c.init {
+		if _, err := execer.ExecContext(ctx, stmt, nil); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+func (c *initConnector) Driver() driver.Driver {
+	return c.driver
 }
 
 // OpenReadOnly opens a database in read-only mode.
@@ -78,42 +262,241 @@ func OpenReadWrite(path string) (*Connection, error) {
 	return Open(path, opts)
 }
 
-// Close closes the database connection.
+// Close closes the database connection. Connections bound to a
+// transaction share their pools with the Manager's and aren't closed.
 func (c *Connection) Close() error {
+	if c.tx != nil {
+		return nil
+	}
+
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
+	var err error
+	if c.writer != nil {
+		err = c.writer.Close()
+	}
 	if c.DB != nil {
-		return c.DB.Close()
+		if cerr := c.DB.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
 	}
-	return nil
+	if c.onClose != nil {
+		c.onClose()
+		c.onClose = nil
+	}
+	return err
+}
+
+// querier runs statements: a connection pool, or a session's transaction.
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
 }
 
-// Execute runs a query that doesn't return rows (INSERT, UPDATE, DELETE).
+// forQuery returns what to run query on: the transaction the connection is
+// bound to, else the readers for statements that only read and the writer
+// for anything that may write, including PRAGMAs, which can change
+// settings.
+func (c *Connection) forQuery(query string) querier {
+	if c.tx != nil {
+		return c.tx
+	}
+	if c.writer == nil {
+		return c.DB
+	}
+	if ClassifySQL(query).Queries() {
+		return c.DB
+	}
+	return c.writer
+}
+
+// forWrite returns what to run writes on: the bound transaction, else the
+// writer pool.
+func (c *Connection) forWrite() querier {
+	if c.tx != nil {
+		return c.tx
+	}
+	return c.writePool()
+}
+
+// writePool returns the pool to run writes and transactions on. Read-only
+// connections use their readers, where SQLite rejects writes.
+func (c *Connection) writePool() *sql.DB {
+	if c.writer == nil {
+		return c.DB
+	}
+	return c.writer
+}
+
+// Execute runs a query that doesn't return rows (INSERT, UPDATE, DELETE)
+// on the writer.
 // Note: sql.DB handles its own connection pooling and locking, so we don't
 // need to hold a mutex during these operations. The mutex is only used for
 // protecting Connection struct fields.
 func (c *Connection) Execute(query string, args ...any) (sql.Result, error) {
-	return c.DB.Exec(query, args...)
+	return c.ExecuteContext(context.Background(), query, args...)
 }
 
-// Query runs a query that returns rows.
+// ExecuteContext is Execute with a context; cancelling it interrupts the
+// statement.
+func (c *Connection) ExecuteContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	var result sql.Result
+	err := c.retryBusy(ctx, func() (err error) {
+		result, err = c.forWrite().ExecContext(ctx, query, args...)
+		return err
+	})
+	return result, err
+}
+
+// Query runs a query that returns rows, on a reader unless it may write.
 func (c *Connection) Query(query string, args ...any) (*sql.Rows, error) {
-	return c.DB.Query(query, args...)
+	return c.QueryContext(context.Background(), query, args...)
+}
+
+// QueryContext is Query with a context; cancelling it interrupts the query
+// and stops reading rows.
+func (c *Connection) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	var rows *sql.Rows
+	err := c.retryBusy(ctx, func() (err error) {
+		rows, err = c.forQuery(query).QueryContext(ctx, query, args...)
+		return err
+	})
+	return rows, err
 }
 
 // QueryRow runs a query that returns at most one row.
 func (c *Connection) QueryRow(query string, args ...any) *sql.Row {
-	return c.DB.QueryRow(query, args...)
+	ctx := context.Background()
+	var row *sql.Row
+	c.retryBusy(ctx, func() error {
+		row = c.forQuery(query).QueryRowContext(ctx, query, args...)
+		return row.Err()
+	})
+	return row
+}
+
+// retryBusy runs fn again while it fails because the database is locked,
+// waiting with exponential backoff and jitter in between. It gives up when
+// ctx ends or its deadline, the query timeout, would pass while waiting.
+// Statements in a transaction aren't retried: only the whole transaction
+// could be.
+func (c *Connection) retryBusy(ctx context.Context, fn func() error) error {
+	err := fn()
+	if c.tx != nil {
+		return err
+	}
+	delay := c.busyRetry.BaseDelay
+	for i := 0; i < c.busyRetry.Retries && IsWALLockError(err); i++ {
+		wait := delay/2 + rand.N(delay/2+1)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			return err
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		err = fn()
+		if delay *= 2; delay > c.busyRetry.MaxDelay {
+			delay = c.busyRetry.MaxDelay
+		}
+	}
+	return err
 }
 
-// Begin starts a new transaction.
+// SetPragma sets a pragma and returns its value before and after, both
+// read on the writer connection that set it. Pooled connections don't
+// share per-connection settings, and some values only take effect later,
+// as auto_vacuum does after a VACUUM, so the value read back is the one
+// that took.
+func (c *Connection) SetPragma(ctx context.Context, name, value string) (previous, current any, err error) {
+	if c.tx != nil {
+		return nil, nil, ErrInTransaction
+	}
+	conn, err := c.writePool().Conn(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer conn.Close()
+
+	read := func() (v any, err error) {
+		err = conn.QueryRowContext(ctx, "PRAGMA "+name).Scan(&v)
+		return v, err
+	}
+	if previous, err = read(); err != nil {
+		return nil, nil, err
+	}
+	if _, err = conn.ExecContext(ctx, fmt.Sprintf("PRAGMA %s = %s", name, value)); err != nil {
+		return nil, nil, err
+	}
+	if current, err = read(); err != nil {
+		return nil, nil, err
+	}
+	return previous, current, nil
+}
+
+// Begin starts a new transaction on the writer.
 func (c *Connection) Begin() (*sql.Tx, error) {
-	return c.DB.Begin()
+	if c.tx != nil {
+		return nil, ErrInTransaction
+	}
+	return c.writePool().Begin()
+}
+
+// savepointSeq numbers the savepoints of nested WithTransaction calls.
+var savepointSeq atomic.Int64
+
+// withSavepoint runs fn in a savepoint of the bound transaction, rolling
+// back to it if fn fails.
+func (c *Connection) withSavepoint(fn func(*sql.Tx) error) error {
+	name := quoteIdentifier(fmt.Sprintf("nested_%d", savepointSeq.Add(1)))
+	if _, err := c.tx.Exec("SAVEPOINT " + name); err != nil {
+		return err
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			c.tx.Exec("ROLLBACK TO " + name)
+			c.tx.Exec("RELEASE " + name)
+			panic(p)
+		}
+	}()
+
+	if err := fn(c.tx); err != nil {
+		c.tx.Exec("ROLLBACK TO " + name)
+		c.tx.Exec("RELEASE " + name)
+		return err
+	}
+
+	_, err := c.tx.Exec("RELEASE " + name)
+	return err
 }
 
-// WithTransaction executes a function within a transaction.
+// inTx returns a connection running every statement in tx, sharing c's
+// pools.
+func (c *Connection) inTx(tx *sql.Tx) *Connection {
+	return &Connection{
+		DB:       c.DB,
+		Path:     c.Path,
+		ReadOnly: c.ReadOnly,
+		writer:   c.writer,
+		tx:       tx,
+		opts:     c.opts,
+	}
+}
+
+// WithTransaction executes a function within a transaction. On a
+// connection bound to a session's transaction it runs in a savepoint
+// instead, so a failure undoes only fn's work.
 func (c *Connection) WithTransaction(fn func(*sql.Tx) error) error {
+	if c.tx != nil {
+		return c.withSavepoint(fn)
+	}
+
 	tx, err := c.Begin()
 	if err != nil {
 		return err
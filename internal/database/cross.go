@@ -0,0 +1,120 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/johan-st/sqlite-tui/internal/access"
+)
+
+// ReferencedDatabases returns the aliases of the other managed databases a
+// query names tables in, as in SELECT * FROM sales.orders, in the order
+// they first appear. Qualifiers naming SQLite's own schemas or companions
+// the database's source attaches are not references.
+func (m *Manager) ReferencedDatabases(pathOrAlias string, query string) []string {
+	db := m.discovery.GetDatabase(pathOrAlias)
+	if db == nil {
+		return nil
+	}
+
+	var refs []string
+	for _, stmt := range splitStatements(tokenize(query)) {
+		tables := append(classify(stmt).Tables, readTables(stmt, nil)...)
+		for _, table := range tables {
+			for _, other := range m.discovery.GetDatabases() {
+				alias := other.Alias
+				if alias == "" || other.Path == db.Path || slices.Contains(refs, alias) ||
+					!strings.HasPrefix(table, alias+".") || isReservedSchema(alias) {
+					continue
+				}
+				if _, ok := sourceAttach(db)[alias]; ok {
+					continue
+				}
+				refs = append(refs, alias)
+			}
+		}
+	}
+	return refs
+}
+
+// ExecuteCrossQuery executes a query over several databases: the first
+// alias is the database queried, and the others are attached for the
+// duration of the query, each access-checked as for ExecuteQueryAttached.
+// Tables are qualified by alias in the query; aliases that can't be used
+// as schema names are rewritten to ones that can.
+func (m *Manager) ExecuteCrossQuery(ctx context.Context, aliases []string, user *access.UserInfo, sessionID string, query string) (*QueryResult, error) {
+	if len(aliases) == 0 {
+		return nil, fmt.Errorf("%w: no database to query", ErrInvalidAttachment)
+	}
+
+	used := make(map[string]bool)
+	for schema := range sourceAttach(m.discovery.GetDatabase(aliases[0])) {
+		used[strings.ToLower(schema)] = true
+	}
+	var attachments []Attachment
+	schemas := make(map[string]string)
+	for _, alias := range aliases[1:] {
+		if _, ok := schemas[alias]; ok {
+			continue
+		}
+		schema := crossSchema(alias, used)
+		schemas[alias] = schema
+		attachments = append(attachments, Attachment{Database: alias, Schema: schema})
+	}
+
+	// The attachments are closed with the query's connection, which
+	// detaches them
+	return m.ExecuteQueryAttached(ctx, aliases[0], attachments, user, sessionID, renameQualifiers(query, schemas))
+}
+
+// crossSchema returns a schema name for attaching a database by alias: the
+// alias with characters schema names can't hold replaced by underscores,
+// numbered when that name is reserved or already used.
+func crossSchema(alias string, used map[string]bool) string {
+	var b strings.Builder
+	for i, r := range alias {
+		switch {
+		case r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z':
+		case r >= '0' && r <= '9' && i > 0:
+		case r >= '0' && r <= '9':
+			b.WriteByte('_')
+		default:
+			r = '_'
+		}
+		b.WriteRune(r)
+	}
+
+	base := b.String()
+	schema := base
+	for n := 2; isReservedSchema(schema) || used[strings.ToLower(schema)]; n++ {
+		schema = base + "_" + strconv.Itoa(n)
+	}
+	used[strings.ToLower(schema)] = true
+	return schema
+}
+
+// renameQualifiers replaces the qualifiers in a query that name a key of
+// schemas, bare or quoted, with the schema name it maps to. Other text,
+// including strings and comments, is left as it is.
+func renameQualifiers(query string, schemas map[string]string) string {
+	toks := tokenize(query)
+	var b strings.Builder
+	last := 0
+	for i, t := range toks {
+		if t.kind != tokWord && t.kind != tokQuoted {
+			continue
+		}
+		schema, ok := schemas[t.text]
+		if !ok || i+1 >= len(toks) || !toks[i+1].is(".") || i > 0 && toks[i-1].is(".") {
+			continue
+		}
+		b.WriteString(query[last:t.pos])
+		b.WriteString(quoteIdentifier(schema))
+		last = toks[i+1].pos
+	}
+	b.WriteString(query[last:])
+	return b.String()
+}
@@ -1,9 +1,13 @@
 package database
 
 import (
-	"log"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
 
@@ -20,6 +24,14 @@ type DiscoveredDatabase struct {
 	Size        int64
 	ModTime     int64
 	Source      *config.DatabaseSource
+	Key         string // encryption key, "" for plain databases
+
+	// Aliases are the other names the same file was found under, through
+	// symlinks or overlapping sources; GetDatabase finds it by them too
+	Aliases []string
+
+	file     string // identifies the file whatever path reaches it
+	realPath string // Path with symlinks resolved
 }
 
 // Discovery handles database file discovery and watching.
@@ -29,6 +41,7 @@ type Discovery struct {
 	watcher   *fsnotify.Watcher
 	callbacks []func(added, removed []*DiscoveredDatabase)
 	stop      chan struct{}
+	running   bool
 	mu        sync.RWMutex
 }
 
@@ -65,11 +78,22 @@ func (d *Discovery) Start() error {
 	}
 
 	// Start watching
+	d.mu.Lock()
+	d.running = true
+	d.mu.Unlock()
 	go d.watch()
 
 	return nil
 }
 
+// Running reports whether discovery is started and still watching for
+// changes.
+func (d *Discovery) Running() bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.running
+}
+
 // Stop stops the discovery service.
 func (d *Discovery) Stop() {
 	close(d.stop)
@@ -104,28 +128,60 @@ func (d *Discovery) GetDatabase(pathOrAlias string) *DiscoveredDatabase {
 			return db
 		}
 	}
+	for _, db := range d.databases {
+		if slices.Contains(db.Aliases, pathOrAlias) {
+			return db
+		}
+	}
 
 	return nil
 }
 
+// refreshStat updates the size and modification time of a known database
+// from its file, without rescanning its source. It returns the updated
+// database, or nil if it isn't known or its file can't be read.
+func (d *Discovery) refreshStat(path string) *DiscoveredDatabase {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	db, ok := d.databases[path]
+	if !ok {
+		return nil
+	}
+	// Replaced rather than modified, as callers may hold the old one
+	updated := *db
+	updated.Size = info.Size()
+	updated.ModTime = info.ModTime().Unix()
+	d.databases[path] = &updated
+	return &updated
+}
+
 // scan discovers all database files from configured sources.
 func (d *Discovery) scan() error {
 	d.mu.Lock()
 	defer d.mu.Unlock()
 
-	newDatabases := make(map[string]*DiscoveredDatabase)
+	files := make(map[string]*DiscoveredDatabase)
 	watchPaths := make(map[string]bool)
 
 	for i := range d.sources {
 		source := &d.sources[i]
 		found, watchDirs, err := d.discoverSource(source)
 		if err != nil {
-			log.Printf("warning: failed to discover databases from %s: %v", source.Path, err)
+			slog.Warn("Failed to discover databases", "source", source.Path, "err", err)
 			continue
 		}
 
+		// The same file may be reached by several paths; list it once
 		for _, db := range found {
-			newDatabases[db.Path] = db
+			if prev, ok := files[db.file]; ok {
+				db = preferDuplicate(prev, db)
+			}
+			files[db.file] = db
 		}
 
 		for _, dir := range watchDirs {
@@ -133,6 +189,11 @@ func (d *Discovery) scan() error {
 		}
 	}
 
+	newDatabases := make(map[string]*DiscoveredDatabase, len(files))
+	for _, db := range files {
+		newDatabases[db.Path] = db
+	}
+
 	// Determine added and removed databases
 	var added, removed []*DiscoveredDatabase
 
@@ -169,6 +230,11 @@ func (d *Discovery) discoverSource(source *config.DatabaseSource) ([]*Discovered
 	var watchDirs []string
 
 	path := source.Path
+	for _, pattern := range source.Exclude {
+		if !doublestar.ValidatePattern(pattern) {
+			return nil, nil, fmt.Errorf("invalid exclude pattern: %q", pattern)
+		}
+	}
 
 	// Check if it's a glob pattern
 	if strings.ContainsAny(path, "*?[") {
@@ -177,11 +243,12 @@ func (d *Discovery) discoverSource(source *config.DatabaseSource) ([]*Discovered
 			return nil, nil, err
 		}
 
+		root := filepath.Dir(strings.Split(path, "*")[0])
 		for _, match := range matches {
-			if isSQLiteFile(match) {
+			if !excluded(source, root, match) && isSQLiteFile(match, source) {
 				db, err := d.createDiscoveredDB(match, source)
 				if err != nil {
-					log.Printf("warning: failed to stat %s: %v", match, err)
+					slog.Warn("Failed to stat database", "path", match, "err", err)
 					continue
 				}
 				databases = append(databases, db)
@@ -209,10 +276,13 @@ func (d *Discovery) discoverSource(source *config.DatabaseSource) ([]*Discovered
 			if err != nil {
 				return nil // Skip errors
 			}
-			if d.IsDir() && filePath != path && !source.Recursive {
+			if d.IsDir() && filePath != path && (!source.Recursive || excluded(source, path, filePath)) {
 				return filepath.SkipDir
 			}
-			if !d.IsDir() && isSQLiteFile(filePath) {
+			if !d.IsDir() && excluded(source, path, filePath) {
+				return nil
+			}
+			if !d.IsDir() && isSQLiteFile(filePath, source) {
 				db, err := createDiscoveredDBFromPath(filePath, source)
 				if err == nil {
 					databases = append(databases, db)
@@ -227,15 +297,17 @@ func (d *Discovery) discoverSource(source *config.DatabaseSource) ([]*Discovered
 		return databases, watchDirs, nil
 	}
 
-	// Single file
-	if isSQLiteFile(path) {
-		db, err := d.createDiscoveredDB(path, source)
-		if err != nil {
-			return nil, nil, err
-		}
-		databases = append(databases, db)
-		watchDirs = append(watchDirs, filepath.Dir(path))
+	// Single file, which is named explicitly and so must be a database,
+	// unless it's encrypted and so has no header
+	if err := CheckSQLiteFile(path); err != nil && !source.Encrypted() {
+		return nil, nil, err
 	}
+	db, err := d.createDiscoveredDB(path, source)
+	if err != nil {
+		return nil, nil, err
+	}
+	databases = append(databases, db)
+	watchDirs = append(watchDirs, filepath.Dir(path))
 
 	return databases, watchDirs, nil
 }
@@ -255,6 +327,18 @@ func createDiscoveredDBFromPath(path string, source *config.DatabaseSource) (*Di
 	if err != nil {
 		return nil, err
 	}
+	key, err := source.GetKey()
+	if err != nil {
+		return nil, err
+	}
+	realPath, err := filepath.EvalSymlinks(absPath)
+	if err != nil {
+		return nil, err
+	}
+	file, ok := fileID(info)
+	if !ok {
+		file = realPath
+	}
 
 	// Generate alias
 	alias := source.Alias
@@ -274,17 +358,152 @@ func createDiscoveredDBFromPath(path string, source *config.DatabaseSource) (*Di
 		Size:        info.Size(),
 		ModTime:     info.ModTime().Unix(),
 		Source:      source,
+		Key:         key,
+		file:        file,
+		realPath:    realPath,
 	}, nil
 }
 
-// isSQLiteFile checks if a file looks like a SQLite database.
-func isSQLiteFile(path string) bool {
+// preferDuplicate returns which of two entries for the same file to list,
+// noting the other's aliases on it: the one whose source sets an alias,
+// then the one not reached through a symlink, then a, which was found
+// first.
+func preferDuplicate(a, b *DiscoveredDatabase) *DiscoveredDatabase {
+	rank := func(db *DiscoveredDatabase) int {
+		r := 0
+		if db.Source != nil && db.Source.Alias != "" {
+			r += 2
+		}
+		if db.Path == db.realPath {
+			r++
+		}
+		return r
+	}
+	keep, other := a, b
+	if rank(b) > rank(a) {
+		keep, other = b, a
+	}
+
+	slog.Debug("Database found more than once", "path", keep.Path, "duplicate", other.Path)
+	for _, alias := range append([]string{other.Alias}, other.Aliases...) {
+		if alias != "" && alias != keep.Alias && !slices.Contains(keep.Aliases, alias) {
+			keep.Aliases = append(keep.Aliases, alias)
+		}
+	}
+	return keep
+}
+
+// excluded reports whether a source's exclude patterns match a path below
+// root: patterns without a slash match any of its names below root, the
+// others the whole of it relative to root.
+func excluded(source *config.DatabaseSource, root, path string) bool {
+	if len(source.Exclude) == 0 {
+		return false
+	}
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		rel = path
+	}
+	rel = filepath.ToSlash(rel)
+
+	for _, pattern := range source.Exclude {
+		if strings.Contains(pattern, "/") {
+			if ok, _ := doublestar.Match(pattern, rel); ok {
+				return true
+			}
+			continue
+		}
+		for _, name := range strings.Split(rel, "/") {
+			if ok, _ := doublestar.Match(pattern, name); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isSQLiteFile checks if a file is a database of a source: by its header,
+// by its extension if the source detects databases that way or is
+// encrypted, or by both. Files named like databases that aren't are
+// logged, since they were likely meant to be.
+func isSQLiteFile(path string, source *config.DatabaseSource) bool {
+	named := hasSourceExt(path, source)
+	switch {
+	case source.Detect == config.DetectExtension || source.Encrypted():
+		return named
+	case source.Detect == config.DetectBoth && !named:
+		return false
+	}
+	err := CheckSQLiteFile(path)
+	if errors.Is(err, ErrNotSQLite) && named {
+		slog.Warn("Skipping file that is not a SQLite database", "path", path)
+	}
+	return err == nil
+}
+
+// CheckSQLiteFile returns an error wrapping ErrNotSQLite unless the file at
+// path starts with the SQLite header. An empty file with a database
+// extension passes: SQLite opens it as an empty database.
+func CheckSQLiteFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	header := make([]byte, len(sqliteHeader))
+	n, err := io.ReadFull(f, header)
+	switch {
+	case n == 0 && HasDatabaseExt(path):
+		return nil
+	case err == io.EOF, err == io.ErrUnexpectedEOF:
+		return fmt.Errorf("%w: %s is too short", ErrNotSQLite, path)
+	case err != nil:
+		return err
+	case !hasSQLiteHeader(header):
+		return fmt.Errorf("%w: %s has no SQLite header", ErrNotSQLite, path)
+	}
+	return nil
+}
+
+// hasSQLiteHeader reports whether b starts with the SQLite header.
+func hasSQLiteHeader(b []byte) bool {
+	return len(b) >= len(sqliteHeader) && string(b[:len(sqliteHeader)]) == sqliteHeader
+}
+
+// HasDatabaseExt reports whether path has an extension that discovery
+// treats as a SQLite database.
+func HasDatabaseExt(path string) bool {
 	ext := strings.ToLower(filepath.Ext(path))
 	return ext == ".db" || ext == ".sqlite" || ext == ".sqlite3" || ext == ".db3"
 }
 
+// hasSourceExt reports whether path has a database extension or one of the
+// source's extra extensions.
+func hasSourceExt(path string, source *config.DatabaseSource) bool {
+	if HasDatabaseExt(path) {
+		return true
+	}
+	ext := filepath.Ext(path)
+	for _, want := range source.Extensions {
+		if want != "" && !strings.HasPrefix(want, ".") {
+			want = "." + want
+		}
+		if strings.EqualFold(ext, want) {
+			return true
+		}
+	}
+	return false
+}
+
 // watch watches for file system changes.
 func (d *Discovery) watch() {
+	defer func() {
+		d.mu.Lock()
+		d.running = false
+		d.mu.Unlock()
+	}()
+
 	for {
 		select {
 		case event, ok := <-d.watcher.Events:
@@ -292,19 +511,16 @@ func (d *Discovery) watch() {
 				return
 			}
 
-			// Handle file changes
-			if event.Has(fsnotify.Create) || event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename) {
-				if isSQLiteFile(event.Name) {
-					// Rescan to pick up changes
-					d.scan()
-				}
+			// Rescan to pick up changes
+			if d.relevant(event) {
+				d.scan()
 			}
 
 		case err, ok := <-d.watcher.Errors:
 			if !ok {
 				return
 			}
-			log.Printf("discovery watcher error: %v", err)
+			slog.Error("Discovery watcher error", "err", err)
 
 		case <-d.stop:
 			return
@@ -312,6 +528,48 @@ func (d *Discovery) watch() {
 	}
 }
 
+// relevant reports whether a file system event may add or remove a
+// database: a known database going away, or a file appearing or being
+// written that could be one.
+func (d *Discovery) relevant(event fsnotify.Event) bool {
+	path, err := filepath.Abs(event.Name)
+	if err != nil {
+		return false
+	}
+	for _, suffix := range []string{"-wal", "-shm", "-journal"} {
+		if strings.HasSuffix(path, suffix) {
+			return false
+		}
+	}
+	d.mu.RLock()
+	_, known := d.databases[path]
+	named := false
+	for i := range d.sources {
+		named = named || hasSourceExt(path, &d.sources[i])
+	}
+	d.mu.RUnlock()
+
+	switch {
+	case known:
+		return event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename)
+	case event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename):
+		return false
+	case event.Has(fsnotify.Create) && named:
+		return true
+	case event.Has(fsnotify.Create) || event.Has(fsnotify.Write):
+		// Files copied in are only recognizable once the header is written
+		f, err := os.Open(path)
+		if err != nil {
+			return false
+		}
+		defer f.Close()
+		header := make([]byte, len(sqliteHeader))
+		_, err = io.ReadFull(f, header)
+		return err == nil && hasSQLiteHeader(header)
+	}
+	return false
+}
+
 // notifyCallbacks notifies all registered callbacks.
 func (d *Discovery) notifyCallbacks(added, removed []*DiscoveredDatabase) {
 	d.mu.RLock()
@@ -0,0 +1,95 @@
+package database
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net/url"
+	"sync"
+)
+
+// ErrEncryptionUnsupported is returned when opening an encrypted database
+// with a driver that can't decrypt it.
+var ErrEncryptionUnsupported = errors.New("the SQLite driver of this build can't open encrypted databases")
+
+// Driver is a SQLite database/sql driver databases are opened with.
+// Builds can plug in another, e.g. one linked against SQLCipher, with
+// SetDriver from an init function.
+type Driver struct {
+	// Name is the name the driver is registered under with database/sql.
+	Name string
+
+	// DSN returns the data source name that opens a database as p says.
+	DSN func(p DSNParams) string
+
+	// Encryption reports whether the driver opens encrypted databases
+	// given DSNParams.Key.
+	Encryption bool
+}
+
+// DSNParams say how to open a database.
+type DSNParams struct {
+	Path      string
+	Mode      string   // "ro" or "rwc"
+	Pragmas   []string // set on every new connection, each as name(value)
+	Immutable bool
+	Key       string // encryption key, "" for plain databases
+}
+
+// DefaultDriver is the pure Go SQLite driver. It can't open encrypted
+// databases.
+var DefaultDriver = Driver{Name: "sqlite", DSN: moderncDSN}
+
+var (
+	driverMu      sync.RWMutex
+	currentDriver = DefaultDriver
+)
+
+// SetDriver makes databases opened from now on use d.
+func SetDriver(d Driver) {
+	driverMu.Lock()
+	currentDriver = d
+	driverMu.Unlock()
+}
+
+// activeDriver returns the driver databases are opened with.
+func activeDriver() Driver {
+	driverMu.RLock()
+	defer driverMu.RUnlock()
+	return currentDriver
+}
+
+// sqlDriver returns the database/sql driver registered as name.
+func sqlDriver(name string) (driver.Driver, error) {
+	db, err := sql.Open(name, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+	return db.Driver(), nil
+}
+
+// moderncDSN returns the DSN for the pure Go driver, which runs the
+// _pragma parameters in order on each new connection.
+func moderncDSN(p DSNParams) string {
+	q := url.Values{"mode": {p.Mode}, "_pragma": p.Pragmas}
+	if p.Immutable {
+		q.Set("immutable", "1")
+	}
+	return fileURI(p.Path, q)
+}
+
+// fileURI returns the SQLite URI of the file at path with query q. The
+// path is percent-escaped, so a '?', '#' or '%' in it can't end it early
+// or be decoded into something else.
+func fileURI(path string, q url.Values) string {
+	u := url.URL{Scheme: "file", Opaque: (&url.URL{Path: path}).EscapedPath(), RawQuery: q.Encode()}
+	return u.String()
+}
+
+// EncryptionSupported reports whether the driver databases are opened with
+// can open encrypted ones.
+func EncryptionSupported() bool {
+	return activeDriver().Encryption
+}
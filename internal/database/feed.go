@@ -0,0 +1,406 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/johan-st/sqlite-tui/internal/access"
+	"github.com/johan-st/sqlite-tui/internal/hooks"
+)
+
+// ErrNoFeedKey is returned for tables a change feed can't follow.
+var ErrNoFeedKey = errors.New("table has neither a key nor an updated_at column to follow")
+
+// Change feed operations.
+const (
+	FeedInsert = "insert"
+	FeedUpdate = "update"
+)
+
+// maxFeedBatch is the most rows a change feed reads in one poll; the rest
+// follow in the next.
+const maxFeedBatch = 1000
+
+// feedStampColumns are the column names taken to hold the time a row was
+// last updated.
+var feedStampColumns = []string{"updated_at", "modified_at", "updated", "modified"}
+
+// FeedEvent is a row a change feed found added or updated.
+type FeedEvent struct {
+	Table   string
+	Op      string // FeedInsert or FeedUpdate
+	Columns []string
+	Row     []any
+	Key     any   // the row's key, for inserts
+	Err     error // set on the last event of a feed that failed
+}
+
+// ChangeFeed finds the rows added to or updated in a table since it last
+// looked, by polling with two heuristics: rows past the greatest key (the
+// rowid, or the primary key of a WITHOUT ROWID table) are new, and rows
+// with a later updated_at (or modified_at) are updated. Deleted rows and
+// updates to tables without such a column go unnoticed. Tables with no key
+// report every row with a later update time as updated.
+type ChangeFeed struct {
+	conn   *Connection
+	connMu sync.Mutex
+	table  string
+	key    string // column new rows are found by, "" for none
+	stamp  string // column updated rows are found by, "" for none
+
+	lastKey   any // greatest key seen, nil for none
+	lastStamp any // latest update time seen, nil for none
+}
+
+// NewChangeFeed starts following a table from its current rows.
+func NewChangeFeed(ctx context.Context, conn *Connection, table string) (*ChangeFeed, error) {
+	schema := NewSchema(conn)
+	columns, err := schema.GetColumns(table)
+	if err != nil {
+		return nil, err
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrTableNotFound, table)
+	}
+
+	f := &ChangeFeed{conn: conn, table: table, key: schema.KeyColumn(table)}
+	for _, col := range columns {
+		if slices.Contains(feedStampColumns, strings.ToLower(col.Name)) {
+			f.stamp = col.Name
+			break
+		}
+	}
+	if f.key == "" && f.stamp == "" {
+		return nil, fmt.Errorf("%w: %s", ErrNoFeedKey, table)
+	}
+
+	if f.key != "" {
+		if f.lastKey, err = f.max(ctx, f.key); err != nil {
+			return nil, err
+		}
+	}
+	if f.stamp != "" {
+		if f.lastStamp, err = f.max(ctx, f.stamp); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// Table returns the table followed.
+func (f *ChangeFeed) Table() string {
+	return f.table
+}
+
+// SetConnection switches the feed to another connection to the same
+// database, e.g. after its connection was closed.
+func (f *ChangeFeed) SetConnection(conn *Connection) {
+	f.connMu.Lock()
+	f.conn = conn
+	f.connMu.Unlock()
+}
+
+// connection returns the connection the feed reads with.
+func (f *ChangeFeed) connection() *Connection {
+	f.connMu.Lock()
+	defer f.connMu.Unlock()
+	return f.conn
+}
+
+// max returns the greatest value of a column.
+func (f *ChangeFeed) max(ctx context.Context, column string) (any, error) {
+	var v any
+	query := fmt.Sprintf("SELECT MAX(%s) FROM %s", quoteIdentifier(column), quoteIdentifier(f.table))
+	if err := f.connection().DB.QueryRowContext(ctx, query).Scan(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// Recent returns the last n rows of the table, oldest first: by key, or by
+// update time for tables without one.
+func (f *ChangeFeed) Recent(ctx context.Context, n int) (*QueryResult, error) {
+	order := f.key
+	if order == "" {
+		order = f.stamp
+	}
+	columns, rows, _, err := f.read(ctx, order, "", nil, true, n)
+	if err != nil {
+		return nil, err
+	}
+	slices.Reverse(rows)
+	return &QueryResult{Columns: columns, Rows: rows, IsSelect: true}, nil
+}
+
+// Poll returns the rows updated and then the rows added since the last
+// poll, at most maxFeedBatch of each.
+func (f *ChangeFeed) Poll(ctx context.Context) ([]FeedEvent, error) {
+	var events []FeedEvent
+
+	// Updates first, leaving out rows past the last key: those are new
+	if f.stamp != "" {
+		where, args := feedAfter(f.stamp, f.lastStamp)
+		if f.key != "" && f.lastKey != nil {
+			where += " AND " + quoteIdentifier(f.key) + " <= ?"
+			args = append(args, f.lastKey)
+		}
+		columns, rows, stamps, err := f.read(ctx, f.stamp, where, args, false, maxFeedBatch)
+		if err != nil {
+			return nil, err
+		}
+		for i, row := range rows {
+			events = append(events, FeedEvent{Table: f.table, Op: FeedUpdate, Columns: columns, Row: row})
+			f.lastStamp = stamps[i]
+		}
+	}
+
+	if f.key != "" {
+		where, args := feedAfter(f.key, f.lastKey)
+		columns, rows, keys, err := f.read(ctx, f.key, where, args, false, maxFeedBatch)
+		if err != nil {
+			return nil, err
+		}
+		for i, row := range rows {
+			events = append(events, FeedEvent{Table: f.table, Op: FeedInsert, Columns: columns, Row: row, Key: keys[i]})
+			f.lastKey = keys[i]
+		}
+		// New rows carry their own update times; don't report them again
+		if f.stamp != "" && len(rows) > 0 {
+			if stamp, err := f.max(ctx, f.stamp); err == nil {
+				f.lastStamp = stamp
+			}
+		}
+	}
+	return events, nil
+}
+
+// feedAfter returns the condition selecting rows whose column is past last,
+// or where it is set at all when nothing was seen yet.
+func feedAfter(column string, last any) (string, []any) {
+	if last == nil {
+		return quoteIdentifier(column) + " IS NOT NULL", nil
+	}
+	return quoteIdentifier(column) + " > ?", []any{last}
+}
+
+// read selects up to limit rows matching where, ordered by column, and
+// returns each row's value of the column alongside.
+func (f *ChangeFeed) read(ctx context.Context, column, where string, args []any, desc bool, limit int) ([]string, [][]any, []any, error) {
+	col := quoteIdentifier(column)
+	query := fmt.Sprintf("SELECT *, %s FROM %s", col, quoteIdentifier(f.table))
+	if where != "" {
+		query += " WHERE " + where
+	}
+	query += " ORDER BY " + col
+	if desc {
+		query += " DESC"
+	}
+	query += fmt.Sprintf(" LIMIT %d", limit)
+
+	rows, err := QueryRows(ctx, f.connection(), query, args...)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer rows.Close()
+
+	columns := rows.Columns()
+	columns = columns[:len(columns)-1]
+	var data [][]any
+	var orders []any
+	for rows.Next() {
+		row := rows.Row()
+		last := len(row) - 1
+		data = append(data, capCells(row[:last:last], MaxCellSize))
+		orders = append(orders, row[last])
+	}
+	return columns, data, orders, rows.Err()
+}
+
+// Follow streams the rows added to or updated in a table from now on,
+// until ctx is done, when the channel is closed. The table is polled when
+// the database changes, see WatchChanges. A feed that fails ends with an
+// event holding the error.
+func (m *Manager) Follow(ctx context.Context, pathOrAlias string, user *access.UserInfo, table string) (*ChangeFeed, <-chan FeedEvent, error) {
+	db := m.discovery.GetDatabase(pathOrAlias)
+	if db == nil {
+		return nil, nil, fmt.Errorf("%w: %s", ErrDatabaseNotFound, pathOrAlias)
+	}
+	if !m.TableAccessLevel(user, pathOrAlias, table).CanRead() {
+		return nil, nil, fmt.Errorf("%w to table: %s", ErrAccessDenied, table)
+	}
+	conn, err := m.OpenConnection(pathOrAlias, user)
+	if err != nil {
+		return nil, nil, err
+	}
+	feed, err := NewChangeFeed(ctx, conn, table)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Keep the connection in use, or idle eviction closes it and changes
+	// are no longer watched for
+	keepOpen := time.NewTicker(changePollInterval)
+
+	changes := m.WatchChanges(ctx)
+	events := make(chan FeedEvent, changeBuffer)
+	go func() {
+		defer close(events)
+		defer keepOpen.Stop()
+
+		for {
+			select {
+			case <-keepOpen.C:
+				if conn, err := m.OpenConnection(pathOrAlias, user); err == nil {
+					feed.SetConnection(conn)
+				}
+				continue
+			case change, ok := <-changes:
+				if !ok {
+					return
+				}
+				if change.Path != db.Path {
+					continue
+				}
+			}
+
+			if conn, err := m.OpenConnection(pathOrAlias, user); err == nil {
+				feed.SetConnection(conn)
+			}
+			batch, err := feed.Poll(ctx)
+			if err != nil {
+				select {
+				case events <- FeedEvent{Table: table, Err: err}:
+				case <-ctx.Done():
+				}
+				return
+			}
+			for _, e := range batch {
+				select {
+				case events <- e:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return feed, events, nil
+}
+
+// changeHooksInterval is how often the tables followed for the change
+// hooks are matched to the config, and feeds that failed are restarted.
+var changeHooksInterval = 10 * time.Second
+
+// changeHooksUser follows tables for the change hooks. Hooks are set up by
+// whoever runs the server, so they see every table, as the write hooks do.
+var changeHooksUser = &access.UserInfo{Name: "hooks", IsAdmin: true}
+
+// changeHook is a table followed for the change hooks.
+type changeHook struct {
+	cancel context.CancelFunc
+	done   chan struct{} // closed when the feed ends
+}
+
+// changeHooksLoop follows the tables listed under hooks.watch while change
+// hooks are configured, firing a change event for each row their feeds
+// find, until Stop. Config reloads apply every interval. Entries that
+// can't be followed are retried, with the reason logged once.
+func (m *Manager) changeHooksLoop(interval time.Duration) {
+	running := make(map[string]*changeHook)
+	failed := make(map[string]string) // why each entry can't be followed
+	defer func() {
+		for _, h := range running {
+			h.cancel()
+		}
+	}()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		var watches []string
+		if m.hooks.Enabled(hooks.Change) {
+			watches = m.cfg.GetHookWatches()
+		}
+		for watch, h := range running {
+			select {
+			case <-h.done:
+				delete(running, watch)
+				continue
+			default:
+			}
+			if !slices.Contains(watches, watch) {
+				h.cancel()
+				delete(running, watch)
+			}
+		}
+		for _, watch := range watches {
+			if running[watch] != nil {
+				continue
+			}
+			h, err := m.startChangeHook(watch)
+			if err != nil {
+				if failed[watch] != err.Error() {
+					slog.Warn("Failed to watch table for hooks", "watch", watch, "err", err)
+					failed[watch] = err.Error()
+				}
+				continue
+			}
+			delete(failed, watch)
+			running[watch] = h
+		}
+
+		select {
+		case <-m.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// startChangeHook follows a "database/table" for the change hooks.
+func (m *Manager) startChangeHook(watch string) (*changeHook, error) {
+	i := strings.LastIndex(watch, "/")
+	if i <= 0 || i == len(watch)-1 {
+		return nil, fmt.Errorf("want database/table")
+	}
+	pathOrAlias, table := watch[:i], watch[i+1:]
+	db := m.discovery.GetDatabase(pathOrAlias)
+	if db == nil {
+		return nil, fmt.Errorf("%w: %s", ErrDatabaseNotFound, pathOrAlias)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	_, events, err := m.Follow(ctx, pathOrAlias, changeHooksUser, table)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	h := &changeHook{cancel: cancel, done: make(chan struct{})}
+	go func() {
+		defer close(h.done)
+		for e := range events {
+			if e.Err != nil {
+				slog.Warn("Change feed for hooks failed, restarting", "watch", watch, "err", e.Err)
+				continue
+			}
+			row := make(map[string]any, len(e.Columns))
+			for i, col := range e.Columns {
+				row[col] = e.Row[i]
+			}
+			m.hooks.Fire(&hooks.Event{
+				Event:    hooks.Change,
+				Database: db.Path,
+				Table:    e.Table,
+				Action:   e.Op,
+				Details:  row,
+			})
+		}
+	}()
+	return h, nil
+}
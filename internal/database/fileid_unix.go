@@ -0,0 +1,19 @@
+//go:build !windows && !plan9
+
+package database
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// fileID returns the device and inode numbers of a file, which are the same
+// whichever path, link or mount it is reached by.
+func fileID(info os.FileInfo) (string, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return "", false
+	}
+	return fmt.Sprintf("%d:%d", st.Dev, st.Ino), true
+}
@@ -0,0 +1,143 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrNotFTSIndex is returned when a table is not an FTS5 virtual table.
+var ErrNotFTSIndex = errors.New("not an FTS5 index")
+
+// FTSIndexName returns the default index name for a table.
+func FTSIndexName(table string) string {
+	return table + "_fts"
+}
+
+// CreateFTSIndex creates an external-content FTS5 index over columns of
+// table, adds triggers that keep it in sync with the table and fills it
+// with the existing rows. Everything happens in one transaction.
+func CreateFTSIndex(conn *Connection, table, index string, columns []string) error {
+	if len(columns) == 0 {
+		return errors.New("at least one column is required")
+	}
+
+	// Check the columns up front for a clearer error than SQLite gives
+	existing, err := NewSchema(conn).GetColumns(table)
+	if err != nil {
+		return err
+	}
+	known := make(map[string]bool, len(existing))
+	for _, c := range existing {
+		known[strings.ToLower(c.Name)] = true
+	}
+	for _, c := range columns {
+		if !known[strings.ToLower(c)] {
+			return fmt.Errorf("no such column: %s", c)
+		}
+	}
+
+	idx := quoteIdentifier(index)
+	tbl := quoteIdentifier(table)
+	cols := make([]string, len(columns))
+	newCols := make([]string, len(columns))
+	oldCols := make([]string, len(columns))
+	for i, c := range columns {
+		cols[i] = quoteIdentifier(c)
+		newCols[i] = "new." + quoteIdentifier(c)
+		oldCols[i] = "old." + quoteIdentifier(c)
+	}
+	colList := strings.Join(cols, ", ")
+
+	insertNew := fmt.Sprintf("INSERT INTO %s(rowid, %s) VALUES (new.rowid, %s);",
+		idx, colList, strings.Join(newCols, ", "))
+	deleteOld := fmt.Sprintf("INSERT INTO %s(%s, rowid, %s) VALUES ('delete', old.rowid, %s);",
+		idx, idx, colList, strings.Join(oldCols, ", "))
+
+	statements := []string{
+		fmt.Sprintf("CREATE VIRTUAL TABLE %s USING fts5(%s, content=%s, content_rowid='rowid')",
+			idx, colList, quoteLiteral(table)),
+		fmt.Sprintf("CREATE TRIGGER %s AFTER INSERT ON %s BEGIN %s END",
+			quoteIdentifier(index+"_ai"), tbl, insertNew),
+		fmt.Sprintf("CREATE TRIGGER %s AFTER DELETE ON %s BEGIN %s END",
+			quoteIdentifier(index+"_ad"), tbl, deleteOld),
+		fmt.Sprintf("CREATE TRIGGER %s AFTER UPDATE ON %s BEGIN %s %s END",
+			quoteIdentifier(index+"_au"), tbl, deleteOld, insertNew),
+		fmt.Sprintf("INSERT INTO %s(%s) VALUES ('rebuild')", idx, idx),
+	}
+
+	return conn.WithTransaction(func(tx *sql.Tx) error {
+		for _, stmt := range statements {
+			if _, err := tx.Exec(stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// RebuildFTSIndex rebuilds an FTS5 index from its content table.
+func RebuildFTSIndex(conn *Connection, index string) error {
+	if err := requireFTSIndex(conn, index); err != nil {
+		return err
+	}
+	idx := quoteIdentifier(index)
+	_, err := conn.Execute(fmt.Sprintf("INSERT INTO %s(%s) VALUES ('rebuild')", idx, idx))
+	return err
+}
+
+// DropFTSIndex drops an FTS5 index and the sync triggers created with it.
+func DropFTSIndex(conn *Connection, index string) error {
+	if err := requireFTSIndex(conn, index); err != nil {
+		return err
+	}
+	return conn.WithTransaction(func(tx *sql.Tx) error {
+		for _, suffix := range []string{"_ai", "_ad", "_au"} {
+			if _, err := tx.Exec("DROP TRIGGER IF EXISTS " + quoteIdentifier(index+suffix)); err != nil {
+				return err
+			}
+		}
+		_, err := tx.Exec("DROP TABLE " + quoteIdentifier(index))
+		return err
+	})
+}
+
+// SearchFTSIndex runs a MATCH query against an FTS5 index, best matches
+// first. When snippet is set a highlighted excerpt column is added.
+func SearchFTSIndex(conn *Connection, index, match string, limit int, snippet bool) (*QueryResult, error) {
+	if err := requireFTSIndex(conn, index); err != nil {
+		return nil, err
+	}
+	idx := quoteIdentifier(index)
+	cols := "rowid, *"
+	if snippet {
+		cols += fmt.Sprintf(", snippet(%s, -1, '[', ']', '…', 10) AS snippet", idx)
+	}
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE %s MATCH ? ORDER BY rank", cols, idx, idx)
+	if limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", limit)
+	}
+	return Query(conn, query, match)
+}
+
+// requireFTSIndex returns an error unless name is an FTS5 virtual table.
+func requireFTSIndex(conn *Connection, name string) error {
+	var ddl string
+	err := conn.QueryRow("SELECT sql FROM sqlite_master WHERE type = 'table' AND name = ?", name).Scan(&ddl)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("%w: %s", ErrTableNotFound, name)
+	}
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(strings.ToLower(ddl), "using fts5") {
+		return fmt.Errorf("%w: %s", ErrNotFTSIndex, name)
+	}
+	return nil
+}
+
+// quoteLiteral quotes a string as an SQL string literal.
+func quoteLiteral(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
@@ -0,0 +1,98 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// maxIntegrityProblems caps the problems an integrity check collects.
+const maxIntegrityProblems = 100
+
+// IntegrityProgress reports how far an integrity check has got.
+type IntegrityProgress struct {
+	Table string // table checked last
+	Done  int    // tables checked so far
+	Total int
+}
+
+// IntegrityReport is the outcome of an integrity check.
+type IntegrityReport struct {
+	Quick    bool
+	Tables   int
+	Problems []string // SQLite's messages, at most maxIntegrityProblems
+}
+
+// OK reports whether the check found no problems.
+func (r *IntegrityReport) OK() bool {
+	return len(r.Problems) == 0
+}
+
+// IntegrityCheck runs PRAGMA integrity_check, or the faster quick_check
+// that skips verifying indexes against their tables, one table at a time.
+// progress, if not nil, is called after each table, and cancelling ctx
+// interrupts the check. Checking by table leaves out SQLite's search for
+// pages that are unused or used twice, which needs a whole-database check.
+func IntegrityCheck(ctx context.Context, conn *Connection, quick bool, progress func(IntegrityProgress)) (*IntegrityReport, error) {
+	pragma := "integrity_check"
+	if quick {
+		pragma = "quick_check"
+	}
+
+	// The schema table itself comes first; it has no entry of its own
+	tables := []string{"sqlite_schema"}
+	rows, err := conn.QueryContext(ctx, "SELECT name FROM sqlite_master WHERE type = 'table' ORDER BY name")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tables: %w", err)
+	}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan table name: %w", err)
+		}
+		tables = append(tables, name)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	report := &IntegrityReport{Quick: quick, Tables: len(tables)}
+	for i, table := range tables {
+		problems, err := checkTable(ctx, conn, pragma, table)
+		if err != nil {
+			return nil, fmt.Errorf("%s of %s: %w", pragma, table, err)
+		}
+		for _, p := range problems {
+			if len(report.Problems) < maxIntegrityProblems {
+				report.Problems = append(report.Problems, p)
+			}
+		}
+		if progress != nil {
+			progress(IntegrityProgress{Table: table, Done: i + 1, Total: len(tables)})
+		}
+	}
+	return report, nil
+}
+
+// checkTable runs an integrity pragma on one table and its indexes,
+// returning the problems found.
+func checkTable(ctx context.Context, conn *Connection, pragma, table string) ([]string, error) {
+	rows, err := conn.QueryContext(ctx, fmt.Sprintf("PRAGMA main.%s(%s)", pragma, quoteIdentifier(table)))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var problems []string
+	for rows.Next() {
+		var msg string
+		if err := rows.Scan(&msg); err != nil {
+			return nil, err
+		}
+		if msg != "ok" {
+			problems = append(problems, msg)
+		}
+	}
+	return problems, rows.Err()
+}
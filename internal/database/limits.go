@@ -0,0 +1,132 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/johan-st/sqlite-tui/internal/access"
+	"github.com/johan-st/sqlite-tui/internal/config"
+	"github.com/johan-st/sqlite-tui/internal/ratelimit"
+)
+
+// ErrQueryTimeout is returned when a query runs past its configured timeout.
+var ErrQueryTimeout = errors.New("query timed out")
+
+// checkQueryLimit takes one query from the user's budget for their access
+// level and returns the caps on the query's result. Users are limited by
+// name; anonymous users by IP, since their names change with every session.
+func (m *Manager) checkQueryLimit(user *access.UserInfo, level access.Level) (resultLimits, error) {
+	anonymous := user == nil || user.IsAnonymous
+	limit := m.cfg.GetQueryLimit(anonymous, level)
+	limits := queryResultLimits(limit)
+	if limit.QueriesPerMinute <= 0 {
+		return limits, nil
+	}
+
+	class := level.String()
+	if anonymous {
+		class = "anonymous"
+	}
+	limiter := m.queryLimiter(class, limit.QueriesPerMinute)
+
+	var key, who string
+	if anonymous {
+		host := ""
+		if user != nil {
+			host = user.RemoteAddr
+			if h, _, err := net.SplitHostPort(host); err == nil {
+				host = h
+			}
+		}
+		key, who = "ip:"+host, "queries from "+host
+	} else {
+		key, who = "user:"+user.Name, "queries by "+user.Name
+	}
+
+	if ok, retry := limiter.Allow(key); !ok {
+		return resultLimits{}, &ratelimit.Error{What: who, RetryAfter: retry}
+	}
+	return limits, nil
+}
+
+// queryResultLimits returns the result caps of a query limit. The byte cap
+// defaults to DefaultMaxResultBytes, for admins too; -1 lifts it.
+func queryResultLimits(limit config.QueryLimit) resultLimits {
+	bytes := limit.MaxResultBytes
+	switch {
+	case bytes == 0:
+		bytes = DefaultMaxResultBytes
+	case bytes < 0:
+		bytes = 0
+	}
+	return resultLimits{rows: limit.MaxRows, bytes: bytes}
+}
+
+// queryLimiter returns the limiter for an access level class, replacing it
+// when the configured rate changed on reload.
+func (m *Manager) queryLimiter(class string, perMinute int) *ratelimit.Limiter {
+	m.limiterMu.Lock()
+	defer m.limiterMu.Unlock()
+
+	limiter := m.limiters[class]
+	if limiter.PerMinute() != perMinute {
+		limiter = ratelimit.New(perMinute)
+		m.limiters[class] = limiter
+	}
+	return limiter
+}
+
+// ExportRowLimit returns the most rows a user may select or export from a
+// database in one command (0 for no cap).
+func (m *Manager) ExportRowLimit(user *access.UserInfo, pathOrAlias string) int {
+	anonymous := user == nil || user.IsAnonymous
+	return m.cfg.GetQueryLimit(anonymous, m.GetAccessLevel(user, pathOrAlias)).MaxExportRows
+}
+
+// QueryTimeout returns how long a user's queries may run in a database: the
+// shorter of the access level's timeout and the database's own, 0 for none.
+func (m *Manager) QueryTimeout(user *access.UserInfo, pathOrAlias string) time.Duration {
+	anonymous := user == nil || user.IsAnonymous
+	timeout := m.cfg.GetQueryLimit(anonymous, m.GetAccessLevel(user, pathOrAlias)).GetTimeout()
+	if db := m.discovery.GetDatabase(pathOrAlias); db != nil && db.Source != nil {
+		if t := db.Source.GetQueryTimeout(); t > 0 && (timeout == 0 || t < timeout) {
+			timeout = t
+		}
+	}
+	return timeout
+}
+
+// WithQueryTimeout runs a query under the user's timeout for the database,
+// turning an expired deadline into ErrQueryTimeout.
+func (m *Manager) WithQueryTimeout(ctx context.Context, user *access.UserInfo, pathOrAlias string, run func(context.Context) (*QueryResult, error)) (*QueryResult, error) {
+	var result *QueryResult
+	err := m.RunWithQueryTimeout(ctx, user, pathOrAlias, func(ctx context.Context) error {
+		var err error
+		result, err = run(ctx)
+		return err
+	})
+	if errors.Is(err, ErrQueryTimeout) {
+		return nil, err
+	}
+	return result, err
+}
+
+// RunWithQueryTimeout is WithQueryTimeout for work that streams its rows,
+// such as exports.
+func (m *Manager) RunWithQueryTimeout(ctx context.Context, user *access.UserInfo, pathOrAlias string, run func(context.Context) error) error {
+	timeout := m.QueryTimeout(user, pathOrAlias)
+	if timeout <= 0 {
+		return run(ctx)
+	}
+
+	qctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	err := run(qctx)
+	if err != nil && ctx.Err() == nil && errors.Is(qctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%w after %s", ErrQueryTimeout, timeout)
+	}
+	return err
+}
@@ -1,103 +1,446 @@
 package database
 
 import (
+	"cmp"
+	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"slices"
 	"sync"
 	"time"
+
+	"github.com/johan-st/sqlite-tui/internal/tracing"
 )
 
 // LockError represents a database locking error.
 type LockError struct {
 	Database string
+	Table    string // the table locked, "" when the whole database is
 	HeldBy   string
 	Since    time.Time
 }
 
 func (e *LockError) Error() string {
+	if e.Table != "" {
+		return fmt.Sprintf("table %q of database %q is locked by %s (since %s)",
+			e.Table, e.Database, e.HeldBy, e.Since.Format(time.Kitchen))
+	}
 	return fmt.Sprintf("database %q is locked by %s (since %s)",
 		e.Database, e.HeldBy, e.Since.Format(time.Kitchen))
 }
 
 // LockInfo contains information about who holds a lock.
 type LockInfo struct {
+	Path      string // the database file
+	Table     string // the table locked, "" for the whole database
 	HeldBy    string
 	SessionID string
 	Since     time.Time
+	Heartbeat time.Time // last sign of life from the holder, see Heartbeat
+	Waiting   int       // sessions queued for the database, set by ListLocks
+}
+
+// lockKey identifies a lock: a table of a database, or with no table the
+// whole database.
+type lockKey struct {
+	path  string
+	table string
+}
+
+// overlaps reports whether two locks on the same database exclude each
+// other: the whole database overlaps every table.
+func overlaps(a, b string) bool {
+	return a == "" || b == "" || a == b
 }
 
 // LockManager manages application-level database locks.
 // This provides clearer error messages than SQLite's built-in locking.
+//
+// Locks are taken on single tables, so writers to unrelated tables of a
+// database don't turn each other away, or on the whole database, which
+// excludes every table lock on it. A session's own locks never exclude
+// each other.
 type LockManager struct {
-	locks map[string]*LockInfo
+	locks map[lockKey]*LockInfo
 	mu    sync.RWMutex
+
+	// queues holds the sessions waiting in LockWait for each database, in
+	// arrival order. Released locks pass straight to the waiters they kept
+	// out, unless an earlier waiter wants an overlapping lock.
+	queues map[string][]*lockWaiter
+}
+
+// lockWaiter is a session queued for a lock.
+type lockWaiter struct {
+	table     string
+	holder    string
+	sessionID string
+	granted   chan struct{} // closed once the lock is handed over
+	moved     chan struct{} // signalled when the waiter's place changes
+}
+
+// LockWaitFunc is told a waiting session's place in the queue for a lock,
+// 1 being next, and who holds the lock, when it starts waiting and each
+// time it moves up.
+type LockWaitFunc func(position int, heldBy string)
+
+// lockWaitKey is the context key for the LockWaitFunc of a request.
+type lockWaitKey struct{}
+
+// WithLockWaitFunc returns a context whose writes report their place in the
+// queue to fn while they wait for the write lock.
+func WithLockWaitFunc(ctx context.Context, fn LockWaitFunc) context.Context {
+	return context.WithValue(ctx, lockWaitKey{}, fn)
+}
+
+// lockWaitFunc returns the LockWaitFunc of ctx, or nil.
+func lockWaitFunc(ctx context.Context) LockWaitFunc {
+	fn, _ := ctx.Value(lockWaitKey{}).(LockWaitFunc)
+	return fn
+}
+
+// lockTimeoutKey is the context key for the lock wait asked for by a
+// request.
+type lockTimeoutKey struct{}
+
+// WithLockTimeout returns a context whose writes wait up to timeout for a
+// write lock held by another session instead of following the database's
+// lock policy, e.g. failing at once. Databases with the "none" policy
+// still skip the lock.
+func WithLockTimeout(ctx context.Context, timeout time.Duration) context.Context {
+	return context.WithValue(ctx, lockTimeoutKey{}, timeout)
+}
+
+// lockTimeout returns the lock wait asked for in ctx, if any.
+func lockTimeout(ctx context.Context) (time.Duration, bool) {
+	timeout, ok := ctx.Value(lockTimeoutKey{}).(time.Duration)
+	return timeout, ok
 }
 
 // NewLockManager creates a new lock manager.
 func NewLockManager() *LockManager {
 	return &LockManager{
-		locks: make(map[string]*LockInfo),
+		locks:  make(map[lockKey]*LockInfo),
+		queues: make(map[string][]*lockWaiter),
 	}
 }
 
-// TryLock attempts to acquire a write lock on a database.
-// Returns nil if successful, or a LockError if already locked.
-func (lm *LockManager) TryLock(dbPath, holder, sessionID string) error {
+// LockWait acquires a write lock on a table of a database, or on the whole
+// database when table is "", queueing behind the sessions holding
+// overlapping locks and any already waiting for up to timeout, or until
+// ctx is done. Waiting sessions get their locks in the order they asked
+// for them. onWait, if not nil, is told the session's place in the queue.
+// On timeout it returns the LockError for a holder at that time.
+func (lm *LockManager) LockWait(ctx context.Context, dbPath, table, holder, sessionID string, timeout time.Duration, onWait LockWaitFunc) error {
+	err := lm.TryLockTable(dbPath, table, holder, sessionID)
+	var lockErr *LockError
+	if !errors.As(err, &lockErr) {
+		return err
+	}
+
+	w := &lockWaiter{
+		table:     table,
+		holder:    holder,
+		sessionID: sessionID,
+		granted:   make(chan struct{}),
+		moved:     make(chan struct{}, 1),
+	}
 	lm.mu.Lock()
-	defer lm.mu.Unlock()
+	lm.queues[dbPath] = append(lm.queues[dbPath], w)
+	// The locks in the way may have gone since
+	lm.grantWaitersLocked(dbPath)
+	lm.mu.Unlock()
 
-	if info, exists := lm.locks[dbPath]; exists {
-		// If same session holds the lock, allow re-entry
-		if info.SessionID == sessionID {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	// Report the starting place
+	select {
+	case w.moved <- struct{}{}:
+	default:
+	}
+	for {
+		select {
+		case <-w.granted:
+			return nil
+		case <-w.moved:
+			if onWait != nil {
+				if position, heldBy := lm.queuePosition(dbPath, w); position > 0 {
+					onWait(position, heldBy)
+				}
+			}
+			continue
+		case <-deadline.C:
+		case <-ctx.Done():
+		}
+
+		// Leave the queue, unless the lock was handed over meanwhile
+		lm.mu.Lock()
+		select {
+		case <-w.granted:
+			lm.mu.Unlock()
+			return nil
+		default:
+		}
+		lm.removeWaiterLocked(dbPath, w)
+		err := lm.lockErrorLocked(dbPath, table, sessionID)
+		lm.mu.Unlock()
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err == nil {
+			// Released just as the wait ran out
+			return lm.TryLockTable(dbPath, table, holder, sessionID)
+		}
+		return err
+	}
+}
+
+// LockWithTimeout acquires a write lock on a database, waiting in line up
+// to timeout for it. A timeout of zero or less fails at once like TryLock.
+func (lm *LockManager) LockWithTimeout(dbPath, holder, sessionID string, timeout time.Duration) error {
+	if timeout <= 0 {
+		return lm.TryLock(dbPath, holder, sessionID)
+	}
+	return lm.LockWait(context.Background(), dbPath, "", holder, sessionID, timeout, nil)
+}
+
+// queuePosition returns w's place in the queue for a database and who
+// holds the lock in its way, or 0 once it left the queue.
+func (lm *LockManager) queuePosition(dbPath string, w *lockWaiter) (int, string) {
+	lm.mu.RLock()
+	defer lm.mu.RUnlock()
+	i := slices.Index(lm.queues[dbPath], w)
+	if i < 0 {
+		return 0, ""
+	}
+	heldBy := ""
+	if info := lm.conflictLocked(dbPath, w.table, w.sessionID); info != nil {
+		heldBy = info.HeldBy
+	}
+	return i + 1, heldBy
+}
+
+// QueueLength returns how many sessions are waiting for a database's locks.
+func (lm *LockManager) QueueLength(dbPath string) int {
+	lm.mu.RLock()
+	defer lm.mu.RUnlock()
+	return len(lm.queues[dbPath])
+}
+
+// conflictLocked returns a lock another session holds that overlaps the
+// lock sessionID wants, or nil. Must be called with lm.mu held.
+func (lm *LockManager) conflictLocked(dbPath, table, sessionID string) *LockInfo {
+	var found *LockInfo
+	for key, info := range lm.locks {
+		if key.path != dbPath || info.SessionID == sessionID || !overlaps(key.table, table) {
+			continue
+		}
+		// The whole-database lock first, for stable errors
+		if found == nil || key.table == "" {
+			found = info
+		}
+	}
+	return found
+}
+
+// queuedConflictLocked returns a waiter among queue, those ahead, that
+// wants a lock overlapping the one sessionID wants, or nil.
+func queuedConflictLocked(queue []*lockWaiter, table, sessionID string) *lockWaiter {
+	for _, w := range queue {
+		if w.sessionID != sessionID && overlaps(w.table, table) {
+			return w
+		}
+	}
+	return nil
+}
+
+// lockErrorLocked returns the LockError keeping sessionID from a lock, or
+// nil if it could take it now. Must be called with lm.mu held.
+func (lm *LockManager) lockErrorLocked(dbPath, table, sessionID string) error {
+	// A session may take again what it holds, waiters or not
+	for _, t := range []string{table, ""} {
+		if info := lm.locks[lockKey{dbPath, t}]; info != nil && info.SessionID == sessionID {
+			return nil
+		}
+	}
+
+	info := lm.conflictLocked(dbPath, table, sessionID)
+	if info == nil {
+		// Jumping the queue is as good as held: report what holds it up
+		w := queuedConflictLocked(lm.queues[dbPath], table, sessionID)
+		if w == nil {
 			return nil
 		}
-		return &LockError{
-			Database: dbPath,
-			HeldBy:   info.HeldBy,
-			Since:    info.Since,
+		if info = lm.conflictLocked(dbPath, w.table, w.sessionID); info == nil {
+			return &LockError{Database: dbPath, Table: w.table, HeldBy: w.holder + " (waiting)", Since: time.Now()}
 		}
 	}
+	return &LockError{Database: dbPath, Table: info.Table, HeldBy: info.HeldBy, Since: info.Since}
+}
 
-	lm.locks[dbPath] = &LockInfo{
+// grantLocked records a lock as held. A session taking a lock it already
+// holds keeps the original. Must be called with lm.mu held.
+func (lm *LockManager) grantLocked(dbPath, table, holder, sessionID string) {
+	key := lockKey{dbPath, table}
+	if info, exists := lm.locks[key]; exists && info.SessionID == sessionID {
+		return
+	}
+	now := time.Now()
+	lm.locks[key] = &LockInfo{
+		Path:      dbPath,
+		Table:     table,
 		HeldBy:    holder,
 		SessionID: sessionID,
-		Since:     time.Now(),
+		Since:     now,
+		Heartbeat: now,
+	}
+}
+
+// grantWaitersLocked hands locks to the waiters of a database that nothing
+// holds up any more, in queue order, and tells the rest if they moved.
+// Must be called with lm.mu held.
+func (lm *LockManager) grantWaitersLocked(dbPath string) {
+	queue := lm.queues[dbPath]
+	changed := false
+	for i := 0; i < len(queue); {
+		w := queue[i]
+		if lm.conflictLocked(dbPath, w.table, w.sessionID) != nil || queuedConflictLocked(queue[:i], w.table, w.sessionID) != nil {
+			i++
+			continue
+		}
+		lm.grantLocked(dbPath, w.table, w.holder, w.sessionID)
+		close(w.granted)
+		queue = slices.Delete(queue, i, i+1)
+		changed = true
+	}
+	if len(queue) == 0 {
+		delete(lm.queues, dbPath)
+	} else {
+		lm.queues[dbPath] = queue
+	}
+	if changed {
+		notifyMoved(queue)
+	}
+}
+
+// notifyMoved tells waiters their place or the lock holder changed.
+func notifyMoved(queue []*lockWaiter) {
+	for _, w := range queue {
+		select {
+		case w.moved <- struct{}{}:
+		default:
+		}
 	}
+}
+
+// removeWaiterLocked takes w out of a database's queue; the waiters behind
+// it move up, and may now get their locks. Must be called with lm.mu held.
+func (lm *LockManager) removeWaiterLocked(dbPath string, w *lockWaiter) {
+	queue := lm.queues[dbPath]
+	i := slices.Index(queue, w)
+	if i < 0 {
+		return
+	}
+	lm.queues[dbPath] = slices.Delete(queue, i, i+1)
+	notifyMoved(lm.queues[dbPath][i:])
+	lm.grantWaitersLocked(dbPath)
+}
+
+// releaseLocked releases a lock, handing it on to the waiters it kept out.
+// Must be called with lm.mu held.
+func (lm *LockManager) releaseLocked(key lockKey) {
+	delete(lm.locks, key)
+	lm.grantWaitersLocked(key.path)
+}
+
+// TryLock attempts to acquire a write lock on a whole database.
+// Returns nil if successful, or a LockError if already locked.
+func (lm *LockManager) TryLock(dbPath, holder, sessionID string) error {
+	return lm.TryLockTable(dbPath, "", holder, sessionID)
+}
+
+// TryLockTable attempts to acquire a write lock on a table of a database,
+// or on the whole database when table is "". It fails with a LockError
+// when another session holds an overlapping lock, or is waiting for one.
+func (lm *LockManager) TryLockTable(dbPath, table, holder, sessionID string) error {
+	span := tracing.Start("db.lock", tracing.Session(sessionID),
+		tracing.String("db.path", dbPath),
+		tracing.String("db.table", table),
+		tracing.String("lock.holder", holder),
+	)
+
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	if err := lm.lockErrorLocked(dbPath, table, sessionID); err != nil {
+		lockErr := err.(*LockError)
+		span.SetAttrs(tracing.String("lock.held_by", lockErr.HeldBy), tracing.Int("lock.held_ms", time.Since(lockErr.Since).Milliseconds()))
+		span.End(err)
+		return err
+	}
+	span.End(nil)
+
+	lm.grantLocked(dbPath, table, holder, sessionID)
 	return nil
 }
 
-// Unlock releases a lock on a database.
+// Check returns the LockError keeping sessionID from a lock on a table of
+// a database, or on the whole database when table is "", without taking
+// it.
+func (lm *LockManager) Check(dbPath, table, sessionID string) error {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	return lm.lockErrorLocked(dbPath, table, sessionID)
+}
+
+// Unlock releases a session's lock on a whole database.
 func (lm *LockManager) Unlock(dbPath, sessionID string) {
+	lm.UnlockTable(dbPath, "", sessionID)
+}
+
+// UnlockTable releases a session's lock on a table of a database, or on
+// the whole database when table is "".
+func (lm *LockManager) UnlockTable(dbPath, table, sessionID string) {
 	lm.mu.Lock()
 	defer lm.mu.Unlock()
 
-	if info, exists := lm.locks[dbPath]; exists {
-		if info.SessionID == sessionID {
-			delete(lm.locks, dbPath)
-		}
+	key := lockKey{dbPath, table}
+	if info, exists := lm.locks[key]; exists && info.SessionID == sessionID {
+		lm.releaseLocked(key)
 	}
 }
 
-// IsLocked checks if a database is locked.
+// IsLocked checks if a database or any of its tables is locked.
 func (lm *LockManager) IsLocked(dbPath string) bool {
 	lm.mu.RLock()
 	defer lm.mu.RUnlock()
-	_, exists := lm.locks[dbPath]
-	return exists
+	for key := range lm.locks {
+		if key.path == dbPath {
+			return true
+		}
+	}
+	return false
 }
 
-// GetLockInfo returns information about who holds a lock.
+// GetLockInfo returns information about who holds a lock on a database:
+// its whole-database lock, else one of its table locks, or nil.
 func (lm *LockManager) GetLockInfo(dbPath string) *LockInfo {
 	lm.mu.RLock()
 	defer lm.mu.RUnlock()
-	if info, exists := lm.locks[dbPath]; exists {
-		return &LockInfo{
-			HeldBy:    info.HeldBy,
-			SessionID: info.SessionID,
-			Since:     info.Since,
+	var found *LockInfo
+	for key, info := range lm.locks {
+		if key.path == dbPath && (found == nil || key.table == "") {
+			found = info
 		}
 	}
-	return nil
+	if found == nil {
+		return nil
+	}
+	c := *found
+	return &c
 }
 
 // ReleaseAllForSession releases all locks held by a session.
@@ -105,29 +448,85 @@ func (lm *LockManager) ReleaseAllForSession(sessionID string) {
 	lm.mu.Lock()
 	defer lm.mu.Unlock()
 
-	for dbPath, info := range lm.locks {
+	for key, info := range lm.locks {
 		if info.SessionID == sessionID {
-			delete(lm.locks, dbPath)
+			lm.releaseLocked(key)
+		}
+	}
+}
+
+// Heartbeat records that a session holding locks is still alive, keeping
+// them from expiring.
+func (lm *LockManager) Heartbeat(sessionID string) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	now := time.Now()
+	for _, info := range lm.locks {
+		if info.SessionID == sessionID {
+			info.Heartbeat = now
+		}
+	}
+}
+
+// ReleaseStale releases a lock if sessionID still holds it and its last
+// heartbeat was before the given time. It reports whether the lock was
+// released.
+func (lm *LockManager) ReleaseStale(dbPath, table, sessionID string, before time.Time) bool {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	key := lockKey{dbPath, table}
+	info, exists := lm.locks[key]
+	if !exists || info.SessionID != sessionID || !info.Heartbeat.Before(before) {
+		return false
+	}
+	lm.releaseLocked(key)
+	return true
+}
+
+// ForceUnlock releases every lock on a database regardless of which
+// session holds it, for clearing locks left behind by crashed sessions.
+// Returns the released locks, none if the database was not locked.
+func (lm *LockManager) ForceUnlock(dbPath string) []*LockInfo {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	var released []*LockInfo
+	for key, info := range lm.locks {
+		if key.path == dbPath {
+			delete(lm.locks, key)
+			released = append(released, info)
 		}
 	}
+	if len(released) > 0 {
+		lm.grantWaitersLocked(dbPath)
+	}
+	sortLocks(released)
+	return released
 }
 
-// ListLocks returns all current locks.
-func (lm *LockManager) ListLocks() map[string]*LockInfo {
+// ListLocks returns all current locks, by database and table.
+func (lm *LockManager) ListLocks() []*LockInfo {
 	lm.mu.RLock()
 	defer lm.mu.RUnlock()
 
-	result := make(map[string]*LockInfo, len(lm.locks))
-	for k, v := range lm.locks {
-		result[k] = &LockInfo{
-			HeldBy:    v.HeldBy,
-			SessionID: v.SessionID,
-			Since:     v.Since,
-		}
+	result := make([]*LockInfo, 0, len(lm.locks))
+	for _, v := range lm.locks {
+		c := *v
+		c.Waiting = len(lm.queues[v.Path])
+		result = append(result, &c)
 	}
+	sortLocks(result)
 	return result
 }
 
+// sortLocks orders locks by database, the whole-database lock first.
+func sortLocks(locks []*LockInfo) {
+	slices.SortFunc(locks, func(a, b *LockInfo) int {
+		return cmp.Or(cmp.Compare(a.Path, b.Path), cmp.Compare(a.Table, b.Table))
+	})
+}
+
 // WithWriteLock executes a function while holding the write lock.
 func (lm *LockManager) WithWriteLock(dbPath, holder, sessionID string, fn func() error) error {
 	if err := lm.TryLock(dbPath, holder, sessionID); err != nil {
@@ -141,7 +540,7 @@ func (lm *LockManager) WithWriteLock(dbPath, holder, sessionID string, fn func()
 // LogWALError logs when we hit the WAL lock (SQLite's internal locking).
 // This should be rare if application-level locking is working correctly.
 func LogWALError(dbPath string, err error) {
-	log.Printf("ERROR: WAL lock encountered on %s: %v (this indicates application lock failure)", dbPath, err)
+	slog.Error("WAL lock encountered, application locking failed", "db", dbPath, "err", err)
 }
 
 // IsWALLockError checks if an error is a SQLite WAL lock error.
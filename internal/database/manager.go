@@ -1,22 +1,77 @@
 package database
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
+	"maps"
 	"os"
+	"slices"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/johan-st/sqlite-tui/internal/access"
 	"github.com/johan-st/sqlite-tui/internal/config"
+	"github.com/johan-st/sqlite-tui/internal/hooks"
+	"github.com/johan-st/sqlite-tui/internal/ratelimit"
+	"github.com/johan-st/sqlite-tui/internal/tracing"
+)
+
+// Sentinel errors returned by the Manager. Callers can match them with
+// errors.Is to tell failures apart.
+var (
+	// ErrDatabaseNotFound is returned when no discovered database matches.
+	ErrDatabaseNotFound = errors.New("database not found")
+	// ErrAccessDenied is returned when the user lacks the required access level.
+	ErrAccessDenied = errors.New("access denied")
+	// ErrSnapshotWrite is returned for a write query run on a snapshot.
+	ErrSnapshotWrite = errors.New("snapshot queries must be read-only")
+	// ErrApprovalRequired is returned for a query that does what a command
+	// needing an admin's approval does, see QueryApproval.
+	ErrApprovalRequired = errors.New("needs an admin's approval")
 )
 
 // Manager manages database connections and access.
 type Manager struct {
+	cfg         *config.Config
 	discovery   *Discovery
 	connections map[string]*Connection
+	lastUsed    map[string]time.Time // by connection key, see evictIdle
 	lockManager *LockManager
 	resolver    *access.Resolver
 	mu          sync.RWMutex
+
+	// Query rate limiters by access level, see checkQueryLimit
+	limiters  map[string]*ratelimit.Limiter
+	limiterMu sync.Mutex
+
+	// Last TOTP time step used by each user, see VerifyTOTP
+	totpUsed map[string]int64
+	totpMu   sync.Mutex
+
+	// Open transactions by session ID, see BeginTx
+	txs  map[string]*sessionTx
+	txMu sync.Mutex
+
+	// Channels watching for database changes, see WatchChanges
+	changeSubs map[chan DatabaseChange]struct{}
+	changeMu   sync.Mutex
+
+	// Snapshots shared by snapshot queries, by the connection they copy,
+	// see acquireSnapshot
+	snapshots map[*Connection]*cachedSnapshot
+	snapMu    sync.Mutex
+
+	// Reports whether a session is still connected, see SetSessionCheck
+	sessionActive func(sessionID string) bool
+
+	hooks *hooks.Runner
+	stop  chan struct{}
 }
 
 // NewManager creates a new database manager.
@@ -27,10 +82,19 @@ func NewManager(cfg *config.Config) (*Manager, error) {
 	}
 
 	m := &Manager{
+		cfg:         cfg,
 		discovery:   discovery,
 		connections: make(map[string]*Connection),
+		lastUsed:    make(map[string]time.Time),
 		lockManager: NewLockManager(),
 		resolver:    cfg.BuildResolver(),
+		limiters:    make(map[string]*ratelimit.Limiter),
+		totpUsed:    make(map[string]int64),
+		txs:         make(map[string]*sessionTx),
+		changeSubs:  make(map[chan DatabaseChange]struct{}),
+		snapshots:   make(map[*Connection]*cachedSnapshot),
+		hooks:       hooks.NewRunner(cfg),
+		stop:        make(chan struct{}),
 	}
 
 	return m, nil
@@ -38,20 +102,101 @@ func NewManager(cfg *config.Config) (*Manager, error) {
 
 // Start starts the database manager and discovery.
 func (m *Manager) Start() error {
-	return m.discovery.Start()
+	if err := m.discovery.Start(); err != nil {
+		return err
+	}
+	go m.evictLoop()
+	go m.changeLoop(changePollInterval)
+	go m.lockReapLoop(lockReapInterval)
+	go m.rescanLoop()
+	go m.changeHooksLoop(changeHooksInterval)
+	return nil
 }
 
-// Stop stops the database manager.
+// Stop stops the database manager and waits for queued hooks to run.
 func (m *Manager) Stop() {
 	m.discovery.Stop()
+	close(m.stop)
+	m.expireSnapshots(time.Now(), true)
 
 	m.mu.Lock()
-	defer m.mu.Unlock()
-
 	for _, conn := range m.connections {
 		conn.Close()
 	}
 	m.connections = make(map[string]*Connection)
+	m.lastUsed = make(map[string]time.Time)
+	m.mu.Unlock()
+
+	// Let the hooks of what happened so far run
+	m.hooks.Close()
+}
+
+// evictInterval is how often idle connections are looked for.
+const evictInterval = time.Minute
+
+// evictLoop closes idle connections and expired snapshots until Stop.
+func (m *Manager) evictLoop() {
+	ticker := time.NewTicker(evictInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.stop:
+			return
+		case now := <-ticker.C:
+			m.evictIdle(now)
+			m.expireSnapshots(now, false)
+		}
+	}
+}
+
+// evictIdle closes the connections not opened since the configured idle
+// timeout. They are reopened on next use.
+func (m *Manager) evictIdle(now time.Time) {
+	timeout, _ := m.cfg.GetConnectionLimits()
+	if timeout <= 0 {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for key, used := range m.lastUsed {
+		if now.Sub(used) >= timeout {
+			m.closeConnLocked(key)
+		}
+	}
+}
+
+// evictOldestLocked closes the least recently used connection. m.mu must
+// be held.
+func (m *Manager) evictOldestLocked() {
+	var oldest string
+	for key, used := range m.lastUsed {
+		if oldest == "" || used.Before(m.lastUsed[oldest]) {
+			oldest = key
+		}
+	}
+	if oldest != "" {
+		m.closeConnLocked(oldest)
+	}
+}
+
+// closeConnLocked closes and forgets a cached connection. Queries running
+// on it finish first. m.mu must be held.
+func (m *Manager) closeConnLocked(key string) error {
+	conn, ok := m.connections[key]
+	if !ok {
+		return nil
+	}
+	delete(m.connections, key)
+	delete(m.lastUsed, key)
+	return conn.Close()
+}
+
+// OpenConnections returns the number of cached connections.
+func (m *Manager) OpenConnections() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.connections)
 }
 
 // GetDiscovery returns the discovery service.
@@ -69,9 +214,17 @@ func (m *Manager) UpdateResolver(resolver *access.Resolver) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	m.resolver = resolver
+
+	// Drop filtered connections so changed row filters take effect
+	for key := range m.connections {
+		if strings.Contains(key, filterConnKey) {
+			m.closeConnLocked(key)
+		}
+	}
 }
 
-// ListDatabases returns all databases accessible by the user.
+// ListDatabases returns the databases listed for the user: those they can
+// read, minus hidden ones, plus those listed whatever their level.
 func (m *Manager) ListDatabases(user *access.UserInfo) []*DatabaseInfo {
 	databases := m.discovery.GetDatabases()
 	result := make([]*DatabaseInfo, 0, len(databases))
@@ -81,8 +234,8 @@ func (m *Manager) ListDatabases(user *access.UserInfo) []*DatabaseInfo {
 	m.mu.RUnlock()
 
 	for _, db := range databases {
-		level := resolver.Resolve(user, db.Path, db.Alias)
-		if level.CanRead() {
+		level := capReadOnly(db, resolver.Resolve(user, db.Path, db.Alias))
+		if resolver.Listed(user, db.Path, db.Alias) {
 			result = append(result, &DatabaseInfo{
 				Path:        db.Path,
 				Alias:       db.Alias,
@@ -90,6 +243,7 @@ func (m *Manager) ListDatabases(user *access.UserInfo) []*DatabaseInfo {
 				Size:        db.Size,
 				ModTime:     db.ModTime,
 				AccessLevel: level,
+				CanDownload: m.cfg.RawDownloadAllowed() && resolver.CanDownload(user, db.Path, db.Alias),
 			})
 		}
 	}
@@ -105,6 +259,7 @@ type DatabaseInfo struct {
 	Size        int64
 	ModTime     int64
 	AccessLevel access.Level
+	CanDownload bool // raw file downloads allowed
 }
 
 // GetDatabase returns a discovered database by path or alias.
@@ -123,44 +278,233 @@ func (m *Manager) GetAccessLevel(user *access.UserInfo, pathOrAlias string) acce
 	resolver := m.resolver
 	m.mu.RUnlock()
 
-	return resolver.Resolve(user, db.Path, db.Alias)
+	return capReadOnly(db, resolver.Resolve(user, db.Path, db.Alias))
+}
+
+// capReadOnly limits level to read access on databases of read-only
+// sources.
+func capReadOnly(db *DiscoveredDatabase, level access.Level) access.Level {
+	if db.Source != nil && (db.Source.ReadOnly || db.Source.Immutable) && level > access.ReadOnly {
+		return access.ReadOnly
+	}
+	return level
+}
+
+// sourceOpenOptions applies a source's connection settings to opts.
+func sourceOpenOptions(opts *OpenOptions, src *config.DatabaseSource) {
+	if src.MaxReaders > 0 {
+		opts.MaxReaders = src.MaxReaders
+	}
+	if src.BusyRetries != 0 {
+		opts.BusyRetry.Retries = max(src.BusyRetries, 0)
+	}
+	switch mode := strings.ToUpper(src.JournalMode); mode {
+	case "":
+	case "KEEP":
+		opts.JournalMode = ""
+	default:
+		opts.JournalMode = mode
+	}
+	if src.Synchronous != "" {
+		opts.Synchronous = strings.ToUpper(src.Synchronous)
+	}
+	if t := src.GetBusyTimeout(); t > 0 {
+		opts.BusyTimeout = int(t.Milliseconds())
+	}
+	opts.CacheSize = src.CacheSize
+	opts.ForeignKeys = src.ForeignKeys
+	opts.ReadOnly = opts.ReadOnly || src.ReadOnly
+	opts.Immutable = src.Immutable
+}
+
+// CommandAllowed reports whether a user may run a CLI command.
+func (m *Manager) CommandAllowed(user *access.UserInfo, command string) bool {
+	m.mu.RLock()
+	resolver := m.resolver
+	m.mu.RUnlock()
+
+	return resolver.CommandAllowed(user, command)
+}
+
+// ApprovalRequired reports whether a user must have a command approved by
+// an admin. Admins never need approval.
+func (m *Manager) ApprovalRequired(user *access.UserInfo, command string) bool {
+	if user != nil && user.IsAdmin {
+		return false
+	}
+	return m.cfg.ApprovalRequired(command)
 }
 
+// QueryApproval returns the command needing an admin's approval that a
+// query amounts to, or "" if none does: drop-table for a DROP statement and
+// truncate for a DELETE without a WHERE clause. Raw SQL doing the same must
+// not get around the approval.
+func (m *Manager) QueryApproval(user *access.UserInfo, query string) string {
+	for _, s := range ClassifySQL(query) {
+		var command string
+		switch {
+		case s.Type == "DROP":
+			command = "drop-table"
+		case s.Type == "DELETE" && !s.HasWhere:
+			command = "truncate"
+		default:
+			continue
+		}
+		if m.ApprovalRequired(user, command) {
+			return command
+		}
+	}
+	return ""
+}
+
+// checkFileStatements returns an error wrapping ErrAccessDenied if a query
+// opens or writes files by name: ATTACH and DETACH would reach databases
+// past the access checks, which --attach applies, and VACUUM INTO writes
+// any file the server can.
+func checkFileStatements(query string) error {
+	for _, toks := range splitStatements(tokenize(query)) {
+		p := &stmtParser{toks: toks}
+		p.skipWith()
+		switch verb := p.next(); {
+		case verb.isWord("ATTACH"), verb.isWord("DETACH"):
+			return fmt.Errorf("%w: %s is not allowed, attach databases with --attach", ErrAccessDenied, strings.ToUpper(verb.text))
+		case verb.isWord("VACUUM") && slices.ContainsFunc(toks, func(t token) bool { return t.isWord("INTO") }):
+			return fmt.Errorf("%w: VACUUM INTO is not allowed", ErrAccessDenied)
+		}
+	}
+	return nil
+}
+
+// checkQueryApproval returns an error wrapping ErrApprovalRequired if a
+// query needs an admin's approval.
+func (m *Manager) checkQueryApproval(user *access.UserInfo, query string) error {
+	if command := m.QueryApproval(user, query); command != "" {
+		return fmt.Errorf("%w: the query does what %s does", ErrApprovalRequired, command)
+	}
+	return nil
+}
+
+// CanSudo reports whether a user may run commands as admin with sudo.
+func (m *Manager) CanSudo(user *access.UserInfo) bool {
+	m.mu.RLock()
+	resolver := m.resolver
+	m.mu.RUnlock()
+
+	return resolver.CanSudo(user)
+}
+
+// TOTPSecret returns the user's TOTP secret, or "" if they aren't enrolled.
+func (m *Manager) TOTPSecret(user *access.UserInfo) string {
+	m.mu.RLock()
+	resolver := m.resolver
+	m.mu.RUnlock()
+
+	return resolver.TOTPSecret(user)
+}
+
+// UserGroups returns the groups a user belongs to.
+func (m *Manager) UserGroups(user *access.UserInfo) []string {
+	m.mu.RLock()
+	resolver := m.resolver
+	m.mu.RUnlock()
+
+	return resolver.GroupsOf(user)
+}
+
+// Suffixes of connection cache keys, after the database path.
+const (
+	readOnlyConnKey = "\x00ro"
+	filterConnKey   = "\x00filters:" // before a hash of the row filters
+	attachConnKey   = "\x00attach:"  // before each attached companion's path
+)
+
 // OpenConnection opens or returns an existing connection to a database.
 func (m *Manager) OpenConnection(pathOrAlias string, user *access.UserInfo) (*Connection, error) {
+	return m.openConnection(pathOrAlias, user, false)
+}
+
+// openConnection is OpenConnection, returning a connection opened
+// read-only whatever the user's access level if readOnly is set.
+func (m *Manager) openConnection(pathOrAlias string, user *access.UserInfo, readOnly bool) (*Connection, error) {
 	db := m.discovery.GetDatabase(pathOrAlias)
 	if db == nil {
-		return nil, fmt.Errorf("database not found: %s", pathOrAlias)
+		return nil, fmt.Errorf("%w: %s", ErrDatabaseNotFound, pathOrAlias)
 	}
 
 	// Check access
 	level := m.GetAccessLevel(user, pathOrAlias)
 	if !level.CanRead() {
-		return nil, fmt.Errorf("access denied to database: %s", pathOrAlias)
+		return nil, fmt.Errorf("%w to database: %s", ErrAccessDenied, pathOrAlias)
 	}
 
+	// Connections are shared by access mode: users who can't write get a
+	// connection SQLite opened read-only, whoever opened it first. Users
+	// with row filters get a connection with the filters applied, shared
+	// only with users whose filters are the same; the filters can depend
+	// on the user's address as well as their name. Each holds a pool of
+	// readers, and read-write ones a writer.
+	writable := level.CanWrite() && !readOnly
+	key := db.Path
+	if !writable {
+		key += readOnlyConnKey
+	}
+	filters := m.RowFilters(user, pathOrAlias)
+	if len(filters) > 0 {
+		key += filterConnKey + filtersKey(filters)
+	}
+	attach, attachKey := m.groupAttachments(db, user)
+	key += attachKey
+
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	// Return existing connection if available
-	if conn, ok := m.connections[db.Path]; ok {
+	if conn, ok := m.connections[key]; ok {
+		m.lastUsed[key] = time.Now()
 		return conn, nil
 	}
 
+	// Make room under the cap on open connections
+	idleTimeout, maxOpen := m.cfg.GetConnectionLimits()
+	for maxOpen > 0 && len(m.connections) >= maxOpen {
+		m.evictOldestLocked()
+	}
+
 	// Open new connection
 	// Open as read-only if user doesn't have write access
 	opts := DefaultOpenOptions()
-	opts.ReadOnly = !level.CanWrite()
+	opts.ReadOnly = !writable
+	opts.Init = append(RowFilterStatements(filters), attach...)
+	opts.MaxIdleTime = idleTimeout
+	opts.Key = db.Key
+	if db.Source != nil {
+		sourceOpenOptions(&opts, db.Source)
+	}
 
+	// SQLite only notices a file isn't a database at its first query.
+	// Encrypted ones have no header to check
+	if err := CheckSQLiteFile(db.Path); err != nil && db.Key == "" {
+		return nil, err
+	}
 	conn, err := Open(db.Path, opts)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 
-	m.connections[db.Path] = conn
+	m.connections[key] = conn
+	m.lastUsed[key] = time.Now()
 	return conn, nil
 }
 
+// filtersKey returns a hash identifying a set of row filters.
+func filtersKey(filters map[string]string) string {
+	h := sha256.New()
+	for _, table := range slices.Sorted(maps.Keys(filters)) {
+		fmt.Fprintf(h, "%q=%q\n", table, filters[table])
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
 // CloseConnection closes a connection to a database.
 func (m *Manager) CloseConnection(pathOrAlias string) error {
 	db := m.discovery.GetDatabase(pathOrAlias)
@@ -171,42 +515,106 @@ func (m *Manager) CloseConnection(pathOrAlias string) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	if conn, ok := m.connections[db.Path]; ok {
-		delete(m.connections, db.Path)
-		return conn.Close()
+	var err error
+	for key := range m.connections {
+		// Including those with db attached, which would keep the old file
+		if key == db.Path || strings.HasPrefix(key, db.Path+"\x00") ||
+			strings.Contains(key, attachConnKey+db.Path) {
+			if cerr := m.closeConnLocked(key); cerr != nil && err == nil {
+				err = cerr
+			}
+		}
 	}
+	return err
+}
 
-	return nil
+// readOnlyKey is the context key marking queries that must not write.
+type readOnlyKey struct{}
+
+// WithReadOnly returns a context whose queries run on a connection SQLite
+// opened read-only and are refused if they write, whatever the user's
+// access level, e.g. for the web viewer.
+func WithReadOnly(ctx context.Context) context.Context {
+	return context.WithValue(ctx, readOnlyKey{}, true)
 }
 
-// ExecuteQuery executes a query on a database.
-func (m *Manager) ExecuteQuery(pathOrAlias string, user *access.UserInfo, sessionID string, query string) (*QueryResult, error) {
+// isReadOnly reports whether ctx was made by WithReadOnly.
+func isReadOnly(ctx context.Context) bool {
+	readOnly, _ := ctx.Value(readOnlyKey{}).(bool)
+	return readOnly
+}
+
+// ExecuteQuery executes a query on a database. Cancelling ctx interrupts
+// the query, e.g. when the client disconnects.
+func (m *Manager) ExecuteQuery(ctx context.Context, pathOrAlias string, user *access.UserInfo, sessionID string, query string) (*QueryResult, error) {
+	return m.ExecuteQueryArgs(ctx, pathOrAlias, user, sessionID, query)
+}
+
+// ExecuteQueryArgs is ExecuteQuery with arguments bound to the query's
+// parameters.
+func (m *Manager) ExecuteQueryArgs(ctx context.Context, pathOrAlias string, user *access.UserInfo, sessionID string, query string, args ...any) (*QueryResult, error) {
 	db := m.discovery.GetDatabase(pathOrAlias)
 	if db == nil {
-		return nil, fmt.Errorf("database not found: %s", pathOrAlias)
+		return nil, fmt.Errorf("%w: %s", ErrDatabaseNotFound, pathOrAlias)
 	}
 
 	level := m.GetAccessLevel(user, pathOrAlias)
 
 	// Check if query requires write access
-	if !isReadOnlyQuery(query) && !level.CanWrite() {
-		return nil, fmt.Errorf("access denied: write permission required")
+	write := !IsReadOnlyQuery(query)
+	if write && !level.CanWrite() {
+		return nil, fmt.Errorf("%w: write permission required", ErrAccessDenied)
+	}
+	if write && isReadOnly(ctx) {
+		return nil, fmt.Errorf("%w: only reads are allowed here", ErrAccessDenied)
+	}
+	if err := checkFileStatements(query); err != nil {
+		return nil, err
+	}
+	if err := m.checkQueryApproval(user, query); err != nil {
+		return nil, err
+	}
+	if err := m.checkTOTP(ctx, user, query); err != nil {
+		return nil, err
 	}
 
-	conn, err := m.OpenConnection(pathOrAlias, user)
+	limits, err := m.checkQueryLimit(user, level)
 	if err != nil {
 		return nil, err
 	}
 
+	if len(m.RowFilters(user, pathOrAlias)) > 0 {
+		if err := CheckRowFilterQuery(query); err != nil {
+			return nil, err
+		}
+	}
+
+	// In a transaction the session already holds the write lock; each
+	// query shows it is still alive
+	conn := m.txConn(pathOrAlias, sessionID)
+	inTx := conn != nil
+	if inTx {
+		m.lockManager.Heartbeat(sessionID)
+	}
+	if !inTx {
+		conn, err = m.openConnection(pathOrAlias, user, isReadOnly(ctx))
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	// For write queries, acquire lock
-	if !isReadOnlyQuery(query) {
-		if err := m.lockManager.TryLock(db.Path, user.DisplayName(), sessionID); err != nil {
+	if write && !inTx {
+		unlock, err := m.lockForWrite(ctx, db, writeTables(query), user.DisplayName(), sessionID, true)
+		if err != nil {
 			return nil, err
 		}
-		defer m.lockManager.Unlock(db.Path, sessionID)
+		defer unlock()
 	}
 
-	result, err := Query(conn, query)
+	result, err := m.WithQueryTimeout(ctx, user, pathOrAlias, func(ctx context.Context) (*QueryResult, error) {
+		return tracedQuery(ctx, tracing.Session(sessionID), conn, query, args, limits)
+	})
 	if err != nil {
 		// Check if it's a WAL lock error
 		if IsWALLockError(err) {
@@ -215,66 +623,342 @@ func (m *Manager) ExecuteQuery(pathOrAlias string, user *access.UserInfo, sessio
 		return nil, err
 	}
 
+	switch {
+	case !write:
+	case inTx:
+		// Hooks fire once the transaction commits
+		m.recordTxWrite(sessionID, query, result)
+	default:
+		m.fireWrite(db.Path, user, sessionID, query, result)
+	}
 	return result, nil
 }
 
-// StreamDatabase streams the raw database file to a writer.
-func (m *Manager) StreamDatabase(pathOrAlias string, user *access.UserInfo, w io.Writer) error {
+// ExecuteQuerySnapshot runs a read-only query on a snapshot of the
+// database, so a long analytical query doesn't hold up writers. Snapshots
+// are shared by queries for up to snapshotMaxAge; taking one waits for the
+// write lock, as a backup does.
+func (m *Manager) ExecuteQuerySnapshot(ctx context.Context, pathOrAlias string, user *access.UserInfo, sessionID string, query string) (*QueryResult, error) {
+	if !IsReadOnlyQuery(query) {
+		return nil, ErrSnapshotWrite
+	}
+	level := m.GetAccessLevel(user, pathOrAlias)
+	limits, err := m.checkQueryLimit(user, level)
+	if err != nil {
+		return nil, err
+	}
+	if len(m.RowFilters(user, pathOrAlias)) > 0 {
+		if err := CheckRowFilterQuery(query); err != nil {
+			return nil, err
+		}
+	}
+
 	db := m.discovery.GetDatabase(pathOrAlias)
 	if db == nil {
-		return fmt.Errorf("database not found: %s", pathOrAlias)
+		return nil, fmt.Errorf("%w: %s", ErrDatabaseNotFound, pathOrAlias)
 	}
+	conn, err := m.openConnection(pathOrAlias, user, true)
+	if err != nil {
+		return nil, err
+	}
+	return m.WithQueryTimeout(ctx, user, pathOrAlias, func(ctx context.Context) (*QueryResult, error) {
+		snap, release, err := m.acquireSnapshot(ctx, db, conn, user, sessionID)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+		return tracedQuery(ctx, tracing.Session(sessionID), snap, query, nil, limits)
+	})
+}
 
-	level := m.GetAccessLevel(user, pathOrAlias)
-	if !level.CanDownload() {
-		return fmt.Errorf("access denied: download permission required")
+// SetPragma sets a pragma stored in the database file, see
+// Connection.SetPragma, through the gates of any other write: write
+// access, approval, TOTP and the write lock. It is refused in a session's
+// transaction, whose connection is the one it would change.
+func (m *Manager) SetPragma(ctx context.Context, pathOrAlias string, user *access.UserInfo, sessionID, name, value string) (previous, current any, err error) {
+	db := m.discovery.GetDatabase(pathOrAlias)
+	if db == nil {
+		return nil, nil, fmt.Errorf("%w: %s", ErrDatabaseNotFound, pathOrAlias)
+	}
+	if !m.GetAccessLevel(user, pathOrAlias).CanWrite() {
+		return nil, nil, fmt.Errorf("%w: write permission required", ErrAccessDenied)
+	}
+	if isReadOnly(ctx) {
+		return nil, nil, fmt.Errorf("%w: only reads are allowed here", ErrAccessDenied)
+	}
+	query := fmt.Sprintf("PRAGMA %s = %s", name, value)
+	if err := m.checkQueryApproval(user, query); err != nil {
+		return nil, nil, err
+	}
+	if err := m.checkTOTP(ctx, user, query); err != nil {
+		return nil, nil, err
+	}
+	if m.txConn(pathOrAlias, sessionID) != nil {
+		return nil, nil, ErrInTransaction
 	}
 
-	// Open the file directly for streaming
-	f, err := os.Open(db.Path)
+	conn, err := m.openConnection(pathOrAlias, user, false)
 	if err != nil {
-		return fmt.Errorf("failed to open database file: %w", err)
+		return nil, nil, err
 	}
-	defer f.Close()
-
-	_, err = io.Copy(w, f)
-	return err
+	unlock, err := m.lockForWrite(ctx, db, nil, user.DisplayName(), sessionID, true)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer unlock()
+	return conn.SetPragma(ctx, name, value)
 }
 
-// isReadOnlyQuery checks if a query is read-only.
-func isReadOnlyQuery(query string) bool {
-	// Simple heuristic - in production you'd want proper SQL parsing
-	upper := trimToUpper(query)
-	return hasPrefix(upper, "SELECT") ||
-		hasPrefix(upper, "PRAGMA") ||
-		hasPrefix(upper, "EXPLAIN") ||
-		hasPrefix(upper, "WITH")
+// Write lock policies, set per database source.
+const (
+	LockPolicyFail = "fail" // error at once when the lock is held (default)
+	LockPolicyWait = "wait" // wait up to the source's lock_timeout
+	LockPolicyNone = "none" // skip the lock outside transactions, rely on SQLite's busy timeout
+)
+
+// LockForWrite takes the write lock on the given tables of a database, or
+// on all of it without any, following its lock policy or waiting as long
+// as WithLockTimeout asked in ctx, and returns the function releasing it.
+// While waiting, ctx ends the wait and its LockWaitFunc is told the place
+// in the queue.
+func (m *Manager) LockForWrite(ctx context.Context, pathOrAlias, holder, sessionID string, tables ...string) (func(), error) {
+	db := m.discovery.GetDatabase(pathOrAlias)
+	if db == nil {
+		return nil, fmt.Errorf("%w: %s", ErrDatabaseNotFound, pathOrAlias)
+	}
+	return m.lockForWrite(ctx, db, tables, holder, sessionID, true)
 }
 
-func trimToUpper(s string) string {
-	// Trim whitespace and convert to uppercase (first 20 chars)
-	start := 0
-	for start < len(s) && (s[start] == ' ' || s[start] == '\t' || s[start] == '\n' || s[start] == '\r') {
-		start++
+// lockForWrite applies db's lock policy to locking tables, or the whole
+// database when there are none. Without allowBypass the "none" policy
+// fails fast instead, for operations SQLite's busy timeout doesn't cover,
+// such as replacing the file.
+func (m *Manager) lockForWrite(ctx context.Context, db *DiscoveredDatabase, tables []string, holder, sessionID string, allowBypass bool) (func(), error) {
+	policy := LockPolicyFail
+	timeout := time.Duration(0)
+	if db.Source != nil {
+		policy = strings.ToLower(strings.TrimSpace(db.Source.LockPolicy))
+		timeout = db.Source.GetLockTimeout()
+	}
+
+	// SQLite's names are case-insensitive. Taking the locks in order keeps
+	// two writers from each holding what the other waits for
+	keys := []string{""}
+	if len(tables) > 0 {
+		keys = make([]string, len(tables))
+		for i, table := range tables {
+			keys[i] = strings.ToLower(table)
+		}
+		slices.Sort(keys)
+		keys = slices.Compact(keys)
+	}
+
+	if policy == LockPolicyNone && allowBypass {
+		// Transactions lock even so, holding the writer connection until
+		// they end. Report who holds it rather than wait on the connection
+		for _, table := range keys {
+			if err := m.lockManager.Check(db.Path, table, sessionID); err != nil {
+				return nil, err
+			}
+		}
+		return func() {}, nil
+	}
+	// A wait asked for with the write overrides the policy
+	if d, ok := lockTimeout(ctx); ok {
+		policy, timeout = LockPolicyWait, d
 	}
-	end := start + 20
-	if end > len(s) {
-		end = len(s)
+
+	unlock := func() {
+		for _, table := range keys {
+			m.lockManager.UnlockTable(db.Path, table, sessionID)
+		}
 	}
-	result := make([]byte, end-start)
-	for i := start; i < end; i++ {
-		c := s[i]
-		if c >= 'a' && c <= 'z' {
-			result[i-start] = c - 32
+	deadline := time.Now().Add(timeout)
+	for _, table := range keys {
+		var err error
+		if policy == LockPolicyWait && timeout > 0 {
+			err = m.lockManager.LockWait(ctx, db.Path, table, holder, sessionID, time.Until(deadline), lockWaitFunc(ctx))
 		} else {
-			result[i-start] = c
+			err = m.lockManager.TryLockTable(db.Path, table, holder, sessionID)
+		}
+		if err != nil {
+			unlock()
+			return nil, err
+		}
+	}
+	return unlock, nil
+}
+
+// writeTables returns the tables of the main database a query writes, to
+// lock just those, or none when it must lock the whole database: when it
+// changes the schema or settings, or writes tables it can't tell apart
+// from those of other schemas.
+func writeTables(query string) []string {
+	var tables []string
+	for _, s := range ClassifySQL(query) {
+		switch {
+		case s.ReadOnly():
+			continue
+		case s.Type != "INSERT" && s.Type != "UPDATE" && s.Type != "DELETE" && s.Type != "REPLACE":
+			return nil
+		case len(s.Tables) == 0:
+			return nil
+		}
+		for _, table := range s.Tables {
+			if schema, name, ok := strings.Cut(table, "."); ok {
+				if !strings.EqualFold(schema, "main") {
+					return nil
+				}
+				table = name
+			}
+			tables = append(tables, table)
 		}
 	}
-	return string(result)
+	return tables
+}
+
+// lockReapInterval is how often write locks are checked for expiry.
+var lockReapInterval = 30 * time.Second
+
+// SetSessionCheck sets the function telling whether a session is still
+// connected. Locks of connected sessions never expire; without a check only
+// heartbeats count.
+func (m *Manager) SetSessionCheck(active func(sessionID string) bool) {
+	m.mu.Lock()
+	m.sessionActive = active
+	m.mu.Unlock()
 }
 
-func hasPrefix(s, prefix string) bool {
-	return len(s) >= len(prefix) && s[:len(prefix)] == prefix
+// lockReapLoop releases expired write locks every interval until Stop.
+func (m *Manager) lockReapLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.stop:
+			return
+		case now := <-ticker.C:
+			m.reapLocks(now)
+		}
+	}
+}
+
+// reapLocks releases the write locks of sessions that are gone and sent no
+// heartbeat for the lock TTL, such as sessions that crashed without
+// cleaning up. A transaction the session left open is rolled back first.
+func (m *Manager) reapLocks(now time.Time) {
+	ttl := m.cfg.GetLockTTL()
+	if ttl <= 0 {
+		return
+	}
+	m.mu.RLock()
+	active := m.sessionActive
+	m.mu.RUnlock()
+
+	before := now.Add(-ttl)
+	for _, info := range m.lockManager.ListLocks() {
+		if !info.Heartbeat.Before(before) || (active != nil && active(info.SessionID)) {
+			continue
+		}
+		released := false
+		if m.Tx(info.SessionID) != nil {
+			// Rolling back releases the lock
+			m.EndSession(info.SessionID)
+			released = true
+		}
+		if m.lockManager.ReleaseStale(info.Path, info.Table, info.SessionID, before) {
+			released = true
+		}
+		if released {
+			slog.Warn("Released expired write lock",
+				"db", info.Path,
+				"table", info.Table,
+				"held_by", info.HeldBy,
+				"session", info.SessionID,
+				"held_for", now.Sub(info.Since).Round(time.Second),
+				"last_heartbeat", info.Heartbeat)
+		}
+	}
+}
+
+// Hooks returns the runner of the config's hooks, for events fired
+// outside the manager.
+func (m *Manager) Hooks() *hooks.Runner {
+	return m.hooks
+}
+
+// fireWrite runs the write hooks for a successful write query.
+func (m *Manager) fireWrite(dbPath string, user *access.UserInfo, sessionID, query string, result *QueryResult) {
+	m.hooks.Fire(&hooks.Event{
+		Event:     hooks.Write,
+		User:      user.DisplayName(),
+		SessionID: sessionID,
+		Database:  dbPath,
+		Query:     query,
+		Details:   writeDetails(query, result),
+	})
+}
+
+// writeDetails describes a write for its hooks: what kind of statements it
+// ran, on which tables, and whether an UPDATE or DELETE lacked a WHERE
+// clause and so hit every row.
+func writeDetails(query string, result *QueryResult) map[string]any {
+	stmts := ClassifySQL(query)
+	details := map[string]any{
+		"rows_affected": result.RowsAffected,
+		"statements":    stmts.Types(),
+	}
+	if tables := stmts.Tables(); len(tables) > 0 {
+		details["tables"] = tables
+	}
+	for _, s := range stmts {
+		if (s.Type == "UPDATE" || s.Type == "DELETE") && !s.HasWhere {
+			details["unbounded"] = true
+		}
+	}
+	return details
+}
+
+// StreamDatabase streams the raw database file to a writer.
+func (m *Manager) StreamDatabase(pathOrAlias string, user *access.UserInfo, w io.Writer) error {
+	f, err := m.OpenDatabaseFile(pathOrAlias, user)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// OpenDatabaseFile opens the raw database file for reading. It applies the
+// same download check as StreamDatabase; the caller must close the file.
+func (m *Manager) OpenDatabaseFile(pathOrAlias string, user *access.UserInfo) (*os.File, error) {
+	db := m.discovery.GetDatabase(pathOrAlias)
+	if db == nil {
+		return nil, fmt.Errorf("%w: %s", ErrDatabaseNotFound, pathOrAlias)
+	}
+
+	m.mu.RLock()
+	resolver := m.resolver
+	m.mu.RUnlock()
+
+	if !m.cfg.RawDownloadAllowed() {
+		return nil, fmt.Errorf("%w: raw downloads are disabled on this server", ErrAccessDenied)
+	}
+	if !resolver.CanDownload(user, db.Path, db.Alias) {
+		return nil, fmt.Errorf("%w: download permission required", ErrAccessDenied)
+	}
+	if len(m.RowFilters(user, pathOrAlias)) > 0 {
+		return nil, fmt.Errorf("%w: downloads not allowed with row filters", ErrAccessDenied)
+	}
+
+	f, err := os.Open(db.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database file: %w", err)
+	}
+	m.hooks.Fire(&hooks.Event{Event: hooks.Download, User: user.DisplayName(), Database: db.Path})
+	return f, nil
 }
 
 // Refresh refreshes the database discovery.
@@ -282,6 +966,67 @@ func (m *Manager) Refresh() error {
 	return m.discovery.Refresh()
 }
 
+// Rescan scans the database sources again, as Refresh, and returns the
+// paths of the databases found and gone since the last scan.
+func (m *Manager) Rescan() (added, removed []string, err error) {
+	before := make(map[string]bool)
+	for _, db := range m.discovery.GetDatabases() {
+		before[db.Path] = true
+	}
+	if err := m.discovery.Refresh(); err != nil {
+		return nil, nil, err
+	}
+	for _, db := range m.discovery.GetDatabases() {
+		if before[db.Path] {
+			delete(before, db.Path)
+			continue
+		}
+		added = append(added, db.Path)
+	}
+	for path := range before {
+		removed = append(removed, path)
+	}
+	slices.Sort(added)
+	slices.Sort(removed)
+	return added, removed, nil
+}
+
+// rescanIdleCheck is how often the rescan loop checks whether periodic
+// rescans were turned on by a reload.
+var rescanIdleCheck = time.Minute
+
+// rescanLoop rescans the database sources every configured rescan interval
+// until Stop, as a fallback for file systems whose change notifications
+// are unreliable. The interval is read anew each time, so reloads apply.
+func (m *Manager) rescanLoop() {
+	for {
+		interval := m.cfg.GetRescanInterval()
+		wait := interval
+		if wait <= 0 {
+			wait = rescanIdleCheck
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-m.stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		if interval <= 0 {
+			continue
+		}
+
+		added, removed, err := m.Rescan()
+		if err != nil {
+			slog.Warn("Periodic rescan failed", "error", err)
+			continue
+		}
+		if len(added) > 0 || len(removed) > 0 {
+			slog.Info("Periodic rescan found changes", "added", len(added), "removed", len(removed))
+		}
+	}
+}
+
 // OnDatabaseChange registers a callback for database changes.
 func (m *Manager) OnDatabaseChange(callback func(added, removed []*DiscoveredDatabase)) {
 	m.discovery.OnChange(callback)
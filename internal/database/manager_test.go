@@ -1,12 +1,25 @@
 package database
 
 import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/johan-st/sqlite-tui/internal/access"
 	"github.com/johan-st/sqlite-tui/internal/config"
+	"github.com/johan-st/sqlite-tui/internal/hooks"
 	"github.com/johan-st/sqlite-tui/internal/testutil"
+	"github.com/johan-st/sqlite-tui/internal/totp"
 )
 
 // TestManager_AccessControl tests that the manager enforces access control.
@@ -117,8 +130,9 @@ func TestManager_ReadOnlyConnection(t *testing.T) {
 	}
 }
 
-// TestManager_ExecuteQuery_AccessDenied tests that write queries are denied for read-only users.
-func TestManager_ExecuteQuery_AccessDenied(t *testing.T) {
+// TestManager_SharedConnectionModes tests that read-only users never reuse a
+// read-write connection, whoever connects first.
+func TestManager_SharedConnectionModes(t *testing.T) {
 	dbPath, cleanup := testutil.TestDB(t, "users.db")
 	defer cleanup()
 
@@ -126,7 +140,10 @@ func TestManager_ExecuteQuery_AccessDenied(t *testing.T) {
 		Databases: []config.DatabaseSource{
 			{Path: dbPath, Alias: "test"},
 		},
-		AnonymousAccess: "read-only",
+		Users: []config.User{
+			{Name: "reader", Access: []config.AccessRule{{Pattern: "*", Level: "read-only"}}},
+			{Name: "admin", Admin: true},
+		},
 	}
 
 	manager, err := NewManager(cfg)
@@ -138,47 +155,36 @@ func TestManager_ExecuteQuery_AccessDenied(t *testing.T) {
 	}
 	defer manager.Stop()
 
-	user := &access.UserInfo{Name: "anon", IsAnonymous: true}
+	reader := &access.UserInfo{Name: "reader"}
+	admin := &access.UserInfo{Name: "admin", IsAdmin: true}
 
-	// SELECT should work
-	result, err := manager.ExecuteQuery("test", user, "", "SELECT * FROM users")
+	adminConn, err := manager.OpenConnection("test", admin)
 	if err != nil {
-		t.Errorf("SELECT query failed: %v", err)
-	}
-	if len(result.Rows) == 0 {
-		t.Error("expected rows from SELECT")
-	}
-
-	// INSERT should be denied
-	_, err = manager.ExecuteQuery("test", user, "", "INSERT INTO users (name, email) VALUES ('x', 'x@x.com')")
-	if err == nil {
-		t.Error("expected INSERT to be denied for read-only user")
+		t.Fatalf("failed to open admin connection: %v", err)
 	}
-	if !strings.Contains(err.Error(), "access denied") && !strings.Contains(err.Error(), "write permission") {
-		t.Errorf("expected access denied error, got: %v", err)
+	readerConn, err := manager.OpenConnection("test", reader)
+	if err != nil {
+		t.Fatalf("failed to open reader connection: %v", err)
 	}
-
-	// UPDATE should be denied
-	_, err = manager.ExecuteQuery("test", user, "", "UPDATE users SET name = 'y'")
-	if err == nil {
-		t.Error("expected UPDATE to be denied for read-only user")
+	if adminConn == readerConn || adminConn.ReadOnly || !readerConn.ReadOnly {
+		t.Fatalf("expected separate read-write and read-only connections")
 	}
 
-	// DELETE should be denied
-	_, err = manager.ExecuteQuery("test", user, "", "DELETE FROM users")
+	// A write the query check lets through still fails in SQLite
+	_, err = manager.ExecuteQuery(context.Background(), "test", reader, "", "WITH x AS (SELECT 1) DELETE FROM users")
 	if err == nil {
-		t.Error("expected DELETE to be denied for read-only user")
+		t.Error("expected write by read-only user to fail")
 	}
 
-	// DROP should be denied
-	_, err = manager.ExecuteQuery("test", user, "", "DROP TABLE users")
-	if err == nil {
-		t.Error("expected DROP to be denied for read-only user")
+	if _, err := manager.ExecuteQuery(context.Background(), "test", admin, "", "DELETE FROM users WHERE id = 1"); err != nil {
+		t.Errorf("expected admin write to succeed after reader connected: %v", err)
 	}
 }
 
-// TestManager_ListDatabases_Filtered tests that users only see accessible databases.
-func TestManager_ListDatabases_Filtered(t *testing.T) {
+// TestManager_FilteredConnectionModes tests that connections with row
+// filters keep the read-only/read-write split and aren't shared between
+// addresses that get different filters.
+func TestManager_FilteredConnectionModes(t *testing.T) {
 	dbPath, cleanup := testutil.TestDB(t, "users.db")
 	defer cleanup()
 
@@ -186,9 +192,12 @@ func TestManager_ListDatabases_Filtered(t *testing.T) {
 		Databases: []config.DatabaseSource{
 			{Path: dbPath, Alias: "test"},
 		},
-		AnonymousAccess: "none",
 		Users: []config.User{
-			{Name: "reader", Access: []config.AccessRule{{Pattern: "test", Level: "read-only"}}},
+			{Name: "analyst", Access: []config.AccessRule{
+				{Pattern: "test/sensitive_data", Level: "read-only", From: []string{"10.0.0.0/8"}},
+				{Pattern: "test/sensitive_data", Level: "none"},
+				{Pattern: "*", Level: "read-write"},
+			}},
 		},
 	}
 
@@ -201,33 +210,120 @@ func TestManager_ListDatabases_Filtered(t *testing.T) {
 	}
 	defer manager.Stop()
 
-	// Reader should see the database
-	reader := &access.UserInfo{Name: "reader"}
-	dbs := manager.ListDatabases(reader)
-	if len(dbs) != 1 {
-		t.Errorf("expected 1 database for reader, got %d", len(dbs))
+	office := &access.UserInfo{Name: "analyst", RemoteAddr: "10.1.2.3:5000"}
+	home := &access.UserInfo{Name: "analyst", RemoteAddr: "192.0.2.1:5000"}
+
+	// The address that sees the table first must not leave its connection
+	// for the other
+	count := func(user *access.UserInfo) int64 {
+		t.Helper()
+		res, err := manager.ExecuteQuery(context.Background(), "test", user, "", "SELECT COUNT(*) FROM sensitive_data")
+		if err != nil {
+			t.Fatalf("query failed: %v", err)
+		}
+		return res.Rows[0][0].(int64)
+	}
+	if n := count(office); n != 2 {
+		t.Errorf("expected 2 rows from the office, got %d", n)
+	}
+	if n := count(home); n != 0 {
+		t.Errorf("expected no rows from elsewhere, got %d", n)
 	}
 
-	// Anonymous should not see any databases
-	anon := &access.UserInfo{Name: "anon", IsAnonymous: true}
-	dbs = manager.ListDatabases(anon)
-	if len(dbs) != 0 {
-		t.Errorf("expected 0 databases for anonymous, got %d", len(dbs))
+	// The same filters on a read-only connection don't reuse the
+	// read-write one
+	rw, err := manager.OpenConnection("test", home)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ro, err := manager.openConnection("test", home, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rw == ro || rw.ReadOnly || !ro.ReadOnly {
+		t.Fatalf("expected separate read-write and read-only filtered connections")
 	}
 }
 
-// TestManager_UnknownDatabase tests accessing non-existent database.
-func TestManager_UnknownDatabase(t *testing.T) {
+// TestManager_SourceOpenOptions tests that a source's connection settings
+// reach SQLite and that read-only sources allow no writes.
+func TestManager_SourceOpenOptions(t *testing.T) {
 	dbPath, cleanup := testutil.TestDB(t, "users.db")
 	defer cleanup()
+	roPath, roCleanup := testutil.TestDB(t, "users.db")
+	defer roCleanup()
 
 	cfg := &config.Config{
 		Databases: []config.DatabaseSource{
-			{Path: dbPath, Alias: "test"},
+			{Path: dbPath, Alias: "tuned", JournalMode: "truncate", Synchronous: "full",
+				BusyTimeout: "2s", CacheSize: -4096, ForeignKeys: true},
+			{Path: roPath, Alias: "media", ReadOnly: true},
 		},
-		AnonymousAccess: "admin",
+		Users: []config.User{{Name: "admin", Admin: true}},
+	}
+	manager, err := NewManager(cfg)
+	if err != nil {
+		t.Fatalf("failed to create manager: %v", err)
+	}
+	if err := manager.Start(); err != nil {
+		t.Fatalf("failed to start manager: %v", err)
 	}
+	defer manager.Stop()
+	admin := &access.UserInfo{Name: "admin", IsAdmin: true}
+
+	conn, err := manager.OpenConnection("tuned", admin)
+	if err != nil {
+		t.Fatalf("OpenConnection failed: %v", err)
+	}
+	for pragma, want := range map[string]string{
+		"journal_mode": "truncate",
+		"synchronous":  "2",
+		"busy_timeout": "2000",
+		"cache_size":   "-4096",
+		"foreign_keys": "1",
+	} {
+		var got string
+		if err := conn.writer.QueryRow("PRAGMA " + pragma).Scan(&got); err != nil || got != want {
+			t.Errorf("%s = %q (%v), want %q", pragma, got, err, want)
+		}
+	}
+
+	if level := manager.GetAccessLevel(admin, "media"); level != access.ReadOnly {
+		t.Errorf("access to read-only source = %s, want read-only", level)
+	}
+	conn, err = manager.OpenConnection("media", admin)
+	if err != nil {
+		t.Fatalf("OpenConnection failed: %v", err)
+	}
+	if !conn.ReadOnly {
+		t.Error("expected a read-only connection")
+	}
+	if _, err := manager.ExecuteQuery(context.Background(), "media", admin, "", "DELETE FROM users"); err == nil {
+		t.Error("expected write to a read-only source to fail")
+	}
+}
+
+// TestManager_ChangeHooks tests that rows the change feed finds in a
+// watched table fire the change hooks.
+func TestManager_ChangeHooks(t *testing.T) {
+	defer func(d time.Duration) { changePollInterval = d }(changePollInterval)
+	changePollInterval = 10 * time.Millisecond
+	defer func(d time.Duration) { changeHooksInterval = d }(changeHooksInterval)
+	changeHooksInterval = 10 * time.Millisecond
+
+	dbPath, cleanup := testutil.TestDB(t, "users.db")
+	defer cleanup()
 
+	// Hooks run concurrently, so each event gets its own file
+	out := t.TempDir()
+	cfg := &config.Config{
+		Databases: []config.DatabaseSource{{Path: dbPath, Alias: "test"}},
+		Users:     []config.User{{Name: "admin", Admin: true}},
+		Hooks: config.HooksConfig{
+			OnChange: []string{"cat > $(mktemp " + out + "/event.XXXXXX)"},
+			Watch:    []string{"test/posts", "test/nope", "no-such-table"},
+		},
+	}
 	manager, err := NewManager(cfg)
 	if err != nil {
 		t.Fatalf("failed to create manager: %v", err)
@@ -236,36 +332,180 @@ func TestManager_UnknownDatabase(t *testing.T) {
 		t.Fatalf("failed to start manager: %v", err)
 	}
 	defer manager.Stop()
+	admin := &access.UserInfo{Name: "admin", IsAdmin: true}
 
-	user := &access.UserInfo{Name: "admin", IsAdmin: true}
+	// The feed starts from the rows there when it begins following, so
+	// insert until one is reported
+	var event map[string]any
+	deadline := time.Now().Add(5 * time.Second)
+	for i := 0; event == nil; i++ {
+		if time.Now().After(deadline) {
+			t.Fatal("no change event fired")
+		}
+		query := fmt.Sprintf("INSERT INTO posts (user_id, title) VALUES (1, 'hooked %d')", i)
+		if _, err := manager.ExecuteQuery(context.Background(), "test", admin, "", query); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(50 * time.Millisecond)
 
-	// Try to access non-existent database
-	_, err = manager.OpenConnection("nonexistent", user)
-	if err == nil {
-		t.Error("expected error for non-existent database")
+		// A hook may still be writing its file, so only read finished ones
+		files, _ := filepath.Glob(filepath.Join(out, "event.*"))
+		for _, f := range files {
+			data, _ := os.ReadFile(f)
+			if json.Valid(data) {
+				json.Unmarshal(data, &event)
+				break
+			}
+		}
 	}
-	if !strings.Contains(err.Error(), "not found") {
-		t.Errorf("expected 'not found' error, got: %v", err)
+
+	details, _ := event["details"].(map[string]any)
+	if event["event"] != hooks.Change || event["action"] != FeedInsert || event["table"] != "posts" ||
+		!strings.HasPrefix(fmt.Sprint(details["title"]), "hooked") {
+		t.Errorf("unexpected change event: %v", event)
+	}
+}
+
+// TestManager_WatchChanges tests that writes to an open database, by
+// this server or another connection, are reported.
+func TestManager_WatchChanges(t *testing.T) {
+	defer func(d time.Duration) { changePollInterval = d }(changePollInterval)
+	changePollInterval = 10 * time.Millisecond
+
+	dbPath, cleanup := testutil.TestDB(t, "users.db")
+	defer cleanup()
+
+	cfg := &config.Config{
+		Databases: []config.DatabaseSource{{Path: dbPath, Alias: "test"}},
+		Users:     []config.User{{Name: "admin", Admin: true}},
+	}
+	manager, err := NewManager(cfg)
+	if err != nil {
+		t.Fatalf("failed to create manager: %v", err)
+	}
+	if err := manager.Start(); err != nil {
+		t.Fatalf("failed to start manager: %v", err)
+	}
+	defer manager.Stop()
+	admin := &access.UserInfo{Name: "admin", IsAdmin: true}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes := manager.WatchChanges(ctx)
+	if _, err := manager.OpenConnection("test", admin); err != nil {
+		t.Fatalf("OpenConnection failed: %v", err)
 	}
 
-	_, err = manager.ExecuteQuery("nonexistent", user, "", "SELECT 1")
-	if err == nil {
-		t.Error("expected error for non-existent database")
+	// Another connection writes; retry until the watch has started
+	other, err := OpenReadWrite(dbPath)
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	defer other.Close()
+	var change DatabaseChange
+	for i := 0; change.Path == ""; i++ {
+		if i == 100 {
+			t.Fatal("no change reported for a write")
+		}
+		if _, err := other.Execute("INSERT INTO users (name, email) VALUES ('Dora', ?)", fmt.Sprintf("dora%d@example.com", i)); err != nil {
+			t.Fatalf("insert failed: %v", err)
+		}
+		select {
+		case change = <-changes:
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+	if change.Path != manager.GetDatabase("test").Path || change.Schema || change.Size == 0 {
+		t.Errorf("change = %+v, want a data change to the test database", change)
+	}
+
+	if _, err := manager.ExecuteQuery(context.Background(), "test", admin, "", "CREATE TABLE notes (body TEXT)"); err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	timeout := time.After(2 * time.Second)
+	for !change.Schema {
+		select {
+		case change = <-changes:
+		case <-timeout:
+			t.Fatal("no schema change reported")
+		}
+	}
+
+	cancel()
+	for range changes {
 	}
 }
 
-// TestManager_WriteOperations tests that write operations work for authorized users.
-func TestManager_WriteOperations(t *testing.T) {
+// TestManager_Follow tests that a followed table streams rows written
+// after it was followed.
+func TestManager_Follow(t *testing.T) {
+	defer func(d time.Duration) { changePollInterval = d }(changePollInterval)
+	changePollInterval = 10 * time.Millisecond
+
 	dbPath, cleanup := testutil.TestDB(t, "users.db")
 	defer cleanup()
 
 	cfg := &config.Config{
-		Databases: []config.DatabaseSource{
-			{Path: dbPath, Alias: "test"},
-		},
+		Databases: []config.DatabaseSource{{Path: dbPath, Alias: "test"}},
 		Users: []config.User{
 			{Name: "admin", Admin: true},
+			{Name: "nobody"},
+		},
+	}
+	manager, err := NewManager(cfg)
+	if err != nil {
+		t.Fatalf("failed to create manager: %v", err)
+	}
+	if err := manager.Start(); err != nil {
+		t.Fatalf("failed to start manager: %v", err)
+	}
+	defer manager.Stop()
+	admin := &access.UserInfo{Name: "admin", IsAdmin: true}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if _, _, err := manager.Follow(ctx, "test", &access.UserInfo{Name: "nobody"}, "users"); !errors.Is(err, ErrAccessDenied) {
+		t.Errorf("expected access denied, got %v", err)
+	}
+	_, events, err := manager.Follow(ctx, "test", admin, "users")
+	if err != nil {
+		t.Fatalf("Follow failed: %v", err)
+	}
+
+	// Write until the change watch has started and reports
+	var e FeedEvent
+	for i := 0; e.Op == ""; i++ {
+		if i == 100 {
+			t.Fatal("no row followed")
+		}
+		if _, err := manager.ExecuteQuery(ctx, "test", admin, "", fmt.Sprintf("INSERT INTO users (name, email) VALUES ('Dora', 'dora%d@example.com')", i)); err != nil {
+			t.Fatalf("insert failed: %v", err)
+		}
+		select {
+		case e = <-events:
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+	if e.Op != FeedInsert || e.Table != "users" || e.Err != nil || !slices.Contains(e.Row, any("Dora")) {
+		t.Errorf("event = %+v, want an insert of Dora", e)
+	}
+
+	cancel()
+	for range events {
+	}
+}
+
+// TestManager_ReadsDuringWrite tests that reads on a read-write connection
+// don't wait for an open write transaction.
+func TestManager_ReadsDuringWrite(t *testing.T) {
+	dbPath, cleanup := testutil.TestDB(t, "users.db")
+	defer cleanup()
+
+	cfg := &config.Config{
+		Databases: []config.DatabaseSource{
+			{Path: dbPath, Alias: "test"},
 		},
+		Users: []config.User{{Name: "admin", Admin: true}},
 	}
 
 	manager, err := NewManager(cfg)
@@ -277,88 +517,2019 @@ func TestManager_WriteOperations(t *testing.T) {
 	}
 	defer manager.Stop()
 
-	admin := &access.UserInfo{Name: "admin", IsAdmin: true}
+	conn, err := manager.OpenConnection("test", &access.UserInfo{Name: "admin", IsAdmin: true})
+	if err != nil {
+		t.Fatalf("failed to open connection: %v", err)
+	}
 
-	// Insert
-	result, err := manager.ExecuteQuery("test", admin, "sess1",
-		"INSERT INTO users (name, email) VALUES ('NewUser', 'new@test.com')")
+	tx, err := conn.Begin()
 	if err != nil {
-		t.Fatalf("INSERT failed: %v", err)
+		t.Fatalf("failed to begin: %v", err)
 	}
-	if result.RowsAffected != 1 {
-		t.Errorf("expected 1 row affected, got %d", result.RowsAffected)
+	defer tx.Rollback()
+	if _, err := tx.Exec("INSERT INTO users (name, email) VALUES ('x', 'x@x.com')"); err != nil {
+		t.Fatalf("insert failed: %v", err)
 	}
 
-	// Update
-	result, err = manager.ExecuteQuery("test", admin, "sess1",
-		"UPDATE users SET name = 'UpdatedUser' WHERE email = 'new@test.com'")
+	// The uncommitted row is invisible to readers, which don't block
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	var before int
+	rows, err := conn.QueryContext(ctx, "SELECT COUNT(*) FROM users WHERE name = 'x'")
 	if err != nil {
-		t.Fatalf("UPDATE failed: %v", err)
+		t.Fatalf("read during write failed: %v", err)
 	}
-	if result.RowsAffected != 1 {
-		t.Errorf("expected 1 row affected, got %d", result.RowsAffected)
+	for rows.Next() {
+		rows.Scan(&before)
 	}
+	rows.Close()
+	if before != 0 {
+		t.Errorf("reader saw %d uncommitted rows", before)
+	}
+}
 
-	// Verify update
-	result, err = manager.ExecuteQuery("test", admin, "",
-		"SELECT name FROM users WHERE email = 'new@test.com'")
+// TestDiscovery_DetectsByHeader tests that discovery recognizes databases
+// by their header rather than their name.
+func TestDiscovery_DetectsByHeader(t *testing.T) {
+	dbPath, cleanup := testutil.TestDB(t, "users.db")
+	defer cleanup()
+
+	dir := filepath.Dir(dbPath)
+	data, err := os.ReadFile(dbPath)
 	if err != nil {
-		t.Fatalf("SELECT failed: %v", err)
+		t.Fatal(err)
 	}
-	if len(result.Rows) != 1 || result.Rows[0][0] != "UpdatedUser" {
-		t.Errorf("expected 'UpdatedUser', got %v", result.Rows)
+	files := map[string][]byte{
+		"data.sqlite.bak": data,
+		"noext":           data,
+		"export.DATA":     data,
+		"notes.db":        []byte("just some text, not a database"),
+		"notes.data":      []byte("more text"),
+		"new.db":          nil,
+		"readme.txt":      []byte("hello"),
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), content, 0o644); err != nil {
+			t.Fatal(err)
+		}
 	}
 
-	// Delete
-	result, err = manager.ExecuteQuery("test", admin, "sess1",
-		"DELETE FROM users WHERE email = 'new@test.com'")
+	discover := func(detect string, extensions ...string) []string {
+		t.Helper()
+		d, err := NewDiscovery([]config.DatabaseSource{{Path: dir, Detect: detect, Extensions: extensions}})
+		if err != nil {
+			t.Fatalf("failed to create discovery: %v", err)
+		}
+		defer d.watcher.Close()
+		if err := d.scan(); err != nil {
+			t.Fatalf("scan failed: %v", err)
+		}
+		var names []string
+		for _, db := range d.GetDatabases() {
+			names = append(names, filepath.Base(db.Path))
+		}
+		slices.Sort(names)
+		return names
+	}
+
+	if got, want := discover(""), []string{"data.sqlite.bak", "export.DATA", "new.db", "noext", "users.db"}; !slices.Equal(got, want) {
+		t.Errorf("header detection found %v, want %v", got, want)
+	}
+	if got, want := discover(config.DetectExtension), []string{"new.db", "notes.db", "users.db"}; !slices.Equal(got, want) {
+		t.Errorf("extension detection found %v, want %v", got, want)
+	}
+
+	// Extra extensions, "" for none; both filters out files so named that
+	// aren't databases
+	want := []string{"export.DATA", "new.db", "noext", "notes.data", "notes.db", "users.db"}
+	if got := discover(config.DetectExtension, "data", ""); !slices.Equal(got, want) {
+		t.Errorf("extension detection with extra extensions found %v, want %v", got, want)
+	}
+	want = []string{"export.DATA", "new.db", "noext", "users.db"}
+	if got := discover(config.DetectBoth, ".data", ""); !slices.Equal(got, want) {
+		t.Errorf("detecting by both found %v, want %v", got, want)
+	}
+	want = []string{"new.db", "users.db"}
+	if got := discover(config.DetectBoth); !slices.Equal(got, want) {
+		t.Errorf("detecting by both without extra extensions found %v, want %v", got, want)
+	}
+
+	// A file named explicitly must be a database
+	d, err := NewDiscovery(nil)
 	if err != nil {
-		t.Fatalf("DELETE failed: %v", err)
+		t.Fatal(err)
 	}
-	if result.RowsAffected != 1 {
-		t.Errorf("expected 1 row affected, got %d", result.RowsAffected)
+	defer d.watcher.Close()
+	if _, _, err := d.discoverSource(&config.DatabaseSource{Path: filepath.Join(dir, "notes.db")}); !errors.Is(err, ErrNotSQLite) {
+		t.Errorf("discovering a text file = %v, want ErrNotSQLite", err)
 	}
 }
 
-// TestIsReadOnlyQuery tests the read-only query detection.
-func TestIsReadOnlyQuery(t *testing.T) {
-	tests := []struct {
-		query    string
-		readOnly bool
-	}{
-		{"SELECT * FROM users", true},
-		{"select * from users", true},
-		{"  SELECT * FROM users", true},
-		{"\n\tSELECT * FROM users", true},
-		{"PRAGMA table_info(users)", true},
-		{"pragma table_info(users)", true},
-		{"EXPLAIN SELECT * FROM users", true},
-		{"WITH cte AS (SELECT 1) SELECT * FROM cte", true},
+// TestDiscovery_Duplicates tests that a file reached through symlinks, hard
+// links or overlapping sources is listed once, under the preferred alias.
+func TestDiscovery_Duplicates(t *testing.T) {
+	dbPath, cleanup := testutil.TestDB(t, "users.db")
+	defer cleanup()
 
-		{"INSERT INTO users VALUES (1)", false},
-		{"insert into users values (1)", false},
-		{"UPDATE users SET x = 1", false},
-		{"DELETE FROM users", false},
-		{"DROP TABLE users", false},
-		{"CREATE TABLE t (id INT)", false},
-		{"ALTER TABLE users ADD x INT", false},
-		{"VACUUM", false},
-		{"REINDEX", false},
+	dir := filepath.Dir(dbPath)
+	linkPath := filepath.Join(dir, "link.db")
+	if err := os.Symlink(dbPath, linkPath); err != nil {
+		t.Skipf("symlinks unavailable: %v", err)
+	}
+	sources := []config.DatabaseSource{{Path: dir}}
+	want := []string{"link", "users"}
+	info, err := os.Stat(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fileID(info); ok {
+		// A hard link is found by a later source, so the first found wins
+		hardPath := filepath.Join(dir, "copies", "hard.db")
+		if err := os.Mkdir(filepath.Dir(hardPath), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Link(dbPath, hardPath); err != nil {
+			t.Fatal(err)
+		}
+		sources = append(sources, config.DatabaseSource{Path: hardPath})
+		want = []string{"hard", "link", "users"}
 	}
 
-	for _, tt := range tests {
-		t.Run(tt.query[:min(30, len(tt.query))], func(t *testing.T) {
-			got := isReadOnlyQuery(tt.query)
-			if got != tt.readOnly {
-				t.Errorf("isReadOnlyQuery(%q) = %v, want %v", tt.query, got, tt.readOnly)
-			}
-		})
+	discover := func(sources ...config.DatabaseSource) *Discovery {
+		t.Helper()
+		d, err := NewDiscovery(sources)
+		if err != nil {
+			t.Fatalf("failed to create discovery: %v", err)
+		}
+		if err := d.scan(); err != nil {
+			t.Fatalf("scan failed: %v", err)
+		}
+		d.watcher.Close()
+		return d
+	}
+
+	// The file itself is preferred over links to it
+	d := discover(sources...)
+	dbs := d.GetDatabases()
+	if len(dbs) != 1 {
+		t.Fatalf("found %d databases, want 1", len(dbs))
+	}
+	if got := dbs[0].Alias; got != "users" {
+		t.Errorf("alias = %q, want users", got)
+	}
+	if got := append([]string{dbs[0].Alias}, dbs[0].Aliases...); !slices.Equal(sorted(got), want) {
+		t.Errorf("aliases = %v, want %v", got, want)
+	}
+	if got := d.GetDatabase("link"); got != dbs[0] {
+		t.Errorf("GetDatabase(link) = %v, want the deduplicated database", got)
+	}
+
+	// An alias set in the config wins, wherever its source is
+	d = discover(config.DatabaseSource{Path: dir}, config.DatabaseSource{Path: linkPath, Alias: "main"})
+	dbs = d.GetDatabases()
+	if len(dbs) != 1 || dbs[0].Alias != "main" {
+		t.Fatalf("found %v, want only main", dbs)
+	}
+	if got := d.GetDatabase("users"); got != dbs[0] {
+		t.Errorf("GetDatabase(users) = %v, want main", got)
 	}
 }
 
-func min(a, b int) int {
-	if a < b {
-		return a
+func sorted(s []string) []string {
+	s = slices.Clone(s)
+	slices.Sort(s)
+	return s
+}
+
+// TestDiscovery_Exclude tests that exclude patterns leave out files and
+// whole directories, in directory and glob sources.
+func TestDiscovery_Exclude(t *testing.T) {
+	dbPath, cleanup := testutil.TestDB(t, "users.db")
+	defer cleanup()
+
+	dir := filepath.Dir(dbPath)
+	data, err := os.ReadFile(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"users_backup.db", "node_modules/pkg/cache.db", "tmp/scratch.db", "keep/orders.db"} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	exclude := []string{"*_backup.db", "node_modules", "tmp/**"}
+	for _, source := range []config.DatabaseSource{
+		{Path: dir, Recursive: true, Exclude: exclude},
+		{Path: filepath.Join(dir, "**", "*.db"), Exclude: exclude},
+	} {
+		d, err := NewDiscovery([]config.DatabaseSource{source})
+		if err != nil {
+			t.Fatalf("failed to create discovery: %v", err)
+		}
+		if err := d.scan(); err != nil {
+			t.Fatalf("scan failed: %v", err)
+		}
+		var names []string
+		for _, db := range d.GetDatabases() {
+			names = append(names, filepath.Base(db.Path))
+		}
+		d.watcher.Close()
+		slices.Sort(names)
+		if want := []string{"orders.db", "users.db"}; !slices.Equal(names, want) {
+			t.Errorf("%s found %v, want %v", source.Path, names, want)
+		}
+	}
+
+	// An invalid pattern fails the source rather than excluding nothing
+	d, err := NewDiscovery(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.watcher.Close()
+	if _, _, err := d.discoverSource(&config.DatabaseSource{Path: dir, Exclude: []string{"[backup"}}); err == nil {
+		t.Error("expected an invalid exclude pattern to fail")
+	}
+}
+
+// TestManager_AttachGroup tests that a source's companion databases are
+// attached for users who can read them.
+func TestManager_AttachGroup(t *testing.T) {
+	dbPath, cleanup := testutil.TestDB(t, "users.db")
+	defer cleanup()
+
+	archivePath := filepath.Join(filepath.Dir(dbPath), "archive.db")
+	data, err := os.ReadFile(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(archivePath, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{
+		Databases: []config.DatabaseSource{
+			{Path: dbPath, Alias: "main", Attach: map[string]string{"archive": "archive.db"}},
+			{Path: archivePath, Alias: "archive"},
+		},
+		Users: []config.User{
+			{Name: "admin", Admin: true},
+			{Name: "reader", Access: []config.AccessRule{{Pattern: "main", Level: "read-write"}}},
+		},
+	}
+
+	manager, err := NewManager(cfg)
+	if err != nil {
+		t.Fatalf("failed to create manager: %v", err)
+	}
+	if err := manager.Start(); err != nil {
+		t.Fatalf("failed to start manager: %v", err)
+	}
+	defer manager.Stop()
+
+	ctx := context.Background()
+	admin := &access.UserInfo{Name: "admin", IsAdmin: true}
+	reader := &access.UserInfo{Name: "reader"}
+	join := "SELECT COUNT(*) FROM users u JOIN archive.users a ON a.id = u.id"
+
+	result, err := manager.ExecuteQuery(ctx, "main", admin, "", join)
+	if err != nil {
+		t.Fatalf("join across the group failed: %v", err)
+	}
+	if FormatValue(result.Rows[0][0]) == "0" {
+		t.Error("expected joined rows")
+	}
+
+	// Companions are read-only, and only for users who can read them
+	if _, err := manager.ExecuteQuery(ctx, "main", admin, "", "DELETE FROM archive.users"); err == nil {
+		t.Error("expected write to attached companion to fail")
+	}
+	if _, err := manager.ExecuteQuery(ctx, "main", reader, "", join); err == nil {
+		t.Error("expected companion to be hidden from a user without access")
+	}
+
+	// Explicit attachments can't reuse the group's schema names
+	_, err = manager.ExecuteQueryAttached(ctx, "main", []Attachment{{Database: "archive", Schema: "archive"}}, admin, "", join)
+	if !errors.Is(err, ErrInvalidAttachment) {
+		t.Errorf("attaching over a group schema = %v, want ErrInvalidAttachment", err)
+	}
+}
+
+// TestManager_ExecuteCrossQuery tests queries naming tables of other
+// databases by alias, including aliases that aren't valid schema names.
+func TestManager_ExecuteCrossQuery(t *testing.T) {
+	dbPath, cleanup := testutil.TestDB(t, "users.db")
+	defer cleanup()
+
+	salesPath := filepath.Join(filepath.Dir(dbPath), "sales.db")
+	data, err := os.ReadFile(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(salesPath, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{
+		Databases: []config.DatabaseSource{
+			{Path: dbPath, Alias: "users"},
+			{Path: salesPath, Alias: "sales-2024"},
+		},
+		Users: []config.User{
+			{Name: "admin", Admin: true},
+			{Name: "reader", Access: []config.AccessRule{{Pattern: "users", Level: "read-only"}}},
+		},
+	}
+
+	manager, err := NewManager(cfg)
+	if err != nil {
+		t.Fatalf("failed to create manager: %v", err)
+	}
+	if err := manager.Start(); err != nil {
+		t.Fatalf("failed to start manager: %v", err)
+	}
+	defer manager.Stop()
+
+	ctx := context.Background()
+	admin := &access.UserInfo{Name: "admin", IsAdmin: true}
+	reader := &access.UserInfo{Name: "reader"}
+	join := `SELECT COUNT(*) FROM users u JOIN "sales-2024".users s ON s.id = u.id WHERE u.name <> 'sales-2024.users'`
+
+	refs := manager.ReferencedDatabases("users", join)
+	if !slices.Equal(refs, []string{"sales-2024"}) {
+		t.Fatalf("ReferencedDatabases = %v, want [sales-2024]", refs)
+	}
+	if refs := manager.ReferencedDatabases("users", "SELECT u.name FROM users u"); len(refs) != 0 {
+		t.Errorf("ReferencedDatabases without qualified tables = %v", refs)
+	}
+
+	result, err := manager.ExecuteCrossQuery(ctx, []string{"users", "sales-2024"}, admin, "", join)
+	if err != nil {
+		t.Fatalf("cross-database join failed: %v", err)
+	}
+	if FormatValue(result.Rows[0][0]) == "0" {
+		t.Error("expected joined rows")
+	}
+
+	// Every database is access-checked
+	if _, err := manager.ExecuteCrossQuery(ctx, []string{"users", "sales-2024"}, reader, "", join); !errors.Is(err, ErrAccessDenied) {
+		t.Errorf("cross query without access to the other database = %v, want ErrAccessDenied", err)
+	}
+
+	// The attachment is gone after the query
+	if _, err := manager.ExecuteQuery(ctx, "users", admin, "", "SELECT * FROM sales_2024.users"); err == nil {
+		t.Error("expected the attached database to be detached after the query")
+	}
+}
+
+// TestManager_EncryptedDatabase tests that keys reach the driver, and that
+// the default driver refuses encrypted databases.
+func TestManager_EncryptedDatabase(t *testing.T) {
+	dbPath, cleanup := testutil.TestDB(t, "users.db")
+	defer cleanup()
+
+	keyFile := filepath.Join(filepath.Dir(dbPath), "key")
+	if err := os.WriteFile(keyFile, []byte("s3cret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{
+		Databases: []config.DatabaseSource{{Path: dbPath, Alias: "vault", KeyFile: keyFile}},
+		Users:     []config.User{{Name: "admin", Admin: true}},
+	}
+	manager, err := NewManager(cfg)
+	if err != nil {
+		t.Fatalf("failed to create manager: %v", err)
+	}
+	if err := manager.Start(); err != nil {
+		t.Fatalf("failed to start manager: %v", err)
+	}
+	defer manager.Stop()
+
+	ctx := context.Background()
+	admin := &access.UserInfo{Name: "admin", IsAdmin: true}
+	if _, err := manager.ExecuteQuery(ctx, "vault", admin, "", "SELECT 1"); !errors.Is(err, ErrEncryptionUnsupported) {
+		t.Fatalf("query with the default driver = %v, want ErrEncryptionUnsupported", err)
+	}
+
+	var mu sync.Mutex
+	var keys []string
+	SetDriver(Driver{Name: "sqlite", Encryption: true, DSN: func(p DSNParams) string {
+		mu.Lock()
+		keys = append(keys, p.Key)
+		mu.Unlock()
+		return moderncDSN(p)
+	}})
+	defer SetDriver(DefaultDriver)
+
+	if _, err := manager.ExecuteQuery(ctx, "vault", admin, "", "SELECT COUNT(*) FROM users"); err != nil {
+		t.Fatalf("query with an encrypting driver failed: %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(keys) == 0 || !slices.Equal(slices.Compact(keys), []string{"s3cret"}) {
+		t.Errorf("driver got keys %q, want s3cret", keys)
+	}
+}
+
+// TestManager_ConnectionEviction tests the cap on open connections and the
+// idle timeout.
+func TestManager_ConnectionEviction(t *testing.T) {
+	usersPath, cleanup := testutil.TestDB(t, "users.db")
+	defer cleanup()
+	largePath, cleanup2 := testutil.TestDB(t, "large.db")
+	defer cleanup2()
+
+	cfg := &config.Config{
+		Databases: []config.DatabaseSource{
+			{Path: usersPath, Alias: "users"},
+			{Path: largePath, Alias: "large"},
+		},
+		Users:       []config.User{{Name: "admin", Admin: true}},
+		Connections: config.ConnectionsConfig{IdleTimeout: "5m", MaxOpen: 1},
+	}
+
+	manager, err := NewManager(cfg)
+	if err != nil {
+		t.Fatalf("failed to create manager: %v", err)
+	}
+	if err := manager.Start(); err != nil {
+		t.Fatalf("failed to start manager: %v", err)
+	}
+	defer manager.Stop()
+
+	admin := &access.UserInfo{Name: "admin", IsAdmin: true}
+	first, err := manager.OpenConnection("users", admin)
+	if err != nil {
+		t.Fatalf("failed to open users: %v", err)
+	}
+	if _, err := manager.OpenConnection("large", admin); err != nil {
+		t.Fatalf("failed to open large: %v", err)
+	}
+	if n := manager.OpenConnections(); n != 1 {
+		t.Errorf("open connections = %d, want 1 under max_open", n)
+	}
+	if err := first.DB.Ping(); err == nil {
+		t.Error("expected the least recently used connection to be closed")
+	}
+
+	manager.evictIdle(time.Now().Add(time.Minute))
+	if n := manager.OpenConnections(); n != 1 {
+		t.Errorf("open connections = %d, want 1 before the idle timeout", n)
+	}
+	manager.evictIdle(time.Now().Add(10 * time.Minute))
+	if n := manager.OpenConnections(); n != 0 {
+		t.Errorf("open connections = %d, want 0 after the idle timeout", n)
+	}
+
+	// Evicted databases reopen on use
+	conn, err := manager.OpenConnection("users", admin)
+	if err != nil {
+		t.Fatalf("failed to reopen users: %v", err)
+	}
+	if _, err := Query(conn, "SELECT COUNT(*) FROM users"); err != nil {
+		t.Errorf("query on reopened connection failed: %v", err)
+	}
+}
+
+// TestManager_SessionTransaction tests transactions bound to a session.
+func TestManager_SessionTransaction(t *testing.T) {
+	dbPath, cleanup := testutil.TestDB(t, "users.db")
+	defer cleanup()
+
+	cfg := &config.Config{
+		Databases: []config.DatabaseSource{
+			{Path: dbPath, Alias: "test"},
+		},
+		Users: []config.User{{Name: "admin", Admin: true}},
+	}
+
+	manager, err := NewManager(cfg)
+	if err != nil {
+		t.Fatalf("failed to create manager: %v", err)
+	}
+	if err := manager.Start(); err != nil {
+		t.Fatalf("failed to start manager: %v", err)
+	}
+	defer manager.Stop()
+
+	admin := &access.UserInfo{Name: "admin", IsAdmin: true}
+	ctx := context.Background()
+	count := func() string {
+		t.Helper()
+		result, err := manager.ExecuteQuery(ctx, "test", admin, "other", "SELECT COUNT(*) FROM users WHERE name = 'tx'")
+		if err != nil {
+			t.Fatalf("count failed: %v", err)
+		}
+		return FormatValue(result.Rows[0][0])
+	}
+
+	if err := manager.BeginTx("test", admin, "s1"); err != nil {
+		t.Fatalf("BeginTx failed: %v", err)
+	}
+	if err := manager.BeginTx("test", admin, "s1"); !errors.Is(err, ErrInTransaction) {
+		t.Errorf("second BeginTx = %v, want ErrInTransaction", err)
+	}
+	if _, err := manager.ExecuteQuery(ctx, "test", admin, "s1", "INSERT INTO users (name, email) VALUES ('tx', 'tx@x.com')"); err != nil {
+		t.Fatalf("insert in transaction failed: %v", err)
+	}
+
+	// The session sees its own write; others see neither it nor the lock
+	result, err := manager.ExecuteQuery(ctx, "test", admin, "s1", "SELECT COUNT(*) FROM users WHERE name = 'tx'")
+	if err != nil || FormatValue(result.Rows[0][0]) != "1" {
+		t.Errorf("session count = %v, %v; want 1", result, err)
+	}
+	if got := count(); got != "0" {
+		t.Errorf("uncommitted row visible to other session: %s", got)
+	}
+	var lockErr *LockError
+	if _, err := manager.ExecuteQuery(ctx, "test", admin, "other", "DELETE FROM users WHERE id = 1"); !errors.As(err, &lockErr) {
+		t.Errorf("write by other session = %v, want LockError", err)
+	}
+
+	if err := manager.RollbackTx("s1"); err != nil {
+		t.Fatalf("RollbackTx failed: %v", err)
+	}
+	if got := count(); got != "0" {
+		t.Errorf("rolled back row count = %s, want 0", got)
+	}
+	if err := manager.CommitTx("s1"); !errors.Is(err, ErrNoTransaction) {
+		t.Errorf("CommitTx without transaction = %v, want ErrNoTransaction", err)
+	}
+
+	// Committed writes persist
+	if err := manager.BeginTx("test", admin, "s1"); err != nil {
+		t.Fatalf("BeginTx failed: %v", err)
+	}
+	manager.ExecuteQuery(ctx, "test", admin, "s1", "INSERT INTO users (name, email) VALUES ('tx', 'tx@x.com')")
+	if err := manager.CommitTx("s1"); err != nil {
+		t.Fatalf("CommitTx failed: %v", err)
+	}
+	if got := count(); got != "1" {
+		t.Errorf("committed row count = %s, want 1", got)
+	}
+
+	// Ending the session rolls back what it left open
+	if err := manager.BeginTx("test", admin, "s2"); err != nil {
+		t.Fatalf("BeginTx failed: %v", err)
+	}
+	manager.ExecuteQuery(ctx, "test", admin, "s2", "DELETE FROM users WHERE name = 'tx'")
+	manager.EndSession("s2")
+	if manager.Tx("s2") != nil || manager.GetLockManager().IsLocked(dbPath) {
+		t.Error("expected ended session's transaction and lock to be released")
+	}
+	if got := count(); got != "1" {
+		t.Errorf("row count after ended session = %s, want 1", got)
+	}
+}
+
+// TestManager_Savepoints tests partial rollback within a session transaction.
+func TestManager_Savepoints(t *testing.T) {
+	dbPath, cleanup := testutil.TestDB(t, "users.db")
+	defer cleanup()
+
+	cfg := &config.Config{
+		Databases: []config.DatabaseSource{
+			{Path: dbPath, Alias: "test"},
+		},
+		Users: []config.User{{Name: "admin", Admin: true}},
+	}
+
+	manager, err := NewManager(cfg)
+	if err != nil {
+		t.Fatalf("failed to create manager: %v", err)
+	}
+	if err := manager.Start(); err != nil {
+		t.Fatalf("failed to start manager: %v", err)
+	}
+	defer manager.Stop()
+
+	admin := &access.UserInfo{Name: "admin", IsAdmin: true}
+	ctx := context.Background()
+	insert := func(name string) {
+		t.Helper()
+		q := fmt.Sprintf("INSERT INTO users (name, email) VALUES ('%s', '%s@x.com')", name, name)
+		if _, err := manager.ExecuteQuery(ctx, "test", admin, "s1", q); err != nil {
+			t.Fatalf("insert %s failed: %v", name, err)
+		}
+	}
+
+	if err := manager.Savepoint("s1", "a"); !errors.Is(err, ErrNoTransaction) {
+		t.Errorf("Savepoint without transaction = %v, want ErrNoTransaction", err)
+	}
+	if err := manager.BeginTx("test", admin, "s1"); err != nil {
+		t.Fatalf("BeginTx failed: %v", err)
+	}
+
+	insert("sp1")
+	if err := manager.Savepoint("s1", "a"); err != nil {
+		t.Fatalf("Savepoint failed: %v", err)
+	}
+	insert("sp2")
+	if err := manager.Savepoint("s1", "b"); err != nil {
+		t.Fatalf("Savepoint failed: %v", err)
+	}
+	insert("sp3")
+
+	// Rolling back to a keeps it and forgets b
+	if err := manager.RollbackToSavepoint("s1", "a"); err != nil {
+		t.Fatalf("RollbackToSavepoint failed: %v", err)
+	}
+	info := manager.Tx("s1")
+	if info.Writes != 1 || len(info.Savepoints) != 1 || info.Savepoints[0] != "a" {
+		t.Errorf("after rollback: writes = %d, savepoints = %v; want 1, [a]", info.Writes, info.Savepoints)
+	}
+	if err := manager.ReleaseSavepoint("s1", "b"); !errors.Is(err, ErrNoSavepoint) {
+		t.Errorf("ReleaseSavepoint of forgotten savepoint = %v, want ErrNoSavepoint", err)
+	}
+
+	insert("sp4")
+	if err := manager.ReleaseSavepoint("s1", "a"); err != nil {
+		t.Fatalf("ReleaseSavepoint failed: %v", err)
+	}
+	if err := manager.CommitTx("s1"); err != nil {
+		t.Fatalf("CommitTx failed: %v", err)
+	}
+
+	result, err := manager.ExecuteQuery(ctx, "test", admin, "", "SELECT group_concat(name) FROM (SELECT name FROM users WHERE name LIKE 'sp%' ORDER BY name)")
+	if err != nil {
+		t.Fatalf("query failed: %v", err)
+	}
+	if got := FormatValue(result.Rows[0][0]); got != "sp1,sp4" {
+		t.Errorf("committed rows = %s, want sp1,sp4", got)
+	}
+}
+
+// TestConnection_NestedTransaction tests that WithTransaction on a bound
+// connection rolls back only its own work.
+func TestConnection_NestedTransaction(t *testing.T) {
+	dbPath, cleanup := testutil.TestDB(t, "users.db")
+	defer cleanup()
+
+	conn, err := OpenReadWrite(dbPath)
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+	defer conn.Close()
+
+	tx, err := conn.Begin()
+	if err != nil {
+		t.Fatalf("Begin failed: %v", err)
+	}
+	defer tx.Rollback()
+	bound := conn.inTx(tx)
+
+	bound.WithTransaction(func(tx *sql.Tx) error {
+		_, err := tx.Exec("INSERT INTO users (name, email) VALUES ('kept', 'kept@x.com')")
+		return err
+	})
+	err = bound.WithTransaction(func(tx *sql.Tx) error {
+		tx.Exec("INSERT INTO users (name, email) VALUES ('undone', 'undone@x.com')")
+		return errors.New("fail")
+	})
+	if err == nil {
+		t.Fatal("expected nested transaction error")
+	}
+
+	var names string
+	if err := tx.QueryRow("SELECT group_concat(name) FROM users WHERE name IN ('kept', 'undone')").Scan(&names); err != nil {
+		t.Fatalf("query failed: %v", err)
+	}
+	if names != "kept" {
+		t.Errorf("rows = %q, want kept", names)
+	}
+}
+
+// TestConnection_BusyRetry tests that a write blocked by another process
+// holding the file succeeds once the lock is released, and fails at once
+// with retries off.
+func TestConnection_BusyRetry(t *testing.T) {
+	dbPath, cleanup := testutil.TestDB(t, "users.db")
+	defer cleanup()
+
+	// Another process, as far as SQLite can tell
+	other, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+	defer other.Close()
+	lock := func() *sql.Conn {
+		c, err := other.Conn(context.Background())
+		if err != nil {
+			t.Fatalf("failed to get connection: %v", err)
+		}
+		if _, err := c.ExecContext(context.Background(), "BEGIN EXCLUSIVE"); err != nil {
+			t.Fatalf("failed to lock: %v", err)
+		}
+		return c
+	}
+	unlock := func(c *sql.Conn) {
+		c.ExecContext(context.Background(), "ROLLBACK")
+		c.Close()
+	}
+
+	opts := DefaultOpenOptions()
+	opts.BusyTimeout = 0
+	opts.BusyRetry.Retries = 0
+	conn, err := Open(dbPath, opts)
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+	defer conn.Close()
+
+	held := lock()
+	if _, err := conn.Execute("INSERT INTO users (name, email) VALUES ('a', 'a@x.com')"); !IsWALLockError(err) {
+		t.Errorf("without retries: got %v, want database is locked", err)
+	}
+
+	conn.busyRetry = RetryPolicy{Retries: 10, BaseDelay: 20 * time.Millisecond, MaxDelay: 100 * time.Millisecond}
+	time.AfterFunc(50*time.Millisecond, func() { unlock(held) })
+	if _, err := conn.Execute("INSERT INTO users (name, email) VALUES ('b', 'b@x.com')"); err != nil {
+		t.Errorf("with retries: %v", err)
+	}
+
+	// The deadline bounds the retries
+	held = lock()
+	defer unlock(held)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := conn.ExecuteContext(ctx, "INSERT INTO users (name, email) VALUES ('c', 'c@x.com')"); err == nil {
+		t.Error("expected an error past the deadline")
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("retried for %s past a 30ms deadline", elapsed)
+	}
+}
+
+// TestManager_ExecuteQuery_AccessDenied tests that write queries are denied for read-only users.
+func TestManager_ExecuteQuery_AccessDenied(t *testing.T) {
+	dbPath, cleanup := testutil.TestDB(t, "users.db")
+	defer cleanup()
+
+	cfg := &config.Config{
+		Databases: []config.DatabaseSource{
+			{Path: dbPath, Alias: "test"},
+		},
+		AnonymousAccess: "read-only",
+	}
+
+	manager, err := NewManager(cfg)
+	if err != nil {
+		t.Fatalf("failed to create manager: %v", err)
+	}
+	if err := manager.Start(); err != nil {
+		t.Fatalf("failed to start manager: %v", err)
+	}
+	defer manager.Stop()
+
+	user := &access.UserInfo{Name: "anon", IsAnonymous: true}
+
+	// SELECT should work
+	result, err := manager.ExecuteQuery(context.Background(), "test", user, "", "SELECT * FROM users")
+	if err != nil {
+		t.Errorf("SELECT query failed: %v", err)
+	}
+	if len(result.Rows) == 0 {
+		t.Error("expected rows from SELECT")
+	}
+
+	// INSERT should be denied
+	_, err = manager.ExecuteQuery(context.Background(), "test", user, "", "INSERT INTO users (name, email) VALUES ('x', 'x@x.com')")
+	if err == nil {
+		t.Error("expected INSERT to be denied for read-only user")
+	}
+	if !strings.Contains(err.Error(), "access denied") && !strings.Contains(err.Error(), "write permission") {
+		t.Errorf("expected access denied error, got: %v", err)
+	}
+
+	// UPDATE should be denied
+	_, err = manager.ExecuteQuery(context.Background(), "test", user, "", "UPDATE users SET name = 'y'")
+	if err == nil {
+		t.Error("expected UPDATE to be denied for read-only user")
+	}
+
+	// DELETE should be denied
+	_, err = manager.ExecuteQuery(context.Background(), "test", user, "", "DELETE FROM users")
+	if err == nil {
+		t.Error("expected DELETE to be denied for read-only user")
+	}
+
+	// DROP should be denied
+	_, err = manager.ExecuteQuery(context.Background(), "test", user, "", "DROP TABLE users")
+	if err == nil {
+		t.Error("expected DROP to be denied for read-only user")
+	}
+}
+
+// TestManager_FileStatements tests that SQL naming files is refused, so
+// databases can't be attached past the access checks or copied anywhere.
+func TestManager_FileStatements(t *testing.T) {
+	dbPath, cleanup := testutil.TestDB(t, "users.db")
+	defer cleanup()
+	otherPath, cleanupOther := testutil.TestDB(t, "users.db")
+	defer cleanupOther()
+
+	cfg := &config.Config{
+		Databases: []config.DatabaseSource{
+			{Path: dbPath, Alias: "test"},
+			{Path: otherPath, Alias: "secret"},
+		},
+		Users: []config.User{
+			{Name: "writer", Access: []config.AccessRule{{Pattern: "test", Level: "read-write"}}},
+		},
+	}
+	manager, err := NewManager(cfg)
+	if err != nil {
+		t.Fatalf("failed to create manager: %v", err)
+	}
+	if err := manager.Start(); err != nil {
+		t.Fatalf("failed to start manager: %v", err)
+	}
+	defer manager.Stop()
+
+	writer := &access.UserInfo{Name: "writer"}
+	admin := &access.UserInfo{Name: "admin", IsAdmin: true}
+	copyPath := filepath.Join(t.TempDir(), "copy.db")
+	for _, query := range []string{
+		fmt.Sprintf("ATTACH DATABASE '%s' AS s2; CREATE TABLE stolen AS SELECT * FROM s2.users", otherPath),
+		fmt.Sprintf("attach '%s' as s2", otherPath),
+		"DETACH DATABASE s2",
+		fmt.Sprintf("VACUUM INTO '%s'", copyPath),
+		fmt.Sprintf("SELECT 1; VACUUM main INTO '%s'", copyPath),
+	} {
+		for _, user := range []*access.UserInfo{writer, admin} {
+			if _, err := manager.ExecuteQuery(context.Background(), "test", user, "", query); !errors.Is(err, ErrAccessDenied) {
+				t.Errorf("ExecuteQuery(%s, %q) = %v, want ErrAccessDenied", user.Name, query, err)
+			}
+		}
+		attach := []Attachment{{Database: "test", Schema: "t2"}}
+		if _, err := manager.ExecuteQueryAttached(context.Background(), "secret", attach, admin, "", query); !errors.Is(err, ErrAccessDenied) {
+			t.Errorf("ExecuteQueryAttached(%q) = %v, want ErrAccessDenied", query, err)
+		}
+	}
+	if _, err := os.Stat(copyPath); !os.IsNotExist(err) {
+		t.Errorf("expected no copy to be written, stat = %v", err)
+	}
+
+	if _, err := manager.ExecuteQuery(context.Background(), "test", writer, "", "VACUUM"); err != nil {
+		t.Errorf("plain VACUUM failed: %v", err)
+	}
+}
+
+// TestManager_WithReadOnly tests that a read-only context keeps writers
+// from writing and runs their reads on a read-only connection.
+func TestManager_WithReadOnly(t *testing.T) {
+	dbPath, cleanup := testutil.TestDB(t, "users.db")
+	defer cleanup()
+
+	cfg := &config.Config{
+		Databases: []config.DatabaseSource{{Path: dbPath, Alias: "test"}},
+		Users: []config.User{
+			{Name: "writer", Access: []config.AccessRule{{Pattern: "*", Level: "read-write"}}},
+		},
+	}
+	manager, err := NewManager(cfg)
+	if err != nil {
+		t.Fatalf("failed to create manager: %v", err)
+	}
+	if err := manager.Start(); err != nil {
+		t.Fatalf("failed to start manager: %v", err)
+	}
+	defer manager.Stop()
+
+	writer := &access.UserInfo{Name: "writer"}
+	ctx := WithReadOnly(context.Background())
+	if _, err := manager.ExecuteQuery(ctx, "test", writer, "", "UPDATE users SET name = 'x'"); !errors.Is(err, ErrAccessDenied) {
+		t.Errorf("expected the write to be denied, got %v", err)
+	}
+	res, err := manager.ExecuteQueryArgs(ctx, "test", writer, "", "SELECT name FROM users WHERE id = ?", 1)
+	if err != nil || len(res.Rows) != 1 {
+		t.Fatalf("expected one row, got %v, %v", res, err)
+	}
+
+	// Even a write the classifier misses can't get through SQLite
+	conn, err := manager.openConnection("test", writer, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.DB.Exec("UPDATE users SET name = 'x'"); err == nil {
+		t.Error("expected the read-only connection to refuse a write")
+	}
+}
+
+func TestManager_TOTP(t *testing.T) {
+	dbPath, cleanup := testutil.TestDB(t, "users.db")
+	defer cleanup()
+
+	const secret = "JBSWY3DPEHPK3PXP"
+	cfg := &config.Config{
+		Databases: []config.DatabaseSource{{Path: dbPath, Alias: "test"}},
+		Users: []config.User{
+			{Name: "operator", TOTPSecret: secret, Access: []config.AccessRule{{Pattern: "*", Level: "read-write"}}},
+		},
+	}
+	manager, err := NewManager(cfg)
+	if err != nil {
+		t.Fatalf("failed to create manager: %v", err)
+	}
+	if err := manager.Start(); err != nil {
+		t.Fatalf("failed to start manager: %v", err)
+	}
+	defer manager.Stop()
+	operator := &access.UserInfo{Name: "operator"}
+
+	// Only DROP and DELETE statements count, not the words
+	for _, q := range []string{
+		"SELECT 'drop table users' AS note",
+		`SELECT 1 AS "delete"`,
+		"UPDATE posts SET title = 'deleted' WHERE id = 1 -- not a DELETE",
+	} {
+		if _, err := manager.ExecuteQuery(context.Background(), "test", operator, "", q); err != nil {
+			t.Errorf("%q: expected no code to be needed, got %v", q, err)
+		}
+	}
+	for _, q := range []string{"DELETE FROM posts WHERE id = 1", "WITH x AS (SELECT 1) DELETE FROM posts WHERE id = 1", "SELECT 1; DROP TABLE posts"} {
+		if _, err := manager.ExecuteQuery(context.Background(), "test", operator, "", q); !errors.Is(err, ErrTOTPRequired) {
+			t.Errorf("%q: expected ErrTOTPRequired, got %v", q, err)
+		}
+	}
+
+	code, err := totp.Code(secret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := manager.ExecuteQuery(WithTOTP(context.Background(), "000000"), "test", operator, "", "DELETE FROM posts WHERE id = 1"); !errors.Is(err, ErrTOTPInvalid) {
+		t.Errorf("expected a wrong code to be refused, got %v", err)
+	}
+
+	// A code covers the queries run with its context, once
+	ctx := WithTOTP(context.Background(), code)
+	for _, id := range []int{1, 2} {
+		if _, err := manager.ExecuteQuery(ctx, "test", operator, "", fmt.Sprintf("DELETE FROM posts WHERE id = %d", id)); err != nil {
+			t.Errorf("DELETE %d with a code: %v", id, err)
+		}
+	}
+	if _, err := manager.ExecuteQuery(WithTOTP(context.Background(), code), "test", operator, "", "DELETE FROM posts WHERE id = 3"); !errors.Is(err, ErrTOTPInvalid) {
+		t.Errorf("expected a reused code to be refused, got %v", err)
+	}
+	if _, err := manager.ExecuteQuery(WithTOTPVerified(context.Background()), "test", operator, "", "DELETE FROM posts WHERE id = 3"); err != nil {
+		t.Errorf("expected a verified context to need no code, got %v", err)
+	}
+}
+
+// TestManager_ListDatabases_Filtered tests that users only see accessible databases.
+func TestManager_ListDatabases_Filtered(t *testing.T) {
+	dbPath, cleanup := testutil.TestDB(t, "users.db")
+	defer cleanup()
+
+	cfg := &config.Config{
+		Databases: []config.DatabaseSource{
+			{Path: dbPath, Alias: "test"},
+		},
+		AnonymousAccess: "none",
+		Users: []config.User{
+			{Name: "reader", Access: []config.AccessRule{{Pattern: "test", Level: "read-only"}}},
+		},
+	}
+
+	manager, err := NewManager(cfg)
+	if err != nil {
+		t.Fatalf("failed to create manager: %v", err)
+	}
+	if err := manager.Start(); err != nil {
+		t.Fatalf("failed to start manager: %v", err)
+	}
+	defer manager.Stop()
+
+	// Reader should see the database
+	reader := &access.UserInfo{Name: "reader"}
+	dbs := manager.ListDatabases(reader)
+	if len(dbs) != 1 {
+		t.Errorf("expected 1 database for reader, got %d", len(dbs))
+	}
+
+	// Anonymous should not see any databases
+	anon := &access.UserInfo{Name: "anon", IsAnonymous: true}
+	dbs = manager.ListDatabases(anon)
+	if len(dbs) != 0 {
+		t.Errorf("expected 0 databases for anonymous, got %d", len(dbs))
+	}
+}
+
+// TestManager_UnknownDatabase tests accessing non-existent database.
+func TestManager_UnknownDatabase(t *testing.T) {
+	dbPath, cleanup := testutil.TestDB(t, "users.db")
+	defer cleanup()
+
+	cfg := &config.Config{
+		Databases: []config.DatabaseSource{
+			{Path: dbPath, Alias: "test"},
+		},
+		AnonymousAccess: "admin",
+	}
+
+	manager, err := NewManager(cfg)
+	if err != nil {
+		t.Fatalf("failed to create manager: %v", err)
+	}
+	if err := manager.Start(); err != nil {
+		t.Fatalf("failed to start manager: %v", err)
+	}
+	defer manager.Stop()
+
+	user := &access.UserInfo{Name: "admin", IsAdmin: true}
+
+	// Try to access non-existent database
+	_, err = manager.OpenConnection("nonexistent", user)
+	if err == nil {
+		t.Error("expected error for non-existent database")
+	}
+	if !strings.Contains(err.Error(), "not found") {
+		t.Errorf("expected 'not found' error, got: %v", err)
+	}
+
+	_, err = manager.ExecuteQuery(context.Background(), "nonexistent", user, "", "SELECT 1")
+	if err == nil {
+		t.Error("expected error for non-existent database")
+	}
+}
+
+// TestManager_WriteOperations tests that write operations work for authorized users.
+func TestManager_WriteOperations(t *testing.T) {
+	dbPath, cleanup := testutil.TestDB(t, "users.db")
+	defer cleanup()
+
+	cfg := &config.Config{
+		Databases: []config.DatabaseSource{
+			{Path: dbPath, Alias: "test"},
+		},
+		Users: []config.User{
+			{Name: "admin", Admin: true},
+		},
+	}
+
+	manager, err := NewManager(cfg)
+	if err != nil {
+		t.Fatalf("failed to create manager: %v", err)
+	}
+	if err := manager.Start(); err != nil {
+		t.Fatalf("failed to start manager: %v", err)
+	}
+	defer manager.Stop()
+
+	admin := &access.UserInfo{Name: "admin", IsAdmin: true}
+
+	// Insert
+	result, err := manager.ExecuteQuery(context.Background(), "test", admin, "sess1",
+		"INSERT INTO users (name, email) VALUES ('NewUser', 'new@test.com')")
+	if err != nil {
+		t.Fatalf("INSERT failed: %v", err)
+	}
+	if result.RowsAffected != 1 {
+		t.Errorf("expected 1 row affected, got %d", result.RowsAffected)
+	}
+
+	// Update
+	result, err = manager.ExecuteQuery(context.Background(), "test", admin, "sess1",
+		"UPDATE users SET name = 'UpdatedUser' WHERE email = 'new@test.com'")
+	if err != nil {
+		t.Fatalf("UPDATE failed: %v", err)
+	}
+	if result.RowsAffected != 1 {
+		t.Errorf("expected 1 row affected, got %d", result.RowsAffected)
+	}
+
+	// Verify update
+	result, err = manager.ExecuteQuery(context.Background(), "test", admin, "",
+		"SELECT name FROM users WHERE email = 'new@test.com'")
+	if err != nil {
+		t.Fatalf("SELECT failed: %v", err)
+	}
+	if len(result.Rows) != 1 || result.Rows[0][0] != "UpdatedUser" {
+		t.Errorf("expected 'UpdatedUser', got %v", result.Rows)
+	}
+
+	// Delete
+	result, err = manager.ExecuteQuery(context.Background(), "test", admin, "sess1",
+		"DELETE FROM users WHERE email = 'new@test.com'")
+	if err != nil {
+		t.Fatalf("DELETE failed: %v", err)
+	}
+	if result.RowsAffected != 1 {
+		t.Errorf("expected 1 row affected, got %d", result.RowsAffected)
+	}
+}
+
+// TestManager_Upload tests that uploads are validated and replace the database atomically.
+func TestManager_Upload(t *testing.T) {
+	dbPath, cleanup := testutil.TestDB(t, "users.db")
+	defer cleanup()
+	largePath, cleanupLarge := testutil.TestDB(t, "large.db")
+	defer cleanupLarge()
+
+	cfg := &config.Config{
+		Databases: []config.DatabaseSource{
+			{Path: dbPath, Alias: "test"},
+		},
+	}
+
+	manager, err := NewManager(cfg)
+	if err != nil {
+		t.Fatalf("failed to create manager: %v", err)
+	}
+	if err := manager.Start(); err != nil {
+		t.Fatalf("failed to start manager: %v", err)
+	}
+	defer manager.Stop()
+
+	admin := &access.UserInfo{Name: "admin", IsAdmin: true}
+	data, err := os.ReadFile(largePath)
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+
+	// A truncated file is rejected and leaves the database untouched
+	upload, err := manager.CreateUpload(dbPath)
+	if err != nil {
+		t.Fatalf("CreateUpload() error = %v", err)
+	}
+	upload.Write(data[:len(data)/2])
+	if err := upload.Commit("admin", "s1"); !errors.Is(err, ErrNotSQLite) {
+		t.Errorf("expected ErrNotSQLite for truncated upload, got %v", err)
+	}
+	if _, err := manager.ExecuteQuery(context.Background(), "test", admin, "s1", "SELECT COUNT(*) FROM users"); err != nil {
+		t.Errorf("database changed after rejected upload: %v", err)
+	}
+
+	// A locked database can't be replaced
+	manager.GetLockManager().TryLock(dbPath, "other", "s2")
+	upload, _ = manager.CreateUpload(dbPath)
+	upload.Write(data)
+	var lockErr *LockError
+	if err := upload.Commit("admin", "s1"); !errors.As(err, &lockErr) {
+		t.Errorf("expected LockError while locked, got %v", err)
+	}
+	manager.GetLockManager().Unlock(dbPath, "s2")
+
+	upload, _ = manager.CreateUpload(dbPath)
+	upload.Write(data)
+	if err := upload.Commit("admin", "s1"); err != nil {
+		t.Fatalf("Commit() error = %v", err)
+	}
+	if _, err := manager.ExecuteQuery(context.Background(), "test", admin, "s1", "SELECT COUNT(*) FROM records"); err != nil {
+		t.Errorf("expected uploaded database to be served, got %v", err)
+	}
+
+	entries, _ := os.ReadDir(filepath.Dir(dbPath))
+	for _, e := range entries {
+		if strings.Contains(e.Name(), ".upload-") {
+			t.Errorf("temporary upload file left behind: %s", e.Name())
+		}
+	}
+}
+
+// TestManager_LockPolicy tests the per-source write lock policies.
+func TestManager_LockPolicy(t *testing.T) {
+	dbPath, cleanup := testutil.TestDB(t, "users.db")
+	defer cleanup()
+
+	for _, tt := range []struct {
+		policy  string
+		wantErr bool
+	}{
+		{"", true},
+		{"fail", true},
+		{"wait", false},
+		{"none", false},
+	} {
+		t.Run("policy "+tt.policy, func(t *testing.T) {
+			cfg := &config.Config{
+				Databases: []config.DatabaseSource{
+					{Path: dbPath, Alias: "test", LockPolicy: tt.policy, LockTimeout: "2s"},
+				},
+				Users: []config.User{
+					{Name: "writer", Access: []config.AccessRule{{Pattern: "*", Level: "read-write"}}},
+				},
+			}
+			manager, err := NewManager(cfg)
+			if err != nil {
+				t.Fatalf("failed to create manager: %v", err)
+			}
+			if err := manager.Start(); err != nil {
+				t.Fatalf("failed to start manager: %v", err)
+			}
+			defer manager.Stop()
+
+			// Another session holds the lock briefly
+			unlock, err := manager.LockForWrite(context.Background(), "test", "other", "other-session")
+			if err != nil {
+				t.Fatalf("LockForWrite() error = %v", err)
+			}
+			go func() {
+				time.Sleep(50 * time.Millisecond)
+				unlock()
+			}()
+
+			writer := &access.UserInfo{Name: "writer"}
+			_, err = manager.ExecuteQuery(context.Background(), "test", writer, "session", "UPDATE users SET name = name WHERE id = 1")
+			var lockErr *LockError
+			if tt.wantErr && !errors.As(err, &lockErr) {
+				t.Errorf("expected LockError, got %v", err)
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("expected write to succeed, got %v", err)
+			}
+			time.Sleep(60 * time.Millisecond)
+		})
+	}
+}
+
+// TestManager_LockPolicyNoneTx checks that transactions lock under the
+// "none" policy, so other sessions are told who holds the writer
+// connection instead of waiting on it.
+func TestManager_LockPolicyNoneTx(t *testing.T) {
+	dbPath, cleanup := testutil.TestDB(t, "users.db")
+	defer cleanup()
+
+	cfg := &config.Config{
+		Databases: []config.DatabaseSource{{Path: dbPath, Alias: "test", LockPolicy: "none"}},
+		Users: []config.User{
+			{Name: "alice", Access: []config.AccessRule{{Pattern: "*", Level: "read-write"}}},
+			{Name: "bob", Access: []config.AccessRule{{Pattern: "*", Level: "read-write"}}},
+		},
+	}
+	manager, err := NewManager(cfg)
+	if err != nil {
+		t.Fatalf("failed to create manager: %v", err)
+	}
+	if err := manager.Start(); err != nil {
+		t.Fatalf("failed to start manager: %v", err)
+	}
+	defer manager.Stop()
+
+	ctx := context.Background()
+	alice, bob := &access.UserInfo{Name: "alice"}, &access.UserInfo{Name: "bob"}
+	update := "UPDATE users SET name = 'tx' WHERE id = 1"
+
+	if err := manager.BeginTx("test", alice, "s1"); err != nil {
+		t.Fatalf("BeginTx failed: %v", err)
+	}
+	if _, err := manager.ExecuteQuery(ctx, "test", alice, "s1", update); err != nil {
+		t.Fatalf("write in transaction failed: %v", err)
+	}
+
+	// The other session learns who holds the lock at once
+	start := time.Now()
+	_, err = manager.ExecuteQuery(ctx, "test", bob, "s2", update)
+	var lockErr *LockError
+	if !errors.As(err, &lockErr) || lockErr.HeldBy != "alice" {
+		t.Errorf("write beside the transaction = %v, want a LockError held by alice", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("write waited %v for the transaction", elapsed)
+	}
+	if err := manager.BeginTx("test", bob, "s2"); !errors.As(err, &lockErr) {
+		t.Errorf("second transaction = %v, want a LockError", err)
+	}
+
+	// Reads don't need the lock
+	if _, err := manager.ExecuteQuery(ctx, "test", bob, "s2", "SELECT COUNT(*) FROM users"); err != nil {
+		t.Errorf("read beside the transaction failed: %v", err)
+	}
+
+	if err := manager.CommitTx("s1"); err != nil {
+		t.Fatalf("CommitTx failed: %v", err)
+	}
+	if _, err := manager.ExecuteQuery(ctx, "test", bob, "s2", update); err != nil {
+		t.Errorf("write after the transaction failed: %v", err)
+	}
+	if manager.lockManager.IsLocked(dbPath) {
+		t.Error("expected no lock left after the transaction")
+	}
+}
+
+// TestManager_TableLocking checks that writes lock just the tables they
+// write.
+func TestManager_TableLocking(t *testing.T) {
+	dbPath, cleanup := testutil.TestDB(t, "users.db")
+	defer cleanup()
+
+	manager, err := NewManager(&config.Config{
+		Databases: []config.DatabaseSource{{Path: dbPath, Alias: "test"}},
+		Users:     []config.User{{Name: "admin", Admin: true}},
+	})
+	if err != nil {
+		t.Fatalf("failed to create manager: %v", err)
+	}
+	if err := manager.Start(); err != nil {
+		t.Fatalf("failed to start manager: %v", err)
+	}
+	defer manager.Stop()
+
+	unlock, err := manager.LockForWrite(context.Background(), "test", "other", "other-session", "Posts")
+	if err != nil {
+		t.Fatalf("LockForWrite() error = %v", err)
+	}
+	defer unlock()
+
+	admin := &access.UserInfo{Name: "admin", IsAdmin: true}
+	if _, err := manager.ExecuteQuery(context.Background(), "test", admin, "s1", "UPDATE users SET name = name WHERE id = 1"); err != nil {
+		t.Errorf("expected a write to another table to succeed, got %v", err)
+	}
+	var lockErr *LockError
+	if _, err := manager.ExecuteQuery(context.Background(), "test", admin, "s1", "DELETE FROM posts WHERE id = -1"); !errors.As(err, &lockErr) {
+		t.Errorf("expected a write to the locked table to fail, got %v", err)
+	}
+	if _, err := manager.ExecuteQuery(context.Background(), "test", admin, "s1", "CREATE TABLE t (id INT)"); !errors.As(err, &lockErr) {
+		t.Errorf("expected a schema change to need the whole database, got %v", err)
+	}
+}
+
+// TestLockManager_WaitQueue checks that waiting sessions get the lock in
+// the order they asked, are told their place, and leave the queue when
+// their wait ends.
+func TestLockManager_WaitQueue(t *testing.T) {
+	lm := NewLockManager()
+	if err := lm.TryLock("db", "holder", "s0"); err != nil {
+		t.Fatalf("TryLock() error = %v", err)
+	}
+
+	var mu sync.Mutex
+	positions := make(map[string][]int)
+	lastPosition := func(session string) int {
+		mu.Lock()
+		defer mu.Unlock()
+		if p := positions[session]; len(p) > 0 {
+			return p[len(p)-1]
+		}
+		return 0
+	}
+	got := make(chan string)
+	wait := func(session string, want int) {
+		go func() {
+			err := lm.LockWait(context.Background(), "db", "", session, session, 5*time.Second, func(position int, heldBy string) {
+				mu.Lock()
+				positions[session] = append(positions[session], position)
+				mu.Unlock()
+			})
+			if err != nil {
+				t.Errorf("LockWait(%s) error = %v", session, err)
+			}
+			got <- session
+		}()
+		for lastPosition(session) != want {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	wait("s1", 1)
+	wait("s2", 2)
+
+	// A wait that runs out leaves the queue
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	var lockErr *LockError
+	if err := lm.LockWait(ctx, "db", "", "s3", "s3", time.Second, nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("LockWait(cancelled) error = %v, want DeadlineExceeded", err)
+	}
+	if err := lm.LockWait(context.Background(), "db", "", "s3", "s3", 20*time.Millisecond, nil); !errors.As(err, &lockErr) || lockErr.HeldBy != "holder" {
+		t.Errorf("LockWait(timeout) error = %v, want LockError held by holder", err)
+	}
+	if locks := lm.ListLocks(); len(locks) != 1 || locks[0].Waiting != 2 {
+		t.Errorf("ListLocks() = %+v, want one lock with 2 waiting", locks)
+	}
+
+	// Each release hands the lock to the next in line
+	lm.Unlock("db", "s0")
+	if s := <-got; s != "s1" {
+		t.Fatalf("lock went to %s, want s1", s)
+	}
+	for lastPosition("s2") != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	if err := lm.TryLock("db", "s4", "s4"); err == nil {
+		t.Error("expected TryLock to fail while the lock is held")
+	}
+	lm.Unlock("db", "s1")
+	if s := <-got; s != "s2" {
+		t.Fatalf("lock went to %s, want s2", s)
+	}
+	lm.Unlock("db", "s2")
+	if lm.IsLocked("db") || lm.QueueLength("db") != 0 {
+		t.Error("expected the lock released and the queue empty")
+	}
+}
+
+// TestLockManager_TableLocks checks that table locks only exclude locks on
+// the same table or the whole database.
+func TestLockManager_TableLocks(t *testing.T) {
+	lm := NewLockManager()
+	if err := lm.TryLockTable("db", "users", "a", "s1"); err != nil {
+		t.Fatalf("TryLockTable(users) error = %v", err)
+	}
+	if err := lm.TryLockTable("db", "orders", "b", "s2"); err != nil {
+		t.Errorf("expected a lock on another table to succeed, got %v", err)
+	}
+	var lockErr *LockError
+	if err := lm.TryLockTable("db", "users", "b", "s2"); !errors.As(err, &lockErr) || lockErr.Table != "users" || lockErr.HeldBy != "a" {
+		t.Errorf("TryLockTable(users) by another session = %v, want LockError on users held by a", err)
+	}
+	if err := lm.TryLock("db", "c", "s3"); !errors.As(err, &lockErr) {
+		t.Errorf("expected the whole-database lock to fail, got %v", err)
+	}
+	if err := lm.TryLock("db", "a", "s1"); !errors.As(err, &lockErr) || lockErr.HeldBy != "b" {
+		t.Errorf("expected the whole-database lock to fail on the other session's table, got %v", err)
+	}
+
+	// A whole-database waiter keeps later table locks from jumping ahead
+	done := make(chan error)
+	go func() {
+		done <- lm.LockWait(context.Background(), "db", "", "c", "s3", 5*time.Second, nil)
+	}()
+	for lm.QueueLength("db") == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if err := lm.TryLockTable("db", "items", "d", "s4"); !errors.As(err, &lockErr) {
+		t.Errorf("expected a table lock behind a queued whole-database lock to fail, got %v", err)
+	}
+	if err := lm.TryLockTable("db", "users", "a", "s1"); err != nil {
+		t.Errorf("expected a session to take its own lock again, got %v", err)
+	}
+
+	lm.UnlockTable("db", "users", "s1")
+	lm.UnlockTable("db", "orders", "s2")
+	if err := <-done; err != nil {
+		t.Fatalf("LockWait() error = %v", err)
+	}
+	if info := lm.GetLockInfo("db"); info == nil || info.Table != "" || info.SessionID != "s3" {
+		t.Errorf("GetLockInfo() = %+v, want the whole database held by s3", info)
+	}
+	if released := lm.ForceUnlock("db"); len(released) != 1 || lm.IsLocked("db") {
+		t.Errorf("ForceUnlock() = %v, want the one lock released", released)
+	}
+}
+
+// TestWriteTables checks which tables a write query locks.
+func TestWriteTables(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"UPDATE users SET name = 'x' WHERE id = 1", []string{"users"}},
+		{"INSERT INTO main.Orders VALUES (1); DELETE FROM items", []string{"Orders", "items"}},
+		{"SELECT 1; UPDATE users SET name = (SELECT name FROM t)", []string{"users"}},
+		{"INSERT INTO other.users VALUES (1)", nil},
+		{"CREATE TABLE t (id INT)", nil},
+		{"UPDATE users SET a = 1; DROP TABLE t", nil},
+		{"PRAGMA user_version = 3", nil},
+	}
+	for _, tt := range tests {
+		if got := writeTables(tt.query); !slices.Equal(got, tt.want) {
+			t.Errorf("writeTables(%q) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+// TestManager_ReapLocks checks that write locks of gone sessions expire
+// after the lock TTL without heartbeats, while connected sessions and
+// recent heartbeats keep theirs.
+func TestManager_ReapLocks(t *testing.T) {
+	dbPath, cleanup := testutil.TestDB(t, "users.db")
+	defer cleanup()
+
+	cfg := &config.Config{
+		Databases:   []config.DatabaseSource{{Path: dbPath, Alias: "test"}},
+		Connections: config.ConnectionsConfig{LockTTL: "1m"},
+	}
+	manager, err := NewManager(cfg)
+	if err != nil {
+		t.Fatalf("failed to create manager: %v", err)
+	}
+	lm := manager.GetLockManager()
+	manager.SetSessionCheck(func(id string) bool { return id == "live" })
+
+	for path, session := range map[string]string{"gone.db": "gone", "live.db": "live", "beat.db": "beat"} {
+		if err := lm.TryLock(path, session, session); err != nil {
+			t.Fatalf("TryLock(%s) error = %v", path, err)
+		}
+	}
+
+	manager.reapLocks(time.Now().Add(30 * time.Second))
+	if len(lm.ListLocks()) != 3 {
+		t.Fatalf("expected no lock to expire within the TTL, got %v", lm.ListLocks())
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	lm.Heartbeat("beat")
+	manager.reapLocks(lm.GetLockInfo("beat.db").Heartbeat.Add(-time.Millisecond).Add(time.Minute))
+	if lm.IsLocked("gone.db") {
+		t.Error("expected the lock of the gone session to expire")
+	}
+	if !lm.IsLocked("live.db") || !lm.IsLocked("beat.db") {
+		t.Errorf("expected connected and recently active sessions to keep their locks, got %v", lm.ListLocks())
+	}
+
+	// Ending a session releases its locks at once
+	manager.EndSession("beat")
+	if lm.IsLocked("beat.db") {
+		t.Error("expected ending the session to release its lock")
+	}
+}
+
+// TestManager_Rescan tests that rescanning reports databases added and
+// removed since the last scan, without relying on the watcher.
+func TestManager_Rescan(t *testing.T) {
+	dbPath, cleanup := testutil.TestDB(t, "users.db")
+	defer cleanup()
+	dir := filepath.Dir(dbPath)
+
+	cfg := &config.Config{
+		Databases: []config.DatabaseSource{{Path: dir}},
+		Discovery: config.DiscoveryConfig{RescanInterval: "1m"},
+	}
+	if got := cfg.GetRescanInterval(); got != time.Minute {
+		t.Errorf("GetRescanInterval() = %v, want 1m", got)
+	}
+	manager, err := NewManager(cfg)
+	if err != nil {
+		t.Fatalf("failed to create manager: %v", err)
+	}
+	defer manager.Stop()
+
+	added, removed, err := manager.Rescan()
+	if err != nil {
+		t.Fatalf("Rescan() error = %v", err)
+	}
+	if !slices.Equal(added, []string{dbPath}) || len(removed) != 0 {
+		t.Errorf("first Rescan() = %v, %v, want [%s], []", added, removed, dbPath)
+	}
+
+	data, err := os.ReadFile(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newPath := filepath.Join(dir, "orders.db")
+	if err := os.WriteFile(newPath, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	added, removed, err = manager.Rescan()
+	if err != nil {
+		t.Fatalf("Rescan() error = %v", err)
+	}
+	if !slices.Equal(added, []string{newPath}) || len(removed) != 0 {
+		t.Errorf("Rescan() after adding = %v, %v, want [%s], []", added, removed, newPath)
+	}
+
+	if err := os.Remove(newPath); err != nil {
+		t.Fatal(err)
+	}
+	added, removed, err = manager.Rescan()
+	if err != nil {
+		t.Fatalf("Rescan() error = %v", err)
+	}
+	if len(added) != 0 || !slices.Equal(removed, []string{newPath}) {
+		t.Errorf("Rescan() after removing = %v, %v, want [], [%s]", added, removed, newPath)
+	}
+}
+
+// TestClassifySQL tests statement types, tables and WHERE detection.
+func TestClassifySQL(t *testing.T) {
+	tests := []struct {
+		query    string
+		typ      string
+		tables   []string
+		hasWhere bool
+	}{
+		{"SELECT * FROM users u JOIN orders o ON o.user_id = u.id WHERE u.id = 1", "SELECT", []string{"users", "orders"}, true},
+		{"SELECT * FROM a, \"b c\" AS x, main.d", "SELECT", []string{"a", "b c", "main.d"}, false},
+		{"WITH t AS (SELECT * FROM users) SELECT * FROM t, json_each('[1]')", "SELECT", []string{"users"}, false},
+		{"SELECT * FROM users WHERE id IN (SELECT user_id FROM orders WHERE total > 5)", "SELECT", []string{"users", "orders"}, true},
+		{"WITH x AS (SELECT 1) DELETE FROM users", "DELETE", []string{"users"}, false},
+		{"UPDATE users SET name = (SELECT name FROM t WHERE id = 1)", "UPDATE", []string{"users"}, false},
+		{"update or ignore [users] set name = 'x' where id = 2", "UPDATE", []string{"users"}, true},
+		{"INSERT OR REPLACE INTO main.users (name) VALUES ('x')", "INSERT", []string{"main.users"}, false},
+		{"REPLACE INTO users SELECT * FROM old", "REPLACE", []string{"users"}, false},
+		{"CREATE TABLE IF NOT EXISTS t (id INT)", "CREATE", []string{"t"}, false},
+		{"CREATE UNIQUE INDEX idx ON users (email)", "CREATE", []string{"users"}, false},
+		{"DROP INDEX idx", "DROP", nil, false},
+		{"ALTER TABLE users RENAME TO people", "ALTER", []string{"users"}, false},
+		{"(SELECT 1)", "", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query[:min(30, len(tt.query))], func(t *testing.T) {
+			stmts := ClassifySQL(tt.query)
+			if len(stmts) != 1 {
+				t.Fatalf("got %d statements, want 1", len(stmts))
+			}
+			s := stmts[0]
+			if s.Type != tt.typ || !slices.Equal(s.Tables, tt.tables) || s.HasWhere != tt.hasWhere {
+				t.Errorf("got %s %v where=%v, want %s %v where=%v", s.Type, s.Tables, s.HasWhere, tt.typ, tt.tables, tt.hasWhere)
+			}
+		})
+	}
+
+	// Semicolons in a trigger body don't end the statement
+	stmts := ClassifySQL(`CREATE TRIGGER tr AFTER INSERT ON users BEGIN
+		UPDATE stats SET n = CASE WHEN n IS NULL THEN 1 ELSE n + 1 END;
+		DELETE FROM log;
+	END; SELECT 1`)
+	if len(stmts) != 2 || stmts[0].Type != "CREATE" || !slices.Equal(stmts[0].Tables, []string{"users"}) || stmts[1].Type != "SELECT" {
+		t.Errorf("trigger split = %+v", stmts)
+	}
+}
+
+// TestIsReadOnlyQuery tests the read-only query detection.
+func TestIsReadOnlyQuery(t *testing.T) {
+	tests := []struct {
+		query    string
+		readOnly bool
+	}{
+		{"SELECT * FROM users", true},
+		{"select * from users", true},
+		{"  SELECT * FROM users", true},
+		{"\n\tSELECT * FROM users", true},
+		{"PRAGMA table_info(users)", true},
+		{"pragma table_info(users)", true},
+		{"EXPLAIN SELECT * FROM users", true},
+		{"WITH cte AS (SELECT 1) SELECT * FROM cte", true},
+		{"-- count\nSELECT COUNT(*) FROM users", true},
+		{"/* hi */ VALUES (1), (2)", true},
+		{"SELECT 1; SELECT 2;", true},
+		{"SELECT 'DELETE FROM users'", true},
+		{"PRAGMA main.index_list(users)", true},
+
+		{"INSERT INTO users VALUES (1)", false},
+		{"insert into users values (1)", false},
+		{"UPDATE users SET x = 1", false},
+		{"DELETE FROM users", false},
+		{"DROP TABLE users", false},
+		{"CREATE TABLE t (id INT)", false},
+		{"ALTER TABLE users ADD x INT", false},
+		{"VACUUM", false},
+		{"REINDEX", false},
+		{"WITH old AS (SELECT id FROM users) DELETE FROM users WHERE id IN old", false},
+		{"SELECT 1; DROP TABLE users", false},
+		{"PRAGMA journal_mode = DELETE", false},
+		{"PRAGMA user_version(3)", false},
+		{"PRAGMA optimize", false},
+		{"", false},
+		{"-- nothing", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query[:min(30, len(tt.query))], func(t *testing.T) {
+			got := IsReadOnlyQuery(tt.query)
+			if got != tt.readOnly {
+				t.Errorf("IsReadOnlyQuery(%q) = %v, want %v", tt.query, got, tt.readOnly)
+			}
+		})
+	}
+}
+
+// TestPageQuery tests adding a LIMIT to queries that can be paged.
+func TestPageQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string // "" when the query can't be paged
+	}{
+		{"SELECT * FROM users", "SELECT * FROM users\nLIMIT 51 OFFSET 100"},
+		{"select * from users;  ", "select * from users\nLIMIT 51 OFFSET 100"},
+		{"SELECT * FROM users -- all", "SELECT * FROM users -- all\nLIMIT 51 OFFSET 100"},
+		{"WITH t AS (SELECT * FROM users LIMIT 5) SELECT * FROM t", "WITH t AS (SELECT * FROM users LIMIT 5) SELECT * FROM t\nLIMIT 51 OFFSET 100"},
+		{"SELECT * FROM users WHERE id IN (SELECT id FROM users LIMIT 3)", "SELECT * FROM users WHERE id IN (SELECT id FROM users LIMIT 3)\nLIMIT 51 OFFSET 100"},
+		{"SELECT * FROM users LIMIT 10", ""},
+		{"SELECT * FROM users limit 10 offset 5", ""},
+		{"SELECT 1; SELECT 2", ""},
+		{"DELETE FROM users", ""},
+		{"PRAGMA table_info(users)", ""},
+		{"EXPLAIN SELECT * FROM users", ""},
+	}
+
+	for _, tt := range tests {
+		got, ok := PageQuery(tt.query, 51, 100)
+		if ok != (tt.want != "") || got != tt.want {
+			t.Errorf("PageQuery(%q) = %q, %v, want %q", tt.query, got, ok, tt.want)
+		}
+	}
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func TestManager_RawDownloadDisabled(t *testing.T) {
+	dbPath, cleanup := testutil.TestDB(t, "users.db")
+	defer cleanup()
+
+	allow := false
+	cfg := &config.Config{
+		Databases: []config.DatabaseSource{
+			{Path: dbPath, Alias: "test"},
+		},
+		AnonymousAccess:  "none",
+		AllowRawDownload: &allow,
+	}
+
+	manager, err := NewManager(cfg)
+	if err != nil {
+		t.Fatalf("failed to create manager: %v", err)
+	}
+	if err := manager.Start(); err != nil {
+		t.Fatalf("failed to start manager: %v", err)
+	}
+	defer manager.Stop()
+
+	admin := &access.UserInfo{Name: "admin", IsAdmin: true}
+
+	var buf bytes.Buffer
+	if err := manager.StreamDatabase("test", admin, &buf); !errors.Is(err, ErrAccessDenied) {
+		t.Errorf("expected downloads to be disabled, got %v", err)
+	}
+	if dbs := manager.ListDatabases(admin); len(dbs) != 1 || dbs[0].CanDownload {
+		t.Errorf("expected the database to be listed without downloads, got %+v", dbs)
+	}
+
+	allow = true
+	if err := manager.StreamDatabase("test", admin, &buf); err != nil {
+		t.Errorf("expected downloads to work once allowed, got %v", err)
+	}
+}
+
+// TestManager_Backup checks that backups take the write lock from the lock
+// queue.
+func TestManager_Backup(t *testing.T) {
+	dbPath, cleanup := testutil.TestDB(t, "users.db")
+	defer cleanup()
+
+	manager, err := NewManager(&config.Config{
+		Databases: []config.DatabaseSource{{Path: dbPath, Alias: "test"}},
+		Users:     []config.User{{Name: "admin", Admin: true}},
+	})
+	if err != nil {
+		t.Fatalf("failed to create manager: %v", err)
+	}
+	if err := manager.Start(); err != nil {
+		t.Fatalf("failed to start manager: %v", err)
+	}
+	defer manager.Stop()
+
+	admin := &access.UserInfo{Name: "admin", IsAdmin: true}
+	dest := filepath.Join(t.TempDir(), "backup.db")
+
+	// A writer holding the lock keeps the backup out
+	unlock, err := manager.LockForWrite(context.Background(), "test", "other", "other-session")
+	if err != nil {
+		t.Fatalf("LockForWrite() error = %v", err)
+	}
+	var lockErr *LockError
+	if _, err := manager.Backup(context.Background(), "test", admin, "s1", dest); !errors.As(err, &lockErr) {
+		t.Errorf("expected LockError, got %v", err)
+	}
+	if _, err := os.Stat(dest); !os.IsNotExist(err) {
+		t.Errorf("expected no backup while locked, stat %v", err)
+	}
+
+	// Waiting for the lock gets the backup in once the writer is done
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		unlock()
+	}()
+	ctx := WithLockTimeout(context.Background(), 2*time.Second)
+	if size, err := manager.Backup(ctx, "test", admin, "s1", dest); err != nil || size == 0 {
+		t.Fatalf("Backup() = %d, %v", size, err)
+	}
+	if manager.GetLockManager().IsLocked(dbPath) {
+		t.Error("expected the lock to be released after the backup")
+	}
+
+	// A session's own transaction lock isn't borrowed
+	if err := manager.BeginTx("test", admin, "s1"); err != nil {
+		t.Fatal(err)
+	}
+	defer manager.RollbackTx("s1")
+	if _, err := manager.Backup(context.Background(), "test", admin, "s1", dest); !errors.Is(err, ErrInTransaction) {
+		t.Errorf("expected ErrInTransaction, got %v", err)
+	}
+	if !manager.GetLockManager().IsLocked(dbPath) {
+		t.Error("expected the transaction to keep its lock")
+	}
+}
+
+// TestManager_SnapshotReuse checks that snapshot queries share a snapshot
+// until it expires, and take fresh ones under the write lock.
+func TestManager_SnapshotReuse(t *testing.T) {
+	defer func(d time.Duration) { snapshotMaxAge = d }(snapshotMaxAge)
+	snapshotMaxAge = time.Hour
+
+	dbPath, cleanup := testutil.TestDB(t, "users.db")
+	defer cleanup()
+
+	manager, err := NewManager(&config.Config{
+		Databases: []config.DatabaseSource{{Path: dbPath, Alias: "test"}},
+		Users:     []config.User{{Name: "admin", Admin: true}},
+	})
+	if err != nil {
+		t.Fatalf("failed to create manager: %v", err)
+	}
+	if err := manager.Start(); err != nil {
+		t.Fatalf("failed to start manager: %v", err)
+	}
+	defer manager.Stop()
+
+	admin := &access.UserInfo{Name: "admin", IsAdmin: true}
+	count := func() any {
+		t.Helper()
+		res, err := manager.ExecuteQuerySnapshot(context.Background(), "test", admin, "s1", "SELECT count(*) FROM users")
+		if err != nil {
+			t.Fatalf("snapshot query failed: %v", err)
+		}
+		return res.Rows[0][0]
+	}
+	snapshotPaths := func() []string {
+		manager.snapMu.Lock()
+		defer manager.snapMu.Unlock()
+		var paths []string
+		for _, s := range manager.snapshots {
+			paths = append(paths, s.conn.Path)
+		}
+		return paths
+	}
+
+	if n := count(); n != int64(3) {
+		t.Fatalf("expected 3 users, got %v", n)
+	}
+	first := snapshotPaths()
+	if _, err := manager.ExecuteQuery(context.Background(), "test", admin, "s2", "INSERT INTO users (name, email) VALUES ('dave', 'dave@example.com')"); err != nil {
+		t.Fatal(err)
+	}
+
+	// A fresh snapshot is reused, even by a locked database
+	unlock, err := manager.LockForWrite(context.Background(), "test", "other", "other-session")
+	if err != nil {
+		t.Fatalf("LockForWrite() error = %v", err)
+	}
+	if n := count(); n != int64(3) {
+		t.Errorf("expected the shared snapshot's 3 users, got %v", n)
+	}
+	if paths := snapshotPaths(); len(paths) != 1 || !slices.Equal(paths, first) {
+		t.Errorf("expected the snapshot to be reused, got %v after %v", paths, first)
+	}
+
+	// An expired one is replaced once the lock is free, and deleted
+	snapshotMaxAge = 0
+	var lockErr *LockError
+	if _, err := manager.ExecuteQuerySnapshot(context.Background(), "test", admin, "s1", "SELECT 1"); !errors.As(err, &lockErr) {
+		t.Errorf("expected LockError taking a snapshot of a locked database, got %v", err)
+	}
+	unlock()
+	if n := count(); n != int64(4) {
+		t.Errorf("expected a fresh snapshot with 4 users, got %v", n)
+	}
+	if _, err := os.Stat(first[0]); !os.IsNotExist(err) {
+		t.Errorf("expected the expired snapshot to be deleted, stat %v", err)
+	}
+
+	// Expired snapshots are deleted without waiting for another query
+	last := snapshotPaths()
+	manager.expireSnapshots(time.Now(), false)
+	if paths := snapshotPaths(); len(paths) != 0 {
+		t.Errorf("expected no snapshots left, got %v", paths)
+	}
+	if _, err := os.Stat(filepath.Dir(last[0])); !os.IsNotExist(err) {
+		t.Errorf("expected the snapshot directory to be deleted, stat %v", err)
+	}
+}
+
+// TestManager_KeepsJournalMode checks that databases keep their own
+// journal mode unless their source sets one.
+func TestManager_KeepsJournalMode(t *testing.T) {
+	dbPath, cleanup := testutil.TestDB(t, "users.db")
+	defer cleanup()
+
+	manager, err := NewManager(&config.Config{
+		Databases: []config.DatabaseSource{{Path: dbPath, Alias: "test"}},
+		Users:     []config.User{{Name: "admin", Admin: true}},
+	})
+	if err != nil {
+		t.Fatalf("failed to create manager: %v", err)
+	}
+	if err := manager.Start(); err != nil {
+		t.Fatalf("failed to start manager: %v", err)
+	}
+	defer manager.Stop()
+	admin := &access.UserInfo{Name: "admin", IsAdmin: true}
+
+	journalMode := func() string {
+		t.Helper()
+		conn, err := manager.OpenConnection("test", admin)
+		if err != nil {
+			t.Fatalf("OpenConnection failed: %v", err)
+		}
+		var mode string
+		if err := conn.writer.QueryRow("PRAGMA journal_mode").Scan(&mode); err != nil {
+			t.Fatal(err)
+		}
+		return mode
+	}
+
+	if mode := journalMode(); mode != "delete" {
+		t.Errorf("journal_mode = %s, want the file's own delete", mode)
+	}
+
+	// A mode set with the pragma command survives reconnects
+	conn, _ := manager.OpenConnection("test", admin)
+	if _, current, err := conn.SetPragma(context.Background(), "journal_mode", "wal"); err != nil || current != "wal" {
+		t.Fatalf("SetPragma = %v, %v", current, err)
+	}
+	manager.CloseConnection("test")
+	if mode := journalMode(); mode != "wal" {
+		t.Errorf("journal_mode after reopening = %s, want wal", mode)
+	}
+}
+
+func TestManager_AttachedOpenOptionsAndPaths(t *testing.T) {
+	dbPath, cleanup := testutil.TestDB(t, "users.db")
+	defer cleanup()
+	data, err := os.ReadFile(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// File names SQLite would read as a query, a fragment or an escape if
+	// they weren't escaped in the URI
+	dir := filepath.Join(t.TempDir(), "odd dir")
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	mainPath := filepath.Join(dir, "main#1.db")
+	otherPath := filepath.Join(dir, "other?mode=rwc%20.db")
+	for _, p := range []string{mainPath, otherPath} {
+		if err := os.WriteFile(p, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cfg := &config.Config{
+		Databases: []config.DatabaseSource{
+			{Path: mainPath, Alias: "main", ForeignKeys: true},
+			{Path: otherPath, Alias: "other"},
+		},
+		Users: []config.User{{Name: "admin", Admin: true}},
+	}
+	manager, err := NewManager(cfg)
+	if err != nil {
+		t.Fatalf("failed to create manager: %v", err)
+	}
+	if err := manager.Start(); err != nil {
+		t.Fatalf("failed to start manager: %v", err)
+	}
+	defer manager.Stop()
+
+	ctx := context.Background()
+	admin := &access.UserInfo{Name: "admin", IsAdmin: true}
+	attach := []Attachment{{Database: "other", Schema: "other"}}
+
+	result, err := manager.ExecuteQueryAttached(ctx, "main", attach, admin, "", "SELECT COUNT(*) FROM users u JOIN other.users o ON o.id = u.id")
+	if err != nil {
+		t.Fatalf("join across attached files failed: %v", err)
+	}
+	if FormatValue(result.Rows[0][0]) != "3" {
+		t.Errorf("expected 3 joined rows, got %v", result.Rows[0][0])
+	}
+
+	// The connection is opened with the source's options
+	result, err = manager.ExecuteQueryAttached(ctx, "main", attach, admin, "", "PRAGMA foreign_keys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if FormatValue(result.Rows[0][0]) != "1" {
+		t.Errorf("expected the source's foreign_keys setting, got %v", result.Rows[0][0])
+	}
+
+	// Writes reach the attached file itself, not one named after part of
+	// its path
+	if _, err := manager.ExecuteQueryAttached(ctx, "main", attach, admin, "", "UPDATE other.users SET name = 'moved' WHERE id = 1"); err != nil {
+		t.Fatalf("write to attached database failed: %v", err)
+	}
+	result, err = manager.ExecuteQuery(ctx, "other", admin, "", "SELECT name FROM users WHERE id = 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if FormatValue(result.Rows[0][0]) != "moved" {
+		t.Errorf("expected the update in %s, got %v", otherPath, result.Rows[0][0])
+	}
+	entries, _ := os.ReadDir(dir)
+	for _, e := range entries {
+		if name := e.Name(); !strings.HasPrefix(name, "main#1.db") && !strings.HasPrefix(name, "other?mode=rwc%20.db") {
+			t.Errorf("unexpected file %s", name)
+		}
 	}
-	return b
 }
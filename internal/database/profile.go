@@ -0,0 +1,98 @@
+package database
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// ColumnProfile summarizes the values stored in one column.
+type ColumnProfile struct {
+	Name      string
+	Type      string
+	Nulls     int64
+	Distinct  int64
+	Min       any
+	Max       any
+	AvgLength *float64 // nil when every value is NULL
+}
+
+// TableProfile summarizes the values stored in a table.
+type TableProfile struct {
+	Table   string
+	Rows    int64
+	Columns []ColumnProfile
+}
+
+// ProfileTable computes per-column statistics for a table in a single
+// full scan: null and distinct counts, min/max and average length.
+func ProfileTable(conn *Connection, table string) (*TableProfile, error) {
+	columns, err := NewSchema(conn).GetColumns(table)
+	if err != nil {
+		return nil, err
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrTableNotFound, table)
+	}
+	columns = slices.DeleteFunc(columns, func(c ColumnInfo) bool { return c.Hidden })
+
+	// Five aggregates per column, after the row count
+	const perColumn = 5
+	exprs := []string{"COUNT(*)"}
+	for _, c := range columns {
+		col := quoteIdentifier(c.Name)
+		exprs = append(exprs,
+			fmt.Sprintf("COUNT(*) - COUNT(%s)", col),
+			fmt.Sprintf("COUNT(DISTINCT %s)", col),
+			fmt.Sprintf("MIN(%s)", col),
+			fmt.Sprintf("MAX(%s)", col),
+			fmt.Sprintf("AVG(length(%s))", col),
+		)
+	}
+	query := fmt.Sprintf("SELECT %s FROM %s", strings.Join(exprs, ", "), quoteIdentifier(table))
+
+	values := make([]any, len(exprs))
+	ptrs := make([]any, len(exprs))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	if err := conn.QueryRow(query).Scan(ptrs...); err != nil {
+		return nil, err
+	}
+
+	profile := &TableProfile{Table: table, Rows: toInt64(values[0])}
+	for i, c := range columns {
+		base := 1 + i*perColumn
+		cp := ColumnProfile{
+			Name:     c.Name,
+			Type:     c.Type,
+			Nulls:    toInt64(values[base]),
+			Distinct: toInt64(values[base+1]),
+			Min:      profileValue(values[base+2]),
+			Max:      profileValue(values[base+3]),
+		}
+		if avg, ok := values[base+4].(float64); ok {
+			cp.AvgLength = &avg
+		}
+		profile.Columns = append(profile.Columns, cp)
+	}
+	return profile, nil
+}
+
+// profileValue makes min/max values printable.
+func profileValue(v any) any {
+	if b, ok := v.([]byte); ok {
+		return fmt.Sprintf("<blob %d bytes>", len(b))
+	}
+	return v
+}
+
+func toInt64(v any) int64 {
+	switch n := v.(type) {
+	case int64:
+		return n
+	case float64:
+		return int64(n)
+	}
+	return 0
+}
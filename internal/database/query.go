@@ -1,12 +1,108 @@
 package database
 
 import (
+	"bytes"
+	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
+
+	"github.com/johan-st/sqlite-tui/internal/tracing"
+)
+
+// maxTracedStatement is the longest statement recorded in a trace span.
+const maxTracedStatement = 2048
+
+// MaxCellSize is the most bytes of one value a QueryResult keeps. Larger
+// values become a TruncatedValue; FetchCell reads them whole.
+const MaxCellSize = 64 << 10
+
+// DefaultMaxResultBytes caps the size of a query result when no
+// max_result_bytes is configured, so one SELECT * on a huge table can't
+// exhaust the server's memory.
+const DefaultMaxResultBytes = 64 << 20
+
+// cellOverhead approximates the bytes a value takes beyond its content.
+const cellOverhead = 16
+
+// Limits that cut a query result short, see QueryResult.TruncatedBy.
+const (
+	TruncatedRows  = "rows"
+	TruncatedBytes = "bytes"
 )
 
+// resultLimits caps what a query reads into a QueryResult. Zero fields
+// don't cap.
+type resultLimits struct {
+	rows  int
+	bytes int64
+}
+
+// TruncatedValue stands in for a value larger than MaxCellSize.
+type TruncatedValue struct {
+	Head any   // the value's first MaxCellSize bytes, a string or []byte
+	Size int64 // the value's full size in bytes
+}
+
+// String returns the truncation marker.
+func (v TruncatedValue) String() string {
+	return fmt.Sprintf("%d bytes, truncated", v.Size)
+}
+
+// MarshalJSON encodes the value as its head and size, marked truncated.
+func (v TruncatedValue) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]any{"truncated": true, "size": v.Size, "head": v.Head})
+}
+
+// capCells replaces the values of row larger than limit with a
+// TruncatedValue holding their start.
+func capCells(row []any, limit int) []any {
+	for i, v := range row {
+		switch val := v.(type) {
+		case []byte:
+			if len(val) > limit {
+				row[i] = TruncatedValue{Head: val[:limit:limit], Size: int64(len(val))}
+			}
+		case string:
+			if len(val) > limit {
+				// Cut at a character boundary
+				cut := limit
+				for cut > 0 && !utf8.RuneStart(val[cut]) {
+					cut--
+				}
+				row[i] = TruncatedValue{Head: strings.Clone(val[:cut]), Size: int64(len(val))}
+			}
+		}
+	}
+	return row
+}
+
+// rowSize estimates the memory a row's values take.
+func rowSize(row []any) int64 {
+	var n int64
+	for _, v := range row {
+		n += cellOverhead
+		if tv, ok := v.(TruncatedValue); ok {
+			v = tv.Head
+		}
+		switch val := v.(type) {
+		case []byte:
+			n += int64(len(val))
+		case string:
+			n += int64(len(val))
+		}
+	}
+	return n
+}
+
 // QueryResult holds the results of a query execution.
 type QueryResult struct {
 	Columns      []string
@@ -16,10 +112,57 @@ type QueryResult struct {
 	Duration     time.Duration
 	IsSelect     bool
 	Error        string
+	Truncated    bool   // the result hit a limit; the rest wasn't read
+	TruncatedBy  string // the limit hit, TruncatedRows or TruncatedBytes
+	Size         int64  // estimated bytes held by Rows
+	Keys         []any  // each row's key for keyset selects, see SelectOptions
+}
+
+// TruncationNote describes the limit that cut the result short, "" if the
+// result is complete.
+func (r *QueryResult) TruncationNote() string {
+	switch {
+	case !r.Truncated:
+		return ""
+	case r.TruncatedBy == TruncatedBytes:
+		return fmt.Sprintf("output limited to %d rows (%d bytes) by the query size limit", len(r.Rows), r.Size)
+	default:
+		return fmt.Sprintf("output limited to %d rows by the query limit", len(r.Rows))
+	}
 }
 
 // Query executes a query and returns structured results.
 func Query(conn *Connection, query string, args ...any) (*QueryResult, error) {
+	return QueryContext(context.Background(), conn, query, args...)
+}
+
+// QueryContext is Query with a context; cancelling it interrupts the query.
+func QueryContext(ctx context.Context, conn *Connection, query string, args ...any) (*QueryResult, error) {
+	return tracedQuery(ctx, nil, conn, query, args, resultLimits{})
+}
+
+// tracedQuery runs Query in a trace span nested under parent, reading no
+// more of the result than limits allow.
+func tracedQuery(ctx context.Context, parent *tracing.Span, conn *Connection, query string, args []any, limits resultLimits) (*QueryResult, error) {
+	statement := query
+	if len(statement) > maxTracedStatement {
+		statement = statement[:maxTracedStatement]
+	}
+	span := tracing.Start("db.query", parent,
+		tracing.String("db.system", "sqlite"),
+		tracing.String("db.path", conn.Path),
+		tracing.String("db.statement", statement),
+	)
+
+	result, err := runQuery(ctx, conn, query, args, limits)
+	if err == nil {
+		span.SetAttrs(tracing.Int("db.rows", int64(len(result.Rows))), tracing.Int("db.rows_affected", result.RowsAffected))
+	}
+	span.End(err)
+	return result, err
+}
+
+func runQuery(ctx context.Context, conn *Connection, query string, args []any, limits resultLimits) (*QueryResult, error) {
 	start := time.Now()
 	trimmed := strings.TrimSpace(strings.ToUpper(query))
 
@@ -30,14 +173,15 @@ func Query(conn *Connection, query string, args ...any) (*QueryResult, error) {
 		strings.HasPrefix(trimmed, "WITH")
 
 	if isSelect {
-		return executeSelect(conn, query, args, start)
+		return executeSelect(ctx, conn, query, args, start, limits)
 	}
-	return executeExec(conn, query, args, start)
+	return executeExec(ctx, conn, query, args, start)
 }
 
-// executeSelect runs a query that returns rows.
-func executeSelect(conn *Connection, query string, args []any, start time.Time) (*QueryResult, error) {
-	rows, err := conn.Query(query, args...)
+// executeSelect runs a query that returns rows. A result over one of the
+// limits stops being read and is marked truncated.
+func executeSelect(ctx context.Context, conn *Connection, query string, args []any, start time.Time, limits resultLimits) (*QueryResult, error) {
+	rows, err := QueryRows(ctx, conn, query, args...)
 	if err != nil {
 		return &QueryResult{
 			Duration: time.Since(start),
@@ -47,41 +191,26 @@ func executeSelect(conn *Connection, query string, args []any, start time.Time)
 	}
 	defer rows.Close()
 
-	columns, err := rows.Columns()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get columns: %w", err)
-	}
-
 	result := &QueryResult{
-		Columns:  columns,
+		Columns:  rows.Columns(),
 		Rows:     make([][]any, 0),
 		Duration: 0,
 		IsSelect: true,
 	}
 
 	for rows.Next() {
-		// Create scan destinations
-		values := make([]any, len(columns))
-		valuePtrs := make([]any, len(columns))
-		for i := range values {
-			valuePtrs[i] = &values[i]
+		if limits.rows > 0 && len(result.Rows) == limits.rows {
+			result.Truncated, result.TruncatedBy = true, TruncatedRows
+			break
 		}
-
-		if err := rows.Scan(valuePtrs...); err != nil {
-			return nil, fmt.Errorf("failed to scan row: %w", err)
-		}
-
-		// Convert []byte to string for readability
-		row := make([]any, len(columns))
-		for i, v := range values {
-			switch val := v.(type) {
-			case []byte:
-				row[i] = string(val)
-			default:
-				row[i] = val
-			}
+		row := capCells(rows.Row(), MaxCellSize)
+		size := rowSize(row)
+		if limits.bytes > 0 && result.Size+size > limits.bytes && len(result.Rows) > 0 {
+			result.Truncated, result.TruncatedBy = true, TruncatedBytes
+			break
 		}
 		result.Rows = append(result.Rows, row)
+		result.Size += size
 	}
 
 	result.Duration = time.Since(start)
@@ -95,8 +224,8 @@ func executeSelect(conn *Connection, query string, args []any, start time.Time)
 }
 
 // executeExec runs a query that modifies data.
-func executeExec(conn *Connection, query string, args []any, start time.Time) (*QueryResult, error) {
-	sqlResult, err := conn.Execute(query, args...)
+func executeExec(ctx context.Context, conn *Connection, query string, args []any, start time.Time) (*QueryResult, error) {
+	sqlResult, err := conn.ExecuteContext(ctx, query, args...)
 	if err != nil {
 		return &QueryResult{
 			Duration: time.Since(start),
@@ -124,6 +253,14 @@ type SelectOptions struct {
 	Limit   int
 	Offset  int
 	Args    []any
+
+	// KeyColumn pages by keyset instead of Offset: rows are ordered by the
+	// column, which must be unique, and each row's key is returned in
+	// QueryResult.Keys. After and Before, when set, select the rows just
+	// past or just before a key. Select only; SelectRows ignores them.
+	KeyColumn string
+	After     any
+	Before    any
 }
 
 // DefaultSelectOptions returns default options for browsing.
@@ -136,6 +273,35 @@ func DefaultSelectOptions() SelectOptions {
 
 // Select retrieves rows from a table with options.
 func Select(conn *Connection, tableName string, opts SelectOptions) (*QueryResult, error) {
+	return SelectContext(context.Background(), conn, tableName, opts)
+}
+
+// SelectContext is Select with a context; cancelling it interrupts the
+// query.
+func SelectContext(ctx context.Context, conn *Connection, tableName string, opts SelectOptions) (*QueryResult, error) {
+	query, args := buildSelect(tableName, opts)
+	result, err := QueryContext(ctx, conn, query, args...)
+	if err != nil || opts.KeyColumn == "" {
+		return result, err
+	}
+
+	// Split the leading key column off the rows
+	result.Columns = result.Columns[1:]
+	result.Keys = make([]any, len(result.Rows))
+	for i, row := range result.Rows {
+		result.Keys[i] = row[0]
+		result.Rows[i] = row[1:]
+	}
+	if opts.Before != nil {
+		// Read backwards from the key; restore ascending order
+		slices.Reverse(result.Keys)
+		slices.Reverse(result.Rows)
+	}
+	return result, nil
+}
+
+// buildSelect builds the query and arguments for Select.
+func buildSelect(tableName string, opts SelectOptions) (string, []any) {
 	// Build column list
 	cols := "*"
 	if len(opts.Columns) > 0 {
@@ -146,16 +312,39 @@ func Select(conn *Connection, tableName string, opts SelectOptions) (*QueryResul
 		cols = strings.Join(quoted, ", ")
 	}
 
+	var key string
+	if opts.KeyColumn != "" {
+		key = quoteIdentifier(opts.KeyColumn)
+		cols = key + ", " + cols
+	}
+
 	// Build query
 	query := fmt.Sprintf("SELECT %s FROM %s", cols, quoteIdentifier(tableName))
 
+	var conds []string
 	args := make([]any, 0)
 	if opts.Where != "" {
-		query += " WHERE " + opts.Where
+		conds = append(conds, "("+opts.Where+")")
 		args = append(args, opts.Args...)
 	}
+	if key != "" && opts.After != nil {
+		conds = append(conds, key+" > ?")
+		args = append(args, opts.After)
+	}
+	if key != "" && opts.Before != nil {
+		conds = append(conds, key+" < ?")
+		args = append(args, opts.Before)
+	}
+	if len(conds) > 0 {
+		query += " WHERE " + strings.Join(conds, " AND ")
+	}
 
-	if opts.OrderBy != "" {
+	switch {
+	case key != "" && opts.Before != nil:
+		query += " ORDER BY " + key + " DESC"
+	case key != "":
+		query += " ORDER BY " + key
+	case opts.OrderBy != "":
 		query += " ORDER BY " + opts.OrderBy
 	}
 
@@ -163,11 +352,11 @@ func Select(conn *Connection, tableName string, opts SelectOptions) (*QueryResul
 		query += fmt.Sprintf(" LIMIT %d", opts.Limit)
 	}
 
-	if opts.Offset > 0 {
+	if opts.Offset > 0 && key == "" {
 		query += fmt.Sprintf(" OFFSET %d", opts.Offset)
 	}
 
-	return Query(conn, query, args...)
+	return query, args
 }
 
 // Insert inserts a row into a table.
@@ -175,6 +364,9 @@ func Insert(conn *Connection, tableName string, data map[string]any) (*QueryResu
 	if len(data) == 0 {
 		return nil, fmt.Errorf("no data to insert")
 	}
+	if err := checkNotShadow(conn, tableName); err != nil {
+		return nil, err
+	}
 
 	columns := make([]string, 0, len(data))
 	placeholders := make([]string, 0, len(data))
@@ -199,6 +391,9 @@ func Update(conn *Connection, tableName string, data map[string]any, where strin
 	if len(data) == 0 {
 		return nil, fmt.Errorf("no data to update")
 	}
+	if err := checkNotShadow(conn, tableName); err != nil {
+		return nil, err
+	}
 
 	setParts := make([]string, 0, len(data))
 	values := make([]any, 0, len(data)+len(whereArgs))
@@ -223,6 +418,9 @@ func Update(conn *Connection, tableName string, data map[string]any, where strin
 
 // Delete deletes rows from a table.
 func Delete(conn *Connection, tableName string, where string, whereArgs ...any) (*QueryResult, error) {
+	if err := checkNotShadow(conn, tableName); err != nil {
+		return nil, err
+	}
 	query := fmt.Sprintf("DELETE FROM %s", quoteIdentifier(tableName))
 
 	if where != "" {
@@ -232,12 +430,90 @@ func Delete(conn *Connection, tableName string, where string, whereArgs ...any)
 	return Query(conn, query, whereArgs...)
 }
 
-// UpdateCell updates a single cell value.
-func UpdateCell(conn *Connection, tableName, pkColumn string, pkValue any, column string, newValue any) (*QueryResult, error) {
-	return Update(conn, tableName,
+// checkNotShadow refuses writes to a shadow table, which would leave its
+// virtual table's index inconsistent.
+func checkNotShadow(conn *Connection, tableName string) error {
+	if kind, err := NewSchema(conn).tableKind(tableName); err == nil && kind == TableKindShadow {
+		return fmt.Errorf("%w: %s", ErrShadowTable, tableName)
+	}
+	return nil
+}
+
+// ErrInvalidValue is returned for input that doesn't fit a column's type.
+var ErrInvalidValue = errors.New("invalid value")
+
+// ErrRowNotFound is returned when the row to update no longer exists.
+var ErrRowNotFound = errors.New("row not found")
+
+// ParseCellInput converts text typed for a column into the value to
+// store, by the column's affinity: INTEGER and REAL columns take numbers
+// only, NUMERIC and untyped columns store numbers as numbers and other
+// text as text, and TEXT columns store the text. NULL, as FormatValue
+// shows it, enters NULL; \NULL enters the text NULL.
+func ParseCellInput(input string, col ColumnInfo) (any, error) {
+	switch input {
+	case "NULL":
+		if col.NotNull || col.PrimaryKey > 0 {
+			return nil, fmt.Errorf("%w: %s can't be NULL", ErrInvalidValue, col.Name)
+		}
+		return nil, nil
+	case `\NULL`:
+		input = "NULL"
+	}
+
+	affinity := col.Affinity()
+	if affinity == AffinityText {
+		return input, nil
+	}
+
+	trimmed := strings.TrimSpace(input)
+	if n, err := strconv.ParseInt(trimmed, 10, 64); err == nil {
+		if affinity == AffinityReal {
+			return float64(n), nil
+		}
+		return n, nil
+	}
+	if f, err := strconv.ParseFloat(trimmed, 64); err == nil && !math.IsInf(f, 0) && !math.IsNaN(f) {
+		return f, nil
+	}
+
+	switch affinity {
+	case AffinityInteger:
+		return nil, fmt.Errorf("%w: %s takes integers, not %q", ErrInvalidValue, col.Name, input)
+	case AffinityReal:
+		return nil, fmt.Errorf("%w: %s takes numbers, not %q", ErrInvalidValue, col.Name, input)
+	}
+	return input, nil
+}
+
+// UpdateCell updates a single cell value in the row identified by key, which
+// maps key columns to the row's values: all of its primary key columns, or
+// rowid for tables without a primary key (see GetPrimaryKeyColumn). It
+// returns ErrRowNotFound when no row matches, e.g. after it was deleted.
+func UpdateCell(conn *Connection, tableName string, key map[string]any, column string, newValue any) (*QueryResult, error) {
+	if len(key) == 0 {
+		return nil, fmt.Errorf("no key to identify the row by")
+	}
+
+	columns := slices.Sorted(maps.Keys(key))
+	whereParts := make([]string, len(columns))
+	whereArgs := make([]any, len(columns))
+	for i, col := range columns {
+		whereParts[i] = fmt.Sprintf("%s = ?", quoteIdentifier(col))
+		whereArgs[i] = key[col]
+	}
+
+	result, err := Update(conn, tableName,
 		map[string]any{column: newValue},
-		fmt.Sprintf("%s = ?", quoteIdentifier(pkColumn)),
-		pkValue)
+		strings.Join(whereParts, " AND "),
+		whereArgs...)
+	if err != nil {
+		return nil, err
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrRowNotFound
+	}
+	return result, nil
 }
 
 // GetPrimaryKeyColumn returns the primary key column name(s) for a table.
@@ -270,7 +546,13 @@ func FormatValue(v any) string {
 	}
 	switch val := v.(type) {
 	case []byte:
+		// Binary data as a BLOB literal
+		if !utf8.Valid(val) || bytes.IndexByte(val, 0) >= 0 {
+			return fmt.Sprintf("x'%x'", val)
+		}
 		return string(val)
+	case TruncatedValue:
+		return fmt.Sprintf("%s… [%s]", FormatValue(val.Head), val)
 	case string:
 		return val
 	case int64:
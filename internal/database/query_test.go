@@ -1,8 +1,16 @@
 package database
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
+	"time"
+	"unicode/utf8"
 
 	"github.com/johan-st/sqlite-tui/internal/testutil"
 )
@@ -337,6 +345,799 @@ func TestSelect_Pagination(t *testing.T) {
 	}
 }
 
+// TestSelect_Keyset tests paging by key instead of offset.
+func TestSelect_Keyset(t *testing.T) {
+	dbPath, cleanup := testutil.TestDB(t, "large.db")
+	defer cleanup()
+
+	conn, err := OpenReadOnly(dbPath)
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	defer conn.Close()
+
+	key := NewSchema(conn).KeyColumn("records")
+	if key != "rowid" {
+		t.Fatalf("KeyColumn = %q, want rowid", key)
+	}
+
+	// Rows after a key
+	result, err := Select(conn, "records", SelectOptions{Limit: 10, KeyColumn: key, After: int64(5)})
+	if err != nil {
+		t.Fatalf("Select failed: %v", err)
+	}
+	if len(result.Rows) != 10 || len(result.Keys) != 10 {
+		t.Fatalf("got %d rows and %d keys, want 10", len(result.Rows), len(result.Keys))
+	}
+	if id := result.Rows[0][0].(int64); id != 6 {
+		t.Errorf("expected first row id=6, got %d", id)
+	}
+	if k := result.Keys[9].(int64); k != 15 {
+		t.Errorf("expected last key 15, got %d", k)
+	}
+
+	// Rows before a key come back in ascending order
+	result, err = Select(conn, "records", SelectOptions{Limit: 3, KeyColumn: key, Before: int64(11)})
+	if err != nil {
+		t.Fatalf("Select failed: %v", err)
+	}
+	var ids []string
+	for _, row := range result.Rows {
+		ids = append(ids, FormatValue(row[0]))
+	}
+	if got := strings.Join(ids, ","); got != "8,9,10" {
+		t.Errorf("rows before 11 = %s, want 8,9,10", got)
+	}
+	if len(result.Columns) != len(result.Rows[0]) {
+		t.Errorf("columns = %v, want one per value", result.Columns)
+	}
+}
+
+// TestEstimateRowCount tests that big tables are estimated and small,
+// shadowed tables counted.
+func TestEstimateRowCount(t *testing.T) {
+	dbPath, cleanup := testutil.EmptyDB(t)
+	defer cleanup()
+
+	conn, err := OpenReadWrite(dbPath)
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	defer conn.Close()
+
+	for _, q := range []string{
+		"CREATE TABLE small (v TEXT)",
+		"INSERT INTO small (v) VALUES ('a'), ('b')",
+		"CREATE TABLE big (v TEXT)",
+		"INSERT INTO big (rowid, v) VALUES (1, 'a'), (250000, 'b')",
+	} {
+		if _, err := conn.Execute(q); err != nil {
+			t.Fatalf("%s: %v", q, err)
+		}
+	}
+
+	schema := NewSchema(conn)
+	if count, exact, err := schema.EstimateRowCount("small"); err != nil || !exact || count != 2 {
+		t.Errorf("small = %d, %v, %v; want exact 2", count, exact, err)
+	}
+	if count, exact, err := schema.EstimateRowCount("big"); err != nil || exact || count != 250000 {
+		t.Errorf("big = %d, %v, %v; want estimate 250000", count, exact, err)
+	}
+
+	// A temp view shadowing the table, as row filters create, is counted
+	opts := DefaultOpenOptions()
+	opts.ReadOnly = true
+	opts.Init = []string{`CREATE TEMP VIEW big AS SELECT * FROM main.big WHERE v = 'a'`}
+	filtered, err := Open(dbPath, opts)
+	if err != nil {
+		t.Fatalf("failed to open filtered db: %v", err)
+	}
+	defer filtered.Close()
+	if count, exact, err := NewSchema(filtered).EstimateRowCount("big"); err != nil || !exact || count != 1 {
+		t.Errorf("shadowed big = %d, %v, %v; want exact 1", count, exact, err)
+	}
+}
+
+// TestGetColumns_GeneratedAndHidden tests that generated columns report
+// their expressions and virtual tables their hidden columns.
+func TestGetColumns_GeneratedAndHidden(t *testing.T) {
+	dbPath, cleanup := testutil.EmptyDB(t)
+	defer cleanup()
+
+	conn, err := OpenReadWrite(dbPath)
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	defer conn.Close()
+
+	for _, q := range []string{
+		`CREATE TABLE items (
+			price REAL,
+			qty INTEGER DEFAULT 1,
+			total REAL GENERATED ALWAYS AS (price * qty) STORED,
+			label TEXT AS (printf('%d x %.2f', qty, round(price, 2))),
+			CHECK (qty > 0)
+		)`,
+		"CREATE VIRTUAL TABLE docs USING fts5(body)",
+	} {
+		if _, err := conn.Execute(q); err != nil {
+			t.Fatalf("%s: %v", q, err)
+		}
+	}
+
+	schema := NewSchema(conn)
+	cols, err := schema.GetColumns("items")
+	if err != nil {
+		t.Fatalf("GetColumns failed: %v", err)
+	}
+	want := map[string][2]string{
+		"price": {"", ""},
+		"qty":   {"", ""},
+		"total": {"STORED", "price * qty"},
+		"label": {"VIRTUAL", "printf('%d x %.2f', qty, round(price, 2))"},
+	}
+	if len(cols) != len(want) {
+		t.Fatalf("got %d columns, want %d", len(cols), len(want))
+	}
+	for _, c := range cols {
+		if got := [2]string{c.Generated, c.Expression}; got != want[c.Name] {
+			t.Errorf("%s = %q, want %q", c.Name, got, want[c.Name])
+		}
+	}
+
+	cols, err = schema.GetColumns("docs")
+	if err != nil {
+		t.Fatalf("GetColumns failed: %v", err)
+	}
+	var hidden []string
+	for _, c := range cols {
+		if c.Hidden {
+			hidden = append(hidden, c.Name)
+		}
+	}
+	if len(hidden) == 0 {
+		t.Error("expected hidden columns in the FTS5 table")
+	}
+}
+
+// TestGetColumns_Constraints tests that collations, single-column unique
+// indexes and CHECK constraints are reported.
+func TestGetColumns_Constraints(t *testing.T) {
+	dbPath, cleanup := testutil.EmptyDB(t)
+	defer cleanup()
+
+	conn, err := OpenReadWrite(dbPath)
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	defer conn.Close()
+
+	for _, q := range []string{
+		`CREATE TABLE accounts (
+			id INTEGER PRIMARY KEY,
+			email TEXT NOT NULL UNIQUE COLLATE NOCASE,
+			handle TEXT CHECK (length(handle) <= 20),
+			region TEXT,
+			code TEXT,
+			balance INTEGER,
+			UNIQUE (region, code),
+			CONSTRAINT positive CHECK (balance >= 0)
+		)`,
+		"CREATE UNIQUE INDEX accounts_code ON accounts(code) WHERE code IS NOT NULL",
+		"CREATE UNIQUE INDEX accounts_handle ON accounts(lower(handle))",
+	} {
+		if _, err := conn.Execute(q); err != nil {
+			t.Fatalf("%s: %v", q, err)
+		}
+	}
+
+	info, err := NewSchema(conn).GetTableInfo("accounts")
+	if err != nil {
+		t.Fatalf("GetTableInfo failed: %v", err)
+	}
+	for _, col := range info.Columns {
+		wantCollation, wantUnique := "BINARY", false
+		if col.Name == "email" {
+			wantCollation, wantUnique = "NOCASE", true
+		}
+		if col.Collation != wantCollation || col.Unique != wantUnique {
+			t.Errorf("%s: collation %q unique %v, want %q %v", col.Name, col.Collation, col.Unique, wantCollation, wantUnique)
+		}
+	}
+
+	want := []string{"length(handle) <= 20", "balance >= 0"}
+	if strings.Join(info.Checks, "|") != strings.Join(want, "|") {
+		t.Errorf("Checks = %q, want %q", info.Checks, want)
+	}
+}
+
+// TestSchema_VirtualTables tests that virtual tables are marked with their
+// module and that their shadow tables are hidden and protected from writes.
+func TestSchema_VirtualTables(t *testing.T) {
+	dbPath, cleanup := testutil.EmptyDB(t)
+	defer cleanup()
+
+	conn, err := OpenReadWrite(dbPath)
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	defer conn.Close()
+
+	for _, q := range []string{
+		"CREATE TABLE notes (id INTEGER PRIMARY KEY, body TEXT)",
+		"CREATE VIRTUAL TABLE docs USING fts5(title, body, tokenize = 'porter unicode61')",
+		"CREATE VIRTUAL TABLE boxes USING rtree(id, minX, maxX)",
+	} {
+		if _, err := conn.Execute(q); err != nil {
+			t.Fatalf("%s: %v", q, err)
+		}
+	}
+
+	schema := NewSchema(conn)
+	tables, err := schema.ListTables()
+	if err != nil {
+		t.Fatalf("ListTables failed: %v", err)
+	}
+	if want := []string{"boxes", "docs", "notes"}; strings.Join(tables, ",") != strings.Join(want, ",") {
+		t.Errorf("ListTables = %v, want %v", tables, want)
+	}
+
+	entries, err := schema.ListTableEntries(true)
+	if err != nil {
+		t.Fatalf("ListTableEntries failed: %v", err)
+	}
+	kinds := make(map[string]TableEntry)
+	for _, e := range entries {
+		kinds[e.Name] = e
+	}
+	for name, want := range map[string]TableEntry{
+		"notes":      {Name: "notes", Kind: TableKindTable},
+		"docs":       {Name: "docs", Kind: TableKindVirtual, Module: "fts5"},
+		"boxes":      {Name: "boxes", Kind: TableKindVirtual, Module: "rtree"},
+		"docs_data":  {Name: "docs_data", Kind: TableKindShadow},
+		"boxes_node": {Name: "boxes_node", Kind: TableKindShadow},
+	} {
+		if kinds[name] != want {
+			t.Errorf("entry %s = %+v, want %+v", name, kinds[name], want)
+		}
+	}
+
+	info, err := schema.GetTableInfo("docs")
+	if err != nil {
+		t.Fatalf("GetTableInfo failed: %v", err)
+	}
+	wantArgs := []string{"title", "body", "tokenize = 'porter unicode61'"}
+	if info.Kind != TableKindVirtual || info.Module != "fts5" || strings.Join(info.ModuleArgs, "|") != strings.Join(wantArgs, "|") {
+		t.Errorf("docs info = %s %s %q", info.Kind, info.Module, info.ModuleArgs)
+	}
+
+	if _, err := Insert(conn, "docs", map[string]any{"title": "a", "body": "b"}); err != nil {
+		t.Fatalf("Insert into virtual table failed: %v", err)
+	}
+	if _, err := Delete(conn, "docs_data", ""); !errors.Is(err, ErrShadowTable) {
+		t.Errorf("Delete from shadow table: got %v, want ErrShadowTable", err)
+	}
+	if _, err := Update(conn, "docs_content", map[string]any{"c0": "x"}, ""); !errors.Is(err, ErrShadowTable) {
+		t.Errorf("Update of shadow table: got %v, want ErrShadowTable", err)
+	}
+}
+
+// TestSchema_GetTriggers tests that triggers are reported with their timing
+// and event and are included in the table info.
+func TestSchema_GetTriggers(t *testing.T) {
+	dbPath, cleanup := testutil.EmptyDB(t)
+	defer cleanup()
+
+	conn, err := OpenReadWrite(dbPath)
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	defer conn.Close()
+
+	for _, q := range []string{
+		"CREATE TABLE items (id INTEGER PRIMARY KEY, price REAL, qty INTEGER)",
+		"CREATE TABLE log (msg TEXT)",
+		"CREATE TRIGGER items_ai AFTER INSERT ON items BEGIN INSERT INTO log VALUES ('insert'); END",
+		"CREATE TRIGGER IF NOT EXISTS items_bu UPDATE OF price, \"qty\" ON items BEGIN SELECT 1; END",
+		"CREATE TRIGGER log_bd BEFORE DELETE ON log BEGIN SELECT RAISE(ABORT, 'no'); END",
+	} {
+		if _, err := conn.Execute(q); err != nil {
+			t.Fatalf("%s: %v", q, err)
+		}
+	}
+
+	info, err := NewSchema(conn).GetTableInfo("items")
+	if err != nil {
+		t.Fatalf("GetTableInfo failed: %v", err)
+	}
+	if len(info.Triggers) != 2 {
+		t.Fatalf("got %d triggers, want 2: %+v", len(info.Triggers), info.Triggers)
+	}
+	want := []TriggerInfo{
+		{Name: "items_ai", Timing: "AFTER", Event: "INSERT"},
+		{Name: "items_bu", Timing: "BEFORE", Event: "UPDATE", Columns: []string{"price", "qty"}},
+	}
+	for i, trig := range info.Triggers {
+		w := want[i]
+		if trig.Name != w.Name || trig.Timing != w.Timing || trig.Event != w.Event ||
+			strings.Join(trig.Columns, ",") != strings.Join(w.Columns, ",") {
+			t.Errorf("trigger %d = %+v, want %+v", i, trig, w)
+		}
+		if !strings.HasPrefix(trig.SQL, "CREATE TRIGGER") {
+			t.Errorf("trigger %s SQL = %q", trig.Name, trig.SQL)
+		}
+	}
+}
+
+// TestIntegrityCheck tests that the check reports progress per table and
+// stops when its context is cancelled.
+func TestIntegrityCheck(t *testing.T) {
+	dbPath, cleanup := testutil.EmptyDB(t)
+	defer cleanup()
+
+	conn, err := OpenReadWrite(dbPath)
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	defer conn.Close()
+
+	for _, q := range []string{
+		"CREATE TABLE a (id INTEGER PRIMARY KEY, v TEXT UNIQUE)",
+		"CREATE TABLE b (id INTEGER PRIMARY KEY)",
+		"INSERT INTO a (v) VALUES ('x'), ('y')",
+	} {
+		if _, err := conn.Execute(q); err != nil {
+			t.Fatalf("%s: %v", q, err)
+		}
+	}
+
+	var seen []IntegrityProgress
+	report, err := IntegrityCheck(context.Background(), conn, false, func(p IntegrityProgress) {
+		seen = append(seen, p)
+	})
+	if err != nil {
+		t.Fatalf("IntegrityCheck failed: %v", err)
+	}
+	if !report.OK() || report.Tables != 3 {
+		t.Errorf("report = %+v, want ok with 3 tables", report)
+	}
+	if len(seen) != 3 || seen[2].Done != 3 || seen[2].Total != 3 {
+		t.Errorf("progress = %+v", seen)
+	}
+
+	if report, err := IntegrityCheck(context.Background(), conn, true, nil); err != nil || !report.OK() || !report.Quick {
+		t.Errorf("quick check = %+v, %v", report, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := IntegrityCheck(ctx, conn, false, nil); err == nil {
+		t.Error("expected an error from a cancelled check")
+	}
+}
+
+// TestMeasureSizes tests per-object sizes, from dbstat and estimated.
+func TestMeasureSizes(t *testing.T) {
+	dbPath, cleanup := testutil.EmptyDB(t)
+	defer cleanup()
+
+	conn, err := OpenReadWrite(dbPath)
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	defer conn.Close()
+
+	for _, q := range []string{
+		"CREATE TABLE big (id INTEGER PRIMARY KEY, v TEXT)",
+		"CREATE INDEX big_v ON big (v)",
+		"CREATE TABLE small (id INTEGER PRIMARY KEY)",
+		"WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM n WHERE i < 200) INSERT INTO big (v) SELECT printf('%0500d', i) FROM n",
+	} {
+		if _, err := conn.Execute(q); err != nil {
+			t.Fatalf("%s: %v", q, err)
+		}
+	}
+
+	report, err := MeasureSizes(context.Background(), conn)
+	if err != nil {
+		t.Fatalf("MeasureSizes failed: %v", err)
+	}
+	if report.TotalBytes() == 0 {
+		t.Error("expected a total size")
+	}
+	largest := report.Largest(2)
+	if len(largest) != 2 || largest[0].Bytes < largest[1].Bytes {
+		t.Fatalf("Largest(2) = %+v", largest)
+	}
+	if largest[0].Name != "big" && largest[0].Name != "big_v" {
+		t.Errorf("largest object = %s, want big or big_v", largest[0].Name)
+	}
+
+	// The fallback estimates from row payloads
+	objects, err := listSizeObjects(context.Background(), conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	estimateSizes(conn, objects, report.PageSize)
+	if objects["big"].Bytes < 200*500 || objects["big_v"].Bytes < 200*500 {
+		t.Errorf("estimated sizes = %d and %d, want at least the payload", objects["big"].Bytes, objects["big_v"].Bytes)
+	}
+	if objects["small"].Bytes != 0 {
+		t.Errorf("estimated size of an empty table = %d", objects["small"].Bytes)
+	}
+}
+
+// TestBackup tests that a backup is a complete copy that replaces the
+// destination and leaves no temporary files behind.
+func TestBackup(t *testing.T) {
+	dbPath, cleanup := testutil.EmptyDB(t)
+	defer cleanup()
+
+	conn, err := OpenReadWrite(dbPath)
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	defer conn.Close()
+
+	for _, q := range []string{
+		"CREATE TABLE items (id INTEGER PRIMARY KEY, name TEXT)",
+		"INSERT INTO items (name) VALUES ('a'), ('b'), ('c')",
+	} {
+		if _, err := conn.Execute(q); err != nil {
+			t.Fatalf("%s: %v", q, err)
+		}
+	}
+
+	dir := t.TempDir()
+	dest := filepath.Join(dir, "backup.db")
+	if err := os.WriteFile(dest, []byte("old backup"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	size, err := backupConn(context.Background(), conn, dest)
+	if err != nil {
+		t.Fatalf("backupConn failed: %v", err)
+	}
+	if info, err := os.Stat(dest); err != nil || info.Size() != size {
+		t.Errorf("backup size = %d, stat %v", size, err)
+	}
+
+	copyConn, err := OpenReadOnly(dest)
+	if err != nil {
+		t.Fatalf("failed to open backup: %v", err)
+	}
+	defer copyConn.Close()
+	if count, err := NewSchema(copyConn).GetRowCount("items"); err != nil || count != 3 {
+		t.Errorf("backup has %d rows (%v), want 3", count, err)
+	}
+
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("expected only the backup in %s, got %d entries", dir, len(entries))
+	}
+	if _, err := backupConn(context.Background(), conn, dbPath); err == nil {
+		t.Error("expected an error backing up onto the source")
+	}
+}
+
+// TestSnapshot tests that a snapshot is an immutable copy that doesn't see
+// later writes and is deleted on close.
+func TestSnapshot(t *testing.T) {
+	dbPath, cleanup := testutil.EmptyDB(t)
+	defer cleanup()
+
+	conn, err := OpenReadWrite(dbPath)
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	defer conn.Close()
+
+	for _, q := range []string{
+		"CREATE TABLE items (id INTEGER PRIMARY KEY)",
+		"INSERT INTO items VALUES (1), (2)",
+	} {
+		if _, err := conn.Execute(q); err != nil {
+			t.Fatalf("%s: %v", q, err)
+		}
+	}
+
+	snap, err := snapshotConn(context.Background(), conn)
+	if err != nil {
+		t.Fatalf("snapshotConn failed: %v", err)
+	}
+	if !snap.ReadOnly {
+		t.Error("expected a read-only snapshot")
+	}
+	if _, err := conn.Execute("INSERT INTO items VALUES (3)"); err != nil {
+		t.Fatalf("insert failed: %v", err)
+	}
+	if count, err := NewSchema(snap).GetRowCount("items"); err != nil || count != 2 {
+		t.Errorf("snapshot has %d rows (%v), want 2", count, err)
+	}
+
+	snap.Close()
+	if _, err := os.Stat(filepath.Dir(snap.Path)); !os.IsNotExist(err) {
+		t.Errorf("snapshot directory left behind: %v", err)
+	}
+}
+
+// TestQuery_LargeValues tests that BLOBs keep their type and that values
+// over MaxCellSize are truncated in results but can be fetched whole.
+func TestChangeFeed(t *testing.T) {
+	dbPath, cleanup := testutil.EmptyDB(t)
+	defer cleanup()
+
+	conn, err := OpenReadWrite(dbPath)
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	defer conn.Close()
+
+	for _, q := range []string{
+		"CREATE TABLE events (id INTEGER PRIMARY KEY, name TEXT, updated_at INTEGER)",
+		"INSERT INTO events VALUES (1, 'a', 100), (2, 'b', 100)",
+		"CREATE TABLE tags (name TEXT PRIMARY KEY, n INTEGER) WITHOUT ROWID",
+		"CREATE TABLE pairs (a TEXT, b TEXT, PRIMARY KEY (a, b)) WITHOUT ROWID",
+	} {
+		if _, err := conn.Execute(q); err != nil {
+			t.Fatalf("%s: %v", q, err)
+		}
+	}
+
+	ctx := context.Background()
+	feed, err := NewChangeFeed(ctx, conn, "events")
+	if err != nil {
+		t.Fatalf("NewChangeFeed failed: %v", err)
+	}
+	if events, err := feed.Poll(ctx); err != nil || len(events) != 0 {
+		t.Fatalf("expected no events before changes, got %v, %v", events, err)
+	}
+
+	for _, q := range []string{
+		"INSERT INTO events VALUES (3, 'c', 200)",
+		"UPDATE events SET name = 'A', updated_at = 150 WHERE id = 1",
+	} {
+		if _, err := conn.Execute(q); err != nil {
+			t.Fatalf("%s: %v", q, err)
+		}
+	}
+	events, err := feed.Poll(ctx)
+	if err != nil {
+		t.Fatalf("Poll failed: %v", err)
+	}
+	if len(events) != 2 || events[0].Op != FeedUpdate || events[0].Row[1] != "A" ||
+		events[1].Op != FeedInsert || events[1].Row[1] != "c" || events[1].Key != int64(3) {
+		t.Errorf("events = %+v, want the update of 1 then the insert of 3", events)
+	}
+	if events, _ := feed.Poll(ctx); len(events) != 0 {
+		t.Errorf("expected changes to be reported once, got %+v", events)
+	}
+
+	recent, err := feed.Recent(ctx, 2)
+	if err != nil {
+		t.Fatalf("Recent failed: %v", err)
+	}
+	if len(recent.Rows) != 2 || recent.Rows[0][0] != int64(2) || recent.Rows[1][0] != int64(3) || len(recent.Columns) != 3 {
+		t.Errorf("Recent = %v %v, want rows 2 and 3", recent.Columns, recent.Rows)
+	}
+
+	// WITHOUT ROWID tables are followed by a single-column key
+	tags, err := NewChangeFeed(ctx, conn, "tags")
+	if err != nil {
+		t.Fatalf("NewChangeFeed(tags) failed: %v", err)
+	}
+	conn.Execute("INSERT INTO tags VALUES ('x', 1)")
+	if events, err := tags.Poll(ctx); err != nil || len(events) != 1 || events[0].Row[0] != "x" {
+		t.Errorf("tags events = %+v, %v, want the insert of x", events, err)
+	}
+
+	if _, err := NewChangeFeed(ctx, conn, "pairs"); !errors.Is(err, ErrNoFeedKey) {
+		t.Errorf("expected ErrNoFeedKey for a composite key, got %v", err)
+	}
+	if _, err := NewChangeFeed(ctx, conn, "missing"); !errors.Is(err, ErrTableNotFound) {
+		t.Errorf("expected ErrTableNotFound, got %v", err)
+	}
+}
+
+func TestParseCellInput(t *testing.T) {
+	col := func(typ string) ColumnInfo { return ColumnInfo{Name: "c", Type: typ} }
+	tests := []struct {
+		input string
+		col   ColumnInfo
+		want  any
+	}{
+		{"42", col("INTEGER"), int64(42)},
+		{" 7 ", col("BIGINT"), int64(7)},
+		{"1.5", col("INT"), 1.5},
+		{"3", col("REAL"), 3.0},
+		{"2.5e3", col("DOUBLE PRECISION"), 2500.0},
+		{"42", col("VARCHAR(10)"), "42"},
+		{"NULL", col("TEXT"), nil},
+		{`\NULL`, col("TEXT"), "NULL"},
+		{"12", col("DECIMAL(10,2)"), int64(12)},
+		{"2024-01-02", col("DATETIME"), "2024-01-02"},
+		{"99", col(""), int64(99)},
+		{"abc", col(""), "abc"},
+	}
+	for _, tt := range tests {
+		got, err := ParseCellInput(tt.input, tt.col)
+		if err != nil || got != tt.want {
+			t.Errorf("ParseCellInput(%q, %s) = %#v, %v; want %#v", tt.input, tt.col.Type, got, err, tt.want)
+		}
+	}
+
+	for _, bad := range []struct {
+		input string
+		col   ColumnInfo
+	}{
+		{"abc", col("INTEGER")},
+		{"", col("INTEGER")},
+		{"1,5", col("REAL")},
+		{"inf", col("REAL")},
+		{"NULL", ColumnInfo{Name: "c", Type: "TEXT", NotNull: true}},
+		{"NULL", ColumnInfo{Name: "c", Type: "TEXT", PrimaryKey: 1}},
+	} {
+		if _, err := ParseCellInput(bad.input, bad.col); !errors.Is(err, ErrInvalidValue) {
+			t.Errorf("ParseCellInput(%q, %+v) = %v, want ErrInvalidValue", bad.input, bad.col, err)
+		}
+	}
+}
+
+// TestUpdateCell checks that cells are updated by rowid in tables without a
+// primary key and by every column of a composite one.
+func TestUpdateCell(t *testing.T) {
+	dbPath, cleanup := testutil.EmptyDB(t)
+	defer cleanup()
+
+	conn, err := OpenReadWrite(dbPath)
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	defer conn.Close()
+
+	for _, q := range []string{
+		"CREATE TABLE notes (body TEXT)",
+		"INSERT INTO notes (rowid, body) VALUES (1, 'a'), (2, 'a')",
+		"CREATE TABLE grades (student TEXT, course TEXT, grade TEXT, PRIMARY KEY (student, course)) WITHOUT ROWID",
+		"INSERT INTO grades VALUES ('ann', 'math', 'B'), ('ann', 'art', 'C'), ('bob', 'math', 'C')",
+	} {
+		if _, err := conn.Execute(q); err != nil {
+			t.Fatalf("%s: %v", q, err)
+		}
+	}
+
+	if pks, err := GetPrimaryKeyColumn(conn, "notes"); err != nil || !slices.Equal(pks, []string{"rowid"}) {
+		t.Fatalf("GetPrimaryKeyColumn(notes) = %v, %v; want [rowid]", pks, err)
+	}
+	if _, err := UpdateCell(conn, "notes", map[string]any{"rowid": int64(2)}, "body", "b"); err != nil {
+		t.Fatalf("UpdateCell(notes): %v", err)
+	}
+	result, err := Query(conn, "SELECT body FROM notes ORDER BY rowid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := []any{result.Rows[0][0], result.Rows[1][0]}; got[0] != "a" || got[1] != "b" {
+		t.Errorf("notes = %v, want [a b]", got)
+	}
+
+	key := map[string]any{"student": "ann", "course": "math"}
+	if _, err := UpdateCell(conn, "grades", key, "grade", "A"); err != nil {
+		t.Fatalf("UpdateCell(grades): %v", err)
+	}
+	result, err = Query(conn, "SELECT grade FROM grades ORDER BY student, course")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var grades []any
+	for _, row := range result.Rows {
+		grades = append(grades, row[0])
+	}
+	if want := []any{"C", "A", "C"}; !slices.Equal(grades, want) {
+		t.Errorf("grades = %v, want %v", grades, want)
+	}
+
+	if _, err := UpdateCell(conn, "notes", map[string]any{"rowid": int64(9)}, "body", "x"); !errors.Is(err, ErrRowNotFound) {
+		t.Errorf("UpdateCell(missing row) = %v, want ErrRowNotFound", err)
+	}
+}
+
+func TestQuery_LargeValues(t *testing.T) {
+	dbPath, cleanup := testutil.EmptyDB(t)
+	defer cleanup()
+
+	conn, err := OpenReadWrite(dbPath)
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	defer conn.Close()
+
+	big := strings.Repeat("é", MaxCellSize) // two bytes each
+	if _, err := conn.Execute("CREATE TABLE files (id INTEGER PRIMARY KEY, data BLOB, note TEXT)"); err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	if _, err := conn.Execute("INSERT INTO files VALUES (1, x'00ff10', 'small'), (2, zeroblob(200000), ?)", big); err != nil {
+		t.Fatalf("insert failed: %v", err)
+	}
+
+	result, err := Query(conn, "SELECT data, note FROM files ORDER BY id")
+	if err != nil {
+		t.Fatalf("query failed: %v", err)
+	}
+	if b, ok := result.Rows[0][0].([]byte); !ok || !bytes.Equal(b, []byte{0, 0xff, 0x10}) {
+		t.Errorf("small blob = %#v, want []byte{0, 0xff, 0x10}", result.Rows[0][0])
+	}
+	if got := FormatValue(result.Rows[0][0]); got != "x'00ff10'" {
+		t.Errorf("FormatValue(blob) = %q", got)
+	}
+
+	blob, ok := result.Rows[1][0].(TruncatedValue)
+	if !ok || blob.Size != 200000 || len(blob.Head.([]byte)) != MaxCellSize {
+		t.Errorf("big blob = %T %v, want truncated to %d of 200000 bytes", result.Rows[1][0], blob, MaxCellSize)
+	}
+	text, ok := result.Rows[1][1].(TruncatedValue)
+	if !ok || text.Size != int64(len(big)) || !utf8.ValidString(text.Head.(string)) {
+		t.Errorf("big text = %T, want truncated at a character boundary", result.Rows[1][1])
+	}
+
+	full, err := FetchCell(context.Background(), conn, "files", "data", "id", int64(2))
+	if err != nil {
+		t.Fatalf("FetchCell failed: %v", err)
+	}
+	if b, ok := full.([]byte); !ok || len(b) != 200000 {
+		t.Errorf("FetchCell = %T of %d bytes, want 200000-byte []byte", full, len(b))
+	}
+	if _, err := FetchCell(context.Background(), conn, "files", "data", "id", int64(3)); err == nil {
+		t.Error("expected error for missing row")
+	}
+}
+
+func TestQuery_ResultLimits(t *testing.T) {
+	dbPath, cleanup := testutil.EmptyDB(t)
+	defer cleanup()
+
+	conn, err := OpenReadWrite(dbPath)
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Execute("CREATE TABLE docs (id INTEGER PRIMARY KEY, body TEXT)"); err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	if _, err := conn.Execute("WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM n WHERE i < 100) INSERT INTO docs SELECT i, printf('%.1000c', 'x') FROM n"); err != nil {
+		t.Fatalf("insert failed: %v", err)
+	}
+
+	ctx := context.Background()
+	result, err := tracedQuery(ctx, nil, conn, "SELECT * FROM docs", nil, resultLimits{rows: 10, bytes: 1 << 20})
+	if err != nil {
+		t.Fatalf("query failed: %v", err)
+	}
+	if len(result.Rows) != 10 || !result.Truncated || result.TruncatedBy != TruncatedRows {
+		t.Errorf("got %d rows, truncated=%v by %q; want 10 rows cut by the row limit", len(result.Rows), result.Truncated, result.TruncatedBy)
+	}
+
+	result, err = tracedQuery(ctx, nil, conn, "SELECT * FROM docs", nil, resultLimits{bytes: 10000})
+	if err != nil {
+		t.Fatalf("query failed: %v", err)
+	}
+	if len(result.Rows) == 0 || len(result.Rows) >= 10 || result.TruncatedBy != TruncatedBytes || result.Size > 10000 {
+		t.Errorf("got %d rows of %d bytes cut by %q; want fewer than 10 rows within 10000 bytes", len(result.Rows), result.Size, result.TruncatedBy)
+	}
+	if note := result.TruncationNote(); !strings.Contains(note, "size limit") {
+		t.Errorf("TruncationNote() = %q, want the size limit named", note)
+	}
+
+	// A single row over the cap is still returned
+	result, err = tracedQuery(ctx, nil, conn, "SELECT * FROM docs", nil, resultLimits{bytes: 10})
+	if err != nil || len(result.Rows) != 1 {
+		t.Errorf("expected one row over a tiny cap, got %v, %v", result, err)
+	}
+
+	result, err = Query(conn, "SELECT * FROM docs")
+	if err != nil || len(result.Rows) != 100 || result.Truncated || result.TruncationNote() != "" {
+		t.Errorf("expected all 100 rows without limits, got truncated=%v, %v", result.Truncated, err)
+	}
+}
+
 // TestReadOnly_CannotWrite tests that read-only connections cannot write.
 func TestReadOnly_CannotWrite(t *testing.T) {
 	dbPath, cleanup := testutil.TestDB(t, "users.db")
@@ -375,3 +1176,74 @@ func TestReadOnly_CannotWrite(t *testing.T) {
 		t.Error("expected error when dropping table via read-only connection")
 	}
 }
+
+func TestQueryContext_Cancel(t *testing.T) {
+	dbPath, cleanup := testutil.TestDB(t, "users.db")
+	defer cleanup()
+
+	conn, err := OpenReadOnly(dbPath)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	// Counts far past anything that would finish before the deadline
+	start := time.Now()
+	_, err = QueryContext(ctx, conn, `
+		WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM n)
+		SELECT COUNT(*) FROM n`)
+	if !errors.Is(err, context.DeadlineExceeded) && (err == nil || !strings.Contains(err.Error(), "interrupt")) {
+		t.Fatalf("expected the query to be interrupted, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("query kept running for %v after its context ended", elapsed)
+	}
+
+	// The connection is still usable afterwards
+	if _, err := Query(conn, "SELECT COUNT(*) FROM users"); err != nil {
+		t.Errorf("query after cancellation failed: %v", err)
+	}
+}
+
+func TestSelectRows_Streams(t *testing.T) {
+	dbPath, cleanup := testutil.TestDB(t, "large.db")
+	defer cleanup()
+
+	conn, err := OpenReadOnly(dbPath)
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	defer conn.Close()
+
+	want, err := Select(conn, "records", SelectOptions{Limit: 25, Offset: 10})
+	if err != nil {
+		t.Fatalf("Select failed: %v", err)
+	}
+
+	rows, err := SelectRows(context.Background(), conn, "records", SelectOptions{Limit: 25, Offset: 10})
+	if err != nil {
+		t.Fatalf("SelectRows failed: %v", err)
+	}
+	defer rows.Close()
+
+	if strings.Join(rows.Columns(), ",") != strings.Join(want.Columns, ",") {
+		t.Errorf("columns = %v, want %v", rows.Columns(), want.Columns)
+	}
+	n := 0
+	for rows.Next() {
+		row := rows.Row()
+		if n >= len(want.Rows) || FormatValue(row[0]) != FormatValue(want.Rows[n][0]) {
+			t.Fatalf("row %d = %v, want %v", n, row, want.Rows[n])
+		}
+		n++
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatalf("iteration failed: %v", err)
+	}
+	if n != len(want.Rows) {
+		t.Errorf("streamed %d rows, want %d", n, len(want.Rows))
+	}
+}
@@ -0,0 +1,74 @@
+package database
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// exactCountBelow is the estimate under which EstimateRowCount counts rows
+// exactly; COUNT(*) scans the whole table, which is only cheap when small.
+const exactCountBelow = 100_000
+
+// EstimateRowCount returns the number of rows in a table without scanning
+// it where possible, reporting whether the count is exact. The estimate
+// comes from sqlite_stat1 when ANALYZE has run, else from the largest
+// rowid. Small tables, views and tables shadowed by row filters are
+// counted exactly, so filtered rows never show in an estimate.
+func (s *Schema) EstimateRowCount(tableName string) (count int64, exact bool, err error) {
+	if !s.shadowed(tableName) {
+		estimate, ok := s.statRowCount(tableName)
+		if !ok {
+			estimate, ok = s.maxRowid(tableName)
+		}
+		if ok && estimate >= exactCountBelow {
+			return estimate, false, nil
+		}
+	}
+
+	count, err = s.GetRowCount(tableName)
+	return count, true, err
+}
+
+// shadowed reports whether a temp table or view hides the main table of
+// the same name, as row filters do.
+func (s *Schema) shadowed(tableName string) bool {
+	var n int
+	err := s.conn.QueryRow("SELECT COUNT(*) FROM sqlite_temp_master WHERE name = ?", tableName).Scan(&n)
+	return err != nil || n > 0
+}
+
+// statRowCount reads a table's row count from sqlite_stat1. The first
+// number of each entry is the row count of the table or index.
+func (s *Schema) statRowCount(tableName string) (int64, bool) {
+	var stat string
+	err := s.conn.QueryRow(`
+		SELECT stat FROM sqlite_stat1
+		WHERE tbl = ?
+		ORDER BY idx IS NOT NULL
+		LIMIT 1
+	`, tableName).Scan(&stat)
+	if err != nil {
+		return 0, false
+	}
+	fields := strings.Fields(stat)
+	if len(fields) == 0 {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(fields[0], 10, 64)
+	return n, err == nil
+}
+
+// maxRowid returns the largest rowid in a table, which is at least its row
+// count unless rowids were assigned explicitly.
+func (s *Schema) maxRowid(tableName string) (int64, bool) {
+	var n *int64
+	err := s.conn.QueryRow(fmt.Sprintf("SELECT max(rowid) FROM %s", quoteIdentifier(tableName))).Scan(&n)
+	if err != nil {
+		return 0, false
+	}
+	if n == nil {
+		return 0, true // empty table
+	}
+	return *n, true
+}
@@ -0,0 +1,193 @@
+package database
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/johan-st/sqlite-tui/internal/access"
+)
+
+// Row filters are applied by shadowing each filtered table with a temp view
+// of the same name. Unqualified names resolve to the temp schema before
+// main, so queries, exports and the TUI all see the filtered rows. Writes to
+// the view fail, which makes filtered tables read-only for the user.
+
+// filteredKeywords are the keywords of statements that could read around
+// the views, and filteredTables the tables that could.
+var (
+	filteredKeywords = []string{"ATTACH", "DETACH", "VACUUM", "CREATE", "DROP", "ALTER"}
+	filteredTables   = []string{"sqlite_temp_master", "sqlite_temp_schema"}
+)
+
+// filteredAllowed lists the statements users with row filters may run.
+var filteredAllowed = []string{"SELECT", "VALUES", "EXPLAIN", "INSERT", "UPDATE", "DELETE", "REPLACE", "PRAGMA"}
+
+// RowFilters returns the row filters that apply to a user in a database,
+// keyed by table. Tables closed to the user by alias/table rules are
+// filtered to no rows, and tables they may only read are filtered to all
+// rows, which leaves them read-only.
+func (m *Manager) RowFilters(user *access.UserInfo, pathOrAlias string) map[string]string {
+	db := m.discovery.GetDatabase(pathOrAlias)
+	if db == nil {
+		return nil
+	}
+
+	m.mu.RLock()
+	resolver := m.resolver
+	m.mu.RUnlock()
+
+	filters := resolver.RowFilters(user, db.Path, db.Alias)
+	if !resolver.HasTableRules(user, db.Alias) {
+		return filters
+	}
+
+	tables, err := listTables(db.Path, db.Key)
+	if err != nil {
+		return filters
+	}
+	level := resolver.Resolve(user, db.Path, db.Alias)
+	for _, table := range tables {
+		tableLevel := resolver.ResolveTable(user, db.Path, db.Alias, table)
+		var where string
+		switch {
+		case !tableLevel.CanRead():
+			where = "0"
+		case level.CanWrite() && !tableLevel.CanWrite():
+			where = "1"
+		default:
+			continue
+		}
+		if filters == nil {
+			filters = make(map[string]string)
+		}
+		if prev, ok := filters[table]; ok {
+			where = prev + " AND " + where
+		}
+		filters[table] = where
+	}
+	return filters
+}
+
+// TableAccessLevel returns a user's access level for a table, taking
+// alias/table rules into account.
+func (m *Manager) TableAccessLevel(user *access.UserInfo, pathOrAlias, table string) access.Level {
+	db := m.discovery.GetDatabase(pathOrAlias)
+	if db == nil {
+		return access.None
+	}
+
+	m.mu.RLock()
+	resolver := m.resolver
+	m.mu.RUnlock()
+
+	return capReadOnly(db, resolver.ResolveTable(user, db.Path, db.Alias, table))
+}
+
+// FilterTables returns the tables a user may read, in the given order.
+func (m *Manager) FilterTables(user *access.UserInfo, pathOrAlias string, tables []string) []string {
+	db := m.discovery.GetDatabase(pathOrAlias)
+	if db == nil {
+		return nil
+	}
+
+	m.mu.RLock()
+	resolver := m.resolver
+	m.mu.RUnlock()
+
+	if !resolver.HasTableRules(user, db.Alias) {
+		return tables
+	}
+	visible := make([]string, 0, len(tables))
+	for _, table := range tables {
+		if resolver.ResolveTable(user, db.Path, db.Alias, table).CanRead() {
+			visible = append(visible, table)
+		}
+	}
+	return visible
+}
+
+// listTables lists a database's tables over a short-lived read-only
+// connection, so it doesn't depend on the connection being set up.
+func listTables(path, key string) ([]string, error) {
+	opts := DefaultOpenOptions()
+	opts.ReadOnly = true
+	opts.Key = key
+	conn, err := Open(path, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	return NewSchema(conn).ListTables()
+}
+
+// RowFilterStatements returns the statements that apply row filters to a
+// new connection, for use as OpenOptions.Init.
+func RowFilterStatements(filters map[string]string) []string {
+	tables := make([]string, 0, len(filters))
+	for table := range filters {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+
+	stmts := make([]string, 0, len(tables))
+	for _, table := range tables {
+		quoted := quoteIdentifier(table)
+		stmts = append(stmts, fmt.Sprintf("CREATE TEMP VIEW %s AS SELECT * FROM main.%s WHERE %s",
+			quoted, quoted, filters[table]))
+	}
+	return stmts
+}
+
+// CheckRowFilterQuery returns an error wrapping ErrAccessDenied if a query
+// from a user with row filters could bypass them.
+func CheckRowFilterQuery(query string) error {
+	stmts := ClassifySQL(query)
+	if len(stmts) == 0 || filteredForbidden(query) {
+		return fmt.Errorf("%w: statement not allowed with row filters", ErrAccessDenied)
+	}
+	for _, s := range stmts {
+		if !slices.Contains(filteredAllowed, s.Type) {
+			return fmt.Errorf("%w: statement not allowed with row filters", ErrAccessDenied)
+		}
+		if s.Type == "PRAGMA" && !s.ReadOnly() {
+			return fmt.Errorf("%w: setting pragmas not allowed with row filters", ErrAccessDenied)
+		}
+	}
+	if schemaQualified(query) {
+		return fmt.Errorf("%w: schema-qualified names not allowed with row filters", ErrAccessDenied)
+	}
+	return nil
+}
+
+// filteredForbidden reports whether a query uses a keyword or names a
+// table that could read around the views. Only tokens count, so string
+// literals like 'drop off' and names like created or "alter" don't.
+func filteredForbidden(query string) bool {
+	for _, t := range tokenize(query) {
+		if t.kind == tokWord && slices.ContainsFunc(filteredKeywords, t.isWord) {
+			return true
+		}
+		if t.isName() && slices.ContainsFunc(filteredTables, func(table string) bool { return strings.EqualFold(t.text, table) }) {
+			return true
+		}
+	}
+	return false
+}
+
+// schemaQualified reports whether a query qualifies a name with the main or
+// temp schema, e.g. main.t, "main"."t" or 'main'.t, which would reach the
+// filtered tables past their views. Comments between the qualifier and the
+// dot are dropped by the tokenizer, as by SQLite.
+func schemaQualified(query string) bool {
+	toks := tokenize(query)
+	for i := 0; i+1 < len(toks); i++ {
+		t := toks[i]
+		if t.isName() && toks[i+1].is(".") &&
+			(strings.EqualFold(t.text, "main") || strings.EqualFold(t.text, "temp")) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,103 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/johan-st/sqlite-tui/internal/access"
+	"github.com/johan-st/sqlite-tui/internal/config"
+	"github.com/johan-st/sqlite-tui/internal/testutil"
+)
+
+// TestCheckRowFilterQuery tests that queries naming the main or temp
+// schema are refused in every quoting style, comments or not, as are
+// statements that could change the schema, but not literals or names that
+// merely contain their keywords.
+func TestCheckRowFilterQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		ok    bool
+	}{
+		{"SELECT * FROM users", true},
+		{"SELECT u.name FROM users u WHERE u.id = 1", true},
+		{"SELECT 'main.users' AS s FROM users", true},
+		{"SELECT * FROM users -- main.users", true},
+		{"SELECT * FROM domain.users", true},
+		{"SELECT * FROM main.users", false},
+		{"SELECT * FROM MAIN.users", false},
+		{"SELECT count(*) FROM main/**/.users", false},
+		{"SELECT count(*) FROM main /* x */ . users", false},
+		{"SELECT count(*) FROM main--x\n.users", false},
+		{`SELECT count(*) FROM "main".users`, false},
+		{"SELECT count(*) FROM [main].users", false},
+		{"SELECT count(*) FROM `main`.users", false},
+		{"SELECT count(*) FROM 'main'.users", false},
+		{"SELECT count(*) FROM temp.users", false},
+		{`SELECT count(*) FROM "TEMP"/**/.users`, false},
+		{"SELECT main.users.name FROM users", false},
+		{"SELECT * FROM users WHERE name = 'drop off'", true},
+		{"SELECT created, updated FROM users", true},
+		{`SELECT "alter", [create] FROM users`, true},
+		{"SELECT * FROM users -- create a report", true},
+		{"UPDATE users SET name = 'Vacuum cleaner' WHERE id = 1", true},
+		{"CREATE TEMP TABLE t AS SELECT * FROM users", false},
+		{"DROP VIEW users", false},
+		{"EXPLAIN ALTER TABLE users RENAME TO x", false},
+		{"ATTACH 'other.db' AS other", false},
+		{"SELECT sql FROM sqlite_temp_master", false},
+		{`SELECT sql FROM "SQLITE_TEMP_SCHEMA"`, false},
+	}
+	for _, tt := range tests {
+		err := CheckRowFilterQuery(tt.query)
+		if tt.ok && err != nil {
+			t.Errorf("CheckRowFilterQuery(%q) = %v, want nil", tt.query, err)
+		}
+		if !tt.ok && !errors.Is(err, ErrAccessDenied) {
+			t.Errorf("CheckRowFilterQuery(%q) = %v, want ErrAccessDenied", tt.query, err)
+		}
+	}
+}
+
+// TestManager_RowFilterBypass tests that a table filtered to no rows, as
+// denied tables are, can't be read around its view.
+func TestManager_RowFilterBypass(t *testing.T) {
+	dbPath, cleanup := testutil.TestDB(t, "users.db")
+	defer cleanup()
+
+	manager, err := NewManager(&config.Config{
+		Databases: []config.DatabaseSource{{Path: dbPath, Alias: "test"}},
+	})
+	if err != nil {
+		t.Fatalf("failed to create manager: %v", err)
+	}
+	if err := manager.Start(); err != nil {
+		t.Fatalf("failed to start manager: %v", err)
+	}
+	defer manager.Stop()
+
+	resolver := access.NewResolver()
+	resolver.AddUserRule("tenant", "*", access.ReadWrite)
+	resolver.AddRowFilter("tenant", access.RowFilter{Pattern: "test", Table: "users", Where: "0"})
+	manager.UpdateResolver(resolver)
+	tenant := &access.UserInfo{Name: "tenant"}
+
+	result, err := manager.ExecuteQuery(context.Background(), "test", tenant, "", "SELECT count(*) FROM users")
+	if err != nil {
+		t.Fatalf("filtered count failed: %v", err)
+	}
+	if got := result.Rows[0][0]; got != int64(0) {
+		t.Errorf("filtered count = %v, want 0", got)
+	}
+
+	for _, query := range []string{
+		"SELECT count(*) FROM main/**/.users",
+		"SELECT count(*) FROM 'main'.users",
+		"SELECT count(*) FROM [main].users",
+		"SELECT count(*) FROM `main`.users",
+	} {
+		if _, err := manager.ExecuteQuery(context.Background(), "test", tenant, "", query); !errors.Is(err, ErrAccessDenied) {
+			t.Errorf("ExecuteQuery(%q) = %v, want ErrAccessDenied", query, err)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+)
+
+// Rows iterates over a query's rows one at a time, so callers can write
+// out large results without holding them in memory. It must be closed.
+type Rows struct {
+	rows    *sql.Rows
+	columns []string
+	values  []any
+	ptrs    []any
+	row     []any
+	err     error
+}
+
+// QueryRows runs a query and returns an iterator over its rows.
+// Cancelling ctx stops the query.
+func QueryRows(ctx context.Context, conn *Connection, query string, args ...any) (*Rows, error) {
+	rows, err := conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	columns, err := rows.Columns()
+	if err != nil {
+		rows.Close()
+		return nil, fmt.Errorf("failed to get columns: %w", err)
+	}
+
+	r := &Rows{
+		rows:    rows,
+		columns: columns,
+		values:  make([]any, len(columns)),
+		ptrs:    make([]any, len(columns)),
+	}
+	for i := range r.values {
+		r.ptrs[i] = &r.values[i]
+	}
+	return r, nil
+}
+
+// FetchCell reads one whole value: column of the row of a table whose
+// keyColumn is key. It fetches values truncated in a QueryResult.
+func FetchCell(ctx context.Context, conn *Connection, tableName, column, keyColumn string, key any) (any, error) {
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE %s = ?",
+		quoteIdentifier(column), quoteIdentifier(tableName), quoteIdentifier(keyColumn))
+	rows, err := QueryRows(ctx, conn, query, key)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("no row with %s = %v", keyColumn, key)
+	}
+	return rows.Row()[0], nil
+}
+
+// SelectRows is Select returning an iterator instead of a buffered result.
+func SelectRows(ctx context.Context, conn *Connection, tableName string, opts SelectOptions) (*Rows, error) {
+	opts.KeyColumn, opts.After, opts.Before = "", nil, nil
+	query, args := buildSelect(tableName, opts)
+	return QueryRows(ctx, conn, query, args...)
+}
+
+// Columns returns the result's column names.
+func (r *Rows) Columns() []string {
+	return r.columns
+}
+
+// Next reads the next row, reporting false at the end or on an error.
+func (r *Rows) Next() bool {
+	if r.err != nil || !r.rows.Next() {
+		return false
+	}
+	if err := r.rows.Scan(r.ptrs...); err != nil {
+		r.err = fmt.Errorf("failed to scan row: %w", err)
+		return false
+	}
+
+	// Scanning into any copies BLOBs, so they can be kept as []byte
+	r.row = slices.Clone(r.values)
+	return true
+}
+
+// Row returns the row read by the last call to Next. The slice is the
+// caller's to keep.
+func (r *Rows) Row() []any {
+	return r.row
+}
+
+// Err returns the error that ended the iteration, if any.
+func (r *Rows) Err() error {
+	if r.err != nil {
+		return r.err
+	}
+	return r.rows.Err()
+}
+
+// Close releases the rows; it is safe to call more than once.
+func (r *Rows) Close() error {
+	return r.rows.Close()
+}
@@ -2,10 +2,27 @@ package database
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
+	"os"
+	"slices"
 	"strings"
 )
 
+// ErrTableNotFound is returned when a requested table does not exist.
+var ErrTableNotFound = errors.New("table not found")
+
+// ErrShadowTable is returned when writing to a shadow table, which holds
+// the data of a virtual table and is only consistent when changed through it.
+var ErrShadowTable = errors.New("shadow table of a virtual table")
+
+// Table kinds, as reported by PRAGMA table_list.
+const (
+	TableKindTable   = "table"
+	TableKindVirtual = "virtual"
+	TableKindShadow  = "shadow"
+)
+
 // TableInfo contains information about a database table.
 type TableInfo struct {
 	Name       string
@@ -13,6 +30,19 @@ type TableInfo struct {
 	Columns    []ColumnInfo
 	RowCount   int64
 	PrimaryKey []string
+
+	Kind       string   // one of the TableKind constants
+	Module     string   // module of a virtual table, e.g. "fts5"
+	ModuleArgs []string // arguments of a virtual table's USING clause
+	Triggers   []TriggerInfo
+	Checks     []string // CHECK constraint expressions
+}
+
+// TableEntry is a table in a listing.
+type TableEntry struct {
+	Name   string
+	Kind   string // one of the TableKind constants
+	Module string // module of a virtual table, else ""
 }
 
 // ColumnInfo contains information about a table column.
@@ -23,6 +53,40 @@ type ColumnInfo struct {
 	NotNull      bool
 	DefaultValue sql.NullString
 	PrimaryKey   int // 0 if not PK, otherwise position in composite PK
+
+	Hidden     bool   // hidden column of a virtual table, left out of SELECT *
+	Generated  string // "VIRTUAL" or "STORED" for generated columns, else ""
+	Expression string // a generated column's expression
+	Collation  string // declared collation, "BINARY" if none
+	Unique     bool   // covered alone by a unique index
+}
+
+// Type affinities, as SQLite derives them from declared column types.
+const (
+	AffinityInteger = "INTEGER"
+	AffinityText    = "TEXT"
+	AffinityBlob    = "BLOB"
+	AffinityReal    = "REAL"
+	AffinityNumeric = "NUMERIC"
+)
+
+// Affinity returns the column's type affinity by SQLite's rules, checked in
+// order: INT, then CHAR, CLOB or TEXT, then BLOB or no type, then REAL,
+// FLOA or DOUB; anything else is NUMERIC.
+func (c ColumnInfo) Affinity() string {
+	t := strings.ToUpper(c.Type)
+	switch {
+	case strings.Contains(t, "INT"):
+		return AffinityInteger
+	case strings.Contains(t, "CHAR"), strings.Contains(t, "CLOB"), strings.Contains(t, "TEXT"):
+		return AffinityText
+	case strings.Contains(t, "BLOB"), t == "":
+		return AffinityBlob
+	case strings.Contains(t, "REAL"), strings.Contains(t, "FLOA"), strings.Contains(t, "DOUB"):
+		return AffinityReal
+	default:
+		return AffinityNumeric
+	}
 }
 
 // IndexInfo contains information about an index.
@@ -42,6 +106,32 @@ type ForeignKeyInfo struct {
 	OnDelete string
 }
 
+// TriggerInfo contains information about a trigger.
+type TriggerInfo struct {
+	Name    string
+	Timing  string   // "BEFORE", "AFTER" or "INSTEAD OF"
+	Event   string   // "INSERT", "UPDATE" or "DELETE"
+	Columns []string // columns of an UPDATE OF trigger
+	SQL     string
+}
+
+// DatabaseMetadata describes the storage of a database file.
+type DatabaseMetadata struct {
+	PageSize      int64
+	PageCount     int64
+	FreelistCount int64
+	Encoding      string // "UTF-8", "UTF-16le" or "UTF-16be"
+	JournalMode   string
+	UserVersion   int64
+	ApplicationID int64
+	WALSize       int64 // size of the -wal file, 0 if there is none
+}
+
+// Size returns the size of the database in bytes, not counting the WAL.
+func (m *DatabaseMetadata) Size() int64 {
+	return m.PageSize * m.PageCount
+}
+
 // Schema provides methods for introspecting database schema.
 type Schema struct {
 	conn *Connection
@@ -52,28 +142,103 @@ func NewSchema(conn *Connection) *Schema {
 	return &Schema{conn: conn}
 }
 
-// ListTables returns all user tables in the database.
+// ListTables returns all user tables in the database, including virtual
+// tables but not the shadow tables that store their data.
 func (s *Schema) ListTables() ([]string, error) {
+	entries, err := s.ListTableEntries(false)
+	if err != nil {
+		return nil, err
+	}
+	tables := make([]string, len(entries))
+	for i, e := range entries {
+		tables[i] = e.Name
+	}
+	return tables, nil
+}
+
+// ListTableEntries returns the user tables in the database with their kind.
+// Shadow tables are only included if withShadow is set.
+func (s *Schema) ListTableEntries(withShadow bool) ([]TableEntry, error) {
 	rows, err := s.conn.Query(`
-		SELECT name FROM sqlite_master 
-		WHERE type = 'table' 
-		AND name NOT LIKE 'sqlite_%'
-		ORDER BY name
+		SELECT t.name, t.type, COALESCE(m.sql, '')
+		FROM pragma_table_list AS t
+		LEFT JOIN sqlite_master AS m ON m.type = 'table' AND m.name = t.name
+		WHERE t.schema = 'main'
+		AND t.type IN ('table', 'virtual', 'shadow')
+		AND t.name NOT LIKE 'sqlite_%'
+		ORDER BY t.name
 	`)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list tables: %w", err)
 	}
 	defer rows.Close()
 
-	var tables []string
+	var entries []TableEntry
 	for rows.Next() {
-		var name string
-		if err := rows.Scan(&name); err != nil {
+		var e TableEntry
+		var createSQL string
+		if err := rows.Scan(&e.Name, &e.Kind, &createSQL); err != nil {
 			return nil, fmt.Errorf("failed to scan table name: %w", err)
 		}
-		tables = append(tables, name)
+		if e.Kind == TableKindShadow && !withShadow {
+			continue
+		}
+		if e.Kind == TableKindVirtual {
+			e.Module, _ = virtualModule(createSQL)
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// tableKind returns the kind of a table in the main schema.
+func (s *Schema) tableKind(tableName string) (string, error) {
+	var kind string
+	err := s.conn.QueryRow(`
+		SELECT type FROM pragma_table_list
+		WHERE schema = 'main' AND name = ?
+	`, tableName).Scan(&kind)
+	if err == sql.ErrNoRows {
+		return "", fmt.Errorf("%w: %s", ErrTableNotFound, tableName)
+	}
+	return kind, err
+}
+
+// virtualModule returns the module name and arguments of a CREATE VIRTUAL
+// TABLE statement.
+func virtualModule(createSQL string) (module string, args []string) {
+	toks := tokenize(createSQL)
+	i := slices.IndexFunc(toks, func(t token) bool { return t.isWord("USING") })
+	if i < 0 || i+1 >= len(toks) || !toks[i+1].isName() {
+		return "", nil
+	}
+	module = strings.ToLower(toks[i+1].text)
+
+	// Arguments are separated by top-level commas
+	if i+2 >= len(toks) || !toks[i+2].is("(") {
+		return module, nil
+	}
+	start, depth := toks[i+2].pos+1, 0
+	for _, t := range toks[i+2:] {
+		switch {
+		case t.is("("):
+			depth++
+		case t.is(")") || depth == 1 && t.is(","):
+			if depth == 1 {
+				if arg := strings.TrimSpace(createSQL[start:t.pos]); arg != "" {
+					args = append(args, arg)
+				}
+				start = t.pos + 1
+			}
+			if t.is(")") {
+				depth--
+				if depth == 0 {
+					return module, args
+				}
+			}
+		}
 	}
-	return tables, rows.Err()
+	return module, args
 }
 
 // GetTableInfo returns detailed information about a table.
@@ -86,7 +251,7 @@ func (s *Schema) GetTableInfo(tableName string) (*TableInfo, error) {
 	`, tableName).Scan(&tableSql)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("table %q not found", tableName)
+			return nil, fmt.Errorf("%w: %s", ErrTableNotFound, tableName)
 		}
 		return nil, fmt.Errorf("failed to get table SQL: %w", err)
 	}
@@ -94,6 +259,15 @@ func (s *Schema) GetTableInfo(tableName string) (*TableInfo, error) {
 	info := &TableInfo{
 		Name: tableName,
 		SQL:  tableSql.String,
+		Kind: TableKindTable,
+	}
+	if kind, err := s.tableKind(tableName); err == nil {
+		info.Kind = kind
+	}
+	if info.Kind == TableKindVirtual {
+		info.Module, info.ModuleArgs = virtualModule(info.SQL)
+	} else {
+		info.Checks = parseTableDDL(info.SQL).checks
 	}
 
 	// Get columns
@@ -110,6 +284,12 @@ func (s *Schema) GetTableInfo(tableName string) (*TableInfo, error) {
 		}
 	}
 
+	triggers, err := s.GetTriggers(tableName)
+	if err != nil {
+		return nil, err
+	}
+	info.Triggers = triggers
+
 	// Get row count
 	count, err := s.GetRowCount(tableName)
 	if err != nil {
@@ -121,22 +301,178 @@ func (s *Schema) GetTableInfo(tableName string) (*TableInfo, error) {
 }
 
 // GetColumns returns column information for a table.
+// table_xinfo, unlike table_info, includes generated and hidden columns.
 func (s *Schema) GetColumns(tableName string) ([]ColumnInfo, error) {
-	rows, err := s.conn.Query(fmt.Sprintf("PRAGMA table_info(%s)", quoteIdentifier(tableName)))
+	rows, err := s.conn.Query(fmt.Sprintf("PRAGMA table_xinfo(%s)", quoteIdentifier(tableName)))
 	if err != nil {
 		return nil, fmt.Errorf("failed to get column info: %w", err)
 	}
-	defer rows.Close()
 
 	var columns []ColumnInfo
+	generated := false
 	for rows.Next() {
 		var col ColumnInfo
-		if err := rows.Scan(&col.CID, &col.Name, &col.Type, &col.NotNull, &col.DefaultValue, &col.PrimaryKey); err != nil {
+		var hidden int
+		if err := rows.Scan(&col.CID, &col.Name, &col.Type, &col.NotNull, &col.DefaultValue, &col.PrimaryKey, &hidden); err != nil {
+			rows.Close()
 			return nil, fmt.Errorf("failed to scan column info: %w", err)
 		}
+		switch hidden {
+		case 1:
+			col.Hidden = true
+		case 2:
+			col.Generated = "VIRTUAL"
+		case 3:
+			col.Generated = "STORED"
+		}
+		generated = generated || col.Generated != ""
 		columns = append(columns, col)
 	}
-	return columns, rows.Err()
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// SQLite keeps expressions and collations only in the table's SQL
+	var createSQL string
+	err = s.conn.QueryRow("SELECT sql FROM sqlite_master WHERE type = 'table' AND name = ?", tableName).Scan(&createSQL)
+	if err == nil {
+		ddl := parseTableDDL(createSQL)
+		for i, col := range columns {
+			key := strings.ToLower(col.Name)
+			if col.Generated != "" {
+				columns[i].Expression = ddl.generated[key]
+			}
+			columns[i].Collation = ddl.collations[key]
+			if columns[i].Collation == "" {
+				columns[i].Collation = "BINARY"
+			}
+		}
+	}
+
+	// A column is unique if a full unique index covers it alone
+	rows, err = s.conn.Query(`
+		SELECT MIN(ii.name) FROM pragma_index_list(?) AS il, pragma_index_info(il.name) AS ii
+		WHERE il."unique" = 1 AND il.partial = 0
+		GROUP BY il.name
+		HAVING COUNT(*) = 1 AND MIN(ii.name) IS NOT NULL
+	`, tableName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get unique columns: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("failed to scan unique column: %w", err)
+		}
+		for i := range columns {
+			if columns[i].Name == name {
+				columns[i].Unique = true
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return columns, nil
+}
+
+// tableDDL holds what a CREATE TABLE statement declares beyond the columns
+// PRAGMA table_xinfo reports.
+type tableDDL struct {
+	generated  map[string]string // expression by lower-case column name
+	collations map[string]string // declared collation by lower-case column name
+	checks     []string          // CHECK expressions, table- and column-level
+}
+
+// parseTableDDL parses the column definitions and table constraints of a
+// CREATE TABLE statement.
+func parseTableDDL(createSQL string) tableDDL {
+	ddl := tableDDL{
+		generated:  make(map[string]string),
+		collations: make(map[string]string),
+	}
+	toks := tokenize(createSQL)
+
+	// Definitions are separated by commas in the first parentheses
+	start, depth := -1, 0
+	for i, t := range toks {
+		switch {
+		case t.is("("):
+			depth++
+			if depth == 1 {
+				start = i + 1
+			}
+		case t.is(")") || depth == 1 && t.is(","):
+			if depth == 1 && start >= 0 {
+				ddl.addDef(createSQL, toks[start:i])
+				start = i + 1
+			}
+			if t.is(")") {
+				depth--
+				if depth == 0 {
+					return ddl
+				}
+			}
+		}
+	}
+	return ddl
+}
+
+// addDef records a column definition or table constraint.
+func (ddl *tableDDL) addDef(createSQL string, def []token) {
+	if len(def) == 0 || !def[0].isName() {
+		return
+	}
+
+	// Table constraints start with a keyword, column definitions with a name
+	column := strings.ToLower(def[0].text)
+	if slices.ContainsFunc([]string{"CONSTRAINT", "PRIMARY", "UNIQUE", "CHECK", "FOREIGN"}, def[0].isWord) {
+		column = ""
+	}
+
+	depth := 0
+	for i, t := range def {
+		switch {
+		case t.is("("):
+			depth++
+		case t.is(")"):
+			depth--
+		case depth > 0:
+		case t.isWord("COLLATE") && column != "" && i+1 < len(def) && def[i+1].isName():
+			ddl.collations[column] = strings.ToUpper(def[i+1].text)
+		case t.isWord("AS") && column != "":
+			if expr, ok := groupText(createSQL, def[i+1:]); ok {
+				ddl.generated[column] = expr
+			}
+		case t.isWord("CHECK"):
+			if expr, ok := groupText(createSQL, def[i+1:]); ok {
+				ddl.checks = append(ddl.checks, expr)
+			}
+		}
+	}
+}
+
+// groupText returns the source text inside the parentheses that toks
+// starts with.
+func groupText(src string, toks []token) (string, bool) {
+	if len(toks) == 0 || !toks[0].is("(") {
+		return "", false
+	}
+	depth := 0
+	for _, t := range toks {
+		switch {
+		case t.is("("):
+			depth++
+		case t.is(")"):
+			depth--
+			if depth == 0 {
+				return strings.TrimSpace(src[toks[0].pos+1 : t.pos]), true
+			}
+		}
+	}
+	return "", false
 }
 
 // GetIndexes returns index information for a table.
@@ -222,6 +558,94 @@ func (s *Schema) GetForeignKeys(tableName string) ([]ForeignKeyInfo, error) {
 	return fks, rows.Err()
 }
 
+// GetTriggers returns the triggers on a table or view.
+func (s *Schema) GetTriggers(tableName string) ([]TriggerInfo, error) {
+	rows, err := s.conn.Query(`
+		SELECT name, sql FROM sqlite_master
+		WHERE type = 'trigger' AND tbl_name = ?
+		ORDER BY name
+	`, tableName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get triggers: %w", err)
+	}
+	defer rows.Close()
+
+	var triggers []TriggerInfo
+	for rows.Next() {
+		var trig TriggerInfo
+		if err := rows.Scan(&trig.Name, &trig.SQL); err != nil {
+			return nil, fmt.Errorf("failed to scan trigger: %w", err)
+		}
+		trig.Timing, trig.Event, trig.Columns = parseTrigger(trig.SQL)
+		triggers = append(triggers, trig)
+	}
+	return triggers, rows.Err()
+}
+
+// parseTrigger returns the timing, event and UPDATE OF columns of a CREATE
+// TRIGGER statement. SQLite fires triggers without a timing BEFORE.
+func parseTrigger(createSQL string) (timing, event string, columns []string) {
+	p := &stmtParser{toks: tokenize(createSQL)}
+	if !p.seek("TRIGGER") {
+		return "", "", nil
+	}
+	if p.skipWord("IF") {
+		p.skipWord("NOT")
+		p.skipWord("EXISTS")
+	}
+	p.name()
+
+	timing = "BEFORE"
+	switch {
+	case p.skipWord("BEFORE"):
+	case p.skipWord("AFTER"):
+		timing = "AFTER"
+	case p.skipWord("INSTEAD"):
+		p.skipWord("OF")
+		timing = "INSTEAD OF"
+	}
+
+	if t := p.next(); t.kind == tokWord {
+		event = strings.ToUpper(t.text)
+	}
+	if event == "UPDATE" && p.skipWord("OF") {
+		for p.peek().isName() {
+			columns = append(columns, p.next().text)
+			if !p.peek().is(",") {
+				break
+			}
+			p.next()
+		}
+	}
+	return timing, event, columns
+}
+
+// DatabaseInfo returns the page layout, encoding, journal mode and header
+// fields of the database.
+func (s *Schema) DatabaseInfo() (*DatabaseMetadata, error) {
+	meta := &DatabaseMetadata{}
+	for _, p := range []struct {
+		pragma string
+		dest   any
+	}{
+		{"page_size", &meta.PageSize},
+		{"page_count", &meta.PageCount},
+		{"freelist_count", &meta.FreelistCount},
+		{"encoding", &meta.Encoding},
+		{"journal_mode", &meta.JournalMode},
+		{"user_version", &meta.UserVersion},
+		{"application_id", &meta.ApplicationID},
+	} {
+		if err := s.conn.QueryRow("PRAGMA " + p.pragma).Scan(p.dest); err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", p.pragma, err)
+		}
+	}
+	if fi, err := os.Stat(s.conn.Path + "-wal"); err == nil {
+		meta.WALSize = fi.Size()
+	}
+	return meta, nil
+}
+
 // GetRowCount returns the number of rows in a table.
 func (s *Schema) GetRowCount(tableName string) (int64, error) {
 	var count int64
@@ -232,6 +656,34 @@ func (s *Schema) GetRowCount(tableName string) (int64, error) {
 	return count, nil
 }
 
+// KeyColumn returns the column to page a table by with keyset pagination:
+// rowid for ordinary tables, or the primary key of a WITHOUT ROWID table
+// with a single-column key. It returns "" for views and tables that can
+// only be paged by offset.
+func (s *Schema) KeyColumn(tableName string) string {
+	rows, err := s.conn.Query(fmt.Sprintf("SELECT rowid FROM %s LIMIT 0", quoteIdentifier(tableName)))
+	if err == nil {
+		rows.Close()
+		return "rowid"
+	}
+
+	columns, err := s.GetColumns(tableName)
+	if err != nil {
+		return ""
+	}
+	var key string
+	for _, col := range columns {
+		if col.PrimaryKey == 0 {
+			continue
+		}
+		if key != "" {
+			return "" // composite key
+		}
+		key = col.Name
+	}
+	return key
+}
+
 // TableExists checks if a table exists.
 func (s *Schema) TableExists(tableName string) (bool, error) {
 	var count int
@@ -0,0 +1,388 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Seed value kinds. A kind decides what kind of fake value a column gets.
+const (
+	SeedInt      = "int"
+	SeedReal     = "real"
+	SeedText     = "text"
+	SeedWords    = "words"
+	SeedName     = "name"
+	SeedEmail    = "email"
+	SeedBool     = "bool"
+	SeedDate     = "date"
+	SeedDatetime = "datetime"
+	SeedUUID     = "uuid"
+	SeedURL      = "url"
+	SeedPhone    = "phone"
+	SeedBlob     = "blob"
+	SeedSkip     = "skip" // leave the column to its default
+)
+
+// SeedKinds returns the supported seed kinds in sorted order.
+func SeedKinds() []string {
+	kinds := []string{
+		SeedInt, SeedReal, SeedText, SeedWords, SeedName, SeedEmail, SeedBool,
+		SeedDate, SeedDatetime, SeedUUID, SeedURL, SeedPhone, SeedBlob, SeedSkip,
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+// ErrInvalidSeedSpec is returned for unknown columns or kinds in a seed spec.
+var ErrInvalidSeedSpec = errors.New("invalid seed spec")
+
+// SeedOptions controls how fake rows are generated.
+type SeedOptions struct {
+	Rows int
+	Spec map[string]string // column name -> kind, overrides inference
+	Rand *rand.Rand        // nil uses a time-seeded source
+}
+
+var (
+	seedFirstNames = []string{"Ada", "Alan", "Alice", "Bob", "Carol", "Dave", "Eve", "Frank", "Grace",
+		"Heidi", "Ivan", "Judy", "Ken", "Linus", "Mallory", "Niklaus", "Olivia", "Peggy", "Rob", "Sybil"}
+	seedLastNames = []string{"Lovelace", "Turing", "Hopper", "Ritchie", "Thompson", "Torvalds", "Wirth",
+		"Liskov", "Knuth", "Dijkstra", "Hamilton", "Kernighan", "Pike", "Cerf", "Allen", "Backus"}
+	seedWords = []string{"lorem", "ipsum", "dolor", "sit", "amet", "consectetur", "adipiscing", "elit",
+		"sed", "do", "eiusmod", "tempor", "incididunt", "ut", "labore", "et", "dolore", "magna", "aliqua"}
+	seedDomains = []string{"example.com", "example.org", "example.net"}
+)
+
+// seedColumn describes how to fill one column.
+type seedColumn struct {
+	name    string
+	kind    string
+	notNull bool
+	unique  bool
+	refs    []any // allowed values for foreign key columns
+}
+
+// SeedTable inserts opts.Rows rows of generated data into a table in a
+// single transaction. Column kinds are inferred from names and declared
+// types unless overridden by opts.Spec. NOT NULL columns always get a
+// value, single-column UNIQUE constraints are respected, and foreign key
+// columns draw from the referenced table. Returns the number of rows
+// inserted.
+func SeedTable(conn *Connection, table string, opts SeedOptions) (int64, error) {
+	rnd := opts.Rand
+	if rnd == nil {
+		rnd = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+
+	columns, err := planSeedColumns(conn, table, opts.Spec)
+	if err != nil {
+		return 0, err
+	}
+	if len(columns) == 0 {
+		return 0, fmt.Errorf("%w: no columns to fill", ErrInvalidSeedSpec)
+	}
+
+	// Offset generated unique values past the rows already in the table
+	offset, err := NewSchema(conn).GetRowCount(table)
+	if err != nil {
+		return 0, err
+	}
+
+	names := make([]string, len(columns))
+	placeholders := make([]string, len(columns))
+	for i, c := range columns {
+		names[i] = quoteIdentifier(c.name)
+		placeholders[i] = "?"
+	}
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)",
+		quoteIdentifier(table), strings.Join(names, ", "), strings.Join(placeholders, ", "))
+
+	var inserted int64
+	err = conn.WithTransaction(func(tx *sql.Tx) error {
+		stmt, err := tx.Prepare(query)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+
+		values := make([]any, len(columns))
+		for row := 0; row < opts.Rows; row++ {
+			seq := offset + int64(row) + 1
+			for i, c := range columns {
+				values[i] = c.generate(rnd, seq)
+			}
+			if _, err := stmt.Exec(values...); err != nil {
+				return err
+			}
+			inserted++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return inserted, nil
+}
+
+// planSeedColumns decides which columns to fill and with what.
+func planSeedColumns(conn *Connection, table string, spec map[string]string) ([]*seedColumn, error) {
+	schema := NewSchema(conn)
+	cols, err := schema.GetColumns(table)
+	if err != nil {
+		return nil, err
+	}
+	if len(cols) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrTableNotFound, table)
+	}
+
+	known := make(map[string]bool, len(cols))
+	for _, c := range cols {
+		known[strings.ToLower(c.Name)] = true
+	}
+	lowerSpec := make(map[string]string, len(spec))
+	valid := make(map[string]bool)
+	for _, k := range SeedKinds() {
+		valid[k] = true
+	}
+	for col, kind := range spec {
+		if !known[strings.ToLower(col)] {
+			return nil, fmt.Errorf("%w: no such column: %s", ErrInvalidSeedSpec, col)
+		}
+		if !valid[kind] {
+			return nil, fmt.Errorf("%w: unknown kind %q for %s (use %s)",
+				ErrInvalidSeedSpec, kind, col, strings.Join(SeedKinds(), ", "))
+		}
+		lowerSpec[strings.ToLower(col)] = kind
+	}
+
+	indexes, err := schema.GetIndexes(table)
+	if err != nil {
+		return nil, err
+	}
+	unique := make(map[string]bool)
+	for _, idx := range indexes {
+		if idx.Unique && len(idx.Columns) == 1 {
+			unique[strings.ToLower(idx.Columns[0])] = true
+		}
+	}
+
+	fks, err := schema.GetForeignKeys(table)
+	if err != nil {
+		return nil, err
+	}
+	fkByColumn := make(map[string]ForeignKeyInfo, len(fks))
+	for _, fk := range fks {
+		fkByColumn[strings.ToLower(fk.From)] = fk
+	}
+
+	var pkCount int
+	for _, c := range cols {
+		if c.PrimaryKey > 0 {
+			pkCount++
+		}
+	}
+
+	var result []*seedColumn
+	for _, c := range cols {
+		if c.Generated != "" || c.Hidden {
+			continue // can't be inserted into
+		}
+		lower := strings.ToLower(c.Name)
+		kind, explicit := lowerSpec[lower]
+		if !explicit {
+			// An INTEGER PRIMARY KEY is the rowid and assigns itself
+			if pkCount == 1 && c.PrimaryKey > 0 && strings.EqualFold(c.Type, "INTEGER") {
+				continue
+			}
+			kind = inferSeedKind(c.Name, c.Type)
+		}
+		if kind == SeedSkip {
+			continue
+		}
+
+		col := &seedColumn{
+			name:    c.Name,
+			kind:    kind,
+			notNull: c.NotNull || c.PrimaryKey > 0,
+			unique:  unique[lower] || (pkCount == 1 && c.PrimaryKey > 0),
+		}
+
+		if fk, ok := fkByColumn[lower]; ok && !explicit {
+			refs, err := foreignKeyValues(conn, fk)
+			if err != nil {
+				return nil, err
+			}
+			if len(refs) == 0 && col.notNull {
+				return nil, fmt.Errorf("cannot seed %s: referenced table %s is empty", c.Name, fk.Table)
+			}
+			col.refs = refs
+		}
+
+		result = append(result, col)
+	}
+	return result, nil
+}
+
+// foreignKeyValues returns up to 10000 existing values of the referenced column.
+func foreignKeyValues(conn *Connection, fk ForeignKeyInfo) ([]any, error) {
+	to := "rowid"
+	if fk.To != "" {
+		to = quoteIdentifier(fk.To)
+	}
+	rows, err := conn.Query(fmt.Sprintf("SELECT DISTINCT %s FROM %s WHERE %s IS NOT NULL LIMIT 10000",
+		to, quoteIdentifier(fk.Table), to))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var values []any
+	for rows.Next() {
+		var v any
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, rows.Err()
+}
+
+// inferSeedKind guesses a kind from a column's name, then its declared type
+// using SQLite's type affinity rules.
+func inferSeedKind(name, declType string) string {
+	n := strings.ToLower(name)
+	switch {
+	case strings.Contains(n, "email"):
+		return SeedEmail
+	case strings.Contains(n, "uuid"), strings.Contains(n, "guid"):
+		return SeedUUID
+	case strings.Contains(n, "url"), strings.Contains(n, "website"):
+		return SeedURL
+	case strings.Contains(n, "phone"):
+		return SeedPhone
+	case n == "name", strings.HasSuffix(n, "_name"), strings.HasSuffix(n, "name") && len(n) > 4:
+		return SeedName
+	case strings.HasSuffix(n, "_at"), strings.Contains(n, "time"), strings.Contains(n, "created"),
+		strings.Contains(n, "updated"):
+		return SeedDatetime
+	case strings.Contains(n, "date"), strings.HasSuffix(n, "_on"):
+		return SeedDate
+	case strings.HasPrefix(n, "is_"), strings.HasPrefix(n, "has_"), n == "active", n == "enabled",
+		n == "published", n == "deleted":
+		return SeedBool
+	case n == "title", n == "subject", n == "label":
+		return SeedWords
+	}
+
+	t := strings.ToUpper(declType)
+	switch {
+	case strings.Contains(t, "INT"):
+		return SeedInt
+	case strings.Contains(t, "CHAR"), strings.Contains(t, "CLOB"), strings.Contains(t, "TEXT"):
+		return SeedText
+	case strings.Contains(t, "BLOB"):
+		return SeedBlob
+	case strings.Contains(t, "REAL"), strings.Contains(t, "FLOA"), strings.Contains(t, "DOUB"):
+		return SeedReal
+	case strings.Contains(t, "BOOL"):
+		return SeedBool
+	case strings.Contains(t, "DATE"), strings.Contains(t, "TIME"):
+		return SeedDatetime
+	case t == "":
+		return SeedText
+	default:
+		return SeedInt
+	}
+}
+
+// generate returns a fake value for the column. seq is a per-table
+// sequence number used to keep unique columns unique.
+func (c *seedColumn) generate(rnd *rand.Rand, seq int64) any {
+	if c.refs != nil {
+		if len(c.refs) == 0 {
+			return nil
+		}
+		return c.refs[rnd.Intn(len(c.refs))]
+	}
+	// Leave some nullable columns empty so the data looks realistic
+	if !c.notNull && !c.unique && rnd.Intn(10) == 0 {
+		return nil
+	}
+
+	first := seedFirstNames[rnd.Intn(len(seedFirstNames))]
+	last := seedLastNames[rnd.Intn(len(seedLastNames))]
+
+	switch c.kind {
+	case SeedInt:
+		if c.unique {
+			return seq
+		}
+		return rnd.Int63n(1000)
+	case SeedReal:
+		return float64(rnd.Int63n(100000)) / 100
+	case SeedWords:
+		return capitalize(seedSentence(rnd, 2+rnd.Intn(4)))
+	case SeedText:
+		s := capitalize(seedSentence(rnd, 5+rnd.Intn(10))) + "."
+		if c.unique {
+			s = fmt.Sprintf("%s #%d", s, seq)
+		}
+		return s
+	case SeedName:
+		if c.unique {
+			return fmt.Sprintf("%s %s %d", first, last, seq)
+		}
+		return first + " " + last
+	case SeedEmail:
+		domain := seedDomains[rnd.Intn(len(seedDomains))]
+		return fmt.Sprintf("%s.%s%d@%s", strings.ToLower(first), strings.ToLower(last), seq, domain)
+	case SeedBool:
+		return rnd.Intn(2)
+	case SeedDate:
+		return seedTime(rnd).Format("2006-01-02")
+	case SeedDatetime:
+		return seedTime(rnd).Format("2006-01-02 15:04:05")
+	case SeedUUID:
+		b := make([]byte, 16)
+		rnd.Read(b)
+		b[6] = b[6]&0x0f | 0x40
+		b[8] = b[8]&0x3f | 0x80
+		return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+	case SeedURL:
+		return fmt.Sprintf("https://%s/%s/%d", seedDomains[rnd.Intn(len(seedDomains))],
+			seedWords[rnd.Intn(len(seedWords))], seq)
+	case SeedPhone:
+		return fmt.Sprintf("+1-555-%03d-%04d", rnd.Intn(1000), rnd.Intn(10000))
+	case SeedBlob:
+		b := make([]byte, 16)
+		rnd.Read(b)
+		return b
+	}
+	return nil
+}
+
+// seedTime returns a random time within the last three years.
+func seedTime(rnd *rand.Rand) time.Time {
+	span := int64(3 * 365 * 24 * time.Hour / time.Second)
+	return time.Now().UTC().Add(-time.Duration(rnd.Int63n(span)) * time.Second).Truncate(time.Second)
+}
+
+func seedSentence(rnd *rand.Rand, n int) string {
+	words := make([]string, n)
+	for i := range words {
+		words[i] = seedWords[rnd.Intn(len(seedWords))]
+	}
+	return strings.Join(words, " ")
+}
+
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
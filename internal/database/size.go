@@ -0,0 +1,167 @@
+package database
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// ObjectSize is the on-disk size of a table or index.
+type ObjectSize struct {
+	Name  string
+	Type  string // "table" or "index"
+	Table string // table an index belongs to; a table's own name
+	Pages int64
+	Bytes int64
+}
+
+// SizeReport breaks a database's size down by table and index.
+type SizeReport struct {
+	PageSize      int64
+	PageCount     int64
+	FreelistCount int64
+	Estimated     bool          // dbstat was unavailable, sizes are estimates
+	Objects       []*ObjectSize // by name
+}
+
+// TotalBytes returns the size of the database, not counting the WAL.
+func (r *SizeReport) TotalBytes() int64 {
+	return r.PageSize * r.PageCount
+}
+
+// Largest returns the n largest objects, largest first.
+func (r *SizeReport) Largest(n int) []*ObjectSize {
+	objects := slices.Clone(r.Objects)
+	slices.SortStableFunc(objects, func(a, b *ObjectSize) int {
+		return cmp.Compare(b.Bytes, a.Bytes)
+	})
+	return objects[:min(n, len(objects))]
+}
+
+// MeasureSizes reports the pages and bytes each table and index takes up,
+// from the dbstat virtual table. dbstat is an optional compile-time feature
+// of SQLite; without it sizes are estimated from the payload length of each
+// row, using the columns PRAGMA table_info and index_info list.
+func MeasureSizes(ctx context.Context, conn *Connection) (*SizeReport, error) {
+	meta, err := NewSchema(conn).DatabaseInfo()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read database info: %w", err)
+	}
+	report := &SizeReport{PageSize: meta.PageSize, PageCount: meta.PageCount, FreelistCount: meta.FreelistCount}
+
+	objects, err := listSizeObjects(ctx, conn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list objects: %w", err)
+	}
+	if err := sizesFromDBStat(ctx, conn, objects); err != nil {
+		report.Estimated = true
+		estimateSizes(conn, objects, meta.PageSize)
+	}
+
+	for _, obj := range objects {
+		report.Objects = append(report.Objects, obj)
+	}
+	slices.SortFunc(report.Objects, func(a, b *ObjectSize) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return report, nil
+}
+
+// listSizeObjects returns all tables and indexes keyed by name.
+func listSizeObjects(ctx context.Context, conn *Connection) (map[string]*ObjectSize, error) {
+	rows, err := conn.QueryContext(ctx, `
+		SELECT name, type, tbl_name FROM sqlite_master
+		WHERE type IN ('table', 'index')
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	objects := make(map[string]*ObjectSize)
+	for rows.Next() {
+		obj := &ObjectSize{}
+		if err := rows.Scan(&obj.Name, &obj.Type, &obj.Table); err != nil {
+			return nil, err
+		}
+		objects[obj.Name] = obj
+	}
+	return objects, rows.Err()
+}
+
+// sizesFromDBStat fills in exact sizes using the dbstat virtual table.
+func sizesFromDBStat(ctx context.Context, conn *Connection, objects map[string]*ObjectSize) error {
+	rows, err := conn.QueryContext(ctx, "SELECT name, COUNT(*), SUM(pgsize) FROM dbstat GROUP BY name")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		var pages, bytes int64
+		if err := rows.Scan(&name, &pages, &bytes); err != nil {
+			return err
+		}
+		obj, ok := objects[name]
+		if !ok {
+			// The schema table itself is not listed in sqlite_master
+			obj = &ObjectSize{Name: name, Type: "table", Table: name}
+			objects[name] = obj
+		}
+		obj.Pages = pages
+		obj.Bytes = bytes
+	}
+	return rows.Err()
+}
+
+// estimateSizes approximates sizes from the payload length of each row.
+// Errors are ignored; objects that cannot be measured are left at zero.
+func estimateSizes(conn *Connection, objects map[string]*ObjectSize, pageSize int64) {
+	schema := NewSchema(conn)
+
+	for _, obj := range objects {
+		var columns []string
+		switch obj.Type {
+		case "table":
+			cols, err := schema.GetColumns(obj.Name)
+			if err != nil {
+				continue
+			}
+			for _, c := range cols {
+				columns = append(columns, c.Name)
+			}
+		case "index":
+			indexes, err := schema.GetIndexes(obj.Table)
+			if err != nil {
+				continue
+			}
+			for _, idx := range indexes {
+				if idx.Name == obj.Name {
+					columns = idx.Columns
+				}
+			}
+		}
+		if len(columns) == 0 {
+			continue
+		}
+
+		lengths := make([]string, len(columns))
+		for i, c := range columns {
+			lengths[i] = fmt.Sprintf("COALESCE(length(%s), 0)", quoteIdentifier(c))
+		}
+		query := fmt.Sprintf("SELECT COALESCE(SUM(%s), 0) FROM %s",
+			strings.Join(lengths, " + "), quoteIdentifier(obj.Table))
+
+		var bytes int64
+		if err := conn.QueryRow(query).Scan(&bytes); err != nil {
+			continue
+		}
+		obj.Bytes = bytes
+		if pageSize > 0 {
+			obj.Pages = (bytes + pageSize - 1) / pageSize
+		}
+	}
+}
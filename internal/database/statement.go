@@ -0,0 +1,585 @@
+package database
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Statement describes what a SQL statement does, as far as access checks,
+// locking and auditing need to know. It comes from the statement's tokens,
+// not a full parse, so it errs towards treating statements as writes.
+type Statement struct {
+	// Type is the statement's verb in upper case, e.g. SELECT or INSERT.
+	// A WITH clause is skipped, so WITH ... DELETE is a DELETE.
+	Type string
+	// Tables are the tables the statement writes, or those it reads for
+	// queries, as written, e.g. main.users.
+	Tables []string
+	// HasWhere reports a WHERE clause on the statement itself, not in a
+	// subquery.
+	HasWhere bool
+
+	// pragmaSets marks a PRAGMA that changes a setting.
+	pragmaSets bool
+}
+
+// ReadOnly reports whether the statement only reads.
+func (s Statement) ReadOnly() bool {
+	switch s.Type {
+	case "SELECT", "VALUES", "EXPLAIN":
+		return true
+	case "PRAGMA":
+		return !s.pragmaSets
+	}
+	return false
+}
+
+// Statements are the statements of a query, in order.
+type Statements []Statement
+
+// ClassifySQL splits a query into statements and classifies each one.
+func ClassifySQL(query string) Statements {
+	var stmts Statements
+	for _, toks := range splitStatements(tokenize(query)) {
+		stmts = append(stmts, classify(toks))
+	}
+	return stmts
+}
+
+// IsReadOnlyQuery reports whether every statement of a query only reads.
+// An empty query is not read-only.
+func IsReadOnlyQuery(query string) bool {
+	return ClassifySQL(query).ReadOnly()
+}
+
+// PageQuery returns a query limited to limit rows from offset, for paging
+// through the result of a single SELECT without a LIMIT of its own. It
+// reports false for any other query, which has to run as it is.
+func PageQuery(query string, limit, offset int) (string, bool) {
+	toks := tokenize(query)
+	stmts := splitStatements(toks)
+	if len(stmts) != 1 || classify(stmts[0]).Type != "SELECT" {
+		return "", false
+	}
+
+	depth := 0
+	for _, t := range stmts[0] {
+		switch {
+		case t.is("("):
+			depth++
+		case t.is(")"):
+			depth--
+		case depth == 0 && t.isWord("LIMIT"):
+			return "", false
+		}
+	}
+
+	// Cut the semicolons after the statement; a new line ends a comment
+	// it may finish with
+	end := len(query)
+	last := stmts[0][len(stmts[0])-1]
+	for _, t := range toks {
+		if t.is(";") && t.pos > last.pos {
+			end = t.pos
+			break
+		}
+	}
+	return fmt.Sprintf("%s\nLIMIT %d OFFSET %d", query[:end], limit, offset), true
+}
+
+// ReadOnly reports whether there are statements and all of them only read.
+func (ss Statements) ReadOnly() bool {
+	if len(ss) == 0 {
+		return false
+	}
+	for _, s := range ss {
+		if !s.ReadOnly() {
+			return false
+		}
+	}
+	return true
+}
+
+// Queries reports whether there are statements and all of them are
+// queries, which unlike PRAGMAs run the same on any connection.
+func (ss Statements) Queries() bool {
+	if len(ss) == 0 {
+		return false
+	}
+	for _, s := range ss {
+		switch s.Type {
+		case "SELECT", "VALUES", "EXPLAIN":
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// Types returns the statements' types, without repeats.
+func (ss Statements) Types() []string {
+	var types []string
+	for _, s := range ss {
+		if !slices.Contains(types, s.Type) {
+			types = append(types, s.Type)
+		}
+	}
+	return types
+}
+
+// Tables returns the tables of all statements, without repeats.
+func (ss Statements) Tables() []string {
+	var tables []string
+	for _, s := range ss {
+		for _, t := range s.Tables {
+			if !slices.Contains(tables, t) {
+				tables = append(tables, t)
+			}
+		}
+	}
+	return tables
+}
+
+// readPragmas are the pragmas that take an argument in parentheses yet
+// only read; an argument to any other pragma sets it.
+var readPragmas = map[string]bool{
+	"TABLE_INFO": true, "TABLE_XINFO": true, "TABLE_LIST": true,
+	"INDEX_INFO": true, "INDEX_XINFO": true, "INDEX_LIST": true,
+	"FOREIGN_KEY_LIST": true, "FOREIGN_KEY_CHECK": true,
+	"INTEGRITY_CHECK": true, "QUICK_CHECK": true,
+}
+
+// writePragmas are the pragmas that change the database even without an
+// argument.
+var writePragmas = map[string]bool{
+	"OPTIMIZE": true, "WAL_CHECKPOINT": true, "INCREMENTAL_VACUUM": true,
+}
+
+// classify classifies the tokens of one statement.
+func classify(toks []token) Statement {
+	p := &stmtParser{toks: toks}
+	ctes := p.skipWith()
+
+	var s Statement
+	verb := p.next()
+	if verb.kind != tokWord {
+		return s
+	}
+	s.Type = strings.ToUpper(verb.text)
+
+	switch s.Type {
+	case "SELECT", "VALUES":
+		s.Tables = readTables(toks, ctes)
+	case "INSERT", "REPLACE":
+		p.skipConflict()
+		p.skipWord("INTO")
+		s.Tables = p.nameList()
+	case "UPDATE":
+		p.skipConflict()
+		s.Tables = p.nameList()
+	case "DELETE":
+		p.skipWord("FROM")
+		s.Tables = p.nameList()
+	case "CREATE":
+		p.skipWord("TEMP", "TEMPORARY", "UNIQUE", "VIRTUAL")
+		kind := strings.ToUpper(p.next().text)
+		p.skipWord("IF")
+		p.skipWord("NOT")
+		p.skipWord("EXISTS")
+		s.Tables = p.nameList()
+		if kind == "INDEX" || kind == "TRIGGER" {
+			// The table it is on
+			s.Tables = nil
+			if p.seek("ON") {
+				s.Tables = p.nameList()
+			}
+		}
+	case "DROP":
+		kind := strings.ToUpper(p.next().text)
+		p.skipWord("IF")
+		p.skipWord("EXISTS")
+		if kind == "TABLE" || kind == "VIEW" {
+			s.Tables = p.nameList()
+		}
+	case "ALTER":
+		p.skipWord("TABLE")
+		s.Tables = p.nameList()
+	case "PRAGMA":
+		name := p.name()
+		if i := strings.LastIndexByte(name, '.'); i >= 0 {
+			name = name[i+1:]
+		}
+		switch t := p.next(); {
+		case writePragmas[strings.ToUpper(name)], t.is("="):
+			s.pragmaSets = true
+		case t.is("("):
+			s.pragmaSets = !readPragmas[strings.ToUpper(name)]
+		}
+	}
+
+	// Only a WHERE outside parentheses belongs to the statement itself
+	depth := 0
+	for _, t := range toks[p.verbAt:] {
+		switch {
+		case t.is("("):
+			depth++
+		case t.is(")"):
+			depth--
+		case depth == 0 && t.isWord("WHERE"):
+			s.HasWhere = true
+		}
+	}
+	return s
+}
+
+// clauseWords end a table reference; any other word after a table name is
+// its alias.
+var clauseWords = map[string]bool{
+	"WHERE": true, "GROUP": true, "ORDER": true, "LIMIT": true, "HAVING": true,
+	"WINDOW": true, "UNION": true, "EXCEPT": true, "INTERSECT": true,
+	"JOIN": true, "LEFT": true, "RIGHT": true, "FULL": true, "INNER": true,
+	"OUTER": true, "CROSS": true, "NATURAL": true, "ON": true, "USING": true,
+	"INDEXED": true, "NOT": true, "SET": true, "RETURNING": true,
+	"DEFAULT": true, "VALUES": true, "SELECT": true,
+}
+
+// readTables returns the tables named after FROM and JOIN anywhere in a
+// statement, leaving out CTEs and table-valued functions.
+func readTables(toks []token, ctes []string) []string {
+	var tables []string
+	add := func(name string) {
+		if !slices.Contains(tables, name) && !slices.ContainsFunc(ctes, func(c string) bool {
+			return strings.EqualFold(c, name)
+		}) {
+			tables = append(tables, name)
+		}
+	}
+
+	for i, t := range toks {
+		if !t.isWord("FROM") && !t.isWord("JOIN") {
+			continue
+		}
+		p := &stmtParser{toks: toks, pos: i + 1}
+		for p.peek().isName() {
+			name := p.name()
+			if p.peek().is("(") {
+				break // table-valued function
+			}
+			add(name)
+
+			// Skip the alias; a comma continues a FROM list
+			if p.skipWord("AS") || p.peek().kind != tokWord || !clauseWords[strings.ToUpper(p.peek().text)] {
+				if p.peek().isName() {
+					p.next()
+				}
+			}
+			if !p.peek().is(",") {
+				break
+			}
+			p.next()
+		}
+	}
+	return tables
+}
+
+// stmtParser walks the tokens of a statement.
+type stmtParser struct {
+	toks   []token
+	pos    int
+	verbAt int // index of the statement's verb
+}
+
+// peek returns the next token without consuming it, or an empty token at
+// the end.
+func (p *stmtParser) peek() token {
+	if p.pos >= len(p.toks) {
+		return token{kind: tokEnd}
+	}
+	return p.toks[p.pos]
+}
+
+// next consumes and returns the next token.
+func (p *stmtParser) next() token {
+	t := p.peek()
+	if p.pos < len(p.toks) {
+		p.pos++
+	}
+	return t
+}
+
+// skipWord consumes the next token if it is one of words.
+func (p *stmtParser) skipWord(words ...string) bool {
+	for _, w := range words {
+		if p.peek().isWord(w) {
+			p.pos++
+			return true
+		}
+	}
+	return false
+}
+
+// skipGroup consumes a parenthesized group, if one is next.
+func (p *stmtParser) skipGroup() {
+	if !p.peek().is("(") {
+		return
+	}
+	depth := 0
+	for p.pos < len(p.toks) {
+		t := p.next()
+		switch {
+		case t.is("("):
+			depth++
+		case t.is(")"):
+			depth--
+			if depth == 0 {
+				return
+			}
+		}
+	}
+}
+
+// seek consumes tokens up to and including the word w at the top level,
+// reporting whether it was found.
+func (p *stmtParser) seek(w string) bool {
+	for p.pos < len(p.toks) {
+		if p.peek().is("(") {
+			p.skipGroup()
+			continue
+		}
+		if p.next().isWord(w) {
+			return true
+		}
+	}
+	return false
+}
+
+// skipWith consumes a WITH clause and returns the names of its CTEs. It
+// leaves the parser at the statement's verb.
+func (p *stmtParser) skipWith() []string {
+	defer func() { p.verbAt = p.pos }()
+	if !p.skipWord("WITH") {
+		return nil
+	}
+	p.skipWord("RECURSIVE")
+
+	var ctes []string
+	for p.peek().isName() {
+		ctes = append(ctes, p.next().text)
+		p.skipGroup() // column names
+		p.skipWord("AS")
+		p.skipWord("NOT")
+		p.skipWord("MATERIALIZED")
+		p.skipGroup()
+		if !p.peek().is(",") {
+			break
+		}
+		p.next()
+	}
+	return ctes
+}
+
+// skipConflict consumes an OR <resolution> clause, as in INSERT OR IGNORE.
+func (p *stmtParser) skipConflict() {
+	if p.skipWord("OR") {
+		p.next()
+	}
+}
+
+// name consumes a possibly schema-qualified name, returning it with its
+// parts joined by dots.
+func (p *stmtParser) name() string {
+	if !p.peek().isName() {
+		return ""
+	}
+	name := p.next().text
+	for p.peek().is(".") {
+		p.next()
+		if !p.peek().isName() {
+			break
+		}
+		name += "." + p.next().text
+	}
+	return name
+}
+
+// nameList returns the next name as a one-element list, or nil if there
+// isn't one.
+func (p *stmtParser) nameList() []string {
+	if name := p.name(); name != "" {
+		return []string{name}
+	}
+	return nil
+}
+
+// splitStatements splits tokens at semicolons, dropping empty statements.
+// Semicolons inside a trigger's BEGIN ... END body don't end it.
+func splitStatements(toks []token) [][]token {
+	var stmts [][]token
+	start := 0
+	inBody, cases := false, 0
+	for i, t := range toks {
+		switch {
+		case t.isWord("BEGIN") && isCreateTrigger(toks[start:i]):
+			inBody = true
+		case inBody && t.isWord("CASE"):
+			cases++
+		case inBody && t.isWord("END"):
+			if cases > 0 {
+				cases--
+			} else {
+				inBody = false
+			}
+		case t.is(";") && !inBody:
+			if i > start {
+				stmts = append(stmts, toks[start:i])
+			}
+			start = i + 1
+		}
+	}
+	if start < len(toks) {
+		stmts = append(stmts, toks[start:])
+	}
+	return stmts
+}
+
+// isCreateTrigger reports whether tokens start a CREATE TRIGGER statement.
+func isCreateTrigger(toks []token) bool {
+	if len(toks) < 2 || !toks[0].isWord("CREATE") {
+		return false
+	}
+	if toks[1].isWord("TEMP") || toks[1].isWord("TEMPORARY") {
+		return len(toks) > 2 && toks[2].isWord("TRIGGER")
+	}
+	return toks[1].isWord("TRIGGER")
+}
+
+type tokenKind int
+
+const (
+	tokEnd    tokenKind = iota
+	tokWord             // keyword or bare identifier
+	tokQuoted           // quoted identifier, unquoted
+	tokString           // string literal
+	tokNumber
+	tokParam // bound parameter, e.g. ?1 or :name
+	tokPunct // any other character
+)
+
+// token is a lexical token of SQL.
+type token struct {
+	kind tokenKind
+	text string
+	pos  int // byte offset in the SQL
+}
+
+// is reports whether t is the punctuation p.
+func (t token) is(p string) bool {
+	return t.kind == tokPunct && t.text == p
+}
+
+// isWord reports whether t is the keyword w, in any case.
+func (t token) isWord(w string) bool {
+	return t.kind == tokWord && strings.EqualFold(t.text, w)
+}
+
+// isName reports whether t can name a table. SQLite accepts string
+// literals as names too.
+func (t token) isName() bool {
+	return t.kind == tokWord || t.kind == tokQuoted || t.kind == tokString
+}
+
+// tokenize splits SQL into tokens, dropping whitespace and comments.
+func tokenize(sql string) []token {
+	var toks []token
+	for i := 0; i < len(sql); {
+		c := sql[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f':
+			i++
+		case c == '-' && strings.HasPrefix(sql[i:], "--"):
+			end := strings.IndexByte(sql[i:], '\n')
+			if end < 0 {
+				return toks
+			}
+			i += end + 1
+		case c == '/' && strings.HasPrefix(sql[i:], "/*"):
+			end := strings.Index(sql[i+2:], "*/")
+			if end < 0 {
+				return toks
+			}
+			i += end + 4
+		case c == '\'':
+			text, n := scanQuoted(sql[i:], '\'')
+			toks = append(toks, token{tokString, text, i})
+			i += n
+		case c == '"' || c == '`':
+			text, n := scanQuoted(sql[i:], c)
+			toks = append(toks, token{tokQuoted, text, i})
+			i += n
+		case c == '[':
+			end := strings.IndexByte(sql[i:], ']')
+			if end < 0 {
+				end = len(sql) - i - 1
+			}
+			toks = append(toks, token{tokQuoted, sql[i+1 : i+end], i})
+			i += end + 1
+		case isDigit(c) || c == '.' && i+1 < len(sql) && isDigit(sql[i+1]):
+			j := i + 1
+			for j < len(sql) && (isIdentChar(sql[j]) || sql[j] == '.' ||
+				(sql[j] == '+' || sql[j] == '-') && (sql[j-1] == 'e' || sql[j-1] == 'E')) {
+				j++
+			}
+			toks = append(toks, token{tokNumber, sql[i:j], i})
+			i = j
+		case isIdentChar(c):
+			j := i + 1
+			for j < len(sql) && (isIdentChar(sql[j]) || isDigit(sql[j])) {
+				j++
+			}
+			toks = append(toks, token{tokWord, sql[i:j], i})
+			i = j
+		case c == '?' || c == ':' || c == '@' || c == '$':
+			j := i + 1
+			for j < len(sql) && (isIdentChar(sql[j]) || isDigit(sql[j])) {
+				j++
+			}
+			toks = append(toks, token{tokParam, sql[i:j], i})
+			i = j
+		default:
+			toks = append(toks, token{tokPunct, string(c), i})
+			i++
+		}
+	}
+	return toks
+}
+
+// scanQuoted scans a quoted string at the start of s, where a doubled
+// quote stands for itself. It returns the unquoted text and the length
+// consumed.
+func scanQuoted(s string, quote byte) (string, int) {
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		if s[i] != quote {
+			b.WriteByte(s[i])
+			continue
+		}
+		if i+1 < len(s) && s[i+1] == quote {
+			b.WriteByte(quote)
+			i++
+			continue
+		}
+		return b.String(), i + 1
+	}
+	return b.String(), len(s)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// isIdentChar reports whether c can start an identifier. Bytes of
+// multi-byte UTF-8 characters count as letters, as in SQLite.
+func isIdentChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_' || c >= 0x80
+}
@@ -0,0 +1,101 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/johan-st/sqlite-tui/internal/access"
+	"github.com/johan-st/sqlite-tui/internal/totp"
+)
+
+// ErrTOTPInvalid is returned for a wrong, expired or already used TOTP code.
+var ErrTOTPInvalid = fmt.Errorf("%w: invalid or reused TOTP code", ErrAccessDenied)
+
+// ErrTOTPRequired is returned for a destructive query run without a TOTP
+// code by a user enrolled in TOTP.
+var ErrTOTPRequired = fmt.Errorf("%w: DROP and DELETE need a TOTP code", ErrAccessDenied)
+
+// IsDestructiveQuery reports whether a statement of a query drops or
+// deletes, and so needs a TOTP code from users enrolled in TOTP. Words in
+// strings, comments and names don't count.
+func IsDestructiveQuery(query string) bool {
+	for _, s := range ClassifySQL(query) {
+		if s.Type == "DROP" || s.Type == "DELETE" {
+			return true
+		}
+	}
+	return false
+}
+
+type totpKey struct{}
+
+// totpGrant is the TOTP code carried by a context, see WithTOTP.
+type totpGrant struct {
+	mu       sync.Mutex
+	code     string
+	verified bool
+}
+
+// WithTOTP returns a context carrying a TOTP code for the destructive
+// queries run with it. The first such query checks the code, which then
+// covers the rest.
+func WithTOTP(ctx context.Context, code string) context.Context {
+	return context.WithValue(ctx, totpKey{}, &totpGrant{code: code})
+}
+
+// WithTOTPVerified returns a context for the queries of a command whose
+// TOTP code the caller has already checked with VerifyTOTP. Each code is
+// accepted once, so the queries can't check it again.
+func WithTOTPVerified(ctx context.Context) context.Context {
+	return context.WithValue(ctx, totpKey{}, &totpGrant{verified: true})
+}
+
+// checkTOTP refuses a destructive query by a user enrolled in TOTP unless
+// ctx carries a valid code.
+func (m *Manager) checkTOTP(ctx context.Context, user *access.UserInfo, query string) error {
+	if m.TOTPSecret(user) == "" || !IsDestructiveQuery(query) {
+		return nil
+	}
+	grant, _ := ctx.Value(totpKey{}).(*totpGrant)
+	if grant == nil {
+		return ErrTOTPRequired
+	}
+
+	grant.mu.Lock()
+	defer grant.mu.Unlock()
+	if grant.verified {
+		return nil
+	}
+	if grant.code == "" {
+		return ErrTOTPRequired
+	}
+	if err := m.VerifyTOTP(user, grant.code); err != nil {
+		return err
+	}
+	grant.verified = true
+	return nil
+}
+
+// VerifyTOTP checks a TOTP code for a user enrolled in TOTP. Each code is
+// accepted once.
+func (m *Manager) VerifyTOTP(user *access.UserInfo, code string) error {
+	secret := m.TOTPSecret(user)
+	if secret == "" {
+		return nil
+	}
+
+	step, ok := totp.Verify(secret, code, time.Now())
+	if !ok {
+		return ErrTOTPInvalid
+	}
+
+	m.totpMu.Lock()
+	defer m.totpMu.Unlock()
+	if step <= m.totpUsed[user.Name] {
+		return ErrTOTPInvalid
+	}
+	m.totpUsed[user.Name] = step
+	return nil
+}
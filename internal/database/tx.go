@@ -0,0 +1,301 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/johan-st/sqlite-tui/internal/access"
+)
+
+// Errors returned by the session transaction API.
+var (
+	// ErrNoTransaction is returned when a session has no open transaction.
+	ErrNoTransaction = errors.New("no transaction in progress")
+	// ErrInTransaction is returned when a session already has one open.
+	ErrInTransaction = errors.New("transaction already in progress")
+	// ErrNoSavepoint is returned for a savepoint the transaction lacks.
+	ErrNoSavepoint = errors.New("no such savepoint")
+)
+
+// sessionTx is a transaction a session keeps open across queries. It holds
+// the database's write lock and its writer connection until it ends.
+type sessionTx struct {
+	db      *DiscoveredDatabase
+	conn    *Connection // bound to tx
+	tx      *sql.Tx
+	user    *access.UserInfo
+	started time.Time
+	unlock  func()
+	writes  []txWrite // fired as write hooks on commit
+
+	// Open savepoints, innermost last
+	savepoints []savepoint
+}
+
+// savepoint is a named point in a session transaction to roll back to.
+type savepoint struct {
+	name   string
+	writes int // len(writes) when it was set
+}
+
+// txWrite is a write query run in a session transaction.
+type txWrite struct {
+	query  string
+	result *QueryResult
+}
+
+// TxInfo describes a session's open transaction.
+type TxInfo struct {
+	Database   string // path
+	Alias      string
+	Started    time.Time
+	Writes     int
+	Savepoints []string // innermost last
+}
+
+// BeginTx starts a transaction for a session on a database. Until it is
+// committed or rolled back, the session's queries on that database run in
+// it and the session holds the write lock, following the database's lock
+// policy. The transaction keeps the writer connection to itself, so it
+// takes the lock under the "none" policy too, failing at once when it is
+// held. Ending the session rolls it back.
+func (m *Manager) BeginTx(pathOrAlias string, user *access.UserInfo, sessionID string) error {
+	if sessionID == "" {
+		return fmt.Errorf("transactions need a session")
+	}
+	db := m.discovery.GetDatabase(pathOrAlias)
+	if db == nil {
+		return fmt.Errorf("%w: %s", ErrDatabaseNotFound, pathOrAlias)
+	}
+	if !m.GetAccessLevel(user, pathOrAlias).CanWrite() {
+		return fmt.Errorf("%w: write permission required", ErrAccessDenied)
+	}
+
+	if cur := m.Tx(sessionID); cur != nil {
+		return fmt.Errorf("%w on %s", ErrInTransaction, cur.Alias)
+	}
+
+	conn, err := m.OpenConnection(pathOrAlias, user)
+	if err != nil {
+		return err
+	}
+	unlock, err := m.lockForWrite(context.Background(), db, nil, user.DisplayName(), sessionID, false)
+	if err != nil {
+		return err
+	}
+	tx, err := conn.Begin()
+	if err != nil {
+		unlock()
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	m.txMu.Lock()
+	defer m.txMu.Unlock()
+	if _, ok := m.txs[sessionID]; ok {
+		// Lost a race with a concurrent begin by the same session
+		tx.Rollback()
+		return ErrInTransaction
+	}
+	m.txs[sessionID] = &sessionTx{
+		db:      db,
+		conn:    conn.inTx(tx),
+		tx:      tx,
+		user:    user,
+		started: time.Now(),
+		unlock:  unlock,
+	}
+	return nil
+}
+
+// CommitTx commits a session's transaction and releases its write lock.
+func (m *Manager) CommitTx(sessionID string) error {
+	stx, err := m.takeTx(sessionID)
+	if err != nil {
+		return err
+	}
+	defer stx.unlock()
+
+	if err := stx.tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit: %w", err)
+	}
+	for _, w := range stx.writes {
+		m.fireWrite(stx.db.Path, stx.user, sessionID, w.query, w.result)
+	}
+	return nil
+}
+
+// RollbackTx rolls back a session's transaction and releases its write
+// lock.
+func (m *Manager) RollbackTx(sessionID string) error {
+	stx, err := m.takeTx(sessionID)
+	if err != nil {
+		return err
+	}
+	defer stx.unlock()
+
+	if err := stx.tx.Rollback(); err != nil {
+		return fmt.Errorf("failed to roll back: %w", err)
+	}
+	return nil
+}
+
+// takeTx removes and returns a session's transaction.
+func (m *Manager) takeTx(sessionID string) (*sessionTx, error) {
+	m.txMu.Lock()
+	defer m.txMu.Unlock()
+
+	stx, ok := m.txs[sessionID]
+	if !ok {
+		return nil, ErrNoTransaction
+	}
+	delete(m.txs, sessionID)
+	return stx, nil
+}
+
+// Tx describes a session's open transaction, or returns nil.
+func (m *Manager) Tx(sessionID string) *TxInfo {
+	m.txMu.Lock()
+	defer m.txMu.Unlock()
+
+	stx, ok := m.txs[sessionID]
+	if !ok {
+		return nil
+	}
+	info := &TxInfo{
+		Database: stx.db.Path,
+		Alias:    stx.db.Alias,
+		Started:  stx.started,
+		Writes:   len(stx.writes),
+	}
+	for _, sp := range stx.savepoints {
+		info.Savepoints = append(info.Savepoints, sp.name)
+	}
+	return info
+}
+
+// Savepoint sets a named savepoint in a session's transaction. Rolling back
+// to it undoes later work without abandoning the transaction. Names may be
+// reused; the innermost savepoint of a name wins.
+func (m *Manager) Savepoint(sessionID, name string) error {
+	m.txMu.Lock()
+	defer m.txMu.Unlock()
+
+	stx, ok := m.txs[sessionID]
+	if !ok {
+		return ErrNoTransaction
+	}
+	if _, err := stx.tx.Exec("SAVEPOINT " + quoteIdentifier(name)); err != nil {
+		return fmt.Errorf("failed to set savepoint: %w", err)
+	}
+	stx.savepoints = append(stx.savepoints, savepoint{name: name, writes: len(stx.writes)})
+	return nil
+}
+
+// ReleaseSavepoint keeps the work done since a savepoint and forgets it,
+// along with the savepoints set after it.
+func (m *Manager) ReleaseSavepoint(sessionID, name string) error {
+	m.txMu.Lock()
+	defer m.txMu.Unlock()
+
+	stx, i, err := m.findSavepoint(sessionID, name)
+	if err != nil {
+		return err
+	}
+	if _, err := stx.tx.Exec("RELEASE " + quoteIdentifier(name)); err != nil {
+		return fmt.Errorf("failed to release savepoint: %w", err)
+	}
+	stx.savepoints = stx.savepoints[:i]
+	return nil
+}
+
+// RollbackToSavepoint undoes the work done since a savepoint. The
+// savepoint stays set, so it can be rolled back to again; the ones set
+// after it are forgotten.
+func (m *Manager) RollbackToSavepoint(sessionID, name string) error {
+	m.txMu.Lock()
+	defer m.txMu.Unlock()
+
+	stx, i, err := m.findSavepoint(sessionID, name)
+	if err != nil {
+		return err
+	}
+	if _, err := stx.tx.Exec("ROLLBACK TO " + quoteIdentifier(name)); err != nil {
+		return fmt.Errorf("failed to roll back to savepoint: %w", err)
+	}
+	stx.writes = stx.writes[:stx.savepoints[i].writes]
+	stx.savepoints = stx.savepoints[:i+1]
+	return nil
+}
+
+// findSavepoint returns a session's transaction and the index of its
+// innermost savepoint called name. m.txMu must be held.
+func (m *Manager) findSavepoint(sessionID, name string) (*sessionTx, int, error) {
+	stx, ok := m.txs[sessionID]
+	if !ok {
+		return nil, 0, ErrNoTransaction
+	}
+	for i := len(stx.savepoints) - 1; i >= 0; i-- {
+		if stx.savepoints[i].name == name {
+			return stx, i, nil
+		}
+	}
+	return nil, 0, fmt.Errorf("%w: %s", ErrNoSavepoint, name)
+}
+
+// EndSession rolls back the transaction a session left open, e.g. when
+// its client disconnected, and releases any write locks it still holds.
+func (m *Manager) EndSession(sessionID string) {
+	defer m.lockManager.ReleaseAllForSession(sessionID)
+
+	if m.Tx(sessionID) == nil {
+		return
+	}
+	if err := m.RollbackTx(sessionID); err != nil && !errors.Is(err, ErrNoTransaction) {
+		slog.Warn("Failed to roll back transaction of ended session", "session", sessionID, "err", err)
+		return
+	}
+	slog.Info("Rolled back transaction of ended session", "session", sessionID)
+}
+
+// SessionConnection returns the connection a session's queries on a
+// database run on: bound to its transaction if it has one there, else the
+// shared connection from OpenConnection. Don't close it.
+func (m *Manager) SessionConnection(pathOrAlias string, user *access.UserInfo, sessionID string) (*Connection, error) {
+	if conn := m.txConn(pathOrAlias, sessionID); conn != nil {
+		return conn, nil
+	}
+	return m.OpenConnection(pathOrAlias, user)
+}
+
+// txConn returns the connection bound to a session's transaction on a
+// database, or nil.
+func (m *Manager) txConn(pathOrAlias, sessionID string) *Connection {
+	if sessionID == "" {
+		return nil
+	}
+	db := m.discovery.GetDatabase(pathOrAlias)
+	if db == nil {
+		return nil
+	}
+
+	m.txMu.Lock()
+	defer m.txMu.Unlock()
+	if stx, ok := m.txs[sessionID]; ok && stx.db.Path == db.Path {
+		return stx.conn
+	}
+	return nil
+}
+
+// recordTxWrite notes a write run in a session's transaction, for the
+// write hooks fired on commit.
+func (m *Manager) recordTxWrite(sessionID, query string, result *QueryResult) {
+	m.txMu.Lock()
+	defer m.txMu.Unlock()
+	if stx, ok := m.txs[sessionID]; ok {
+		stx.writes = append(stx.writes, txWrite{query: query, result: result})
+	}
+}
@@ -0,0 +1,177 @@
+package database
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/johan-st/sqlite-tui/internal/hooks"
+)
+
+// sqliteHeader is the magic string at the start of every SQLite database.
+const sqliteHeader = "SQLite format 3\x00"
+
+// ErrNotSQLite is returned when a file is not a SQLite database, or an
+// uploaded one is not complete.
+var ErrNotSQLite = errors.New("not a valid SQLite database")
+
+// Upload receives a database file into a temporary file next to its
+// destination. Commit validates it and moves it into place, so readers
+// never see a partially written database.
+type Upload struct {
+	m    *Manager
+	path string
+	tmp  *os.File
+}
+
+// CreateUpload starts an upload to path. The directory must exist.
+func (m *Manager) CreateUpload(path string) (*Upload, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(absPath), "."+filepath.Base(absPath)+".upload-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create upload file: %w", err)
+	}
+
+	return &Upload{m: m, path: absPath, tmp: tmp}, nil
+}
+
+// Path returns the destination path of the upload.
+func (u *Upload) Path() string {
+	return u.path
+}
+
+// Write appends p to the upload.
+func (u *Upload) Write(p []byte) (int, error) {
+	return u.tmp.Write(p)
+}
+
+// WriteAt writes p at offset off.
+func (u *Upload) WriteAt(p []byte, off int64) (int, error) {
+	return u.tmp.WriteAt(p, off)
+}
+
+// Commit validates the uploaded file, runs SQLite's integrity check on it
+// and replaces the destination with it. Replacing a discovered database
+// takes its write lock and drops the cached connection so later queries see
+// the new file.
+func (u *Upload) Commit(holder, sessionID string) error {
+	if err := validateSQLiteFile(u.tmp); err != nil {
+		u.Abort()
+		return err
+	}
+	if err := u.tmp.Sync(); err != nil {
+		u.Abort()
+		return fmt.Errorf("failed to sync upload: %w", err)
+	}
+	if err := checkIntegrity(u.tmp.Name()); err != nil {
+		u.Abort()
+		return err
+	}
+	if err := u.tmp.Close(); err != nil {
+		os.Remove(u.tmp.Name())
+		return fmt.Errorf("failed to close upload: %w", err)
+	}
+
+	replace := func() error {
+		if err := os.Rename(u.tmp.Name(), u.path); err != nil {
+			os.Remove(u.tmp.Name())
+			return fmt.Errorf("failed to move upload into place: %w", err)
+		}
+		// Stale WAL files belong to the old database
+		os.Remove(u.path + "-wal")
+		os.Remove(u.path + "-shm")
+		return nil
+	}
+
+	if db := u.m.discovery.GetDatabase(u.path); db != nil {
+		unlock, err := u.m.lockForWrite(context.Background(), db, nil, holder, sessionID, false)
+		if err == nil {
+			u.m.CloseConnection(db.Path)
+			err = replace()
+			unlock()
+		}
+		if err != nil {
+			os.Remove(u.tmp.Name())
+			return err
+		}
+	} else if err := replace(); err != nil {
+		return err
+	}
+
+	u.m.hooks.Fire(&hooks.Event{Event: hooks.Upload, User: holder, SessionID: sessionID, Database: u.path})
+	return u.m.discovery.Refresh()
+}
+
+// Abort discards the upload.
+func (u *Upload) Abort() {
+	u.tmp.Close()
+	os.Remove(u.tmp.Name())
+}
+
+// validateSQLiteFile checks the SQLite header and that the file is as long
+// as the header says, which catches most truncated transfers.
+func validateSQLiteFile(f *os.File) error {
+	header := make([]byte, 100)
+	if _, err := f.ReadAt(header, 0); err != nil {
+		return fmt.Errorf("%w: file too short", ErrNotSQLite)
+	}
+	if !hasSQLiteHeader(header) {
+		return fmt.Errorf("%w: bad header", ErrNotSQLite)
+	}
+
+	pageSize := int64(binary.BigEndian.Uint16(header[16:18]))
+	if pageSize == 1 {
+		pageSize = 65536
+	}
+	if pageSize < 512 || pageSize&(pageSize-1) != 0 {
+		return fmt.Errorf("%w: invalid page size %d", ErrNotSQLite, pageSize)
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size()%pageSize != 0 {
+		return fmt.Errorf("%w: size %d is not a multiple of the page size", ErrNotSQLite, info.Size())
+	}
+
+	// The page count is only trusted when the header's version-valid-for
+	// number matches its change counter
+	changeCounter := binary.BigEndian.Uint32(header[24:28])
+	pageCount := int64(binary.BigEndian.Uint32(header[28:32]))
+	validFor := binary.BigEndian.Uint32(header[92:96])
+	if validFor == changeCounter && pageCount > 0 && pageCount*pageSize != info.Size() {
+		return fmt.Errorf("%w: expected %d bytes, got %d (truncated?)", ErrNotSQLite, pageCount*pageSize, info.Size())
+	}
+	return nil
+}
+
+// checkIntegrity runs SQLite's integrity check on the database at path.
+func checkIntegrity(path string) error {
+	conn, err := OpenReadOnly(path)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrNotSQLite, err)
+	}
+	defer func() {
+		conn.Close()
+		// Opening may leave WAL files next to the temporary file
+		os.Remove(path + "-wal")
+		os.Remove(path + "-shm")
+	}()
+
+	var result string
+	if err := conn.QueryRow("PRAGMA integrity_check(1)").Scan(&result); err != nil {
+		return fmt.Errorf("%w: %v", ErrNotSQLite, err)
+	}
+	if result != "ok" {
+		return fmt.Errorf("%w: integrity check failed: %s", ErrNotSQLite, result)
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package history
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Approval statuses.
+const (
+	ApprovalPending  = "pending"
+	ApprovalApproved = "approved"
+	ApprovalDenied   = "denied"
+)
+
+// Approval is a command a user asked to run, waiting for an admin.
+type Approval struct {
+	ID           int64      `json:"id"`
+	UserName     string     `json:"user"`
+	Command      string     `json:"command"`
+	Args         []string   `json:"args"`
+	DatabasePath string     `json:"database,omitempty"`
+	Status       string     `json:"status"`
+	DecidedBy    string     `json:"decided_by,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	DecidedAt    *time.Time `json:"decided_at,omitempty"`
+}
+
+// CreateApproval stores a pending approval request and sets its ID.
+func (s *Store) CreateApproval(a *Approval) error {
+	args, err := json.Marshal(a.Args)
+	if err != nil {
+		return err
+	}
+	a.Status = ApprovalPending
+	a.CreatedAt = time.Now()
+	res, err := s.db.Exec(`
+		INSERT INTO approvals (user_name, command, args, database_path, status, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, a.UserName, a.Command, string(args), nullString(a.DatabasePath), a.Status, a.CreatedAt)
+	if err != nil {
+		return err
+	}
+	a.ID, err = res.LastInsertId()
+	return err
+}
+
+// GetApproval returns an approval request, or nil if there is none.
+func (s *Store) GetApproval(id int64) (*Approval, error) {
+	a, err := scanApproval(s.db.QueryRow(approvalColumns+" WHERE id = ?", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return a, err
+}
+
+// ListApprovals returns approval requests, newest first. An empty status
+// or userName matches all.
+func (s *Store) ListApprovals(status, userName string) ([]*Approval, error) {
+	query := approvalColumns + " WHERE 1=1"
+	args := make([]any, 0)
+
+	if status != "" {
+		query += " AND status = ?"
+		args = append(args, status)
+	}
+	if userName != "" {
+		query += " AND user_name = ?"
+		args = append(args, userName)
+	}
+
+	query += " ORDER BY id DESC"
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var approvals []*Approval
+	for rows.Next() {
+		a, err := scanApproval(rows)
+		if err != nil {
+			return nil, err
+		}
+		approvals = append(approvals, a)
+	}
+
+	return approvals, rows.Err()
+}
+
+// DecideApproval approves or denies a pending request. It reports false if
+// the request doesn't exist or was already decided, so two admins can't
+// both run it.
+func (s *Store) DecideApproval(id int64, status, decidedBy string) (bool, error) {
+	res, err := s.db.Exec(`
+		UPDATE approvals SET status = ?, decided_by = ?, decided_at = ?
+		WHERE id = ? AND status = ?
+	`, status, decidedBy, time.Now(), id, ApprovalPending)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+const approvalColumns = `
+	SELECT id, user_name, command, args, database_path, status, decided_by, created_at, decided_at
+	FROM approvals`
+
+// scanApproval reads an approval row from a *sql.Row or *sql.Rows.
+func scanApproval(row interface{ Scan(...any) error }) (*Approval, error) {
+	var a Approval
+	var args, dbPath, decidedBy sql.NullString
+	var decidedAt sql.NullTime
+	if err := row.Scan(&a.ID, &a.UserName, &a.Command, &args, &dbPath, &a.Status,
+		&decidedBy, &a.CreatedAt, &decidedAt); err != nil {
+		return nil, err
+	}
+	if args.Valid {
+		if err := json.Unmarshal([]byte(args.String), &a.Args); err != nil {
+			return nil, err
+		}
+	}
+	a.DatabasePath = dbPath.String
+	a.DecidedBy = decidedBy.String
+	if decidedAt.Valid {
+		a.DecidedAt = &decidedAt.Time
+	}
+	return &a, nil
+}
@@ -0,0 +1,138 @@
+package history
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Ban is a temporary ban of a remote IP.
+type Ban struct {
+	IP        string    `json:"ip"`
+	Reason    string    `json:"reason"`
+	Failures  int       `json:"failures"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Active reports whether the ban is still in force at now.
+func (b *Ban) Active(now time.Time) bool {
+	return now.Before(b.ExpiresAt)
+}
+
+// RecordAuthFailure records a failed authentication attempt from ip.
+func (s *Store) RecordAuthFailure(ip, userName, fingerprint string, at time.Time) error {
+	_, err := s.db.Exec(`
+		INSERT INTO auth_failures (remote_ip, user_name, public_key_fingerprint, created_at)
+		VALUES (?, ?, ?, ?)
+	`, ip, nullString(userName), nullString(fingerprint), at)
+	return err
+}
+
+// CountAuthFailures returns the number of failed attempts from ip since
+// the given time.
+func (s *Store) CountAuthFailures(ip string, since time.Time) (int, error) {
+	var n int
+	err := s.db.QueryRow(
+		"SELECT COUNT(*) FROM auth_failures WHERE remote_ip = ? AND created_at >= ?", ip, since,
+	).Scan(&n)
+	return n, err
+}
+
+// PruneAuthFailures deletes failed attempts older than before.
+func (s *Store) PruneAuthFailures(before time.Time) (int64, error) {
+	res, err := s.db.Exec("DELETE FROM auth_failures WHERE created_at < ?", before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// BanIP bans ip, replacing any existing ban.
+func (s *Store) BanIP(ban *Ban) error {
+	_, err := s.db.Exec(`
+		INSERT OR REPLACE INTO ip_bans (ip, reason, failures, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, ban.IP, nullString(ban.Reason), ban.Failures, ban.CreatedAt, ban.ExpiresAt)
+	return err
+}
+
+// GetBan returns the ban for ip, or nil if it was never banned. The ban
+// may have expired; check Active.
+func (s *Store) GetBan(ip string) (*Ban, error) {
+	var ban Ban
+	var reason sql.NullString
+	err := s.db.QueryRow(`
+		SELECT ip, reason, failures, created_at, expires_at
+		FROM ip_bans WHERE ip = ?
+	`, ip).Scan(&ban.IP, &reason, &ban.Failures, &ban.CreatedAt, &ban.ExpiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	ban.Reason = reason.String
+	return &ban, nil
+}
+
+// ListBans returns bans, newest first. Expired bans are only included when
+// includeExpired is set.
+func (s *Store) ListBans(includeExpired bool, now time.Time) ([]*Ban, error) {
+	query := "SELECT ip, reason, failures, created_at, expires_at FROM ip_bans"
+	args := make([]any, 0)
+
+	if !includeExpired {
+		query += " WHERE expires_at > ?"
+		args = append(args, now)
+	}
+
+	query += " ORDER BY created_at DESC"
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var bans []*Ban
+	for rows.Next() {
+		var ban Ban
+		var reason sql.NullString
+		if err := rows.Scan(&ban.IP, &reason, &ban.Failures, &ban.CreatedAt, &ban.ExpiresAt); err != nil {
+			return nil, err
+		}
+		ban.Reason = reason.String
+		bans = append(bans, &ban)
+	}
+
+	return bans, rows.Err()
+}
+
+// ClearBan lifts the ban on ip and forgets its failed attempts, so the
+// next failure doesn't ban it again straight away. It reports whether a
+// ban was removed.
+func (s *Store) ClearBan(ip string) (bool, error) {
+	res, err := s.db.Exec("DELETE FROM ip_bans WHERE ip = ?", ip)
+	if err != nil {
+		return false, err
+	}
+	if _, err := s.db.Exec("DELETE FROM auth_failures WHERE remote_ip = ?", ip); err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// ClearAllBans lifts every ban and forgets all failed attempts. It
+// returns the number of bans removed.
+func (s *Store) ClearAllBans() (int64, error) {
+	res, err := s.db.Exec("DELETE FROM ip_bans")
+	if err != nil {
+		return 0, err
+	}
+	if _, err := s.db.Exec("DELETE FROM auth_failures"); err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
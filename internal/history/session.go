@@ -22,6 +22,7 @@ type Session struct {
 type QueryRecord struct {
 	ID              int64
 	SessionID       string
+	UserName        string // filled in when listing, not stored
 	DatabasePath    string
 	Query           string
 	ExecutionTimeMs int64
@@ -34,6 +35,7 @@ type QueryRecord struct {
 type AuditRecord struct {
 	ID           int64
 	SessionID    string
+	UserName     string // filled in when listing, not stored
 	Action       string // query, update, delete, export, download, etc.
 	DatabasePath string
 	TableName    string
@@ -1,20 +1,25 @@
 package history
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
+	"github.com/johan-st/sqlite-tui/internal/hooks"
 	_ "modernc.org/sqlite"
 )
 
 // Store manages the history database.
 type Store struct {
 	db            *sql.DB
+	path          string
 	nameGenerator *NameGenerator
+	hooks         *hooks.Runner
 }
 
 // NewStore creates a new history store.
@@ -25,7 +30,9 @@ func NewStore(dataDir string) (*Store, error) {
 	}
 
 	dbPath := filepath.Join(dataDir, "history.db")
-	dsn := fmt.Sprintf("file:%s?_busy_timeout=5000&_journal_mode=WAL&_synchronous=NORMAL&_foreign_keys=ON", dbPath)
+	// The server records history from many connections at once, so writers
+	// wait for each other rather than fail with SQLITE_BUSY
+	dsn := fmt.Sprintf("file:%s?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=synchronous(NORMAL)", dbPath)
 
 	db, err := sql.Open("sqlite", dsn)
 	if err != nil {
@@ -34,6 +41,7 @@ func NewStore(dataDir string) (*Store, error) {
 
 	store := &Store{
 		db:            db,
+		path:          dbPath,
 		nameGenerator: NewNameGenerator(),
 	}
 
@@ -92,6 +100,38 @@ func (s *Store) migrate() error {
 	CREATE INDEX IF NOT EXISTS idx_audit_log_action ON audit_log(action);
 	CREATE INDEX IF NOT EXISTS idx_audit_log_database_path ON audit_log(database_path);
 	CREATE INDEX IF NOT EXISTS idx_audit_log_created_at ON audit_log(created_at);
+
+	CREATE TABLE IF NOT EXISTS auth_failures (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		remote_ip TEXT NOT NULL,
+		user_name TEXT,
+		public_key_fingerprint TEXT,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_auth_failures_ip_created_at ON auth_failures(remote_ip, created_at);
+
+	CREATE TABLE IF NOT EXISTS ip_bans (
+		ip TEXT PRIMARY KEY,
+		reason TEXT,
+		failures INTEGER,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		expires_at DATETIME
+	);
+
+	CREATE TABLE IF NOT EXISTS approvals (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_name TEXT NOT NULL,
+		command TEXT NOT NULL,
+		args TEXT,
+		database_path TEXT,
+		status TEXT NOT NULL DEFAULT 'pending',
+		decided_by TEXT,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		decided_at DATETIME
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_approvals_status ON approvals(status);
 	`
 
 	_, err := s.db.Exec(schema)
@@ -103,6 +143,39 @@ func (s *Store) Close() error {
 	return s.db.Close()
 }
 
+// CheckWritable verifies that the history database can take a write lock,
+// without changing anything.
+func (s *Store) CheckWritable(ctx context.Context) error {
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "BEGIN IMMEDIATE"); err != nil {
+		return err
+	}
+	_, err = conn.ExecContext(ctx, "ROLLBACK")
+	return err
+}
+
+// Size returns the on-disk size of the history database in bytes,
+// including its WAL and shared-memory files.
+func (s *Store) Size() (int64, error) {
+	var total int64
+	for _, suffix := range []string{"", "-wal", "-shm"} {
+		info, err := os.Stat(s.path + suffix)
+		if err != nil {
+			if os.IsNotExist(err) && suffix != "" {
+				continue
+			}
+			return 0, err
+		}
+		total += info.Size()
+	}
+	return total, nil
+}
+
 // GenerateAnonymousName generates a new anonymous name.
 func (s *Store) GenerateAnonymousName() string {
 	return s.nameGenerator.Generate()
@@ -219,71 +292,94 @@ func (s *Store) RecordQuery(record *QueryRecord) error {
 	return err
 }
 
-// ListQueryHistory lists query history with optional filters.
-func (s *Store) ListQueryHistory(sessionID, databasePath string, since time.Time, limit int) ([]*QueryRecord, error) {
-	query := "SELECT id, session_id, database_path, query, execution_time_ms, rows_affected, error, created_at FROM query_history WHERE 1=1"
-	args := make([]any, 0)
-
-	if sessionID != "" {
-		query += " AND session_id = ?"
-		args = append(args, sessionID)
-	}
-
-	if databasePath != "" {
-		query += " AND database_path = ?"
-		args = append(args, databasePath)
+// PruneQueryHistory deletes query history recorded before cutoff and
+// returns the number of deleted entries. Failed queries are kept when
+// keepErrors is set. Ended sessions left without history or audit entries
+// are removed as well.
+func (s *Store) PruneQueryHistory(before time.Time, keepErrors bool) (int64, error) {
+	query := "DELETE FROM query_history WHERE created_at < ?"
+	if keepErrors {
+		query += " AND error IS NULL"
 	}
-
-	if !since.IsZero() {
-		query += " AND created_at >= ?"
-		args = append(args, since)
-	}
-
-	query += " ORDER BY created_at DESC"
-
-	if limit > 0 {
-		query += " LIMIT ?"
-		args = append(args, limit)
-	}
-
-	rows, err := s.db.Query(query, args...)
+	res, err := s.db.Exec(query, before)
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
-	defer rows.Close()
-
-	var records []*QueryRecord
-	for rows.Next() {
-		var record QueryRecord
-		var errStr sql.NullString
+	n, _ := res.RowsAffected()
+	return n, s.pruneSessions(before)
+}
 
-		err := rows.Scan(&record.ID, &record.SessionID, &record.DatabasePath, &record.Query,
-			&record.ExecutionTimeMs, &record.RowsAffected, &errStr, &record.CreatedAt)
-		if err != nil {
-			return nil, err
-		}
+// QueryFilter selects query history entries. Zero values match everything.
+type QueryFilter struct {
+	SessionID  string
+	Databases  []string // database paths or aliases, any of which may match
+	User       string   // authenticated or anonymous user name
+	Since      time.Time
+	Until      time.Time
+	ErrorsOnly bool
+	Search     string // case-insensitive substring of the query text
+	Limit      int
+}
 
-		record.Error = errStr.String
-		records = append(records, &record)
+// ListQueryHistory lists query history with optional filters.
+func (s *Store) ListQueryHistory(sessionID, databasePath string, since time.Time, limit int) ([]*QueryRecord, error) {
+	f := QueryFilter{SessionID: sessionID, Since: since, Limit: limit}
+	if databasePath != "" {
+		f.Databases = []string{databasePath}
 	}
-
-	return records, rows.Err()
+	return s.FindQueryHistory(f)
 }
 
 // GetQueryHistoryForUser lists query history for a specific user.
 func (s *Store) GetQueryHistoryForUser(userName string, limit int) ([]*QueryRecord, error) {
+	return s.FindQueryHistory(QueryFilter{User: userName, Limit: limit})
+}
+
+// FindQueryHistory lists query history matching a filter, newest first.
+func (s *Store) FindQueryHistory(f QueryFilter) ([]*QueryRecord, error) {
 	query := `
-		SELECT qh.id, qh.session_id, qh.database_path, qh.query, qh.execution_time_ms, qh.rows_affected, qh.error, qh.created_at
+		SELECT qh.id, qh.session_id, COALESCE(s.user_name, s.anonymous_name, ''), qh.database_path,
+			qh.query, qh.execution_time_ms, qh.rows_affected, qh.error, qh.created_at
 		FROM query_history qh
-		JOIN sessions s ON qh.session_id = s.id
-		WHERE s.user_name = ?
-		ORDER BY qh.created_at DESC
-	`
-	args := []any{userName}
+		LEFT JOIN sessions s ON qh.session_id = s.id
+		WHERE 1=1`
+	args := make([]any, 0)
 
-	if limit > 0 {
+	if f.SessionID != "" {
+		query += " AND qh.session_id = ?"
+		args = append(args, f.SessionID)
+	}
+	if len(f.Databases) > 0 {
+		query += " AND qh.database_path IN (?" + strings.Repeat(", ?", len(f.Databases)-1) + ")"
+		for _, db := range f.Databases {
+			args = append(args, db)
+		}
+	}
+	if f.User != "" {
+		query += " AND (s.user_name = ? OR s.anonymous_name = ?)"
+		args = append(args, f.User, f.User)
+	}
+	if !f.Since.IsZero() {
+		query += " AND qh.created_at >= ?"
+		args = append(args, f.Since)
+	}
+	if !f.Until.IsZero() {
+		query += " AND qh.created_at < ?"
+		args = append(args, f.Until)
+	}
+	if f.ErrorsOnly {
+		query += " AND qh.error IS NOT NULL AND qh.error != ''"
+	}
+	if f.Search != "" {
+		query += " AND instr(lower(qh.query), lower(?)) > 0"
+		args = append(args, f.Search)
+	}
+
+	query += " ORDER BY qh.created_at DESC"
+
+	if f.Limit > 0 {
 		query += " LIMIT ?"
-		args = append(args, limit)
+		args = append(args, f.Limit)
 	}
 
 	rows, err := s.db.Query(query, args...)
@@ -297,7 +393,7 @@ func (s *Store) GetQueryHistoryForUser(userName string, limit int) ([]*QueryReco
 		var record QueryRecord
 		var errStr sql.NullString
 
-		err := rows.Scan(&record.ID, &record.SessionID, &record.DatabasePath, &record.Query,
+		err := rows.Scan(&record.ID, &record.SessionID, &record.UserName, &record.DatabasePath, &record.Query,
 			&record.ExecutionTimeMs, &record.RowsAffected, &errStr, &record.CreatedAt)
 		if err != nil {
 			return nil, err
@@ -310,7 +406,22 @@ func (s *Store) GetQueryHistoryForUser(userName string, limit int) ([]*QueryReco
 	return records, rows.Err()
 }
 
-// RecordAudit records an audit log entry.
+// SetHooks makes audit records run the hooks of r. Call it before the
+// store is used.
+func (s *Store) SetHooks(r *hooks.Runner) {
+	s.hooks = r
+}
+
+// writeActions are the audited actions that change data or schema; they
+// also run the write hooks.
+var writeActions = map[string]bool{
+	"INSERT": true, "UPDATE": true, "DELETE": true, "SEED": true,
+	"CREATE_TABLE": true, "ADD_COLUMN": true, "DROP_TABLE": true,
+	"FTS_CREATE": true, "FTS_REBUILD": true, "FTS_DROP": true, "PRAGMA": true,
+}
+
+// RecordAudit records an audit log entry and runs the audit hooks, and the
+// write hooks for data and schema changes.
 func (s *Store) RecordAudit(record *AuditRecord) error {
 	_, err := s.db.Exec(`
 		INSERT INTO audit_log (session_id, action, database_path, table_name, details, created_at)
@@ -318,9 +429,46 @@ func (s *Store) RecordAudit(record *AuditRecord) error {
 	`, record.SessionID, record.Action, record.DatabasePath, nullString(record.TableName),
 		nullString(record.Details), record.CreatedAt)
 
+	write := writeActions[record.Action]
+	if s.hooks.Enabled(hooks.Audit) || write && s.hooks.Enabled(hooks.Write) {
+		s.fireAuditHooks(record, write)
+	}
 	return err
 }
 
+// fireAuditHooks runs the hooks for an audit record, naming the user and
+// address of its session.
+func (s *Store) fireAuditHooks(record *AuditRecord, write bool) {
+	var user, remoteAddr string
+	s.db.QueryRow(`
+		SELECT COALESCE(NULLIF(user_name, ''), anonymous_name, ''), COALESCE(remote_addr, '')
+		FROM sessions WHERE id = ?
+	`, record.SessionID).Scan(&user, &remoteAddr)
+
+	var details any
+	if record.Details != "" {
+		details = json.RawMessage(record.Details)
+	}
+	event := func(name string) *hooks.Event {
+		return &hooks.Event{
+			Event:      name,
+			Time:       record.CreatedAt,
+			User:       user,
+			SessionID:  record.SessionID,
+			RemoteAddr: remoteAddr,
+			Database:   record.DatabasePath,
+			Table:      record.TableName,
+			Action:     record.Action,
+			Details:    details,
+		}
+	}
+
+	s.hooks.Fire(event(hooks.Audit))
+	if write {
+		s.hooks.Fire(event(hooks.Write))
+	}
+}
+
 // RecordAuditSimple is a convenience method for recording audit entries.
 func (s *Store) RecordAuditSimple(sessionID, action, dbPath, tableName string, details map[string]any) error {
 	var detailsJSON string
@@ -341,36 +489,100 @@ func (s *Store) RecordAuditSimple(sessionID, action, dbPath, tableName string, d
 	})
 }
 
+// PruneAuditLog deletes audit entries recorded before cutoff and returns
+// the number of deleted entries.
+func (s *Store) PruneAuditLog(before time.Time) (int64, error) {
+	res, err := s.db.Exec("DELETE FROM audit_log WHERE created_at < ?", before)
+	if err != nil {
+		return 0, err
+	}
+	n, _ := res.RowsAffected()
+	return n, s.pruneSessions(before)
+}
+
+// pruneSessions deletes ended sessions created before cutoff that no
+// history or audit entry refers to anymore.
+func (s *Store) pruneSessions(before time.Time) error {
+	_, err := s.db.Exec(`
+		DELETE FROM sessions
+		WHERE is_active = 0 AND created_at < ?
+			AND id NOT IN (SELECT session_id FROM query_history WHERE session_id IS NOT NULL)
+			AND id NOT IN (SELECT session_id FROM audit_log WHERE session_id IS NOT NULL)
+	`, before)
+	return err
+}
+
+// AuditFilter selects audit log entries. Zero values match everything.
+type AuditFilter struct {
+	SessionID string
+	Action    string
+	Databases []string // database paths or aliases, any of which may match
+	Table     string
+	User      string // authenticated or anonymous user name
+	Denied    bool   // only denials (ACCESS_DENIED, COMMAND_DENIED, ...)
+	Since     time.Time
+	Until     time.Time
+	Limit     int
+}
+
 // ListAuditLog lists audit log entries with optional filters.
 func (s *Store) ListAuditLog(sessionID, action, databasePath string, since time.Time, limit int) ([]*AuditRecord, error) {
-	query := "SELECT id, session_id, action, database_path, table_name, details, created_at FROM audit_log WHERE 1=1"
+	f := AuditFilter{SessionID: sessionID, Action: action, Since: since, Limit: limit}
+	if databasePath != "" {
+		f.Databases = []string{databasePath}
+	}
+	return s.FindAuditLog(f)
+}
+
+// FindAuditLog lists audit log entries matching a filter, newest first.
+func (s *Store) FindAuditLog(f AuditFilter) ([]*AuditRecord, error) {
+	query := `
+		SELECT al.id, al.session_id, COALESCE(s.user_name, s.anonymous_name, ''), al.action,
+			al.database_path, al.table_name, al.details, al.created_at
+		FROM audit_log al
+		LEFT JOIN sessions s ON al.session_id = s.id
+		WHERE 1=1`
 	args := make([]any, 0)
 
-	if sessionID != "" {
-		query += " AND session_id = ?"
-		args = append(args, sessionID)
+	if f.SessionID != "" {
+		query += " AND al.session_id = ?"
+		args = append(args, f.SessionID)
 	}
-
-	if action != "" {
-		query += " AND action = ?"
-		args = append(args, action)
+	if f.Action != "" {
+		query += " AND al.action = ?"
+		args = append(args, f.Action)
 	}
-
-	if databasePath != "" {
-		query += " AND database_path = ?"
-		args = append(args, databasePath)
+	if f.Denied {
+		query += ` AND al.action LIKE '%\_DENIED' ESCAPE '\'`
 	}
-
-	if !since.IsZero() {
-		query += " AND created_at >= ?"
-		args = append(args, since)
+	if len(f.Databases) > 0 {
+		query += " AND al.database_path IN (?" + strings.Repeat(", ?", len(f.Databases)-1) + ")"
+		for _, db := range f.Databases {
+			args = append(args, db)
+		}
+	}
+	if f.Table != "" {
+		query += " AND al.table_name = ?"
+		args = append(args, f.Table)
+	}
+	if f.User != "" {
+		query += " AND (s.user_name = ? OR s.anonymous_name = ?)"
+		args = append(args, f.User, f.User)
+	}
+	if !f.Since.IsZero() {
+		query += " AND al.created_at >= ?"
+		args = append(args, f.Since)
+	}
+	if !f.Until.IsZero() {
+		query += " AND al.created_at < ?"
+		args = append(args, f.Until)
 	}
 
-	query += " ORDER BY created_at DESC"
+	query += " ORDER BY al.created_at DESC"
 
-	if limit > 0 {
+	if f.Limit > 0 {
 		query += " LIMIT ?"
-		args = append(args, limit)
+		args = append(args, f.Limit)
 	}
 
 	rows, err := s.db.Query(query, args...)
@@ -384,7 +596,7 @@ func (s *Store) ListAuditLog(sessionID, action, databasePath string, since time.
 		var record AuditRecord
 		var tableName, details sql.NullString
 
-		err := rows.Scan(&record.ID, &record.SessionID, &record.Action, &record.DatabasePath,
+		err := rows.Scan(&record.ID, &record.SessionID, &record.UserName, &record.Action, &record.DatabasePath,
 			&tableName, &details, &record.CreatedAt)
 		if err != nil {
 			return nil, err
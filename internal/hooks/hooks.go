@@ -0,0 +1,188 @@
+// Package hooks runs external commands on server events, such as session
+// starts and writes, passing the event as JSON on stdin. Commands come from
+// the hooks config section and are read when an event fires, so config
+// reloads apply immediately. Events are fired through a Runner, which the
+// database manager owns.
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/johan-st/sqlite-tui/internal/config"
+)
+
+// Events.
+const (
+	SessionStart = "session_start"
+	SessionEnd   = "session_end"
+	Write        = "write"
+	Download     = "download"
+	Upload       = "upload"
+	Ban          = "ban"
+	Audit        = "audit"
+	// Change is a row the change feed found added or updated in a watched
+	// table; Action is insert or update and Details the row by column
+	Change = "change"
+)
+
+const (
+	// queueSize is how many hook runs may wait before events are dropped
+	queueSize = 256
+	// workers is how many hook commands run at once
+	workers = 4
+	// maxLoggedOutput is how much of a failed command's output is logged
+	maxLoggedOutput = 512
+	// waitDelay is how long a timed out command's output is waited for
+	waitDelay = time.Second
+)
+
+// Event is the JSON document a hook command receives on stdin.
+type Event struct {
+	Event      string    `json:"event"`
+	Time       time.Time `json:"time"`
+	User       string    `json:"user,omitempty"`
+	SessionID  string    `json:"session_id,omitempty"`
+	RemoteAddr string    `json:"remote_addr,omitempty"`
+	Database   string    `json:"database,omitempty"`
+	Table      string    `json:"table,omitempty"`
+	Action     string    `json:"action,omitempty"`
+	Query      string    `json:"query,omitempty"`
+	Details    any       `json:"details,omitempty"`
+}
+
+type job struct {
+	event   *Event
+	command string
+	payload []byte
+}
+
+// Runner runs the hook commands of a config on a few workers. A nil
+// Runner runs none.
+type Runner struct {
+	cfg   *config.Config
+	queue chan job
+	wg    sync.WaitGroup
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewRunner starts a runner for the config's hooks section.
+func NewRunner(cfg *config.Config) *Runner {
+	return newRunner(cfg, workers, queueSize)
+}
+
+func newRunner(cfg *config.Config, workers, queueSize int) *Runner {
+	r := &Runner{cfg: cfg, queue: make(chan job, queueSize)}
+	r.wg.Add(workers)
+	for range workers {
+		go r.work()
+	}
+	return r
+}
+
+// Close stops taking events and waits for the commands already queued to
+// run.
+func (r *Runner) Close() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	if !r.closed {
+		r.closed = true
+		close(r.queue)
+	}
+	r.mu.Unlock()
+	r.wg.Wait()
+}
+
+func (r *Runner) commands(event string) []string {
+	if r == nil || r.cfg == nil {
+		return nil
+	}
+	return r.cfg.GetHooks(event)
+}
+
+// Enabled reports whether any command is configured for event, so callers
+// can skip building costly events.
+func (r *Runner) Enabled(event string) bool {
+	return len(r.commands(event)) > 0
+}
+
+// Fire runs the commands configured for e.Event in the background. Events
+// are dropped with a warning when hooks can't keep up; commands for
+// different events may run in any order.
+func (r *Runner) Fire(e *Event) {
+	cmds := r.commands(e.Event)
+	if len(cmds) == 0 {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	payload, err := json.Marshal(e)
+	if err != nil {
+		slog.Error("Failed to encode hook event", "event", e.Event, "err", err)
+		return
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.closed {
+		return
+	}
+	for _, command := range cmds {
+		select {
+		case r.queue <- job{event: e, command: command, payload: payload}:
+		default:
+			slog.Warn("Hook queue full, dropping event", "event", e.Event, "command", command)
+		}
+	}
+}
+
+func (r *Runner) work() {
+	defer r.wg.Done()
+	for j := range r.queue {
+		r.run(j)
+	}
+}
+
+// run executes one hook command with the event on stdin.
+func (r *Runner) run(j job) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.cfg.GetHooksTimeout())
+	defer cancel()
+
+	var output bytes.Buffer
+	cmd := exec.CommandContext(ctx, "sh", "-c", j.command)
+	cmd.Stdin = bytes.NewReader(j.payload)
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	cmd.Env = append(os.Environ(), "SQLITE_TUI_EVENT="+j.event.Event)
+	// Children the shell started may hold the output open after it is
+	// killed; don't wait for them past the timeout
+	cmd.WaitDelay = waitDelay
+
+	start := time.Now()
+	err := cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		err = ctx.Err()
+	}
+	if err != nil {
+		out := strings.TrimSpace(output.String())
+		if len(out) > maxLoggedOutput {
+			out = out[:maxLoggedOutput] + "..."
+		}
+		slog.Warn("Hook failed", "event", j.event.Event, "command", j.command, "err", err, "output", out)
+		return
+	}
+	slog.Debug("Hook ran", "event", j.event.Event, "command", j.command, "duration", time.Since(start).Round(time.Millisecond))
+}
@@ -0,0 +1,154 @@
+package hooks
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/johan-st/sqlite-tui/internal/config"
+)
+
+// waitForFile waits for a hook to create path.
+func waitForFile(t *testing.T, path string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := os.Stat(path); err == nil {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", path)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRunner_Payload(t *testing.T) {
+	dir := t.TempDir()
+	out, env := filepath.Join(dir, "event"), filepath.Join(dir, "env")
+	r := NewRunner(&config.Config{Hooks: config.HooksConfig{
+		OnWrite: []string{"cat > " + out + " && echo $SQLITE_TUI_EVENT > " + env},
+	}})
+
+	if !r.Enabled(Write) || r.Enabled(Download) {
+		t.Error("expected only the write hooks to be enabled")
+	}
+	r.Fire(&Event{Event: Download, Database: "/data/skipped.db"})
+	at := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	r.Fire(&Event{
+		Event:      Write,
+		Time:       at,
+		User:       "alice",
+		SessionID:  "s1",
+		RemoteAddr: "192.0.2.1",
+		Database:   "/data/app.db",
+		Query:      "DELETE FROM users",
+		Details:    map[string]any{"tables": []string{"users"}},
+	})
+	r.Close()
+
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("hook didn't run: %v", err)
+	}
+	var got map[string]any
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("expected a JSON event, got %q: %v", data, err)
+	}
+	want := map[string]any{
+		"event":       "write",
+		"time":        "2026-01-02T03:04:05Z",
+		"user":        "alice",
+		"session_id":  "s1",
+		"remote_addr": "192.0.2.1",
+		"database":    "/data/app.db",
+		"query":       "DELETE FROM users",
+		"details":     map[string]any{"tables": []any{"users"}},
+	}
+	gotJSON, _ := json.Marshal(got)
+	wantJSON, _ := json.Marshal(want)
+	if !bytes.Equal(gotJSON, wantJSON) {
+		t.Errorf("payload = %s, want %s", gotJSON, wantJSON)
+	}
+	if data, _ := os.ReadFile(env); string(bytes.TrimSpace(data)) != Write {
+		t.Errorf("SQLITE_TUI_EVENT = %q, want %q", data, Write)
+	}
+}
+
+func TestRunner_QueueFull(t *testing.T) {
+	dir := t.TempDir()
+	out, started, release := filepath.Join(dir, "events"), filepath.Join(dir, "started"), filepath.Join(dir, "release")
+	cfg := &config.Config{Hooks: config.HooksConfig{
+		OnAudit: []string{"cat >> " + out + " && echo >> " + out + " && touch " + started +
+			" && while [ ! -e " + release + " ]; do sleep 0.01; done"},
+	}}
+	r := newRunner(cfg, 1, 2)
+
+	// The only worker is busy with the first event, two more fit in the
+	// queue and the rest are dropped
+	r.Fire(&Event{Event: Audit, Action: "0"})
+	waitForFile(t, started)
+	for i := 1; i <= 4; i++ {
+		r.Fire(&Event{Event: Audit, Action: string(rune('0' + i))})
+	}
+	if err := os.WriteFile(release, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var actions []string
+	for _, line := range bytes.Split(bytes.TrimSpace(data), []byte("\n")) {
+		var e Event
+		if err := json.Unmarshal(line, &e); err != nil {
+			t.Fatalf("expected a JSON event, got %q: %v", line, err)
+		}
+		actions = append(actions, e.Action)
+	}
+	if len(actions) != 3 || actions[0] != "0" || actions[1] != "1" || actions[2] != "2" {
+		t.Errorf("ran events %v, want [0 1 2]", actions)
+	}
+
+	// A closed runner drops events
+	r.Fire(&Event{Event: Audit, Action: "closed"})
+}
+
+func TestRunner_Timeout(t *testing.T) {
+	dir := t.TempDir()
+	late, next := filepath.Join(dir, "late"), filepath.Join(dir, "next")
+	r := NewRunner(&config.Config{Hooks: config.HooksConfig{
+		Timeout:  "100ms",
+		OnBan:    []string{"sleep 5; touch " + late},
+		OnUpload: []string{"touch " + next},
+	}})
+
+	start := time.Now()
+	r.Fire(&Event{Event: Ban, RemoteAddr: "192.0.2.1"})
+	r.Fire(&Event{Event: Upload, Database: "/data/app.db"})
+	r.Close()
+
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("hooks took %v, want the slow one stopped at its timeout", elapsed)
+	}
+	if _, err := os.Stat(late); err == nil {
+		t.Error("expected the timed out hook to be killed")
+	}
+	if _, err := os.Stat(next); err != nil {
+		t.Errorf("expected the other hook to run: %v", err)
+	}
+}
+
+func TestRunner_Nil(t *testing.T) {
+	var r *Runner
+	if r.Enabled(Write) {
+		t.Error("expected a nil runner to run no hooks")
+	}
+	r.Fire(&Event{Event: Write})
+	r.Close()
+}
@@ -0,0 +1,65 @@
+// Package logging sets up the process-wide structured logger.
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	"github.com/johan-st/sqlite-tui/internal/config"
+)
+
+// level is shared by the installed handlers so it can change on reload.
+var level = new(slog.LevelVar)
+
+// NewHandler creates a slog handler writing to w in the configured format.
+func NewHandler(w io.Writer, cfg config.LogConfig) (slog.Handler, error) {
+	if err := SetLevel(cfg.Level); err != nil {
+		return nil, err
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+	switch strings.ToLower(cfg.Format) {
+	case "", "text":
+		return slog.NewTextHandler(w, opts), nil
+	case "json":
+		return slog.NewJSONHandler(w, opts), nil
+	default:
+		return nil, fmt.Errorf("unknown log format %q (use text or json)", cfg.Format)
+	}
+}
+
+// Setup installs a logger for cfg as the slog default, writing to w and,
+// when configured, to syslog. The standard log package is routed through
+// it as well.
+func Setup(w io.Writer, cfg config.LogConfig) error {
+	handler, err := NewHandler(w, cfg)
+	if err != nil {
+		return err
+	}
+
+	if cfg.Syslog != "" {
+		sh, err := newSyslogHandler(cfg)
+		if err != nil {
+			return err
+		}
+		handler = multiHandler{handler, sh}
+	}
+
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
+
+// SetLevel changes the level of the installed logger. Empty means info.
+func SetLevel(s string) error {
+	if s == "" {
+		s = "info"
+	}
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(s)); err != nil {
+		return fmt.Errorf("unknown log level %q (use debug, info, warn or error)", s)
+	}
+	level.Set(l)
+	return nil
+}
@@ -0,0 +1,14 @@
+//go:build windows || plan9
+
+package logging
+
+import (
+	"errors"
+	"log/slog"
+
+	"github.com/johan-st/sqlite-tui/internal/config"
+)
+
+func newSyslogHandler(cfg config.LogConfig) (slog.Handler, error) {
+	return nil, errors.New("syslog is not supported on this platform")
+}
@@ -0,0 +1,97 @@
+//go:build !windows && !plan9
+
+package logging
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"log/syslog"
+	"strings"
+	"sync"
+
+	"github.com/johan-st/sqlite-tui/internal/config"
+)
+
+// newSyslogHandler connects to the syslog daemon named by cfg.Syslog.
+func newSyslogHandler(cfg config.LogConfig) (slog.Handler, error) {
+	network, addr := "", ""
+	if cfg.Syslog != "local" {
+		var ok bool
+		network, addr, ok = strings.Cut(cfg.Syslog, "://")
+		if !ok || (network != "udp" && network != "tcp") {
+			return nil, fmt.Errorf("invalid syslog address %q (use local, udp://host:port or tcp://host:port)", cfg.Syslog)
+		}
+	}
+
+	tag := cfg.SyslogTag
+	if tag == "" {
+		tag = "sqlite-tui"
+	}
+	w, err := syslog.Dial(network, addr, syslog.LOG_INFO|syslog.LOG_DAEMON, tag)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to syslog: %w", err)
+	}
+
+	out := &syslogWriter{w: w}
+	// Syslog timestamps entries itself
+	inner := slog.NewTextHandler(out, &slog.HandlerOptions{
+		Level: level,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if len(groups) == 0 && (a.Key == slog.TimeKey || a.Key == slog.LevelKey) {
+				return slog.Attr{}
+			}
+			return a
+		},
+	})
+	return &syslogHandler{inner: inner, out: out}, nil
+}
+
+// syslogWriter writes each formatted record at the priority of the record
+// being handled.
+type syslogWriter struct {
+	w     *syslog.Writer
+	level slog.Level
+	mu    sync.Mutex
+}
+
+func (s *syslogWriter) Write(p []byte) (int, error) {
+	msg := strings.TrimSuffix(string(p), "\n")
+	var err error
+	switch {
+	case s.level >= slog.LevelError:
+		err = s.w.Err(msg)
+	case s.level >= slog.LevelWarn:
+		err = s.w.Warning(msg)
+	case s.level >= slog.LevelInfo:
+		err = s.w.Info(msg)
+	default:
+		err = s.w.Debug(msg)
+	}
+	return len(p), err
+}
+
+// syslogHandler formats records as text and sends them to syslog.
+type syslogHandler struct {
+	inner slog.Handler
+	out   *syslogWriter
+}
+
+func (h *syslogHandler) Enabled(ctx context.Context, l slog.Level) bool {
+	return h.inner.Enabled(ctx, l)
+}
+
+func (h *syslogHandler) Handle(ctx context.Context, r slog.Record) error {
+	h.out.mu.Lock()
+	defer h.out.mu.Unlock()
+	h.out.level = r.Level
+	return h.inner.Handle(ctx, r)
+}
+
+func (h *syslogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &syslogHandler{inner: h.inner.WithAttrs(attrs), out: h.out}
+}
+
+func (h *syslogHandler) WithGroup(name string) slog.Handler {
+	return &syslogHandler{inner: h.inner.WithGroup(name), out: h.out}
+}
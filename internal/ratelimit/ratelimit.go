@@ -0,0 +1,96 @@
+// Package ratelimit provides per-key token bucket rate limiting.
+package ratelimit
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Error is returned when a client exceeds a rate limit.
+type Error struct {
+	What       string // what was limited, e.g. "connections from 10.0.0.1"
+	RetryAfter time.Duration
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("rate limit exceeded: too many %s, slow down and retry in %s",
+		e.What, e.RetryAfter.Round(time.Second))
+}
+
+// Limiter is a per-key token bucket allowing a number of events per
+// minute, with bursts up to the same number.
+type Limiter struct {
+	perMinute int
+	buckets   map[string]*bucket
+	mu        sync.Mutex
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// New creates a limiter, or returns nil when perMinute is not positive. A
+// nil limiter allows everything.
+func New(perMinute int) *Limiter {
+	if perMinute <= 0 {
+		return nil
+	}
+	return &Limiter{
+		perMinute: perMinute,
+		buckets:   make(map[string]*bucket),
+	}
+}
+
+// Allow takes a token for key. When none is left it returns false and how
+// long until the next token is available.
+func (rl *Limiter) Allow(key string) (bool, time.Duration) {
+	if rl == nil {
+		return true, 0
+	}
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := time.Now()
+	rate := float64(rl.perMinute) / float64(time.Minute)
+
+	b, ok := rl.buckets[key]
+	if !ok {
+		rl.prune(now)
+		b = &bucket{tokens: float64(rl.perMinute), last: now}
+		rl.buckets[key] = b
+	}
+
+	b.tokens += float64(now.Sub(b.last)) * rate
+	if b.tokens > float64(rl.perMinute) {
+		b.tokens = float64(rl.perMinute)
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / rate)
+	}
+	b.tokens--
+	return true, 0
+}
+
+// PerMinute returns the limit the limiter was created with, or 0 for a nil
+// limiter.
+func (rl *Limiter) PerMinute() int {
+	if rl == nil {
+		return 0
+	}
+	return rl.perMinute
+}
+
+// prune drops buckets that have refilled completely, so idle clients don't
+// accumulate. Must be called with rl.mu held.
+func (rl *Limiter) prune(now time.Time) {
+	for key, b := range rl.buckets {
+		if now.Sub(b.last) >= time.Minute {
+			delete(rl.buckets, key)
+		}
+	}
+}
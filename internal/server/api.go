@@ -0,0 +1,44 @@
+package server
+
+import (
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	"github.com/johan-st/sqlite-tui/internal/api"
+)
+
+// startAPIServer serves the gRPC API on the configured address, if any.
+func (s *Server) startAPIServer() error {
+	if s.config.Server.API.Listen == "" {
+		return nil
+	}
+
+	apiServer, err := api.NewServer(s.config, s.dbManager, s.historyStore)
+	if err != nil {
+		return err
+	}
+	if err := apiServer.Start(); err != nil {
+		return err
+	}
+	s.api = apiServer
+	return nil
+}
+
+// APIMiddleware makes the API server available to the api-token command.
+func APIMiddleware(apiServer *api.Server) wish.Middleware {
+	return func(next ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			if apiServer != nil {
+				s.Context().SetValue(ctxKeyAPI, apiServer)
+			}
+			next(s)
+		}
+	}
+}
+
+// GetAPIFromSSH retrieves the API server from the SSH session context.
+func GetAPIFromSSH(s ssh.Session) *api.Server {
+	if apiServer, ok := s.Context().Value(ctxKeyAPI).(*api.Server); ok {
+		return apiServer
+	}
+	return nil
+}
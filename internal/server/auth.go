@@ -4,7 +4,9 @@ import (
 	"crypto/sha256"
 	"encoding/base64"
 	"fmt"
-	"log"
+	"log/slog"
+	"net"
+	"slices"
 	"strings"
 
 	"github.com/charmbracelet/ssh"
@@ -18,6 +20,8 @@ import (
 type Authenticator struct {
 	config       *config.Config
 	historyStore *history.Store
+	keyFetcher   *KeyFetcher
+	bans         *AuthBans
 }
 
 // NewAuthenticator creates a new authenticator.
@@ -25,19 +29,37 @@ func NewAuthenticator(cfg *config.Config, historyStore *history.Store) *Authenti
 	return &Authenticator{
 		config:       cfg,
 		historyStore: historyStore,
+		keyFetcher:   NewKeyFetcher(cfg),
+		bans:         NewAuthBans(cfg, historyStore),
 	}
 }
 
 // PublicKeyHandler returns a handler for public key authentication.
 func (a *Authenticator) PublicKeyHandler() ssh.PublicKeyHandler {
 	return func(ctx ssh.Context, key ssh.PublicKey) bool {
+		if a.bans.Banned(ctx.RemoteAddr()) != nil {
+			return false
+		}
+
+		if cert, ok := key.(*gossh.Certificate); ok {
+			return a.authenticateCert(ctx, cert)
+		}
+
 		fingerprint := FingerprintKey(key)
 		user := a.findUserByKey(fingerprint, key)
 
 		if user != nil {
+			// A known key from the wrong network is rejected, not let in
+			// anonymously
+			if u := a.config.FindUserByName(user.Name); u != nil && !a.sourceAllowed(ctx, u) {
+				a.bans.Rejected(ctx, fingerprint)
+				return false
+			}
+			user.RemoteAddr = ctx.RemoteAddr().String()
+
 			// Store user info in context
 			ctx.SetValue("user", user)
-			log.Printf("Authenticated user %s from %s", user.Name, ctx.RemoteAddr())
+			slog.Info("Authenticated user", "user", user.Name, "remote", ctx.RemoteAddr().String(), "key", fingerprint)
 			return true
 		}
 
@@ -52,11 +74,12 @@ func (a *Authenticator) PublicKeyHandler() ssh.PublicKeyHandler {
 				RemoteAddr:    ctx.RemoteAddr().String(),
 			}
 			ctx.SetValue("user", anonUser)
-			log.Printf("Anonymous access from %s as %s", ctx.RemoteAddr(), anonName)
+			slog.Info("Anonymous access", "user", anonName, "remote", ctx.RemoteAddr().String(), "key", fingerprint)
 			return true
 		}
 
-		log.Printf("Authentication failed for key %s from %s", fingerprint, ctx.RemoteAddr())
+		slog.Warn("Authentication failed", "remote", ctx.RemoteAddr().String(), "key", fingerprint)
+		a.bans.Rejected(ctx, fingerprint)
 		return false
 	}
 }
@@ -68,6 +91,10 @@ func (a *Authenticator) KeyboardInteractiveHandler() ssh.KeyboardInteractiveHand
 	}
 
 	return func(ctx ssh.Context, challenger gossh.KeyboardInteractiveChallenge) bool {
+		if a.bans.Banned(ctx.RemoteAddr()) != nil {
+			return false
+		}
+
 		// Allow anonymous access
 		anonName := a.historyStore.GenerateAnonymousName()
 		anonUser := &access.UserInfo{
@@ -76,15 +103,146 @@ func (a *Authenticator) KeyboardInteractiveHandler() ssh.KeyboardInteractiveHand
 			RemoteAddr:    ctx.RemoteAddr().String(),
 		}
 		ctx.SetValue("user", anonUser)
-		log.Printf("Anonymous keyboard-interactive access from %s as %s", ctx.RemoteAddr(), anonName)
+		slog.Info("Anonymous keyboard-interactive access", "user", anonName, "remote", ctx.RemoteAddr().String())
 		return true
 	}
 }
 
+// authenticateCert accepts a user certificate signed by a trusted CA and
+// maps one of its principals to a configured user. Rejected certificates
+// don't fall back to anonymous access: the client moves on to its next key
+// and may still get in with that.
+func (a *Authenticator) authenticateCert(ctx ssh.Context, cert *gossh.Certificate) bool {
+	fingerprint := FingerprintKey(cert.Key)
+
+	user, principal, err := a.checkCert(ctx, cert)
+	if err != nil {
+		slog.Warn("Rejected certificate", "cert", cert.KeyId, "remote", ctx.RemoteAddr().String(), "key", fingerprint, "err", err)
+		a.bans.Rejected(ctx, fingerprint)
+		return false
+	}
+	if !a.sourceAllowed(ctx, user) {
+		a.bans.Rejected(ctx, fingerprint)
+		return false
+	}
+
+	ctx.SetValue("user", &access.UserInfo{
+		Name:        user.Name,
+		IsAdmin:     user.Admin,
+		PublicKeyFP: fingerprint,
+		RemoteAddr:  ctx.RemoteAddr().String(),
+	})
+	slog.Info("Authenticated user", "user", user.Name, "remote", ctx.RemoteAddr().String(), "key", fingerprint, "cert", cert.KeyId, "principal", principal)
+	return true
+}
+
+// checkCert validates cert and returns the user its principal maps to. The
+// login name is preferred when it is one of the certificate's principals.
+func (a *Authenticator) checkCert(ctx ssh.Context, cert *gossh.Certificate) (*config.User, string, error) {
+	if cert.CertType != gossh.UserCert {
+		return nil, "", fmt.Errorf("not a user certificate")
+	}
+	if !a.isTrustedCA(cert.SignatureKey) {
+		return nil, "", fmt.Errorf("signed by untrusted CA %s", FingerprintKey(cert.SignatureKey))
+	}
+	if len(cert.ValidPrincipals) == 0 {
+		return nil, "", fmt.Errorf("certificate has no principals")
+	}
+
+	principals := cert.ValidPrincipals
+	if slices.Contains(principals, ctx.User()) {
+		principals = append([]string{ctx.User()}, principals...)
+	}
+
+	for _, principal := range principals {
+		user := a.findUserByPrincipal(principal)
+		if user == nil {
+			continue
+		}
+		// Checks the validity window, signature and critical options
+		checker := gossh.CertChecker{SupportedCriticalOptions: []string{"source-address"}}
+		if err := checker.CheckCert(principal, cert); err != nil {
+			return nil, "", err
+		}
+		if err := checkSourceAddress(ctx.RemoteAddr(), cert.CriticalOptions["source-address"]); err != nil {
+			return nil, "", err
+		}
+		return user, principal, nil
+	}
+	return nil, "", fmt.Errorf("no user for principals %q", cert.ValidPrincipals)
+}
+
+// sourceAllowed enforces the user's "from" list against the client address.
+func (a *Authenticator) sourceAllowed(ctx ssh.Context, user *config.User) bool {
+	if access.SourceAllowed(ctx.RemoteAddr().String(), user.From) {
+		return true
+	}
+	slog.Warn("Rejected user from disallowed address", "user", user.Name, "remote", ctx.RemoteAddr().String())
+	return false
+}
+
+// isTrustedCA reports whether key is one of the configured cert authorities.
+func (a *Authenticator) isTrustedCA(key ssh.PublicKey) bool {
+	for _, caStr := range a.config.CertAuthorities {
+		ca, _, _, _, err := ssh.ParseAuthorizedKey([]byte(caStr))
+		if err != nil {
+			continue
+		}
+		if ssh.KeysEqual(ca, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// findUserByPrincipal finds the user a certificate principal maps to: a
+// user listing it under principals, or else the user of the same name.
+func (a *Authenticator) findUserByPrincipal(principal string) *config.User {
+	for i := range a.config.Users {
+		for _, p := range a.config.Users[i].Principals {
+			if p == principal {
+				return &a.config.Users[i]
+			}
+		}
+	}
+	for i := range a.config.Users {
+		if a.config.Users[i].Name == principal {
+			return &a.config.Users[i]
+		}
+	}
+	return nil
+}
+
+// checkSourceAddress enforces a certificate's source-address option, a
+// comma-separated list of addresses and CIDR ranges. Empty allows any.
+func checkSourceAddress(addr net.Addr, allowed string) error {
+	if allowed == "" {
+		return nil
+	}
+	ip := net.ParseIP(remoteHost(addr))
+	if ip == nil {
+		return fmt.Errorf("cannot parse remote address %s", addr)
+	}
+	for _, entry := range strings.Split(allowed, ",") {
+		if _, ipNet, err := net.ParseCIDR(entry); err == nil {
+			if ipNet.Contains(ip) {
+				return nil
+			}
+		} else if allowedIP := net.ParseIP(entry); allowedIP != nil && allowedIP.Equal(ip) {
+			return nil
+		}
+	}
+	return fmt.Errorf("source address %s not allowed by certificate", ip)
+}
+
 // findUserByKey finds a user by their public key.
 func (a *Authenticator) findUserByKey(fingerprint string, key ssh.PublicKey) *access.UserInfo {
 	for _, user := range a.config.Users {
-		for _, pubKeyStr := range user.PublicKeys {
+		keys := user.AllPublicKeys()
+		if user.PublicKeysFrom != "" {
+			keys = append(keys[:len(keys):len(keys)], a.keyFetcher.Keys(user.PublicKeysFrom)...)
+		}
+		for _, pubKeyStr := range keys {
 			// Parse the authorized key
 			parsedKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(pubKeyStr))
 			if err != nil {
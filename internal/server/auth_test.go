@@ -0,0 +1,249 @@
+package server
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/johan-st/sqlite-tui/internal/config"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// testContext is the ssh.Context of a connection from remote, logging in
+// as user.
+type testContext struct {
+	context.Context
+	sync.Mutex
+	user   string
+	remote net.Addr
+	values map[any]any
+	mu     sync.Mutex
+}
+
+func newTestContext(user, remote string) *testContext {
+	addr, err := net.ResolveTCPAddr("tcp", remote)
+	if err != nil {
+		panic(err)
+	}
+	return &testContext{Context: context.Background(), user: user, remote: addr, values: make(map[any]any)}
+}
+
+func (c *testContext) User() string          { return c.user }
+func (c *testContext) SessionID() string     { return "test" }
+func (c *testContext) ClientVersion() string { return "SSH-2.0-test" }
+func (c *testContext) ServerVersion() string { return "SSH-2.0-test" }
+func (c *testContext) RemoteAddr() net.Addr  { return c.remote }
+func (c *testContext) LocalAddr() net.Addr {
+	return &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 2222}
+}
+func (c *testContext) Permissions() *ssh.Permissions {
+	return &ssh.Permissions{Permissions: &gossh.Permissions{}}
+}
+
+func (c *testContext) SetValue(key, value any) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values[key] = value
+}
+
+func (c *testContext) Value(key any) any {
+	c.mu.Lock()
+	v, ok := c.values[key]
+	c.mu.Unlock()
+	if ok {
+		return v
+	}
+	return c.Context.Value(key)
+}
+
+// newSigner returns a fresh ed25519 signer.
+func newSigner(t *testing.T) gossh.Signer {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := gossh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+// signCert returns a user certificate for a new key, signed by ca after
+// edit adjusts it.
+func signCert(t *testing.T, ca gossh.Signer, edit func(*gossh.Certificate)) *gossh.Certificate {
+	t.Helper()
+	now := time.Now()
+	cert := &gossh.Certificate{
+		Key:         newSigner(t).PublicKey(),
+		KeyId:       "test",
+		CertType:    gossh.UserCert,
+		ValidAfter:  uint64(now.Add(-time.Hour).Unix()),
+		ValidBefore: uint64(now.Add(time.Hour).Unix()),
+	}
+	if edit != nil {
+		edit(cert)
+	}
+	if err := cert.SignCert(rand.Reader, ca); err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestAuthenticator_CheckCert(t *testing.T) {
+	ca, otherCA := newSigner(t), newSigner(t)
+	cfg := &config.Config{
+		CertAuthorities: []string{string(gossh.MarshalAuthorizedKey(ca.PublicKey()))},
+		Users: []config.User{
+			{Name: "alice", Admin: true},
+			{Name: "bob", Principals: []string{"ops", "oncall"}},
+		},
+	}
+	a := NewAuthenticator(cfg, nil)
+
+	principals := func(p ...string) func(*gossh.Certificate) {
+		return func(c *gossh.Certificate) { c.ValidPrincipals = p }
+	}
+	tests := []struct {
+		name    string
+		signer  gossh.Signer
+		edit    func(*gossh.Certificate)
+		login   string
+		remote  string
+		want    string // user the certificate maps to, "" if rejected
+		wantErr string
+	}{
+		{name: "principal is a user name", signer: ca, edit: principals("alice"), want: "alice"},
+		{name: "principal mapped to a user", signer: ca, edit: principals("oncall"), want: "bob"},
+		{name: "login name preferred", signer: ca, edit: principals("ops", "alice"), login: "alice", want: "alice"},
+		{name: "first mapped principal", signer: ca, edit: principals("nobody", "ops", "alice"), login: "carol", want: "bob"},
+		{name: "unmapped principal", signer: ca, edit: principals("mallory"), wantErr: "no user for principals"},
+		{name: "no principals", signer: ca, wantErr: "no principals"},
+		{name: "untrusted CA", signer: otherCA, edit: principals("alice"), wantErr: "untrusted CA"},
+		{
+			name:   "expired",
+			signer: ca,
+			edit: func(c *gossh.Certificate) {
+				c.ValidPrincipals = []string{"alice"}
+				c.ValidBefore = uint64(time.Now().Add(-time.Minute).Unix())
+			},
+			wantErr: "expired",
+		},
+		{
+			name:   "not yet valid",
+			signer: ca,
+			edit: func(c *gossh.Certificate) {
+				c.ValidPrincipals = []string{"alice"}
+				c.ValidAfter = uint64(time.Now().Add(time.Hour).Unix())
+			},
+			wantErr: "not yet valid",
+		},
+		{
+			name:   "host certificate",
+			signer: ca,
+			edit: func(c *gossh.Certificate) {
+				c.ValidPrincipals = []string{"alice"}
+				c.CertType = gossh.HostCert
+			},
+			wantErr: "not a user certificate",
+		},
+		{
+			name:   "source address allowed",
+			signer: ca,
+			edit: func(c *gossh.Certificate) {
+				c.ValidPrincipals = []string{"alice"}
+				c.CriticalOptions = map[string]string{"source-address": "192.0.2.1,10.0.0.0/8"}
+			},
+			remote: "10.1.2.3:50000",
+			want:   "alice",
+		},
+		{
+			name:   "source address refused",
+			signer: ca,
+			edit: func(c *gossh.Certificate) {
+				c.ValidPrincipals = []string{"alice"}
+				c.CriticalOptions = map[string]string{"source-address": "192.0.2.1,10.0.0.0/8"}
+			},
+			remote:  "198.51.100.7:50000",
+			wantErr: "not allowed by certificate",
+		},
+		{
+			name:   "unknown critical option",
+			signer: ca,
+			edit: func(c *gossh.Certificate) {
+				c.ValidPrincipals = []string{"alice"}
+				c.CriticalOptions = map[string]string{"force-command": "ls"}
+			},
+			wantErr: "unsupported critical option",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cert := signCert(t, tt.signer, tt.edit)
+			remote := tt.remote
+			if remote == "" {
+				remote = "192.0.2.1:50000"
+			}
+			user, _, err := a.checkCert(newTestContext(tt.login, remote), cert)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if user.Name != tt.want {
+				t.Errorf("got user %s, want %s", user.Name, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthenticator_AuthenticateCert(t *testing.T) {
+	ca := newSigner(t)
+	cfg := &config.Config{
+		CertAuthorities: []string{string(gossh.MarshalAuthorizedKey(ca.PublicKey()))},
+		Users: []config.User{
+			{Name: "alice", Admin: true},
+			{Name: "office", From: []string{"10.0.0.0/8"}},
+		},
+	}
+	a := NewAuthenticator(cfg, nil)
+	handler := a.PublicKeyHandler()
+
+	// A valid certificate logs the mapped user in
+	ctx := newTestContext("alice", "192.0.2.1:50000")
+	cert := signCert(t, ca, func(c *gossh.Certificate) { c.ValidPrincipals = []string{"alice"} })
+	if !handler(ctx, cert) {
+		t.Fatal("expected the certificate to be accepted")
+	}
+	user := GetUserFromContext(ctx)
+	if user == nil || user.Name != "alice" || !user.IsAdmin || user.PublicKeyFP != FingerprintKey(cert.Key) {
+		t.Errorf("unexpected user: %+v", user)
+	}
+
+	// The user's from rules still apply
+	cert = signCert(t, ca, func(c *gossh.Certificate) { c.ValidPrincipals = []string{"office"} })
+	if ctx := newTestContext("office", "192.0.2.1:50000"); handler(ctx, cert) || GetUserFromContext(ctx) != nil {
+		t.Error("expected a login from outside the user's networks to be refused")
+	}
+	if ctx := newTestContext("office", "10.0.0.5:50000"); !handler(ctx, cert) {
+		t.Error("expected a login from the user's network to be accepted")
+	}
+
+	// A rejected certificate doesn't fall back to anonymous access
+	cfg.AnonymousAccess = "read-only"
+	cert = signCert(t, ca, func(c *gossh.Certificate) { c.ValidPrincipals = []string{"mallory"} })
+	if ctx := newTestContext("mallory", "192.0.2.1:50000"); handler(ctx, cert) || GetUserFromContext(ctx) != nil {
+		t.Error("expected an unmapped certificate to be refused")
+	}
+}
@@ -0,0 +1,133 @@
+package server
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/johan-st/sqlite-tui/internal/config"
+	"github.com/johan-st/sqlite-tui/internal/history"
+	"github.com/johan-st/sqlite-tui/internal/hooks"
+)
+
+// authFailureRetention is the minimum time failed attempts are kept, so
+// they can be looked into after the fact even with a short ban window.
+const authFailureRetention = 24 * time.Hour
+
+// AuthBans records failed authentication attempts in the history store and
+// temporarily bans IPs that fail too often. Bans are stored too, so they
+// survive restarts.
+type AuthBans struct {
+	config    *config.Config
+	store     *history.Store
+	hooks     *hooks.Runner // run for new bans
+	lastPrune time.Time
+	mu        sync.Mutex
+}
+
+// NewAuthBans creates the ban tracker. With a nil store nothing is recorded
+// and nobody is banned.
+func NewAuthBans(cfg *config.Config, store *history.Store) *AuthBans {
+	return &AuthBans{config: cfg, store: store}
+}
+
+// Banned returns the active ban on the IP of addr, or nil.
+func (b *AuthBans) Banned(addr net.Addr) *history.Ban {
+	if b.store == nil {
+		return nil
+	}
+	ban, err := b.store.GetBan(remoteHost(addr))
+	if err != nil {
+		slog.Error("Failed to check IP ban", "remote", addr.String(), "err", err)
+		return nil
+	}
+	if ban == nil || !ban.Active(time.Now()) {
+		return nil
+	}
+	return ban
+}
+
+// Rejected notes a rejected key on the connection of ctx. A failure is
+// recorded once the connection closes without authenticating, so clients
+// offering several keys before the right one aren't held against, and the
+// IP is banned once it reaches the configured number of failures within
+// the window.
+func (b *AuthBans) Rejected(ctx ssh.Context, fingerprint string) {
+	if b.store == nil {
+		return
+	}
+
+	attempt, ok := ctx.Value(ctxKeyAuthAttempt).(*authAttempt)
+	if !ok {
+		attempt = &authAttempt{}
+		ctx.SetValue(ctxKeyAuthAttempt, attempt)
+		go func() {
+			<-ctx.Done()
+			if GetUserFromContext(ctx) == nil {
+				b.recordFailure(ctx.RemoteAddr(), ctx.User(), attempt.fingerprint)
+			}
+		}()
+	}
+	attempt.fingerprint = fingerprint
+}
+
+// authAttempt tracks the last rejected key of a connection.
+type authAttempt struct {
+	fingerprint string
+}
+
+func (b *AuthBans) recordFailure(addr net.Addr, userName, fingerprint string) {
+	ip := remoteHost(addr)
+	now := time.Now()
+	if err := b.store.RecordAuthFailure(ip, userName, fingerprint, now); err != nil {
+		slog.Error("Failed to record authentication failure", "remote", ip, "err", err)
+		return
+	}
+
+	maxFailures, window, duration := b.config.GetAuthBans()
+	b.prune(now, window)
+	if maxFailures <= 0 {
+		return
+	}
+
+	n, err := b.store.CountAuthFailures(ip, now.Add(-window))
+	if err != nil {
+		slog.Error("Failed to count authentication failures", "remote", ip, "err", err)
+		return
+	}
+	if n < maxFailures {
+		return
+	}
+
+	ban := &history.Ban{
+		IP:        ip,
+		Reason:    fmt.Sprintf("%d failed logins within %s", n, window),
+		Failures:  n,
+		CreatedAt: now,
+		ExpiresAt: now.Add(duration),
+	}
+	if err := b.store.BanIP(ban); err != nil {
+		slog.Error("Failed to ban IP", "remote", ip, "err", err)
+		return
+	}
+	slog.Warn("Banned IP", "remote", ip, "failures", n, "until", ban.ExpiresAt.Format(time.RFC3339))
+	b.hooks.Fire(&hooks.Event{Event: hooks.Ban, User: userName, RemoteAddr: ip, Details: ban})
+}
+
+// prune drops old failed attempts, at most once an hour.
+func (b *AuthBans) prune(now time.Time, window time.Duration) {
+	b.mu.Lock()
+	if now.Sub(b.lastPrune) < time.Hour {
+		b.mu.Unlock()
+		return
+	}
+	b.lastPrune = now
+	b.mu.Unlock()
+
+	if _, err := b.store.PruneAuthFailures(now.Add(-max(window, authFailureRetention))); err != nil {
+		slog.Error("Failed to prune authentication failures", "err", err)
+	}
+}
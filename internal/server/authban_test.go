@@ -0,0 +1,116 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/johan-st/sqlite-tui/internal/config"
+	"github.com/johan-st/sqlite-tui/internal/history"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// connect runs a connection from remote through handler, offering keys in
+// turn until one is accepted, then closes it. It reports whether a key was
+// accepted.
+func connect(handler func(*testContext, gossh.PublicKey) bool, remote string, keys ...gossh.PublicKey) bool {
+	ctx := newTestContext("alice", remote)
+	base, cancel := context.WithCancel(context.Background())
+	ctx.Context = base
+	defer cancel()
+	for _, key := range keys {
+		if handler(ctx, key) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestAuthBans(t *testing.T) {
+	store, err := history.NewStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	good, bad := newSigner(t).PublicKey(), newSigner(t).PublicKey()
+	cfg := &config.Config{
+		AnonymousAccess: "none",
+		AuthBans:        config.AuthBanConfig{MaxFailures: 3, Window: "1m", Duration: "1h"},
+		Users: []config.User{{
+			Name:       "alice",
+			PublicKeys: []string{string(gossh.MarshalAuthorizedKey(good))},
+		}},
+	}
+	a := NewAuthenticator(cfg, store)
+	pk := a.PublicKeyHandler()
+	handler := func(ctx *testContext, key gossh.PublicKey) bool { return pk(ctx, key) }
+	failures := func(ip string) int {
+		n, err := store.CountAuthFailures(ip, time.Now().Add(-time.Minute))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	// Keys tried before the right one aren't held against the client
+	if !connect(handler, "192.0.2.1:50000", bad, bad, good) {
+		t.Fatal("expected the good key to be accepted")
+	}
+
+	// A connection that never gets in counts once, however many keys it
+	// offers
+	if connect(handler, "192.0.2.1:50000", bad, bad, bad) {
+		t.Fatal("expected the bad key to be refused")
+	}
+	waitFor(t, "the failure to be recorded", func() bool { return failures("192.0.2.1") == 1 })
+	addr := &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 50000}
+	if a.bans.Banned(addr) != nil {
+		t.Fatal("expected no ban below the threshold")
+	}
+
+	// The third failed connection bans the IP, even for the right key
+	connect(handler, "192.0.2.1:50001", bad)
+	connect(handler, "192.0.2.1:50002", bad)
+	waitFor(t, "the ban", func() bool { return a.bans.Banned(addr) != nil })
+	ban := a.bans.Banned(addr)
+	if ban.Failures != 3 || ban.ExpiresAt.Sub(ban.CreatedAt) != time.Hour {
+		t.Errorf("unexpected ban: %+v", ban)
+	}
+	if connect(handler, "192.0.2.1:50003", good) {
+		t.Error("expected the banned IP to be refused")
+	}
+	if !connect(handler, "198.51.100.7:50000", good) {
+		t.Error("expected other IPs to get in")
+	}
+
+	// Bans lapse once they expire
+	ban.ExpiresAt = time.Now().Add(-time.Second)
+	if err := store.BanIP(ban); err != nil {
+		t.Fatal(err)
+	}
+	if a.bans.Banned(addr) != nil {
+		t.Error("expected the expired ban to be ignored")
+	}
+
+	// With no threshold failures are still recorded, but nobody is banned
+	cfg.AuthBans.MaxFailures = 0
+	for i := range 3 {
+		connect(handler, fmt.Sprintf("203.0.113.9:%d", 50000+i), bad)
+	}
+	waitFor(t, "the failures to be recorded", func() bool { return failures("203.0.113.9") == 3 })
+	if ban, _ := store.GetBan("203.0.113.9"); ban != nil {
+		t.Errorf("expected no ban with bans disabled, got %+v", ban)
+	}
+}
+
+func TestAuthBans_NoStore(t *testing.T) {
+	b := NewAuthBans(&config.Config{AuthBans: config.AuthBanConfig{MaxFailures: 1}}, nil)
+	ctx := newTestContext("alice", "192.0.2.1:50000")
+	b.Rejected(ctx, "SHA256:test")
+	if b.Banned(ctx.RemoteAddr()) != nil {
+		t.Error("expected nobody to be banned without a store")
+	}
+}
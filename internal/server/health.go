@@ -0,0 +1,137 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/johan-st/sqlite-tui/internal/database"
+	"github.com/johan-st/sqlite-tui/internal/history"
+)
+
+// healthTimeout bounds how long a single health check may take.
+const healthTimeout = 5 * time.Second
+
+// HealthCheck is the result of a single health check.
+type HealthCheck struct {
+	Name    string `json:"name"`
+	OK      bool   `json:"ok"`
+	Message string `json:"message,omitempty"`
+}
+
+// HealthReport is the combined result of all health checks.
+type HealthReport struct {
+	Status string        `json:"status"` // "ok" or "fail"
+	Time   time.Time     `json:"time"`
+	Checks []HealthCheck `json:"checks"`
+}
+
+// OK reports whether every check passed.
+func (r *HealthReport) OK() bool {
+	return r.Status == "ok"
+}
+
+// CheckHealth verifies that discovery is running, the history store is
+// writable and a sample database opens. historyStore may be nil in local
+// mode, in which case its check is skipped.
+func CheckHealth(ctx context.Context, dbManager *database.Manager, historyStore *history.Store) *HealthReport {
+	report := &HealthReport{Status: "ok", Time: time.Now()}
+	add := func(name string, err error, okMsg string) {
+		check := HealthCheck{Name: name, OK: err == nil, Message: okMsg}
+		if err != nil {
+			check.Message = err.Error()
+			report.Status = "fail"
+		}
+		report.Checks = append(report.Checks, check)
+	}
+
+	discovery := dbManager.GetDiscovery()
+	databases := discovery.GetDatabases()
+	if discovery.Running() {
+		add("discovery", nil, fmt.Sprintf("%d databases, %d connections open", len(databases), dbManager.OpenConnections()))
+	} else {
+		add("discovery", fmt.Errorf("not running"), "")
+	}
+
+	if historyStore != nil {
+		ctx, cancel := context.WithTimeout(ctx, healthTimeout)
+		err := historyStore.CheckWritable(ctx)
+		cancel()
+		add("history", err, "writable")
+	}
+
+	if len(databases) == 0 {
+		add("database", nil, "no databases discovered")
+	} else {
+		// Check the same database every time so results are comparable
+		sort.Slice(databases, func(i, j int) bool { return databases[i].Path < databases[j].Path })
+		sample := databases[0]
+		add("database", openSample(sample), sample.Alias+" opens")
+	}
+
+	return report
+}
+
+// openSample opens a database read-only on a fresh connection and reads
+// its schema.
+func openSample(db *database.DiscoveredDatabase) error {
+	opts := database.DefaultOpenOptions()
+	opts.ReadOnly = true
+	opts.Key = db.Key
+	conn, err := database.Open(db.Path, opts)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var n int
+	return conn.QueryRow("SELECT COUNT(*) FROM sqlite_master").Scan(&n)
+}
+
+// HealthHandler serves CheckHealth as JSON: 200 when healthy, 503 otherwise.
+func HealthHandler(dbManager *database.Manager, historyStore *history.Store) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		report := CheckHealth(r.Context(), dbManager, historyStore)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		if !report.OK() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		if r.Method == http.MethodGet {
+			json.NewEncoder(w).Encode(report)
+		}
+	})
+}
+
+// startHealthServer serves /healthz on the configured address, if any.
+func (s *Server) startHealthServer() {
+	addr := s.config.Server.Health.Listen
+	if addr == "" {
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/healthz", HealthHandler(s.dbManager, s.historyStore))
+	s.healthServer = &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	slog.Info("Starting health endpoint", "url", "http://"+addr+"/healthz")
+	go func() {
+		if err := s.healthServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			slog.Error("Health endpoint error", "err", err)
+		}
+	}()
+}
@@ -0,0 +1,338 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/keygen"
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+const (
+	// pendingKeyInfix separates a host key path from the activation time of
+	// its replacement: <path>.next-20060102T150405Z
+	pendingKeyInfix  = ".next-"
+	pendingKeyLayout = "20060102T150405Z"
+
+	// hostKeyCheckInterval is how often pending keys are checked for
+	// activation
+	hostKeyCheckInterval = time.Minute
+)
+
+// HostKeyInfo describes a host key.
+type HostKeyInfo struct {
+	Path        string    `json:"path"`
+	Type        string    `json:"type"`
+	Fingerprint string    `json:"fingerprint"`
+	PublicKey   string    `json:"public_key"`
+	Status      string    `json:"status"` // "active" or "pending"
+	ActivatesAt time.Time `json:"activates_at,omitzero"`
+}
+
+// HostKeyManager loads the server's host keys and rotates them. Only one
+// key per type is served, so a rotation writes the new key next to the
+// current one as <path>.next-<time>. The current key stays in use until
+// then, giving clients time to learn the new key; at that time the new key
+// replaces it and the old one is kept as <path>.old.
+type HostKeyManager struct {
+	paths []string
+	srv   *ssh.Server
+	stop  chan struct{}
+	mu    sync.Mutex
+}
+
+// NewHostKeyManager creates a manager for the given host key files.
+func NewHostKeyManager(paths []string) *HostKeyManager {
+	return &HostKeyManager{paths: paths, stop: make(chan struct{})}
+}
+
+// keyTypeForPath picks the type of a new key from its file name, following
+// the ssh_host_<type>_key convention. Ed25519 is the default.
+func keyTypeForPath(path string) keygen.KeyType {
+	name := strings.ToLower(filepath.Base(path))
+	switch {
+	case strings.Contains(name, "rsa"):
+		return keygen.RSA
+	case strings.Contains(name, "ecdsa"):
+		return keygen.ECDSA
+	default:
+		return keygen.Ed25519
+	}
+}
+
+// loadKey reads a key pair, generating it first if missing.
+func loadKey(path string, keyType keygen.KeyType) (*keygen.KeyPair, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create host key directory: %w", err)
+	}
+	kp, err := keygen.New(path, keygen.WithKeyType(keyType), keygen.WithWrite())
+	if err != nil {
+		return nil, fmt.Errorf("failed to load host key %s: %w", path, err)
+	}
+	return kp, nil
+}
+
+// option loads every host key, activating replacements that are due, and
+// adds them to the server.
+func (m *HostKeyManager) option() ssh.Option {
+	return func(srv *ssh.Server) error {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		seen := make(map[string]string)
+		for _, path := range m.paths {
+			if err := m.activatePending(path, time.Now()); err != nil {
+				return err
+			}
+			kp, err := loadKey(path, keyTypeForPath(path))
+			if err != nil {
+				return err
+			}
+			keyType := kp.PublicKey().Type()
+			if other, ok := seen[keyType]; ok {
+				return fmt.Errorf("host keys %s and %s are both %s; only one key per type can be served", other, path, keyType)
+			}
+			seen[keyType] = path
+			srv.AddHostKey(kp.Signer())
+		}
+		m.srv = srv
+		return nil
+	}
+}
+
+// run activates pending keys as they come due, until Close.
+func (m *HostKeyManager) run() {
+	ticker := time.NewTicker(hostKeyCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			m.mu.Lock()
+			for _, path := range m.paths {
+				if err := m.activatePending(path, time.Now()); err != nil {
+					slog.Error("Failed to activate host key", "path", path, "err", err)
+				}
+			}
+			m.mu.Unlock()
+		case <-m.stop:
+			return
+		}
+	}
+}
+
+// Close stops activating pending keys.
+func (m *HostKeyManager) Close() {
+	select {
+	case <-m.stop:
+	default:
+		close(m.stop)
+	}
+}
+
+// pendingKey is a generated replacement for a host key.
+type pendingKey struct {
+	path        string
+	activatesAt time.Time
+}
+
+// pendingKeys returns the pending replacements for path, oldest first.
+func pendingKeys(path string) ([]pendingKey, error) {
+	matches, err := filepath.Glob(path + pendingKeyInfix + "*")
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []pendingKey
+	for _, match := range matches {
+		t, err := time.Parse(pendingKeyLayout, strings.TrimPrefix(match, path+pendingKeyInfix))
+		if err != nil {
+			continue // .pub files and strays
+		}
+		pending = append(pending, pendingKey{path: match, activatesAt: t})
+	}
+	sort.Slice(pending, func(i, j int) bool { return pending[i].activatesAt.Before(pending[j].activatesAt) })
+	return pending, nil
+}
+
+// activatePending moves the latest due replacement of path into place and,
+// when the server is running, starts serving it. Must be called with m.mu
+// held.
+func (m *HostKeyManager) activatePending(path string, now time.Time) error {
+	pending, err := pendingKeys(path)
+	if err != nil {
+		return err
+	}
+
+	due := -1
+	for i, p := range pending {
+		if !p.activatesAt.After(now) {
+			due = i
+		}
+	}
+	if due < 0 {
+		return nil
+	}
+
+	if _, err := os.Stat(path); err == nil {
+		if err := renameKeyPair(path, path+".old"); err != nil {
+			return err
+		}
+	}
+	if err := renameKeyPair(pending[due].path, path); err != nil {
+		return err
+	}
+	// Replacements overtaken by a later one are dropped
+	for _, p := range pending[:due] {
+		os.Remove(p.path)
+		os.Remove(p.path + ".pub")
+	}
+
+	kp, err := loadKey(path, keyTypeForPath(path))
+	if err != nil {
+		return err
+	}
+	if m.srv != nil {
+		m.srv.AddHostKey(kp.Signer())
+	}
+	slog.Info("Activated new host key", "path", path, "fingerprint", FingerprintKey(kp.PublicKey()))
+	return nil
+}
+
+// renameKeyPair renames a private key and its .pub file.
+func renameKeyPair(from, to string) error {
+	if err := os.Rename(from, to); err != nil {
+		return fmt.Errorf("failed to move host key: %w", err)
+	}
+	if err := os.Rename(from+".pub", to+".pub"); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to move host public key: %w", err)
+	}
+	return nil
+}
+
+// List returns the active and pending host keys.
+func (m *HostKeyManager) List() ([]HostKeyInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var keys []HostKeyInfo
+	for _, path := range m.paths {
+		info, err := readHostKeyInfo(path)
+		if err != nil {
+			return nil, err
+		}
+		info.Status = "active"
+		keys = append(keys, *info)
+
+		pending, err := pendingKeys(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range pending {
+			info, err := readHostKeyInfo(p.path)
+			if err != nil {
+				return nil, err
+			}
+			info.Status = "pending"
+			info.ActivatesAt = p.activatesAt
+			keys = append(keys, *info)
+		}
+	}
+	return keys, nil
+}
+
+// Rotate generates a replacement for the host key of the given type (the
+// first configured key if empty) that becomes active after grace. During
+// the grace period the current key is still served.
+func (m *HostKeyManager) Rotate(keyType string, grace time.Duration) (*HostKeyInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	path := ""
+	for _, p := range m.paths {
+		if keyType == "" || string(keyTypeForPath(p)) == keyType {
+			path = p
+			break
+		}
+	}
+	if path == "" {
+		return nil, fmt.Errorf("no %s host key configured", keyType)
+	}
+
+	if pending, err := pendingKeys(path); err != nil {
+		return nil, err
+	} else if len(pending) > 0 {
+		return nil, fmt.Errorf("a rotation of %s is already pending", path)
+	}
+
+	activatesAt := time.Now().Add(grace).UTC().Truncate(time.Second)
+	next := path + pendingKeyInfix + activatesAt.Format(pendingKeyLayout)
+	if _, err := loadKey(next, keyTypeForPath(path)); err != nil {
+		return nil, err
+	}
+
+	if grace <= 0 {
+		if err := m.activatePending(path, activatesAt); err != nil {
+			return nil, err
+		}
+		info, err := readHostKeyInfo(path)
+		if err != nil {
+			return nil, err
+		}
+		info.Status = "active"
+		return info, nil
+	}
+
+	info, err := readHostKeyInfo(next)
+	if err != nil {
+		return nil, err
+	}
+	info.Status = "pending"
+	info.ActivatesAt = activatesAt
+	return info, nil
+}
+
+// readHostKeyInfo describes the host key at path from its private key.
+func readHostKeyInfo(path string) (*HostKeyInfo, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read host key: %w", err)
+	}
+	signer, err := gossh.ParsePrivateKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse host key %s: %w", path, err)
+	}
+	pub := signer.PublicKey()
+	return &HostKeyInfo{
+		Path:        path,
+		Type:        pub.Type(),
+		Fingerprint: FingerprintKey(pub),
+		PublicKey:   strings.TrimSpace(string(gossh.MarshalAuthorizedKey(pub))),
+	}, nil
+}
+
+// HostKeyMiddleware makes the host key manager available to admin commands.
+func HostKeyMiddleware(hostKeys *HostKeyManager) wish.Middleware {
+	return func(next ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			s.Context().SetValue(ctxKeyHostKeys, hostKeys)
+			next(s)
+		}
+	}
+}
+
+// GetHostKeysFromSSH retrieves the host key manager from the SSH session context.
+func GetHostKeysFromSSH(s ssh.Session) *HostKeyManager {
+	if hk, ok := s.Context().Value(ctxKeyHostKeys).(*HostKeyManager); ok {
+		return hk
+	}
+	return nil
+}
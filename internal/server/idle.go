@@ -0,0 +1,158 @@
+package server
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/charmbracelet/ssh"
+)
+
+// idleConn closes a connection when the client has sent nothing for the
+// idle timeout, warning its sessions beforehand so users can press a key
+// to stay connected. Only client traffic counts as activity: keystrokes,
+// window resizes, keepalives, and the flow-control messages a client sends
+// while reading output. Unlike wish's idle timeout, which any write
+// extends, the warnings themselves don't keep the connection alive.
+type idleConn struct {
+	net.Conn
+	lastRead atomic.Int64 // unix nanoseconds
+
+	mu          sync.Mutex
+	subscribers map[chan time.Time]struct{}
+}
+
+// newIdleConn wraps conn and enforces the idle timeout until ctx is done.
+func newIdleConn(ctx ssh.Context, conn net.Conn, timeout, warning time.Duration) *idleConn {
+	c := &idleConn{Conn: conn, subscribers: make(map[chan time.Time]struct{})}
+	c.lastRead.Store(time.Now().UnixNano())
+	ctx.SetValue(ctxKeyIdleConn, c)
+	go c.watch(ctx, timeout, min(warning, timeout/2))
+	return c
+}
+
+func (c *idleConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		c.lastRead.Store(time.Now().UnixNano())
+	}
+	return n, err
+}
+
+func (c *idleConn) lastActivity() time.Time {
+	return time.Unix(0, c.lastRead.Load())
+}
+
+// watch warns subscribers once the connection has been idle for timeout
+// minus warning, tells them when activity resumes, and closes the
+// connection at the timeout.
+func (c *idleConn) watch(ctx ssh.Context, timeout, warning time.Duration) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	var warned time.Time // deadline subscribers were last warned about
+	for {
+		last := c.lastActivity()
+		deadline := last.Add(timeout)
+		warnAt := deadline.Add(-warning)
+
+		var wait time.Duration
+		switch now := time.Now(); {
+		case !now.Before(deadline):
+			slog.Info("Closing idle connection", "remote", c.RemoteAddr().String(), "idle", now.Sub(last).Round(time.Second))
+			c.Close()
+			return
+		case warning > 0 && !now.Before(warnAt):
+			if !warned.Equal(deadline) {
+				warned = deadline
+				c.notify(deadline)
+			}
+			// Check often, so a key press clears the warning promptly
+			wait = min(time.Second, deadline.Sub(now))
+		default:
+			if !warned.IsZero() {
+				warned = time.Time{}
+				c.notify(warned)
+			}
+			wait = warnAt.Sub(now)
+		}
+
+		timer.Reset(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// notify sends deadline to every subscriber, replacing an unread value.
+func (c *idleConn) notify(deadline time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for ch := range c.subscribers {
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- deadline
+	}
+}
+
+// subscribe returns a channel receiving the disconnect deadline when the
+// connection is about to be closed for inactivity, and the zero time when
+// activity resumes. The returned function unsubscribes and closes the
+// channel.
+func (c *idleConn) subscribe() (<-chan time.Time, func()) {
+	ch := make(chan time.Time, 1)
+	c.mu.Lock()
+	c.subscribers[ch] = struct{}{}
+	c.mu.Unlock()
+	return ch, func() {
+		c.mu.Lock()
+		delete(c.subscribers, ch)
+		c.mu.Unlock()
+		close(ch)
+	}
+}
+
+// subscribeIdle subscribes to idle warnings for the connection of s. The
+// channel is nil when there is no idle timeout.
+func subscribeIdle(s ssh.Session) (<-chan time.Time, func()) {
+	c, ok := s.Context().Value(ctxKeyIdleConn).(*idleConn)
+	if !ok {
+		return nil, func() {}
+	}
+	return c.subscribe()
+}
+
+// printIdleWarnings writes idle warnings for a CLI session to stderr.
+func printIdleWarnings(s ssh.Session, warnings <-chan time.Time) {
+	action := "press Enter"
+	if _, _, isPty := s.Pty(); isPty {
+		action = "press any key"
+	}
+	for deadline := range warnings {
+		if !deadline.IsZero() {
+			fmt.Fprintf(s.Stderr(), "\r\n%s\r\n", FormatIdleWarning(deadline, action))
+		}
+	}
+}
+
+// GetIdleWarningsFromSSH returns the idle warnings for the session, see
+// idleConn.subscribe; nil when there is no idle timeout.
+func GetIdleWarningsFromSSH(s ssh.Session) <-chan time.Time {
+	if ch, ok := s.Context().Value(ctxKeyIdleWarnings).(<-chan time.Time); ok {
+		return ch
+	}
+	return nil
+}
+
+// FormatIdleWarning describes a pending idle disconnect.
+func FormatIdleWarning(deadline time.Time, action string) string {
+	remaining := max(time.Until(deadline).Round(time.Second), 0)
+	return fmt.Sprintf("Idle: disconnecting in %s, %s to stay connected", remaining, action)
+}
@@ -0,0 +1,145 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/johan-st/sqlite-tui/internal/config"
+)
+
+// nextWarning returns the next idle warning, failing after a while.
+func nextWarning(t *testing.T, warnings <-chan time.Time) time.Time {
+	t.Helper()
+	select {
+	case deadline := <-warnings:
+		return deadline
+	case <-time.After(3 * time.Second):
+		t.Fatal("no idle warning")
+		return time.Time{}
+	}
+}
+
+func TestIdleConn_WarnThenDisconnect(t *testing.T) {
+	client, conn := net.Pipe()
+	defer client.Close()
+	ctx := newTestContext("alice", "192.0.2.1:50000")
+	base, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ctx.Context = base
+
+	start := time.Now()
+	c := newIdleConn(ctx, conn, 600*time.Millisecond, time.Minute)
+	warnings, unsubscribe := subscribeIdle(testSession{ctx: ctx})
+	defer unsubscribe()
+	if warnings == nil {
+		t.Fatal("expected idle warnings for the connection")
+	}
+
+	// The server reads what the client sends, until the connection closes
+	closed := make(chan time.Time, 1)
+	go func() {
+		io.Copy(io.Discard, c)
+		closed <- time.Now()
+	}()
+	go io.Copy(io.Discard, client)
+
+	// The warning comes at most half the timeout before the disconnect
+	deadline := nextWarning(t, warnings)
+	if deadline.IsZero() || deadline.Before(start.Add(600*time.Millisecond)) {
+		t.Fatalf("unexpected deadline %v, connected at %v", deadline, start)
+	}
+	if elapsed := time.Since(start); elapsed < 300*time.Millisecond {
+		t.Errorf("warned after %v, want at most half the timeout before it", elapsed)
+	}
+
+	// Client activity postpones the deadline. With a timeout this short the
+	// watcher may warn again before it gets to clear the warning.
+	if _, err := client.Write([]byte("x")); err != nil {
+		t.Fatal(err)
+	}
+	next := nextWarning(t, warnings)
+	if next.IsZero() {
+		next = nextWarning(t, warnings)
+	}
+	if !next.After(deadline) {
+		t.Fatalf("expected a later deadline than %v, got %v", deadline, next)
+	}
+	deadline = next
+
+	// Output to the client isn't activity: the next warning is followed by
+	// the disconnect
+	if _, err := c.Write([]byte("Idle: disconnecting soon")); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case at := <-closed:
+		if at.Before(deadline.Add(-50 * time.Millisecond)) {
+			t.Errorf("closed at %v, before the deadline %v", at, deadline)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("idle connection wasn't closed")
+	}
+}
+
+func TestIdleConn_StopsWithContext(t *testing.T) {
+	client, conn := net.Pipe()
+	defer client.Close()
+	ctx := newTestContext("alice", "192.0.2.1:50000")
+	base, cancel := context.WithCancel(context.Background())
+	ctx.Context = base
+
+	newIdleConn(ctx, conn, 100*time.Millisecond, 0)
+	cancel()
+	time.Sleep(300 * time.Millisecond)
+
+	// The connection outlived the timeout once its context ended
+	done := make(chan error, 1)
+	go func() {
+		_, err := conn.Write([]byte("x"))
+		done <- err
+	}()
+	buf := make([]byte, 1)
+	if _, err := client.Read(buf); err != nil {
+		t.Errorf("expected the connection to stay open, got %v", err)
+	}
+	<-done
+}
+
+func TestServer_WrapConnIdleTimeout(t *testing.T) {
+	cfg := &config.Config{}
+	s := &Server{config: cfg, authenticator: NewAuthenticator(cfg, nil)}
+
+	for _, tt := range []struct {
+		timeout string
+		idle    bool
+	}{
+		{"0", false},
+		{"1m", true},
+	} {
+		cfg.Server.SSH.IdleTimeout = tt.timeout
+		cfg.Server.SSH.IdleWarning = "10s"
+		client, conn := net.Pipe()
+		ctx := newTestContext("alice", "192.0.2.1:50000")
+		base, cancel := context.WithCancel(context.Background())
+		ctx.Context = base
+
+		wrapped := s.wrapConn(ctx, conn)
+		if _, ok := wrapped.(*idleConn); ok != tt.idle {
+			t.Errorf("idle timeout %s: got %T", tt.timeout, wrapped)
+		}
+		cancel()
+		client.Close()
+	}
+}
+
+func TestFormatIdleWarning(t *testing.T) {
+	if got := FormatIdleWarning(time.Now().Add(90*time.Second), "press any key"); got != "Idle: disconnecting in 1m30s, press any key to stay connected" {
+		t.Errorf("unexpected warning %q", got)
+	}
+	if got := FormatIdleWarning(time.Now().Add(-time.Second), "press Enter"); got != "Idle: disconnecting in 0s, press Enter to stay connected" {
+		t.Errorf("unexpected warning past the deadline %q", got)
+	}
+}
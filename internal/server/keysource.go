@@ -0,0 +1,161 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/johan-st/sqlite-tui/internal/config"
+)
+
+const (
+	// keyFetchTimeout bounds a single key fetch
+	keyFetchTimeout = 10 * time.Second
+	// maxKeysSize caps the size of a fetched key list
+	maxKeysSize = 1 << 20
+)
+
+// After a failed fetch the source isn't asked again for keyRetryBackoff,
+// doubled for each further failure up to keyRetryMaxBackoff, so logins
+// during an outage don't each hit the code host.
+var (
+	keyRetryBackoff    = 30 * time.Second
+	keyRetryMaxBackoff = 30 * time.Minute
+)
+
+// KeyFetcher fetches and caches user keys from code hosts (public_keys_from).
+// Stale keys are served while a refresh runs in the background, and kept
+// when a refresh fails, so an outage at the code host doesn't lock users out.
+// Failed sources are retried with backoff; until one succeeds, it has no
+// keys.
+type KeyFetcher struct {
+	config *config.Config
+	client *http.Client
+	cache  map[string]*fetchedKeys
+	mu     sync.Mutex
+}
+
+type fetchedKeys struct {
+	keys     []string
+	fetched  time.Time
+	fetching bool
+	done     chan struct{} // closed when the first fetch finishes
+
+	failed   time.Time // when the last fetch failed
+	failures int       // fetches failed in a row
+}
+
+// NewKeyFetcher creates a key fetcher using the refresh interval from cfg.
+func NewKeyFetcher(cfg *config.Config) *KeyFetcher {
+	return &KeyFetcher{
+		config: cfg,
+		client: &http.Client{Timeout: keyFetchTimeout},
+		cache:  make(map[string]*fetchedKeys),
+	}
+}
+
+// Keys returns the keys for a source such as "github:alice". The first call
+// for a source waits for the fetch; later calls return cached keys and
+// refresh them in the background once they are older than the refresh
+// interval.
+func (f *KeyFetcher) Keys(source string) []string {
+	f.mu.Lock()
+	entry, ok := f.cache[source]
+	if !ok {
+		entry = &fetchedKeys{done: make(chan struct{})}
+		f.cache[source] = entry
+	}
+	stale := time.Since(entry.fetched) >= f.config.GetKeyRefresh()
+	if stale && !entry.fetching && !entry.backingOff() {
+		entry.fetching = true
+		go f.refresh(source, entry)
+	}
+	f.mu.Unlock()
+
+	<-entry.done
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return entry.keys
+}
+
+// backingOff reports whether entry failed too recently to fetch again. The
+// caller holds f.mu.
+func (e *fetchedKeys) backingOff() bool {
+	if e.failures == 0 {
+		return false
+	}
+	backoff := keyRetryBackoff << min(e.failures-1, 16)
+	return time.Since(e.failed) < min(backoff, keyRetryMaxBackoff)
+}
+
+// Prefetch fetches the keys of every user with public_keys_from in the
+// background, so their first login doesn't wait for the code host.
+func (f *KeyFetcher) Prefetch() {
+	for _, user := range f.config.Users {
+		if user.PublicKeysFrom != "" {
+			go f.Keys(user.PublicKeysFrom)
+		}
+	}
+}
+
+// refresh fetches the keys for source and updates entry.
+func (f *KeyFetcher) refresh(source string, entry *fetchedKeys) {
+	keys, err := f.fetch(source)
+
+	f.mu.Lock()
+	entry.fetching = false
+	if err != nil {
+		entry.failed = time.Now()
+		entry.failures++
+		slog.Warn("Failed to fetch keys", "source", source, "err", err, "failures", entry.failures)
+	} else {
+		entry.keys = keys
+		entry.fetched = time.Now()
+		entry.failures = 0
+		slog.Debug("Fetched keys", "source", source, "keys", len(keys))
+	}
+	select {
+	case <-entry.done:
+	default:
+		close(entry.done)
+	}
+	f.mu.Unlock()
+}
+
+// fetch downloads the authorized_keys list for source.
+func (f *KeyFetcher) fetch(source string) ([]string, error) {
+	url, err := config.KeySourceURL(source)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), keyFetchTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "sqlite-tui")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", url, resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxKeysSize))
+	if err != nil {
+		return nil, err
+	}
+	return config.ParseAuthorizedKeys(data), nil
+}
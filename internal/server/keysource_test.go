@@ -0,0 +1,93 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/johan-st/sqlite-tui/internal/config"
+)
+
+const testKey = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIHfAcE2Z0Of4B7zMGqNxKJd6ETWH3Es4N1gO3lZxEPkx alice@example.com"
+
+// hostTransport sends every request to a test server, whatever its URL.
+type hostTransport struct {
+	target *url.URL
+}
+
+func (t hostTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme, req.URL.Host = t.target.Scheme, t.target.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// waitFor polls cond until it holds or a second passes.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); !cond(); time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+	}
+}
+
+func TestKeyFetcher_Backoff(t *testing.T) {
+	defer func(d time.Duration) { keyRetryBackoff = d }(keyRetryBackoff)
+	keyRetryBackoff = 200 * time.Millisecond
+
+	var hits, failing atomic.Int32
+	failing.Store(1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		if failing.Load() == 1 {
+			http.Error(w, "down", http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte(testKey + "\n"))
+	}))
+	defer ts.Close()
+	target, _ := url.Parse(ts.URL)
+
+	// Keys go stale at once, so only the backoff holds off fetches
+	cfg := &config.Config{}
+	cfg.Server.SSH.KeyRefresh = "1ns"
+	f := NewKeyFetcher(cfg)
+	f.client.Transport = hostTransport{target}
+
+	// A source that never answered has no keys, and isn't asked again
+	// until the backoff passes
+	for range 5 {
+		if keys := f.Keys("github:alice"); len(keys) != 0 {
+			t.Fatalf("expected no keys, got %q", keys)
+		}
+	}
+	if n := hits.Load(); n != 1 {
+		t.Errorf("expected one fetch during the backoff, got %d", n)
+	}
+
+	// Once the backoff passes, a fetch gets the keys
+	failing.Store(0)
+	time.Sleep(keyRetryBackoff)
+	waitFor(t, "the keys", func() bool { return slices.Contains(f.Keys("github:alice"), testKey) })
+
+	// The last good keys are served while the source fails again
+	failing.Store(1)
+	before := hits.Load()
+	waitFor(t, "a failed refresh", func() bool {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		return f.cache["github:alice"].failures == 1
+	})
+	for range 5 {
+		if keys := f.Keys("github:alice"); !slices.Contains(keys, testKey) {
+			t.Fatalf("expected the last good keys, got %q", keys)
+		}
+	}
+	if n := hits.Load() - before; n != 1 {
+		t.Errorf("expected one failed fetch during the backoff, got %d", n)
+	}
+}
@@ -0,0 +1,133 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/ssh"
+)
+
+// listenFDsStart is the first file descriptor passed by systemd. It's a
+// variable for tests.
+var listenFDsStart = 3
+
+// listen opens a listener for every configured address. "unix:/path"
+// addresses listen on a unix socket, replacing a stale socket file. When
+// systemd passes sockets (socket activation), those are used instead.
+func listen(addrs []string) ([]net.Listener, error) {
+	activated, err := activationListeners()
+	if err != nil {
+		return nil, err
+	}
+	if len(activated) > 0 {
+		if len(addrs) > 0 {
+			slog.Info("Using sockets from systemd instead of server.ssh.listen", "count", len(activated))
+		}
+		return activated, nil
+	}
+
+	if len(addrs) == 0 {
+		return nil, errors.New("no listen address configured")
+	}
+
+	var listeners []net.Listener
+	for _, addr := range addrs {
+		l, err := listenAddr(addr)
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, fmt.Errorf("failed to listen on %s: %w", addr, err)
+		}
+		listeners = append(listeners, l)
+	}
+	return listeners, nil
+}
+
+// activationListeners returns the sockets passed by systemd socket
+// activation, if any. The LISTEN_* variables are cleared so that child
+// processes such as hooks don't pick the sockets up.
+func activationListeners() ([]net.Listener, error) {
+	pid, fds := os.Getenv("LISTEN_PID"), os.Getenv("LISTEN_FDS")
+	if fds == "" {
+		return nil, nil
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	// The sockets are meant for another process
+	if pid != strconv.Itoa(os.Getpid()) {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(fds)
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("invalid LISTEN_FDS %q", fds)
+	}
+
+	var listeners []net.Listener
+	for i := range n {
+		name := "LISTEN_FD_" + strconv.Itoa(listenFDsStart+i)
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+		f := os.NewFile(uintptr(listenFDsStart+i), name)
+		l, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, fmt.Errorf("socket %s from systemd is not a listening stream socket: %w", name, err)
+		}
+		listeners = append(listeners, l)
+	}
+	return listeners, nil
+}
+
+func listenAddr(addr string) (net.Listener, error) {
+	path, ok := strings.CutPrefix(addr, "unix:")
+	if !ok {
+		return net.Listen("tcp", addr)
+	}
+
+	// A socket left behind by a crash blocks the new listener
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, errors.New("socket is in use")
+		}
+		os.Remove(path)
+	}
+	return net.Listen("unix", path)
+}
+
+// serve serves server on every listener and returns when the first one
+// stops.
+func serve(server *ssh.Server, listeners []net.Listener) error {
+	errs := make(chan error, len(listeners))
+	for _, l := range listeners {
+		go func(l net.Listener) {
+			errs <- server.Serve(l)
+		}(l)
+	}
+	return <-errs
+}
+
+// listenerAddrs returns the addresses of listeners for display.
+func listenerAddrs(listeners []net.Listener) string {
+	addrs := make([]string, len(listeners))
+	for i, l := range listeners {
+		addrs[i] = l.Addr().String()
+		if l.Addr().Network() == "unix" {
+			addrs[i] = "unix:" + addrs[i]
+		}
+	}
+	return strings.Join(addrs, ", ")
+}
@@ -0,0 +1,130 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/ssh"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// runSSH runs a session over conn and returns its output.
+func runSSH(t *testing.T, conn net.Conn) string {
+	t.Helper()
+	cfg := &gossh.ClientConfig{User: "alice", HostKeyCallback: gossh.InsecureIgnoreHostKey(), Timeout: 5 * time.Second}
+	c, chans, reqs, err := gossh.NewClientConn(conn, conn.RemoteAddr().String(), cfg)
+	if err != nil {
+		t.Fatalf("SSH handshake failed: %v", err)
+	}
+	client := gossh.NewClient(c, chans, reqs)
+	defer client.Close()
+	session, err := client.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.Close()
+	out, err := session.Output("hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out)
+}
+
+func TestListen_Addresses(t *testing.T) {
+	t.Setenv("LISTEN_FDS", "")
+	sock := filepath.Join(t.TempDir(), "ssh.sock")
+
+	// A socket file left behind by a crash is replaced
+	stale, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	listeners, err := listen([]string{"127.0.0.1:0", "unix:" + sock})
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	if len(listeners) != 2 {
+		t.Fatalf("expected 2 listeners, got %d", len(listeners))
+	}
+	tcpAddr := listeners[0].Addr().String()
+	if addrs := listenerAddrs(listeners); addrs != tcpAddr+", unix:"+sock {
+		t.Errorf("listenerAddrs = %q", addrs)
+	}
+
+	// A socket in use isn't
+	if _, err := listen([]string{"unix:" + sock}); err == nil || !strings.Contains(err.Error(), "socket is in use") {
+		t.Errorf("expected a socket in use to be refused, got %v", err)
+	}
+
+	server := &ssh.Server{Handler: func(s ssh.Session) {
+		io.WriteString(s, strings.Join(s.Command(), " ")+" from "+s.LocalAddr().Network())
+	}}
+	server.AddHostKey(newSigner(t))
+	served := make(chan error, 1)
+	go func() { served <- serve(server, listeners) }()
+
+	// Both addresses serve SSH
+	for _, addr := range []struct{ network, address, want string }{
+		{"tcp", tcpAddr, "hello from tcp"},
+		{"unix", sock, "hello from unix"},
+	} {
+		conn, err := net.DialTimeout(addr.network, addr.address, 5*time.Second)
+		if err != nil {
+			t.Fatalf("failed to dial %s: %v", addr.address, err)
+		}
+		if out := runSSH(t, conn); out != addr.want {
+			t.Errorf("%s: got %q, want %q", addr.network, out, addr.want)
+		}
+	}
+
+	// Closing the server stops every listener and removes the socket
+	if err := server.Close(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-served:
+		if !errors.Is(err, ssh.ErrServerClosed) {
+			t.Errorf("serve returned %v, want ErrServerClosed", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("serve didn't return after Close")
+	}
+	if _, err := net.DialTimeout("tcp", tcpAddr, time.Second); err == nil {
+		t.Error("expected the TCP listener to be closed")
+	}
+	if _, err := os.Stat(sock); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected the socket file to be removed, got %v", err)
+	}
+}
+
+func TestListen_Errors(t *testing.T) {
+	t.Setenv("LISTEN_FDS", "")
+
+	if _, err := listen(nil); err == nil {
+		t.Error("expected an error without addresses")
+	}
+
+	// A failing address closes the listeners opened before it
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	sock := filepath.Join(t.TempDir(), "ssh.sock")
+	_, err = listen([]string{"unix:" + sock, l.Addr().String()})
+	if err == nil || !strings.Contains(err.Error(), l.Addr().String()) {
+		t.Fatalf("expected an error for the address in use, got %v", err)
+	}
+	if _, err := os.Stat(sock); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected the earlier listener to be closed, got %v", err)
+	}
+}
@@ -0,0 +1,132 @@
+//go:build !windows && !plan9
+
+package server
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/ssh"
+)
+
+// activate sets the LISTEN_* variables as systemd would to pass fd,
+// which listen takes over.
+func activate(t *testing.T, fd int, pid int) {
+	t.Helper()
+	start := listenFDsStart
+	t.Cleanup(func() { listenFDsStart = start })
+	listenFDsStart = fd
+	t.Setenv("LISTEN_PID", strconv.Itoa(pid))
+	t.Setenv("LISTEN_FDS", "1")
+	t.Setenv("LISTEN_FDNAMES", "ssh")
+}
+
+// dupFD returns a duplicate of the file descriptor behind c.
+func dupFD(t *testing.T, c syscall.Conn) int {
+	t.Helper()
+	raw, err := c.SyscallConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fd := -1
+	var dupErr error
+	if err := raw.Control(func(s uintptr) { fd, dupErr = syscall.Dup(int(s)) }); err != nil {
+		t.Fatal(err)
+	}
+	if dupErr != nil {
+		t.Fatal(dupErr)
+	}
+	return fd
+}
+
+func TestListen_SocketActivation(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	activate(t, dupFD(t, l.(*net.TCPListener)), os.Getpid())
+	l.Close()
+
+	// The socket from systemd replaces the configured addresses
+	sock := filepath.Join(t.TempDir(), "ssh.sock")
+	listeners, err := listen([]string{"unix:" + sock})
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	if len(listeners) != 1 || listeners[0].Addr().String() != addr {
+		t.Fatalf("expected the activated socket on %s, got %s", addr, listenerAddrs(listeners))
+	}
+	if _, err := os.Stat(sock); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected the configured socket not to be created, got %v", err)
+	}
+	for _, name := range []string{"LISTEN_PID", "LISTEN_FDS", "LISTEN_FDNAMES"} {
+		if v, ok := os.LookupEnv(name); ok {
+			t.Errorf("expected %s to be cleared, got %q", name, v)
+		}
+	}
+
+	server := &ssh.Server{Handler: func(s ssh.Session) { s.Write([]byte("activated")) }}
+	server.AddHostKey(newSigner(t))
+	served := make(chan error, 1)
+	go func() { served <- serve(server, listeners) }()
+
+	conn, err := net.DialTimeout("tcp", addr, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out := runSSH(t, conn); out != "activated" {
+		t.Errorf("got %q, want %q", out, "activated")
+	}
+	server.Close()
+	select {
+	case err := <-served:
+		if !errors.Is(err, ssh.ErrServerClosed) {
+			t.Errorf("serve returned %v, want ErrServerClosed", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("serve didn't return after Close")
+	}
+}
+
+func TestListen_SocketActivationErrors(t *testing.T) {
+	// Sockets meant for another process are ignored
+	activate(t, -1, os.Getpid()+1)
+	listeners, err := listen([]string{"127.0.0.1:0"})
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	if len(listeners) != 1 || listeners[0].Addr().Network() != "tcp" {
+		t.Errorf("expected the configured address, got %s", listenerAddrs(listeners))
+	}
+	for _, l := range listeners {
+		l.Close()
+	}
+	if _, ok := os.LookupEnv("LISTEN_FDS"); ok {
+		t.Error("expected LISTEN_FDS to be cleared")
+	}
+
+	activate(t, -1, os.Getpid())
+	t.Setenv("LISTEN_FDS", "two")
+	if _, err := listen([]string{"127.0.0.1:0"}); err == nil || !strings.Contains(err.Error(), "invalid LISTEN_FDS") {
+		t.Errorf("expected an invalid LISTEN_FDS error, got %v", err)
+	}
+
+	// A file that isn't a listening socket is refused
+	f, err := os.CreateTemp(t.TempDir(), "fd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	activate(t, dupFD(t, f), os.Getpid())
+	if _, err := listen([]string{"127.0.0.1:0"}); err == nil || !strings.Contains(err.Error(), "socket ssh from systemd is not a listening stream socket") {
+		t.Errorf("expected a non-socket to be refused, got %v", err)
+	}
+}
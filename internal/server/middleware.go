@@ -1,24 +1,36 @@
 package server
 
 import (
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
 
 	"github.com/charmbracelet/ssh"
 	"github.com/charmbracelet/wish"
 	"github.com/johan-st/sqlite-tui/internal/access"
 	"github.com/johan-st/sqlite-tui/internal/database"
 	"github.com/johan-st/sqlite-tui/internal/history"
+	"github.com/johan-st/sqlite-tui/internal/tracing"
 )
 
 // Context keys for middleware values
 type ctxKey string
 
 const (
-	ctxKeySession    ctxKey = "session"
-	ctxKeyUser       ctxKey = "user"
-	ctxKeyDBManager  ctxKey = "db_manager"
-	ctxKeyHistory    ctxKey = "history"
-	ctxKeySessionMgr ctxKey = "session_mgr"
+	ctxKeySession      ctxKey = "session"
+	ctxKeyUser         ctxKey = "user"
+	ctxKeyDBManager    ctxKey = "db_manager"
+	ctxKeyHistory      ctxKey = "history"
+	ctxKeySessionMgr   ctxKey = "session_mgr"
+	ctxKeyQueryLimiter ctxKey = "query_limiter"
+	ctxKeyHostKeys     ctxKey = "host_keys"
+	ctxKeyAuthAttempt  ctxKey = "auth_attempt"
+	ctxKeyIdleConn     ctxKey = "idle_conn"
+	ctxKeyIdleWarnings ctxKey = "idle_warnings"
+	ctxKeyWeb          ctxKey = "web"
+	ctxKeyAPI          ctxKey = "api"
 )
 
 // SessionMiddleware creates sessions for each connection.
@@ -36,8 +48,17 @@ func SessionMiddleware(sessionMgr *SessionManager) wish.Middleware {
 			}
 
 			session, err := sessionMgr.CreateSession(user, s.RemoteAddr().String())
+			if errors.Is(err, ErrTooManySessions) {
+				slog.Warn("Rejected session", "user", user.DisplayName(), "remote", s.RemoteAddr().String(), "err", err)
+				fmt.Fprintln(s.Stderr(), "Error:", err)
+				s.Exit(exitRateLimited)
+				return
+			}
 			if err != nil {
-				log.Printf("Failed to create session: %v", err)
+				slog.Error("Failed to create session", "err", err)
+			}
+			if session != nil {
+				session.setCloser(s)
 			}
 
 			// Store session in context
@@ -51,6 +72,26 @@ func SessionMiddleware(sessionMgr *SessionManager) wish.Middleware {
 				}
 			}()
 
+			// Anonymous sessions are disconnected after their time quota
+			if session != nil && session.quota.MaxDuration > 0 {
+				timer := time.AfterFunc(session.quota.MaxDuration, func() {
+					fmt.Fprintf(s.Stderr(), "\r\nError: %v: connected for %s\r\n", ErrQuotaExceeded, session.quota.MaxDuration)
+					s.Close()
+				})
+				defer timer.Stop()
+			}
+
+			// Trace the session; database work for it nests under this span
+			if session != nil {
+				span := tracing.StartSession(session.ID,
+					tracing.String("session.id", session.ID),
+					tracing.String("enduser.id", user.DisplayName()),
+					tracing.String("client.address", remoteHost(s.RemoteAddr())),
+					tracing.String("ssh.command", strings.Join(s.Command(), " ")),
+				)
+				defer span.End(nil)
+			}
+
 			next(s)
 		}
 	}
@@ -86,12 +127,12 @@ func LoggingMiddleware() wish.Middleware {
 				userName = user.DisplayName()
 			}
 
-			log.Printf("Connection from %s as %s (command: %v)",
-				s.RemoteAddr(), userName, s.Command())
+			start := time.Now()
+			slog.Info("Connection", "remote", s.RemoteAddr().String(), "user", userName, "command", s.Command())
 
 			next(s)
 
-			log.Printf("Disconnected: %s", s.RemoteAddr())
+			slog.Info("Disconnected", "remote", s.RemoteAddr().String(), "user", userName, "duration", time.Since(start).Round(time.Millisecond))
 		}
 	}
 }
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	"github.com/johan-st/sqlite-tui/internal/ratelimit"
+)
+
+// exitRateLimited is the exit status for rate-limited sessions, matching
+// the CLI's exit code.
+const exitRateLimited = 6
+
+// RateLimitError is returned when a client exceeds a rate limit.
+type RateLimitError = ratelimit.Error
+
+// RateLimiter is a per-key token bucket; see ratelimit.Limiter.
+type RateLimiter = ratelimit.Limiter
+
+// NewRateLimiter creates a limiter, or returns nil when perMinute is not
+// positive. A nil limiter allows everything.
+func NewRateLimiter(perMinute int) *RateLimiter {
+	return ratelimit.New(perMinute)
+}
+
+// remoteHost returns the IP of a remote address without the port.
+func remoteHost(addr net.Addr) string {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
+
+// allowConnection checks the per-IP connection limit.
+func allowConnection(limiter *RateLimiter, addr net.Addr) error {
+	host := remoteHost(addr)
+	if ok, retry := limiter.Allow(host); !ok {
+		return &RateLimitError{What: "connections from " + host, RetryAfter: retry}
+	}
+	return nil
+}
+
+// RateLimitMiddleware enforces the per-IP connection limit and makes the
+// per-user query limiter available to handlers via CheckQueryRate.
+func RateLimitMiddleware(connections, queries *RateLimiter) wish.Middleware {
+	return func(next ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			if err := allowConnection(connections, s.RemoteAddr()); err != nil {
+				fmt.Fprintln(s.Stderr(), "Error:", err)
+				s.Exit(exitRateLimited)
+				return
+			}
+			s.Context().SetValue(ctxKeyQueryLimiter, queries)
+			next(s)
+		}
+	}
+}
+
+// CheckQueryRate takes one query from the session user's budget. Users are
+// limited by name; anonymous users by IP, since their names change with
+// every session.
+func CheckQueryRate(s ssh.Session) error {
+	limiter, _ := s.Context().Value(ctxKeyQueryLimiter).(*RateLimiter)
+	if limiter == nil {
+		return nil
+	}
+
+	key := "ip:" + remoteHost(s.RemoteAddr())
+	who := "queries from " + remoteHost(s.RemoteAddr())
+	if user := GetUserFromContext(s.Context()); user != nil && !user.IsAnonymous {
+		key = "user:" + user.Name
+		who = "queries by " + user.Name
+	}
+
+	if ok, retry := limiter.Allow(key); !ok {
+		return &RateLimitError{What: who, RetryAfter: retry}
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package server
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/johan-st/sqlite-tui/internal/access"
+)
+
+// testSession is a session from ctx's remote address. Only Context and
+// RemoteAddr are implemented.
+type testSession struct {
+	ssh.Session
+	ctx *testContext
+}
+
+func (s testSession) Context() ssh.Context { return s.ctx }
+func (s testSession) RemoteAddr() net.Addr { return s.ctx.RemoteAddr() }
+
+// session returns a session from remote logged in as user, with queries
+// limited by limiter.
+func session(limiter *RateLimiter, remote string, user *access.UserInfo) testSession {
+	ctx := newTestContext("", remote)
+	ctx.SetValue(ctxKeyQueryLimiter, limiter)
+	if user != nil {
+		ctx.SetValue("user", user)
+	}
+	return testSession{ctx: ctx}
+}
+
+func TestAllowConnection(t *testing.T) {
+	limiter := NewRateLimiter(2)
+	addr := func(s string) net.Addr {
+		a, _ := net.ResolveTCPAddr("tcp", s)
+		return a
+	}
+
+	// The limit is per IP, whatever the port
+	for _, remote := range []string{"192.0.2.1:50000", "192.0.2.1:50001"} {
+		if err := allowConnection(limiter, addr(remote)); err != nil {
+			t.Fatalf("%s: unexpected error: %v", remote, err)
+		}
+	}
+	err := allowConnection(limiter, addr("192.0.2.1:50002"))
+	var rlErr *RateLimitError
+	if !errors.As(err, &rlErr) {
+		t.Fatalf("expected a rate limit error, got %v", err)
+	}
+	if rlErr.What != "connections from 192.0.2.1" || rlErr.RetryAfter <= 0 || rlErr.RetryAfter > 30*time.Second {
+		t.Errorf("unexpected error: %+v", rlErr)
+	}
+	if err := allowConnection(limiter, addr("198.51.100.7:50000")); err != nil {
+		t.Errorf("expected other IPs to connect, got %v", err)
+	}
+
+	// Without a limiter everything is allowed
+	for range 5 {
+		if err := allowConnection(nil, addr("192.0.2.1:50000")); err != nil {
+			t.Fatalf("unexpected error without a limiter: %v", err)
+		}
+	}
+}
+
+func TestCheckQueryRate(t *testing.T) {
+	limiter := NewRateLimiter(2)
+	alice := &access.UserInfo{Name: "alice"}
+	anon := func(name string) *access.UserInfo { return &access.UserInfo{IsAnonymous: true, AnonymousName: name} }
+
+	tests := []struct {
+		name    string
+		session testSession
+		wantErr string // "" if the query is allowed
+	}{
+		{"user", session(limiter, "192.0.2.1:50000", alice), ""},
+		{"user from another IP", session(limiter, "198.51.100.7:50000", alice), ""},
+		{"user over the limit", session(limiter, "203.0.113.9:50000", alice), "too many queries by alice"},
+		{"other user", session(limiter, "192.0.2.1:50000", &access.UserInfo{Name: "bob"}), ""},
+		{"anonymous", session(limiter, "192.0.2.1:50000", anon("red-fox")), ""},
+		{"anonymous under a new name", session(limiter, "192.0.2.1:50001", anon("blue-owl")), ""},
+		{"anonymous over the limit", session(limiter, "192.0.2.1:50002", anon("green-elk")), "too many queries from 192.0.2.1"},
+		{"anonymous from another IP", session(limiter, "198.51.100.7:50000", anon("red-fox")), ""},
+		{"no limiter", session(nil, "192.0.2.1:50000", alice), ""},
+	}
+	for _, tt := range tests {
+		err := CheckQueryRate(tt.session)
+		switch {
+		case tt.wantErr == "" && err != nil:
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+		case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+			t.Errorf("%s: expected error containing %q, got %v", tt.name, tt.wantErr, err)
+		}
+	}
+}
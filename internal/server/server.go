@@ -3,7 +3,9 @@ package server
 import (
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
+	"net"
+	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
@@ -13,9 +15,11 @@ import (
 	"github.com/charmbracelet/ssh"
 	"github.com/charmbracelet/wish"
 	"github.com/charmbracelet/wish/bubbletea"
+	"github.com/johan-st/sqlite-tui/internal/api"
 	"github.com/johan-st/sqlite-tui/internal/config"
 	"github.com/johan-st/sqlite-tui/internal/database"
 	"github.com/johan-st/sqlite-tui/internal/history"
+	"github.com/johan-st/sqlite-tui/internal/web"
 )
 
 // Server is the SSH server for sqlite-tui.
@@ -26,21 +30,52 @@ type Server struct {
 	sessionMgr    *SessionManager
 	authenticator *Authenticator
 	sshServer     *ssh.Server
+	listeners     []net.Listener
+	hostKeys      *HostKeyManager
 	tuiHandler    bubbletea.Handler
 	cliHandler    func(ssh.Session)
+	healthServer  *http.Server
+	web           *web.Server
+	api           *api.Server
+	connLimiter   *RateLimiter
+	queryLimiter  *RateLimiter
 }
 
 // NewServer creates a new SSH server.
 func NewServer(cfg *config.Config, dbManager *database.Manager, historyStore *history.Store) *Server {
 	sessionMgr := NewSessionManager(historyStore)
+	sessionMgr.SetLimits(SessionLimits{
+		PerUser:        cfg.SessionLimits.PerUser,
+		PerKey:         cfg.SessionLimits.PerKey,
+		PerAnonymousIP: cfg.SessionLimits.PerAnonymousIP,
+	})
+	sessionMgr.SetAnonymousQuota(Quota{
+		MaxQueries:  cfg.AnonymousQuota.MaxQueries,
+		MaxRows:     cfg.AnonymousQuota.MaxRows,
+		MaxDuration: cfg.GetAnonymousMaxDuration(),
+	})
+	// Roll back transactions and release locks left by disconnected
+	// sessions, and let the locks of sessions gone without that expire
+	sessionMgr.OnEnd(dbManager.EndSession)
+	dbManager.SetSessionCheck(func(id string) bool { return sessionMgr.GetSession(id) != nil })
 	authenticator := NewAuthenticator(cfg, historyStore)
 
+	// Sessions, bans and audit records run the hooks the manager runs
+	sessionMgr.SetHooks(dbManager.Hooks())
+	authenticator.bans.hooks = dbManager.Hooks()
+	if historyStore != nil {
+		historyStore.SetHooks(dbManager.Hooks())
+	}
+
 	return &Server{
 		config:        cfg,
 		dbManager:     dbManager,
 		historyStore:  historyStore,
 		sessionMgr:    sessionMgr,
 		authenticator: authenticator,
+		hostKeys:      NewHostKeyManager(append([]string{cfg.Server.SSH.HostKeyPath}, cfg.Server.SSH.HostKeys...)),
+		connLimiter:   NewRateLimiter(cfg.RateLimits.ConnectionsPerMinute),
+		queryLimiter:  NewRateLimiter(cfg.RateLimits.QueriesPerMinute),
 	}
 }
 
@@ -62,20 +97,33 @@ func (s *Server) Start() error {
 		return fmt.Errorf("failed to create host key directory: %w", err)
 	}
 
+	// The web viewer and API are created first so that web-login and
+	// api-token can reach them
+	if err := s.startWebServer(); err != nil {
+		return err
+	}
+	if err := s.startAPIServer(); err != nil {
+		return err
+	}
+
 	// Build middleware chain
 	middleware := []wish.Middleware{
 		// Order matters: last middleware wraps first
-		s.routingMiddleware(),             // Route to TUI or CLI
-		SessionMiddleware(s.sessionMgr),   // Create session
-		DatabaseMiddleware(s.dbManager),   // Inject DB manager
-		HistoryMiddleware(s.historyStore), // Inject history store
-		LoggingMiddleware(),               // Log connections
+		s.routingMiddleware(),                              // Route to TUI or CLI
+		SessionMiddleware(s.sessionMgr),                    // Create session
+		DatabaseMiddleware(s.dbManager),                    // Inject DB manager
+		HistoryMiddleware(s.historyStore),                  // Inject history store
+		HostKeyMiddleware(s.hostKeys),                      // Inject host key manager
+		WebMiddleware(s.web),                               // Inject web viewer
+		APIMiddleware(s.api),                               // Inject API server
+		RateLimitMiddleware(s.connLimiter, s.queryLimiter), // Limit connections
+		LoggingMiddleware(),                                // Log connections
 	}
 
 	// Create SSH server
 	opts := []ssh.Option{
-		wish.WithAddress(s.config.Server.SSH.Listen),
-		wish.WithHostKeyPath(s.config.Server.SSH.HostKeyPath),
+		s.hostKeys.option(),
+		ssh.WrapConn(s.wrapConn),
 		wish.WithPublicKeyAuth(s.authenticator.PublicKeyHandler()),
 		wish.WithMiddleware(middleware...),
 	}
@@ -85,10 +133,12 @@ func (s *Server) Start() error {
 		opts = append(opts, wish.WithKeyboardInteractiveAuth(s.authenticator.KeyboardInteractiveHandler()))
 	}
 
-	// Add timeouts
-	if s.config.GetIdleTimeout() > 0 {
-		opts = append(opts, wish.WithIdleTimeout(s.config.GetIdleTimeout()))
+	// Serve database files over sftp/scp
+	if s.config.Server.SSH.SFTP {
+		opts = append(opts, s.sftpOption())
 	}
+
+	// Add timeouts (the idle timeout is enforced by wrapConn)
 	if s.config.GetMaxTimeout() > 0 {
 		opts = append(opts, wish.WithMaxTimeout(s.config.GetMaxTimeout()))
 	}
@@ -100,24 +150,32 @@ func (s *Server) Start() error {
 	s.sshServer = server
 
 	// Start server
-	log.Printf("Starting SSH server on %s", s.config.Server.SSH.Listen)
+	listeners, err := listen(s.config.Server.SSH.Listen)
+	if err != nil {
+		return err
+	}
+	s.listeners = listeners
+	slog.Info("Starting SSH server", "listen", listenerAddrs(listeners))
 
 	done := make(chan os.Signal, 1)
 	signal.Notify(done, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
 
 	go func() {
-		if err := server.ListenAndServe(); err != nil && err != ssh.ErrServerClosed {
-			log.Printf("SSH server error: %v", err)
+		if err := serve(server, listeners); err != nil && err != ssh.ErrServerClosed {
+			slog.Error("SSH server error", "err", err)
 		}
 	}()
+	s.startHealthServer()
+	go s.hostKeys.run()
+	s.authenticator.keyFetcher.Prefetch()
 
 	<-done
-	log.Println("Shutting down SSH server...")
+	slog.Info("Shutting down SSH server")
 
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	return server.Shutdown(ctx)
+	return s.Shutdown(ctx)
 }
 
 // ListenAndServe starts the server without signal handling (for embedding).
@@ -128,19 +186,30 @@ func (s *Server) ListenAndServe() error {
 		return fmt.Errorf("failed to create host key directory: %w", err)
 	}
 
+	if err := s.startWebServer(); err != nil {
+		return err
+	}
+	if err := s.startAPIServer(); err != nil {
+		return err
+	}
+
 	// Build middleware chain
 	middleware := []wish.Middleware{
 		s.routingMiddleware(),
 		SessionMiddleware(s.sessionMgr),
 		DatabaseMiddleware(s.dbManager),
 		HistoryMiddleware(s.historyStore),
+		HostKeyMiddleware(s.hostKeys),
+		WebMiddleware(s.web),
+		APIMiddleware(s.api),
+		RateLimitMiddleware(s.connLimiter, s.queryLimiter),
 		LoggingMiddleware(),
 	}
 
 	// Create SSH server
 	opts := []ssh.Option{
-		wish.WithAddress(s.config.Server.SSH.Listen),
-		wish.WithHostKeyPath(s.config.Server.SSH.HostKeyPath),
+		s.hostKeys.option(),
+		ssh.WrapConn(s.wrapConn),
 		wish.WithPublicKeyAuth(s.authenticator.PublicKeyHandler()),
 		wish.WithMiddleware(middleware...),
 	}
@@ -149,9 +218,10 @@ func (s *Server) ListenAndServe() error {
 		opts = append(opts, wish.WithKeyboardInteractiveAuth(s.authenticator.KeyboardInteractiveHandler()))
 	}
 
-	if s.config.GetIdleTimeout() > 0 {
-		opts = append(opts, wish.WithIdleTimeout(s.config.GetIdleTimeout()))
+	if s.config.Server.SSH.SFTP {
+		opts = append(opts, s.sftpOption())
 	}
+
 	if s.config.GetMaxTimeout() > 0 {
 		opts = append(opts, wish.WithMaxTimeout(s.config.GetMaxTimeout()))
 	}
@@ -162,23 +232,52 @@ func (s *Server) ListenAndServe() error {
 	}
 	s.sshServer = server
 
-	return server.ListenAndServe()
+	listeners, err := listen(s.config.Server.SSH.Listen)
+	if err != nil {
+		return err
+	}
+	s.listeners = listeners
+	s.startHealthServer()
+	go s.hostKeys.run()
+	s.authenticator.keyFetcher.Prefetch()
+
+	return serve(server, listeners)
 }
 
 // Shutdown gracefully shuts down the server.
 func (s *Server) Shutdown(ctx context.Context) error {
+	s.hostKeys.Close()
+	if s.healthServer != nil {
+		s.healthServer.Shutdown(ctx)
+	}
+	if s.web != nil {
+		s.web.Shutdown(ctx)
+	}
+	if s.api != nil {
+		s.api.Shutdown(ctx)
+	}
 	if s.sshServer != nil {
 		return s.sshServer.Shutdown(ctx)
 	}
 	return nil
 }
 
-// GetAddr returns the server's listen address string.
+// GetAddr returns the server's listen addresses, comma-separated.
 func (s *Server) GetAddr() string {
-	if s.sshServer != nil {
-		return s.sshServer.Addr
+	return listenerAddrs(s.listeners)
+}
+
+// wrapConn turns away banned IPs and enforces the idle timeout.
+func (s *Server) wrapConn(ctx ssh.Context, conn net.Conn) net.Conn {
+	if ban := s.authenticator.bans.Banned(conn.RemoteAddr()); ban != nil {
+		slog.Debug("Rejected connection from banned IP", "remote", conn.RemoteAddr().String(),
+			"until", ban.ExpiresAt.Format(time.RFC3339))
+		return nil
 	}
-	return ""
+	if timeout := s.config.GetIdleTimeout(); timeout > 0 {
+		return newIdleConn(ctx, conn, timeout, s.config.GetIdleWarning())
+	}
+	return conn
 }
 
 // routingMiddleware routes requests to either TUI or CLI handler.
@@ -187,9 +286,15 @@ func (s *Server) routingMiddleware() wish.Middleware {
 		return func(sess ssh.Session) {
 			cmd := sess.Command()
 
+			warnings, unsubscribe := subscribeIdle(sess)
+			defer unsubscribe()
+
 			// If command is provided, use CLI handler
 			if len(cmd) > 0 {
 				if s.cliHandler != nil {
+					if warnings != nil {
+						go printIdleWarnings(sess, warnings)
+					}
 					s.cliHandler(sess)
 				} else {
 					wish.Fatalln(sess, "CLI commands not yet implemented")
@@ -206,6 +311,7 @@ func (s *Server) routingMiddleware() wish.Middleware {
 
 			if s.tuiHandler != nil {
 				// Use bubbletea middleware
+				sess.Context().SetValue(ctxKeyIdleWarnings, warnings)
 				btMiddleware := bubbletea.Middleware(s.tuiHandler)
 				btMiddleware(next)(sess)
 			} else {
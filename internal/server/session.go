@@ -1,12 +1,26 @@
 package server
 
 import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/johan-st/sqlite-tui/internal/access"
 	"github.com/johan-st/sqlite-tui/internal/history"
+	"github.com/johan-st/sqlite-tui/internal/hooks"
+)
+
+// Errors returned when creating or looking up sessions.
+var (
+	ErrSessionNotFound  = errors.New("session not found")
+	ErrSessionAmbiguous = errors.New("session ID prefix is ambiguous")
+	ErrTooManySessions  = errors.New("too many concurrent sessions")
+	ErrQuotaExceeded    = errors.New("anonymous session quota exceeded")
 )
 
 // Session represents an active SSH session.
@@ -16,6 +30,10 @@ type Session struct {
 	RemoteAddr   string
 	StartTime    time.Time
 	LastActivity time.Time
+	closer       io.Closer // the underlying SSH session, used to kill it
+	quota        Quota     // zero for authenticated users
+	queries      int       // queries charged against the quota
+	rows         int       // rows charged against the quota
 	mu           sync.RWMutex
 }
 
@@ -52,15 +70,82 @@ func (s *Session) IdleTime() time.Duration {
 	return time.Since(s.LastActivity)
 }
 
+// setCloser records how to terminate the session's connection.
+func (s *Session) setCloser(c io.Closer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closer = c
+}
+
+// ChargeQuery counts a query against the session's quota. It fails once
+// the session has run all its queries or fetched all its rows.
+func (s *Session) ChargeQuery() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	q := s.quota
+	switch {
+	case q.MaxRows > 0 && s.rows >= q.MaxRows:
+		return fmt.Errorf("%w: fetched %d rows (max %d)", ErrQuotaExceeded, s.rows, q.MaxRows)
+	case q.MaxQueries > 0 && s.queries >= q.MaxQueries:
+		return fmt.Errorf("%w: ran %d queries (max %d)", ErrQuotaExceeded, s.queries, q.MaxQueries)
+	}
+	s.queries++
+	return nil
+}
+
+// RowsLeft returns how many more rows the session may fetch, or -1 if
+// there is no limit.
+func (s *Session) RowsLeft() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.quota.MaxRows <= 0 {
+		return -1
+	}
+	return max(s.quota.MaxRows-s.rows, 0)
+}
+
+// TakeRows charges up to n fetched rows against the session's quota and
+// returns how many of them the session may use.
+func (s *Session) TakeRows(n int) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.quota.MaxRows > 0 {
+		n = min(n, max(s.quota.MaxRows-s.rows, 0))
+	}
+	s.rows += n
+	return n
+}
+
 // ToHistorySession converts to a history.Session for storage.
 func (s *Session) ToHistorySession() *history.Session {
 	return history.NewSession(s.ID, s.User, s.RemoteAddr)
 }
 
+// SessionLimits caps simultaneous sessions. Zero disables a limit.
+type SessionLimits struct {
+	PerUser        int // authenticated users, by name
+	PerKey         int // by public key fingerprint
+	PerAnonymousIP int // anonymous users, by remote IP
+}
+
+// Quota caps what a single session may do. Zero disables a limit.
+type Quota struct {
+	MaxQueries  int           // CLI commands and TUI queries
+	MaxRows     int           // rows fetched in total
+	MaxDuration time.Duration // time connected
+}
+
 // SessionManager manages active sessions.
 type SessionManager struct {
 	sessions     map[string]*Session
 	historyStore *history.Store
+	limits       SessionLimits
+	anonQuota    Quota
+	onEnd        []func(id string) // called when a session ends
+	hooks        *hooks.Runner
 	mu           sync.RWMutex
 }
 
@@ -72,14 +157,59 @@ func NewSessionManager(historyStore *history.Store) *SessionManager {
 	}
 }
 
-// CreateSession creates and registers a new session.
+// SetLimits sets the concurrent session limits for new sessions.
+func (sm *SessionManager) SetLimits(limits SessionLimits) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.limits = limits
+}
+
+// SetAnonymousQuota sets the quota for new anonymous sessions.
+func (sm *SessionManager) SetAnonymousQuota(quota Quota) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.anonQuota = quota
+}
+
+// SetHooks makes session starts and ends run the hooks of r.
+func (sm *SessionManager) SetHooks(r *hooks.Runner) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.hooks = r
+}
+
+// OnEnd registers fn to be called with the ID of every session that ends,
+// e.g. to release what the session held.
+func (sm *SessionManager) OnEnd(fn func(id string)) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.onEnd = append(sm.onEnd, fn)
+}
+
+// CreateSession creates and registers a new session. It returns
+// ErrTooManySessions when the user is at a session limit.
 func (sm *SessionManager) CreateSession(user *access.UserInfo, remoteAddr string) (*Session, error) {
 	session := NewSession(user, remoteAddr)
 
 	sm.mu.Lock()
+	if err := sm.checkLimits(user, remoteAddr); err != nil {
+		sm.mu.Unlock()
+		return nil, err
+	}
+	if user.IsAnonymous {
+		session.quota = sm.anonQuota
+	}
 	sm.sessions[session.ID] = session
+	runner := sm.hooks
 	sm.mu.Unlock()
 
+	runner.Fire(&hooks.Event{
+		Event:      hooks.SessionStart,
+		User:       user.DisplayName(),
+		SessionID:  session.ID,
+		RemoteAddr: remoteAddr,
+	})
+
 	// Store in history
 	if sm.historyStore != nil {
 		if err := sm.historyStore.CreateSession(session.ToHistorySession()); err != nil {
@@ -91,6 +221,46 @@ func (sm *SessionManager) CreateSession(user *access.UserInfo, remoteAddr string
 	return session, nil
 }
 
+// checkLimits reports whether a new session for user would exceed a limit.
+// Admins are exempt from the per-user and per-key limits so they can always
+// connect to kill runaway sessions. Must be called with sm.mu held.
+func (sm *SessionManager) checkLimits(user *access.UserInfo, remoteAddr string) error {
+	var byName, byKey, byIP int
+	host := addrHost(remoteAddr)
+	for _, s := range sm.sessions {
+		switch {
+		case user.IsAnonymous && s.User.IsAnonymous && addrHost(s.RemoteAddr) == host:
+			byIP++
+		case !user.IsAnonymous && !s.User.IsAnonymous && s.User.Name == user.Name:
+			byName++
+		}
+		if user.PublicKeyFP != "" && s.User.PublicKeyFP == user.PublicKeyFP {
+			byKey++
+		}
+	}
+
+	l := sm.limits
+	switch {
+	case user.IsAnonymous && l.PerAnonymousIP > 0 && byIP >= l.PerAnonymousIP:
+		return fmt.Errorf("%w: %d anonymous sessions from %s (max %d)", ErrTooManySessions, byIP, host, l.PerAnonymousIP)
+	case user.IsAdmin:
+		return nil
+	case !user.IsAnonymous && l.PerUser > 0 && byName >= l.PerUser:
+		return fmt.Errorf("%w: %d sessions for %s (max %d)", ErrTooManySessions, byName, user.Name, l.PerUser)
+	case user.PublicKeyFP != "" && l.PerKey > 0 && byKey >= l.PerKey:
+		return fmt.Errorf("%w: %d sessions with key %s (max %d)", ErrTooManySessions, byKey, user.PublicKeyFP, l.PerKey)
+	}
+	return nil
+}
+
+// addrHost returns the host part of a host:port address.
+func addrHost(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
 // GetSession returns a session by ID.
 func (sm *SessionManager) GetSession(id string) *Session {
 	sm.mu.RLock()
@@ -98,12 +268,74 @@ func (sm *SessionManager) GetSession(id string) *Session {
 	return sm.sessions[id]
 }
 
+// FindSession returns the session whose ID equals or starts with idOrPrefix.
+func (sm *SessionManager) FindSession(idOrPrefix string) (*Session, error) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	if s, ok := sm.sessions[idOrPrefix]; ok {
+		return s, nil
+	}
+
+	var found *Session
+	for id, s := range sm.sessions {
+		if idOrPrefix != "" && strings.HasPrefix(id, idOrPrefix) {
+			if found != nil {
+				return nil, fmt.Errorf("%w: %s", ErrSessionAmbiguous, idOrPrefix)
+			}
+			found = s
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("%w: %s", ErrSessionNotFound, idOrPrefix)
+	}
+	return found, nil
+}
+
+// KillSession closes a session's SSH connection and ends the session.
+func (sm *SessionManager) KillSession(id string) error {
+	session := sm.GetSession(id)
+	if session == nil {
+		return fmt.Errorf("%w: %s", ErrSessionNotFound, id)
+	}
+
+	session.mu.RLock()
+	closer := session.closer
+	session.mu.RUnlock()
+
+	var err error
+	if closer != nil {
+		err = closer.Close()
+	}
+	sm.EndSession(id)
+	return err
+}
+
 // EndSession ends a session.
 func (sm *SessionManager) EndSession(id string) {
 	sm.mu.Lock()
+	session, ok := sm.sessions[id]
 	delete(sm.sessions, id)
+	onEnd := sm.onEnd
+	runner := sm.hooks
 	sm.mu.Unlock()
 
+	if ok {
+		for _, fn := range onEnd {
+			fn(id)
+		}
+	}
+
+	if ok {
+		runner.Fire(&hooks.Event{
+			Event:      hooks.SessionEnd,
+			User:       session.User.DisplayName(),
+			SessionID:  id,
+			RemoteAddr: session.RemoteAddr,
+			Details:    map[string]any{"duration_ms": session.Duration().Milliseconds()},
+		})
+	}
+
 	if sm.historyStore != nil {
 		sm.historyStore.EndSession(id)
 	}
@@ -0,0 +1,128 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/johan-st/sqlite-tui/internal/access"
+)
+
+func TestSessionManager_Limits(t *testing.T) {
+	sm := NewSessionManager(nil)
+	sm.SetLimits(SessionLimits{PerUser: 2, PerKey: 1, PerAnonymousIP: 2})
+
+	user := func(name, key string) *access.UserInfo {
+		return &access.UserInfo{Name: name, PublicKeyFP: key}
+	}
+	anon := &access.UserInfo{IsAnonymous: true, AnonymousName: "red-fox"}
+	admin := &access.UserInfo{Name: "root", IsAdmin: true, PublicKeyFP: "SHA256:root"}
+
+	var first *Session
+	tests := []struct {
+		name    string
+		user    *access.UserInfo
+		remote  string
+		wantErr string // "" if the session is allowed
+	}{
+		{"first session", user("alice", "SHA256:a"), "192.0.2.1:50000", ""},
+		{"second key", user("alice", "SHA256:b"), "192.0.2.1:50001", ""},
+		{"user at the cap", user("alice", "SHA256:c"), "192.0.2.1:50002", "2 sessions for alice (max 2)"},
+		{"key at the cap", user("bob", "SHA256:a"), "198.51.100.7:50000", "1 sessions with key SHA256:a (max 1)"},
+		{"other user", user("bob", "SHA256:d"), "198.51.100.7:50001", ""},
+		{"admins aren't capped", admin, "192.0.2.9:50000", ""},
+		{"admins aren't capped again", admin, "192.0.2.9:50001", ""},
+		{"anonymous", anon, "203.0.113.9:50000", ""},
+		{"anonymous from the same IP", anon, "203.0.113.9:50001", ""},
+		{"anonymous IP at the cap", anon, "203.0.113.9:50002", "2 anonymous sessions from 203.0.113.9 (max 2)"},
+		{"anonymous from another IP", anon, "198.51.100.7:50002", ""},
+	}
+	for _, tt := range tests {
+		s, err := sm.CreateSession(tt.user, tt.remote)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", tt.name, err)
+			}
+			if first == nil {
+				first = s
+			}
+			continue
+		}
+		if !errors.Is(err, ErrTooManySessions) || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: expected error containing %q, got %v", tt.name, tt.wantErr, err)
+		}
+		if s != nil {
+			t.Errorf("%s: expected no session", tt.name)
+		}
+	}
+	if n := len(sm.ListActiveSessions()); n != 8 {
+		t.Errorf("expected 8 sessions, got %d", n)
+	}
+
+	// Ending a session frees its place
+	sm.EndSession(first.ID)
+	if _, err := sm.CreateSession(user("alice", "SHA256:c"), "192.0.2.1:50003"); err != nil {
+		t.Errorf("expected a session after one ended, got %v", err)
+	}
+
+	// Without limits nothing is capped
+	sm.SetLimits(SessionLimits{})
+	if _, err := sm.CreateSession(user("alice", "SHA256:a"), "192.0.2.1:50004"); err != nil {
+		t.Errorf("expected no cap without limits, got %v", err)
+	}
+}
+
+// capSession is a session that records what it writes to stderr and its
+// exit status. It runs no command.
+type capSession struct {
+	testSession
+	stderr bytes.Buffer
+	status int
+}
+
+func (s *capSession) Stderr() io.ReadWriter { return &s.stderr }
+func (s *capSession) Exit(code int) error   { s.status = code; return nil }
+func (s *capSession) Command() []string     { return nil }
+
+func TestSessionMiddleware_RejectsOverCap(t *testing.T) {
+	sm := NewSessionManager(nil)
+	sm.SetLimits(SessionLimits{PerUser: 1})
+	alice := &access.UserInfo{Name: "alice"}
+
+	var handled int
+	handler := SessionMiddleware(sm)(func(ssh.Session) { handled++ })
+	if _, err := sm.CreateSession(alice, "192.0.2.1:50000"); err != nil {
+		t.Fatal(err)
+	}
+
+	s := &capSession{testSession: session(nil, "192.0.2.1:50001", alice)}
+	handler(s)
+	if handled != 0 {
+		t.Error("expected the session over the cap not to be handled")
+	}
+	if s.status != exitRateLimited || !strings.Contains(s.stderr.String(), "too many concurrent sessions") {
+		t.Errorf("expected a rate limit exit, got status %d, stderr %q", s.status, s.stderr.String())
+	}
+	if n := len(sm.ListActiveSessions()); n != 1 {
+		t.Errorf("expected the rejected session not to be kept, got %d sessions", n)
+	}
+
+	// A user under the cap gets a session for the handler's duration
+	bob := &capSession{testSession: session(nil, "192.0.2.1:50002", &access.UserInfo{Name: "bob"})}
+	handler = SessionMiddleware(sm)(func(s ssh.Session) {
+		handled++
+		if GetSessionFromSSH(s) == nil {
+			t.Error("expected a session in the context")
+		}
+	})
+	handler(bob)
+	if handled != 1 || bob.status != 0 {
+		t.Errorf("expected bob's session to be handled, got %d runs, status %d", handled, bob.status)
+	}
+	if n := len(sm.ListActiveSessions()); n != 1 {
+		t.Errorf("expected bob's session to end with the handler, got %d sessions", n)
+	}
+}
@@ -0,0 +1,291 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/johan-st/sqlite-tui/internal/access"
+	"github.com/johan-st/sqlite-tui/internal/database"
+	"github.com/johan-st/sqlite-tui/internal/history"
+	"github.com/pkg/sftp"
+)
+
+// sftpOption registers the sftp subsystem on the SSH server.
+func (s *Server) sftpOption() ssh.Option {
+	return func(srv *ssh.Server) error {
+		if srv.SubsystemHandlers == nil {
+			srv.SubsystemHandlers = map[string]ssh.SubsystemHandler{}
+		}
+		srv.SubsystemHandlers["sftp"] = s.sftpHandler
+		return nil
+	}
+}
+
+// sftpHandler serves accessible databases as a flat virtual directory.
+// Subsystems bypass the wish middleware, so the session is tracked here.
+func (s *Server) sftpHandler(sess ssh.Session) {
+	if err := allowConnection(s.connLimiter, sess.RemoteAddr()); err != nil {
+		fmt.Fprintln(sess.Stderr(), "Error:", err)
+		sess.Exit(exitRateLimited)
+		return
+	}
+
+	user := GetUserFromContext(sess.Context())
+	if user == nil {
+		user = &access.UserInfo{
+			IsAnonymous:   true,
+			AnonymousName: "unknown",
+			RemoteAddr:    sess.RemoteAddr().String(),
+		}
+	}
+
+	session, err := s.sessionMgr.CreateSession(user, sess.RemoteAddr().String())
+	if errors.Is(err, ErrTooManySessions) {
+		fmt.Fprintln(sess.Stderr(), "Error:", err)
+		sess.Exit(exitRateLimited)
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to create session", "err", err)
+	}
+	sessionID := ""
+	if session != nil {
+		session.setCloser(sess)
+		sessionID = session.ID
+		defer s.sessionMgr.EndSession(session.ID)
+	}
+
+	fs := &databaseFS{
+		dbManager:    s.dbManager,
+		historyStore: s.historyStore,
+		user:         user,
+		sessionID:    sessionID,
+		uploadDir:    s.config.Server.SSH.UploadDir,
+	}
+	handlers := sftp.Handlers{FileGet: fs, FilePut: fs, FileCmd: fs, FileList: fs}
+
+	// Clients such as scp treat a missing exit status as failure
+	server := sftp.NewRequestServer(sess, handlers)
+	if err := server.Serve(); err != nil && !errors.Is(err, io.EOF) {
+		slog.Error("SFTP session error", "remote", sess.RemoteAddr().String(), "err", err)
+		sess.Exit(1)
+	} else {
+		sess.Exit(0)
+	}
+	server.Close()
+}
+
+// databaseFS implements the sftp request handlers on top of the database
+// manager. Every database the user may download appears in the root
+// directory as <alias><ext>; admins may upload by writing a file there.
+type databaseFS struct {
+	dbManager    *database.Manager
+	historyStore *history.Store
+	user         *access.UserInfo
+	sessionID    string
+	uploadDir    string
+}
+
+// Fileread opens a database file for download.
+func (fs *databaseFS) Fileread(r *sftp.Request) (io.ReaderAt, error) {
+	db := fs.lookup(r.Filepath)
+	if db == nil {
+		return nil, os.ErrNotExist
+	}
+	f, err := fs.dbManager.OpenDatabaseFile(db.Path, fs.user)
+	if err != nil {
+		if errors.Is(err, database.ErrAccessDenied) {
+			return nil, sftp.ErrSSHFxPermissionDenied
+		}
+		return nil, err
+	}
+	return f, nil
+}
+
+// Filewrite starts an upload. Existing databases are replaced atomically;
+// new names are created in the upload directory.
+func (fs *databaseFS) Filewrite(r *sftp.Request) (io.WriterAt, error) {
+	if !fs.user.IsAdmin {
+		return nil, sftp.ErrSSHFxPermissionDenied
+	}
+
+	name, ok := entryName(r.Filepath)
+	if !ok || !database.HasDatabaseExt(name) {
+		return nil, sftp.ErrSSHFxPermissionDenied
+	}
+
+	target := ""
+	if db := fs.lookup(r.Filepath); db != nil {
+		target = db.Path
+	} else {
+		if fs.uploadDir == "" {
+			return nil, sftp.ErrSSHFxPermissionDenied
+		}
+		target = filepath.Join(fs.uploadDir, name)
+		if _, err := os.Stat(target); err == nil {
+			// Never clobber files that discovery doesn't know about
+			return nil, os.ErrExist
+		}
+	}
+
+	upload, err := fs.dbManager.CreateUpload(target)
+	if err != nil {
+		return nil, err
+	}
+	return &sftpUpload{Upload: upload, fs: fs}, nil
+}
+
+// Filecmd handles file commands. Only setstat is accepted, and ignored,
+// because sftp and scp clients send it after uploads.
+func (fs *databaseFS) Filecmd(r *sftp.Request) error {
+	if r.Method == "Setstat" {
+		return nil
+	}
+	return sftp.ErrSSHFxOpUnsupported
+}
+
+// Filelist lists the root directory or stats a single entry.
+func (fs *databaseFS) Filelist(r *sftp.Request) (sftp.ListerAt, error) {
+	switch r.Method {
+	case "List":
+		if path.Clean(r.Filepath) != "/" {
+			return nil, os.ErrNotExist
+		}
+		var entries listerAt
+		for _, db := range fs.dbManager.ListDatabases(fs.user) {
+			if fs.downloadable(db) {
+				entries = append(entries, databaseFileInfo(db))
+			}
+		}
+		return entries, nil
+	case "Stat":
+		if path.Clean(r.Filepath) == "/" {
+			mode := os.ModeDir | 0555
+			if fs.user.IsAdmin {
+				mode |= 0200
+			}
+			return listerAt{&fileInfo{name: "/", mode: mode, modTime: time.Now()}}, nil
+		}
+		db := fs.lookup(r.Filepath)
+		if db == nil {
+			return nil, os.ErrNotExist
+		}
+		return listerAt{databaseFileInfo(db)}, nil
+	}
+	return nil, sftp.ErrSSHFxOpUnsupported
+}
+
+// lookup returns the downloadable database behind a virtual path.
+func (fs *databaseFS) lookup(p string) *database.DatabaseInfo {
+	name, ok := entryName(p)
+	if !ok {
+		return nil
+	}
+	for _, db := range fs.dbManager.ListDatabases(fs.user) {
+		if fs.downloadable(db) && databaseEntryName(db) == name {
+			return db
+		}
+	}
+	return nil
+}
+
+// downloadable reports whether the user may fetch a database over sftp.
+// Users enrolled in TOTP must use the download command, which asks for a code.
+func (fs *databaseFS) downloadable(db *database.DatabaseInfo) bool {
+	return db.CanDownload && fs.dbManager.TOTPSecret(fs.user) == ""
+}
+
+// entryName returns the file name of a path directly below the root.
+func entryName(p string) (string, bool) {
+	p = path.Clean("/" + p)
+	dir, name := path.Split(p)
+	if dir != "/" || name == "" || strings.HasPrefix(name, ".") {
+		return "", false
+	}
+	return name, true
+}
+
+// databaseEntryName is the virtual file name of a database.
+func databaseEntryName(db *database.DatabaseInfo) string {
+	return db.Alias + filepath.Ext(db.Path)
+}
+
+func databaseFileInfo(db *database.DatabaseInfo) *fileInfo {
+	return &fileInfo{
+		name:    databaseEntryName(db),
+		size:    db.Size,
+		mode:    0444,
+		modTime: time.Unix(db.ModTime, 0),
+	}
+}
+
+// sftpUpload commits the upload when the client closes the file, unless
+// the transfer failed.
+type sftpUpload struct {
+	*database.Upload
+	fs     *databaseFS
+	failed bool
+}
+
+// TransferError is called by the sftp server when the transfer breaks off.
+func (u *sftpUpload) TransferError(err error) {
+	u.failed = true
+}
+
+// Close commits or discards the upload.
+func (u *sftpUpload) Close() error {
+	if u.failed {
+		u.Abort()
+		return nil
+	}
+	if err := u.Commit(u.fs.user.DisplayName(), u.fs.sessionID); err != nil {
+		slog.Error("SFTP upload failed", "path", u.Path(), "err", err)
+		return err
+	}
+
+	// Log to audit
+	if u.fs.historyStore != nil {
+		u.fs.historyStore.RecordAuditSimple(u.fs.sessionID, "UPLOAD", u.Path(), "", map[string]any{
+			"via": "sftp",
+		})
+	}
+	return nil
+}
+
+// fileInfo is a static os.FileInfo for virtual entries.
+type fileInfo struct {
+	name    string
+	size    int64
+	mode    os.FileMode
+	modTime time.Time
+}
+
+func (fi *fileInfo) Name() string       { return fi.name }
+func (fi *fileInfo) Size() int64        { return fi.size }
+func (fi *fileInfo) Mode() os.FileMode  { return fi.mode }
+func (fi *fileInfo) ModTime() time.Time { return fi.modTime }
+func (fi *fileInfo) IsDir() bool        { return fi.mode.IsDir() }
+func (fi *fileInfo) Sys() any           { return nil }
+
+// listerAt serves a fixed list of entries.
+type listerAt []os.FileInfo
+
+// ListAt copies entries starting at offset into ls.
+func (l listerAt) ListAt(ls []os.FileInfo, offset int64) (int, error) {
+	if offset >= int64(len(l)) {
+		return 0, io.EOF
+	}
+	n := copy(ls, l[offset:])
+	if n < len(ls) {
+		return n, io.EOF
+	}
+	return n, nil
+}
@@ -0,0 +1,42 @@
+package server
+
+import (
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	"github.com/johan-st/sqlite-tui/internal/web"
+)
+
+// startWebServer serves the web viewer on the configured address, if any.
+func (s *Server) startWebServer() error {
+	if s.config.Server.Web.Listen == "" {
+		return nil
+	}
+
+	webServer, err := web.NewServer(s.config, s.dbManager)
+	if err != nil {
+		return err
+	}
+	s.web = webServer
+	s.web.Start()
+	return nil
+}
+
+// WebMiddleware makes the web viewer available to the web-login command.
+func WebMiddleware(webServer *web.Server) wish.Middleware {
+	return func(next ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			if webServer != nil {
+				s.Context().SetValue(ctxKeyWeb, webServer)
+			}
+			next(s)
+		}
+	}
+}
+
+// GetWebFromSSH retrieves the web viewer from the SSH session context.
+func GetWebFromSSH(s ssh.Session) *web.Server {
+	if webServer, ok := s.Context().Value(ctxKeyWeb).(*web.Server); ok {
+		return webServer
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+// Package token signs and verifies the short tokens that name a user to
+// the web viewer and the API: a payload of the user and an expiry, and an
+// HMAC over it bound to the token's purpose.
+package token
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Signer signs and verifies tokens with one secret key.
+type Signer struct {
+	secret []byte
+}
+
+// Load returns a signer using the key at path, creating the key if it is
+// missing. Keeping the key means tokens survive restarts; deleting it
+// revokes every token.
+func Load(path string) (*Signer, error) {
+	secret, err := os.ReadFile(path)
+	if err == nil && len(secret) >= 32 {
+		return &Signer{secret: secret}, nil
+	}
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read signing key: %w", err)
+	}
+
+	secret = make([]byte, 32)
+	rand.Read(secret)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create data directory: %w", err)
+	}
+	if err := os.WriteFile(path, secret, 0600); err != nil {
+		return nil, fmt.Errorf("failed to write signing key: %w", err)
+	}
+	return &Signer{secret: secret}, nil
+}
+
+// Sign creates a token naming user for purpose, valid until expires.
+func (s *Signer) Sign(purpose, user string, expires time.Time) string {
+	payload := user + "\n" + strconv.FormatInt(expires.Unix(), 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." +
+		base64.RawURLEncoding.EncodeToString(s.mac(purpose, payload))
+}
+
+// Verify checks a token made by Sign for the same purpose and returns the
+// user it names and when it expires.
+func (s *Signer) Verify(purpose, token string) (string, time.Time, bool) {
+	p, m, ok := strings.Cut(token, ".")
+	if !ok {
+		return "", time.Time{}, false
+	}
+	payload, err1 := base64.RawURLEncoding.DecodeString(p)
+	mac, err2 := base64.RawURLEncoding.DecodeString(m)
+	if err1 != nil || err2 != nil || !hmac.Equal(mac, s.mac(purpose, string(payload))) {
+		return "", time.Time{}, false
+	}
+
+	user, exp, _ := strings.Cut(string(payload), "\n")
+	unix, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil || time.Now().Unix() > unix {
+		return "", time.Time{}, false
+	}
+	return user, time.Unix(unix, 0), true
+}
+
+func (s *Signer) mac(purpose, payload string) []byte {
+	h := hmac.New(sha256.New, s.secret)
+	h.Write([]byte(purpose + "\n" + payload))
+	return h.Sum(nil)
+}
@@ -0,0 +1,52 @@
+package totp
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+)
+
+func TestCode_RFC6238(t *testing.T) {
+	// SHA-1 test vectors from RFC 6238 appendix B, last 6 of 8 digits
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+	for _, tt := range tests {
+		got, err := Code(secret, time.Unix(tt.unix, 0))
+		if err != nil {
+			t.Fatalf("Code() error = %v", err)
+		}
+		if got != tt.want {
+			t.Errorf("Code(%d) = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	secret, err := NewSecret()
+	if err != nil {
+		t.Fatalf("NewSecret() error = %v", err)
+	}
+	now := time.Unix(1_700_000_000, 0)
+	code, _ := Code(secret, now)
+
+	if _, ok := Verify(secret, code, now.Add(25*time.Second)); !ok {
+		t.Error("expected code to be accepted within the skew")
+	}
+	if _, ok := Verify(secret, code, now.Add(2*time.Minute)); ok {
+		t.Error("expected stale code to be rejected")
+	}
+	if _, ok := Verify(secret, "12345", now); ok {
+		t.Error("expected short code to be rejected")
+	}
+	if _, ok := Verify("not base32!", code, now); ok {
+		t.Error("expected invalid secret to be rejected")
+	}
+}
@@ -0,0 +1,280 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/johan-st/sqlite-tui/internal/config"
+)
+
+const (
+	// queueSize bounds the spans waiting for export; more are dropped
+	queueSize = 4096
+	// batchSize is the most spans sent in one request
+	batchSize = 512
+	// flushInterval is how often queued spans are sent
+	flushInterval = 5 * time.Second
+	// exportTimeout bounds a single export request
+	exportTimeout = 10 * time.Second
+)
+
+// exporter sends finished spans to an OTLP/HTTP collector as JSON.
+type exporter struct {
+	url      string
+	headers  map[string]string
+	resource []otlpAttr
+	version  string
+	client   *http.Client
+
+	queue chan *Span
+	done  chan struct{}
+
+	dropped atomic.Int64
+	failing bool // last export failed, so further failures aren't logged
+}
+
+func newExporter(cfg config.TracingConfig, version string) (*exporter, error) {
+	u, err := url.Parse(cfg.Endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid tracing endpoint %q: want http(s)://host:port", cfg.Endpoint)
+	}
+	if !strings.HasSuffix(u.Path, "/v1/traces") {
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/v1/traces"
+	}
+
+	service := cfg.ServiceName
+	if service == "" {
+		service = "sqlite-tui"
+	}
+
+	e := &exporter{
+		url:     u.String(),
+		headers: cfg.Headers,
+		resource: []otlpAttr{
+			attr(String("service.name", service)),
+			attr(String("service.version", version)),
+		},
+		version: version,
+		client:  &http.Client{Timeout: exportTimeout},
+		queue:   make(chan *Span, queueSize),
+		done:    make(chan struct{}),
+	}
+	go e.run()
+	slog.Info("Exporting traces", "endpoint", e.url)
+	return e, nil
+}
+
+// enqueue queues a finished span, dropping it when the queue is full.
+func (e *exporter) enqueue(s *Span) {
+	select {
+	case e.queue <- s:
+	default:
+		e.dropped.Add(1)
+	}
+}
+
+// run sends queued spans in batches until the queue is closed.
+func (e *exporter) run() {
+	defer close(e.done)
+
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	var batch []*Span
+	for {
+		select {
+		case s, ok := <-e.queue:
+			if !ok {
+				e.export(batch)
+				return
+			}
+			batch = append(batch, s)
+			if len(batch) >= batchSize {
+				e.export(batch)
+				batch = nil
+			}
+		case <-ticker.C:
+			e.export(batch)
+			batch = nil
+		}
+	}
+}
+
+// shutdown sends the remaining spans, waiting until ctx is done at most.
+func (e *exporter) shutdown(ctx context.Context) error {
+	close(e.queue)
+	select {
+	case <-e.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (e *exporter) export(spans []*Span) {
+	if len(spans) == 0 {
+		return
+	}
+
+	body, err := json.Marshal(e.request(spans))
+	if err != nil {
+		slog.Error("Failed to encode traces", "err", err)
+		return
+	}
+
+	req, err := http.NewRequest(http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		slog.Error("Failed to export traces", "err", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "sqlite-tui/"+e.version)
+	for k, v := range e.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := e.client.Do(req)
+	if err == nil {
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+		resp.Body.Close()
+		if resp.StatusCode/100 != 2 {
+			err = fmt.Errorf("collector returned %s", resp.Status)
+		}
+	}
+	if err != nil {
+		if !e.failing {
+			slog.Warn("Failed to export traces", "endpoint", e.url, "spans", len(spans), "err", err)
+		}
+		e.failing = true
+		return
+	}
+	if e.failing {
+		slog.Info("Exporting traces again", "endpoint", e.url)
+		e.failing = false
+	}
+	if n := e.dropped.Swap(0); n > 0 {
+		slog.Warn("Dropped spans, export queue was full", "spans", n)
+	}
+}
+
+// OTLP/JSON encoding of an ExportTraceServiceRequest. IDs are hex and
+// 64-bit integers are strings, as the OTLP JSON mapping requires.
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttr `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string     `json:"traceId"`
+	SpanID            string     `json:"spanId"`
+	ParentSpanID      string     `json:"parentSpanId,omitempty"`
+	Name              string     `json:"name"`
+	Kind              int        `json:"kind"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string     `json:"endTimeUnixNano"`
+	Attributes        []otlpAttr `json:"attributes,omitempty"`
+	Status            otlpStatus `json:"status"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"` // 0 unset, 2 error
+	Message string `json:"message,omitempty"`
+}
+
+type otlpAttr struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+func (e *exporter) request(spans []*Span) otlpRequest {
+	out := make([]otlpSpan, 0, len(spans))
+	for _, s := range spans {
+		s.mu.Lock()
+		span := otlpSpan{
+			TraceID:           hex.EncodeToString(s.traceID[:]),
+			SpanID:            hex.EncodeToString(s.spanID[:]),
+			Name:              s.name,
+			Kind:              s.kind,
+			StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+		}
+		if s.parentID != [8]byte{} {
+			span.ParentSpanID = hex.EncodeToString(s.parentID[:])
+		}
+		for _, a := range s.attrs {
+			span.Attributes = append(span.Attributes, attr(a))
+		}
+		if s.errorMsg != "" {
+			span.Status = otlpStatus{Code: 2, Message: s.errorMsg}
+		}
+		s.mu.Unlock()
+		out = append(out, span)
+	}
+
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource: otlpResource{Attributes: e.resource},
+		ScopeSpans: []otlpScopeSpans{{
+			Scope: otlpScope{Name: "github.com/johan-st/sqlite-tui", Version: e.version},
+			Spans: out,
+		}},
+	}}}
+}
+
+func attr(a Attr) otlpAttr {
+	var v otlpValue
+	switch x := a.Value.(type) {
+	case string:
+		v.StringValue = &x
+	case int:
+		s := strconv.Itoa(x)
+		v.IntValue = &s
+	case int64:
+		s := strconv.FormatInt(x, 10)
+		v.IntValue = &s
+	case bool:
+		v.BoolValue = &x
+	case float64:
+		v.DoubleValue = &x
+	default:
+		s := fmt.Sprint(x)
+		v.StringValue = &s
+	}
+	return otlpAttr{Key: a.Key, Value: v}
+}
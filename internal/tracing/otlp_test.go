@@ -0,0 +1,217 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/johan-st/sqlite-tui/internal/config"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// collector records the requests an OTLP/HTTP collector receives.
+type collector struct {
+	requests chan *http.Request
+	bodies   chan []byte
+}
+
+func newCollector(t *testing.T) (*collector, *httptest.Server) {
+	c := &collector{requests: make(chan *http.Request, 10), bodies: make(chan []byte, 10)}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		c.requests <- r
+		c.bodies <- body
+	}))
+	t.Cleanup(ts.Close)
+	return c, ts
+}
+
+// decodeOTLP decodes an OTLP/JSON export request with the OTLP protobuf
+// schema. TracesData has the fields of ExportTraceServiceRequest. The
+// OTLP JSON mapping encodes IDs as hex where protojson expects base64, so
+// they are converted first.
+func decodeOTLP(t *testing.T, body []byte) *tracepb.TracesData {
+	t.Helper()
+	var req map[string]any
+	if err := json.Unmarshal(body, &req); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	for _, rs := range req["resourceSpans"].([]any) {
+		for _, ss := range rs.(map[string]any)["scopeSpans"].([]any) {
+			for _, span := range ss.(map[string]any)["spans"].([]any) {
+				span := span.(map[string]any)
+				for _, field := range []string{"traceId", "spanId", "parentSpanId"} {
+					id, ok := span[field].(string)
+					if !ok {
+						continue
+					}
+					raw, err := hex.DecodeString(id)
+					if err != nil {
+						t.Fatalf("%s %q is not hex: %v", field, id, err)
+					}
+					span[field] = base64.StdEncoding.EncodeToString(raw)
+				}
+			}
+		}
+	}
+	body, _ = json.Marshal(req)
+
+	var data tracepb.TracesData
+	if err := protojson.Unmarshal(body, &data); err != nil {
+		t.Fatalf("payload doesn't match the OTLP schema: %v\n%s", err, body)
+	}
+	return &data
+}
+
+func attrs(kvs []*commonpb.KeyValue) map[string]*commonpb.AnyValue {
+	m := make(map[string]*commonpb.AnyValue, len(kvs))
+	for _, kv := range kvs {
+		m[kv.Key] = kv.Value
+	}
+	return m
+}
+
+func TestExporter_OTLPPayload(t *testing.T) {
+	c, ts := newCollector(t)
+	err := Setup(config.TracingConfig{
+		Endpoint:    ts.URL,
+		ServiceName: "test-service",
+		Headers:     map[string]string{"Authorization": "Bearer secret"},
+	}, "1.2.3")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	session := StartSession("s1", String("ssh.user", "alice"))
+	query := Start("db.query", Session("s1"),
+		String("db.statement", "SELECT 1"),
+		Int("db.rows", 42),
+		Attr{"db.cached", true},
+		Attr{"db.ratio", 0.5},
+		Attr{"db.attempt", 3},
+		Attr{"db.elapsed", time.Second},
+	)
+	query.End(errors.New("no such table: nope"))
+	session.End(nil)
+	if err := Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	var r *http.Request
+	select {
+	case r = <-c.requests:
+	case <-time.After(time.Second):
+		t.Fatal("no export request")
+	}
+	if r.Method != http.MethodPost || r.URL.Path != "/v1/traces" {
+		t.Errorf("got %s %s, want POST /v1/traces", r.Method, r.URL.Path)
+	}
+	if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if auth := r.Header.Get("Authorization"); auth != "Bearer secret" {
+		t.Errorf("Authorization = %q", auth)
+	}
+
+	data := decodeOTLP(t, <-c.bodies)
+	if len(data.ResourceSpans) != 1 || len(data.ResourceSpans[0].ScopeSpans) != 1 {
+		t.Fatalf("expected one resource and scope, got %v", data)
+	}
+	rs := data.ResourceSpans[0]
+	resource := attrs(rs.Resource.Attributes)
+	if resource["service.name"].GetStringValue() != "test-service" || resource["service.version"].GetStringValue() != "1.2.3" {
+		t.Errorf("unexpected resource: %v", rs.Resource)
+	}
+	scope := rs.ScopeSpans[0]
+	if scope.Scope.Name != "github.com/johan-st/sqlite-tui" || scope.Scope.Version != "1.2.3" {
+		t.Errorf("unexpected scope: %v", scope.Scope)
+	}
+
+	spans := map[string]*tracepb.Span{}
+	for _, s := range scope.Spans {
+		spans[s.Name] = s
+		if len(s.TraceId) != 16 || len(s.SpanId) != 8 {
+			t.Errorf("%s: trace ID of %d bytes, span ID of %d", s.Name, len(s.TraceId), len(s.SpanId))
+		}
+		if s.StartTimeUnixNano == 0 || s.EndTimeUnixNano < s.StartTimeUnixNano {
+			t.Errorf("%s: runs from %d to %d", s.Name, s.StartTimeUnixNano, s.EndTimeUnixNano)
+		}
+	}
+	parent, child := spans["ssh.session"], spans["db.query"]
+	if parent == nil || child == nil || len(spans) != 2 {
+		t.Fatalf("expected the session and query spans, got %v", scope.Spans)
+	}
+
+	if parent.Kind != tracepb.Span_SPAN_KIND_SERVER || len(parent.ParentSpanId) != 0 {
+		t.Errorf("session span: kind %v, parent %x", parent.Kind, parent.ParentSpanId)
+	}
+	if parent.Status.GetCode() != tracepb.Status_STATUS_CODE_UNSET {
+		t.Errorf("session span: status %v", parent.Status)
+	}
+	if child.Kind != tracepb.Span_SPAN_KIND_INTERNAL {
+		t.Errorf("query span: kind %v", child.Kind)
+	}
+	if !bytes.Equal(child.TraceId, parent.TraceId) || !bytes.Equal(child.ParentSpanId, parent.SpanId) {
+		t.Errorf("query span isn't a child of the session span")
+	}
+	if child.Status.GetCode() != tracepb.Status_STATUS_CODE_ERROR || child.Status.GetMessage() != "no such table: nope" {
+		t.Errorf("query span: status %v", child.Status)
+	}
+
+	got := attrs(child.Attributes)
+	for key, want := range map[string]*commonpb.AnyValue{
+		"db.statement": {Value: &commonpb.AnyValue_StringValue{StringValue: "SELECT 1"}},
+		"db.rows":      {Value: &commonpb.AnyValue_IntValue{IntValue: 42}},
+		"db.cached":    {Value: &commonpb.AnyValue_BoolValue{BoolValue: true}},
+		"db.ratio":     {Value: &commonpb.AnyValue_DoubleValue{DoubleValue: 0.5}},
+		"db.attempt":   {Value: &commonpb.AnyValue_IntValue{IntValue: 3}},
+		"db.elapsed":   {Value: &commonpb.AnyValue_StringValue{StringValue: "1s"}},
+	} {
+		if got[key].String() != want.String() {
+			t.Errorf("attribute %s = %v, want %v", key, got[key], want)
+		}
+	}
+}
+
+func TestExporter_Endpoint(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		want     string // "" if invalid
+	}{
+		{"http://collector:4318", "http://collector:4318/v1/traces"},
+		{"https://collector:4318/", "https://collector:4318/v1/traces"},
+		{"https://example.com/otlp/", "https://example.com/otlp/v1/traces"},
+		{"http://collector:4318/v1/traces", "http://collector:4318/v1/traces"},
+		{"collector:4318", ""},
+		{"grpc://collector:4317", ""},
+		{"http://", ""},
+	}
+	for _, tt := range tests {
+		e, err := newExporter(config.TracingConfig{Endpoint: tt.endpoint}, "dev")
+		if tt.want == "" {
+			if err == nil {
+				e.shutdown(context.Background())
+				t.Errorf("%s: expected an error", tt.endpoint)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.endpoint, err)
+			continue
+		}
+		if e.url != tt.want {
+			t.Errorf("%s: exports to %s, want %s", tt.endpoint, e.url, tt.want)
+		}
+		e.shutdown(context.Background())
+	}
+}
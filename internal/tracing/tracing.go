@@ -0,0 +1,180 @@
+// Package tracing records OpenTelemetry spans and exports them to an OTLP
+// collector over HTTP. Tracing is off until Setup is called with an
+// endpoint; until then Start returns nil, and all Span methods accept a
+// nil span, so instrumented code needs no checks.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"sync"
+	"time"
+
+	"github.com/johan-st/sqlite-tui/internal/config"
+)
+
+// Span kinds, as defined by OTLP.
+const (
+	KindInternal = 1
+	KindServer   = 2
+)
+
+// exp is the active exporter, nil when tracing is off.
+var (
+	exp   *exporter
+	expMu sync.RWMutex
+)
+
+// sessions maps SSH session IDs to their spans, so work done for a session
+// nests under it without passing the span around.
+var sessions sync.Map
+
+// Attr is a span attribute. Values are strings, ints, int64s, bools or
+// float64s.
+type Attr struct {
+	Key   string
+	Value any
+}
+
+// String returns a string attribute.
+func String(key, value string) Attr { return Attr{key, value} }
+
+// Int returns an integer attribute.
+func Int(key string, value int64) Attr { return Attr{key, value} }
+
+// Bool returns a boolean attribute.
+func Bool(key string, value bool) Attr { return Attr{key, value} }
+
+// Span is an operation being traced.
+type Span struct {
+	traceID  [16]byte
+	spanID   [8]byte
+	parentID [8]byte
+	name     string
+	kind     int
+	start    time.Time
+	session  string // session ID the span is registered under
+
+	mu       sync.Mutex
+	end      time.Time
+	attrs    []Attr
+	errorMsg string
+	ended    bool
+}
+
+// Setup starts exporting spans to the configured OTLP endpoint. It does
+// nothing when no endpoint is configured.
+func Setup(cfg config.TracingConfig, version string) error {
+	if cfg.Endpoint == "" {
+		return nil
+	}
+	e, err := newExporter(cfg, version)
+	if err != nil {
+		return err
+	}
+	expMu.Lock()
+	exp = e
+	expMu.Unlock()
+	return nil
+}
+
+// Shutdown exports pending spans and stops tracing.
+func Shutdown(ctx context.Context) error {
+	expMu.Lock()
+	e := exp
+	exp = nil
+	expMu.Unlock()
+	if e == nil {
+		return nil
+	}
+	return e.shutdown(ctx)
+}
+
+// Enabled reports whether spans are being recorded.
+func Enabled() bool {
+	expMu.RLock()
+	defer expMu.RUnlock()
+	return exp != nil
+}
+
+// Start begins an internal span, a child of parent when it is not nil. It
+// returns nil when tracing is off.
+func Start(name string, parent *Span, attrs ...Attr) *Span {
+	return start(name, KindInternal, parent, attrs)
+}
+
+// StartSession begins the span of an SSH session. Spans started with
+// Session(id) as parent nest under it until it ends.
+func StartSession(id string, attrs ...Attr) *Span {
+	s := start("ssh.session", KindServer, nil, attrs)
+	if s != nil {
+		s.session = id
+		sessions.Store(id, s)
+	}
+	return s
+}
+
+// Session returns the span of the SSH session with the given ID, or nil.
+func Session(id string) *Span {
+	if id == "" {
+		return nil
+	}
+	if s, ok := sessions.Load(id); ok {
+		return s.(*Span)
+	}
+	return nil
+}
+
+func start(name string, kind int, parent *Span, attrs []Attr) *Span {
+	if !Enabled() {
+		return nil
+	}
+	s := &Span{name: name, kind: kind, start: time.Now(), attrs: attrs}
+	if parent != nil {
+		s.traceID = parent.traceID
+		s.parentID = parent.spanID
+	} else {
+		rand.Read(s.traceID[:])
+	}
+	rand.Read(s.spanID[:])
+	return s
+}
+
+// SetAttrs adds attributes to the span.
+func (s *Span) SetAttrs(attrs ...Attr) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.attrs = append(s.attrs, attrs...)
+	s.mu.Unlock()
+}
+
+// End finishes the span, marking it failed when err is not nil, and queues
+// it for export. Later calls do nothing.
+func (s *Span) End(err error) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.end = time.Now()
+	if err != nil {
+		s.errorMsg = err.Error()
+	}
+	s.mu.Unlock()
+
+	if s.session != "" {
+		sessions.CompareAndDelete(s.session, s)
+	}
+
+	expMu.RLock()
+	if exp != nil {
+		exp.enqueue(s)
+	}
+	expMu.RUnlock()
+}
@@ -1,17 +1,23 @@
 package tui
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/charmbracelet/bubbles/key"
 	"github.com/charmbracelet/bubbles/list"
 	"github.com/charmbracelet/bubbles/table"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/dustin/go-humanize"
 	"github.com/johan-st/sqlite-tui/internal/access"
 	"github.com/johan-st/sqlite-tui/internal/database"
 	"github.com/johan-st/sqlite-tui/internal/history"
+	"github.com/johan-st/sqlite-tui/internal/server"
 )
 
 // Focus represents which pane is focused
@@ -25,6 +31,18 @@ const (
 
 const (
 	pageSize = 50 // rows per page
+
+	// maxLoadedRows bounds the rows kept in memory while browsing; rows
+	// scrolled far out of view are dropped and reloaded when needed
+	maxLoadedRows = 20 * pageSize
+
+	// queryLockWait is how long queries wait in line for a write lock
+	// another session holds; esc stops waiting sooner
+	queryLockWait = 30 * time.Second
+
+	// dbInfoLargest is how many of the largest tables and indexes the
+	// database info modal lists
+	dbInfoLargest = 5
 )
 
 // listItem implements list.Item for bubbles/list
@@ -43,6 +61,12 @@ type App struct {
 	dbManager    *database.Manager
 	historyStore *history.Store
 	user         *access.UserInfo
+	checkRate    func() error     // query rate limit, nil when unlimited
+	idleWarnings <-chan time.Time // idle disconnect warnings, nil without idle timeout
+	sessionID    string           // SSH session, empty in local mode
+	session      *server.Session  // holds the anonymous quota, nil in local mode
+	ctx          context.Context  // cancelled on disconnect, nil in local mode
+	changes      <-chan database.DatabaseChange
 
 	// Window size
 	width, height int
@@ -58,7 +82,16 @@ type App struct {
 	dataTable    table.Model
 	dataColumns  []string
 	dataRows     [][]any
+	dataKeys     []any  // keys of dataRows when paging by keyset, else nil
+	browseKey    string // column to page the table by, "" to page by offset
+	rowBase      int    // table row of dataRows[0]
 	totalRows    int64
+	rowsApprox   bool   // totalRows is an estimate
+	resultNote   string // why the query result shown was cut short
+	queryShown   bool   // the data shown is a query result, not a table
+	pagedQuery   string // query shown a page at a time, "" when shown whole
+	queryMore    bool   // the paged query has rows past those loaded
+	stale        bool   // the database changed since the data was loaded
 	loadedOffset int
 	selectedRow  int
 
@@ -76,17 +109,41 @@ type App struct {
 	editCellValue string
 	editError     error
 
+	// TOTP prompt, asking users enrolled in TOTP for a code before a DROP
+	// or DELETE query or a cell edit
+	totpActive bool
+	totpInput  string
+	totpRun    func(code string) tea.Cmd // runs what the code is for
+
 	// Lists
 	dbList    list.Model
 	tableList list.Model
 
 	// Schema
-	schema *database.TableInfo
+	schema  *database.TableInfo
+	dbInfo  *database.DatabaseMetadata
+	dbSizes *database.SizeReport
+
+	// Integrity check, run from the database info modal
+	checkProgress *database.IntegrityProgress
+	checkReport   *database.IntegrityReport
+	checkErr      error
+	checkMsgs     chan tea.Msg       // progress and result of the running check
+	cancelCheck   context.CancelFunc // stops the running check, nil when none runs
+
+	// Watch mode, following the rows added to the table shown
+	watching    string // table watched, "" when not watching
+	watchDB     string // path of the database watched
+	watchEvents <-chan database.FeedEvent
+	cancelWatch context.CancelFunc
 
 	// Query input
 	queryInput  string
 	queryActive bool
 	queryError  error
+	cancelQuery context.CancelFunc // stops the running query, nil when none runs
+	lockWaits   <-chan LockWaitMsg // the running query's waits for the write lock
+	lockWait    *LockWaitMsg       // where the running query is queued, nil when not
 
 	// Query history
 	queryHistory      []string // cached query strings (most recent first)
@@ -96,8 +153,13 @@ type App struct {
 	// UI state
 	showHelp   bool
 	showSchema bool
+	showDBInfo bool
 	err        error
 
+	// idleDeadline is when the server disconnects this idle session; zero
+	// unless a warning is showing
+	idleDeadline time.Time
+
 	// Key bindings
 	keys KeyMap
 }
@@ -157,7 +219,40 @@ func NewApp(dbManager *database.Manager, historyStore *history.Store, user *acce
 
 // Init implements tea.Model.
 func (a *App) Init() tea.Cmd {
-	return a.loadDatabases
+	ctx := a.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	a.changes = a.dbManager.WatchChanges(ctx)
+	return tea.Batch(a.loadDatabases, a.waitIdleWarning, a.waitForChange)
+}
+
+// waitForChange waits for the next change to an open database.
+func (a *App) waitForChange() tea.Msg {
+	change, ok := <-a.changes
+	if !ok {
+		return nil
+	}
+	return DatabaseChangedMsg{Change: change}
+}
+
+// waitIdleWarning waits for the next idle warning from the server.
+func (a *App) waitIdleWarning() tea.Msg {
+	if a.idleWarnings == nil {
+		return nil
+	}
+	deadline, ok := <-a.idleWarnings
+	if !ok {
+		return nil
+	}
+	return IdleWarningMsg{Deadline: deadline}
+}
+
+// idleTick redraws the idle countdown in a second.
+func idleTick(deadline time.Time) tea.Cmd {
+	return tea.Tick(time.Second, func(time.Time) tea.Msg {
+		return idleTickMsg{deadline: deadline}
+	})
 }
 
 // loadDatabases loads the list of databases.
@@ -180,9 +275,18 @@ func (a *App) loadTables() tea.Msg {
 
 	schema := database.NewSchema(conn)
 	tables, err := schema.ListTables()
+	tables = a.dbManager.FilterTables(a.user, db.Alias, tables)
 	return TablesLoadedMsg{Tables: tables, Error: err}
 }
 
+// refreshTables reloads the tables of the selected database after its
+// schema changed.
+func (a *App) refreshTables() tea.Msg {
+	msg := a.loadTables().(TablesLoadedMsg)
+	msg.Refresh = true
+	return msg
+}
+
 // loadData loads data for the selected table.
 func (a *App) loadData() tea.Msg {
 	if a.selectedDB >= len(a.databases) || a.selectedTable >= len(a.tables) {
@@ -197,29 +301,73 @@ func (a *App) loadData() tea.Msg {
 		return DataLoadedMsg{Error: err}
 	}
 
-	// Get total row count
+	// Estimate the row count; counting big tables exactly is slow
 	schema := database.NewSchema(conn)
-	totalRows, err := schema.GetRowCount(tableName)
+	totalRows, exact, err := schema.EstimateRowCount(tableName)
 	if err != nil {
 		return DataLoadedMsg{Error: err}
 	}
 
+	if err := a.checkRowsLeft(); err != nil {
+		return DataLoadedMsg{Error: err}
+	}
+
 	// Load first page
 	opts := database.DefaultSelectOptions()
 	opts.Limit = pageSize
-	opts.Offset = 0
+	opts.KeyColumn = schema.KeyColumn(tableName)
 	result, err := database.Select(conn, tableName, opts)
+	a.takeRows(result)
 
 	return DataLoadedMsg{
-		Result:    result,
-		TotalRows: totalRows,
-		Offset:    0,
-		Error:     err,
+		Result:     result,
+		TotalRows:  totalRows,
+		RowsApprox: !exact,
+		KeyColumn:  opts.KeyColumn,
+		Offset:     0,
+		Error:      err,
+	}
+}
+
+// loadMoreData loads the page below the loaded rows.
+func (a *App) loadMoreData() tea.Cmd {
+	offset := a.rowBase + len(a.dataRows)
+	if a.pagedQuery != "" {
+		return a.loadQueryPage(pageSize, offset)
+	}
+	opts := database.DefaultSelectOptions()
+	opts.Limit = pageSize
+	if a.browseKey != "" && len(a.dataKeys) > 0 {
+		opts.KeyColumn = a.browseKey
+		opts.After = a.dataKeys[len(a.dataKeys)-1]
+	} else {
+		opts.Offset = offset
 	}
+	return a.loadPage(opts, offset)
 }
 
-// loadMoreData loads additional rows.
-func (a *App) loadMoreData(offset int) tea.Cmd {
+// loadPreviousData loads the page above the loaded rows.
+func (a *App) loadPreviousData() tea.Cmd {
+	offset := max(0, a.rowBase-pageSize)
+	if a.pagedQuery != "" {
+		return a.loadQueryPage(a.rowBase-offset, offset)
+	}
+	opts := database.DefaultSelectOptions()
+	opts.Limit = pageSize
+	if a.browseKey != "" && len(a.dataKeys) > 0 {
+		opts.KeyColumn = a.browseKey
+		opts.Before = a.dataKeys[0]
+		opts.Limit = a.rowBase - offset
+	} else {
+		opts.Offset = offset
+	}
+	return a.loadPage(opts, offset)
+}
+
+// loadPage loads the rows selected by opts, which start at table row
+// offset. Keyset options page from a loaded row's key, so deep pages cost
+// no more than the first.
+func (a *App) loadPage(opts database.SelectOptions, offset int) tea.Cmd {
 	return func() tea.Msg {
 		if a.selectedDB >= len(a.databases) || a.selectedTable >= len(a.tables) {
 			return MoreDataLoadedMsg{Error: fmt.Errorf("no table selected")}
@@ -233,10 +381,12 @@ func (a *App) loadMoreData(offset int) tea.Cmd {
 			return MoreDataLoadedMsg{Error: err}
 		}
 
-		opts := database.DefaultSelectOptions()
-		opts.Limit = pageSize
-		opts.Offset = offset
+		if err := a.checkRowsLeft(); err != nil {
+			return MoreDataLoadedMsg{Error: err}
+		}
+
 		result, err := database.Select(conn, tableName, opts)
+		a.takeRows(result)
 
 		return MoreDataLoadedMsg{
 			Result: result,
@@ -246,14 +396,63 @@ func (a *App) loadMoreData(offset int) tea.Cmd {
 	}
 }
 
+// moreBelow reports whether the table or paged query has rows below the
+// loaded ones. With an estimated count there may be more rows than
+// estimated, until a short page shows the end was reached.
+func (a *App) moreBelow() bool {
+	if a.pagedQuery != "" {
+		return a.queryMore
+	}
+	return a.rowsApprox || int64(a.rowBase+len(a.dataRows)) < a.totalRows
+}
+
+// countRows counts the rows of the selected table exactly.
+func (a *App) countRows() tea.Msg {
+	if a.selectedDB >= len(a.databases) || a.selectedTable >= len(a.tables) {
+		return RowCountMsg{Error: fmt.Errorf("no table selected")}
+	}
+
+	db := a.databases[a.selectedDB]
+	tableName := a.tables[a.selectedTable]
+
+	conn, err := a.dbManager.OpenConnection(db.Alias, a.user)
+	if err != nil {
+		return RowCountMsg{Error: err}
+	}
+
+	count, err := database.NewSchema(conn).GetRowCount(tableName)
+	return RowCountMsg{Table: tableName, Count: count, Error: err}
+}
+
+// reachedEnd fixes an estimated row count once a page came back short,
+// which means every row was loaded.
+func (a *App) reachedEnd() {
+	a.totalRows = int64(a.rowBase + len(a.dataRows))
+	a.rowsApprox = false
+}
+
 // Update implements tea.Model.
 func (a *App) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	var cmds []tea.Cmd
 
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
+		a.idleDeadline = time.Time{}
 		return a.handleKey(msg)
 
+	case IdleWarningMsg:
+		a.idleDeadline = msg.Deadline
+		if msg.Deadline.IsZero() {
+			return a, a.waitIdleWarning
+		}
+		return a, tea.Batch(a.waitIdleWarning, idleTick(msg.Deadline))
+
+	case idleTickMsg:
+		if !msg.deadline.Equal(a.idleDeadline) {
+			return a, nil // warning cleared or replaced
+		}
+		return a, idleTick(msg.deadline)
+
 	case tea.WindowSizeMsg:
 		a.width = msg.Width
 		a.height = msg.Height
@@ -261,6 +460,7 @@ func (a *App) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		return a, nil
 
 	case DatabasesLoadedMsg:
+		a.stopWatch()
 		a.databases = msg.Databases
 		a.selectedDB = 0
 		a.updateDBList()
@@ -272,6 +472,20 @@ func (a *App) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case TablesLoadedMsg:
 		if msg.Error != nil {
 			a.err = msg.Error
+		} else if msg.Refresh && a.selectedTable < len(a.tables) {
+			// Stay on the table shown unless it's gone
+			selected := a.tables[a.selectedTable]
+			a.tables = msg.Tables
+			a.updateTableList()
+			if i := slices.Index(a.tables, selected); i >= 0 {
+				a.selectedTable = i
+				a.tableList.Select(i)
+				return a, nil
+			}
+			a.selectedTable = 0
+			if len(a.tables) > 0 && !a.queryShown {
+				return a, a.loadData
+			}
 		} else {
 			a.tables = msg.Tables
 			a.selectedTable = 0
@@ -288,7 +502,21 @@ func (a *App) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		} else {
 			a.dataColumns = msg.Result.Columns
 			a.dataRows = msg.Result.Rows
+			a.dataKeys = msg.Result.Keys
+			a.browseKey = msg.KeyColumn
+			a.rowBase = 0
 			a.totalRows = msg.TotalRows
+			a.rowsApprox = msg.RowsApprox
+			a.resultNote = ""
+			a.queryShown = false
+			a.pagedQuery, a.queryMore = "", false
+			a.stale = false
+			if a.watching != "" && !a.showsWatched() {
+				a.stopWatch()
+			}
+			if a.rowsApprox && len(a.dataRows) < pageSize {
+				a.reachedEnd()
+			}
 			a.loadedOffset = 0
 			a.selectedRow = 0
 			a.updateDataTable()
@@ -296,33 +524,173 @@ func (a *App) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 		return a, nil
 
+	case DatabaseInfoLoadedMsg:
+		if msg.Error != nil {
+			a.err = msg.Error
+			a.showDBInfo = false
+		} else {
+			a.dbInfo, a.dbSizes = msg.Info, msg.Sizes
+		}
+		return a, nil
+
+	case IntegrityProgressMsg:
+		a.checkProgress = &msg.Progress
+		return a, a.waitForCheck(a.checkMsgs)
+
+	case IntegrityCheckedMsg:
+		a.stopCheck()
+		if !errors.Is(msg.Error, context.Canceled) {
+			a.checkReport, a.checkErr = msg.Report, msg.Error
+		}
+		return a, nil
+
+	case RowCountMsg:
+		if msg.Error != nil {
+			a.err = msg.Error
+		} else if a.selectedTable < len(a.tables) && a.tables[a.selectedTable] == msg.Table {
+			a.totalRows = msg.Count
+			a.rowsApprox = false
+			a.updateTableHeight()
+		}
+		return a, nil
+
 	case MoreDataLoadedMsg:
+		if msg.Query != a.pagedQuery {
+			// Rows of a query or table no longer shown
+			return a, nil
+		}
 		if msg.Error != nil {
 			a.err = msg.Error
-		} else if msg.Result != nil && len(msg.Result.Rows) > 0 {
-			// Append new rows
-			a.dataRows = append(a.dataRows, msg.Result.Rows...)
+		} else if msg.Result != nil {
+			below := msg.Offset == a.rowBase+len(a.dataRows)
+			switch {
+			case len(msg.Result.Rows) == 0:
+			case below:
+				// Rows below: append, dropping rows from the top
+				a.dataRows = append(a.dataRows, msg.Result.Rows...)
+				a.dataKeys = append(a.dataKeys, msg.Result.Keys...)
+				if drop := len(a.dataRows) - maxLoadedRows; drop > 0 {
+					a.dataRows = append([][]any(nil), a.dataRows[drop:]...)
+					if a.dataKeys != nil {
+						a.dataKeys = append([]any(nil), a.dataKeys[drop:]...)
+					}
+					a.rowBase += drop
+					a.selectedRow = max(0, a.selectedRow-drop)
+				}
+			case msg.Offset < a.rowBase:
+				// Rows above: prepend, dropping rows from the bottom
+				n := min(len(msg.Result.Rows), a.rowBase-msg.Offset)
+				a.dataRows = append(append([][]any(nil), msg.Result.Rows[:n]...), a.dataRows...)
+				if a.dataKeys != nil {
+					a.dataKeys = append(append([]any(nil), msg.Result.Keys[:n]...), a.dataKeys...)
+				}
+				a.rowBase -= n
+				a.selectedRow += n
+				if len(a.dataRows) > maxLoadedRows {
+					a.dataRows = a.dataRows[:maxLoadedRows]
+					if a.dataKeys != nil {
+						a.dataKeys = a.dataKeys[:maxLoadedRows]
+					}
+				}
+			default:
+				// Stale: the window moved since the load started
+				return a, nil
+			}
+			if below && a.rowsApprox && len(msg.Result.Rows) < pageSize {
+				// A short page: every row is loaded, so the count is known
+				a.reachedEnd()
+			}
+			if below && a.pagedQuery != "" {
+				a.totalRows = int64(a.rowBase + len(a.dataRows))
+				a.queryMore = msg.More
+			}
 			a.loadedOffset = msg.Offset
 			a.updateDataTable()
+			a.dataTable.SetCursor(a.selectedRow)
 			a.updateTableHeight()
 		}
 		return a, nil
 
+	case LockWaitMsg:
+		// Waits of queries since replaced or finished no longer matter
+		if msg.waits != a.lockWaits || a.cancelQuery == nil {
+			return a, nil
+		}
+		a.lockWait = &msg
+		return a, waitForLockWait(msg.waits)
+
 	case QueryExecutedMsg:
+		cancelled := errors.Is(msg.Error, context.Canceled)
+		if cancelled && a.cancelQuery != nil {
+			// A query replaced by a newer one; the newer one reports
+			return a, nil
+		}
 		a.queryActive = false
-		if msg.Error != nil {
+		a.lockWait = nil
+		if a.cancelQuery != nil {
+			a.cancelQuery()
+			a.cancelQuery = nil
+		}
+		if cancelled {
+			a.queryError = fmt.Errorf("query cancelled")
+		} else if msg.Error != nil {
 			a.queryError = msg.Error
 		} else {
 			a.queryError = nil
 			a.dataColumns = msg.Result.Columns
 			a.dataRows = msg.Result.Rows
+			a.dataKeys = nil
+			a.browseKey = ""
+			a.rowBase = 0
 			a.totalRows = int64(len(msg.Result.Rows))
+			a.rowsApprox = false
+			a.resultNote = msg.Result.TruncationNote()
+			a.queryShown = true
+			a.pagedQuery, a.queryMore = msg.Paged, msg.More
+			a.stale = false
+			a.stopWatch()
 			a.selectedRow = 0
 			a.updateDataTable()
 			a.updateTableHeight()
 		}
 		return a, nil
 
+	case FeedEventsMsg:
+		if msg.Table != a.watching || a.watchEvents == nil {
+			return a, nil // from a watch since stopped
+		}
+		if !a.showsWatched() {
+			a.stopWatch()
+			return a, nil
+		}
+		a.applyFeed(msg.Events)
+		if msg.Closed {
+			a.stopWatch()
+			return a, nil
+		}
+		return a, a.waitForFeed(msg.Table, a.watchEvents)
+
+	case DatabaseChangedMsg:
+		cmds := []tea.Cmd{a.waitForChange}
+		for _, db := range a.databases {
+			if db.Path == msg.Change.Path {
+				db.Size, db.ModTime = msg.Change.Size, msg.Change.ModTime
+			}
+		}
+		if a.selectedDB < len(a.databases) && a.databases[a.selectedDB].Path == msg.Change.Path {
+			// A watched table shows its new rows already
+			if len(a.dataColumns) > 0 && a.watching == "" {
+				a.stale = true
+			}
+			if msg.Change.Schema {
+				cmds = append(cmds, a.refreshTables)
+			}
+			if a.showDBInfo && a.cancelCheck == nil {
+				cmds = append(cmds, a.loadDatabaseInfo)
+			}
+		}
+		return a, tea.Batch(cmds...)
+
 	case ErrorMsg:
 		a.err = msg.Error
 		return a, nil
@@ -419,9 +787,9 @@ func (a *App) updateTableHeight() {
 	// Calculate if we need to show "rows below" indicator
 	showRowsBelowIndicator := false
 	if len(a.dataRows) > 0 {
-		if int64(len(a.dataRows)) < a.totalRows {
+		if a.moreBelow() {
 			// Not all rows loaded - check against totalRows
-			rowsBelow := a.totalRows - int64(lastVisible) - 1
+			rowsBelow := a.totalRows - int64(a.rowBase+lastVisible) - 1
 			if rowsBelow > 0 {
 				showRowsBelowIndicator = true
 			}
@@ -627,6 +995,10 @@ func (a *App) updateDataTable() {
 }
 
 func (a *App) handleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if a.totpActive {
+		return a.handleTOTPInput(msg)
+	}
+
 	// Handle cell editing mode
 	if a.editingCell {
 		return a.handleEditInput(msg)
@@ -645,10 +1017,15 @@ func (a *App) handleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		return a, nil
 	}
 
-	// Handle schema modal
-	if a.showSchema {
-		if key.Matches(msg, a.keys.Back) {
+	// Handle schema and database info modals
+	if a.showSchema || a.showDBInfo {
+		switch {
+		case key.Matches(msg, a.keys.Back):
 			a.showSchema = false
+			a.showDBInfo = false
+			a.stopCheck()
+		case a.showDBInfo && key.Matches(msg, a.keys.Count) && a.cancelCheck == nil:
+			return a, a.startCheck()
 		}
 		return a, nil
 	}
@@ -669,6 +1046,10 @@ func (a *App) handleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		return a, a.loadQueryHistory
 
 	case key.Matches(msg, a.keys.Refresh):
+		// A table that changed while shown is reloaded first
+		if a.stale && !a.queryShown && a.selectedTable < len(a.tables) {
+			return a, a.loadData
+		}
 		return a, a.loadDatabases
 
 	case key.Matches(msg, a.keys.NextPane):
@@ -738,11 +1119,33 @@ func (a *App) handleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		return a.handleEditCell()
 
 	case key.Matches(msg, a.keys.Schema):
+		if a.focus == FocusDatabases && a.selectedDB < len(a.databases) {
+			a.showDBInfo = true
+			a.dbInfo, a.dbSizes = nil, nil
+			a.checkProgress, a.checkReport, a.checkErr = nil, nil, nil
+			return a, a.loadDatabaseInfo
+		}
 		if (a.focus == FocusTables || a.focus == FocusData) && a.selectedTable < len(a.tables) {
 			a.showSchema = true
 			return a, a.loadSchema
 		}
 		return a, nil
+
+	case key.Matches(msg, a.keys.Count):
+		if a.rowsApprox {
+			return a, a.countRows
+		}
+		return a, nil
+
+	case key.Matches(msg, a.keys.Watch):
+		if a.watching != "" {
+			a.stopWatch()
+			return a, nil
+		}
+		if (a.focus == FocusTables || a.focus == FocusData) && !a.queryShown && a.selectedTable < len(a.tables) {
+			return a, a.startWatch()
+		}
+		return a, nil
 	}
 
 	return a, nil
@@ -776,6 +1179,9 @@ func (a *App) handleUp() (tea.Model, tea.Cmd) {
 			a.dataTable.SetCursor(a.selectedRow)
 			a.updateTableHeight()
 		}
+		if a.selectedRow < 5 && a.rowBase > 0 {
+			return a, a.loadPreviousData()
+		}
 	}
 	return a, nil
 }
@@ -800,12 +1206,12 @@ func (a *App) handleDown() (tea.Model, tea.Cmd) {
 			a.dataTable.SetCursor(a.selectedRow)
 			a.updateTableHeight()
 			// Load more if near end
-			if a.selectedRow >= len(a.dataRows)-5 && int64(len(a.dataRows)) < a.totalRows {
-				return a, a.loadMoreData(len(a.dataRows))
+			if a.selectedRow >= len(a.dataRows)-5 && a.moreBelow() {
+				return a, a.loadMoreData()
 			}
-		} else if int64(len(a.dataRows)) < a.totalRows {
+		} else if a.moreBelow() {
 			// At end but more rows exist - load them
-			return a, a.loadMoreData(len(a.dataRows))
+			return a, a.loadMoreData()
 		} else {
 			a.updateTableHeight()
 		}
@@ -835,6 +1241,9 @@ func (a *App) handlePageUp() (tea.Model, tea.Cmd) {
 		}
 		a.dataTable.SetCursor(a.selectedRow)
 		a.updateTableHeight()
+		if a.selectedRow < 5 && a.rowBase > 0 {
+			return a, a.loadPreviousData()
+		}
 	}
 	return a, nil
 }
@@ -865,8 +1274,8 @@ func (a *App) handlePageDown() (tea.Model, tea.Cmd) {
 		a.dataTable.SetCursor(a.selectedRow)
 		a.updateTableHeight()
 		// Load more if needed
-		if int64(len(a.dataRows)) < a.totalRows && a.selectedRow >= len(a.dataRows)-5 {
-			return a, a.loadMoreData(len(a.dataRows))
+		if a.moreBelow() && a.selectedRow >= len(a.dataRows)-5 {
+			return a, a.loadMoreData()
 		}
 	}
 	return a, nil
@@ -883,6 +1292,13 @@ func (a *App) handleHome() (tea.Model, tea.Cmd) {
 		a.selectedTable = 0
 		return a, a.loadData
 	case FocusData:
+		if a.rowBase > 0 && a.pagedQuery != "" {
+			return a, a.reloadQuery
+		}
+		if a.rowBase > 0 {
+			// The first rows were dropped; reload from the top
+			return a, a.loadData
+		}
 		a.selectedRow = 0
 		a.dataTable.SetCursor(0)
 		a.updateTableHeight()
@@ -906,9 +1322,9 @@ func (a *App) handleEnd() (tea.Model, tea.Cmd) {
 		}
 	case FocusData:
 		// Jump to end - may need to load more
-		if int64(len(a.dataRows)) < a.totalRows {
+		if a.moreBelow() {
 			// Need to load all remaining - for now just load next batch
-			return a, a.loadMoreData(len(a.dataRows))
+			return a, a.loadMoreData()
 		}
 		a.selectedRow = len(a.dataRows) - 1
 		if a.selectedRow < 0 {
@@ -937,6 +1353,11 @@ func (a *App) handleSelect() (tea.Model, tea.Cmd) {
 func (a *App) handleQueryInput(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	switch msg.Type {
 	case tea.KeyEsc:
+		// Esc also stops a query that is still running
+		if a.cancelQuery != nil {
+			a.cancelQuery()
+			a.cancelQuery = nil
+		}
 		a.queryActive = false
 		a.queryHistoryIdx = -1
 		return a, nil
@@ -952,7 +1373,11 @@ func (a *App) handleQueryInput(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 				}
 			}
 			a.queryHistoryIdx = -1
-			return a, a.executeQuery
+			if database.IsDestructiveQuery(query) && a.dbManager.TOTPSecret(a.user) != "" {
+				a.askTOTP(a.startQuery)
+				return a, nil
+			}
+			return a, a.startQuery("")
 		}
 		a.queryActive = false
 		return a, nil
@@ -1000,14 +1425,225 @@ func (a *App) handleQueryInput(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	return a, nil
 }
 
-func (a *App) executeQuery() tea.Msg {
+// startQuery runs the query input, stopping any still running. A TOTP
+// code, if given, covers its DROP and DELETE statements.
+func (a *App) startQuery(code string) tea.Cmd {
+	if a.cancelQuery != nil {
+		a.cancelQuery()
+	}
+	ctx := a.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, a.cancelQuery = context.WithCancel(ctx)
+	if code != "" {
+		ctx = database.WithTOTP(ctx, code)
+	}
+	return a.runQuery(ctx)
+}
+
+// askTOTP prompts for a TOTP code, then calls run with it.
+func (a *App) askTOTP(run func(code string) tea.Cmd) {
+	a.totpActive = true
+	a.totpInput = ""
+	a.totpRun = run
+}
+
+// handleTOTPInput reads a TOTP code. Esc gives up on what it was for.
+func (a *App) handleTOTPInput(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.Type {
+	case tea.KeyEsc:
+		a.totpActive = false
+		a.totpRun = nil
+		return a, nil
+
+	case tea.KeyEnter:
+		code, run := a.totpInput, a.totpRun
+		a.totpActive = false
+		a.totpInput = ""
+		a.totpRun = nil
+		return a, run(code)
+
+	case tea.KeyBackspace:
+		if len(a.totpInput) > 0 {
+			a.totpInput = a.totpInput[:len(a.totpInput)-1]
+		}
+		return a, nil
+
+	case tea.KeyRunes:
+		a.totpInput += string(msg.Runes)
+		return a, nil
+	}
+
+	return a, nil
+}
+
+// runQuery runs the query input in the background. A write finding the
+// write lock held waits in line for up to queryLockWait, whatever the
+// database's lock policy, reporting its place in the queue.
+func (a *App) runQuery(ctx context.Context) tea.Cmd {
+	waits := make(chan LockWaitMsg, 8)
+	a.lockWaits, a.lockWait = waits, nil
+	ctx = database.WithLockTimeout(ctx, queryLockWait)
+	ctx = database.WithLockWaitFunc(ctx, func(position int, heldBy string) {
+		select {
+		case waits <- LockWaitMsg{Position: position, HeldBy: heldBy, waits: waits}:
+		default:
+		}
+	})
+	return tea.Batch(func() tea.Msg {
+		defer close(waits)
+		return a.executeQuery(ctx)
+	}, waitForLockWait(waits))
+}
+
+// waitForLockWait returns a command reading the next LockWaitMsg of a
+// query. It yields nil once the query is over.
+func waitForLockWait(waits <-chan LockWaitMsg) tea.Cmd {
+	return func() tea.Msg {
+		if msg, ok := <-waits; ok {
+			return msg
+		}
+		return nil
+	}
+}
+
+// executeQuery runs the query input; cancelling ctx stops it.
+func (a *App) executeQuery(ctx context.Context) tea.Msg {
 	if a.selectedDB >= len(a.databases) {
 		return QueryExecutedMsg{Error: fmt.Errorf("no database selected")}
 	}
 
+	if a.checkRate != nil {
+		if err := a.checkRate(); err != nil {
+			return QueryExecutedMsg{Error: err}
+		}
+	}
+	if a.session != nil {
+		if err := a.session.ChargeQuery(); err != nil {
+			return QueryExecutedMsg{Error: err}
+		}
+	}
+
+	// A SELECT without a LIMIT loads a page at a time, the rest as the
+	// user scrolls to it
 	db := a.databases[a.selectedDB]
-	result, err := a.dbManager.ExecuteQuery(db.Alias, a.user, "", a.queryInput)
-	return QueryExecutedMsg{Result: result, Error: err}
+	query := a.queryInput
+	if command := a.dbManager.QueryApproval(a.user, query); command != "" &&
+		a.dbManager.GetAccessLevel(a.user, db.Alias).CanWrite() {
+		return QueryExecutedMsg{Error: a.requestApproval(db, query, command)}
+	}
+	paged, ok := database.PageQuery(query, pageSize+1, 0)
+	if ok {
+		query = paged
+	}
+	result, err := a.runSQL(ctx, db, query)
+	if errors.Is(err, database.ErrAccessDenied) && a.historyStore != nil {
+		a.historyStore.RecordAuditSimple(a.sessionID, "ACCESS_DENIED", db.Path, "", map[string]any{
+			"via":   "tui",
+			"query": a.queryInput,
+		})
+	}
+
+	msg := QueryExecutedMsg{Result: result, Error: err}
+	if ok && result != nil {
+		msg.Paged = a.queryInput
+		msg.More = trimPage(result, pageSize)
+	}
+	a.takeRows(result)
+	return msg
+}
+
+// requestApproval stores a query that does what a command needing an
+// admin's approval does as a pending request, as the CLI's query command
+// does, and returns the error telling the user so.
+func (a *App) requestApproval(db *database.DatabaseInfo, query, command string) error {
+	if a.historyStore == nil || a.user == nil || a.user.IsAnonymous {
+		return fmt.Errorf("%w: the query does what %s does", database.ErrApprovalRequired, command)
+	}
+	approval := &history.Approval{
+		UserName:     a.user.Name,
+		Command:      "query",
+		Args:         []string{db.Alias, query},
+		DatabasePath: db.Path,
+	}
+	if err := a.historyStore.CreateApproval(approval); err != nil {
+		return fmt.Errorf("failed to request approval: %w", err)
+	}
+	a.historyStore.RecordAuditSimple(a.sessionID, "APPROVAL_REQUESTED", db.Path, "", map[string]any{
+		"approval": approval.ID,
+		"command":  "query",
+		"args":     approval.Args,
+		"via":      "tui",
+	})
+	return fmt.Errorf("%w: requested as #%d, the query runs when an admin approves it", database.ErrApprovalRequired, approval.ID)
+}
+
+// runSQL runs a query on a database. Tables of other databases, as in
+// other.table, are attached for the query, outside transactions.
+func (a *App) runSQL(ctx context.Context, db *database.DatabaseInfo, query string) (*database.QueryResult, error) {
+	if refs := a.dbManager.ReferencedDatabases(db.Alias, query); len(refs) > 0 && a.dbManager.Tx(a.sessionID) == nil {
+		return a.dbManager.ExecuteCrossQuery(ctx, append([]string{db.Alias}, refs...), a.user, a.sessionID, query)
+	}
+	return a.dbManager.ExecuteQuery(ctx, db.Alias, a.user, a.sessionID, query)
+}
+
+// loadQueryPage loads up to limit rows of the paged query shown, starting
+// at row offset of its result.
+func (a *App) loadQueryPage(limit, offset int) tea.Cmd {
+	query := a.pagedQuery
+	return func() tea.Msg {
+		if a.selectedDB >= len(a.databases) {
+			return MoreDataLoadedMsg{Error: fmt.Errorf("no database selected")}
+		}
+		if err := a.checkRowsLeft(); err != nil {
+			return MoreDataLoadedMsg{Error: err}
+		}
+
+		paged, _ := database.PageQuery(query, limit+1, offset)
+		result, err := a.runSQL(context.Background(), a.databases[a.selectedDB], paged)
+		msg := MoreDataLoadedMsg{Result: result, Offset: offset, Query: query, Error: err}
+		if result != nil {
+			msg.More = trimPage(result, limit)
+		}
+		a.takeRows(result)
+		return msg
+	}
+}
+
+// reloadQuery loads the first page of the paged query shown again,
+// replacing the rows loaded.
+func (a *App) reloadQuery() tea.Msg {
+	page := a.loadQueryPage(pageSize, 0)().(MoreDataLoadedMsg)
+	return QueryExecutedMsg{Result: page.Result, Paged: page.Query, More: page.More, Error: page.Error}
+}
+
+// trimPage cuts a result paged with one row extra down to n rows,
+// reporting whether the extra row showed there are more.
+func trimPage(result *database.QueryResult, n int) bool {
+	if len(result.Rows) <= n {
+		return false
+	}
+	result.Rows = result.Rows[:n]
+	return true
+}
+
+// checkRowsLeft fails once the session has fetched all the rows its quota
+// allows.
+func (a *App) checkRowsLeft() error {
+	if a.session != nil && a.session.RowsLeft() == 0 {
+		return fmt.Errorf("%w: no rows left to fetch", server.ErrQuotaExceeded)
+	}
+	return nil
+}
+
+// takeRows charges fetched rows against the session's quota and drops the
+// rows past it.
+func (a *App) takeRows(result *database.QueryResult) {
+	if a.session == nil || result == nil {
+		return
+	}
+	result.Rows = result.Rows[:a.session.TakeRows(len(result.Rows))]
 }
 
 func (a *App) loadQueryHistory() tea.Msg {
@@ -1047,6 +1683,12 @@ func (a *App) handleEditCell() (tea.Model, tea.Cmd) {
 		return a, nil
 	}
 
+	// Query results don't say which rows of which table they came from
+	if a.queryShown {
+		a.editError = fmt.Errorf("query results can't be edited, select a table")
+		return a, nil
+	}
+
 	// Check we have data and a valid row
 	if len(a.dataRows) == 0 || a.selectedRow >= len(a.dataRows) {
 		return a, nil
@@ -1077,7 +1719,18 @@ func (a *App) handleEditInput(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		return a, nil
 
 	case tea.KeyEnter:
-		// Save the cell value
+		// Save the cell value, after a TOTP code from users enrolled in TOTP
+		if a.dbManager.TOTPSecret(a.user) != "" {
+			a.askTOTP(func(code string) tea.Cmd {
+				return func() tea.Msg {
+					if err := a.dbManager.VerifyTOTP(a.user, code); err != nil {
+						return CellUpdatedMsg{Error: err}
+					}
+					return a.executeCellUpdate()
+				}
+			})
+			return a, nil
+		}
 		return a, a.executeCellUpdate
 
 	case tea.KeyLeft:
@@ -1143,59 +1796,66 @@ func (a *App) executeCellUpdate() tea.Msg {
 		return CellUpdatedMsg{Error: err}
 	}
 
-	// Get schema to find primary key
+	// Get schema to find the edited column
 	schema := database.NewSchema(conn)
 	tableInfo, err := schema.GetTableInfo(tableName)
 	if err != nil {
 		return CellUpdatedMsg{Error: err}
 	}
 
-	// Find primary key column(s)
-	var pkCols []string
-	for _, col := range tableInfo.Columns {
-		if col.PrimaryKey > 0 {
-			pkCols = append(pkCols, col.Name)
+	colName := a.dataColumns[a.editCellCol]
+	var editCol *database.ColumnInfo
+	for i, col := range tableInfo.Columns {
+		if col.Name == colName {
+			if col.Generated != "" {
+				return CellUpdatedMsg{Error: fmt.Errorf("%s is a generated column (AS %s) and can't be edited", colName, col.Expression)}
+			}
+			editCol = &tableInfo.Columns[i]
 		}
 	}
+	if editCol == nil {
+		return CellUpdatedMsg{Error: fmt.Errorf("column %s not found in table", colName)}
+	}
 
-	if len(pkCols) == 0 {
-		return CellUpdatedMsg{Error: fmt.Errorf("table has no primary key")}
+	// Store the input as the column's type, not always as text
+	value, err := database.ParseCellInput(a.editCellValue, *editCol)
+	if err != nil {
+		return CellUpdatedMsg{Error: err}
 	}
 
-	// Build UPDATE query
-	colName := a.dataColumns[a.editCellCol]
 	row := a.dataRows[a.editCellRow]
 
-	// Build WHERE clause from primary key values
-	whereParts := make([]string, len(pkCols))
-	whereArgs := make([]any, len(pkCols))
-	for i, pkCol := range pkCols {
-		// Find pk column index
-		pkIdx := -1
-		for j, c := range a.dataColumns {
-			if c == pkCol {
-				pkIdx = j
-				break
-			}
+	// Saving the displayed text would corrupt binary data or cut the value
+	switch row[a.editCellCol].(type) {
+	case []byte, database.TruncatedValue:
+		return CellUpdatedMsg{Error: fmt.Errorf("BLOB and truncated values can't be edited here")}
+	}
+
+	// Identify the row by all of its primary key columns, or by the rowid
+	// the table was paged by when it has none
+	pkCols, err := database.GetPrimaryKeyColumn(conn, tableName)
+	if err != nil {
+		return CellUpdatedMsg{Error: err}
+	}
+	key := make(map[string]any, len(pkCols))
+	for _, pkCol := range pkCols {
+		if idx := slices.Index(a.dataColumns, pkCol); idx >= 0 && idx < len(row) {
+			key[pkCol] = row[idx]
+			continue
 		}
-		if pkIdx == -1 || pkIdx >= len(row) {
-			return CellUpdatedMsg{Error: fmt.Errorf("primary key column %s not found in data", pkCol)}
+		if pkCol == "rowid" && a.browseKey == "rowid" && a.editCellRow < len(a.dataKeys) {
+			key[pkCol] = a.dataKeys[a.editCellRow]
+			continue
 		}
-		whereParts[i] = fmt.Sprintf("%s = ?", pkCol)
-		whereArgs[i] = row[pkIdx]
+		return CellUpdatedMsg{Error: fmt.Errorf("primary key column %s not found in data", pkCol)}
 	}
 
-	query := fmt.Sprintf("UPDATE %s SET %s = ? WHERE %s",
-		tableName, colName, strings.Join(whereParts, " AND "))
-	args := append([]any{a.editCellValue}, whereArgs...)
-
-	_, err = conn.Execute(query, args...)
-	if err != nil {
+	if _, err := database.UpdateCell(conn, tableName, key, colName, value); err != nil {
 		return CellUpdatedMsg{Error: err}
 	}
 
 	// Update local data
-	a.dataRows[a.editCellRow][a.editCellCol] = a.editCellValue
+	a.dataRows[a.editCellRow][a.editCellCol] = value
 
 	return CellUpdatedMsg{Error: nil}
 }
@@ -1219,6 +1879,166 @@ func (a *App) loadSchema() tea.Msg {
 	return SchemaLoadedMsg{Info: info, Error: err}
 }
 
+// loadDatabaseInfo loads the metadata of the selected database.
+func (a *App) loadDatabaseInfo() tea.Msg {
+	if a.selectedDB >= len(a.databases) {
+		return DatabaseInfoLoadedMsg{Error: fmt.Errorf("no database selected")}
+	}
+
+	conn, err := a.dbManager.OpenConnection(a.databases[a.selectedDB].Alias, a.user)
+	if err != nil {
+		return DatabaseInfoLoadedMsg{Error: err}
+	}
+
+	info, err := database.NewSchema(conn).DatabaseInfo()
+	if err != nil {
+		return DatabaseInfoLoadedMsg{Error: err}
+	}
+	sizes, _ := database.MeasureSizes(context.Background(), conn)
+	return DatabaseInfoLoadedMsg{Info: info, Sizes: sizes}
+}
+
+// startCheck starts an integrity check of the selected database. Its
+// progress arrives as messages read by waitForCheck.
+func (a *App) startCheck() tea.Cmd {
+	if a.selectedDB >= len(a.databases) {
+		return nil
+	}
+	conn, err := a.dbManager.OpenConnection(a.databases[a.selectedDB].Alias, a.user)
+	if err != nil {
+		a.checkErr = err
+		return nil
+	}
+
+	ctx := a.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, a.cancelCheck = context.WithCancel(ctx)
+	a.checkProgress, a.checkReport, a.checkErr = nil, nil, nil
+
+	msgs := make(chan tea.Msg)
+	a.checkMsgs = msgs
+	send := func(msg tea.Msg) {
+		select {
+		case msgs <- msg:
+		case <-ctx.Done():
+		}
+	}
+	go func() {
+		defer close(msgs)
+		report, err := database.IntegrityCheck(ctx, conn, false, func(p database.IntegrityProgress) {
+			send(IntegrityProgressMsg{Progress: p})
+		})
+		send(IntegrityCheckedMsg{Report: report, Error: err})
+	}()
+	return a.waitForCheck(msgs)
+}
+
+// waitForCheck returns a command reading the next message of a check. It
+// yields nil once the check is over.
+func (a *App) waitForCheck(msgs chan tea.Msg) tea.Cmd {
+	return func() tea.Msg {
+		return <-msgs
+	}
+}
+
+// startWatch follows the table shown, appending rows added to it as they
+// arrive. Its events are read by waitForFeed.
+func (a *App) startWatch() tea.Cmd {
+	ctx := a.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, cancel := context.WithCancel(ctx)
+
+	table := a.tables[a.selectedTable]
+	_, events, err := a.dbManager.Follow(ctx, a.databases[a.selectedDB].Alias, a.user, table)
+	if err != nil {
+		cancel()
+		a.err = err
+		return nil
+	}
+	a.watching, a.watchEvents, a.cancelWatch = table, events, cancel
+	a.watchDB = a.databases[a.selectedDB].Path
+	return a.waitForFeed(table, events)
+}
+
+// waitForFeed returns a command reading the next events of a watched
+// table, along with any others already waiting.
+func (a *App) waitForFeed(table string, events <-chan database.FeedEvent) tea.Cmd {
+	return func() tea.Msg {
+		e, ok := <-events
+		if !ok {
+			return FeedEventsMsg{Table: table, Closed: true}
+		}
+		msg := FeedEventsMsg{Table: table, Events: []database.FeedEvent{e}}
+		for {
+			select {
+			case e, ok := <-events:
+				if !ok {
+					msg.Closed = true
+					return msg
+				}
+				msg.Events = append(msg.Events, e)
+			default:
+				return msg
+			}
+		}
+	}
+}
+
+// applyFeed adds the rows a watched table's feed found to the data shown.
+// New rows are appended when the end of the table is loaded, following
+// them if the last row was selected; updated rows mark the data stale.
+func (a *App) applyFeed(events []database.FeedEvent) {
+	atEnd := !a.moreBelow()
+	following := a.selectedRow == len(a.dataRows)-1
+	for _, e := range events {
+		switch {
+		case e.Err != nil:
+			a.err = e.Err
+		case e.Op == database.FeedUpdate:
+			a.stale = true
+		case atEnd:
+			a.dataRows = append(a.dataRows, e.Row)
+			if a.dataKeys != nil {
+				a.dataKeys = append(a.dataKeys, e.Key)
+			}
+			a.totalRows++
+		default:
+			a.totalRows++
+		}
+	}
+	if atEnd && following && len(a.dataRows) > 0 {
+		a.selectedRow = len(a.dataRows) - 1
+	}
+	a.updateDataTable()
+	a.updateTableHeight()
+}
+
+// showsWatched reports whether the table shown is the one watched.
+func (a *App) showsWatched() bool {
+	return !a.queryShown && a.selectedDB < len(a.databases) && a.databases[a.selectedDB].Path == a.watchDB &&
+		a.selectedTable < len(a.tables) && a.tables[a.selectedTable] == a.watching
+}
+
+// stopWatch stops following the watched table.
+func (a *App) stopWatch() {
+	if a.cancelWatch != nil {
+		a.cancelWatch()
+	}
+	a.watching, a.watchEvents, a.cancelWatch = "", nil, nil
+}
+
+// stopCheck cancels a running integrity check.
+func (a *App) stopCheck() {
+	if a.cancelCheck != nil {
+		a.cancelCheck()
+		a.cancelCheck = nil
+	}
+}
+
 // View implements tea.Model.
 func (a *App) View() string {
 	if a.width < 40 || a.height < 10 {
@@ -1234,6 +2054,10 @@ func (a *App) View() string {
 		return a.renderSchema()
 	}
 
+	if a.showDBInfo {
+		return a.renderDatabaseInfo()
+	}
+
 	// Calculate pane widths based on content
 	dbWidth := a.calculateDBPaneWidth()
 	tableWidth := a.calculateTablePaneWidth()
@@ -1420,6 +2244,7 @@ func (a *App) renderDataPane(width, height int) string {
 	if a.editingCell {
 		editInfo := fmt.Sprintf("Editing [%s]: %s█", a.dataColumns[a.editCellCol], a.editCellValue)
 		content.WriteString(queryInputStyle.Render(editInfo))
+		content.WriteString(dimItemStyle.Render("  NULL for null"))
 		content.WriteString("\n")
 	} else if a.editError != nil {
 		content.WriteString(errorStyle.Render(a.editError.Error()))
@@ -1442,14 +2267,34 @@ func (a *App) renderDataPane(width, height int) string {
 	if a.selectedRow == len(a.dataRows)-1 && len(a.dataRows) > 0 {
 		lastVisible = a.selectedRow
 	}
-	rowsBelow := a.totalRows - int64(lastVisible) - 1
-	if rowsBelow > 0 {
+	rowsBelow := a.totalRows - int64(a.rowBase+lastVisible) - 1
+	if rowsBelow > 0 || a.queryMore {
 		indicator := fmt.Sprintf("\n↓ %d more rows", rowsBelow)
-		if int64(len(a.dataRows)) < a.totalRows {
+		switch {
+		case a.queryMore && rowsBelow > 0:
+			indicator = fmt.Sprintf("\n↓ %d+ more rows", rowsBelow)
+		case a.queryMore:
+			indicator = "\n↓ more rows"
+		case a.rowsApprox:
+			indicator = fmt.Sprintf("\n↓ ~%d more rows", rowsBelow)
+		}
+		if a.moreBelow() {
 			indicator += " (scroll to load)"
 		}
 		content.WriteString(dimItemStyle.Render(indicator))
 	}
+	if a.resultNote != "" {
+		content.WriteString(errorStyle.Render("\n" + a.resultNote))
+	}
+	if a.watching != "" {
+		content.WriteString(dimItemStyle.Render("\nWatching for new rows, w to stop"))
+	}
+	switch {
+	case a.stale && a.queryShown:
+		content.WriteString(dimItemStyle.Render("\nDatabase changed since the query ran"))
+	case a.stale:
+		content.WriteString(dimItemStyle.Render("\nTable may have changed, press r to reload"))
+	}
 
 	return a.renderPaneWithTitle(content.String(), width, height, "Data", focused)
 }
@@ -1565,9 +2410,18 @@ func (a *App) renderPaneWithTitle(content string, width, height int, title strin
 }
 
 func (a *App) renderQueryBar() string {
+	if a.totpActive {
+		return queryPromptStyle.Render("TOTP code: ") + queryInputStyle.Render(strings.Repeat("*", len(a.totpInput))+"█") +
+			dimItemStyle.Render("  enter to continue, esc to cancel")
+	}
 	prompt := queryPromptStyle.Render("SQL> ")
 	if a.queryActive {
-		return prompt + queryInputStyle.Render(a.queryInput+"█")
+		bar := prompt + queryInputStyle.Render(a.queryInput+"█")
+		if w := a.lockWait; w != nil && a.cancelQuery != nil {
+			bar += dimItemStyle.Render(fmt.Sprintf("  waiting for the write lock held by %s (%s in line), esc to cancel",
+				w.HeldBy, humanize.Ordinal(w.Position)))
+		}
+		return bar
 	}
 	if a.queryError != nil {
 		return prompt + errorStyle.Render(a.queryError.Error())
@@ -1582,6 +2436,9 @@ func (a *App) renderStatusBar() string {
 	// Left side: title and user
 	leftParts = append(leftParts, titleStyle.Render("sqlite-tui"))
 	leftParts = append(leftParts, dimItemStyle.Render(a.user.DisplayName()))
+	if !a.idleDeadline.IsZero() {
+		leftParts = append(leftParts, errorStyle.Render(server.FormatIdleWarning(a.idleDeadline, "press any key")))
+	}
 
 	// Right side: db/table info, row count, badge, help
 	if a.selectedDB < len(a.databases) {
@@ -1592,11 +2449,18 @@ func (a *App) renderStatusBar() string {
 		rightParts = append(rightParts, statusValueStyle.Render("> "+a.tables[a.selectedTable]))
 	}
 
-	// Row count
+	// Row count, "~" marking an estimate and "+" a paged query with more
+	approx, more := "", ""
+	if a.rowsApprox {
+		approx = "~"
+	}
+	if a.queryMore {
+		more = "+"
+	}
 	if len(a.dataRows) > 0 {
-		rightParts = append(rightParts, dimItemStyle.Render(fmt.Sprintf("| row %d/%d", a.selectedRow+1, a.totalRows)))
+		rightParts = append(rightParts, dimItemStyle.Render(fmt.Sprintf("| row %d/%s%d%s", a.rowBase+a.selectedRow+1, approx, a.totalRows, more)))
 	} else if a.totalRows > 0 {
-		rightParts = append(rightParts, dimItemStyle.Render(fmt.Sprintf("| %d rows", a.totalRows)))
+		rightParts = append(rightParts, dimItemStyle.Render(fmt.Sprintf("| %s%d rows", approx, a.totalRows)))
 	}
 
 	// Access level badge
@@ -1651,7 +2515,8 @@ func (a *App) renderHelp() string {
 		{"Enter", "Select"},
 		{"/", "Query mode (↑/↓ for history)"},
 		{"e", "Edit cell (write access)"},
-		{"s", "Show schema"},
+		{"s", "Show schema (database info in databases pane)"},
+		{"c", "Count rows exactly (integrity check in database info)"},
 		{"r", "Refresh"},
 		{"?", "Toggle help"},
 		{"q, Ctrl+C", "Quit"},
@@ -1678,7 +2543,12 @@ func (a *App) renderSchema() string {
 	} else {
 		b.WriteString(paneHeaderStyle.Render(a.schema.Name))
 		b.WriteString("\n")
-		b.WriteString(fmt.Sprintf("Rows: %d\n\n", a.schema.RowCount))
+		b.WriteString(fmt.Sprintf("Rows: %d\n", a.schema.RowCount))
+		if a.schema.Kind == database.TableKindVirtual {
+			b.WriteString(dimItemStyle.Render(fmt.Sprintf("Virtual table using %s(%s)", a.schema.Module, strings.Join(a.schema.ModuleArgs, ", "))))
+			b.WriteString("\n")
+		}
+		b.WriteString("\n")
 
 		nameW, typeW := 6, 4
 		for _, col := range a.schema.Columns {
@@ -1702,7 +2572,27 @@ func (a *App) renderSchema() string {
 			if col.NotNull {
 				nn = "✓"
 			}
-			b.WriteString(fmt.Sprintf("%-*s  %-*s  %s  %s\n", nameW, col.Name, typeW, col.Type, pk, nn))
+			line := fmt.Sprintf("%-*s  %-*s  %s  %s", nameW, col.Name, typeW, col.Type, pk, nn)
+			switch {
+			case col.Generated != "":
+				line += dimItemStyle.Render(fmt.Sprintf("  AS (%s) %s", col.Expression, col.Generated))
+			case col.Hidden:
+				line += dimItemStyle.Render("  hidden")
+			}
+			b.WriteString(line + "\n")
+		}
+
+		if len(a.schema.Triggers) > 0 {
+			b.WriteString("\n")
+			b.WriteString(tableHeaderStyle.Render("Triggers"))
+			b.WriteString("\n")
+			for _, trig := range a.schema.Triggers {
+				event := trig.Event
+				if len(trig.Columns) > 0 {
+					event += " OF " + strings.Join(trig.Columns, ", ")
+				}
+				b.WriteString(fmt.Sprintf("%s  %s\n", trig.Name, dimItemStyle.Render(trig.Timing+" "+event)))
+			}
 		}
 	}
 
@@ -1713,6 +2603,71 @@ func (a *App) renderSchema() string {
 	return lipgloss.Place(a.width, a.height, lipgloss.Center, lipgloss.Center, modal)
 }
 
+func (a *App) renderDatabaseInfo() string {
+	var b strings.Builder
+
+	if a.dbInfo == nil || a.selectedDB >= len(a.databases) {
+		b.WriteString(dimItemStyle.Render("Loading..."))
+	} else {
+		info := a.dbInfo
+		b.WriteString(paneHeaderStyle.Render(a.databases[a.selectedDB].Alias))
+		b.WriteString("\n\n")
+		for _, field := range []struct{ name, value string }{
+			{"Size", humanize.Bytes(uint64(info.Size()))},
+			{"Pages", fmt.Sprintf("%d x %d bytes", info.PageCount, info.PageSize)},
+			{"Free pages", fmt.Sprintf("%d", info.FreelistCount)},
+			{"Encoding", info.Encoding},
+			{"Journal mode", info.JournalMode},
+			{"WAL size", humanize.Bytes(uint64(info.WALSize))},
+			{"User version", fmt.Sprintf("%d", info.UserVersion)},
+			{"Application ID", fmt.Sprintf("%d", info.ApplicationID)},
+		} {
+			b.WriteString(helpKeyStyle.Render(fmt.Sprintf("%-16s", field.name)))
+			b.WriteString(field.value + "\n")
+		}
+
+		if sizes := a.dbSizes; sizes != nil && len(sizes.Objects) > 0 {
+			label := "Largest"
+			if sizes.Estimated {
+				label += " (est.)"
+			}
+			for i, obj := range sizes.Largest(dbInfoLargest) {
+				b.WriteString(helpKeyStyle.Render(fmt.Sprintf("%-16s", label)))
+				b.WriteString(fmt.Sprintf("%s  %s\n", truncateString(obj.Name, 30), dimItemStyle.Render(obj.Type+", "+humanize.Bytes(uint64(obj.Bytes)))))
+				if i == 0 {
+					label = ""
+				}
+			}
+		}
+
+		b.WriteString(helpKeyStyle.Render(fmt.Sprintf("%-16s", "Integrity")))
+		switch {
+		case a.checkErr != nil:
+			b.WriteString(errorStyle.Render(a.checkErr.Error()))
+		case a.checkReport != nil && a.checkReport.OK():
+			b.WriteString(fmt.Sprintf("ok (%d tables)", a.checkReport.Tables))
+		case a.checkReport != nil:
+			b.WriteString(errorStyle.Render(fmt.Sprintf("%d problems", len(a.checkReport.Problems))))
+			for _, p := range a.checkReport.Problems[:min(5, len(a.checkReport.Problems))] {
+				b.WriteString("\n  " + truncateString(p, 60))
+			}
+		case a.cancelCheck != nil && a.checkProgress != nil:
+			b.WriteString(fmt.Sprintf("checking %d/%d (%s)", a.checkProgress.Done, a.checkProgress.Total, a.checkProgress.Table))
+		case a.cancelCheck != nil:
+			b.WriteString("checking...")
+		default:
+			b.WriteString(dimItemStyle.Render("press c to check"))
+		}
+		b.WriteString("\n")
+	}
+
+	b.WriteString("\n")
+	b.WriteString(dimItemStyle.Render("Press Esc to close"))
+
+	modal := modalStyle.Render(titleStyle.Render("Database") + "\n\n" + b.String())
+	return lipgloss.Place(a.width, a.height, lipgloss.Center, lipgloss.Center, modal)
+}
+
 // truncateString truncates a string to maxLen, adding ellipsis if needed
 func truncateString(s string, maxLen int) string {
 	if maxLen <= 0 {
@@ -20,6 +20,13 @@ func Handler(dbManager *database.Manager, historyStore *history.Store) bubbletea
 		}
 
 		app := NewApp(dbManager, historyStore, user, pty.Window.Width, pty.Window.Height)
+		app.checkRate = func() error { return server.CheckQueryRate(s) }
+		app.idleWarnings = server.GetIdleWarningsFromSSH(s)
+		app.ctx = s.Context()
+		if session := server.GetSessionFromSSH(s); session != nil {
+			app.sessionID = session.ID
+			app.session = session
+		}
 
 		return app, []tea.ProgramOption{
 			tea.WithAltScreen(),
@@ -25,6 +25,8 @@ type KeyMap struct {
 	Edit    key.Binding
 	Delete  key.Binding
 	Insert  key.Binding
+	Count   key.Binding
+	Watch   key.Binding
 
 	// General
 	Help key.Binding
@@ -106,6 +108,14 @@ func DefaultKeyMap() KeyMap {
 			key.WithKeys("n"),
 			key.WithHelp("n", "new row"),
 		),
+		Count: key.NewBinding(
+			key.WithKeys("c"),
+			key.WithHelp("c", "count rows"),
+		),
+		Watch: key.NewBinding(
+			key.WithKeys("w"),
+			key.WithHelp("w", "watch table"),
+		),
 		Help: key.NewBinding(
 			key.WithKeys("?"),
 			key.WithHelp("?", "help"),
@@ -127,7 +137,7 @@ func (k KeyMap) FullHelp() [][]key.Binding {
 	return [][]key.Binding{
 		{k.Up, k.Down, k.Left, k.Right},
 		{k.NextPane, k.Select, k.Back},
-		{k.Query, k.Refresh, k.Schema},
+		{k.Query, k.Refresh, k.Schema, k.Count, k.Watch},
 		{k.Edit, k.Delete, k.Insert},
 		{k.Help, k.Quit},
 	}
@@ -1,6 +1,8 @@
 package tui
 
 import (
+	"time"
+
 	"github.com/johan-st/sqlite-tui/internal/database"
 )
 
@@ -13,37 +15,89 @@ type DatabasesLoadedMsg struct {
 
 // TablesLoadedMsg is sent when tables are loaded.
 type TablesLoadedMsg struct {
-	Tables []string
-	Error  error
+	Tables  []string
+	Error   error
+	Refresh bool // reloaded after a schema change, keeping the selection
 }
 
 // DataLoadedMsg is sent when table data is loaded.
 type DataLoadedMsg struct {
-	Result    *database.QueryResult
-	TotalRows int64
-	Offset    int
-	Error     error
+	Result     *database.QueryResult
+	TotalRows  int64
+	RowsApprox bool   // TotalRows is an estimate
+	KeyColumn  string // column the rows are paged by, "" for offset paging
+	Offset     int
+	Error      error
 }
 
 // MoreDataLoadedMsg is sent when additional rows are loaded.
 type MoreDataLoadedMsg struct {
 	Result *database.QueryResult
 	Offset int
+	Query  string // paged query the rows are from, "" for table rows
+	More   bool   // the paged query has rows past these
 	Error  error
 }
 
+// RowCountMsg is sent when a table's rows were counted exactly.
+type RowCountMsg struct {
+	Table string
+	Count int64
+	Error error
+}
+
 // SchemaLoadedMsg is sent when table schema is loaded.
 type SchemaLoadedMsg struct {
 	Info  *database.TableInfo
 	Error error
 }
 
+// DatabaseInfoLoadedMsg is sent when database metadata is loaded.
+type DatabaseInfoLoadedMsg struct {
+	Info  *database.DatabaseMetadata
+	Sizes *database.SizeReport // nil if sizes couldn't be measured
+	Error error
+}
+
+// IntegrityProgressMsg is sent after each table of an integrity check.
+type IntegrityProgressMsg struct {
+	Progress database.IntegrityProgress
+}
+
+// IntegrityCheckedMsg is sent when an integrity check finishes.
+type IntegrityCheckedMsg struct {
+	Report *database.IntegrityReport
+	Error  error
+}
+
 // QueryExecutedMsg is sent when a query is executed.
 type QueryExecutedMsg struct {
 	Result *database.QueryResult
+	Paged  string // the query, when the result is its first page
+	More   bool   // the paged query has rows past the first page
 	Error  error
 }
 
+// LockWaitMsg is sent while a write query waits for the write lock, with
+// its place in the queue.
+type LockWaitMsg struct {
+	Position int
+	HeldBy   string
+	waits    <-chan LockWaitMsg
+}
+
+// DatabaseChangedMsg is sent when an open database was written to.
+type DatabaseChangedMsg struct {
+	Change database.DatabaseChange
+}
+
+// FeedEventsMsg carries the rows a watched table's change feed found.
+type FeedEventsMsg struct {
+	Table  string
+	Events []database.FeedEvent
+	Closed bool // the feed ended
+}
+
 // ErrorMsg is sent when an error occurs.
 type ErrorMsg struct {
 	Error error
@@ -57,6 +111,17 @@ type QueryHistoryLoadedMsg struct {
 	Queries []string
 }
 
+// IdleWarningMsg is sent when the server is about to disconnect the idle
+// session at Deadline, or with a zero Deadline when activity resumed.
+type IdleWarningMsg struct {
+	Deadline time.Time
+}
+
+// idleTickMsg redraws the countdown of the idle warning for deadline.
+type idleTickMsg struct {
+	deadline time.Time
+}
+
 // CellUpdatedMsg is sent when a cell update completes.
 type CellUpdatedMsg struct {
 	Error error
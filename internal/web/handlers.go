@@ -0,0 +1,264 @@
+package web
+
+import (
+	"embed"
+	"errors"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/johan-st/sqlite-tui/internal/access"
+	"github.com/johan-st/sqlite-tui/internal/database"
+)
+
+// pageSize is the number of rows per page in the table browser
+const pageSize = 100
+
+//go:embed templates/*.html
+var templateFS embed.FS
+
+var templates = template.Must(template.New("").Funcs(template.FuncMap{
+	"pathEscape": url.PathEscape,
+	"add":        func(a, b int) int { return a + b },
+	"sub":        func(a, b int) int { return a - b },
+}).ParseFS(templateFS, "templates/*.html"))
+
+// page is the data rendered by the page template.
+type page struct {
+	View  string // index, database, table, query or error
+	Title string
+	User  *access.UserInfo
+
+	Databases []*database.DatabaseInfo
+	DB        string
+	Tables    []string
+	Views     []string
+	Table     string
+
+	Query  string
+	Result *result
+	Error  string
+
+	Page, Pages int
+	Total       int64
+}
+
+// result is a query result formatted for display.
+type result struct {
+	Columns   []string
+	Rows      [][]string
+	Truncated string // why rows were left out, if they were
+	Duration  time.Duration
+}
+
+func (s *Server) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", s.handleIndex)
+	mux.HandleFunc("GET /db/{db}", s.handleDatabase)
+	mux.HandleFunc("GET /db/{db}/table/{table}", s.handleTable)
+	mux.HandleFunc("GET /db/{db}/query", s.handleQuery)
+	mux.HandleFunc("GET /login", s.handleLogin)
+	mux.HandleFunc("POST /logout", s.handleLogout)
+	return securityHeaders(mux)
+}
+
+// securityHeaders keeps pages out of caches and frames, and allows no
+// scripts.
+func securityHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("X-Frame-Options", "DENY")
+		w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; form-action 'self'")
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) render(w http.ResponseWriter, status int, p *page) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	if err := templates.ExecuteTemplate(w, "page.html", p); err != nil {
+		slog.Error("Failed to render web page", "view", p.View, "err", err)
+	}
+}
+
+func (s *Server) renderError(w http.ResponseWriter, status int, user *access.UserInfo, msg string) {
+	s.render(w, status, &page{View: "error", Title: http.StatusText(status), User: user, Error: msg})
+}
+
+func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
+	user := s.user(r)
+	s.render(w, http.StatusOK, &page{
+		View:      "index",
+		Title:     "Databases",
+		User:      user,
+		Databases: s.dbManager.ListDatabases(user),
+	})
+}
+
+// open returns the manager's connection to the database named in the
+// request for reading its schema, or renders an error. Databases the user
+// can't read are reported as not found.
+func (s *Server) open(w http.ResponseWriter, r *http.Request, user *access.UserInfo) (*database.Connection, bool) {
+	name := r.PathValue("db")
+	conn, err := s.dbManager.OpenConnection(name, user)
+	switch {
+	case errors.Is(err, database.ErrDatabaseNotFound), errors.Is(err, database.ErrAccessDenied):
+		s.renderError(w, http.StatusNotFound, user, "Database not found: "+name)
+		return nil, false
+	case err != nil:
+		slog.Error("Web viewer failed to open database", "db", name, "err", err)
+		s.renderError(w, http.StatusInternalServerError, user, "Failed to open database")
+		return nil, false
+	}
+	return conn, true
+}
+
+// query runs a read through the manager, which applies the user's query
+// limits, timeout and row filters, and charges anonymous visitors' quota.
+// The viewer never writes, whatever the user's access level. It returns
+// the error message instead of an error, for display.
+func (s *Server) query(r *http.Request, user *access.UserInfo, db, query string, args ...any) (*result, string) {
+	rowsLeft, err := s.quotas.charge(user)
+	if err != nil {
+		return nil, err.Error()
+	}
+
+	ctx := database.WithReadOnly(r.Context())
+	res, err := s.dbManager.ExecuteQueryArgs(ctx, db, user, "web-"+uuid.New().String(), query, args...)
+	if err != nil {
+		return nil, err.Error()
+	}
+
+	note := res.TruncationNote()
+	if rowsLeft >= 0 && len(res.Rows) > rowsLeft {
+		res.Rows = res.Rows[:rowsLeft]
+		note = errQuotaExceeded.Error() + ": no rows left to fetch"
+	}
+	s.quotas.takeRows(user, len(res.Rows))
+	out := formatResult(res.Columns, res.Rows, res.Duration)
+	out.Truncated = note
+	return out, ""
+}
+
+func (s *Server) handleDatabase(w http.ResponseWriter, r *http.Request) {
+	user := s.user(r)
+	conn, ok := s.open(w, r, user)
+	if !ok {
+		return
+	}
+
+	p := &page{View: "database", Title: r.PathValue("db"), User: user, DB: r.PathValue("db")}
+	schema := database.NewSchema(conn)
+	var err error
+	if p.Tables, err = schema.ListTables(); err == nil {
+		p.Tables = s.dbManager.FilterTables(user, p.DB, p.Tables)
+		p.Views, err = schema.ListViews()
+	}
+	if err != nil {
+		p.Error = err.Error()
+	}
+	s.render(w, http.StatusOK, p)
+}
+
+func (s *Server) handleTable(w http.ResponseWriter, r *http.Request) {
+	user := s.user(r)
+	conn, ok := s.open(w, r, user)
+	if !ok {
+		return
+	}
+
+	db, table := r.PathValue("db"), r.PathValue("table")
+	schema := database.NewSchema(conn)
+	if exists, err := schema.TableExists(table); err != nil || !exists || !s.dbManager.TableAccessLevel(user, db, table).CanRead() {
+		s.renderError(w, http.StatusNotFound, user, "Table not found: "+table)
+		return
+	}
+
+	p := &page{View: "table", Title: db + " / " + table, User: user, DB: db, Table: table, Page: 1}
+	if n, err := strconv.Atoi(r.URL.Query().Get("page")); err == nil && n > 0 {
+		p.Page = n
+	}
+
+	total, err := schema.GetRowCount(table)
+	if err != nil {
+		p.Error = err.Error()
+		s.render(w, http.StatusOK, p)
+		return
+	}
+	p.Total = total
+	p.Pages = max(1, int((total+pageSize-1)/pageSize))
+
+	query := `SELECT * FROM "` + strings.ReplaceAll(table, `"`, `""`) + `" LIMIT ? OFFSET ?`
+	p.Result, p.Error = s.query(r, user, db, query, pageSize, (p.Page-1)*pageSize)
+	s.render(w, http.StatusOK, p)
+}
+
+func (s *Server) handleQuery(w http.ResponseWriter, r *http.Request) {
+	user := s.user(r)
+	db := r.PathValue("db")
+	if !s.dbManager.GetAccessLevel(user, db).CanRead() {
+		s.renderError(w, http.StatusNotFound, user, "Database not found: "+db)
+		return
+	}
+
+	p := &page{View: "query", Title: db + " / query", User: user, DB: db, Query: r.URL.Query().Get("q")}
+	if strings.TrimSpace(p.Query) == "" {
+		s.render(w, http.StatusOK, p)
+		return
+	}
+	if !database.ClassifySQL(p.Query).Queries() {
+		p.Error = "Only SELECT, WITH, VALUES and EXPLAIN queries can run in the web viewer"
+		s.render(w, http.StatusBadRequest, p)
+		return
+	}
+
+	p.Result, p.Error = s.query(r, user, db, p.Query)
+	slog.Info("Web query", "user", user.DisplayName(), "db", db, "remote", r.RemoteAddr, "ok", p.Error == "")
+	s.render(w, http.StatusOK, p)
+}
+
+func formatResult(columns []string, rows [][]any, d time.Duration) *result {
+	res := &result{Columns: columns, Rows: make([][]string, len(rows)), Duration: d.Round(time.Microsecond)}
+	for i, row := range rows {
+		res.Rows[i] = make([]string, len(row))
+		for j, v := range row {
+			res.Rows[i][j] = database.FormatValue(v)
+		}
+	}
+	return res
+}
+
+// handleLogin exchanges a web-login link for a session cookie. Each link
+// works once.
+func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
+	t := r.URL.Query().Get("token")
+	name, linkExpires, ok := s.signer.Verify("login", t)
+	if !ok || s.config.FindUserByName(name) == nil || !s.useLogin(t, linkExpires) {
+		s.renderError(w, http.StatusForbidden, s.user(r), "This sign-in link is invalid, expired or already used. Run web-login again for a new one.")
+		return
+	}
+
+	expires := time.Now().Add(sessionTTL)
+	http.SetCookie(w, &http.Cookie{
+		Name:     cookieName,
+		Value:    s.signer.Sign("session", name, expires),
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   r.TLS != nil || strings.HasPrefix(s.baseURL(), "https://"),
+		SameSite: http.SameSiteLaxMode,
+	})
+	slog.Info("Web sign-in", "user", name, "remote", r.RemoteAddr)
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+func (s *Server) handleLogout(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, &http.Cookie{Name: cookieName, Value: "", Path: "/", MaxAge: -1})
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
@@ -0,0 +1,99 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/johan-st/sqlite-tui/internal/access"
+	"github.com/johan-st/sqlite-tui/internal/config"
+)
+
+// quotaWindow is how long anonymous usage counts against the anonymous
+// quota when anonymous_quota sets no max_duration
+const quotaWindow = time.Hour
+
+var errQuotaExceeded = errors.New("anonymous quota exceeded")
+
+// quotas charges anonymous visitors' queries and rows against the
+// anonymous quota. The viewer has no sessions, so usage is counted per IP
+// and starts over after max_duration, as it would for a new SSH session.
+type quotas struct {
+	config *config.Config
+	usage  map[string]*usage
+	mu     sync.Mutex
+}
+
+// usage is what one IP has used since start.
+type usage struct {
+	start   time.Time
+	queries int
+	rows    int
+}
+
+func newQuotas(cfg *config.Config) *quotas {
+	return &quotas{config: cfg, usage: make(map[string]*usage)}
+}
+
+// current returns the usage of an anonymous user's IP in the current
+// window, dropping windows that have ended. The caller holds q.mu.
+func (q *quotas) current(user *access.UserInfo) *usage {
+	window := q.config.GetAnonymousMaxDuration()
+	if window <= 0 {
+		window = quotaWindow
+	}
+	now := time.Now()
+	for ip, u := range q.usage {
+		if now.Sub(u.start) >= window {
+			delete(q.usage, ip)
+		}
+	}
+
+	ip := user.RemoteAddr
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		ip = host
+	}
+	u := q.usage[ip]
+	if u == nil {
+		u = &usage{start: now}
+		q.usage[ip] = u
+	}
+	return u
+}
+
+// charge counts a query against the quota and returns how many rows it
+// may fetch, or -1 if there is no limit. Signed-in users have no quota.
+func (q *quotas) charge(user *access.UserInfo) (int, error) {
+	quota := q.config.AnonymousQuota
+	if !user.IsAnonymous || (quota.MaxQueries <= 0 && quota.MaxRows <= 0) {
+		return -1, nil
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	u := q.current(user)
+	switch {
+	case quota.MaxRows > 0 && u.rows >= quota.MaxRows:
+		return 0, fmt.Errorf("%w: fetched %d rows (max %d)", errQuotaExceeded, u.rows, quota.MaxRows)
+	case quota.MaxQueries > 0 && u.queries >= quota.MaxQueries:
+		return 0, fmt.Errorf("%w: ran %d queries (max %d)", errQuotaExceeded, u.queries, quota.MaxQueries)
+	}
+	u.queries++
+	if quota.MaxRows <= 0 {
+		return -1, nil
+	}
+	return quota.MaxRows - u.rows, nil
+}
+
+// takeRows charges n fetched rows against an anonymous user's quota.
+func (q *quotas) takeRows(user *access.UserInfo, n int) {
+	if !user.IsAnonymous || q.config.AnonymousQuota.MaxRows <= 0 {
+		return
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.current(user).rows += n
+}
@@ -0,0 +1,133 @@
+// Package web serves a minimal read-only browser interface to the managed
+// databases: a database list, a table browser and a query box. Queries run
+// through the database manager with the same access rules, query limits and
+// timeouts as SSH sessions; users sign in with a link from the web-login
+// command, everyone else gets anonymous access and its quota.
+package web
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/johan-st/sqlite-tui/internal/access"
+	"github.com/johan-st/sqlite-tui/internal/config"
+	"github.com/johan-st/sqlite-tui/internal/database"
+	"github.com/johan-st/sqlite-tui/internal/token"
+)
+
+const (
+	// loginLinkTTL is how long a web-login link can be used
+	loginLinkTTL = 10 * time.Minute
+	// sessionTTL is how long a signed-in browser stays signed in
+	sessionTTL = 12 * time.Hour
+
+	cookieName = "sqlite_tui_session"
+)
+
+// Server is the web viewer.
+type Server struct {
+	config    *config.Config
+	dbManager *database.Manager
+	signer    *token.Signer
+	quotas    *quotas
+	http      *http.Server
+
+	// Login links already used, with when they expire
+	usedLogins map[string]time.Time
+	loginMu    sync.Mutex
+}
+
+// NewServer creates the web viewer for the configured listen address. The
+// key signing login links and cookies is kept in the data directory, so
+// sign-ins survive restarts.
+func NewServer(cfg *config.Config, dbManager *database.Manager) (*Server, error) {
+	signer, err := token.Load(filepath.Join(cfg.GetDataDir(), "web_secret"))
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		config:     cfg,
+		dbManager:  dbManager,
+		signer:     signer,
+		quotas:     newQuotas(cfg),
+		usedLogins: make(map[string]time.Time),
+	}
+	s.http = &http.Server{
+		Addr:              cfg.Server.Web.Listen,
+		Handler:           s.routes(),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	return s, nil
+}
+
+// Start serves the web viewer in the background.
+func (s *Server) Start() {
+	slog.Info("Starting web viewer", "url", s.baseURL())
+	go func() {
+		if err := s.http.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			slog.Error("Web viewer error", "err", err)
+		}
+	}()
+}
+
+// Shutdown stops the web viewer.
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.http.Shutdown(ctx)
+}
+
+func (s *Server) baseURL() string {
+	if u := s.config.Server.Web.URL; u != "" {
+		return strings.TrimSuffix(u, "/")
+	}
+	return "http://" + s.config.Server.Web.Listen
+}
+
+// LoginURL returns a link signing the browser in as user. It is valid for
+// a few minutes, and only once.
+func (s *Server) LoginURL(user *access.UserInfo) (string, error) {
+	if user == nil || user.IsAnonymous {
+		return "", errors.New("only authenticated users can sign in to the web viewer")
+	}
+	t := s.signer.Sign("login", user.Name, time.Now().Add(loginLinkTTL))
+	return s.baseURL() + "/login?token=" + url.QueryEscape(t), nil
+}
+
+// useLogin marks a login link used, reporting false if it already was.
+// Used links are remembered until they expire.
+func (s *Server) useLogin(t string, expires time.Time) bool {
+	s.loginMu.Lock()
+	defer s.loginMu.Unlock()
+
+	now := time.Now()
+	for used, exp := range s.usedLogins {
+		if now.After(exp) {
+			delete(s.usedLogins, used)
+		}
+	}
+	if _, used := s.usedLogins[t]; used {
+		return false
+	}
+	s.usedLogins[t] = expires
+	return true
+}
+
+// user returns the signed-in user of the request, or an anonymous user. A
+// user removed from the config since signing in is anonymous too.
+func (s *Server) user(r *http.Request) *access.UserInfo {
+	if c, err := r.Cookie(cookieName); err == nil {
+		if name, _, ok := s.signer.Verify("session", c.Value); ok {
+			if u := s.config.FindUserByName(name); u != nil && access.SourceAllowed(r.RemoteAddr, u.From) {
+				return &access.UserInfo{Name: u.Name, IsAdmin: u.Admin, RemoteAddr: r.RemoteAddr}
+			}
+		}
+	}
+	return &access.UserInfo{IsAnonymous: true, AnonymousName: "web", RemoteAddr: r.RemoteAddr}
+}
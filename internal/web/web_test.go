@@ -0,0 +1,138 @@
+package web
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/johan-st/sqlite-tui/internal/access"
+	"github.com/johan-st/sqlite-tui/internal/config"
+	"github.com/johan-st/sqlite-tui/internal/database"
+	"github.com/johan-st/sqlite-tui/internal/testutil"
+)
+
+// testViewer serves the web viewer for cfg over httptest.
+func testViewer(t *testing.T, cfg *config.Config) (*Server, *httptest.Server) {
+	t.Helper()
+	t.Chdir(t.TempDir()) // the signing key goes in the data directory
+
+	manager, err := database.NewManager(cfg)
+	if err != nil {
+		t.Fatalf("failed to create manager: %v", err)
+	}
+	if err := manager.Start(); err != nil {
+		t.Fatalf("failed to start manager: %v", err)
+	}
+	t.Cleanup(manager.Stop)
+
+	s, err := NewServer(cfg, manager)
+	if err != nil {
+		t.Fatalf("failed to create web viewer: %v", err)
+	}
+	ts := httptest.NewServer(s.routes())
+	t.Cleanup(ts.Close)
+	cfg.Server.Web.URL = ts.URL
+	return s, ts
+}
+
+// get fetches path with the client and returns the status and body.
+func get(t *testing.T, client *http.Client, url string) (int, string) {
+	t.Helper()
+	resp, err := client.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(body)
+}
+
+func queryURL(base, db, q string) string {
+	return base + "/db/" + db + "/query?q=" + url.QueryEscape(q)
+}
+
+func TestServer_LoginOnce(t *testing.T) {
+	dbPath, cleanup := testutil.TestDB(t, "users.db")
+	defer cleanup()
+
+	cfg := &config.Config{
+		Databases: []config.DatabaseSource{{Path: dbPath, Alias: "test"}},
+		Users:     []config.User{{Name: "reader", Access: []config.AccessRule{{Pattern: "*", Level: "read-only"}}}},
+	}
+	s, _ := testViewer(t, cfg)
+
+	link, err := s.LoginURL(&access.UserInfo{Name: "reader"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	noRedirect := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	if code, _ := get(t, noRedirect, link); code != http.StatusSeeOther {
+		t.Errorf("first use: expected a redirect, got %d", code)
+	}
+	if code, body := get(t, noRedirect, link); code != http.StatusForbidden || !strings.Contains(body, "already used") {
+		t.Errorf("second use: expected 403, got %d", code)
+	}
+}
+
+func TestServer_QueriesThroughManager(t *testing.T) {
+	dbPath, cleanup := testutil.TestDB(t, "users.db")
+	defer cleanup()
+
+	cfg := &config.Config{
+		Databases:       []config.DatabaseSource{{Path: dbPath, Alias: "test"}},
+		AnonymousAccess: "read-write",
+		QueryLimits: config.QueryLimitsConfig{
+			Anonymous: config.QueryLimit{MaxRows: 2, QueriesPerMinute: 100},
+		},
+		AnonymousQuota: config.AnonymousQuotaConfig{MaxQueries: 4},
+	}
+	_, ts := testViewer(t, cfg)
+	client := ts.Client()
+
+	// The level's row cap applies
+	_, body := get(t, client, queryURL(ts.URL, "test", "SELECT * FROM users"))
+	if !strings.Contains(body, "2 rows") || !strings.Contains(body, "limited to 2 rows") {
+		t.Errorf("expected 2 rows, capped by the query limit:\n%s", body)
+	}
+
+	// Writes are refused even with write access
+	code, _ := get(t, client, queryURL(ts.URL, "test", "DELETE FROM users"))
+	if code != http.StatusBadRequest {
+		t.Errorf("expected DELETE to be refused, got %d", code)
+	}
+	_, body = get(t, client, queryURL(ts.URL, "test", "WITH x AS (SELECT 1) SELECT * FROM x"))
+	if strings.Contains(body, "denied") {
+		t.Errorf("expected a read to run:\n%s", body)
+	}
+
+	// Browsing a table counts too; the fourth query uses up the quota
+	if _, body = get(t, client, ts.URL+"/db/test/table/users"); strings.Contains(body, "quota") {
+		t.Errorf("expected the table to show:\n%s", body)
+	}
+	get(t, client, queryURL(ts.URL, "test", "SELECT 1"))
+	if _, body = get(t, client, queryURL(ts.URL, "test", "SELECT 1")); !strings.Contains(body, "anonymous quota exceeded") {
+		t.Errorf("expected the anonymous quota to be used up:\n%s", body)
+	}
+}
+
+func TestServer_QueryRateLimit(t *testing.T) {
+	dbPath, cleanup := testutil.TestDB(t, "users.db")
+	defer cleanup()
+
+	cfg := &config.Config{
+		Databases:       []config.DatabaseSource{{Path: dbPath, Alias: "test"}},
+		AnonymousAccess: "read-only",
+		QueryLimits: config.QueryLimitsConfig{
+			Anonymous: config.QueryLimit{QueriesPerMinute: 1},
+		},
+	}
+	_, ts := testViewer(t, cfg)
+
+	get(t, ts.Client(), queryURL(ts.URL, "test", "SELECT 1"))
+	if _, body := get(t, ts.Client(), queryURL(ts.URL, "test", "SELECT 1")); !strings.Contains(body, "rate limit exceeded") {
+		t.Errorf("expected the second query to be rate limited:\n%s", body)
+	}
+}
@@ -0,0 +1,234 @@
+// Package sqlitetui embeds the sqlite-tui SSH database studio in other Go
+// programs. It is the supported public API: the types below are aliases of
+// the implementation under internal/, so values can be passed between them
+// freely, and only what is exported here is kept stable.
+//
+// Most programs only need New:
+//
+//	cfg, err := sqlitetui.LoadConfig("config.yaml")
+//	...
+//	studio, err := sqlitetui.New(cfg, "v1.2.3")
+//	...
+//	defer studio.Close()
+//	log.Fatal(studio.ListenAndServe())
+//
+// The building blocks (Manager, Resolver, Server, CLIHandler) can also be
+// assembled by hand, for example to run CLI commands against a Manager
+// without an SSH server.
+package sqlitetui
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+
+	"github.com/charmbracelet/wish/bubbletea"
+	"github.com/johan-st/sqlite-tui/internal/access"
+	"github.com/johan-st/sqlite-tui/internal/api"
+	"github.com/johan-st/sqlite-tui/internal/cli"
+	"github.com/johan-st/sqlite-tui/internal/config"
+	"github.com/johan-st/sqlite-tui/internal/database"
+	"github.com/johan-st/sqlite-tui/internal/history"
+	"github.com/johan-st/sqlite-tui/internal/server"
+	"github.com/johan-st/sqlite-tui/internal/tui"
+)
+
+// Configuration.
+type (
+	Config         = config.Config
+	DatabaseSource = config.DatabaseSource
+	User           = config.User
+	AccessRule     = config.AccessRule
+)
+
+// Access control.
+type (
+	Resolver = access.Resolver
+	UserInfo = access.UserInfo
+	Level    = access.Level
+)
+
+// Access levels.
+const (
+	None      = access.None
+	ReadOnly  = access.ReadOnly
+	ReadWrite = access.ReadWrite
+	Admin     = access.Admin
+)
+
+// Databases, history, the SSH server and command handlers.
+type (
+	Manager      = database.Manager
+	DatabaseInfo = database.DatabaseInfo
+	QueryResult  = database.QueryResult
+	HistoryStore = history.Store
+	Server       = server.Server
+	CLIHandler   = cli.Handler
+	LocalContext = cli.LocalContext
+	ExitError    = cli.ExitError
+	APIService   = api.Service
+	APIServer    = api.Server
+	Driver       = database.Driver
+	DSNParams    = database.DSNParams
+)
+
+// LoadConfig reads and validates a YAML config file.
+func LoadConfig(path string) (*Config, error) {
+	return config.Load(path)
+}
+
+// DefaultConfig returns a config with default settings and no databases.
+func DefaultConfig() *Config {
+	return config.DefaultConfig()
+}
+
+// NewResolver creates an empty access resolver. Config.BuildResolver
+// creates one from the config's users and rules.
+func NewResolver() *Resolver {
+	return access.NewResolver()
+}
+
+// NewManager creates a database manager. Call Start to begin discovery.
+func NewManager(cfg *Config) (*Manager, error) {
+	return database.NewManager(cfg)
+}
+
+// SetDriver makes databases opened from now on use another SQLite driver,
+// such as one built with SQLCipher for databases configured with a key.
+// Call it before NewManager.
+func SetDriver(d Driver) {
+	database.SetDriver(d)
+}
+
+// OpenHistoryStore opens the query history and audit database in dataDir.
+func OpenHistoryStore(dataDir string) (*HistoryStore, error) {
+	return history.NewStore(dataDir)
+}
+
+// NewServer creates the SSH server. Set its handlers with SetCLIHandler and
+// SetTUIHandler before serving. historyStore may be nil.
+func NewServer(cfg *Config, manager *Manager, historyStore *HistoryStore) *Server {
+	return server.NewServer(cfg, manager, historyStore)
+}
+
+// NewCLIHandler creates the handler for CLI commands. historyStore may be
+// nil, which disables history and audit commands.
+func NewCLIHandler(manager *Manager, historyStore *HistoryStore, version string) *CLIHandler {
+	return cli.NewHandler(manager, historyStore, version)
+}
+
+// NewLocalContext creates a context for running a CLI command without an
+// SSH session, with CLIHandler.HandleLocal.
+func NewLocalContext(user *UserInfo, args []string, out, errOut io.Writer) *LocalContext {
+	return cli.NewLocalContext(user, args, out, errOut)
+}
+
+// TUIHandler returns the Bubble Tea handler for interactive SSH sessions.
+func TUIHandler(manager *Manager, historyStore *HistoryStore) bubbletea.Handler {
+	return tui.Handler(manager, historyStore)
+}
+
+// NewAPIService creates the programmatic API service; see WithUser.
+// Queries are recorded in historyStore if it is not nil.
+func NewAPIService(manager *Manager, historyStore *HistoryStore) *APIService {
+	return api.NewService(manager, historyStore)
+}
+
+// NewAPIServer creates the authenticated gRPC API server. Server starts one
+// itself when server.api.listen is set; embedders can also call Serve with
+// a listener of their own.
+func NewAPIServer(cfg *Config, manager *Manager, historyStore *HistoryStore) (*APIServer, error) {
+	return api.NewServer(cfg, manager, historyStore)
+}
+
+// WithUser attaches an authenticated user to a context for APIService.
+func WithUser(ctx context.Context, user *UserInfo) context.Context {
+	return api.WithUser(ctx, user)
+}
+
+// Studio is a fully wired SSH database studio: history store, database
+// manager, CLI and TUI handlers and the SSH server.
+type Studio struct {
+	Config  *Config
+	Manager *Manager
+	History *HistoryStore
+	CLI     *CLIHandler
+	Server  *Server
+
+	watcher *config.Watcher
+}
+
+// New opens the history store, starts database discovery and creates the
+// SSH server for cfg. Close releases everything New opened.
+func New(cfg *Config, version string) (*Studio, error) {
+	historyStore, err := history.NewStore(cfg.GetDataDir())
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize history store: %w", err)
+	}
+
+	manager, err := database.NewManager(cfg)
+	if err != nil {
+		historyStore.Close()
+		return nil, fmt.Errorf("failed to initialize database manager: %w", err)
+	}
+	if err := manager.Start(); err != nil {
+		historyStore.Close()
+		return nil, fmt.Errorf("failed to start database manager: %w", err)
+	}
+
+	s := &Studio{
+		Config:  cfg,
+		Manager: manager,
+		History: historyStore,
+		CLI:     cli.NewHandler(manager, historyStore, version),
+		Server:  server.NewServer(cfg, manager, historyStore),
+	}
+	s.Server.SetCLIHandler(s.CLI.Handle)
+	s.Server.SetTUIHandler(tui.Handler(manager, historyStore))
+	return s, nil
+}
+
+// WatchConfig reloads the config file when it changes or on SIGHUP and
+// applies new users, access rules and database sources. onReload, if not
+// nil, is called after each reload.
+func (s *Studio) WatchConfig(onReload func(*Config)) error {
+	watcher, err := config.NewWatcher(s.Config)
+	if err != nil {
+		return err
+	}
+	watcher.OnReload(func(newCfg *Config) {
+		slog.Debug("Updating resolver and database sources")
+		s.Manager.UpdateResolver(newCfg.BuildResolver())
+		s.Manager.GetDiscovery().UpdateSources(newCfg.Databases)
+		if onReload != nil {
+			onReload(newCfg)
+		}
+	})
+	if err := watcher.Start(); err != nil {
+		watcher.Stop()
+		return err
+	}
+	s.watcher = watcher
+	return nil
+}
+
+// ListenAndServe serves SSH until the server is shut down.
+func (s *Studio) ListenAndServe() error {
+	return s.Server.ListenAndServe()
+}
+
+// Shutdown gracefully stops the SSH server.
+func (s *Studio) Shutdown(ctx context.Context) error {
+	return s.Server.Shutdown(ctx)
+}
+
+// Close stops config watching and database discovery and closes the
+// history store. Shut the server down first.
+func (s *Studio) Close() error {
+	if s.watcher != nil {
+		s.watcher.Stop()
+	}
+	s.Manager.Stop()
+	return s.History.Close()
+}